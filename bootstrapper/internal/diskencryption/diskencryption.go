@@ -60,6 +60,22 @@ func (c *DiskEncryption) UpdatePassphrase(passphrase string) error {
 	return c.device.SetConstellationStateDiskToken(cryptsetup.SetDiskInitialized)
 }
 
+// SetKeyVersion records the version of the state disk key the passphrase was derived from.
+// Only works after calling Open().
+func (c *DiskEncryption) SetKeyVersion(version uint32) error {
+	return c.device.SetConstellationStateDiskKeyVersion(version)
+}
+
+// AddRecoveryKey adds a keyslot for the escrowed recovery key and records it in the Constellation state disk token.
+// Only works after calling Open().
+func (c *DiskEncryption) AddRecoveryKey(passphrase, recoveryKey string) error {
+	recoveryKeyslot, err := c.device.KeyslotAddByPassphrase(passphrase, recoveryKey)
+	if err != nil {
+		return fmt.Errorf("adding keyslot for recovery key: %w", err)
+	}
+	return c.device.SetConstellationStateDiskRecoveryKeyslot(recoveryKeyslot)
+}
+
 // MarkDiskForReset marks the state disk as not initialized so it may be wiped (reset) on reboot.
 func (c *DiskEncryption) MarkDiskForReset() error {
 	return c.device.SetConstellationStateDiskToken(cryptsetup.SetDiskNotInitialized)
@@ -79,4 +95,7 @@ type cryptdevice interface {
 	GetUUID() (string, error)
 	KeyslotChangeByPassphrase(currentKeyslot int, newKeyslot int, currentPassphrase string, newPassphrase string) error
 	SetConstellationStateDiskToken(bool) error
+	SetConstellationStateDiskKeyVersion(uint32) error
+	KeyslotAddByPassphrase(passphrase, newPassphrase string) (int, error)
+	SetConstellationStateDiskRecoveryKeyslot(keyslot int) error
 }
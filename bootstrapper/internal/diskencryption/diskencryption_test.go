@@ -70,10 +70,46 @@ func TestUpdatePassphrase(t *testing.T) {
 	}
 }
 
+func TestAddRecoveryKey(t *testing.T) {
+	testCases := map[string]struct {
+		keyslotAddErr error
+		wantErr       bool
+	}{
+		"adding recovery key works": {},
+		"adding keyslot can fail": {
+			keyslotAddErr: errors.New("keyslotAddErr"),
+			wantErr:       true,
+		},
+	}
+
+	for name, tc := range testCases {
+		t.Run(name, func(t *testing.T) {
+			assert := assert.New(t)
+
+			device := &stubCryptdevice{recoveryKeyslot: -1, keyslotAddErr: tc.keyslotAddErr}
+			crypt := DiskEncryption{
+				fs:     afero.NewMemMapFs(),
+				device: device,
+			}
+
+			err := crypt.AddRecoveryKey("key", "recovery-key")
+			if tc.wantErr {
+				assert.Error(err)
+				assert.Equal(-1, device.recoveryKeyslot)
+				return
+			}
+			assert.NoError(err)
+			assert.Equal(1, device.recoveryKeyslot)
+		})
+	}
+}
+
 type stubCryptdevice struct {
 	uuid             string
 	uuidErr          error
 	keyslotChangeErr error
+	keyslotAddErr    error
+	recoveryKeyslot  int
 }
 
 func (s *stubCryptdevice) InitByName(_ string) (func(), error) {
@@ -91,3 +127,16 @@ func (s *stubCryptdevice) KeyslotChangeByPassphrase(_, _ int, _, _ string) error
 func (s *stubCryptdevice) SetConstellationStateDiskToken(bool) error {
 	return nil
 }
+
+func (s *stubCryptdevice) SetConstellationStateDiskKeyVersion(uint32) error {
+	return nil
+}
+
+func (s *stubCryptdevice) KeyslotAddByPassphrase(_, _ string) (int, error) {
+	return 1, s.keyslotAddErr
+}
+
+func (s *stubCryptdevice) SetConstellationStateDiskRecoveryKeyslot(keyslot int) error {
+	s.recoveryKeyslot = keyslot
+	return nil
+}
@@ -296,7 +296,7 @@ func (c *JoinClient) startNodeAndJoin(ticket *joinproto.IssueJoinTicketResponse,
 
 	cleaner.Clean()
 
-	if err := c.updateDiskPassphrase(string(ticket.StateDiskKey)); err != nil {
+	if err := c.updateDiskPassphrase(string(ticket.StateDiskKey), ticket.StateDiskKeyVersion, ticket.StateDiskRecoveryKey); err != nil {
 		return fmt.Errorf("updating disk passphrase: %w", err)
 	}
 
@@ -382,13 +382,24 @@ func (c *JoinClient) getNodeMetadata() error {
 	return nil
 }
 
-func (c *JoinClient) updateDiskPassphrase(passphrase string) error {
+func (c *JoinClient) updateDiskPassphrase(passphrase string, keyVersion uint32, recoveryKey []byte) error {
 	free, err := c.disk.Open()
 	if err != nil {
 		return fmt.Errorf("opening disk: %w", err)
 	}
 	defer free()
-	return c.disk.UpdatePassphrase(passphrase)
+	if err := c.disk.UpdatePassphrase(passphrase); err != nil {
+		return err
+	}
+	if keyVersion != 0 {
+		if err := c.disk.SetKeyVersion(keyVersion); err != nil {
+			return err
+		}
+	}
+	if recoveryKey == nil {
+		return nil
+	}
+	return c.disk.AddRecoveryKey(passphrase, string(recoveryKey))
 }
 
 func (c *JoinClient) getDiskUUID() (string, error) {
@@ -468,6 +479,10 @@ type encryptedDisk interface {
 	UUID() (string, error)
 	// UpdatePassphrase switches the initial random passphrase of the encrypted disk to a permanent passphrase.
 	UpdatePassphrase(passphrase string) error
+	// SetKeyVersion records the version of the state disk key the passphrase was derived from.
+	SetKeyVersion(version uint32) error
+	// AddRecoveryKey adds a keyslot for the escrowed recovery key.
+	AddRecoveryKey(passphrase, recoveryKey string) error
 }
 
 type cleaner interface {
@@ -58,6 +58,8 @@ func TestClient(t *testing.T) {
 	}
 	caDerivationKey := make([]byte, 256)
 	respCaKey := &joinproto.IssueJoinTicketResponse{AuthorizedCaPublicKey: caDerivationKey}
+	recoveryKey := []byte("recovery-key")
+	respRecoveryKey := &joinproto.IssueJoinTicketResponse{AuthorizedCaPublicKey: caDerivationKey, StateDiskRecoveryKey: recoveryKey}
 
 	// TODO: fix test since keys are generated with systemd service
 	makeIssueJoinTicketAnswerWithValidCert := func(t *testing.T, originalAnswer issueJoinTicketAnswer, fh file.Handler) issueJoinTicketAnswer {
@@ -123,6 +125,7 @@ func TestClient(t *testing.T) {
 		wantNumJoins        int
 		wantNotMatchingCert bool
 		wantCertNotExisting bool
+		wantRecoveryKey     []byte
 	}{
 		"on worker: metadata self: errors occur": {
 			role: role.Worker,
@@ -140,6 +143,20 @@ func TestClient(t *testing.T) {
 			wantJoin:      true,
 			wantLock:      true,
 		},
+		"on worker: escrowed recovery key is added": {
+			role: role.Worker,
+			apiAnswers: []any{
+				selfAnswer{instance: workerSelf},
+				listAnswer{instances: peers},
+				issueJoinTicketAnswer{resp: respRecoveryKey},
+			},
+			clusterJoiner:   &stubClusterJoiner{},
+			nodeLock:        newFakeLock(),
+			disk:            &stubDisk{},
+			wantJoin:        true,
+			wantLock:        true,
+			wantRecoveryKey: recoveryKey,
+		},
 		"on worker: SSH host cert not matching": {
 			role: role.Worker,
 			apiAnswers: []any{
@@ -392,6 +409,9 @@ func TestClient(t *testing.T) {
 			if tc.wantNumJoins > 0 {
 				assert.GreaterOrEqual(tc.clusterJoiner.joinClusterCalled, tc.wantNumJoins)
 			}
+			if tc.wantRecoveryKey != nil {
+				assert.Equal(string(tc.wantRecoveryKey), tc.disk.(*stubDisk).recoveryKey)
+			}
 			if tc.wantLock {
 				assert.False(client.nodeLock.TryLockOnce(nil)) // lock should be locked
 			} else {
@@ -484,6 +504,8 @@ type stubDisk struct {
 	uuidErr                error
 	updatePassphraseErr    error
 	updatePassphraseCalled bool
+	keyVersion             uint32
+	recoveryKey            string
 }
 
 func (d *stubDisk) Open() (func(), error) {
@@ -499,6 +521,16 @@ func (d *stubDisk) UpdatePassphrase(string) error {
 	return d.updatePassphraseErr
 }
 
+func (d *stubDisk) SetKeyVersion(version uint32) error {
+	d.keyVersion = version
+	return nil
+}
+
+func (d *stubDisk) AddRecoveryKey(_, recoveryKey string) error {
+	d.recoveryKey = recoveryKey
+	return nil
+}
+
 func (d *stubDisk) MarkDiskForReset() error {
 	return nil
 }
@@ -63,6 +63,7 @@ func NewRootCmd() *cobra.Command {
 	rootCmd.AddCommand(cmd.NewInitCmd())
 	rootCmd.AddCommand(cmd.NewSSHCmd())
 	rootCmd.AddCommand(cmd.NewMaaPatchCmd())
+	rootCmd.AddCommand(cmd.NewMasterSecretCmd())
 
 	return rootCmd
 }
@@ -398,7 +398,11 @@ func (a *applyCmd) apply(
 	// Apply Attestation Config
 	if !a.flags.skipPhases.contains(skipAttestationConfigPhase) {
 		a.log.Debug("Applying new attestation config to cluster")
-		if err := a.applyJoinConfig(cmd, conf.GetAttestationConfig(), stateFile.ClusterValues.MeasurementSalt); err != nil {
+		imageVersion, err := configuredImageVersion(conf)
+		if err != nil {
+			return err
+		}
+		if err := a.applyJoinConfig(cmd, conf.GetAttestationConfig(), stateFile.ClusterValues.MeasurementSalt, imageVersion); err != nil {
 			return fmt.Errorf("applying attestation config: %w", err)
 		}
 	}
@@ -595,14 +599,15 @@ func (a *applyCmd) validateInputs(cmd *cobra.Command, configFetcher attestationc
 
 // applyJoinConfig creates or updates the cluster's join config.
 // If the config already exists, and is different from the new config, the user is asked to confirm the upgrade.
-func (a *applyCmd) applyJoinConfig(cmd *cobra.Command, newConfig config.AttestationCfg, measurementSalt []byte,
+// The measurements of the image currently used by the cluster stay allowed until the upgrade to imageVersion is completed.
+func (a *applyCmd) applyJoinConfig(cmd *cobra.Command, newConfig config.AttestationCfg, measurementSalt []byte, imageVersion semver.Semver,
 ) error {
 	clusterAttestationConfig, err := a.applier.GetClusterAttestationConfig(cmd.Context(), newConfig.GetVariant())
 	if err != nil {
 		a.log.Debug(fmt.Sprintf("Getting cluster attestation config failed: %q", err))
 		if k8serrors.IsNotFound(err) {
 			a.log.Debug("Creating new join config")
-			return a.applier.ApplyJoinConfig(cmd.Context(), newConfig, measurementSalt)
+			return a.applier.ApplyJoinConfig(cmd.Context(), newConfig, measurementSalt, imageVersion)
 		}
 		return fmt.Errorf("getting cluster attestation config: %w", err)
 	}
@@ -634,7 +639,7 @@ func (a *applyCmd) applyJoinConfig(cmd *cobra.Command, newConfig config.Attestat
 		}
 	}
 
-	if err := a.applier.ApplyJoinConfig(cmd.Context(), newConfig, measurementSalt); err != nil {
+	if err := a.applier.ApplyJoinConfig(cmd.Context(), newConfig, measurementSalt, imageVersion); err != nil {
 		return fmt.Errorf("updating attestation config: %w", err)
 	}
 	cmd.Println("Successfully updated the cluster's attestation config")
@@ -651,13 +656,9 @@ func (a *applyCmd) runNodeImageUpgrade(cmd *cobra.Command, conf *config.Config)
 		return fmt.Errorf("fetching image reference: %w", err)
 	}
 
-	imageVersionInfo, err := versionsapi.NewVersionFromShortPath(conf.Image, versionsapi.VersionKindImage)
+	imageVersion, err := configuredImageVersion(conf)
 	if err != nil {
-		return fmt.Errorf("parsing version from image short path: %w", err)
-	}
-	imageVersion, err := semver.New(imageVersionInfo.Version())
-	if err != nil {
-		return fmt.Errorf("parsing image version: %w", err)
+		return err
 	}
 
 	err = a.applier.UpgradeNodeImage(cmd.Context(), imageVersion, imageReference, a.flags.force)
@@ -674,6 +675,19 @@ func (a *applyCmd) runNodeImageUpgrade(cmd *cobra.Command, conf *config.Config)
 	return nil
 }
 
+// configuredImageVersion returns the version of the image configured in the config.
+func configuredImageVersion(conf *config.Config) (semver.Semver, error) {
+	imageVersionInfo, err := versionsapi.NewVersionFromShortPath(conf.Image, versionsapi.VersionKindImage)
+	if err != nil {
+		return semver.Semver{}, fmt.Errorf("parsing version from image short path: %w", err)
+	}
+	imageVersion, err := semver.New(imageVersionInfo.Version())
+	if err != nil {
+		return semver.Semver{}, fmt.Errorf("parsing image version: %w", err)
+	}
+	return imageVersion, nil
+}
+
 func (a *applyCmd) runK8sVersionUpgrade(cmd *cobra.Command, conf *config.Config) error {
 	err := a.applier.UpgradeKubernetesVersion(cmd.Context(), conf.KubernetesVersion, a.flags.force)
 	var upgradeErr *compatibility.InvalidUpgradeError
@@ -855,7 +869,7 @@ type applier interface {
 
 	ExtendClusterConfigCertSANs(ctx context.Context, clusterEndpoint, customEndpoint string, additionalAPIServerCertSANs []string) error
 	GetClusterAttestationConfig(ctx context.Context, variant variant.Variant) (config.AttestationCfg, error)
-	ApplyJoinConfig(ctx context.Context, newAttestConfig config.AttestationCfg, measurementSalt []byte) error
+	ApplyJoinConfig(ctx context.Context, newAttestConfig config.AttestationCfg, measurementSalt []byte, imageVersion semver.Semver) error
 	UpgradeNodeImage(ctx context.Context, imageVersion semver.Semver, imageReference string, force bool) error
 	UpgradeKubernetesVersion(ctx context.Context, kubernetesVersion versions.ValidK8sVersion, force bool) error
 	BackupCRDs(ctx context.Context, fileHandler file.Handler, upgradeDir string) ([]apiextensionsv1.CustomResourceDefinition, error)
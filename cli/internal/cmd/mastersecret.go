@@ -0,0 +1,136 @@
+/*
+Copyright (c) Edgeless Systems GmbH
+
+SPDX-License-Identifier: BUSL-1.1
+*/
+
+package cmd
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/edgelesssys/constellation/v2/internal/constants"
+	"github.com/edgelesssys/constellation/v2/internal/constellation/kubecmd"
+	"github.com/edgelesssys/constellation/v2/internal/crypto"
+	"github.com/edgelesssys/constellation/v2/internal/file"
+	"github.com/edgelesssys/constellation/v2/internal/kms/uri"
+	"github.com/spf13/afero"
+	"github.com/spf13/cobra"
+)
+
+// NewMasterSecretCmd returns a new cobra.Command for managing the master secret of a cluster.
+func NewMasterSecretCmd() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "master-secret",
+		Short: "Manage the master secret of a Constellation cluster",
+		Long:  "Manage the master secret of a Constellation cluster.",
+		Args:  cobra.ExactArgs(0),
+	}
+
+	cmd.AddCommand(newMasterSecretRotateCmd())
+
+	return cmd
+}
+
+func newMasterSecretRotateCmd() *cobra.Command {
+	return &cobra.Command{
+		Use:   "rotate",
+		Short: "Rotate the master secret of a Constellation cluster",
+		Long: "Rotate the master secret of a Constellation cluster.\n\n" +
+			"A new master secret is added to the master secret file and the cluster. New versions of keys are derived from the new master secret.\n" +
+			"State disks are re-keyed when their nodes rejoin the cluster, other keys when they are rotated the next time.\n" +
+			"Previous master secrets are kept in the master secret file and the cluster, as they are needed to decrypt data encrypted with older keys.",
+		Args: cobra.NoArgs,
+		RunE: runMasterSecretRotate,
+	}
+}
+
+func runMasterSecretRotate(cmd *cobra.Command, _ []string) error {
+	log, err := newCLILogger(cmd)
+	if err != nil {
+		return fmt.Errorf("creating logger: %w", err)
+	}
+	fileHandler := file.NewHandler(afero.NewOsFs())
+
+	r := &masterSecretRotateCmd{log: log, fileHandler: fileHandler}
+	if err := r.flags.parse(cmd.Flags()); err != nil {
+		return err
+	}
+
+	kubeConfig, err := fileHandler.Read(constants.AdminConfFilename)
+	if err != nil {
+		return fmt.Errorf("reading kubeconfig: %w", err)
+	}
+	kubeClient, err := kubecmd.New(kubeConfig, log)
+	if err != nil {
+		return fmt.Errorf("setting up kubernetes client: %w", err)
+	}
+
+	return r.rotate(cmd, kubeClient, generateMasterSecretRotation)
+}
+
+type masterSecretRotateCmd struct {
+	log         debugLog
+	fileHandler file.Handler
+	flags       rootFlags
+}
+
+// rotate adds a new generation to the master secret file and applies it to the cluster.
+// If the master secret file already holds a generation the cluster doesn't know, e.g., because
+// a previous rotation failed, that generation is applied instead of generating a new one.
+func (r *masterSecretRotateCmd) rotate(
+	cmd *cobra.Command, applier masterSecretApplier, generate func() (uri.MasterSecretRotation, error),
+) error {
+	var masterSecret uri.MasterSecret
+	if err := r.fileHandler.ReadJSON(constants.MasterSecretFilename, &masterSecret); err != nil {
+		return fmt.Errorf("reading master secret (does %q exist?): %w", r.flags.pathPrefixer.PrefixPrintablePath(constants.MasterSecretFilename), err)
+	}
+
+	r.log.Debug("Applying pending rotations of the master secret", "generation", masterSecret.Generation())
+	applied, err := applier.ApplyMasterSecret(cmd.Context(), masterSecret)
+	if err != nil {
+		return fmt.Errorf("applying master secret: %w", err)
+	}
+	if applied {
+		cmd.Printf("Applied pending rotation of the master secret to generation %d.\n", masterSecret.Generation())
+		return nil
+	}
+
+	rotation, err := generate()
+	if err != nil {
+		return fmt.Errorf("generating master secret: %w", err)
+	}
+	masterSecret.Rotations = append(masterSecret.Rotations, rotation)
+
+	// Write the master secret file first, so the new master secret is never only known to the cluster.
+	if err := r.fileHandler.WriteJSON(constants.MasterSecretFilename, masterSecret, file.OptOverwrite); err != nil {
+		return fmt.Errorf("writing master secret: %w", err)
+	}
+	r.log.Debug("Wrote rotated master secret", "generation", masterSecret.Generation())
+
+	if _, err := applier.ApplyMasterSecret(cmd.Context(), masterSecret); err != nil {
+		return fmt.Errorf("applying rotated master secret, run the command again to retry: %w", err)
+	}
+	cmd.Printf("Rotated the master secret to generation %d and wrote it to %q.\n",
+		masterSecret.Generation(), r.flags.pathPrefixer.PrefixPrintablePath(constants.MasterSecretFilename))
+	cmd.Println("State disks are re-keyed when their nodes rejoin the cluster, other keys when they are rotated the next time.")
+	return nil
+}
+
+// generateMasterSecretRotation generates a new master secret and salt.
+func generateMasterSecretRotation() (uri.MasterSecretRotation, error) {
+	key, err := crypto.GenerateRandomBytes(crypto.MasterSecretLengthDefault)
+	if err != nil {
+		return uri.MasterSecretRotation{}, err
+	}
+	salt, err := crypto.GenerateRandomBytes(crypto.RNGLengthDefault)
+	if err != nil {
+		return uri.MasterSecretRotation{}, err
+	}
+	return uri.MasterSecretRotation{Key: key, Salt: salt}, nil
+}
+
+type masterSecretApplier interface {
+	ApplyMasterSecret(ctx context.Context, masterSecret uri.MasterSecret) (bool, error)
+}
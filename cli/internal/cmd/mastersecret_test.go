@@ -0,0 +1,132 @@
+/*
+Copyright (c) Edgeless Systems GmbH
+
+SPDX-License-Identifier: BUSL-1.1
+*/
+
+package cmd
+
+import (
+	"bytes"
+	"context"
+	"testing"
+
+	"github.com/edgelesssys/constellation/v2/internal/constants"
+	"github.com/edgelesssys/constellation/v2/internal/file"
+	"github.com/edgelesssys/constellation/v2/internal/kms/uri"
+	"github.com/edgelesssys/constellation/v2/internal/logger"
+	"github.com/spf13/afero"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestMasterSecretRotate(t *testing.T) {
+	masterSecret := uri.MasterSecret{Key: []byte("key"), Salt: []byte("salt")}
+	rotation := uri.MasterSecretRotation{Key: []byte("key-1"), Salt: []byte("salt-1")}
+
+	testCases := map[string]struct {
+		masterSecret     *uri.MasterSecret
+		applier          *stubMasterSecretApplier
+		generateErr      error
+		wantMasterSecret uri.MasterSecret
+		wantApplied      []uint32
+		wantErr          bool
+	}{
+		"rotate": {
+			masterSecret: &masterSecret,
+			applier:      &stubMasterSecretApplier{},
+			wantMasterSecret: uri.MasterSecret{
+				Key: masterSecret.Key, Salt: masterSecret.Salt, Rotations: []uri.MasterSecretRotation{rotation},
+			},
+			wantApplied: []uint32{0, 1},
+		},
+		"pending rotation is applied": {
+			masterSecret: &uri.MasterSecret{
+				Key: masterSecret.Key, Salt: masterSecret.Salt, Rotations: []uri.MasterSecretRotation{rotation},
+			},
+			applier: &stubMasterSecretApplier{changed: true},
+			wantMasterSecret: uri.MasterSecret{
+				Key: masterSecret.Key, Salt: masterSecret.Salt, Rotations: []uri.MasterSecretRotation{rotation},
+			},
+			wantApplied: []uint32{1},
+		},
+		"no master secret": {
+			applier: &stubMasterSecretApplier{},
+			wantErr: true,
+		},
+		"master secret mismatch": {
+			masterSecret:     &masterSecret,
+			applier:          &stubMasterSecretApplier{errs: []error{assert.AnError}},
+			wantMasterSecret: masterSecret,
+			wantApplied:      []uint32{0},
+			wantErr:          true,
+		},
+		"generating fails": {
+			masterSecret:     &masterSecret,
+			applier:          &stubMasterSecretApplier{},
+			generateErr:      assert.AnError,
+			wantMasterSecret: masterSecret,
+			wantApplied:      []uint32{0},
+			wantErr:          true,
+		},
+		"applying rotation fails": {
+			masterSecret: &masterSecret,
+			applier:      &stubMasterSecretApplier{errs: []error{nil, assert.AnError}},
+			wantMasterSecret: uri.MasterSecret{
+				Key: masterSecret.Key, Salt: masterSecret.Salt, Rotations: []uri.MasterSecretRotation{rotation},
+			},
+			wantApplied: []uint32{0, 1},
+			wantErr:     true,
+		},
+	}
+
+	for name, tc := range testCases {
+		t.Run(name, func(t *testing.T) {
+			assert := assert.New(t)
+			require := require.New(t)
+
+			fileHandler := file.NewHandler(afero.NewMemMapFs())
+			if tc.masterSecret != nil {
+				require.NoError(fileHandler.WriteJSON(constants.MasterSecretFilename, tc.masterSecret))
+			}
+
+			cmd := newMasterSecretRotateCmd()
+			cmd.SetOut(&bytes.Buffer{})
+			cmd.SetErr(&bytes.Buffer{})
+
+			r := &masterSecretRotateCmd{log: logger.NewTest(t), fileHandler: fileHandler}
+			generate := func() (uri.MasterSecretRotation, error) {
+				return rotation, tc.generateErr
+			}
+
+			err := r.rotate(cmd, tc.applier, generate)
+			if tc.wantErr {
+				assert.Error(err)
+			} else {
+				assert.NoError(err)
+			}
+			assert.Equal(tc.wantApplied, tc.applier.applied)
+			if tc.masterSecret == nil {
+				return
+			}
+			var gotMasterSecret uri.MasterSecret
+			require.NoError(fileHandler.ReadJSON(constants.MasterSecretFilename, &gotMasterSecret))
+			assert.Equal(tc.wantMasterSecret, gotMasterSecret)
+		})
+	}
+}
+
+type stubMasterSecretApplier struct {
+	changed bool
+	errs    []error
+	applied []uint32
+}
+
+func (s *stubMasterSecretApplier) ApplyMasterSecret(_ context.Context, masterSecret uri.MasterSecret) (bool, error) {
+	s.applied = append(s.applied, masterSecret.Generation())
+	var err error
+	if len(s.errs) > 0 {
+		err, s.errs = s.errs[0], s.errs[1:]
+	}
+	return s.changed, err
+}
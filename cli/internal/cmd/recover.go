@@ -43,12 +43,18 @@ func NewRecoverCmd() *cobra.Command {
 		RunE: runRecover,
 	}
 	cmd.Flags().StringP("endpoint", "e", "", "endpoint of the instance, passed as HOST[:PORT]")
+	cmd.Flags().String("recovery-kms-uri", "", "URI of the KMS holding the escrowed state disk recovery keys\n"+
+		"If set, the escrowed recovery key is used instead of the master secret.")
+	cmd.Flags().String("recovery-storage-uri", "", "URI of the storage backend of the KMS holding the escrowed state disk recovery keys\n"+
+		"Required if --recovery-kms-uri is set.")
 	return cmd
 }
 
 type recoverFlags struct {
 	rootFlags
-	endpoint string
+	endpoint           string
+	recoveryKMSURI     string
+	recoveryStorageURI string
 }
 
 func (f *recoverFlags) parse(flags *pflag.FlagSet) error {
@@ -61,6 +67,18 @@ func (f *recoverFlags) parse(flags *pflag.FlagSet) error {
 		return fmt.Errorf("getting 'endpoint' flag: %w", err)
 	}
 	f.endpoint = endpoint
+
+	recoveryKMSURI, err := flags.GetString("recovery-kms-uri")
+	if err != nil {
+		return fmt.Errorf("getting 'recovery-kms-uri' flag: %w", err)
+	}
+	f.recoveryKMSURI = recoveryKMSURI
+
+	recoveryStorageURI, err := flags.GetString("recovery-storage-uri")
+	if err != nil {
+		return fmt.Errorf("getting 'recovery-storage-uri' flag: %w", err)
+	}
+	f.recoveryStorageURI = recoveryStorageURI
 	return nil
 }
 
@@ -91,9 +109,8 @@ func (r *recoverCmd) recover(
 	cmd *cobra.Command, fileHandler file.Handler, interval time.Duration,
 	doer recoverDoerInterface, newDialer func(validator atls.Validator) *dialer.Dialer,
 ) error {
-	var masterSecret uri.MasterSecret
-	r.log.Debug(fmt.Sprintf("Loading master secret file from %q", r.flags.pathPrefixer.PrefixPrintablePath(constants.MasterSecretFilename)))
-	if err := fileHandler.ReadJSON(constants.MasterSecretFilename, &masterSecret); err != nil {
+	kmsURI, storageURI, useRecoveryKey, err := r.recoveryURIs(fileHandler)
+	if err != nil {
 		return err
 	}
 
@@ -136,8 +153,9 @@ func (r *recoverCmd) recover(
 	r.log.Debug("Created a new validator")
 	doer.setDialer(newDialer(validator), endpoint)
 	r.log.Debug(fmt.Sprintf("Set dialer for endpoint %q", endpoint))
-	doer.setURIs(masterSecret.EncodeToURI(), uri.NoStoreURI)
-	r.log.Debug("Set secrets")
+	doer.setURIs(kmsURI, storageURI)
+	doer.setUseRecoveryKey(useRecoveryKey)
+	r.log.Debug("Set secrets", "useRecoveryKey", useRecoveryKey)
 	if err := r.recoverCall(cmd.Context(), cmd.OutOrStdout(), interval, doer); err != nil {
 		if grpcRetry.ServiceIsUnavailable(err) {
 			return nil
@@ -147,6 +165,25 @@ func (r *recoverCmd) recover(
 	return nil
 }
 
+// recoveryURIs returns the KMS and storage URIs sent to the recovery server.
+// If a recovery KMS is configured, the escrowed recovery keys are used and the master secret is not required.
+func (r *recoverCmd) recoveryURIs(fileHandler file.Handler) (kmsURI, storageURI string, useRecoveryKey bool, err error) {
+	if r.flags.recoveryKMSURI != "" {
+		r.log.Debug(fmt.Sprintf("Using escrowed recovery keys from %q", r.flags.recoveryKMSURI))
+		if r.flags.recoveryStorageURI == "" || r.flags.recoveryStorageURI == uri.NoStoreURI {
+			return "", "", false, errors.New("flag --recovery-storage-uri is required when using escrowed recovery keys")
+		}
+		return r.flags.recoveryKMSURI, r.flags.recoveryStorageURI, true, nil
+	}
+
+	var masterSecret uri.MasterSecret
+	r.log.Debug(fmt.Sprintf("Loading master secret file from %q", r.flags.pathPrefixer.PrefixPrintablePath(constants.MasterSecretFilename)))
+	if err := fileHandler.ReadJSON(constants.MasterSecretFilename, &masterSecret); err != nil {
+		return "", "", false, err
+	}
+	return masterSecret.EncodeToURI(), uri.NoStoreURI, false, nil
+}
+
 func (r *recoverCmd) recoverCall(ctx context.Context, out io.Writer, interval time.Duration, doer recoverDoerInterface) error {
 	var err error
 	ctr := 0
@@ -204,14 +241,16 @@ type recoverDoerInterface interface {
 	Do(ctx context.Context) error
 	setDialer(dialer grpcDialer, endpoint string)
 	setURIs(kmsURI, storageURI string)
+	setUseRecoveryKey(useRecoveryKey bool)
 }
 
 type recoverDoer struct {
-	dialer     grpcDialer
-	endpoint   string
-	kmsURI     string // encodes masterSecret
-	storageURI string
-	log        debugLog
+	dialer         grpcDialer
+	endpoint       string
+	kmsURI         string // encodes masterSecret, or points to the KMS holding the escrowed recovery keys
+	storageURI     string
+	useRecoveryKey bool
+	log            debugLog
 }
 
 // Do performs the recover streaming rpc.
@@ -227,8 +266,9 @@ func (d *recoverDoer) Do(ctx context.Context) (retErr error) {
 	d.log.Debug("Created protoClient")
 
 	req := &recoverproto.RecoverMessage{
-		KmsUri:     d.kmsURI,
-		StorageUri: d.storageURI,
+		KmsUri:         d.kmsURI,
+		StorageUri:     d.storageURI,
+		UseRecoveryKey: d.useRecoveryKey,
 	}
 
 	_, err = protoClient.Recover(ctx, req)
@@ -249,3 +289,7 @@ func (d *recoverDoer) setURIs(kmsURI, storageURI string) {
 	d.kmsURI = kmsURI
 	d.storageURI = storageURI
 }
+
+func (d *recoverDoer) setUseRecoveryKey(useRecoveryKey bool) {
+	d.useRecoveryKey = useRecoveryKey
+}
@@ -70,8 +70,12 @@ func TestRecover(t *testing.T) {
 		doer               *stubDoer
 		masterSecret       testvector.HKDF
 		endpoint           string
+		recoveryKMSURI     string
+		recoveryStorageURI string
 		successfulCalls    int
 		skipConfigCreation bool
+		skipMasterSecret   bool
+		wantRecoveryKey    bool
 		wantErr            bool
 	}{
 		"works": {
@@ -130,6 +134,36 @@ func TestRecover(t *testing.T) {
 			masterSecret:    testvector.HKDFZero,
 			successfulCalls: 1,
 		},
+		"missing master secret": {
+			doer:             &stubDoer{returns: []error{nil}},
+			endpoint:         "192.0.2.90",
+			skipMasterSecret: true,
+			wantErr:          true,
+		},
+		"escrowed recovery key is used without master secret": {
+			doer:               &stubDoer{returns: []error{nil}},
+			endpoint:           "192.0.2.90",
+			recoveryKMSURI:     "gcp-kms://project/example/location/global/keyRing/ring/cryptoKey/key",
+			recoveryStorageURI: "storage://gcp?projectID=example&bucket=bucket",
+			skipMasterSecret:   true,
+			wantRecoveryKey:    true,
+			successfulCalls:    1,
+		},
+		"escrowed recovery key requires storage URI": {
+			doer:             &stubDoer{returns: []error{nil}},
+			endpoint:         "192.0.2.90",
+			recoveryKMSURI:   "gcp-kms://project/example/location/global/keyRing/ring/cryptoKey/key",
+			skipMasterSecret: true,
+			wantErr:          true,
+		},
+		"escrowed recovery key rejects no-store URI": {
+			doer:               &stubDoer{returns: []error{nil}},
+			endpoint:           "192.0.2.90",
+			recoveryKMSURI:     "gcp-kms://project/example/location/global/keyRing/ring/cryptoKey/key",
+			recoveryStorageURI: uri.NoStoreURI,
+			skipMasterSecret:   true,
+			wantErr:            true,
+		},
 	}
 
 	for name, tc := range testCases {
@@ -151,11 +185,13 @@ func TestRecover(t *testing.T) {
 				require.NoError(fileHandler.WriteYAML(constants.ConfigFilename, config))
 			}
 
-			require.NoError(fileHandler.WriteJSON(
-				constants.MasterSecretFilename,
-				uri.MasterSecret{Key: tc.masterSecret.Secret, Salt: tc.masterSecret.Salt},
-				file.OptNone,
-			))
+			if !tc.skipMasterSecret {
+				require.NoError(fileHandler.WriteJSON(
+					constants.MasterSecretFilename,
+					uri.MasterSecret{Key: tc.masterSecret.Secret, Salt: tc.masterSecret.Salt},
+					file.OptNone,
+				))
+			}
 			require.NoError(fileHandler.WriteYAML(
 				constants.StateFilename,
 				defaultStateFile(cloudprovider.GCP),
@@ -167,8 +203,10 @@ func TestRecover(t *testing.T) {
 				log:           logger.NewTest(t),
 				configFetcher: stubAttestationFetcher{},
 				flags: recoverFlags{
-					rootFlags: rootFlags{force: true},
-					endpoint:  tc.endpoint,
+					rootFlags:          rootFlags{force: true},
+					endpoint:           tc.endpoint,
+					recoveryKMSURI:     tc.recoveryKMSURI,
+					recoveryStorageURI: tc.recoveryStorageURI,
 				},
 			}
 			err := r.recover(cmd, fileHandler, time.Millisecond, tc.doer, newDialer)
@@ -181,6 +219,11 @@ func TestRecover(t *testing.T) {
 			}
 
 			assert.NoError(err)
+			assert.Equal(tc.wantRecoveryKey, tc.doer.useRecoveryKey)
+			if tc.recoveryKMSURI != "" {
+				assert.Equal(tc.recoveryKMSURI, tc.doer.kmsURI)
+				assert.Equal(tc.recoveryStorageURI, tc.doer.storageURI)
+			}
 			if tc.successfulCalls > 0 {
 				assert.Contains(out.String(), "Pushed recovery key.")
 				assert.Contains(out.String(), strconv.Itoa(tc.successfulCalls))
@@ -279,7 +322,10 @@ func (s *stubRecoveryServer) Recover(context.Context, *recoverproto.RecoverMessa
 }
 
 type stubDoer struct {
-	returns []error
+	returns        []error
+	kmsURI         string
+	storageURI     string
+	useRecoveryKey bool
 }
 
 func (d *stubDoer) Do(context.Context) error {
@@ -294,4 +340,11 @@ func (d *stubDoer) Do(context.Context) error {
 
 func (d *stubDoer) setDialer(grpcDialer, string) {}
 
-func (d *stubDoer) setURIs(_, _ string) {}
+func (d *stubDoer) setURIs(kmsURI, storageURI string) {
+	d.kmsURI = kmsURI
+	d.storageURI = storageURI
+}
+
+func (d *stubDoer) setUseRecoveryKey(useRecoveryKey bool) {
+	d.useRecoveryKey = useRecoveryKey
+}
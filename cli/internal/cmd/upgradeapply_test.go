@@ -312,7 +312,7 @@ func (u *stubKubernetesUpgrader) UpgradeKubernetesVersion(_ context.Context, _ v
 	return u.kubernetesVersionErr
 }
 
-func (u *stubKubernetesUpgrader) ApplyJoinConfig(_ context.Context, _ config.AttestationCfg, _ []byte) error {
+func (u *stubKubernetesUpgrader) ApplyJoinConfig(_ context.Context, _ config.AttestationCfg, _ []byte, _ semver.Semver) error {
 	return nil
 }
 
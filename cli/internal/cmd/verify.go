@@ -9,10 +9,6 @@ package cmd
 import (
 	"bytes"
 	"context"
-	"crypto/sha256"
-	"crypto/sha512"
-	"encoding/base64"
-	"encoding/hex"
 	"encoding/json"
 	"errors"
 	"fmt"
@@ -25,6 +21,7 @@ import (
 	"github.com/edgelesssys/constellation/v2/internal/atls"
 	azuretdx "github.com/edgelesssys/constellation/v2/internal/attestation/azure/tdx"
 	"github.com/edgelesssys/constellation/v2/internal/attestation/choose"
+	"github.com/edgelesssys/constellation/v2/internal/attestation/eventlog"
 	"github.com/edgelesssys/constellation/v2/internal/attestation/measurements"
 	"github.com/edgelesssys/constellation/v2/internal/attestation/snp"
 	"github.com/edgelesssys/constellation/v2/internal/attestation/variant"
@@ -36,6 +33,7 @@ import (
 	"github.com/edgelesssys/constellation/v2/internal/file"
 	"github.com/edgelesssys/constellation/v2/internal/grpc/dialer"
 	"github.com/edgelesssys/constellation/v2/internal/verify"
+	"github.com/edgelesssys/constellation/v2/verify/verifyclient"
 	"github.com/edgelesssys/constellation/v2/verify/verifyproto"
 
 	"github.com/google/go-sev-guest/proto/sevsnp"
@@ -62,6 +60,9 @@ func NewVerifyCmd() *cobra.Command {
 	cmd.Flags().String("cluster-id", "", "expected cluster identifier")
 	cmd.Flags().StringP("output", "o", "", "print the attestation document in the output format {json|raw}")
 	cmd.Flags().StringP("node-endpoint", "e", "", "endpoint of the node to verify, passed as HOST[:PORT]")
+	cmd.Flags().String("user-data", "", "data, e.g. a session or public key, the attestation must be bound to")
+	cmd.Flags().StringToString("claims", nil, "claims the attestation must be bound to, passed as KEY=VALUE pairs")
+	cmd.MarkFlagsMutuallyExclusive("user-data", "claims")
 	return cmd
 }
 
@@ -71,6 +72,8 @@ type verifyFlags struct {
 	ownerID   string
 	clusterID string
 	output    string
+	userData  string
+	claims    map[string]string
 }
 
 func (f *verifyFlags) parse(flags *pflag.FlagSet) error {
@@ -91,6 +94,14 @@ func (f *verifyFlags) parse(flags *pflag.FlagSet) error {
 	if err != nil {
 		return fmt.Errorf("getting 'cluster-id' flag: %w", err)
 	}
+	f.userData, err = flags.GetString("user-data")
+	if err != nil {
+		return fmt.Errorf("getting 'user-data' flag: %w", err)
+	}
+	f.claims, err = flags.GetStringToString("claims")
+	if err != nil {
+		return fmt.Errorf("getting 'claims' flag: %w", err)
+	}
 	return nil
 }
 
@@ -158,7 +169,7 @@ func (c *verifyCmd) verify(cmd *cobra.Command, verifyClient verifyClient, config
 
 	c.log.Debug("Updating expected PCRs")
 	attConfig := conf.GetAttestationConfig()
-	if err := updateInitMeasurements(attConfig, ownerID, clusterID); err != nil {
+	if err := attConfig.GetMeasurements().UpdateInitMeasurements(attConfig.GetVariant(), ownerID, clusterID); err != nil {
 		return fmt.Errorf("updating expected PCRs: %w", err)
 	}
 
@@ -178,11 +189,17 @@ func (c *verifyCmd) verify(cmd *cobra.Command, verifyClient verifyClient, config
 		cmd.Context(),
 		endpoint,
 		&verifyproto.GetAttestationRequest{
-			Nonce: nonce,
+			Nonce:    nonce,
+			UserData: []byte(c.flags.userData),
+			Claims:   c.flags.claims,
 		},
 		validator,
 	)
 	if err != nil {
+		// Explain the measurements of a rejected attestation, so the user can tell which boot component caused a mismatch
+		if rawAttestationDoc != nil {
+			c.printEventLog(cmd, rawAttestationDoc, attConfig)
+		}
 		return fmt.Errorf("verifying: %w", err)
 	}
 
@@ -213,6 +230,24 @@ func (c *verifyCmd) verify(cmd *cobra.Command, verifyClient verifyClient, config
 	return nil
 }
 
+// printEventLog prints the event log of an attestation document that failed verification.
+// Errors are only logged, since the event log is only used to explain the failure.
+func (c *verifyCmd) printEventLog(cmd *cobra.Command, rawAttestationDoc []byte, attestationCfg config.AttestationCfg) {
+	doc, err := unmarshalAttDoc(rawAttestationDoc, attestationCfg.GetVariant())
+	if err != nil {
+		c.log.Debug(fmt.Sprintf("Unmarshalling attestation document: %s", err))
+		return
+	}
+
+	b := &strings.Builder{}
+	b.WriteString("Attestation Document:\n")
+	if err := parseEventLog(b, doc.Attestation.EventLog, doc.Attestation.Quotes, attestationCfg.GetMeasurements()); err != nil {
+		c.log.Debug(fmt.Sprintf("Parsing event log: %s", err))
+		return
+	}
+	cmd.PrintErr(b.String())
+}
+
 func (c *verifyCmd) validateIDFlags(cmd *cobra.Command, stateFile *state.State) (ownerID, clusterID string, err error) {
 	ownerID, clusterID = c.flags.ownerID, c.flags.clusterID
 	if c.flags.clusterID == "" {
@@ -317,6 +352,9 @@ func formatDefault(ctx context.Context, docString []byte, attestationCfg config.
 	if err := parseQuotes(b, doc.Attestation.Quotes, attestationCfg.GetMeasurements()); err != nil {
 		return "", fmt.Errorf("parse quote: %w", err)
 	}
+	if err := parseEventLog(b, doc.Attestation.EventLog, doc.Attestation.Quotes, attestationCfg.GetMeasurements()); err != nil {
+		return "", fmt.Errorf("parse event log: %w", err)
+	}
 
 	// If we have a non SNP variant, print only the PCRs
 	if !(attestationCfg.GetVariant().Equal(variant.AzureSEVSNP{}) ||
@@ -367,12 +405,75 @@ func parseQuotes(b *strings.Builder, quotes []*tpmProto.Quote, expectedPCRs meas
 	return nil
 }
 
+// parseEventLog replays the event log and writes the events extending each PCR to the output builder.
+// If a PCR diverges from its expected measurement, the events that may have caused the divergence are highlighted.
+// Events that are the same for every image, like separators, are never highlighted.
+func parseEventLog(b *strings.Builder, rawEventLog []byte, quotes []*tpmProto.Quote, expectedPCRs measurements.M) error {
+	// Nodes of older Constellation versions don't include the event log
+	if len(rawEventLog) == 0 {
+		return nil
+	}
+
+	events, err := eventlog.Parse(rawEventLog)
+	if err != nil {
+		return err
+	}
+	quoteIdx, err := vtpm.GetSHA256QuoteIndex(quotes)
+	if err != nil {
+		return fmt.Errorf("get SHA256 quote index: %w", err)
+	}
+	actualPCRs := quotes[quoteIdx].Pcrs.Pcrs
+	replayedPCRs := eventlog.Replay(events)
+	descriptions := eventlog.Describe(events)
+
+	var pcrNumbers []uint32
+	for pcrNum := range replayedPCRs {
+		pcrNumbers = append(pcrNumbers, pcrNum)
+	}
+	sort.Slice(pcrNumbers, func(i, j int) bool { return pcrNumbers[i] < pcrNumbers[j] })
+
+	// Compare the PCRs with the values of the image the quote belongs to.
+	// If the quote doesn't belong to a single image, it is compared with the expected values.
+	image, _ := expectedPCRs.MatchingImage(actualPCRs)
+
+	writeIndentfln(b, 1, "Event log:")
+	for _, pcrNum := range pcrNumbers {
+		var diverges bool
+		actualPCR := actualPCRs[pcrNum]
+		expectedPCR, isExpected := expectedPCRs[pcrNum]
+		switch {
+		case !bytes.Equal(replayedPCRs[pcrNum], actualPCR):
+			writeIndentfln(b, 2, "PCR %d (event log does not match quote):", pcrNum)
+		case !isExpected:
+			writeIndentfln(b, 2, "PCR %d (not verified):", pcrNum)
+		case !expectedPCR.MatchesImage(actualPCR, image):
+			writeIndentfln(b, 2, "PCR %d (diverges from expected image):", pcrNum)
+			diverges = true
+		default:
+			writeIndentfln(b, 2, "PCR %d (matches expected image):", pcrNum)
+		}
+
+		for i, event := range events {
+			if event.PCR != pcrNum || event.Type == eventlog.EVNoAction {
+				continue
+			}
+			var marker string
+			if diverges && !event.Static() {
+				marker = "\t<- unexpected"
+			}
+			writeIndentfln(b, 3, "Event %d:\t%x\t%s%s", event.Sequence, event.Digest, descriptions[i], marker)
+		}
+	}
+	return nil
+}
+
 type constellationVerifier struct {
 	dialer grpcInsecureDialer
 	log    debugLog
 }
 
 // Verify retrieves an attestation statement from the Constellation and verifies it using the validator.
+// If the attestation statement fails verification, it is returned alongside the error.
 func (v *constellationVerifier) Verify(
 	ctx context.Context, endpoint string, req *verifyproto.GetAttestationRequest, validator atls.Validator,
 ) ([]byte, error) {
@@ -392,18 +493,16 @@ func (v *constellationVerifier) Verify(
 	}
 
 	v.log.Debug("Verifying attestation")
-	signedData, err := validator.Validate(ctx, resp.Attestation, req.Nonce)
-	if err != nil {
-		return nil, fmt.Errorf("validating attestation: %w", err)
-	}
-
-	if !bytes.Equal(signedData, []byte(constants.ConstellationVerifyServiceUserData)) {
-		return nil, errors.New("signed data in attestation does not match expected user data")
+	if err := verifyclient.VerifyAttestation(ctx, resp.Attestation, req, validator); err != nil {
+		return resp.Attestation, err
 	}
 
 	return resp.Attestation, nil
 }
 
+// verifyClient retrieves and verifies attestation statements.
+// If verification fails, the unverified attestation statement is returned alongside the error,
+// so the failure can be explained to the user.
 type verifyClient interface {
 	Verify(ctx context.Context, endpoint string, req *verifyproto.GetAttestationRequest, validator atls.Validator) ([]byte, error)
 }
@@ -438,89 +537,6 @@ func addPortIfMissing(endpoint string, defaultPort int) (string, error) {
 	return "", err
 }
 
-// UpdateInitMeasurements sets the owner and cluster measurement values in the attestation config depending on the
-// attestation variant.
-func updateInitMeasurements(config config.AttestationCfg, ownerID, clusterID string) error {
-	m := config.GetMeasurements()
-
-	switch config.GetVariant() {
-	case variant.AWSNitroTPM{}, variant.AWSSEVSNP{},
-		variant.AzureTrustedLaunch{}, variant.AzureSEVSNP{}, variant.AzureTDX{}, // AzureTDX also uses a vTPM for measurements
-		variant.GCPSEVES{}, variant.GCPSEVSNP{},
-		variant.QEMUVTPM{}:
-		if err := updateMeasurementTPM(m, uint32(measurements.PCRIndexOwnerID), ownerID); err != nil {
-			return err
-		}
-		return updateMeasurementTPM(m, uint32(measurements.PCRIndexClusterID), clusterID)
-	case variant.QEMUTDX{}:
-		// Measuring ownerID is currently not implemented for Constellation
-		// Since adding support for measuring ownerID to TDX would require additional code changes,
-		// the current implementation does not support it, but can be changed if we decide to add support in the future
-		return updateMeasurementTDX(m, uint32(measurements.TDXIndexClusterID), clusterID)
-	default:
-		return errors.New("selecting attestation variant: unknown attestation variant")
-	}
-}
-
-// updateMeasurementTDX updates the TDX measurement value in the attestation config for the given measurement index.
-func updateMeasurementTDX(m measurements.M, measurementIdx uint32, encoded string) error {
-	if encoded == "" {
-		delete(m, measurementIdx)
-		return nil
-	}
-	decoded, err := decodeMeasurement(encoded)
-	if err != nil {
-		return err
-	}
-
-	// new_measurement_value := hash(old_measurement_value || data_to_extend)
-	// Since we use the DG.MR.RTMR.EXTEND call to extend the register, data_to_extend is the hash of our input
-	hashedInput := sha512.Sum384(decoded)
-	oldExpected := m[measurementIdx].Expected
-	expectedMeasurementSum := sha512.Sum384(append(oldExpected[:], hashedInput[:]...))
-	m[measurementIdx] = measurements.Measurement{
-		Expected:      expectedMeasurementSum[:],
-		ValidationOpt: m[measurementIdx].ValidationOpt,
-	}
-	return nil
-}
-
-// updateMeasurementTPM updates the TPM measurement value in the attestation config for the given measurement index.
-func updateMeasurementTPM(m measurements.M, measurementIdx uint32, encoded string) error {
-	if encoded == "" {
-		delete(m, measurementIdx)
-		return nil
-	}
-	decoded, err := decodeMeasurement(encoded)
-	if err != nil {
-		return err
-	}
-
-	// new_pcr_value := hash(old_pcr_value || data_to_extend)
-	// Since we use the TPM2_PCR_Event call to extend the PCR, data_to_extend is the hash of our input
-	hashedInput := sha256.Sum256(decoded)
-	oldExpected := m[measurementIdx].Expected
-	expectedMeasurement := sha256.Sum256(append(oldExpected[:], hashedInput[:]...))
-	m[measurementIdx] = measurements.Measurement{
-		Expected:      expectedMeasurement[:],
-		ValidationOpt: m[measurementIdx].ValidationOpt,
-	}
-	return nil
-}
-
-// decodeMeasurement is a utility function that decodes the given string as hex or base64.
-func decodeMeasurement(encoded string) ([]byte, error) {
-	decoded, err := hex.DecodeString(encoded)
-	if err != nil {
-		hexErr := err
-		decoded, err = base64.StdEncoding.DecodeString(encoded)
-		if err != nil {
-			return nil, fmt.Errorf("input [%s] could neither be hex decoded (%w) nor base64 decoded (%w)", encoded, hexErr, err)
-		}
-	}
-	return decoded, nil
-}
-
 func unmarshalAttDoc(attDocJSON []byte, attestationVariant variant.Variant) (vtpm.AttestationDocument, error) {
 	attDoc := vtpm.AttestationDocument{
 		Attestation: &attest.Attestation{},
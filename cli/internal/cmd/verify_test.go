@@ -10,18 +10,22 @@ import (
 	"bytes"
 	"context"
 	"crypto/sha256"
-	"crypto/sha512"
 	"encoding/base64"
+	"encoding/binary"
 	"encoding/json"
 	"errors"
+	"fmt"
 	"net"
 	"strconv"
 	"strings"
 	"testing"
 
+	"github.com/edgelesssys/constellation/v2/image/measured-boot/measure"
 	"github.com/edgelesssys/constellation/v2/internal/atls"
+	"github.com/edgelesssys/constellation/v2/internal/attestation/eventlog"
 	"github.com/edgelesssys/constellation/v2/internal/attestation/measurements"
 	"github.com/edgelesssys/constellation/v2/internal/attestation/variant"
+	"github.com/edgelesssys/constellation/v2/internal/attestation/vtpm"
 	"github.com/edgelesssys/constellation/v2/internal/cloud/cloudprovider"
 	"github.com/edgelesssys/constellation/v2/internal/config"
 	"github.com/edgelesssys/constellation/v2/internal/constants"
@@ -30,7 +34,9 @@ import (
 	"github.com/edgelesssys/constellation/v2/internal/grpc/dialer"
 	"github.com/edgelesssys/constellation/v2/internal/grpc/testdialer"
 	"github.com/edgelesssys/constellation/v2/internal/logger"
+	"github.com/edgelesssys/constellation/v2/verify/userdata"
 	"github.com/edgelesssys/constellation/v2/verify/verifyproto"
+	"github.com/google/go-tpm-tools/proto/attest"
 	tpmProto "github.com/google/go-tpm-tools/proto/tpm"
 	"github.com/spf13/afero"
 	"github.com/stretchr/testify/assert"
@@ -50,8 +56,11 @@ func TestVerify(t *testing.T) {
 		nodeEndpointFlag   string
 		clusterIDFlag      string
 		stateFile          *state.State
+		userDataFlag       string
+		claimsFlag         map[string]string
 		wantEndpoint       string
 		skipConfigCreation bool
+		wantErrOutput      string
 		wantErr            bool
 	}{
 		"gcp": {
@@ -167,6 +176,18 @@ func TestVerify(t *testing.T) {
 			stateFile:        defaultStateFile(cloudprovider.Azure),
 			wantErr:          true,
 		},
+		"verification failed, event log is printed": {
+			provider:         cloudprovider.GCP,
+			nodeEndpointFlag: "192.0.2.1:1234",
+			clusterIDFlag:    zeroBase64,
+			protoClient: &stubVerifyClient{
+				attestation: newAttestationDocWithEventLog(t),
+				verifyErr:   someErr,
+			},
+			stateFile:     defaultStateFile(cloudprovider.GCP),
+			wantErrOutput: "Event log:",
+			wantErr:       true,
+		},
 		"state file is not required if flags are given": {
 			provider:         cloudprovider.Azure,
 			nodeEndpointFlag: "192.0.2.1:1234",
@@ -179,6 +200,22 @@ func TestVerify(t *testing.T) {
 			protoClient: &stubVerifyClient{},
 			wantErr:     true,
 		},
+		"user data": {
+			provider:         cloudprovider.GCP,
+			nodeEndpointFlag: "192.0.2.1:1234",
+			clusterIDFlag:    zeroBase64,
+			userDataFlag:     "session-key",
+			protoClient:      &stubVerifyClient{},
+			wantEndpoint:     "192.0.2.1:1234",
+		},
+		"claims": {
+			provider:         cloudprovider.GCP,
+			nodeEndpointFlag: "192.0.2.1:1234",
+			clusterIDFlag:    zeroBase64,
+			claimsFlag:       map[string]string{"session": "1234"},
+			protoClient:      &stubVerifyClient{},
+			wantEndpoint:     "192.0.2.1:1234",
+		},
 	}
 
 	for name, tc := range testCases {
@@ -206,15 +243,20 @@ func TestVerify(t *testing.T) {
 					clusterID: tc.clusterIDFlag,
 					endpoint:  tc.nodeEndpointFlag,
 					output:    "raw",
+					userData:  tc.userDataFlag,
+					claims:    tc.claimsFlag,
 				},
 			}
 			err := v.verify(cmd, tc.protoClient, stubAttestationFetcher{})
 			if tc.wantErr {
 				assert.Error(err)
+				assert.Contains(out.String(), tc.wantErrOutput)
 			} else {
 				assert.NoError(err)
 				assert.Contains(out.String(), "OK")
 				assert.Equal(tc.wantEndpoint, tc.protoClient.endpoint)
+				assert.Equal([]byte(tc.userDataFlag), tc.protoClient.req.UserData)
+				assert.Equal(tc.claimsFlag, tc.protoClient.req.Claims)
 			}
 		})
 	}
@@ -249,9 +291,27 @@ func TestVerifyClient(t *testing.T) {
 	testCases := map[string]struct {
 		attestationDoc atls.FakeAttestationDoc
 		nonce          []byte
+		userData       []byte
 		attestationErr error
 		wantErr        bool
 	}{
+		"attestation bound to user data": {
+			attestationDoc: atls.FakeAttestationDoc{
+				UserData: userdata.FromUserData([]byte("session-key")),
+				Nonce:    []byte("nonce"),
+			},
+			nonce:    []byte("nonce"),
+			userData: []byte("session-key"),
+		},
+		"attestation not bound to user data": {
+			attestationDoc: atls.FakeAttestationDoc{
+				UserData: []byte(constants.ConstellationVerifyServiceUserData),
+				Nonce:    []byte("nonce"),
+			},
+			nonce:    []byte("nonce"),
+			userData: []byte("session-key"),
+			wantErr:  true,
+		},
 		"success": {
 			attestationDoc: atls.FakeAttestationDoc{
 				UserData: []byte(constants.ConstellationVerifyServiceUserData),
@@ -310,7 +370,8 @@ func TestVerifyClient(t *testing.T) {
 
 			verifier := &constellationVerifier{dialer: dialer, log: logger.NewTest(t)}
 			request := &verifyproto.GetAttestationRequest{
-				Nonce: tc.nonce,
+				Nonce:    tc.nonce,
+				UserData: tc.userData,
 			}
 
 			_, err = verifier.Verify(t.Context(), addr, request, atls.NewFakeValidator(variant.Dummy{}))
@@ -325,13 +386,16 @@ func TestVerifyClient(t *testing.T) {
 }
 
 type stubVerifyClient struct {
-	verifyErr error
-	endpoint  string
+	attestation []byte
+	verifyErr   error
+	endpoint    string
+	req         *verifyproto.GetAttestationRequest
 }
 
-func (c *stubVerifyClient) Verify(_ context.Context, endpoint string, _ *verifyproto.GetAttestationRequest, _ atls.Validator) ([]byte, error) {
+func (c *stubVerifyClient) Verify(_ context.Context, endpoint string, req *verifyproto.GetAttestationRequest, _ atls.Validator) ([]byte, error) {
 	c.endpoint = endpoint
-	return nil, c.verifyErr
+	c.req = req
+	return c.attestation, c.verifyErr
 }
 
 type stubVerifyAPI struct {
@@ -489,96 +553,63 @@ func TestParseQuotes(t *testing.T) {
 	}
 }
 
-func TestValidatorUpdateInitPCRs(t *testing.T) {
-	zero := measurements.WithAllBytes(0x00, measurements.WarnOnly, measurements.PCRMeasurementLength)
-	one := measurements.WithAllBytes(0x11, measurements.WarnOnly, measurements.PCRMeasurementLength)
-	one64 := base64.StdEncoding.EncodeToString(one.Expected[:])
-	oneHash := sha256.Sum256(one.Expected[:])
-	pcrZeroUpdatedOne := sha256.Sum256(append(zero.Expected[:], oneHash[:]...))
-	newTestPCRs := func() measurements.M {
-		return measurements.M{
-			0:  measurements.WithAllBytes(0x00, measurements.WarnOnly, measurements.PCRMeasurementLength),
-			1:  measurements.WithAllBytes(0x00, measurements.WarnOnly, measurements.PCRMeasurementLength),
-			2:  measurements.WithAllBytes(0x00, measurements.WarnOnly, measurements.PCRMeasurementLength),
-			3:  measurements.WithAllBytes(0x00, measurements.WarnOnly, measurements.PCRMeasurementLength),
-			4:  measurements.WithAllBytes(0x00, measurements.WarnOnly, measurements.PCRMeasurementLength),
-			5:  measurements.WithAllBytes(0x00, measurements.WarnOnly, measurements.PCRMeasurementLength),
-			6:  measurements.WithAllBytes(0x00, measurements.WarnOnly, measurements.PCRMeasurementLength),
-			7:  measurements.WithAllBytes(0x00, measurements.WarnOnly, measurements.PCRMeasurementLength),
-			8:  measurements.WithAllBytes(0x00, measurements.WarnOnly, measurements.PCRMeasurementLength),
-			9:  measurements.WithAllBytes(0x00, measurements.WarnOnly, measurements.PCRMeasurementLength),
-			10: measurements.WithAllBytes(0x00, measurements.WarnOnly, measurements.PCRMeasurementLength),
-			11: measurements.WithAllBytes(0x00, measurements.WarnOnly, measurements.PCRMeasurementLength),
-			12: measurements.WithAllBytes(0x00, measurements.WarnOnly, measurements.PCRMeasurementLength),
-			13: measurements.WithAllBytes(0x00, measurements.WarnOnly, measurements.PCRMeasurementLength),
-			14: measurements.WithAllBytes(0x00, measurements.WarnOnly, measurements.PCRMeasurementLength),
-			15: measurements.WithAllBytes(0x00, measurements.WarnOnly, measurements.PCRMeasurementLength),
-			16: measurements.WithAllBytes(0x00, measurements.WarnOnly, measurements.PCRMeasurementLength),
-			17: measurements.WithAllBytes(0x11, measurements.WarnOnly, measurements.PCRMeasurementLength),
-			18: measurements.WithAllBytes(0x11, measurements.WarnOnly, measurements.PCRMeasurementLength),
-			19: measurements.WithAllBytes(0x11, measurements.WarnOnly, measurements.PCRMeasurementLength),
-			20: measurements.WithAllBytes(0x11, measurements.WarnOnly, measurements.PCRMeasurementLength),
-			21: measurements.WithAllBytes(0x11, measurements.WarnOnly, measurements.PCRMeasurementLength),
-			22: measurements.WithAllBytes(0x11, measurements.WarnOnly, measurements.PCRMeasurementLength),
-			23: measurements.WithAllBytes(0x00, measurements.WarnOnly, measurements.PCRMeasurementLength),
-		}
+func TestParseEventLog(t *testing.T) {
+	efiAction := measure.EVEFIActionPCR256()
+	uki := sha256.Sum256([]byte("uki"))
+	events := []eventlog.Event{
+		{PCR: 4, Type: eventlog.EVEFIAction, Digest: efiAction[:]},
+		{PCR: 4, Type: eventlog.EVEFIBootServicesApplication, Digest: uki[:]},
 	}
+	pcr4 := eventlog.Replay(events)[4]
 
 	testCases := map[string]struct {
-		config    config.AttestationCfg
-		ownerID   string
-		clusterID string
-		wantErr   bool
+		eventLog     []byte
+		quotes       []*tpmProto.Quote
+		expectedPCRs measurements.M
+		wantOutput   string
+		wantErr      bool
 	}{
-		"gcp update owner ID": {
-			config: &config.GCPSEVES{
-				Measurements: newTestPCRs(),
-			},
-			ownerID: one64,
-		},
-		"gcp update cluster ID": {
-			config: &config.GCPSEVES{
-				Measurements: newTestPCRs(),
-			},
-			clusterID: one64,
-		},
-		"gcp update both": {
-			config: &config.GCPSEVES{
-				Measurements: newTestPCRs(),
-			},
-			ownerID:   one64,
-			clusterID: one64,
-		},
-		"azure update owner ID": {
-			config: &config.AzureSEVSNP{
-				Measurements: newTestPCRs(),
-			},
-			ownerID: one64,
-		},
-		"azure update cluster ID": {
-			config: &config.AzureSEVSNP{
-				Measurements: newTestPCRs(),
-			},
-			clusterID: one64,
-		},
-		"azure update both": {
-			config: &config.AzureSEVSNP{
-				Measurements: newTestPCRs(),
-			},
-			ownerID:   one64,
-			clusterID: one64,
-		},
-		"owner ID and cluster ID empty": {
-			config: &config.AzureSEVSNP{
-				Measurements: newTestPCRs(),
-			},
-		},
-		"invalid encoding": {
-			config: &config.GCPSEVES{
-				Measurements: newTestPCRs(),
-			},
-			ownerID: "invalid",
-			wantErr: true,
+		"no event log": {
+			quotes: []*tpmProto.Quote{{Pcrs: &tpmProto.PCRs{Hash: tpmProto.HashAlgo_SHA256, Pcrs: map[uint32][]byte{4: pcr4}}}},
+		},
+		"PCR matches expected image": {
+			eventLog:     newEventLog(t, events...),
+			quotes:       []*tpmProto.Quote{{Pcrs: &tpmProto.PCRs{Hash: tpmProto.HashAlgo_SHA256, Pcrs: map[uint32][]byte{4: pcr4}}}},
+			expectedPCRs: measurements.M{4: {Expected: pcr4}},
+			wantOutput: "\tEvent log:\n\t\tPCR 4 (matches expected image):\n" +
+				fmt.Sprintf("\t\t\tEvent 1:\t%x\tEV_EFI_ACTION: Calling EFI Application from Boot Option\n", efiAction) +
+				fmt.Sprintf("\t\t\tEvent 2:\t%x\tBoot Stage 1: Unified Kernel Image (UKI)\n", uki),
+		},
+		"PCR diverges from expected image": {
+			eventLog:     newEventLog(t, events...),
+			quotes:       []*tpmProto.Quote{{Pcrs: &tpmProto.PCRs{Hash: tpmProto.HashAlgo_SHA256, Pcrs: map[uint32][]byte{4: pcr4}}}},
+			expectedPCRs: measurements.M{4: measurements.WithAllBytes(0x00, measurements.Enforce, 32)},
+			wantOutput: "\tEvent log:\n\t\tPCR 4 (diverges from expected image):\n" +
+				fmt.Sprintf("\t\t\tEvent 1:\t%x\tEV_EFI_ACTION: Calling EFI Application from Boot Option\n", efiAction) +
+				fmt.Sprintf("\t\t\tEvent 2:\t%x\tBoot Stage 1: Unified Kernel Image (UKI)\t<- unexpected\n", uki),
+		},
+		"PCR is not verified": {
+			eventLog: newEventLog(t, events...),
+			quotes:   []*tpmProto.Quote{{Pcrs: &tpmProto.PCRs{Hash: tpmProto.HashAlgo_SHA256, Pcrs: map[uint32][]byte{4: pcr4}}}},
+			wantOutput: "\tEvent log:\n\t\tPCR 4 (not verified):\n" +
+				fmt.Sprintf("\t\t\tEvent 1:\t%x\tEV_EFI_ACTION: Calling EFI Application from Boot Option\n", efiAction) +
+				fmt.Sprintf("\t\t\tEvent 2:\t%x\tBoot Stage 1: Unified Kernel Image (UKI)\n", uki),
+		},
+		"event log does not match quote": {
+			eventLog:     newEventLog(t, events[0]),
+			quotes:       []*tpmProto.Quote{{Pcrs: &tpmProto.PCRs{Hash: tpmProto.HashAlgo_SHA256, Pcrs: map[uint32][]byte{4: pcr4}}}},
+			expectedPCRs: measurements.M{4: {Expected: pcr4}},
+			wantOutput: "\tEvent log:\n\t\tPCR 4 (event log does not match quote):\n" +
+				fmt.Sprintf("\t\t\tEvent 1:\t%x\tEV_EFI_ACTION: Calling EFI Application from Boot Option\n", efiAction),
+		},
+		"invalid event log": {
+			eventLog: []byte("invalid"),
+			quotes:   []*tpmProto.Quote{{Pcrs: &tpmProto.PCRs{Hash: tpmProto.HashAlgo_SHA256, Pcrs: map[uint32][]byte{4: pcr4}}}},
+			wantErr:  true,
+		},
+		"no quotes": {
+			eventLog: newEventLog(t, events...),
+			wantErr:  true,
 		},
 	}
 
@@ -586,112 +617,64 @@ func TestValidatorUpdateInitPCRs(t *testing.T) {
 		t.Run(name, func(t *testing.T) {
 			assert := assert.New(t)
 
-			err := updateInitMeasurements(tc.config, tc.ownerID, tc.clusterID)
-
+			b := &strings.Builder{}
+			err := parseEventLog(b, tc.eventLog, tc.quotes, tc.expectedPCRs)
 			if tc.wantErr {
 				assert.Error(err)
-				return
-			}
-			require.NoError(t, err)
-			m := tc.config.GetMeasurements()
-			for i := 0; i < len(m); i++ {
-				switch {
-				case i == int(measurements.PCRIndexClusterID) && tc.clusterID == "":
-					// should be deleted
-					_, ok := m[uint32(i)]
-					assert.False(ok)
-
-				case i == int(measurements.PCRIndexClusterID):
-					pcr, ok := m[uint32(i)]
-					assert.True(ok)
-					assert.Equal(pcrZeroUpdatedOne[:], pcr.Expected)
-
-				case i == int(measurements.PCRIndexOwnerID) && tc.ownerID == "":
-					// should be deleted
-					_, ok := m[uint32(i)]
-					assert.False(ok)
-
-				case i == int(measurements.PCRIndexOwnerID):
-					pcr, ok := m[uint32(i)]
-					assert.True(ok)
-					assert.Equal(pcrZeroUpdatedOne[:], pcr.Expected)
-
-				default:
-					if i >= 17 && i <= 22 {
-						assert.Equal(one, m[uint32(i)])
-					} else {
-						assert.Equal(zero, m[uint32(i)])
-					}
-				}
+			} else {
+				assert.NoError(err)
+				assert.Equal(tc.wantOutput, b.String())
 			}
 		})
 	}
 }
 
-func TestValidatorUpdateInitMeasurementsTDX(t *testing.T) {
-	zero := measurements.WithAllBytes(0x00, true, measurements.TDXMeasurementLength)
-	one := measurements.WithAllBytes(0x11, true, measurements.TDXMeasurementLength)
-	one64 := base64.StdEncoding.EncodeToString(one.Expected[:])
-	oneHash := sha512.Sum384(one.Expected[:])
-	tdxZeroUpdatedOne := sha512.Sum384(append(zero.Expected[:], oneHash[:]...))
-	newTestTDXMeasurements := func() measurements.M {
-		return measurements.M{
-			0: measurements.WithAllBytes(0x00, true, measurements.TDXMeasurementLength),
-			1: measurements.WithAllBytes(0x00, true, measurements.TDXMeasurementLength),
-			2: measurements.WithAllBytes(0x00, true, measurements.TDXMeasurementLength),
-			3: measurements.WithAllBytes(0x00, true, measurements.TDXMeasurementLength),
-			4: measurements.WithAllBytes(0x00, true, measurements.TDXMeasurementLength),
-		}
+// newEventLog serializes a crypto agile event log with SHA-256 digests.
+func newEventLog(t *testing.T, events ...eventlog.Event) []byte {
+	t.Helper()
+	require := require.New(t)
+
+	specID := append([]byte("Spec ID Event03\x00"),
+		0x00, 0x00, 0x00, 0x00, // platform class
+		0x00, 0x02, 0x00, 0x02, // spec version minor, major, errata, uintn size
+		0x01, 0x00, 0x00, 0x00, // number of algorithms
+		0x0B, 0x00, 0x20, 0x00, // SHA-256, 32 bytes
+		0x00, // vendor info size
+	)
+	log := &bytes.Buffer{}
+	require.NoError(binary.Write(log, binary.LittleEndian, struct {
+		PCR, Type uint32
+		Digest    [20]byte
+		Size      uint32
+	}{Type: uint32(eventlog.EVNoAction), Size: uint32(len(specID))}))
+	log.Write(specID)
+
+	for _, event := range events {
+		require.NoError(binary.Write(log, binary.LittleEndian, struct {
+			PCR, Type, Count uint32
+			Alg              uint16
+		}{PCR: event.PCR, Type: uint32(event.Type), Count: 1, Alg: 0x000B}))
+		log.Write(event.Digest)
+		require.NoError(binary.Write(log, binary.LittleEndian, uint32(len(event.Data))))
+		log.Write(event.Data)
 	}
+	return log.Bytes()
+}
 
-	testCases := map[string]struct {
-		measurements measurements.M
-		clusterID    string
-		wantErr      bool
-	}{
-		"QEMUT TDX update update cluster ID": {
-			measurements: newTestTDXMeasurements(),
-			clusterID:    one64,
-		},
-		"cluster ID empty": {
-			measurements: newTestTDXMeasurements(),
-		},
-		"invalid encoding": {
-			measurements: newTestTDXMeasurements(),
-			clusterID:    "invalid",
-			wantErr:      true,
-		},
-	}
-
-	for name, tc := range testCases {
-		t.Run(name, func(t *testing.T) {
-			assert := assert.New(t)
-
-			cfg := &config.QEMUTDX{Measurements: tc.measurements}
-
-			err := updateInitMeasurements(cfg, "", tc.clusterID)
-
-			if tc.wantErr {
-				assert.Error(err)
-				return
-			}
-			assert.NoError(err)
-			for i := 0; i < len(tc.measurements); i++ {
-				switch {
-				case i == measurements.TDXIndexClusterID && tc.clusterID == "":
-					// should be deleted
-					_, ok := cfg.Measurements[uint32(i)]
-					assert.False(ok)
-
-				case i == measurements.TDXIndexClusterID:
-					pcr, ok := cfg.Measurements[uint32(i)]
-					assert.True(ok)
-					assert.Equal(tdxZeroUpdatedOne[:], pcr.Expected)
-
-				default:
-					assert.Equal(zero, cfg.Measurements[uint32(i)])
-				}
-			}
-		})
-	}
+func newAttestationDocWithEventLog(t *testing.T) []byte {
+	t.Helper()
+	efiAction := measure.EVEFIActionPCR256()
+	event := eventlog.Event{PCR: 4, Type: eventlog.EVEFIAction, Digest: efiAction[:]}
+
+	doc, err := json.Marshal(vtpm.AttestationDocument{
+		Attestation: &attest.Attestation{
+			EventLog: newEventLog(t, event),
+			Quotes: []*tpmProto.Quote{{Pcrs: &tpmProto.PCRs{
+				Hash: tpmProto.HashAlgo_SHA256,
+				Pcrs: map[uint32][]byte{4: eventlog.Replay([]eventlog.Event{event})[4]},
+			}}},
+		},
+	})
+	require.NoError(t, err)
+	return doc
 }
@@ -8,7 +8,9 @@ SPDX-License-Identifier: BUSL-1.1
 package cryptmapper
 
 import (
+	"bytes"
 	"context"
+	"encoding/json"
 	"errors"
 	"fmt"
 	"io/fs"
@@ -28,8 +30,12 @@ const (
 	cryptPrefix       = "/dev/mapper/"
 	integritySuffix   = "_dif"
 	integrityFSSuffix = "-integrity"
-	keySizeIntegrity  = 96
-	keySizeCrypt      = 64
+	keySizeIntegrity  = 96 // 32*2 bytes for aes-xts-plain64 encryption and 32 bytes for hmac(sha256) integrity
+	keySizeCrypt      = 64 // 32*2 bytes for aes-xts-plain64 encryption
+	keySizeAEAD       = 32 // 32 bytes for aes-gcm authenticated encryption
+	// keyTokenID is the ID of the LUKS2 token storing the key version of a volume.
+	keyTokenID   = 0
+	keyTokenType = "constellation-csi-key"
 )
 
 // CryptMapper manages dm-crypt volumes.
@@ -37,16 +43,33 @@ type CryptMapper struct {
 	mapper        func() deviceMapper
 	kms           keyCreator
 	getDiskFormat func(disk string) (string, error)
+	rekeyClones   bool
+}
+
+// Option configures a CryptMapper.
+type Option func(*CryptMapper)
+
+// WithCloneRekeying enables re-keying of snapshots and clones.
+// Devices restored from a snapshot or cloned from another volume are unlocked using the key of their source volume.
+// If enabled, the key of such a device is replaced with a key of its own volume ID when it is opened for the first time.
+func WithCloneRekeying() Option {
+	return func(c *CryptMapper) {
+		c.rekeyClones = true
+	}
 }
 
 // New initializes a new CryptMapper with the given kms client and key-encryption-key ID.
 // kms is used to fetch data encryption keys for the dm-crypt volumes.
-func New(kms keyCreator) *CryptMapper {
-	return &CryptMapper{
+func New(kms keyCreator, opts ...Option) *CryptMapper {
+	c := &CryptMapper{
 		mapper:        func() deviceMapper { return cryptsetup.New() },
 		kms:           kms,
 		getDiskFormat: getDiskFormat,
 	}
+	for _, opt := range opts {
+		opt(c)
+	}
+	return c
 }
 
 // CloseCryptDevice closes the crypt device mapped for volumeID.
@@ -86,7 +109,21 @@ func (c *CryptMapper) CloseCryptDevice(volumeID string) error {
 
 // OpenCryptDevice maps the volume at source to the crypt device identified by volumeID.
 // The key used to encrypt the volume is fetched using CryptMapper's kms client.
+// If the volume is a snapshot or clone of another volume, the key of the source volume is used.
+// New volumes are formatted using the default crypto profile.
 func (c *CryptMapper) OpenCryptDevice(ctx context.Context, source, volumeID string, integrity bool) (string, error) {
+	return c.OpenCryptDeviceWithProfile(ctx, source, volumeID, DefaultProfile(integrity))
+}
+
+// OpenCryptDeviceWithProfile maps the volume at source to the crypt device identified by volumeID.
+// New volumes are formatted using the given crypto profile.
+// Existing volumes keep the crypto profile they were formatted with.
+func (c *CryptMapper) OpenCryptDeviceWithProfile(ctx context.Context, source, volumeID string, profile Profile) (string, error) {
+	if err := profile.Validate(); err != nil {
+		return "", err
+	}
+	integrity := profile.Integrity()
+
 	// Initialize the block device
 	mapper := c.mapper()
 	free, err := mapper.Init(source)
@@ -100,7 +137,7 @@ func (c *CryptMapper) OpenCryptDevice(ctx context.Context, source, volumeID stri
 	// Try to load LUKS headers
 	// If this fails, the device is either not formatted at all, or already formatted with a different FS
 	if err := mapper.LoadLUKS2(); err != nil {
-		passphrase, err = c.formatNewDevice(ctx, mapper, volumeID, source, integrity)
+		passphrase, err = c.formatNewDevice(ctx, mapper, volumeID, source, profile)
 		if err != nil {
 			return "", fmt.Errorf("formatting device: %w", err)
 		}
@@ -116,20 +153,16 @@ func (c *CryptMapper) OpenCryptDevice(ctx context.Context, source, volumeID stri
 			return deviceName, nil
 		}
 
-		uuid, err := mapper.GetUUID()
-		if err != nil {
-			return "", err
-		}
-		passphrase, err = c.kms.GetDEK(ctx, uuid, crypto.StateDiskKeyLength)
-		if err != nil {
-			return "", err
+		if err := c.adoptDevice(ctx, mapper, volumeID); err != nil {
+			return "", fmt.Errorf("preparing device for volume %q: %w", volumeID, err)
 		}
-		if len(passphrase) != crypto.StateDiskKeyLength {
-			return "", fmt.Errorf("expected key length to be [%d] but got [%d]", crypto.StateDiskKeyLength, len(passphrase))
+		if err := c.activate(ctx, mapper, volumeID, cryptsetup.ReadWriteQueueBypass); err != nil {
+			return "", fmt.Errorf("trying to activate dm-crypt volume: %w", err)
 		}
+		return deviceName, nil
 	}
 
-	if err := mapper.ActivateByPassphrase(volumeID, 0, string(passphrase), cryptsetup.ReadWriteQueueBypass); err != nil {
+	if err := mapper.ActivateByPassphrase(volumeID, cryptsetup.AnyKeyslot, string(passphrase), activationFlags(profile.NoJournal)); err != nil {
 		return "", fmt.Errorf("trying to activate dm-crypt volume: %w", err)
 	}
 
@@ -149,24 +182,77 @@ func (c *CryptMapper) ResizeCryptDevice(ctx context.Context, volumeID string) (s
 		return "", fmt.Errorf("loading device: %w", err)
 	}
 
-	uuid, err := mapper.GetUUID()
+	if err := c.activate(ctx, mapper, "", resizeFlags); err != nil {
+		return "", fmt.Errorf("activating keyring for crypt device %q with passphrase: %w", volumeID, err)
+	}
+
+	if err := mapper.Resize(volumeID, 0); err != nil {
+		return "", fmt.Errorf("resizing device: %w", err)
+	}
+
+	return cryptPrefix + volumeID, nil
+}
+
+// RotateKey replaces the key of the crypt device mapped for volumeID with a new version of the key.
+// A new version of the volume's data encryption key is requested from the kms,
+// and added as a new keyslot. Afterwards, the keyslot of the old key is removed.
+// If reencrypt is set, the volume key is additionally replaced using LUKS2 online reencryption,
+// which rewrites the whole volume. Reencryption is not supported for volumes with integrity protection.
+//
+// The volume stays usable during the rotation. An interrupted rotation is continued
+// by calling RotateKey again. Returns the new key version.
+func (c *CryptMapper) RotateKey(ctx context.Context, volumeID string, reencrypt bool) (uint32, error) {
+	if reencrypt {
+		if _, err := os.Stat(cryptPrefix + volumeID + integritySuffix); err == nil {
+			return 0, errors.New("reencryption of volumes with integrity protection is not supported")
+		}
+	}
+
+	mapper := c.mapper()
+	free, err := mapper.InitByName(volumeID)
 	if err != nil {
-		return "", err
+		return 0, fmt.Errorf("initializing device: %w", err)
+	}
+	defer free()
+
+	if err := mapper.LoadLUKS2(); err != nil {
+		return 0, fmt.Errorf("loading device: %w", err)
 	}
-	passphrase, err := c.kms.GetDEK(ctx, uuid, crypto.StateDiskKeyLength)
+	uuid, err := mapper.GetUUID()
 	if err != nil {
-		return "", fmt.Errorf("getting key: %w", err)
+		return 0, err
 	}
 
-	if err := mapper.ActivateByPassphrase("", 0, string(passphrase), resizeFlags); err != nil {
-		return "", fmt.Errorf("activating keyring for crypt device %q with passphrase: %w", volumeID, err)
+	// Persist the new key version before using it, so an interrupted rotation
+	// can be continued without requesting yet another version.
+	token := readKeyToken(mapper)
+	if _, ok := token.pendingKey(uuid); !ok {
+		newVersion, err := c.kms.RotateDEK(ctx, token.key(uuid).id)
+		if err != nil {
+			return 0, fmt.Errorf("rotating key: %w", err)
+		}
+		token.PendingKeyVersion = &newVersion
+		if err := writeKeyToken(mapper, token); err != nil {
+			return 0, err
+		}
 	}
 
-	if err := mapper.Resize(volumeID, 0); err != nil {
-		return "", fmt.Errorf("resizing device: %w", err)
+	token, err = c.replaceKey(ctx, mapper, uuid, token)
+	if err != nil {
+		return 0, err
 	}
 
-	return cryptPrefix + volumeID, nil
+	if reencrypt {
+		passphrase, err := c.getPassphrase(ctx, token.key(uuid))
+		if err != nil {
+			return 0, err
+		}
+		if err := mapper.Reencrypt(volumeID, string(passphrase)); err != nil {
+			return 0, fmt.Errorf("reencrypting volume: %w", err)
+		}
+	}
+
+	return token.KeyVersion, nil
 }
 
 // GetDevicePath returns the device path of a mapped crypt device.
@@ -202,7 +288,7 @@ func (c *CryptMapper) closeCryptDevice(source, volumeID, deviceType string) erro
 	return nil
 }
 
-func (c *CryptMapper) formatNewDevice(ctx context.Context, mapper deviceMapper, volumeID, source string, integrity bool) ([]byte, error) {
+func (c *CryptMapper) formatNewDevice(ctx context.Context, mapper deviceMapper, volumeID, source string, profile Profile) ([]byte, error) {
 	format, err := c.getDiskFormat(source)
 	if err != nil {
 		return nil, fmt.Errorf("determining if disk is formatted: %w", err)
@@ -212,7 +298,7 @@ func (c *CryptMapper) formatNewDevice(ctx context.Context, mapper deviceMapper,
 	}
 
 	// Device is not formatted, so we can safely create a new LUKS2 partition
-	if err := mapper.Format(integrity); err != nil {
+	if err := mapper.FormatWithParams(profile.formatParams()); err != nil {
 		return nil, fmt.Errorf("formatting device %q: %w", source, err)
 	}
 
@@ -220,20 +306,21 @@ func (c *CryptMapper) formatNewDevice(ctx context.Context, mapper deviceMapper,
 	if err != nil {
 		return nil, err
 	}
-	passphrase, err := c.kms.GetDEK(ctx, uuid, crypto.StateDiskKeyLength)
+	passphrase, err := c.getPassphrase(ctx, keyRef{id: uuid})
 	if err != nil {
 		return nil, err
 	}
-	if len(passphrase) != crypto.StateDiskKeyLength {
-		return nil, fmt.Errorf("expected key length to be [%d] but got [%d]", crypto.StateDiskKeyLength, len(passphrase))
-	}
 
 	// Add a new keyslot using the internal volume key
 	if err := mapper.KeyslotAddByVolumeKey(0, "", string(passphrase)); err != nil {
 		return nil, fmt.Errorf("adding keyslot: %w", err)
 	}
+	// Record the key of the volume, so snapshots and clones of the volume can be unlocked
+	if err := writeKeyToken(mapper, keyToken{VolumeID: volumeID, KeyID: uuid, NoJournal: profile.NoJournal}); err != nil {
+		return nil, err
+	}
 
-	if integrity {
+	if profile.Integrity() {
 		logProgress := func(size, offset uint64) {
 			prog := (float64(offset) / float64(size)) * 100
 			fmt.Printf("Wipe in progress: %.2f%%\n", prog)
@@ -247,6 +334,215 @@ func (c *CryptMapper) formatNewDevice(ctx context.Context, mapper deviceMapper,
 	return passphrase, nil
 }
 
+// adoptDevice records the volume a device belongs to in the key token of the device.
+// A device that was created for another volume is a snapshot or clone of that volume.
+// It keeps using the key of its source volume, unless re-keying of clones is enabled.
+func (c *CryptMapper) adoptDevice(ctx context.Context, mapper deviceMapper, volumeID string) error {
+	token := readKeyToken(mapper)
+	switch {
+	case token.VolumeID == volumeID:
+		return nil
+	case token.VolumeID == "":
+		// The device was created before volume IDs were recorded.
+		token.VolumeID = volumeID
+		return writeKeyToken(mapper, token)
+	case !c.rekeyClones:
+		return nil
+	}
+
+	sourceVolumeID := token.VolumeID
+	uuid, err := mapper.GetUUID()
+	if err != nil {
+		return err
+	}
+	// Finish a key rotation of the source volume that was interrupted when the snapshot was taken.
+	if pending, ok := token.pendingKey(uuid); ok && pending.id != volumeID {
+		if token, err = c.replaceKey(ctx, mapper, uuid, token); err != nil {
+			return err
+		}
+	}
+	if _, ok := token.pendingKey(uuid); !ok {
+		var version uint32
+		token.PendingKeyID = volumeID
+		token.PendingKeyVersion = &version
+		if err := writeKeyToken(mapper, token); err != nil {
+			return err
+		}
+	}
+	if token, err = c.replaceKey(ctx, mapper, uuid, token); err != nil {
+		return fmt.Errorf("re-keying clone of volume %q: %w", sourceVolumeID, err)
+	}
+	token.VolumeID = volumeID
+	return writeKeyToken(mapper, token)
+}
+
+// replaceKey finishes the pending key replacement of a device.
+// A keyslot for the pending key is added, and the keyslot of the current key is removed.
+// Each step is skipped if it was already performed by an interrupted replacement.
+// Returns the updated key token.
+func (c *CryptMapper) replaceKey(ctx context.Context, mapper deviceMapper, uuid string, token keyToken) (keyToken, error) {
+	oldKey := token.key(uuid)
+	newKey, _ := token.pendingKey(uuid)
+
+	oldPassphrase, err := c.getPassphrase(ctx, oldKey)
+	if err != nil {
+		return keyToken{}, err
+	}
+	newPassphrase, err := c.getPassphrase(ctx, newKey)
+	if err != nil {
+		return keyToken{}, err
+	}
+
+	if !bytes.Equal(oldPassphrase, newPassphrase) {
+		if _, err := mapper.KeyslotByPassphrase(string(newPassphrase)); err != nil {
+			if _, err := mapper.KeyslotAddByPassphrase(string(oldPassphrase), string(newPassphrase)); err != nil {
+				return keyToken{}, fmt.Errorf("adding keyslot for %s: %w", newKey, err)
+			}
+		}
+		// The old keyslot may already be gone if a previous replacement was interrupted.
+		if oldKeyslot, err := mapper.KeyslotByPassphrase(string(oldPassphrase)); err == nil {
+			if err := mapper.KeyslotDestroy(oldKeyslot); err != nil {
+				return keyToken{}, fmt.Errorf("removing keyslot of %s: %w", oldKey, err)
+			}
+		}
+	}
+
+	token.KeyID, token.KeyVersion = newKey.id, newKey.version
+	token.PendingKeyID, token.PendingKeyVersion = "", nil
+	if err := writeKeyToken(mapper, token); err != nil {
+		return keyToken{}, err
+	}
+	return token, nil
+}
+
+// activate activates the crypt device using the current key of the device.
+// If a key replacement of the device was interrupted, the pending key is tried as well.
+// Activation options recorded for the device are added to flags.
+func (c *CryptMapper) activate(ctx context.Context, mapper deviceMapper, volumeID string, flags int) error {
+	uuid, err := mapper.GetUUID()
+	if err != nil {
+		return err
+	}
+	token := readKeyToken(mapper)
+	flags |= activationFlags(token.NoJournal)
+	passphrase, err := c.getPassphrase(ctx, token.key(uuid))
+	if err != nil {
+		return err
+	}
+	activateErr := mapper.ActivateByPassphrase(volumeID, cryptsetup.AnyKeyslot, string(passphrase), flags)
+	pendingKey, ok := token.pendingKey(uuid)
+	if activateErr == nil || !ok {
+		return activateErr
+	}
+
+	passphrase, err = c.getPassphrase(ctx, pendingKey)
+	if err != nil {
+		return err
+	}
+	if err := mapper.ActivateByPassphrase(volumeID, cryptsetup.AnyKeyslot, string(passphrase), flags); err != nil {
+		return errors.Join(activateErr, err)
+	}
+	return nil
+}
+
+// getPassphrase fetches the passphrase of a volume for the given key.
+func (c *CryptMapper) getPassphrase(ctx context.Context, key keyRef) ([]byte, error) {
+	passphrase, err := c.kms.GetVersionedDEK(ctx, key.id, key.version, crypto.StateDiskKeyLength)
+	if err != nil {
+		return nil, fmt.Errorf("getting %s: %w", key, err)
+	}
+	if len(passphrase) != crypto.StateDiskKeyLength {
+		return nil, fmt.Errorf("expected key length to be [%d] but got [%d]", crypto.StateDiskKeyLength, len(passphrase))
+	}
+	return passphrase, nil
+}
+
+// activationFlags returns the flags to activate a crypt device with.
+func activationFlags(noJournal bool) int {
+	if noJournal {
+		return cryptsetup.ReadWriteQueueBypass | cryptsetup.NoJournal
+	}
+	return cryptsetup.ReadWriteQueueBypass
+}
+
+// keyRef references a version of a data encryption key.
+type keyRef struct {
+	id      string
+	version uint32
+}
+
+func (k keyRef) String() string {
+	return fmt.Sprintf("key %q version %d", k.id, k.version)
+}
+
+// keyToken is a LUKS2 token storing the key used to unlock a volume, and the options to activate it with.
+// Volumes without the token use version 0 of the key derived from their LUKS2 UUID.
+type keyToken struct {
+	Type     string   `json:"type"`
+	Keyslots []string `json:"keyslots"`
+	// VolumeID is the ID of the volume the device was created for.
+	// Snapshots and clones of a volume keep the VolumeID of their source volume until they are re-keyed.
+	VolumeID string `json:"volumeID,omitempty"`
+	// KeyID is the ID of the key that unlocks the volume. If empty, the LUKS2 UUID of the device is used.
+	KeyID string `json:"keyID,omitempty"`
+	// KeyVersion is the version of the key that unlocks the volume.
+	KeyVersion uint32 `json:"keyVersion"`
+	// PendingKeyID is the ID of the key a running key replacement is switching to. If empty, KeyID is kept.
+	PendingKeyID string `json:"pendingKeyID,omitempty"`
+	// PendingKeyVersion is the version of the key a running key replacement is switching to.
+	PendingKeyVersion *uint32 `json:"pendingKeyVersion,omitempty"`
+	// NoJournal disables the dm-integrity journal when activating the volume.
+	NoJournal bool `json:"noJournal,omitempty"`
+}
+
+// key returns the key that unlocks the volume.
+func (t keyToken) key(uuid string) keyRef {
+	if t.KeyID == "" {
+		return keyRef{id: uuid, version: t.KeyVersion}
+	}
+	return keyRef{id: t.KeyID, version: t.KeyVersion}
+}
+
+// pendingKey returns the key a running key replacement is switching to,
+// and false if no key replacement is running.
+func (t keyToken) pendingKey(uuid string) (keyRef, bool) {
+	if t.PendingKeyVersion == nil {
+		return keyRef{}, false
+	}
+	if t.PendingKeyID == "" {
+		return keyRef{id: t.key(uuid).id, version: *t.PendingKeyVersion}, true
+	}
+	return keyRef{id: t.PendingKeyID, version: *t.PendingKeyVersion}, true
+}
+
+// readKeyToken reads the key token of a volume.
+// If the volume has no key token, an empty token is returned.
+func readKeyToken(mapper deviceMapper) keyToken {
+	var token keyToken
+	tokenJSON, err := mapper.TokenJSONGet(keyTokenID)
+	if err != nil {
+		return keyToken{}
+	}
+	if err := json.Unmarshal([]byte(tokenJSON), &token); err != nil || token.Type != keyTokenType {
+		return keyToken{}
+	}
+	return token
+}
+
+// writeKeyToken writes the key token of a volume.
+func writeKeyToken(mapper deviceMapper, token keyToken) error {
+	token.Type = keyTokenType
+	token.Keyslots = []string{}
+	tokenJSON, err := json.Marshal(token)
+	if err != nil {
+		return fmt.Errorf("marshaling key token: %w", err)
+	}
+	if _, err := mapper.TokenJSONSet(keyTokenID, string(tokenJSON)); err != nil {
+		return fmt.Errorf("writing key token: %w", err)
+	}
+	return nil
+}
+
 // IsIntegrityFS checks if the fstype string contains an integrity suffix.
 // If yes, returns the trimmed fstype and true, fstype and false otherwise.
 func IsIntegrityFS(fstype string) (string, bool) {
@@ -263,17 +559,24 @@ type deviceMapper interface {
 	ActivateByPassphrase(deviceName string, keyslot int, passphrase string, flags int) error
 	ActivateByVolumeKey(deviceName string, volumeKey string, volumeKeySize int, flags int) error
 	Deactivate(deviceName string) error
-	Format(integrity bool) error
+	FormatWithParams(params cryptsetup.FormatParams) error
 	Free()
 	GetDeviceName() string
 	GetUUID() (string, error)
 	LoadLUKS2() error
 	KeyslotAddByVolumeKey(keyslot int, volumeKey string, passphrase string) error
+	KeyslotAddByPassphrase(passphrase, newPassphrase string) (int, error)
+	KeyslotByPassphrase(passphrase string) (int, error)
+	KeyslotDestroy(keyslot int) error
+	Reencrypt(name, passphrase string) error
+	TokenJSONGet(token int) (string, error)
+	TokenJSONSet(token int, json string) (int, error)
 	Wipe(name string, wipeBlockSize int, flags int, progress func(size, offset uint64), frequency time.Duration) error
 	Resize(name string, newSize uint64) error
 }
 
-// keyCreator is an interface to create data encryption keys.
+// keyCreator is an interface to create and rotate data encryption keys.
 type keyCreator interface {
-	GetDEK(ctx context.Context, dekID string, dekSize int) ([]byte, error)
+	GetVersionedDEK(ctx context.Context, dekID string, version uint32, dekSize int) ([]byte, error)
+	RotateDEK(ctx context.Context, dekID string) (uint32, error)
 }
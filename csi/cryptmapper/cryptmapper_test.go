@@ -13,7 +13,9 @@ import (
 	"testing"
 	"time"
 
+	"github.com/edgelesssys/constellation/v2/internal/cryptsetup"
 	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
 	"go.uber.org/goleak"
 )
 
@@ -182,6 +184,46 @@ func TestOpenCryptDevice(t *testing.T) {
 			diskInfo: func(_ string) (string, error) { return "", nil },
 			wantErr:  true,
 		},
+		"success with rotated key": {
+			source:   "/dev/some-device",
+			volumeID: "volume0",
+			mapper: &stubCryptDevice{
+				token:    `{"type":"constellation-csi-key","keyslots":[],"keyVersion":2}`,
+				keyslots: map[string]int{string(testKey("", 2, 32)): 1},
+			},
+			kms:      &fakeKMS{},
+			diskInfo: func(_ string) (string, error) { return "", nil },
+		},
+		"success with interrupted key rotation": {
+			source:   "/dev/some-device",
+			volumeID: "volume0",
+			mapper: &stubCryptDevice{
+				token:    `{"type":"constellation-csi-key","keyslots":[],"keyVersion":0,"pendingKeyVersion":1}`,
+				keyslots: map[string]int{string(testKey("", 1, 32)): 1},
+			},
+			kms:      &fakeKMS{},
+			diskInfo: func(_ string) (string, error) { return "", nil },
+		},
+		"wrong key version": {
+			source:   "/dev/some-device",
+			volumeID: "volume0",
+			mapper: &stubCryptDevice{
+				keyslots: map[string]int{string(testKey("", 1, 32)): 1},
+			},
+			kms:      &fakeKMS{},
+			diskInfo: func(_ string) (string, error) { return "", nil },
+			wantErr:  true,
+		},
+		"success with clone": {
+			source:   "/dev/some-device",
+			volumeID: "volume0",
+			mapper: &stubCryptDevice{
+				token:    `{"type":"constellation-csi-key","keyslots":[],"volumeID":"source","keyID":"source-uuid","keyVersion":0}`,
+				keyslots: map[string]int{string(testKey("source-uuid", 0, 32)): 0},
+			},
+			kms:      &fakeKMS{},
+			diskInfo: func(_ string) (string, error) { return "", nil },
+		},
 		"getKey fails with error on Load": {
 			source:   "/dev/some-device",
 			volumeID: "volume0",
@@ -227,6 +269,68 @@ func TestOpenCryptDevice(t *testing.T) {
 	assert.NoError(t, err)
 }
 
+func TestOpenCryptDeviceWithProfile(t *testing.T) {
+	testCases := map[string]struct {
+		profile          Profile
+		mapper           *stubCryptDevice
+		wantFormatParams cryptsetup.FormatParams
+		wantNoJournal    bool
+		wantErr          bool
+	}{
+		"format with aes-gcm": {
+			profile: Profile{Name: ProfileAESGCM, SectorSize: 512, NoJournal: true},
+			mapper:  &stubCryptDevice{loadErr: assert.AnError},
+			wantFormatParams: cryptsetup.FormatParams{
+				Cipher: "aes", CipherMode: "gcm-random", VolumeKeySize: 32, Integrity: "aead", SectorSize: 512,
+			},
+			wantNoJournal: true,
+		},
+		"format with default profile": {
+			profile:          DefaultProfile(false),
+			mapper:           &stubCryptDevice{loadErr: assert.AnError},
+			wantFormatParams: cryptsetup.DefaultFormatParams(false),
+		},
+		"format with default integrity profile": {
+			profile:          DefaultProfile(true),
+			mapper:           &stubCryptDevice{loadErr: assert.AnError},
+			wantFormatParams: cryptsetup.DefaultFormatParams(true),
+		},
+		"existing volume uses recorded options": {
+			profile:       DefaultProfile(false),
+			mapper:        &stubCryptDevice{token: `{"type":"constellation-csi-key","keyslots":[],"volumeID":"volume0","noJournal":true}`},
+			wantNoJournal: true,
+		},
+		"invalid profile": {
+			profile: Profile{Name: "rot13", SectorSize: 4096},
+			mapper:  &stubCryptDevice{loadErr: assert.AnError},
+			wantErr: true,
+		},
+	}
+
+	for name, tc := range testCases {
+		t.Run(name, func(t *testing.T) {
+			assert := assert.New(t)
+			require := require.New(t)
+
+			mapper := &CryptMapper{
+				mapper:        testMapper(tc.mapper),
+				kms:           &fakeKMS{},
+				getDiskFormat: func(_ string) (string, error) { return "", nil },
+			}
+
+			_, err := mapper.OpenCryptDeviceWithProfile(t.Context(), "/dev/some-device", "volume0", tc.profile)
+			if tc.wantErr {
+				assert.Error(err)
+				return
+			}
+			require.NoError(err)
+			assert.Equal(tc.wantFormatParams, tc.mapper.formatParams)
+			assert.Equal(tc.wantNoJournal, readKeyToken(tc.mapper).NoJournal)
+			assert.Equal(tc.wantNoJournal, tc.mapper.activateFlags&cryptsetup.NoJournal != 0)
+		})
+	}
+}
+
 func TestResizeCryptDevice(t *testing.T) {
 	volumeID := "pvc-123"
 	someErr := errors.New("error")
@@ -281,6 +385,260 @@ func TestResizeCryptDevice(t *testing.T) {
 	}
 }
 
+func TestRotateKey(t *testing.T) {
+	volumeID := "pvc-123"
+	keyV0 := string(testKey("", 0, 32))
+	keyV1 := string(testKey("", 1, 32))
+	keyV2 := string(testKey("", 2, 32))
+	testCases := map[string]struct {
+		device        *stubCryptDevice
+		kms           *fakeKMS
+		reencrypt     bool
+		wantVersion   uint32
+		wantKeyslots  []string
+		wantReencrypt bool
+		wantPending   bool
+		wantErr       bool
+	}{
+		"success": {
+			device:       &stubCryptDevice{keyslots: map[string]int{keyV0: 0}},
+			kms:          &fakeKMS{},
+			wantVersion:  1,
+			wantKeyslots: []string{keyV1},
+		},
+		"success with reencryption": {
+			device:        &stubCryptDevice{keyslots: map[string]int{keyV0: 0}},
+			kms:           &fakeKMS{},
+			reencrypt:     true,
+			wantVersion:   1,
+			wantKeyslots:  []string{keyV1},
+			wantReencrypt: true,
+		},
+		"rotate rotated key": {
+			device: &stubCryptDevice{
+				token:    `{"type":"constellation-csi-key","keyslots":[],"keyVersion":1}`,
+				keyslots: map[string]int{keyV1: 1},
+			},
+			kms:          &fakeKMS{version: 1},
+			wantVersion:  2,
+			wantKeyslots: []string{keyV2},
+		},
+		"continue rotation before keyslot was added": {
+			device: &stubCryptDevice{
+				token:    `{"type":"constellation-csi-key","keyslots":[],"keyVersion":0,"pendingKeyVersion":1}`,
+				keyslots: map[string]int{keyV0: 0},
+			},
+			kms:          &fakeKMS{rotateDEKErr: assert.AnError},
+			wantVersion:  1,
+			wantKeyslots: []string{keyV1},
+		},
+		"continue rotation after old keyslot was removed": {
+			device: &stubCryptDevice{
+				token:    `{"type":"constellation-csi-key","keyslots":[],"keyVersion":0,"pendingKeyVersion":1}`,
+				keyslots: map[string]int{keyV1: 1},
+			},
+			kms:          &fakeKMS{rotateDEKErr: assert.AnError},
+			wantVersion:  1,
+			wantKeyslots: []string{keyV1},
+		},
+		"InitByName fails": {
+			device:  &stubCryptDevice{initByNameErr: assert.AnError},
+			kms:     &fakeKMS{},
+			wantErr: true,
+		},
+		"Load fails": {
+			device:  &stubCryptDevice{loadErr: assert.AnError},
+			kms:     &fakeKMS{},
+			wantErr: true,
+		},
+		"RotateDEK fails": {
+			device:       &stubCryptDevice{keyslots: map[string]int{keyV0: 0}},
+			kms:          &fakeKMS{rotateDEKErr: assert.AnError},
+			wantKeyslots: []string{keyV0},
+			wantErr:      true,
+		},
+		"writing token fails": {
+			device:       &stubCryptDevice{keyslots: map[string]int{keyV0: 0}, tokenSetErr: assert.AnError},
+			kms:          &fakeKMS{},
+			wantKeyslots: []string{keyV0},
+			wantErr:      true,
+		},
+		"getting key fails": {
+			device:       &stubCryptDevice{keyslots: map[string]int{keyV0: 0}},
+			kms:          &fakeKMS{getDEKErr: assert.AnError},
+			wantKeyslots: []string{keyV0},
+			wantPending:  true,
+			wantErr:      true,
+		},
+		"adding keyslot fails": {
+			device:       &stubCryptDevice{keyslots: map[string]int{keyV0: 0}, keyslotAddPassErr: assert.AnError},
+			kms:          &fakeKMS{},
+			wantKeyslots: []string{keyV0},
+			wantPending:  true,
+			wantErr:      true,
+		},
+		"removing keyslot fails": {
+			device:       &stubCryptDevice{keyslots: map[string]int{keyV0: 0}, keyslotDestroyErr: assert.AnError},
+			kms:          &fakeKMS{},
+			wantKeyslots: []string{keyV0, keyV1},
+			wantPending:  true,
+			wantErr:      true,
+		},
+		"old key is not valid": {
+			device:       &stubCryptDevice{keyslots: map[string]int{keyV2: 0}},
+			kms:          &fakeKMS{},
+			wantKeyslots: []string{keyV2},
+			wantPending:  true,
+			wantErr:      true,
+		},
+		"reencryption fails": {
+			device:        &stubCryptDevice{keyslots: map[string]int{keyV0: 0}, reencryptErr: assert.AnError},
+			kms:           &fakeKMS{},
+			reencrypt:     true,
+			wantKeyslots:  []string{keyV1},
+			wantReencrypt: true,
+			wantErr:       true,
+		},
+	}
+
+	for name, tc := range testCases {
+		t.Run(name, func(t *testing.T) {
+			assert := assert.New(t)
+			require := require.New(t)
+
+			mapper := &CryptMapper{
+				kms:    tc.kms,
+				mapper: testMapper(tc.device),
+			}
+
+			version, err := mapper.RotateKey(t.Context(), volumeID, tc.reencrypt)
+			if tc.wantKeyslots != nil {
+				var keyslots []string
+				for passphrase := range tc.device.keyslots {
+					keyslots = append(keyslots, passphrase)
+				}
+				assert.ElementsMatch(tc.wantKeyslots, keyslots)
+			}
+			assert.Equal(tc.wantReencrypt, tc.device.reencryptCalled)
+			if tc.wantErr {
+				assert.Error(err)
+				if tc.wantPending {
+					assert.NotNil(readKeyToken(tc.device).PendingKeyVersion)
+				}
+				return
+			}
+			require.NoError(err)
+			assert.Equal(tc.wantVersion, version)
+			token := readKeyToken(tc.device)
+			assert.Equal(tc.wantVersion, token.KeyVersion)
+			assert.Nil(token.PendingKeyVersion)
+		})
+	}
+}
+
+func TestAdoptDevice(t *testing.T) {
+	volumeID := "pvc-123"
+	sourceKey := string(testKey("source-uuid", 0, 32))
+	sourceKeyV1 := string(testKey("source-uuid", 1, 32))
+	ownKey := string(testKey(volumeID, 0, 32))
+	testCases := map[string]struct {
+		device       *stubCryptDevice
+		rekeyClones  bool
+		wantToken    keyToken
+		wantKeyslots []string
+		wantErr      bool
+	}{
+		"volume without token": {
+			device:       &stubCryptDevice{keyslots: map[string]int{sourceKey: 0}},
+			wantToken:    keyToken{Type: keyTokenType, Keyslots: []string{}, VolumeID: volumeID},
+			wantKeyslots: []string{sourceKey},
+		},
+		"own volume": {
+			device: &stubCryptDevice{
+				token:    `{"type":"constellation-csi-key","keyslots":[],"volumeID":"pvc-123","keyID":"source-uuid","keyVersion":0}`,
+				keyslots: map[string]int{sourceKey: 0},
+			},
+			rekeyClones:  true,
+			wantToken:    keyToken{Type: keyTokenType, Keyslots: []string{}, VolumeID: volumeID, KeyID: "source-uuid"},
+			wantKeyslots: []string{sourceKey},
+		},
+		"clone without re-keying": {
+			device: &stubCryptDevice{
+				token:    `{"type":"constellation-csi-key","keyslots":[],"volumeID":"source","keyID":"source-uuid","keyVersion":0}`,
+				keyslots: map[string]int{sourceKey: 0},
+			},
+			wantToken:    keyToken{Type: keyTokenType, Keyslots: []string{}, VolumeID: "source", KeyID: "source-uuid"},
+			wantKeyslots: []string{sourceKey},
+		},
+		"clone with re-keying": {
+			device: &stubCryptDevice{
+				token:    `{"type":"constellation-csi-key","keyslots":[],"volumeID":"source","keyID":"source-uuid","keyVersion":0}`,
+				keyslots: map[string]int{sourceKey: 0},
+			},
+			rekeyClones:  true,
+			wantToken:    keyToken{Type: keyTokenType, Keyslots: []string{}, VolumeID: volumeID, KeyID: volumeID},
+			wantKeyslots: []string{ownKey},
+		},
+		"clone taken during key rotation": {
+			device: &stubCryptDevice{
+				token:    `{"type":"constellation-csi-key","keyslots":[],"volumeID":"source","keyID":"source-uuid","keyVersion":0,"pendingKeyVersion":1}`,
+				keyslots: map[string]int{sourceKey: 0, sourceKeyV1: 1},
+			},
+			rekeyClones:  true,
+			wantToken:    keyToken{Type: keyTokenType, Keyslots: []string{}, VolumeID: volumeID, KeyID: volumeID},
+			wantKeyslots: []string{ownKey},
+		},
+		"interrupted re-keying": {
+			device: &stubCryptDevice{
+				token:    `{"type":"constellation-csi-key","keyslots":[],"volumeID":"source","keyID":"source-uuid","keyVersion":0,"pendingKeyID":"pvc-123","pendingKeyVersion":0}`,
+				keyslots: map[string]int{ownKey: 1},
+			},
+			rekeyClones:  true,
+			wantToken:    keyToken{Type: keyTokenType, Keyslots: []string{}, VolumeID: volumeID, KeyID: volumeID},
+			wantKeyslots: []string{ownKey},
+		},
+		"re-keying fails": {
+			device: &stubCryptDevice{
+				token:             `{"type":"constellation-csi-key","keyslots":[],"volumeID":"source","keyID":"source-uuid","keyVersion":0}`,
+				keyslots:          map[string]int{sourceKey: 0},
+				keyslotAddPassErr: assert.AnError,
+			},
+			rekeyClones: true,
+			wantToken: keyToken{
+				Type: keyTokenType, Keyslots: []string{}, VolumeID: "source", KeyID: "source-uuid",
+				PendingKeyID: volumeID, PendingKeyVersion: new(uint32),
+			},
+			wantKeyslots: []string{sourceKey},
+			wantErr:      true,
+		},
+	}
+
+	for name, tc := range testCases {
+		t.Run(name, func(t *testing.T) {
+			assert := assert.New(t)
+
+			mapper := &CryptMapper{
+				kms:         &fakeKMS{},
+				mapper:      testMapper(tc.device),
+				rekeyClones: tc.rekeyClones,
+			}
+
+			err := mapper.adoptDevice(t.Context(), tc.device, volumeID)
+			if tc.wantErr {
+				assert.Error(err)
+			} else {
+				assert.NoError(err)
+			}
+			assert.Equal(tc.wantToken, readKeyToken(tc.device))
+			var keyslots []string
+			for passphrase := range tc.device.keyslots {
+				keyslots = append(keyslots, passphrase)
+			}
+			assert.ElementsMatch(tc.wantKeyslots, keyslots)
+		})
+	}
+}
+
 func TestGetDevicePath(t *testing.T) {
 	volumeID := "pvc-123"
 	someErr := errors.New("error")
@@ -370,35 +728,66 @@ func TestIsIntegrityFS(t *testing.T) {
 }
 
 type fakeKMS struct {
-	presetKey []byte
-	getDEKErr error
+	presetKey    []byte
+	getDEKErr    error
+	rotateDEKErr error
+	version      uint32
 }
 
-func (k *fakeKMS) GetDEK(_ context.Context, _ string, dekSize int) ([]byte, error) {
+func (k *fakeKMS) GetVersionedDEK(_ context.Context, dekID string, version uint32, dekSize int) ([]byte, error) {
 	if k.getDEKErr != nil {
 		return nil, k.getDEKErr
 	}
 	if k.presetKey != nil {
 		return k.presetKey, nil
 	}
-	return bytes.Repeat([]byte{0xAA}, dekSize), nil
+	return testKey(dekID, version, dekSize), nil
+}
+
+func (k *fakeKMS) RotateDEK(_ context.Context, _ string) (uint32, error) {
+	if k.rotateDEKErr != nil {
+		return 0, k.rotateDEKErr
+	}
+	k.version++
+	return k.version, nil
+}
+
+// testKey returns a key unique to the ID and version.
+func testKey(dekID string, version uint32, dekSize int) []byte {
+	key := bytes.Repeat([]byte{0xAA + byte(version)}, dekSize)
+	copy(key, dekID)
+	return key
 }
 
 type stubCryptDevice struct {
-	deviceName       string
-	uuid             string
-	uuidErr          error
-	initErr          error
-	initByNameErr    error
-	activateErr      error
-	activatePassErr  error
-	deactivateErr    error
-	formatErr        error
-	loadErr          error
-	keySlotAddCalled bool
-	keySlotAddErr    error
-	wipeErr          error
-	resizeErr        error
+	deviceName        string
+	uuid              string
+	uuidErr           error
+	initErr           error
+	initByNameErr     error
+	activateErr       error
+	activatePassErr   error
+	deactivateErr     error
+	formatErr         error
+	loadErr           error
+	keySlotAddCalled  bool
+	keySlotAddErr     error
+	wipeErr           error
+	resizeErr         error
+	reencryptErr      error
+	reencryptCalled   bool
+	tokenSetErr       error
+	keyslotAddPassErr error
+	keyslotDestroyErr error
+
+	formatParams  cryptsetup.FormatParams
+	activateFlags int
+
+	// token is the JSON data of the key token. The token does not exist if empty.
+	token string
+	// keyslots maps the passphrases of the device to their keyslots.
+	// If nil, every passphrase activates the device.
+	keyslots map[string]int
 }
 
 func (c *stubCryptDevice) Init(_ string) (func(), error) {
@@ -413,7 +802,13 @@ func (c *stubCryptDevice) ActivateByVolumeKey(_, _ string, _, _ int) error {
 	return c.activateErr
 }
 
-func (c *stubCryptDevice) ActivateByPassphrase(_ string, _ int, _ string, _ int) error {
+func (c *stubCryptDevice) ActivateByPassphrase(_ string, _ int, passphrase string, flags int) error {
+	c.activateFlags = flags
+	if c.keyslots != nil {
+		if _, ok := c.keyslots[passphrase]; !ok {
+			return errors.New("no keyslot for passphrase")
+		}
+	}
 	return c.activatePassErr
 }
 
@@ -421,7 +816,8 @@ func (c *stubCryptDevice) Deactivate(_ string) error {
 	return c.deactivateErr
 }
 
-func (c *stubCryptDevice) Format(_ bool) error {
+func (c *stubCryptDevice) FormatWithParams(params cryptsetup.FormatParams) error {
+	c.formatParams = params
 	return c.formatErr
 }
 
@@ -444,6 +840,61 @@ func (c *stubCryptDevice) KeyslotAddByVolumeKey(_ int, _ string, _ string) error
 	return c.keySlotAddErr
 }
 
+func (c *stubCryptDevice) KeyslotAddByPassphrase(passphrase, newPassphrase string) (int, error) {
+	if c.keyslotAddPassErr != nil {
+		return -1, c.keyslotAddPassErr
+	}
+	if _, ok := c.keyslots[passphrase]; !ok {
+		return -1, errors.New("no keyslot for passphrase")
+	}
+	keyslot := 0
+	for _, slot := range c.keyslots {
+		keyslot = max(keyslot, slot+1)
+	}
+	c.keyslots[newPassphrase] = keyslot
+	return keyslot, nil
+}
+
+func (c *stubCryptDevice) KeyslotByPassphrase(passphrase string) (int, error) {
+	keyslot, ok := c.keyslots[passphrase]
+	if !ok {
+		return -1, errors.New("no keyslot for passphrase")
+	}
+	return keyslot, nil
+}
+
+func (c *stubCryptDevice) KeyslotDestroy(keyslot int) error {
+	if c.keyslotDestroyErr != nil {
+		return c.keyslotDestroyErr
+	}
+	for passphrase, slot := range c.keyslots {
+		if slot == keyslot {
+			delete(c.keyslots, passphrase)
+		}
+	}
+	return nil
+}
+
+func (c *stubCryptDevice) Reencrypt(_, _ string) error {
+	c.reencryptCalled = true
+	return c.reencryptErr
+}
+
+func (c *stubCryptDevice) TokenJSONGet(_ int) (string, error) {
+	if c.token == "" {
+		return "", errors.New("token does not exist")
+	}
+	return c.token, nil
+}
+
+func (c *stubCryptDevice) TokenJSONSet(token int, json string) (int, error) {
+	if c.tokenSetErr != nil {
+		return -1, c.tokenSetErr
+	}
+	c.token = json
+	return token, nil
+}
+
 func (c *stubCryptDevice) Wipe(_ string, _ int, _ int, _ func(size, offset uint64), _ time.Duration) error {
 	return c.wipeErr
 }
@@ -0,0 +1,134 @@
+/*
+Copyright (c) Edgeless Systems GmbH
+
+SPDX-License-Identifier: BUSL-1.1
+*/
+
+package cryptmapper
+
+import (
+	"fmt"
+	"slices"
+	"strconv"
+
+	"github.com/edgelesssys/constellation/v2/internal/cryptsetup"
+)
+
+const (
+	// ProfileParameter is the StorageClass parameter selecting the crypto profile of a volume.
+	ProfileParameter = "cryptoProfile"
+	// SectorSizeParameter is the StorageClass parameter setting the encryption sector size of a volume in bytes.
+	SectorSizeParameter = "cryptoSectorSize"
+	// NoJournalParameter is the StorageClass parameter disabling the dm-integrity journal of a volume if set to "true".
+	// Without a journal, writes are faster, but a crash may leave sectors with invalid integrity tags.
+	NoJournalParameter = "integrityNoJournal"
+
+	// ProfileAESXTS encrypts volumes using AES-XTS without integrity protection.
+	ProfileAESXTS = "aes-xts"
+	// ProfileAESXTSHMACSHA256 encrypts volumes using AES-XTS, and protects their integrity using HMAC-SHA256 and dm-integrity.
+	ProfileAESXTSHMACSHA256 = "aes-xts-hmac-sha256"
+	// ProfileAESGCM encrypts and authenticates volumes using AES-GCM with dm-integrity.
+	ProfileAESGCM = "aes-gcm"
+
+	defaultSectorSize = 4096
+)
+
+// profiles are the supported crypto profiles.
+var profiles = map[string]cryptsetup.FormatParams{
+	ProfileAESXTS: {
+		Cipher:        "aes",
+		CipherMode:    "xts-plain64",
+		VolumeKeySize: keySizeCrypt,
+	},
+	ProfileAESXTSHMACSHA256: {
+		Cipher:        "aes",
+		CipherMode:    "xts-plain64",
+		VolumeKeySize: keySizeIntegrity,
+		Integrity:     "hmac(sha256)",
+	},
+	ProfileAESGCM: {
+		Cipher:        "aes",
+		CipherMode:    "gcm-random",
+		VolumeKeySize: keySizeAEAD,
+		Integrity:     "aead",
+	},
+}
+
+// Profile is a named set of crypto parameters used to format and activate a volume.
+type Profile struct {
+	// Name is the name of the profile.
+	Name string
+	// SectorSize is the encryption sector size in bytes.
+	SectorSize int
+	// NoJournal disables the dm-integrity journal.
+	NoJournal bool
+}
+
+// DefaultProfile returns the profile used for volumes without crypto parameters.
+// Integrity protected volumes use HMAC-SHA256.
+func DefaultProfile(integrity bool) Profile {
+	if integrity {
+		return Profile{Name: ProfileAESXTSHMACSHA256, SectorSize: defaultSectorSize}
+	}
+	return Profile{Name: ProfileAESXTS, SectorSize: defaultSectorSize}
+}
+
+// ProfileFromParameters returns the crypto profile selected by the parameters of a StorageClass.
+// Parameters not related to encryption are ignored.
+// integrity is true if integrity protection was requested using the fstype, see IsIntegrityFS.
+// If no profile is selected, the default profile is used.
+func ProfileFromParameters(parameters map[string]string, integrity bool) (Profile, error) {
+	profile := DefaultProfile(integrity)
+	if name, ok := parameters[ProfileParameter]; ok {
+		profile.Name = name
+	}
+	if sectorSize, ok := parameters[SectorSizeParameter]; ok {
+		size, err := strconv.Atoi(sectorSize)
+		if err != nil {
+			return Profile{}, fmt.Errorf("parsing %s: %w", SectorSizeParameter, err)
+		}
+		profile.SectorSize = size
+	}
+	if noJournal, ok := parameters[NoJournalParameter]; ok {
+		enabled, err := strconv.ParseBool(noJournal)
+		if err != nil {
+			return Profile{}, fmt.Errorf("parsing %s: %w", NoJournalParameter, err)
+		}
+		profile.NoJournal = enabled
+	}
+
+	if err := profile.Validate(); err != nil {
+		return Profile{}, err
+	}
+	if integrity && !profile.Integrity() {
+		return Profile{}, fmt.Errorf("integrity protection requested, but crypto profile %q does not support integrity", profile.Name)
+	}
+	return profile, nil
+}
+
+// Validate checks that the profile is supported.
+func (p Profile) Validate() error {
+	if _, ok := profiles[p.Name]; !ok {
+		return fmt.Errorf("unknown crypto profile %q, supported profiles are %q, %q and %q",
+			p.Name, ProfileAESXTS, ProfileAESXTSHMACSHA256, ProfileAESGCM)
+	}
+	if !slices.Contains([]int{512, 1024, 2048, 4096}, p.SectorSize) {
+		return fmt.Errorf("invalid sector size %d, must be one of 512, 1024, 2048 or 4096", p.SectorSize)
+	}
+	if p.NoJournal && !p.Integrity() {
+		return fmt.Errorf("%s requires a crypto profile with integrity protection", NoJournalParameter)
+	}
+	return nil
+}
+
+// Integrity returns true if the profile protects the integrity of volumes using dm-integrity.
+func (p Profile) Integrity() bool {
+	return profiles[p.Name].Integrity != ""
+}
+
+// formatParams returns the cryptsetup parameters to format a volume with the profile.
+func (p Profile) formatParams() cryptsetup.FormatParams {
+	params := profiles[p.Name]
+	params.SectorSize = p.SectorSize
+	return params
+}
@@ -0,0 +1,83 @@
+/*
+Copyright (c) Edgeless Systems GmbH
+
+SPDX-License-Identifier: BUSL-1.1
+*/
+
+package cryptmapper
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestProfileFromParameters(t *testing.T) {
+	testCases := map[string]struct {
+		parameters  map[string]string
+		integrity   bool
+		wantProfile Profile
+		wantErr     bool
+	}{
+		"no parameters": {
+			parameters:  map[string]string{"type": "pd-ssd"},
+			wantProfile: Profile{Name: ProfileAESXTS, SectorSize: 4096},
+		},
+		"integrity fstype": {
+			integrity:   true,
+			wantProfile: Profile{Name: ProfileAESXTSHMACSHA256, SectorSize: 4096},
+		},
+		"all parameters": {
+			parameters: map[string]string{
+				ProfileParameter:    ProfileAESGCM,
+				SectorSizeParameter: "512",
+				NoJournalParameter:  "true",
+			},
+			wantProfile: Profile{Name: ProfileAESGCM, SectorSize: 512, NoJournal: true},
+		},
+		"integrity profile with integrity fstype": {
+			parameters:  map[string]string{ProfileParameter: ProfileAESGCM},
+			integrity:   true,
+			wantProfile: Profile{Name: ProfileAESGCM, SectorSize: 4096},
+		},
+		"profile without integrity with integrity fstype": {
+			parameters: map[string]string{ProfileParameter: ProfileAESXTS},
+			integrity:  true,
+			wantErr:    true,
+		},
+		"unknown profile": {
+			parameters: map[string]string{ProfileParameter: "aes-cbc"},
+			wantErr:    true,
+		},
+		"invalid sector size": {
+			parameters: map[string]string{SectorSizeParameter: "4000"},
+			wantErr:    true,
+		},
+		"malformed sector size": {
+			parameters: map[string]string{SectorSizeParameter: "4k"},
+			wantErr:    true,
+		},
+		"no journal without integrity": {
+			parameters: map[string]string{NoJournalParameter: "true"},
+			wantErr:    true,
+		},
+		"malformed no journal": {
+			parameters: map[string]string{ProfileParameter: ProfileAESGCM, NoJournalParameter: "yes please"},
+			wantErr:    true,
+		},
+	}
+
+	for name, tc := range testCases {
+		t.Run(name, func(t *testing.T) {
+			assert := assert.New(t)
+
+			profile, err := ProfileFromParameters(tc.parameters, tc.integrity)
+			if tc.wantErr {
+				assert.Error(err)
+				return
+			}
+			assert.NoError(err)
+			assert.Equal(tc.wantProfile, profile)
+		})
+	}
+}
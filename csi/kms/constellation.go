@@ -10,6 +10,7 @@ import (
 	"context"
 	"fmt"
 
+	"github.com/edgelesssys/constellation/v2/internal/grpc/tokencredentials"
 	"github.com/edgelesssys/constellation/v2/keyservice/keyserviceproto"
 	"google.golang.org/grpc"
 	"google.golang.org/grpc/credentials/insecure"
@@ -30,7 +31,14 @@ func NewConstellationKMS(endpoint string) *ConstellationKMS {
 }
 
 // GetDEK request a data encryption key derived from the Constellation's master secret.
+// The initial version of the key is returned, even if the key was rotated.
 func (k *ConstellationKMS) GetDEK(ctx context.Context, dekID string, dekSize int) ([]byte, error) {
+	return k.GetVersionedDEK(ctx, dekID, 0, dekSize)
+}
+
+// GetVersionedDEK requests a specific version of a data encryption key derived from the Constellation's master secret.
+// Version 0 is the key that existed before the first rotation.
+func (k *ConstellationKMS) GetVersionedDEK(ctx context.Context, dekID string, version uint32, dekSize int) ([]byte, error) {
 	conn, err := grpc.NewClient(k.endpoint, grpc.WithTransportCredentials(insecure.NewCredentials()))
 	if err != nil {
 		return nil, err
@@ -42,6 +50,7 @@ func (k *ConstellationKMS) GetDEK(ctx context.Context, dekID string, dekSize int
 		&keyserviceproto.GetDataKeyRequest{
 			DataKeyId: dekID,
 			Length:    uint32(dekSize),
+			Version:   version,
 		},
 		conn,
 	)
@@ -52,8 +61,30 @@ func (k *ConstellationKMS) GetDEK(ctx context.Context, dekID string, dekSize int
 	return res.DataKey, nil
 }
 
+// RotateDEK rotates a data encryption key and returns its new version.
+// Previous versions of the key can still be requested using GetVersionedDEK.
+// The request is authenticated with the service account token of the CSI driver.
+func (k *ConstellationKMS) RotateDEK(ctx context.Context, dekID string) (uint32, error) {
+	conn, err := grpc.NewClient(k.endpoint,
+		grpc.WithTransportCredentials(insecure.NewCredentials()),
+		grpc.WithPerRPCCredentials(tokencredentials.New(tokencredentials.ServiceAccountTokenPath)),
+	)
+	if err != nil {
+		return 0, err
+	}
+	defer conn.Close()
+
+	res, err := k.kms.RotateDataKey(ctx, &keyserviceproto.RotateDataKeyRequest{DataKeyId: dekID}, conn)
+	if err != nil {
+		return 0, fmt.Errorf("rotating data encryption key in Constellation KMS: %w", err)
+	}
+
+	return res.Version, nil
+}
+
 type kmsClient interface {
 	GetDataKey(context.Context, *keyserviceproto.GetDataKeyRequest, *grpc.ClientConn) (*keyserviceproto.GetDataKeyResponse, error)
+	RotateDataKey(context.Context, *keyserviceproto.RotateDataKeyRequest, *grpc.ClientConn) (*keyserviceproto.RotateDataKeyResponse, error)
 }
 
 type constellationKMSClient struct{}
@@ -61,3 +92,7 @@ type constellationKMSClient struct{}
 func (c *constellationKMSClient) GetDataKey(ctx context.Context, req *keyserviceproto.GetDataKeyRequest, conn *grpc.ClientConn) (*keyserviceproto.GetDataKeyResponse, error) {
 	return keyserviceproto.NewAPIClient(conn).GetDataKey(ctx, req)
 }
+
+func (c *constellationKMSClient) RotateDataKey(ctx context.Context, req *keyserviceproto.RotateDataKeyRequest, conn *grpc.ClientConn) (*keyserviceproto.RotateDataKeyResponse, error) {
+	return keyserviceproto.NewAPIClient(conn).RotateDataKey(ctx, req)
+}
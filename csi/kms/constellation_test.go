@@ -23,12 +23,21 @@ func TestMain(m *testing.M) {
 }
 
 type stubKMSClient struct {
-	getDataKeyErr error
-	dataKey       []byte
+	getDataKeyErr    error
+	dataKey          []byte
+	rotateDataKeyErr error
+	version          uint32
+
+	requestedVersion uint32
+}
+
+func (c *stubKMSClient) GetDataKey(_ context.Context, req *keyserviceproto.GetDataKeyRequest, _ *grpc.ClientConn) (*keyserviceproto.GetDataKeyResponse, error) {
+	c.requestedVersion = req.Version
+	return &keyserviceproto.GetDataKeyResponse{DataKey: c.dataKey, Version: req.Version}, c.getDataKeyErr
 }
 
-func (c *stubKMSClient) GetDataKey(context.Context, *keyserviceproto.GetDataKeyRequest, *grpc.ClientConn) (*keyserviceproto.GetDataKeyResponse, error) {
-	return &keyserviceproto.GetDataKeyResponse{DataKey: c.dataKey}, c.getDataKeyErr
+func (c *stubKMSClient) RotateDataKey(context.Context, *keyserviceproto.RotateDataKeyRequest, *grpc.ClientConn) (*keyserviceproto.RotateDataKeyResponse, error) {
+	return &keyserviceproto.RotateDataKeyResponse{Version: c.version}, c.rotateDataKeyErr
 }
 
 func TestConstellationKMS(t *testing.T) {
@@ -69,3 +78,55 @@ func TestConstellationKMS(t *testing.T) {
 		})
 	}
 }
+
+func TestConstellationKMSVersions(t *testing.T) {
+	testCases := map[string]struct {
+		kms         *stubKMSClient
+		wantVersion uint32
+		wantErr     bool
+	}{
+		"success": {
+			kms:         &stubKMSClient{dataKey: []byte{0x1, 0x2, 0x3}, version: 3},
+			wantVersion: 3,
+		},
+		"RotateDataKey error": {
+			kms:     &stubKMSClient{rotateDataKeyErr: errors.New("error")},
+			wantErr: true,
+		},
+		"GetDataKey error": {
+			kms:         &stubKMSClient{getDataKeyErr: errors.New("error"), version: 3},
+			wantVersion: 3,
+			wantErr:     true,
+		},
+	}
+
+	for name, tc := range testCases {
+		t.Run(name, func(t *testing.T) {
+			assert := assert.New(t)
+
+			listener := bufconn.Listen(1)
+			defer listener.Close()
+
+			kms := &ConstellationKMS{
+				endpoint: listener.Addr().String(),
+				kms:      tc.kms,
+			}
+			version, err := kms.RotateDEK(t.Context(), "data-key")
+			if err != nil {
+				assert.True(tc.wantErr)
+				return
+			}
+			assert.Equal(tc.wantVersion, version)
+
+			res, err := kms.GetVersionedDEK(t.Context(), "data-key", version, 64)
+			if tc.wantErr {
+				assert.Error(err)
+				assert.Nil(res)
+				return
+			}
+			assert.NoError(err)
+			assert.NotNil(res)
+			assert.Equal(tc.wantVersion, tc.kms.requestedVersion)
+		})
+	}
+}
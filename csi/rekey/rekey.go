@@ -0,0 +1,155 @@
+/*
+Copyright (c) Edgeless Systems GmbH
+
+SPDX-License-Identifier: BUSL-1.1
+*/
+
+/*
+Package rekey rotates the keys of encrypted CSI volumes on request.
+
+A key rotation is requested by setting the RotateKeyAnnotation of a PersistentVolume.
+A Controller runs on every node alongside the CSI driver's node service,
+and rotates the keys of the requested volumes that are mapped on its node.
+The result of a rotation is reported using annotations on the PersistentVolume.
+*/
+package rekey
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"strconv"
+	"time"
+
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/client-go/kubernetes"
+)
+
+const (
+	// RotateKeyAnnotation requests a key rotation of a volume.
+	// A rotation is performed whenever the value differs from the value of KeyRotatedAnnotation,
+	// so any new value, e.g. a timestamp, requests another rotation.
+	RotateKeyAnnotation = "csi.constellation.edgeless.systems/rotate-key"
+	// ReencryptAnnotation requests a full reencryption of the volume with every key rotation if set to "true".
+	ReencryptAnnotation = "csi.constellation.edgeless.systems/reencrypt"
+	// KeyRotatedAnnotation is set to the value of RotateKeyAnnotation once the requested rotation is finished.
+	KeyRotatedAnnotation = "csi.constellation.edgeless.systems/key-rotated"
+	// KeyVersionAnnotation is set to the key version of the volume after a rotation.
+	KeyVersionAnnotation = "csi.constellation.edgeless.systems/key-version"
+	// KeyRotationErrorAnnotation is set to the error of a failed rotation. It is removed by a successful rotation.
+	KeyRotationErrorAnnotation = "csi.constellation.edgeless.systems/key-rotation-error"
+)
+
+// Controller rotates the keys of volumes mapped on the node on request.
+type Controller struct {
+	client     kubernetes.Interface
+	driverName string
+	mappedName func(volumeHandle string) string
+	rotator    keyRotator
+	log        *slog.Logger
+}
+
+// New creates a new Controller for the volumes of the CSI driver driverName.
+// mappedName returns the name of the crypt device the driver maps a volume to, given the volume handle.
+func New(log *slog.Logger, client kubernetes.Interface, driverName string, mappedName func(volumeHandle string) string, rotator keyRotator) *Controller {
+	return &Controller{
+		client:     client,
+		driverName: driverName,
+		mappedName: mappedName,
+		rotator:    rotator,
+		log:        log,
+	}
+}
+
+// Run reconciles the volumes every interval until ctx is done.
+func (c *Controller) Run(ctx context.Context, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		if err := c.Reconcile(ctx); err != nil {
+			c.log.With(slog.Any("error", err)).Error("Failed to rotate volume keys")
+		}
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// Reconcile rotates the keys of all requested volumes of the driver that are mapped on this node.
+// Rotations are performed one after another. A failed rotation does not stop the rotation of other volumes.
+func (c *Controller) Reconcile(ctx context.Context) error {
+	pvs, err := c.client.CoreV1().PersistentVolumes().List(ctx, metav1.ListOptions{})
+	if err != nil {
+		return fmt.Errorf("listing persistent volumes: %w", err)
+	}
+
+	var errs error
+	for _, pv := range pvs.Items {
+		if pv.Spec.CSI == nil || pv.Spec.CSI.Driver != c.driverName || !rotationRequested(&pv) {
+			continue
+		}
+		name := c.mappedName(pv.Spec.CSI.VolumeHandle)
+		// Only the node the volume is mapped on can rotate its key.
+		if _, err := c.rotator.GetDevicePath(name); err != nil {
+			continue
+		}
+
+		log := c.log.With(slog.String("volume", pv.Name))
+		reencrypt := pv.Annotations[ReencryptAnnotation] == "true"
+		log.With(slog.Bool("reencrypt", reencrypt)).Info("Rotating volume key")
+		version, rotateErr := c.rotator.RotateKey(ctx, name, reencrypt)
+		if rotateErr != nil {
+			log.With(slog.Any("error", rotateErr)).Error("Failed to rotate volume key")
+			errs = errors.Join(errs, fmt.Errorf("rotating key of volume %q: %w", pv.Name, rotateErr))
+		} else {
+			log.With(slog.Any("version", version)).Info("Rotated volume key")
+		}
+
+		if err := c.patchAnnotations(ctx, &pv, version, rotateErr); err != nil {
+			errs = errors.Join(errs, fmt.Errorf("updating annotations of volume %q: %w", pv.Name, err))
+		}
+	}
+	return errs
+}
+
+// patchAnnotations reports the result of a key rotation on the persistent volume.
+func (c *Controller) patchAnnotations(ctx context.Context, pv *corev1.PersistentVolume, version uint32, rotateErr error) error {
+	annotations := map[string]*string{}
+	if rotateErr != nil {
+		msg := rotateErr.Error()
+		annotations[KeyRotationErrorAnnotation] = &msg
+	} else {
+		requested := pv.Annotations[RotateKeyAnnotation]
+		versionStr := strconv.FormatUint(uint64(version), 10)
+		annotations[KeyRotatedAnnotation] = &requested
+		annotations[KeyVersionAnnotation] = &versionStr
+		annotations[KeyRotationErrorAnnotation] = nil // remove errors of previous attempts
+	}
+
+	patch, err := json.Marshal(map[string]any{
+		"metadata": map[string]any{"annotations": annotations},
+	})
+	if err != nil {
+		return err
+	}
+	_, err = c.client.CoreV1().PersistentVolumes().Patch(ctx, pv.Name, types.MergePatchType, patch, metav1.PatchOptions{})
+	return err
+}
+
+// rotationRequested returns true if a key rotation was requested for the volume and is not finished yet.
+func rotationRequested(pv *corev1.PersistentVolume) bool {
+	requested, ok := pv.Annotations[RotateKeyAnnotation]
+	return ok && requested != pv.Annotations[KeyRotatedAnnotation]
+}
+
+type keyRotator interface {
+	GetDevicePath(volumeID string) (string, error)
+	RotateKey(ctx context.Context, volumeID string, reencrypt bool) (uint32, error)
+}
@@ -0,0 +1,191 @@
+/*
+Copyright (c) Edgeless Systems GmbH
+
+SPDX-License-Identifier: BUSL-1.1
+*/
+
+package rekey
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/edgelesssys/constellation/v2/internal/logger"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.uber.org/goleak"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/client-go/kubernetes/fake"
+	k8stesting "k8s.io/client-go/testing"
+)
+
+func TestMain(m *testing.M) {
+	goleak.VerifyTestMain(m, goleak.IgnoreAnyFunction("github.com/bazelbuild/rules_go/go/tools/bzltestutil.RegisterTimeoutHandler.func1"))
+}
+
+func TestReconcile(t *testing.T) {
+	const driver = "test.csi.edgeless.systems"
+
+	testCases := map[string]struct {
+		pv              *corev1.PersistentVolume
+		rotator         *stubKeyRotator
+		listErr         error
+		wantRotated     bool
+		wantReencrypt   bool
+		wantAnnotations map[string]string
+		wantErr         bool
+	}{
+		"rotation requested": {
+			pv:          newPV(driver, map[string]string{RotateKeyAnnotation: "1"}),
+			rotator:     &stubKeyRotator{version: 3},
+			wantRotated: true,
+			wantAnnotations: map[string]string{
+				RotateKeyAnnotation:  "1",
+				KeyRotatedAnnotation: "1",
+				KeyVersionAnnotation: "3",
+			},
+		},
+		"rotation with reencryption requested": {
+			pv:            newPV(driver, map[string]string{RotateKeyAnnotation: "1", ReencryptAnnotation: "true"}),
+			rotator:       &stubKeyRotator{version: 1},
+			wantRotated:   true,
+			wantReencrypt: true,
+			wantAnnotations: map[string]string{
+				RotateKeyAnnotation:  "1",
+				ReencryptAnnotation:  "true",
+				KeyRotatedAnnotation: "1",
+				KeyVersionAnnotation: "1",
+			},
+		},
+		"new rotation requested": {
+			pv: newPV(driver, map[string]string{
+				RotateKeyAnnotation:        "2",
+				KeyRotatedAnnotation:       "1",
+				KeyVersionAnnotation:       "1",
+				KeyRotationErrorAnnotation: "failed",
+			}),
+			rotator:     &stubKeyRotator{version: 2},
+			wantRotated: true,
+			wantAnnotations: map[string]string{
+				RotateKeyAnnotation:  "2",
+				KeyRotatedAnnotation: "2",
+				KeyVersionAnnotation: "2",
+			},
+		},
+		"rotation finished": {
+			pv:      newPV(driver, map[string]string{RotateKeyAnnotation: "1", KeyRotatedAnnotation: "1"}),
+			rotator: &stubKeyRotator{},
+			wantAnnotations: map[string]string{
+				RotateKeyAnnotation:  "1",
+				KeyRotatedAnnotation: "1",
+			},
+		},
+		"no rotation requested": {
+			pv:              newPV(driver, nil),
+			rotator:         &stubKeyRotator{},
+			wantAnnotations: nil,
+		},
+		"volume of other driver": {
+			pv:              newPV("other.csi.k8s.io", map[string]string{RotateKeyAnnotation: "1"}),
+			rotator:         &stubKeyRotator{},
+			wantAnnotations: map[string]string{RotateKeyAnnotation: "1"},
+		},
+		"volume not mapped on node": {
+			pv:              newPV(driver, map[string]string{RotateKeyAnnotation: "1"}),
+			rotator:         &stubKeyRotator{getDevicePathErr: assert.AnError},
+			wantAnnotations: map[string]string{RotateKeyAnnotation: "1"},
+		},
+		"rotation fails": {
+			pv:          newPV(driver, map[string]string{RotateKeyAnnotation: "1"}),
+			rotator:     &stubKeyRotator{rotateErr: errors.New("failed")},
+			wantRotated: true,
+			wantAnnotations: map[string]string{
+				RotateKeyAnnotation:        "1",
+				KeyRotationErrorAnnotation: "failed",
+			},
+			wantErr: true,
+		},
+		"listing volumes fails": {
+			pv:          newPV(driver, map[string]string{RotateKeyAnnotation: "1"}),
+			rotator:     &stubKeyRotator{},
+			listErr:     assert.AnError,
+			wantErr:     true,
+			wantRotated: false,
+			wantAnnotations: map[string]string{
+				RotateKeyAnnotation: "1",
+			},
+		},
+	}
+
+	for name, tc := range testCases {
+		t.Run(name, func(t *testing.T) {
+			assert := assert.New(t)
+			require := require.New(t)
+
+			client := fake.NewClientset(tc.pv)
+			if tc.listErr != nil {
+				client.PrependReactor("list", "persistentvolumes", func(k8stesting.Action) (bool, runtime.Object, error) {
+					return true, nil, tc.listErr
+				})
+			}
+			ctrl := New(logger.NewTest(t), client, driver, func(volumeHandle string) string { return "mapped-" + volumeHandle }, tc.rotator)
+
+			err := ctrl.Reconcile(t.Context())
+			if tc.wantErr {
+				assert.Error(err)
+			} else {
+				assert.NoError(err)
+			}
+
+			if tc.wantRotated {
+				assert.Equal("mapped-"+tc.pv.Spec.CSI.VolumeHandle, tc.rotator.rotatedVolume)
+			} else {
+				assert.Empty(tc.rotator.rotatedVolume)
+			}
+			assert.Equal(tc.wantReencrypt, tc.rotator.reencrypt)
+
+			pv, err := client.CoreV1().PersistentVolumes().Get(t.Context(), tc.pv.Name, metav1.GetOptions{})
+			require.NoError(err)
+			assert.Equal(tc.wantAnnotations, pv.Annotations)
+		})
+	}
+}
+
+func newPV(driver string, annotations map[string]string) *corev1.PersistentVolume {
+	return &corev1.PersistentVolume{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:        "pvc-1234",
+			Annotations: annotations,
+		},
+		Spec: corev1.PersistentVolumeSpec{
+			PersistentVolumeSource: corev1.PersistentVolumeSource{
+				CSI: &corev1.CSIPersistentVolumeSource{
+					Driver:       driver,
+					VolumeHandle: "volume-1234",
+				},
+			},
+		},
+	}
+}
+
+type stubKeyRotator struct {
+	getDevicePathErr error
+	version          uint32
+	rotateErr        error
+
+	rotatedVolume string
+	reencrypt     bool
+}
+
+func (r *stubKeyRotator) GetDevicePath(volumeID string) (string, error) {
+	return "/dev/mapper/" + volumeID, r.getDevicePathErr
+}
+
+func (r *stubKeyRotator) RotateKey(_ context.Context, volumeID string, reencrypt bool) (uint32, error) {
+	r.rotatedVolume = volumeID
+	r.reencrypt = reencrypt
+	return r.version, r.rotateErr
+}
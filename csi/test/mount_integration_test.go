@@ -10,6 +10,7 @@ package integration
 
 import (
 	"context"
+	"errors"
 	"fmt"
 	"os"
 	"os/exec"
@@ -186,6 +187,28 @@ func TestOpenAndCloseIntegrity(t *testing.T) {
 	assert.NoError(mapper.CloseCryptDevice(deviceName))
 }
 
+func TestOpenAndCloseWithProfile(t *testing.T) {
+	assert := assert.New(t)
+	require := require.New(t)
+	setup(devicePath)
+	defer teardown(devicePath)
+
+	mapper := cryptmapper.New(&fakeKMS{})
+	profile := cryptmapper.Profile{Name: cryptmapper.ProfileAESGCM, SectorSize: 4096, NoJournal: true}
+
+	newPath, err := mapper.OpenCryptDeviceWithProfile(t.Context(), devicePath, deviceName, profile)
+	require.NoError(err)
+	// assert integrity device got created
+	_, err = os.Stat(newPath + "_dif")
+	assert.NoError(err)
+	assert.NoError(mapper.CloseCryptDevice(deviceName))
+
+	// check if we can reopen the device without specifying the profile
+	_, err = mapper.OpenCryptDevice(t.Context(), devicePath, deviceName, true)
+	assert.NoError(err)
+	assert.NoError(mapper.CloseCryptDevice(deviceName))
+}
+
 func TestDeviceCloning(t *testing.T) {
 	assert := assert.New(t)
 	require := require.New(t)
@@ -207,6 +230,111 @@ func TestDeviceCloning(t *testing.T) {
 	assert.NoError(mapper.CloseCryptDevice(deviceName + "-copy"))
 }
 
+func TestDeviceCloningWithRekeying(t *testing.T) {
+	assert := assert.New(t)
+	require := require.New(t)
+	setup(devicePath)
+	defer teardown(devicePath)
+
+	mapper := cryptmapper.New(&dynamicKMS{}, cryptmapper.WithCloneRekeying())
+
+	_, err := mapper.OpenCryptDevice(t.Context(), devicePath, deviceName, false)
+	require.NoError(err)
+	require.NoError(mapper.CloseCryptDevice(deviceName))
+
+	require.NoError(cp(devicePath, devicePath+"-copy"))
+	defer teardown(devicePath + "-copy")
+
+	// the clone is re-keyed when opened for the first time
+	_, err = mapper.OpenCryptDevice(t.Context(), devicePath+"-copy", deviceName+"-copy", false)
+	require.NoError(err)
+	require.NoError(mapper.CloseCryptDevice(deviceName + "-copy"))
+
+	// both devices can be opened with their own key
+	_, err = mapper.OpenCryptDevice(t.Context(), devicePath+"-copy", deviceName+"-copy", false)
+	assert.NoError(err)
+	_, err = mapper.OpenCryptDevice(t.Context(), devicePath, deviceName, false)
+	assert.NoError(err)
+
+	assert.NoError(mapper.CloseCryptDevice(deviceName))
+	assert.NoError(mapper.CloseCryptDevice(deviceName + "-copy"))
+}
+
+func TestRotateKey(t *testing.T) {
+	assert := assert.New(t)
+	require := require.New(t)
+	setup(devicePath)
+	defer teardown(devicePath)
+
+	kms := &fakeKMS{}
+	mapper := cryptmapper.New(kms)
+
+	_, err := mapper.OpenCryptDevice(t.Context(), devicePath, deviceName, false)
+	require.NoError(err)
+	defer func() {
+		_ = mapper.CloseCryptDevice(deviceName)
+	}()
+
+	version, err := mapper.RotateKey(t.Context(), deviceName, false)
+	require.NoError(err)
+	assert.Equal(uint32(1), version)
+
+	version, err = mapper.RotateKey(t.Context(), deviceName, true)
+	require.NoError(err)
+	assert.Equal(uint32(2), version)
+
+	// check if we can reopen the device with the rotated key
+	require.NoError(mapper.CloseCryptDevice(deviceName))
+	_, err = mapper.OpenCryptDevice(t.Context(), devicePath, deviceName, false)
+	assert.NoError(err)
+	require.NoError(mapper.CloseCryptDevice(deviceName))
+
+	// integrity devices do not support reencryption
+	setup(devicePath)
+	_, err = mapper.OpenCryptDevice(t.Context(), devicePath, deviceName, true)
+	require.NoError(err)
+	_, err = mapper.RotateKey(t.Context(), deviceName, true)
+	assert.Error(err)
+}
+
+func TestRotateKeyWithSectorSize(t *testing.T) {
+	assert := assert.New(t)
+	require := require.New(t)
+	setup(devicePath)
+	defer teardown(devicePath)
+
+	mapper := cryptmapper.New(&fakeKMS{})
+	profile := cryptmapper.Profile{Name: cryptmapper.ProfileAESXTS, SectorSize: 512}
+
+	newPath, err := mapper.OpenCryptDeviceWithProfile(t.Context(), devicePath, deviceName, profile)
+	require.NoError(err)
+	defer func() {
+		_ = mapper.CloseCryptDevice(deviceName)
+	}()
+	assert.Equal("512", logicalBlockSize(t, newPath))
+
+	_, err = mapper.RotateKey(t.Context(), deviceName, true)
+	require.NoError(err)
+	assert.Equal("512", logicalBlockSize(t, newPath))
+
+	// check if the device keeps its sector size when reopened with the rotated key
+	require.NoError(mapper.CloseCryptDevice(deviceName))
+	newPath, err = mapper.OpenCryptDevice(t.Context(), devicePath, deviceName, false)
+	require.NoError(err)
+	assert.Equal("512", logicalBlockSize(t, newPath))
+	assert.NoError(mapper.CloseCryptDevice(deviceName))
+}
+
+// logicalBlockSize returns the logical block size of a device mapper device, which is the sector size of a crypt device.
+func logicalBlockSize(t *testing.T, mappedPath string) string {
+	t.Helper()
+	device, err := filepath.EvalSymlinks(mappedPath)
+	require.NoError(t, err)
+	size, err := os.ReadFile(filepath.Join("/sys/block", filepath.Base(device), "queue/logical_block_size"))
+	require.NoError(t, err)
+	return strings.TrimSpace(string(size))
+}
+
 func TestConcurrency(t *testing.T) {
 	assert := assert.New(t)
 	setup(devicePath)
@@ -242,22 +370,36 @@ func TestConcurrency(t *testing.T) {
 	wg.Wait()
 }
 
-type fakeKMS struct{}
+type fakeKMS struct {
+	mux     sync.Mutex
+	version uint32
+}
 
-func (k *fakeKMS) GetDEK(_ context.Context, _ string, dekSize int) ([]byte, error) {
+func (k *fakeKMS) GetVersionedDEK(_ context.Context, _ string, version uint32, dekSize int) ([]byte, error) {
 	key := make([]byte, dekSize)
 	for i := range key {
-		key[i] = 0x41
+		key[i] = 0x41 + byte(version)
 	}
 	return key, nil
 }
 
+func (k *fakeKMS) RotateDEK(_ context.Context, _ string) (uint32, error) {
+	k.mux.Lock()
+	defer k.mux.Unlock()
+	k.version++
+	return k.version, nil
+}
+
 type dynamicKMS struct{}
 
-func (k *dynamicKMS) GetDEK(_ context.Context, dekID string, dekSize int) ([]byte, error) {
+func (k *dynamicKMS) GetVersionedDEK(_ context.Context, dekID string, version uint32, dekSize int) ([]byte, error) {
 	key := make([]byte, dekSize)
 	for i := range key {
-		key[i] = 0x41 ^ dekID[i%len(dekID)]
+		key[i] = 0x41 ^ dekID[i%len(dekID)] ^ byte(version)
 	}
 	return key, nil
 }
+
+func (k *dynamicKMS) RotateDEK(_ context.Context, _ string) (uint32, error) {
+	return 0, errors.New("key rotation not supported")
+}
@@ -84,8 +84,9 @@ func (d *DiskEncryption) FormatDisk(passphrase string) error {
 }
 
 // MapDisk maps a crypt device to /dev/mapper/target using the provided passphrase.
+// The passphrase may unlock any keyslot of the device.
 func (d *DiskEncryption) MapDisk(target, passphrase string) error {
-	if err := d.device.ActivateByPassphrase(target, 0, passphrase, cryptsetup.ReadWriteQueueBypass); err != nil {
+	if err := d.device.ActivateByPassphrase(target, cryptsetup.AnyKeyslot, passphrase, cryptsetup.ReadWriteQueueBypass); err != nil {
 		return fmt.Errorf("mapping disk as %q: %w", target, err)
 	}
 	return nil
@@ -96,6 +97,56 @@ func (d *DiskEncryption) UnmapDisk(target string) error {
 	return d.device.Deactivate(target)
 }
 
+// KeyVersion returns the version of the key that unlocks the disk.
+func (d *DiskEncryption) KeyVersion() uint32 {
+	return d.device.ConstellationStateDiskKeyVersion()
+}
+
+// ReplaceKey replaces the passphrase of the disk with newPassphrase, and records its version.
+// The replacement is idempotent, so an interrupted replacement can be finished by calling ReplaceKey again.
+// If it is interrupted after the old keyslot was destroyed, the disk can only be unlocked using newPassphrase.
+func (d *DiskEncryption) ReplaceKey(passphrase, newPassphrase string, newVersion uint32) error {
+	if passphrase != newPassphrase {
+		if _, err := d.device.KeyslotByPassphrase(newPassphrase); err != nil {
+			if _, err := d.device.KeyslotAddByPassphrase(passphrase, newPassphrase); err != nil {
+				return fmt.Errorf("adding keyslot for new key: %w", err)
+			}
+		}
+		// an error means the old keyslot was already destroyed
+		if keyslot, err := d.device.KeyslotByPassphrase(passphrase); err == nil {
+			if err := d.device.KeyslotDestroy(keyslot); err != nil {
+				return fmt.Errorf("destroying keyslot of old key: %w", err)
+			}
+		}
+	}
+
+	if err := d.device.SetConstellationStateDiskKeyVersion(newVersion); err != nil {
+		return fmt.Errorf("recording key version: %w", err)
+	}
+	return nil
+}
+
+// RecoveryKeyslot returns the keyslot of the escrowed recovery key.
+// The keyslot is -1 if the disk has no recovery key.
+func (d *DiskEncryption) RecoveryKeyslot() int {
+	return d.device.ConstellationStateDiskRecoveryKeyslot()
+}
+
+// AddRecoveryKey adds a keyslot for the escrowed recovery key.
+func (d *DiskEncryption) AddRecoveryKey(passphrase, recoveryKey string) error {
+	keyslot, err := d.device.KeyslotByPassphrase(recoveryKey)
+	if err != nil {
+		keyslot, err = d.device.KeyslotAddByPassphrase(passphrase, recoveryKey)
+		if err != nil {
+			return fmt.Errorf("adding keyslot for recovery key: %w", err)
+		}
+	}
+	if err := d.device.SetConstellationStateDiskRecoveryKeyslot(keyslot); err != nil {
+		return fmt.Errorf("recording recovery key: %w", err)
+	}
+	return nil
+}
+
 // Wipe overwrites the device with zeros to initialize integrity checksums.
 func (d *DiskEncryption) Wipe(blockWipeSize int) error {
 	logProgress := func(size, offset uint64) {
@@ -127,7 +178,14 @@ type cryptDevice interface {
 	Init(path string) (func(), error)
 	LoadLUKS2() error
 	KeyslotAddByVolumeKey(keyslot int, volumeKey string, passphrase string) error
+	KeyslotAddByPassphrase(passphrase, newPassphrase string) (int, error)
+	KeyslotByPassphrase(passphrase string) (int, error)
+	KeyslotDestroy(keyslot int) error
 	SetConstellationStateDiskToken(diskIsInitialized bool) error
 	ConstellationStateDiskTokenIsInitialized() bool
+	SetConstellationStateDiskKeyVersion(version uint32) error
+	ConstellationStateDiskKeyVersion() uint32
+	SetConstellationStateDiskRecoveryKeyslot(keyslot int) error
+	ConstellationStateDiskRecoveryKeyslot() int
 	Wipe(name string, wipeBlockSize int, flags int, logCallback func(size, offset uint64), logFrequency time.Duration) error
 }
@@ -40,6 +40,7 @@ type RecoveryServer struct {
 	mux sync.Mutex
 
 	diskUUID          string
+	keyVersion        uint32
 	stateDiskKey      []byte
 	measurementSecret []byte
 	grpcServer        server
@@ -71,9 +72,13 @@ func New(issuer atls.Issuer, factory kmsFactory, log *slog.Logger) *RecoveryServ
 // It blocks until a recover request call is successful.
 // The server will shut down when the call is successful and the keys are returned.
 // Additionally, the server can be shutdown by canceling the context.
-func (s *RecoveryServer) Serve(ctx context.Context, listener net.Listener, diskUUID string) (diskKey, measurementSecret []byte, err error) {
+// keyVersion is the version of the key the state disk is currently encrypted with.
+// If the disk is recovered using its escrowed recovery key, the returned key is the recovery key,
+// and the measurement secret is the one escrowed next to it.
+func (s *RecoveryServer) Serve(ctx context.Context, listener net.Listener, diskUUID string, keyVersion uint32) (diskKey, measurementSecret []byte, err error) {
 	s.log.Info("Starting RecoveryServer")
 	s.diskUUID = diskUUID
+	s.keyVersion = keyVersion
 	recoveryDone := make(chan struct{}, 1)
 	var serveErr error
 
@@ -114,17 +119,37 @@ func (s *RecoveryServer) Recover(ctx context.Context, req *recoverproto.RecoverM
 		return nil, status.Errorf(codes.Internal, "creating kms client: %s", err)
 	}
 
-	measurementSecret, err := cloudKms.GetDEK(ctx, crypto.DEKPrefix+crypto.MeasurementSecretKeyID, crypto.DerivedKeyLengthDefault)
-	if err != nil {
-		return nil, status.Errorf(codes.Internal, "requesting measurementSecret: %s", err)
-	}
-	stateDiskKey, err := cloudKms.GetDEK(ctx, crypto.DEKPrefix+s.diskUUID, crypto.StateDiskKeyLength)
-	if err != nil {
-		return nil, status.Errorf(codes.Internal, "requesting stateDiskKey: %s", err)
+	if req.UseRecoveryKey {
+		// The join service escrows the measurement secret next to the recovery keys.
+		// Escrowed keys are only loaded, so a missing key isn't silently replaced by a new random one.
+		escrow, ok := cloudKms.(kms.KeyEscrow)
+		if !ok {
+			return nil, status.Error(codes.InvalidArgument, "KMS doesn't support escrowed recovery keys")
+		}
+		measurementSecret, err := escrow.LoadDEK(ctx, crypto.StateDiskRecoveryMeasurementSecretID)
+		if err != nil {
+			return nil, status.Errorf(codes.Internal, "requesting escrowed measurementSecret: %s", err)
+		}
+		recoveryKey, err := escrow.LoadDEK(ctx, crypto.StateDiskRecoveryKeyID(s.diskUUID))
+		if err != nil {
+			return nil, status.Errorf(codes.Internal, "requesting recovery key: %s", err)
+		}
+		s.stateDiskKey = recoveryKey
+		s.measurementSecret = measurementSecret
+		log.Info("Received escrowed recovery key and measurement secret, shutting down server")
+	} else {
+		measurementSecret, err := cloudKms.GetDEK(ctx, crypto.DEKPrefix+crypto.MeasurementSecretKeyID, crypto.DerivedKeyLengthDefault)
+		if err != nil {
+			return nil, status.Errorf(codes.Internal, "requesting measurementSecret: %s", err)
+		}
+		stateDiskKey, err := cloudKms.GetDEK(ctx, crypto.VersionedDEKID(s.diskUUID, s.keyVersion), crypto.StateDiskKeyLength)
+		if err != nil {
+			return nil, status.Errorf(codes.Internal, "requesting stateDiskKey: %s", err)
+		}
+		s.stateDiskKey = stateDiskKey
+		s.measurementSecret = measurementSecret
+		log.Info("Received state disk key and measurement secret, shutting down server")
 	}
-	s.stateDiskKey = stateDiskKey
-	s.measurementSecret = measurementSecret
-	log.Info("Received state disk key and measurement secret, shutting down server")
 
 	go s.grpcServer.GracefulStop()
 	return &recoverproto.RecoverResponse{}, nil
@@ -142,7 +167,7 @@ func NewStub(log *slog.Logger) *StubServer {
 }
 
 // Serve waits until the context is canceled and returns nil.
-func (s *StubServer) Serve(ctx context.Context, _ net.Listener, _ string) ([]byte, []byte, error) {
+func (s *StubServer) Serve(ctx context.Context, _ net.Listener, _ string, _ uint32) ([]byte, []byte, error) {
 	s.log.Info("Running as worker node, skipping recovery server")
 	<-ctx.Done()
 	return nil, nil, ctx.Err()
@@ -47,7 +47,7 @@ func TestServe(t *testing.T) {
 	wg.Add(1)
 	go func() {
 		defer wg.Done()
-		_, _, err := server.Serve(ctx, listener, uuid)
+		_, _, err := server.Serve(ctx, listener, uuid, 0)
 		assert.ErrorIs(err, context.Canceled)
 	}()
 	time.Sleep(100 * time.Millisecond)
@@ -62,7 +62,7 @@ func TestServe(t *testing.T) {
 	wg.Add(1)
 	go func() {
 		defer wg.Done()
-		_, _, err := server.Serve(t.Context(), listener, uuid)
+		_, _, err := server.Serve(t.Context(), listener, uuid, 0)
 		assert.NoError(err)
 	}()
 	time.Sleep(100 * time.Millisecond)
@@ -70,22 +70,58 @@ func TestServe(t *testing.T) {
 	wg.Wait()
 
 	// Serve method returns an error when serving is unsuccessful
-	_, _, err := server.Serve(t.Context(), listener, uuid)
+	_, _, err := server.Serve(t.Context(), listener, uuid, 0)
 	assert.Error(err)
 }
 
 func TestRecover(t *testing.T) {
 	testCases := map[string]struct {
-		kmsURI     string
-		storageURI string
-		factory    kmsFactory
-		wantErr    bool
+		kmsURI                string
+		storageURI            string
+		keyVersion            uint32
+		useRecoveryKey        bool
+		factory               kmsFactory
+		wantDiskKey           []byte
+		wantMeasurementSecret []byte
+		wantErr               bool
 	}{
 		"success": {
 			// base64 encoded: key=masterkey&salt=somesalt
-			kmsURI:     "kms://cluster-kms?key=bWFzdGVya2V5&salt=c29tZXNhbHQ=",
-			storageURI: "storage://no-store",
-			factory:    newStubKMS(nil, nil),
+			kmsURI:                "kms://cluster-kms?key=bWFzdGVya2V5&salt=c29tZXNhbHQ=",
+			storageURI:            "storage://no-store",
+			factory:               newStubKMS(nil, nil),
+			wantDiskKey:           []byte("key-uuid"),
+			wantMeasurementSecret: []byte("key-measurementSecret"),
+		},
+		"rotated key": {
+			kmsURI:                "kms://cluster-kms?key=bWFzdGVya2V5&salt=c29tZXNhbHQ=",
+			storageURI:            "storage://no-store",
+			keyVersion:            2,
+			factory:               newStubKMS(nil, nil),
+			wantDiskKey:           []byte("versioned-key-v2-uuid"),
+			wantMeasurementSecret: []byte("key-measurementSecret"),
+		},
+		"recovery key": {
+			kmsURI:                "kms://aws?keyName=recovery",
+			storageURI:            "storage://aws?bucket=recovery",
+			useRecoveryKey:        true,
+			factory:               newStubKMS(nil, nil),
+			wantDiskKey:           []byte("key-state-disk-recovery-uuid"),
+			wantMeasurementSecret: []byte("key-state-disk-recovery-measurement-secret"),
+		},
+		"recovery key from KMS without escrow support": {
+			kmsURI:         "kms://cluster-kms?key=ZXNjcm93a2V5&salt=c29tZXNhbHQ=",
+			storageURI:     "storage://no-store",
+			useRecoveryKey: true,
+			factory:        newStubCloudKMS(),
+			wantErr:        true,
+		},
+		"loading escrowed keys fails": {
+			kmsURI:         "kms://aws?keyName=recovery",
+			storageURI:     "storage://aws?bucket=recovery",
+			useRecoveryKey: true,
+			factory:        newStubKMS(nil, errors.New("LoadDEK failed")),
+			wantErr:        true,
 		},
 		"kms init fails": {
 			factory: newStubKMS(errors.New("setup failed"), nil),
@@ -120,7 +156,7 @@ func TestRecover(t *testing.T) {
 			wg.Add(1)
 			go func() {
 				defer wg.Done()
-				diskKey, measurementSecret, serveErr = server.Serve(serveCtx, listener, serverUUID)
+				diskKey, measurementSecret, serveErr = server.Serve(serveCtx, listener, serverUUID, tc.keyVersion)
 			}()
 
 			conn, err := dialer.New(nil, nil, netDialer).Dial("192.0.2.1:1234")
@@ -128,8 +164,9 @@ func TestRecover(t *testing.T) {
 			defer conn.Close()
 
 			req := recoverproto.RecoverMessage{
-				KmsUri:     tc.kmsURI,
-				StorageUri: tc.storageURI,
+				KmsUri:         tc.kmsURI,
+				StorageUri:     tc.storageURI,
+				UseRecoveryKey: tc.useRecoveryKey,
 			}
 			_, err = recoverproto.NewAPIClient(conn).Recover(ctx, &req)
 
@@ -140,8 +177,8 @@ func TestRecover(t *testing.T) {
 			wg.Wait()
 			require.NoError(serveErr)
 			assert.NoError(err)
-			assert.NotNil(measurementSecret)
-			assert.NotNil(diskKey)
+			assert.Equal(tc.wantMeasurementSecret, measurementSecret)
+			assert.Equal(tc.wantDiskKey, diskKey)
 		})
 	}
 }
@@ -155,14 +192,36 @@ func newStubKMS(setupErr, getDEKErr error) kmsFactory {
 	}
 }
 
+func newStubCloudKMS() kmsFactory {
+	return func(_ context.Context, _ string, _ string) (kms.CloudKMS, error) {
+		return &stubCloudKMS{}, nil
+	}
+}
+
 type stubKMS struct {
-	kms.CloudKMS
+	kms.KeyEscrow
 	getDEKErr error
 }
 
-func (s *stubKMS) GetDEK(_ context.Context, _ string, _ int) ([]byte, error) {
+func (s *stubKMS) GetDEK(_ context.Context, dekID string, _ int) ([]byte, error) {
 	if s.getDEKErr != nil {
 		return nil, s.getDEKErr
 	}
-	return []byte("someDEK"), nil
+	return []byte(dekID), nil
+}
+
+func (s *stubKMS) LoadDEK(_ context.Context, dekID string) ([]byte, error) {
+	if s.getDEKErr != nil {
+		return nil, s.getDEKErr
+	}
+	return []byte(dekID), nil
+}
+
+// stubCloudKMS is a KMS that doesn't support escrowed keys.
+type stubCloudKMS struct {
+	kms.CloudKMS
+}
+
+func (s *stubCloudKMS) GetDEK(_ context.Context, dekID string, _ int) ([]byte, error) {
+	return []byte(dekID), nil
 }
@@ -36,8 +36,9 @@ const (
 // RejoinClient is a client for requesting the needed information
 // for rejoining a cluster as a restarting worker or control-plane node.
 type RejoinClient struct {
-	diskUUID string
-	nodeInfo metadata.InstanceMetadata
+	diskUUID   string
+	keyVersion uint32
+	nodeInfo   metadata.InstanceMetadata
 
 	timeout  time.Duration
 	interval time.Duration
@@ -67,10 +68,13 @@ func New(dial grpcDialer, nodeInfo metadata.InstanceMetadata,
 // Start starts the rejoin client.
 // The client will continuously request available control-plane endpoints
 // from the metadata API and send rejoin requests to them.
-// The function returns after a successful rejoin request has been performed.
-func (c *RejoinClient) Start(ctx context.Context, diskUUID string) (diskKey, measurementSecret []byte) {
+// The function returns the rejoin ticket after a successful rejoin request has been performed,
+// or nil if the context is canceled.
+// keyVersion is the version of the key the state disk is currently encrypted with.
+func (c *RejoinClient) Start(ctx context.Context, diskUUID string, keyVersion uint32) *joinproto.IssueRejoinTicketResponse {
 	c.log.Info("Starting RejoinClient")
 	c.diskUUID = diskUUID
+	c.keyVersion = keyVersion
 	ticker := c.clock.NewTicker(c.interval)
 
 	defer ticker.Stop()
@@ -82,40 +86,40 @@ func (c *RejoinClient) Start(ctx context.Context, diskUUID string) (diskKey, mea
 			c.log.With(slog.Any("error", err)).Error("Failed to get control-plane endpoints")
 		} else {
 			c.log.With(slog.Any("endpoints", endpoints)).Info("Received list with JoinService endpoints")
-			diskKey, measurementSecret, err = c.tryRejoinWithAvailableServices(ctx, endpoints)
+			rejoinTicket, err := c.tryRejoinWithAvailableServices(ctx, endpoints)
 			if err == nil {
 				c.log.Info("Successfully retrieved rejoin ticket")
-				return diskKey, measurementSecret
+				return rejoinTicket
 			}
 		}
 
 		select {
 		case <-ctx.Done():
-			return nil, nil
+			return nil
 		case <-ticker.C():
 		}
 	}
 }
 
 // tryRejoinWithAvailableServices tries sending rejoin requests to the available endpoints.
-func (c *RejoinClient) tryRejoinWithAvailableServices(ctx context.Context, endpoints []string) (diskKey, measurementSecret []byte, err error) {
+func (c *RejoinClient) tryRejoinWithAvailableServices(ctx context.Context, endpoints []string) (*joinproto.IssueRejoinTicketResponse, error) {
 	for _, endpoint := range endpoints {
 		c.log.With(slog.String("endpoint", endpoint)).Info("Requesting rejoin ticket")
 		rejoinTicket, err := c.requestRejoinTicket(endpoint)
 		if err == nil {
-			return rejoinTicket.StateDiskKey, rejoinTicket.MeasurementSecret, nil
+			return rejoinTicket, nil
 		}
 		c.log.With(slog.Any("error", err), slog.String("endpoint", endpoint)).Warn("Failed to rejoin on endpoint")
 
 		// stop requesting additional endpoints if the context is done
 		select {
 		case <-ctx.Done():
-			return nil, nil, ctx.Err()
+			return nil, ctx.Err()
 		default:
 		}
 	}
 	c.log.Error("Failed to rejoin on all endpoints")
-	return nil, nil, errors.New("failed to join on all endpoints")
+	return nil, errors.New("failed to join on all endpoints")
 }
 
 // requestRejoinTicket requests a rejoin ticket from the endpoint.
@@ -129,7 +133,10 @@ func (c *RejoinClient) requestRejoinTicket(endpoint string) (*joinproto.IssueRej
 	}
 	defer conn.Close()
 
-	return joinproto.NewAPIClient(conn).IssueRejoinTicket(ctx, &joinproto.IssueRejoinTicketRequest{DiskUuid: c.diskUUID})
+	return joinproto.NewAPIClient(conn).IssueRejoinTicket(ctx, &joinproto.IssueRejoinTicketRequest{
+		DiskUuid:            c.diskUUID,
+		StateDiskKeyVersion: c.keyVersion,
+	})
 }
 
 // getJoinEndpoints requests the available control-plane endpoints from the metadata API.
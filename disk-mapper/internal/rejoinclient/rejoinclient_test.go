@@ -77,7 +77,7 @@ func TestStartCancel(t *testing.T) {
 
 	go func() {
 		defer wg.Done()
-		client.Start(ctx, "uuid")
+		client.Start(ctx, "uuid", 0)
 	}()
 
 	clock.Step(time.Millisecond)
@@ -265,6 +265,7 @@ func TestStart(t *testing.T) {
 					MeasurementSecret: measurementSecret,
 				},
 			}
+
 			joinproto.RegisterAPIServer(rejoinServer, rejoinServiceAPI)
 			port := strconv.Itoa(constants.JoinServiceNodePort)
 			listener := netDialer.GetListener(net.JoinHostPort("192.0.2.1", port))
@@ -294,9 +295,11 @@ func TestStart(t *testing.T) {
 
 			client := New(dialer, tc.nodeInfo, meta, logger.NewTest(t))
 
-			passphrase, secret := client.Start(t.Context(), "uuid")
-			assert.Equal(diskKey, passphrase)
-			assert.Equal(measurementSecret, secret)
+			ticket := client.Start(t.Context(), "uuid", 2)
+			assert.Equal(diskKey, ticket.StateDiskKey)
+			assert.Equal(measurementSecret, ticket.MeasurementSecret)
+			assert.Equal("uuid", rejoinServiceAPI.gotRequest.GetDiskUuid())
+			assert.Equal(uint32(2), rejoinServiceAPI.gotRequest.GetStateDiskKeyVersion())
 		})
 	}
 }
@@ -319,10 +322,12 @@ func (s stubMetadataAPI) GetLoadBalancerEndpoint(_ context.Context) (string, str
 type stubRejoinServiceAPI struct {
 	rejoinTicketResponse *joinproto.IssueRejoinTicketResponse
 	err                  error
+	gotRequest           *joinproto.IssueRejoinTicketRequest
 	joinproto.UnimplementedAPIServer
 }
 
-func (s *stubRejoinServiceAPI) IssueRejoinTicket(context.Context, *joinproto.IssueRejoinTicketRequest,
+func (s *stubRejoinServiceAPI) IssueRejoinTicket(_ context.Context, req *joinproto.IssueRejoinTicketRequest,
 ) (*joinproto.IssueRejoinTicketResponse, error) {
+	s.gotRequest = req
 	return s.rejoinTicketResponse, s.err
 }
@@ -27,6 +27,10 @@ type DeviceMapper interface {
 	FormatDisk(passphrase string) error
 	MapDisk(target string, passphrase string) error
 	UnmapDisk(target string) error
+	KeyVersion() uint32
+	ReplaceKey(passphrase, newPassphrase string, newVersion uint32) error
+	RecoveryKeyslot() int
+	AddRecoveryKey(passphrase, recoveryKey string) error
 }
 
 // ConfigurationGenerator is an interface for generating systemd-cryptsetup@.service unit files.
@@ -42,9 +46,9 @@ type MetadataAPI interface {
 }
 
 // RecoveryDoer is an interface to perform key recovery operations.
-// Calls to Do may be blocking, and if successful return a passphrase and measurementSecret.
+// Calls to Do may be blocking, and if successful return the keys of the state disk.
 type RecoveryDoer interface {
-	Do(uuid, endpoint string) (passphrase, measurementSecret []byte, err error)
+	Do(uuid, endpoint string, keyVersion uint32) (DiskKeys, error)
 }
 
 // DiskMounter uses the syscall package to mount disks.
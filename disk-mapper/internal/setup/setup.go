@@ -33,6 +33,7 @@ import (
 	"github.com/edgelesssys/constellation/v2/internal/crypto"
 	"github.com/edgelesssys/constellation/v2/internal/file"
 	"github.com/edgelesssys/constellation/v2/internal/nodestate"
+	"github.com/edgelesssys/constellation/v2/joinservice/joinproto"
 	"github.com/spf13/afero"
 )
 
@@ -76,21 +77,34 @@ func New(log *slog.Logger, csp string, diskPath string, fs afero.Afero,
 
 // PrepareExistingDisk requests and waits for a decryption key to remap the encrypted state disk.
 // Once the disk is mapped, the function taints the node as initialized by updating it's PCRs.
+// If a newer version of the state disk key is available, the disk is re-keyed to use it.
+// If an escrowed recovery key is available, it is added to the disk as a secondary key.
 func (s *Manager) PrepareExistingDisk(recoverer RecoveryDoer) error {
 	uuid, err := s.mapper.DiskUUID()
 	if err != nil {
 		return err
 	}
-	s.log.With(slog.String("uuid", uuid)).Info("Preparing existing state disk")
+	keyVersion := s.mapper.KeyVersion()
+	log := s.log.With(slog.String("uuid", uuid), slog.Uint64("keyVersion", uint64(keyVersion)))
+	log.Info("Preparing existing state disk")
 	endpoint := net.JoinHostPort("0.0.0.0", strconv.Itoa(constants.RecoveryPort))
 
-	passphrase, measurementSecret, err := recoverer.Do(uuid, endpoint)
+	keys, err := recoverer.Do(uuid, endpoint, keyVersion)
 	if err != nil {
 		return fmt.Errorf("failed to perform recovery: %w", err)
 	}
 
+	passphrase := keys.Passphrase
 	if err := s.mapper.MapDisk(stateDiskMappedName, string(passphrase)); err != nil {
-		return err
+		if keys.LatestPassphrase == nil {
+			return err
+		}
+		// A previous key rotation may have been interrupted after the old key was removed from the disk.
+		log.With(slog.Any("error", err)).Warn("Failed to map state disk, retrying with latest key")
+		if err := s.mapper.MapDisk(stateDiskMappedName, string(keys.LatestPassphrase)); err != nil {
+			return err
+		}
+		passphrase = keys.LatestPassphrase
 	}
 
 	if err := s.mounter.MkdirAll(stateDiskMountPath, os.ModePerm); err != nil {
@@ -107,7 +121,10 @@ func (s *Manager) PrepareExistingDisk(recoverer RecoveryDoer) error {
 		return err
 	}
 
-	clusterID, err := attestation.DeriveClusterID(measurementSecret, measurementSalt)
+	if len(keys.MeasurementSecret) == 0 {
+		return errors.New("missing measurement secret")
+	}
+	clusterID, err := attestation.DeriveClusterID(keys.MeasurementSecret, measurementSalt)
 	if err != nil {
 		return err
 	}
@@ -117,6 +134,21 @@ func (s *Manager) PrepareExistingDisk(recoverer RecoveryDoer) error {
 		return err
 	}
 
+	if keys.LatestPassphrase != nil {
+		log.Info(fmt.Sprintf("Rotating state disk key to version %d", keys.LatestKeyVersion))
+		if err := s.mapper.ReplaceKey(string(passphrase), string(keys.LatestPassphrase), keys.LatestKeyVersion); err != nil {
+			return fmt.Errorf("rotating state disk key: %w", err)
+		}
+		passphrase = keys.LatestPassphrase
+	}
+
+	if keys.RecoveryKey != nil && s.mapper.RecoveryKeyslot() < 0 {
+		log.Info("Adding escrowed recovery key to state disk")
+		if err := s.mapper.AddRecoveryKey(string(passphrase), string(keys.RecoveryKey)); err != nil {
+			return fmt.Errorf("adding recovery key: %w", err)
+		}
+	}
+
 	if err := s.saveConfiguration(passphrase); err != nil {
 		return err
 	}
@@ -220,12 +252,30 @@ func (s *Manager) LogDevices() error {
 
 // RecoveryServer interface serves a recovery server.
 type RecoveryServer interface {
-	Serve(context.Context, net.Listener, string) (key, secret []byte, err error)
+	Serve(ctx context.Context, lis net.Listener, uuid string, keyVersion uint32) (key, secret []byte, err error)
 }
 
 // RejoinClient interface starts a rejoin client.
 type RejoinClient interface {
-	Start(context.Context, string) (key, secret []byte)
+	Start(ctx context.Context, uuid string, keyVersion uint32) *joinproto.IssueRejoinTicketResponse
+}
+
+// DiskKeys are the keys returned by a successful recovery.
+type DiskKeys struct {
+	// Passphrase unlocks the state disk.
+	Passphrase []byte
+	// MeasurementSecret is used to derive the node's ClusterID.
+	// It is never stored on the disk. If Passphrase is the escrowed recovery key of the disk,
+	// it is the measurement secret escrowed next to the recovery key.
+	MeasurementSecret []byte
+	// LatestPassphrase is a newer version of the state disk key that should replace Passphrase.
+	// It is nil if the disk already uses the latest version.
+	LatestPassphrase []byte
+	// LatestKeyVersion is the version of LatestPassphrase.
+	LatestKeyVersion uint32
+	// RecoveryKey is the escrowed recovery key of the disk.
+	// It is nil if recovery key escrow is disabled.
+	RecoveryKey []byte
 }
 
 // NodeRecoverer bundles a RecoveryServer and RejoinClient.
@@ -245,13 +295,13 @@ func NewNodeRecoverer(recoveryServer RecoveryServer, rejoinClient RejoinClient)
 // Do performs a recovery procedure on the given state disk.
 // The method starts a gRPC server to allow manual recovery by a user.
 // At the same time it tries to request a decryption key from all available Constellation control-plane nodes.
-func (r *NodeRecoverer) Do(uuid, endpoint string) (passphrase, measurementSecret []byte, err error) {
+func (r *NodeRecoverer) Do(uuid, endpoint string, keyVersion uint32) (keys DiskKeys, err error) {
 	ctx, cancel := context.WithCancel(context.Background())
 	defer cancel()
 
 	lis, err := net.Listen("tcp", endpoint)
 	if err != nil {
-		return nil, nil, err
+		return DiskKeys{}, err
 	}
 	defer lis.Close()
 
@@ -261,11 +311,10 @@ func (r *NodeRecoverer) Do(uuid, endpoint string) (passphrase, measurementSecret
 	wg.Add(1)
 	go func() {
 		defer wg.Done()
-		key, secret, serveErr := r.recoveryServer.Serve(ctx, lis, uuid)
+		key, secret, serveErr := r.recoveryServer.Serve(ctx, lis, uuid, keyVersion)
 		once.Do(func() {
 			cancel()
-			passphrase = key
-			measurementSecret = secret
+			keys = DiskKeys{Passphrase: key, MeasurementSecret: secret}
 		})
 		if serveErr != nil && !errors.Is(serveErr, context.Canceled) {
 			err = serveErr
@@ -275,14 +324,19 @@ func (r *NodeRecoverer) Do(uuid, endpoint string) (passphrase, measurementSecret
 	wg.Add(1)
 	go func() {
 		defer wg.Done()
-		key, secret := r.rejoinClient.Start(ctx, uuid)
+		ticket := r.rejoinClient.Start(ctx, uuid, keyVersion)
 		once.Do(func() {
 			cancel()
-			passphrase = key
-			measurementSecret = secret
+			keys = DiskKeys{
+				Passphrase:        ticket.GetStateDiskKey(),
+				MeasurementSecret: ticket.GetMeasurementSecret(),
+				LatestPassphrase:  ticket.GetLatestStateDiskKey(),
+				LatestKeyVersion:  ticket.GetLatestStateDiskKeyVersion(),
+				RecoveryKey:       ticket.GetStateDiskRecoveryKey(),
+			}
 		})
 	}()
 
 	wg.Wait()
-	return passphrase, measurementSecret, err
+	return keys, err
 }
@@ -15,12 +15,14 @@ import (
 	"path/filepath"
 	"sync"
 	"testing"
+	"time"
 
 	"github.com/edgelesssys/constellation/v2/internal/attestation/vtpm"
 	"github.com/edgelesssys/constellation/v2/internal/crypto"
 	"github.com/edgelesssys/constellation/v2/internal/file"
 	"github.com/edgelesssys/constellation/v2/internal/logger"
 	"github.com/edgelesssys/constellation/v2/internal/nodestate"
+	"github.com/edgelesssys/constellation/v2/joinservice/joinproto"
 	"github.com/spf13/afero"
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
@@ -34,18 +36,24 @@ func TestMain(m *testing.M) {
 func TestPrepareExistingDisk(t *testing.T) {
 	someErr := errors.New("error")
 	testRecoveryDoer := &stubRecoveryDoer{
-		passphrase: []byte("passphrase"),
-		secret:     []byte("secret"),
+		keys: DiskKeys{
+			Passphrase:        []byte("passphrase"),
+			MeasurementSecret: []byte("secret"),
+		},
 	}
+	recoveryKey := []byte("recoveryKey")
 
 	testCases := map[string]struct {
-		recoveryDoer    *stubRecoveryDoer
-		mapper          *stubMapper
-		mounter         *stubMounter
-		configGenerator *stubConfigurationGenerator
-		openDevice      vtpm.TPMOpenFunc
-		missingState    bool
-		wantErr         bool
+		recoveryDoer        *stubRecoveryDoer
+		mapper              *stubMapper
+		mounter             *stubMounter
+		configGenerator     *stubConfigurationGenerator
+		openDevice          vtpm.TPMOpenFunc
+		missingState        bool
+		wantPassphrase      []byte
+		wantKeyVersion      uint32
+		wantRecoveryKeyslot bool
+		wantErr             bool
 	}{
 		"success": {
 			recoveryDoer:    testRecoveryDoer,
@@ -122,6 +130,93 @@ func TestPrepareExistingDisk(t *testing.T) {
 			missingState:    true,
 			wantErr:         true,
 		},
+		"key is rotated": {
+			recoveryDoer: &stubRecoveryDoer{keys: DiskKeys{
+				Passphrase:        []byte("passphrase"),
+				MeasurementSecret: []byte("secret"),
+				LatestPassphrase:  []byte("latestPassphrase"),
+				LatestKeyVersion:  2,
+			}},
+			mapper:          &stubMapper{uuid: "test", keyVersion: 1},
+			mounter:         &stubMounter{},
+			configGenerator: &stubConfigurationGenerator{},
+			openDevice:      vtpm.OpenNOPTPM,
+			wantPassphrase:  []byte("latestPassphrase"),
+			wantKeyVersion:  2,
+		},
+		"interrupted key rotation is resumed": {
+			recoveryDoer: &stubRecoveryDoer{keys: DiskKeys{
+				Passphrase:        []byte("passphrase"),
+				MeasurementSecret: []byte("secret"),
+				LatestPassphrase:  []byte("latestPassphrase"),
+				LatestKeyVersion:  2,
+			}},
+			mapper:          &stubMapper{uuid: "test", keyVersion: 1, validPassphrase: "latestPassphrase"},
+			mounter:         &stubMounter{},
+			configGenerator: &stubConfigurationGenerator{},
+			openDevice:      vtpm.OpenNOPTPM,
+			wantPassphrase:  []byte("latestPassphrase"),
+			wantKeyVersion:  2,
+		},
+		"key rotation fails": {
+			recoveryDoer: &stubRecoveryDoer{keys: DiskKeys{
+				Passphrase:        []byte("passphrase"),
+				MeasurementSecret: []byte("secret"),
+				LatestPassphrase:  []byte("latestPassphrase"),
+				LatestKeyVersion:  2,
+			}},
+			mapper:          &stubMapper{uuid: "test", replaceKeyErr: someErr},
+			mounter:         &stubMounter{},
+			configGenerator: &stubConfigurationGenerator{},
+			openDevice:      vtpm.OpenNOPTPM,
+			wantErr:         true,
+		},
+		"recovery key is added": {
+			recoveryDoer: &stubRecoveryDoer{keys: DiskKeys{
+				Passphrase:        []byte("passphrase"),
+				MeasurementSecret: []byte("secret"),
+				RecoveryKey:       recoveryKey,
+			}},
+			mapper:              &stubMapper{uuid: "test"},
+			mounter:             &stubMounter{},
+			configGenerator:     &stubConfigurationGenerator{},
+			openDevice:          vtpm.OpenNOPTPM,
+			wantRecoveryKeyslot: true,
+		},
+		"adding recovery key fails": {
+			recoveryDoer: &stubRecoveryDoer{keys: DiskKeys{
+				Passphrase:        []byte("passphrase"),
+				MeasurementSecret: []byte("secret"),
+				RecoveryKey:       recoveryKey,
+			}},
+			mapper:          &stubMapper{uuid: "test", addRecoveryKeyErr: someErr},
+			mounter:         &stubMounter{},
+			configGenerator: &stubConfigurationGenerator{},
+			openDevice:      vtpm.OpenNOPTPM,
+			wantErr:         true,
+		},
+		"unlocked with recovery key": {
+			recoveryDoer: &stubRecoveryDoer{keys: DiskKeys{
+				Passphrase:        recoveryKey,
+				MeasurementSecret: []byte("secret"),
+			}},
+			mapper:              &stubMapper{uuid: "test", recoveryKeyslot: 1},
+			mounter:             &stubMounter{},
+			configGenerator:     &stubConfigurationGenerator{},
+			openDevice:          vtpm.OpenNOPTPM,
+			wantPassphrase:      recoveryKey,
+			wantRecoveryKeyslot: true,
+		},
+		"missing measurement secret": {
+			recoveryDoer: &stubRecoveryDoer{keys: DiskKeys{
+				Passphrase: recoveryKey,
+			}},
+			mapper:          &stubMapper{uuid: "test", recoveryKeyslot: 1},
+			mounter:         &stubMounter{},
+			configGenerator: &stubConfigurationGenerator{},
+			openDevice:      vtpm.OpenNOPTPM,
+			wantErr:         true,
+		},
 	}
 
 	for name, tc := range testCases {
@@ -155,6 +250,21 @@ func TestPrepareExistingDisk(t *testing.T) {
 				assert.True(tc.mounter.mountCalled)
 				assert.True(tc.mounter.unmountCalled)
 				assert.False(tc.mapper.formatDiskCalled)
+
+				wantPassphrase := tc.wantPassphrase
+				if wantPassphrase == nil {
+					wantPassphrase = tc.recoveryDoer.keys.Passphrase
+				}
+				passphrase, err := fs.ReadFile(filepath.Join(keyPath, keyFile))
+				require.NoError(t, err)
+				assert.Equal(wantPassphrase, passphrase)
+				assert.Equal(tc.wantKeyVersion, tc.mapper.keyVersion)
+
+				if tc.wantRecoveryKeyslot {
+					assert.GreaterOrEqual(tc.mapper.RecoveryKeyslot(), 0)
+				} else {
+					assert.Less(tc.mapper.RecoveryKeyslot(), 0)
+				}
 			}
 		})
 	}
@@ -288,6 +398,8 @@ func TestRecoveryDoer(t *testing.T) {
 
 	rejoinClientKey := []byte("rejoinClientKey")
 	rejoinClientSecret := []byte("rejoinClientSecret")
+	rejoinClientLatestKey := []byte("rejoinClientLatestKey")
+	rejoinClientRecoveryKey := []byte("rejoinClientRecoveryKey")
 	recoveryServerKey := []byte("recoveryServerKey")
 	recoveryServerSecret := []byte("recoveryServerSecret")
 
@@ -299,21 +411,26 @@ func TestRecoveryDoer(t *testing.T) {
 		err:      recoveryServerErr,
 	}
 	rejoinClient := &stubRejoinClient{
-		key:      rejoinClientKey,
-		secret:   rejoinClientSecret,
+		ticket: &joinproto.IssueRejoinTicketResponse{
+			StateDiskKey:              rejoinClientKey,
+			MeasurementSecret:         rejoinClientSecret,
+			LatestStateDiskKey:        rejoinClientLatestKey,
+			LatestStateDiskKeyVersion: 2,
+			StateDiskRecoveryKey:      rejoinClientRecoveryKey,
+		},
 		sendKeys: make(chan struct{}, 1),
 	}
 	recoverer := NewNodeRecoverer(recoveryServer, rejoinClient)
 
 	var wg sync.WaitGroup
-	var key, secret []byte
+	var keys DiskKeys
 	var err error
 
 	// error from recovery server
 	wg.Add(1)
 	go func() {
 		defer wg.Done()
-		key, secret, err = recoverer.Do("", "")
+		keys, err = recoverer.Do("", "", 1)
 	}()
 	recoveryServer.sendKeys <- struct{}{}
 	wg.Wait()
@@ -326,13 +443,12 @@ func TestRecoveryDoer(t *testing.T) {
 	wg.Add(1)
 	go func() {
 		defer wg.Done()
-		key, secret, err = recoverer.Do("", "")
+		keys, err = recoverer.Do("", "", 1)
 	}()
 	recoveryServer.sendKeys <- struct{}{}
 	wg.Wait()
 	assert.NoError(err)
-	assert.Equal(recoveryServerKey, key)
-	assert.Equal(recoveryServerSecret, secret)
+	assert.Equal(DiskKeys{Passphrase: recoveryServerKey, MeasurementSecret: recoveryServerSecret}, keys)
 
 	recoveryServer.sendKeys = make(chan struct{}, 1)
 
@@ -340,13 +456,36 @@ func TestRecoveryDoer(t *testing.T) {
 	wg.Add(1)
 	go func() {
 		defer wg.Done()
-		key, secret, err = recoverer.Do("", "")
+		keys, err = recoverer.Do("", "", 1)
 	}()
 	rejoinClient.sendKeys <- struct{}{}
 	wg.Wait()
 	assert.NoError(err)
-	assert.Equal(rejoinClientKey, key)
-	assert.Equal(rejoinClientSecret, secret)
+	assert.Equal(DiskKeys{
+		Passphrase:        rejoinClientKey,
+		MeasurementSecret: rejoinClientSecret,
+		LatestPassphrase:  rejoinClientLatestKey,
+		LatestKeyVersion:  2,
+		RecoveryKey:       rejoinClientRecoveryKey,
+	}, keys)
+
+	recoveryServer.sendKeys = make(chan struct{}, 1)
+	rejoinClient.sendKeys = make(chan struct{}, 1)
+
+	// recovery server returns the recovery key and escrowed secret, no control-plane node is available
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		keys, err = recoverer.Do("", "", 1)
+	}()
+	recoveryServer.sendKeys <- struct{}{}
+	select {
+	case <-done:
+	case <-time.After(5 * time.Second):
+		assert.FailNow("recovery didn't finish while the rejoin client was still waiting for a control-plane node")
+	}
+	assert.NoError(err)
+	assert.Equal(DiskKeys{Passphrase: recoveryServerKey, MeasurementSecret: recoveryServerSecret}, keys)
 }
 
 type stubRecoveryServer struct {
@@ -356,7 +495,7 @@ type stubRecoveryServer struct {
 	err      error
 }
 
-func (s *stubRecoveryServer) Serve(ctx context.Context, _ net.Listener, _ string) ([]byte, []byte, error) {
+func (s *stubRecoveryServer) Serve(ctx context.Context, _ net.Listener, _ string, _ uint32) ([]byte, []byte, error) {
 	for {
 		select {
 		case <-ctx.Done():
@@ -368,30 +507,34 @@ func (s *stubRecoveryServer) Serve(ctx context.Context, _ net.Listener, _ string
 }
 
 type stubRejoinClient struct {
-	key      []byte
-	secret   []byte
+	ticket   *joinproto.IssueRejoinTicketResponse
 	sendKeys chan struct{}
 }
 
-func (s *stubRejoinClient) Start(ctx context.Context, _ string) ([]byte, []byte) {
+func (s *stubRejoinClient) Start(ctx context.Context, _ string, _ uint32) *joinproto.IssueRejoinTicketResponse {
 	for {
 		select {
 		case <-ctx.Done():
-			return nil, nil
+			return nil
 		case <-s.sendKeys:
-			return s.key, s.secret
+			return s.ticket
 		}
 	}
 }
 
 type stubMapper struct {
-	formatDiskCalled bool
-	formatDiskErr    error
-	mapDiskCalled    bool
-	mapDiskErr       error
-	unmapDiskCalled  bool
-	unmapDiskErr     error
-	uuid             string
+	formatDiskCalled  bool
+	formatDiskErr     error
+	mapDiskCalled     bool
+	mapDiskErr        error
+	validPassphrase   string
+	unmapDiskCalled   bool
+	unmapDiskErr      error
+	uuid              string
+	keyVersion        uint32
+	replaceKeyErr     error
+	recoveryKeyslot   int
+	addRecoveryKeyErr error
 }
 
 func (s *stubMapper) DiskUUID() (string, error) {
@@ -403,8 +546,11 @@ func (s *stubMapper) FormatDisk(string) error {
 	return s.formatDiskErr
 }
 
-func (s *stubMapper) MapDisk(string, string) error {
+func (s *stubMapper) MapDisk(_, passphrase string) error {
 	s.mapDiskCalled = true
+	if s.validPassphrase != "" && passphrase != s.validPassphrase {
+		return errors.New("invalid passphrase")
+	}
 	return s.mapDiskErr
 }
 
@@ -417,6 +563,35 @@ func (s *stubMapper) SetDiskToInitialized() error {
 	return nil
 }
 
+func (s *stubMapper) KeyVersion() uint32 {
+	return s.keyVersion
+}
+
+func (s *stubMapper) ReplaceKey(_, _ string, newVersion uint32) error {
+	if s.replaceKeyErr != nil {
+		return s.replaceKeyErr
+	}
+	s.keyVersion = newVersion
+	return nil
+}
+
+// RecoveryKeyslot returns the recovery keyslot of the stub.
+// The zero value of recoveryKeyslot means no recovery key was added.
+func (s *stubMapper) RecoveryKeyslot() int {
+	if s.recoveryKeyslot == 0 {
+		return -1
+	}
+	return s.recoveryKeyslot
+}
+
+func (s *stubMapper) AddRecoveryKey(_, _ string) error {
+	if s.addRecoveryKeyErr != nil {
+		return s.addRecoveryKeyErr
+	}
+	s.recoveryKeyslot = 1
+	return nil
+}
+
 type stubMounter struct {
 	mountCalled   bool
 	mountErr      error
@@ -440,13 +615,12 @@ func (s *stubMounter) MkdirAll(_ string, _ fs.FileMode) error {
 }
 
 type stubRecoveryDoer struct {
-	passphrase  []byte
-	secret      []byte
+	keys        DiskKeys
 	recoveryErr error
 }
 
-func (s *stubRecoveryDoer) Do(_, _ string) (passphrase, measurementSecret []byte, err error) {
-	return s.passphrase, s.secret, s.recoveryErr
+func (s *stubRecoveryDoer) Do(_, _ string, _ uint32) (DiskKeys, error) {
+	return s.keys, s.recoveryErr
 }
 
 type stubConfigurationGenerator struct {
@@ -26,11 +26,12 @@ const (
 )
 
 type RecoverMessage struct {
-	state         protoimpl.MessageState `protogen:"open.v1"`
-	KmsUri        string                 `protobuf:"bytes,3,opt,name=kms_uri,json=kmsUri,proto3" json:"kms_uri,omitempty"`
-	StorageUri    string                 `protobuf:"bytes,4,opt,name=storage_uri,json=storageUri,proto3" json:"storage_uri,omitempty"`
-	unknownFields protoimpl.UnknownFields
-	sizeCache     protoimpl.SizeCache
+	state          protoimpl.MessageState `protogen:"open.v1"`
+	KmsUri         string                 `protobuf:"bytes,3,opt,name=kms_uri,json=kmsUri,proto3" json:"kms_uri,omitempty"`
+	StorageUri     string                 `protobuf:"bytes,4,opt,name=storage_uri,json=storageUri,proto3" json:"storage_uri,omitempty"`
+	UseRecoveryKey bool                   `protobuf:"varint,5,opt,name=use_recovery_key,json=useRecoveryKey,proto3" json:"use_recovery_key,omitempty"`
+	unknownFields  protoimpl.UnknownFields
+	sizeCache      protoimpl.SizeCache
 }
 
 func (x *RecoverMessage) Reset() {
@@ -77,6 +78,13 @@ func (x *RecoverMessage) GetStorageUri() string {
 	return ""
 }
 
+func (x *RecoverMessage) GetUseRecoveryKey() bool {
+	if x != nil {
+		return x.UseRecoveryKey
+	}
+	return false
+}
+
 type RecoverResponse struct {
 	state         protoimpl.MessageState `protogen:"open.v1"`
 	unknownFields protoimpl.UnknownFields
@@ -117,11 +125,12 @@ var File_disk_mapper_recoverproto_recover_proto protoreflect.FileDescriptor
 
 const file_disk_mapper_recoverproto_recover_proto_rawDesc = "" +
 	"\n" +
-	"&disk-mapper/recoverproto/recover.proto\x12\frecoverproto\"J\n" +
+	"&disk-mapper/recoverproto/recover.proto\x12\frecoverproto\"t\n" +
 	"\x0eRecoverMessage\x12\x17\n" +
 	"\akms_uri\x18\x03 \x01(\tR\x06kmsUri\x12\x1f\n" +
 	"\vstorage_uri\x18\x04 \x01(\tR\n" +
-	"storageUri\"\x11\n" +
+	"storageUri\x12(\n" +
+	"\x10use_recovery_key\x18\x05 \x01(\bR\x0euseRecoveryKey\"\x11\n" +
 	"\x0fRecoverResponse2O\n" +
 	"\x03API\x12H\n" +
 	"\aRecover\x12\x1c.recoverproto.RecoverMessage\x1a\x1d.recoverproto.RecoverResponse\"\x00BBZ@github.com/edgelesssys/constellation/v2/disk-mapper/recoverprotob\x06proto3"
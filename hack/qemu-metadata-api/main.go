@@ -12,10 +12,13 @@ import (
 	"flag"
 	"log/slog"
 	"os"
+	"strings"
 
 	"github.com/edgelesssys/constellation/v2/hack/qemu-metadata-api/dhcp/dnsmasq"
 	"github.com/edgelesssys/constellation/v2/hack/qemu-metadata-api/dhcp/virtwrapper"
+	"github.com/edgelesssys/constellation/v2/hack/qemu-metadata-api/scalinggroup"
 	"github.com/edgelesssys/constellation/v2/hack/qemu-metadata-api/server"
+	"github.com/edgelesssys/constellation/v2/internal/constants"
 	"github.com/edgelesssys/constellation/v2/internal/logger"
 	"libvirt.org/go/libvirt"
 )
@@ -26,11 +29,14 @@ func main() {
 	libvirtURI := flag.String("libvirt-uri", "qemu:///system", "URI of the libvirt connection")
 	leasesFileName := flag.String("dnsmasq-leases", "", "Path to the dnsmasq leases file")
 	initSecretHash := flag.String("initsecrethash", "", "brcypt hash of the init secret")
+	operatorPort := flag.String("operator-port", "8081", "Port to bind the scaling group endpoints used by the node operator to")
+	imageURLPrefixes := flag.String("image-url-prefixes", constants.CDNRepositoryURL+"/", "Comma separated list of URL prefixes images of scaling groups may be downloaded from")
 	flag.Parse()
 
 	log := logger.NewJSONLogger(slog.LevelInfo)
 
 	var leaseGetter server.LeaseGetter
+	var scalingGroups server.ScalingGroupManager
 	if *leasesFileName == "" {
 		conn, err := libvirt.NewConnect(*libvirtURI)
 		if err != nil {
@@ -39,14 +45,30 @@ func main() {
 		}
 		defer conn.Close()
 		leaseGetter = virtwrapper.New(conn, *targetNetwork)
+		var prefixes []string
+		if *imageURLPrefixes != "" {
+			prefixes = strings.Split(*imageURLPrefixes, ",")
+		}
+		scalingGroups, err = scalinggroup.New(conn, *targetNetwork, prefixes)
+		if err != nil {
+			log.With(slog.Any("error", err)).Error("Failed to create scaling group manager")
+			os.Exit(1)
+		}
 	} else {
-		log.Info("Using dnsmasq leases file")
+		log.Info("Using dnsmasq leases file, scaling groups are disabled")
 		leaseGetter = dnsmasq.New(*leasesFileName)
 	}
 
-	serv := server.New(log, *targetNetwork, *initSecretHash, leaseGetter)
-	if err := serv.ListenAndServe(*bindPort); err != nil {
-		log.With(slog.Any("error", err)).Error("Failed to serve")
-		os.Exit(1)
+	serv := server.New(log, *targetNetwork, *initSecretHash, leaseGetter, scalingGroups)
+	errs := make(chan error, 2)
+	go func() {
+		errs <- serv.ListenAndServe(*bindPort)
+	}()
+	if scalingGroups != nil {
+		go func() {
+			errs <- serv.ListenAndServeOperator(*operatorPort)
+		}()
 	}
+	log.With(slog.Any("error", <-errs)).Error("Failed to serve")
+	os.Exit(1)
 }
@@ -0,0 +1,145 @@
+/*
+Copyright (c) Edgeless Systems GmbH
+
+SPDX-License-Identifier: BUSL-1.1
+*/
+
+package scalinggroup
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"path"
+	"strings"
+)
+
+// ParseImageURLPrefixes parses the prefixes of URLs images may be downloaded from.
+// Each prefix must be an http or https URL, e.g., "https://cdn.confidential.cloud/constellation/".
+func ParseImageURLPrefixes(prefixes []string) ([]*url.URL, error) {
+	var parsed []*url.URL
+	for _, prefix := range prefixes {
+		prefixURL, err := url.Parse(prefix)
+		if err != nil {
+			return nil, fmt.Errorf("parsing image URL prefix %q: %w", prefix, err)
+		}
+		if (prefixURL.Scheme != "https" && prefixURL.Scheme != "http") || prefixURL.Host == "" || prefixURL.User != nil {
+			return nil, fmt.Errorf("image URL prefix %q must be an http or https URL without user info", prefix)
+		}
+		parsed = append(parsed, prefixURL)
+	}
+	return parsed, nil
+}
+
+// checkImage checks that an image is the path of a volume, or a URL with one of the allowed prefixes.
+// Images are downloaded from the host, so arbitrary URLs would let instances make the host send requests on their behalf.
+func (m *Manager) checkImage(image string) error {
+	if strings.HasPrefix(image, "/") {
+		return nil
+	}
+	imageURL, err := url.Parse(image)
+	if err != nil || !m.imageURLAllowed(imageURL) {
+		return fmt.Errorf("image %q must be a volume path or a URL with an allowed prefix: %w", image, ErrImageNotAllowed)
+	}
+	return nil
+}
+
+// imageURLAllowed reports whether a URL has one of the allowed prefixes.
+func (m *Manager) imageURLAllowed(imageURL *url.URL) bool {
+	if imageURL.User != nil {
+		return false
+	}
+	for _, prefix := range m.imageURLPrefixes {
+		if imageURL.Scheme == prefix.Scheme && imageURL.Host == prefix.Host && strings.HasPrefix(path.Clean(imageURL.Path), prefix.Path) {
+			return true
+		}
+	}
+	return false
+}
+
+// checkRedirect stops redirects of image downloads to URLs without an allowed prefix.
+func (m *Manager) checkRedirect(req *http.Request, _ []*http.Request) error {
+	if !m.imageURLAllowed(req.URL) {
+		return fmt.Errorf("redirect to %q: %w", req.URL, ErrImageNotAllowed)
+	}
+	return nil
+}
+
+// imageVolume returns the storage volume of an image.
+// Images are either referenced by the path of a volume, or by a URL of a raw image.
+// Images referenced by URL are downloaded once into the storage pool of the volume at poolOf.
+func (m *Manager) imageVolume(ctx context.Context, image, poolOf string) (volumeXML, error) {
+	if err := m.checkImage(image); err != nil {
+		return volumeXML{}, err
+	}
+	if strings.HasPrefix(image, "/") {
+		return m.volume(image)
+	}
+
+	hash := sha256.Sum256([]byte(image))
+	name := "constellation-image-" + hex.EncodeToString(hash[:8])
+	rawVolume, err := m.conn.volumeXMLByName(poolOf, name)
+	if errors.Is(err, ErrNotFound) {
+		if err := m.downloadImage(ctx, image, name, poolOf); err != nil {
+			return volumeXML{}, fmt.Errorf("downloading image %q: %w", image, err)
+		}
+		rawVolume, err = m.conn.volumeXMLByName(poolOf, name)
+	}
+	if err != nil {
+		return volumeXML{}, fmt.Errorf("getting volume %q: %w", name, err)
+	}
+	var volume volumeXML
+	if err := xml.Unmarshal([]byte(rawVolume), &volume); err != nil {
+		return volumeXML{}, fmt.Errorf("parsing volume XML: %w", err)
+	}
+	return volume, nil
+}
+
+// downloadImage downloads a raw image into a new storage volume.
+// The volume is deleted if the download fails.
+func (m *Manager) downloadImage(ctx context.Context, url, name, poolOf string) (retErr error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, url, http.NoBody)
+	if err != nil {
+		return err
+	}
+	resp, err := m.httpClient.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("unexpected status code %d", resp.StatusCode)
+	}
+	if resp.ContentLength <= 0 {
+		return errors.New("image size unknown")
+	}
+
+	var volume volumeXML
+	volume.Name = name
+	volume.Capacity.Unit = "bytes"
+	volume.Capacity.Value = uint64(resp.ContentLength)
+	volume.Target.Format.Type = "raw"
+	rawVolume, err := xml.Marshal(volume)
+	if err != nil {
+		return fmt.Errorf("marshalling volume XML: %w", err)
+	}
+	path, err := m.conn.createVolume(poolOf, string(rawVolume))
+	if err != nil {
+		return fmt.Errorf("creating volume %q: %w", name, err)
+	}
+	defer func() {
+		if retErr != nil {
+			retErr = errors.Join(retErr, m.conn.deleteVolume(path))
+		}
+	}()
+	return m.conn.uploadVolume(path, resp.Body, uint64(resp.ContentLength))
+}
+
+type httpClient interface {
+	Do(req *http.Request) (*http.Response, error)
+}
@@ -0,0 +1,264 @@
+//go:build cgo
+
+/*
+Copyright (c) Edgeless Systems GmbH
+
+SPDX-License-Identifier: BUSL-1.1
+*/
+
+package scalinggroup
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+
+	"libvirt.org/go/libvirt"
+)
+
+// New creates a new Manager for the domains attached to the given libvirt network.
+// Images referenced by URL are only downloaded if the URL starts with one of imageURLPrefixes.
+func New(conn *libvirt.Connect, network string, imageURLPrefixes []string) (*Manager, error) {
+	prefixes, err := ParseImageURLPrefixes(imageURLPrefixes)
+	if err != nil {
+		return nil, err
+	}
+	m := newManager(&libvirtConnection{conn: conn, network: network}, network, nil, prefixes)
+	m.httpClient = &http.Client{CheckRedirect: m.checkRedirect}
+	return m, nil
+}
+
+// libvirtConnection implements the connection interface using a libvirt connection.
+type libvirtConnection struct {
+	conn    *libvirt.Connect
+	network string
+}
+
+func (c *libvirtConnection) listDomains() ([]domain, error) {
+	libvirtDomains, err := c.conn.ListAllDomains(libvirt.CONNECT_LIST_DOMAINS_PERSISTENT)
+	if err != nil {
+		return nil, err
+	}
+	defer func() {
+		for _, d := range libvirtDomains {
+			_ = d.Free()
+		}
+	}()
+
+	domains := make([]domain, 0, len(libvirtDomains))
+	for _, d := range libvirtDomains {
+		domainXML, err := d.GetXMLDesc(libvirt.DOMAIN_XML_INACTIVE)
+		if err != nil {
+			return nil, err
+		}
+		state, _, err := d.GetState()
+		if err != nil {
+			return nil, err
+		}
+		domains = append(domains, domain{xml: domainXML, state: instanceState(state)})
+	}
+	return domains, nil
+}
+
+func (c *libvirtConnection) defineDomain(domainXML string) (string, error) {
+	d, err := c.conn.DomainDefineXMLFlags(domainXML, libvirt.DOMAIN_DEFINE_VALIDATE)
+	if err != nil {
+		return "", err
+	}
+	defer d.Free()
+	return d.GetXMLDesc(libvirt.DOMAIN_XML_INACTIVE)
+}
+
+func (c *libvirtConnection) setDomainMetadata(name, element, namespace string) error {
+	d, err := c.conn.LookupDomainByName(name)
+	if err != nil {
+		return err
+	}
+	defer d.Free()
+	return d.SetMetadata(libvirt.DOMAIN_METADATA_ELEMENT, element, "constellation", namespace, libvirt.DOMAIN_AFFECT_CONFIG)
+}
+
+func (c *libvirtConnection) startDomain(name string) error {
+	d, err := c.conn.LookupDomainByName(name)
+	if err != nil {
+		return err
+	}
+	defer d.Free()
+	return d.Create()
+}
+
+func (c *libvirtConnection) deleteDomain(name string) error {
+	d, err := c.conn.LookupDomainByName(name)
+	if hasCode(err, libvirt.ERR_NO_DOMAIN) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	defer d.Free()
+
+	active, err := d.IsActive()
+	if err != nil {
+		return err
+	}
+	if active {
+		if err := d.Destroy(); err != nil {
+			return err
+		}
+	}
+	return d.UndefineFlags(libvirt.DOMAIN_UNDEFINE_NVRAM)
+}
+
+func (c *libvirtConnection) networkXML() (string, error) {
+	n, err := c.conn.LookupNetworkByName(c.network)
+	if err != nil {
+		return "", err
+	}
+	defer n.Free()
+	return n.GetXMLDesc(0)
+}
+
+func (c *libvirtConnection) addDHCPHost(hostXML string) error {
+	return c.updateDHCPHosts(libvirt.NETWORK_UPDATE_COMMAND_ADD_LAST, hostXML)
+}
+
+func (c *libvirtConnection) removeDHCPHost(hostXML string) error {
+	return c.updateDHCPHosts(libvirt.NETWORK_UPDATE_COMMAND_DELETE, hostXML)
+}
+
+func (c *libvirtConnection) updateDHCPHosts(cmd libvirt.NetworkUpdateCommand, hostXML string) error {
+	n, err := c.conn.LookupNetworkByName(c.network)
+	if err != nil {
+		return err
+	}
+	defer n.Free()
+	return n.Update(cmd, libvirt.NETWORK_SECTION_IP_DHCP_HOST, -1, hostXML,
+		libvirt.NETWORK_UPDATE_AFFECT_LIVE|libvirt.NETWORK_UPDATE_AFFECT_CONFIG)
+}
+
+func (c *libvirtConnection) volumeXML(path string) (string, error) {
+	v, err := c.lookupVolume(path)
+	if err != nil {
+		return "", err
+	}
+	defer v.Free()
+	return v.GetXMLDesc(0)
+}
+
+func (c *libvirtConnection) volumeXMLByName(poolOf, name string) (string, error) {
+	p, err := c.lookupPoolOf(poolOf)
+	if err != nil {
+		return "", err
+	}
+	defer p.Free()
+	v, err := p.LookupStorageVolByName(name)
+	if hasCode(err, libvirt.ERR_NO_STORAGE_VOL) {
+		return "", fmt.Errorf("volume %q: %w", name, ErrNotFound)
+	}
+	if err != nil {
+		return "", err
+	}
+	defer v.Free()
+	return v.GetXMLDesc(0)
+}
+
+func (c *libvirtConnection) createVolume(poolOf, volumeXML string) (string, error) {
+	p, err := c.lookupPoolOf(poolOf)
+	if err != nil {
+		return "", err
+	}
+	defer p.Free()
+	v, err := p.StorageVolCreateXML(volumeXML, 0)
+	if err != nil {
+		return "", err
+	}
+	defer v.Free()
+	return v.GetPath()
+}
+
+func (c *libvirtConnection) uploadVolume(path string, content io.Reader, length uint64) (retErr error) {
+	v, err := c.lookupVolume(path)
+	if err != nil {
+		return err
+	}
+	defer v.Free()
+	stream, err := c.conn.NewStream(0)
+	if err != nil {
+		return err
+	}
+	defer stream.Free()
+	if err := v.Upload(stream, 0, length, 0); err != nil {
+		return err
+	}
+	defer func() {
+		if retErr != nil {
+			_ = stream.Abort()
+		}
+	}()
+
+	buf := make([]byte, 4<<20)
+	for {
+		n, readErr := content.Read(buf)
+		for sent := 0; sent < n; {
+			written, err := stream.Send(buf[sent:n])
+			if err != nil {
+				return err
+			}
+			sent += written
+		}
+		if errors.Is(readErr, io.EOF) {
+			break
+		}
+		if readErr != nil {
+			return readErr
+		}
+	}
+	return stream.Finish()
+}
+
+func (c *libvirtConnection) deleteVolume(path string) error {
+	v, err := c.lookupVolume(path)
+	if err != nil {
+		return err
+	}
+	defer v.Free()
+	return v.Delete(0)
+}
+
+// lookupVolume looks up a storage volume by path. A missing volume results in ErrNotFound.
+func (c *libvirtConnection) lookupVolume(path string) (*libvirt.StorageVol, error) {
+	v, err := c.conn.LookupStorageVolByPath(path)
+	if hasCode(err, libvirt.ERR_NO_STORAGE_VOL) {
+		return nil, fmt.Errorf("volume %q: %w", path, ErrNotFound)
+	}
+	return v, err
+}
+
+// lookupPoolOf looks up the storage pool of the volume with the given path.
+func (c *libvirtConnection) lookupPoolOf(path string) (*libvirt.StoragePool, error) {
+	v, err := c.lookupVolume(path)
+	if err != nil {
+		return nil, err
+	}
+	defer v.Free()
+	return v.LookupPoolByVolume()
+}
+
+func instanceState(state libvirt.DomainState) InstanceState {
+	switch state {
+	case libvirt.DOMAIN_RUNNING, libvirt.DOMAIN_BLOCKED:
+		return StateRunning
+	case libvirt.DOMAIN_PAUSED, libvirt.DOMAIN_SHUTDOWN, libvirt.DOMAIN_SHUTOFF, libvirt.DOMAIN_PMSUSPENDED:
+		return StateStopped
+	case libvirt.DOMAIN_CRASHED:
+		return StateCrashed
+	default:
+		return StateUnknown
+	}
+}
+
+func hasCode(err error, code libvirt.ErrorNumber) bool {
+	var libvirtErr libvirt.Error
+	return errors.As(err, &libvirtErr) && libvirtErr.Code == code
+}
@@ -0,0 +1,542 @@
+/*
+Copyright (c) Edgeless Systems GmbH
+
+SPDX-License-Identifier: BUSL-1.1
+*/
+
+/*
+Package scalinggroup manages the libvirt domains of a Constellation as scaling groups.
+
+A scaling group consists of all domains whose names only differ in the trailing index,
+e.g. the domains "constell-worker-1a2b3c4d-0" and "constell-worker-1a2b3c4d-1" form the scaling group "constell-worker-1a2b3c4d".
+Instances are identified by the hostname of their static DHCP host entry in the cluster network,
+which is also the name the instance uses to join the cluster.
+
+New instances are created by cloning the newest domain of a scaling group:
+the boot disk is a new overlay of the scaling group image, all other disks are blank disks of the same size.
+The image of a scaling group is stored in the metadata of all of its domains.
+*/
+package scalinggroup
+
+import (
+	"cmp"
+	"context"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/url"
+	"path/filepath"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/edgelesssys/constellation/v2/internal/role"
+)
+
+var (
+	// ErrNotFound is returned if a scaling group or instance does not exist.
+	ErrNotFound = errors.New("not found")
+	// ErrImageNotAllowed is returned if an image is neither a volume path nor a URL with an allowed prefix.
+	ErrImageNotAllowed = errors.New("image not allowed")
+)
+
+// ScalingGroup is a group of libvirt domains sharing the same configuration.
+type ScalingGroup struct {
+	// ID is the common name prefix of the domains of the scaling group.
+	ID string `json:"id"`
+	// Role is the role of the instances of the scaling group.
+	Role role.Role `json:"role"`
+}
+
+// Instance is a libvirt domain of a scaling group.
+type Instance struct {
+	// Name is the hostname of the instance.
+	Name string `json:"name"`
+	// ScalingGroupID is the ID of the scaling group the instance belongs to.
+	ScalingGroupID string `json:"scalingGroupID"`
+	// Image is the image the instance was created from.
+	Image string `json:"image"`
+	// State is the state of the libvirt domain.
+	State InstanceState `json:"state"`
+}
+
+// InstanceState is the state of a libvirt domain.
+type InstanceState string
+
+const (
+	// StateRunning is the state of a running domain.
+	StateRunning InstanceState = "running"
+	// StateStopped is the state of a domain that is shut off, paused or suspended.
+	StateStopped InstanceState = "stopped"
+	// StateCrashed is the state of a crashed domain.
+	StateCrashed InstanceState = "crashed"
+	// StateUnknown is the state of a domain in any other state.
+	StateUnknown InstanceState = "unknown"
+)
+
+// Manager manages the libvirt domains attached to a network as scaling groups.
+type Manager struct {
+	conn       connection
+	network    string
+	httpClient httpClient
+	// imageURLPrefixes are the prefixes of URLs images may be downloaded from.
+	imageURLPrefixes []*url.URL
+	// mux serializes all operations modifying domains, volumes or the network.
+	mux sync.Mutex
+}
+
+func newManager(conn connection, network string, httpClient httpClient, imageURLPrefixes []*url.URL) *Manager {
+	return &Manager{
+		conn:             conn,
+		network:          network,
+		httpClient:       httpClient,
+		imageURLPrefixes: imageURLPrefixes,
+	}
+}
+
+// ListScalingGroups lists all scaling groups of domains attached to the network.
+func (m *Manager) ListScalingGroups() ([]ScalingGroup, error) {
+	groups, _, err := m.scalingGroups()
+	if err != nil {
+		return nil, err
+	}
+	result := []ScalingGroup{}
+	for id, members := range groups {
+		result = append(result, ScalingGroup{ID: id, Role: members[0].role()})
+	}
+	return result, nil
+}
+
+// GetImage returns the image used for new instances of the scaling group.
+func (m *Manager) GetImage(scalingGroupID string) (string, error) {
+	groups, _, err := m.scalingGroups()
+	if err != nil {
+		return "", err
+	}
+	members, ok := groups[scalingGroupID]
+	if !ok {
+		return "", fmt.Errorf("scaling group %q: %w", scalingGroupID, ErrNotFound)
+	}
+	return m.groupImage(newest(members))
+}
+
+// SetImage sets the image used for new instances of the scaling group.
+// The image must be the path of a storage volume, or a URL with one of the allowed prefixes.
+func (m *Manager) SetImage(scalingGroupID, image string) error {
+	if err := m.checkImage(image); err != nil {
+		return err
+	}
+
+	m.mux.Lock()
+	defer m.mux.Unlock()
+
+	groups, _, err := m.scalingGroups()
+	if err != nil {
+		return err
+	}
+	members, ok := groups[scalingGroupID]
+	if !ok {
+		return fmt.Errorf("scaling group %q: %w", scalingGroupID, ErrNotFound)
+	}
+	for _, member := range members {
+		nodeImage, err := m.nodeImage(member)
+		if err != nil {
+			return err
+		}
+		if err := m.conn.setDomainMetadata(member.xml.Name, scalingGroupMetadata(image, nodeImage), metadataNamespace); err != nil {
+			return fmt.Errorf("setting metadata of domain %q: %w", member.xml.Name, err)
+		}
+	}
+	return nil
+}
+
+// GetInstance returns the instance with the given hostname.
+func (m *Manager) GetInstance(name string) (Instance, error) {
+	groups, _, err := m.scalingGroups()
+	if err != nil {
+		return Instance{}, err
+	}
+	for id, members := range groups {
+		for _, member := range members {
+			if member.host.Name != name {
+				continue
+			}
+			image, err := m.nodeImage(member)
+			if err != nil {
+				return Instance{}, err
+			}
+			return Instance{Name: name, ScalingGroupID: id, Image: image, State: member.state}, nil
+		}
+	}
+	return Instance{}, fmt.Errorf("instance %q: %w", name, ErrNotFound)
+}
+
+// CreateInstance creates a new instance in the scaling group, using the newest domain of the scaling group as a template.
+// If the image of the scaling group is a URL, the image is downloaded into the storage pool of the template's boot disk first.
+func (m *Manager) CreateInstance(ctx context.Context, scalingGroupID string) (instance Instance, retErr error) {
+	m.mux.Lock()
+	defer m.mux.Unlock()
+
+	groups, hosts, err := m.scalingGroups()
+	if err != nil {
+		return Instance{}, err
+	}
+	members, ok := groups[scalingGroupID]
+	if !ok {
+		return Instance{}, fmt.Errorf("scaling group %q: %w", scalingGroupID, ErrNotFound)
+	}
+	template := newest(members)
+	templateDisks := template.xml.diskPaths()
+	if len(templateDisks) == 0 {
+		return Instance{}, fmt.Errorf("template domain %q has no file backed disks", template.xml.Name)
+	}
+
+	image, err := m.groupImage(template)
+	if err != nil {
+		return Instance{}, err
+	}
+	imageVolume, err := m.imageVolume(ctx, image, templateDisks[0])
+	if err != nil {
+		return Instance{}, err
+	}
+
+	name := fmt.Sprintf("%s-%d", scalingGroupID, template.index+1)
+	var cleanups []func() error
+	defer func() {
+		if retErr == nil {
+			return
+		}
+		errs := []error{retErr}
+		for i := len(cleanups) - 1; i >= 0; i-- {
+			errs = append(errs, cleanups[i]())
+		}
+		retErr = errors.Join(errs...)
+	}()
+
+	disks := make(map[string]string, len(templateDisks))
+	for i, templateDisk := range templateDisks {
+		volume, err := m.cloneVolume(name, i, templateDisk, imageVolume)
+		if err != nil {
+			return Instance{}, err
+		}
+		disks[templateDisk] = volume
+		cleanups = append(cleanups, func() error { return m.conn.deleteVolume(volume) })
+	}
+	var nvram string
+	if template.xml.OS.NVRAM != "" {
+		nvram = filepath.Join(filepath.Dir(template.xml.OS.NVRAM), name+"_VARS.fd")
+	}
+
+	cloneXML, err := cloneDomainXML(template.rawXML, name, disks, nvram)
+	if err != nil {
+		return Instance{}, err
+	}
+	definedXML, err := m.conn.defineDomain(cloneXML)
+	if err != nil {
+		return Instance{}, fmt.Errorf("defining domain %q: %w", name, err)
+	}
+	cleanups = append(cleanups, func() error { return m.conn.deleteDomain(name) })
+	if err := m.conn.setDomainMetadata(name, scalingGroupMetadata(image, image), metadataNamespace); err != nil {
+		return Instance{}, fmt.Errorf("setting metadata of domain %q: %w", name, err)
+	}
+
+	host, err := m.newHost(definedXML, template.host, hosts)
+	if err != nil {
+		return Instance{}, err
+	}
+	hostXML, err := xml.Marshal(host)
+	if err != nil {
+		return Instance{}, fmt.Errorf("marshalling DHCP host: %w", err)
+	}
+	if err := m.conn.addDHCPHost(string(hostXML)); err != nil {
+		return Instance{}, fmt.Errorf("adding DHCP host %q: %w", host.Name, err)
+	}
+	cleanups = append(cleanups, func() error { return m.conn.removeDHCPHost(string(hostXML)) })
+
+	if err := m.conn.startDomain(name); err != nil {
+		return Instance{}, fmt.Errorf("starting domain %q: %w", name, err)
+	}
+	return Instance{Name: host.Name, ScalingGroupID: scalingGroupID, Image: image, State: StateRunning}, nil
+}
+
+// DeleteInstance deletes the instance with the given hostname, including its disks and DHCP host entry.
+// Deleting an instance that does not exist is not an error.
+func (m *Manager) DeleteInstance(name string) error {
+	m.mux.Lock()
+	defer m.mux.Unlock()
+
+	groups, hosts, err := m.scalingGroups()
+	if err != nil {
+		return err
+	}
+	for _, members := range groups {
+		for _, member := range members {
+			if member.host.Name != name {
+				continue
+			}
+			if err := m.conn.deleteDomain(member.xml.Name); err != nil {
+				return fmt.Errorf("deleting domain %q: %w", member.xml.Name, err)
+			}
+			var errs []error
+			for _, disk := range member.xml.diskPaths() {
+				if err := m.conn.deleteVolume(disk); err != nil && !errors.Is(err, ErrNotFound) {
+					errs = append(errs, fmt.Errorf("deleting volume %q: %w", disk, err))
+				}
+			}
+			if err := errors.Join(errs...); err != nil {
+				return err
+			}
+		}
+	}
+	for _, host := range hosts {
+		if host.Name != name {
+			continue
+		}
+		hostXML, err := xml.Marshal(host)
+		if err != nil {
+			return fmt.Errorf("marshalling DHCP host: %w", err)
+		}
+		if err := m.conn.removeDHCPHost(string(hostXML)); err != nil {
+			return fmt.Errorf("removing DHCP host %q: %w", name, err)
+		}
+	}
+	return nil
+}
+
+// member is a domain of a scaling group.
+type member struct {
+	rawXML string
+	xml    domainXML
+	state  InstanceState
+	host   dhcpHost
+	index  int
+}
+
+func (m member) role() role.Role {
+	if strings.HasPrefix(m.host.Name, "control-plane") {
+		return role.ControlPlane
+	}
+	return role.Worker
+}
+
+// scalingGroups returns the domains attached to the network grouped by scaling group ID, ordered by index,
+// and all static DHCP host entries of the network.
+// Domains without a static DHCP host entry are ignored, since they cannot be identified by hostname.
+func (m *Manager) scalingGroups() (map[string][]member, []dhcpHost, error) {
+	rawNetwork, err := m.conn.networkXML()
+	if err != nil {
+		return nil, nil, fmt.Errorf("getting network: %w", err)
+	}
+	var network networkXML
+	if err := xml.Unmarshal([]byte(rawNetwork), &network); err != nil {
+		return nil, nil, fmt.Errorf("parsing network XML: %w", err)
+	}
+	hosts := network.dhcpHosts()
+	hostsByMAC := make(map[string]dhcpHost, len(hosts))
+	for _, host := range hosts {
+		hostsByMAC[strings.ToLower(host.MAC)] = host
+	}
+
+	domains, err := m.conn.listDomains()
+	if err != nil {
+		return nil, nil, fmt.Errorf("listing domains: %w", err)
+	}
+	groups := map[string][]member{}
+	for _, domain := range domains {
+		var parsed domainXML
+		if err := xml.Unmarshal([]byte(domain.xml), &parsed); err != nil {
+			return nil, nil, fmt.Errorf("parsing domain XML: %w", err)
+		}
+		mac, ok := parsed.macOnNetwork(m.network)
+		if !ok {
+			continue
+		}
+		host, ok := hostsByMAC[mac]
+		if !ok {
+			continue
+		}
+		id, index, ok := splitIndex(parsed.Name)
+		if !ok {
+			continue
+		}
+		groups[id] = append(groups[id], member{rawXML: domain.xml, xml: parsed, state: domain.state, host: host, index: index})
+	}
+	for _, members := range groups {
+		slices.SortFunc(members, func(a, b member) int { return cmp.Compare(a.index, b.index) })
+	}
+	return groups, hosts, nil
+}
+
+// groupImage returns the image of the scaling group the member belongs to.
+// If the image was never set, the image the member was created from is used.
+func (m *Manager) groupImage(member member) (string, error) {
+	if image := member.xml.Metadata.ScalingGroup.Image; image != "" {
+		return image, nil
+	}
+	return m.nodeImage(member)
+}
+
+// nodeImage returns the image the member was created from.
+// For domains not created by the manager, this is the backing volume of the boot disk.
+func (m *Manager) nodeImage(member member) (string, error) {
+	if image := member.xml.Metadata.ScalingGroup.NodeImage; image != "" {
+		return image, nil
+	}
+	disks := member.xml.diskPaths()
+	if len(disks) == 0 {
+		return "", fmt.Errorf("domain %q has no file backed disks", member.xml.Name)
+	}
+	volume, err := m.volume(disks[0])
+	if err != nil {
+		return "", err
+	}
+	if volume.BackingStore == nil || volume.BackingStore.Path == "" {
+		return "", fmt.Errorf("boot disk %q of domain %q has no backing image", disks[0], member.xml.Name)
+	}
+	return volume.BackingStore.Path, nil
+}
+
+// cloneVolume creates the i-th disk of a new domain based on the disk of the template domain.
+// The boot disk is created as an overlay of the image, all other disks are created blank.
+func (m *Manager) cloneVolume(domainName string, i int, templateDisk string, image volumeXML) (string, error) {
+	template, err := m.volume(templateDisk)
+	if err != nil {
+		return "", err
+	}
+	var volume volumeXML
+	volume.Capacity.Unit = "bytes"
+	volume.Capacity.Value = template.Capacity.Value
+	volume.Target.Format.Type = template.Target.Format.Type
+	switch i {
+	case 0:
+		volume.Name = domainName + "-boot"
+		volume.Capacity.Value = max(template.Capacity.Value, image.Capacity.Value)
+		volume.Target.Format.Type = "qcow2"
+		volume.BackingStore = &volumeTarget{Path: image.Target.Path}
+		volume.BackingStore.Format.Type = image.Target.Format.Type
+	case 1:
+		volume.Name = domainName + "-state"
+	default:
+		volume.Name = fmt.Sprintf("%s-state-%d", domainName, i)
+	}
+
+	rawVolume, err := xml.Marshal(volume)
+	if err != nil {
+		return "", fmt.Errorf("marshalling volume XML: %w", err)
+	}
+	path, err := m.conn.createVolume(templateDisk, string(rawVolume))
+	if err != nil {
+		return "", fmt.Errorf("creating volume %q: %w", volume.Name, err)
+	}
+	return path, nil
+}
+
+// newHost returns a static DHCP host entry for a newly defined domain.
+// The hostname uses the same prefix as the template's hostname with the next free index,
+// the IP is the next free IP after the template's IP in the same /24 subnet.
+func (m *Manager) newHost(definedXML string, template dhcpHost, hosts []dhcpHost) (dhcpHost, error) {
+	var defined domainXML
+	if err := xml.Unmarshal([]byte(definedXML), &defined); err != nil {
+		return dhcpHost{}, fmt.Errorf("parsing domain XML: %w", err)
+	}
+	mac, ok := defined.macOnNetwork(m.network)
+	if !ok {
+		return dhcpHost{}, fmt.Errorf("domain %q has no interface on network %q", defined.Name, m.network)
+	}
+
+	prefix, _, ok := splitIndex(template.Name)
+	if !ok {
+		return dhcpHost{}, fmt.Errorf("hostname %q has no index", template.Name)
+	}
+	nextIndex := 0
+	usedIPs := map[string]struct{}{}
+	for _, host := range hosts {
+		usedIPs[host.IP] = struct{}{}
+		if hostPrefix, index, ok := splitIndex(host.Name); ok && hostPrefix == prefix && index >= nextIndex {
+			nextIndex = index + 1
+		}
+	}
+
+	ip := net.ParseIP(template.IP).To4()
+	if ip == nil {
+		return dhcpHost{}, fmt.Errorf("invalid IPv4 address %q of host %q", template.IP, template.Name)
+	}
+	for last := int(ip[3]) + 1; last < 255; last++ {
+		candidate := net.IPv4(ip[0], ip[1], ip[2], byte(last)).String()
+		if _, used := usedIPs[candidate]; !used {
+			return dhcpHost{MAC: mac, Name: fmt.Sprintf("%s-%d", prefix, nextIndex), IP: candidate}, nil
+		}
+	}
+	return dhcpHost{}, fmt.Errorf("no free IP address left after %s", template.IP)
+}
+
+func (m *Manager) volume(path string) (volumeXML, error) {
+	rawVolume, err := m.conn.volumeXML(path)
+	if err != nil {
+		return volumeXML{}, fmt.Errorf("getting volume %q: %w", path, err)
+	}
+	var volume volumeXML
+	if err := xml.Unmarshal([]byte(rawVolume), &volume); err != nil {
+		return volumeXML{}, fmt.Errorf("parsing volume XML: %w", err)
+	}
+	return volume, nil
+}
+
+// newest returns the member with the highest index.
+func newest(members []member) member {
+	return members[len(members)-1]
+}
+
+// splitIndex splits a name of the form "<prefix>-<index>".
+func splitIndex(name string) (string, int, bool) {
+	idx := strings.LastIndex(name, "-")
+	if idx <= 0 {
+		return "", 0, false
+	}
+	index, err := strconv.Atoi(name[idx+1:])
+	if err != nil || index < 0 {
+		return "", 0, false
+	}
+	return name[:idx], index, true
+}
+
+// connection is the subset of libvirt operations used to manage scaling groups.
+type connection interface {
+	// listDomains returns the inactive XML and state of all persistent domains.
+	listDomains() ([]domain, error)
+	// defineDomain defines a new persistent domain and returns its inactive XML.
+	defineDomain(xml string) (string, error)
+	// setDomainMetadata sets a metadata element of the persistent domain configuration.
+	setDomainMetadata(name, element, namespace string) error
+	// startDomain starts a defined domain.
+	startDomain(name string) error
+	// deleteDomain stops a domain and removes its definition and NVRAM.
+	deleteDomain(name string) error
+	// networkXML returns the XML of the network.
+	networkXML() (string, error)
+	// addDHCPHost adds a static DHCP host entry to the network.
+	addDHCPHost(xml string) error
+	// removeDHCPHost removes a static DHCP host entry from the network.
+	removeDHCPHost(xml string) error
+	// volumeXML returns the XML of the storage volume with the given path.
+	volumeXML(path string) (string, error)
+	// volumeXMLByName returns the XML of the storage volume with the given name,
+	// in the same storage pool as the volume with the given path.
+	volumeXMLByName(poolOf, name string) (string, error)
+	// createVolume creates a storage volume in the same storage pool as the volume with the given path
+	// and returns the path of the new volume.
+	createVolume(poolOf, xml string) (string, error)
+	// uploadVolume uploads content to the storage volume with the given path.
+	uploadVolume(path string, content io.Reader, length uint64) error
+	// deleteVolume deletes the storage volume with the given path.
+	deleteVolume(path string) error
+}
+
+// domain is a persistent libvirt domain.
+type domain struct {
+	xml   string
+	state InstanceState
+}
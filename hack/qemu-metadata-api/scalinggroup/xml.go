@@ -0,0 +1,224 @@
+/*
+Copyright (c) Edgeless Systems GmbH
+
+SPDX-License-Identifier: BUSL-1.1
+*/
+
+package scalinggroup
+
+import (
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"io"
+	"sort"
+	"strings"
+)
+
+// metadataNamespace is the XML namespace of the Constellation metadata stored in libvirt domains.
+const metadataNamespace = "https://constellation.edgeless.systems/xmlns/libvirt/scalinggroup"
+
+// domainXML is the subset of the libvirt domain XML used to manage scaling groups.
+type domainXML struct {
+	Name     string `xml:"name"`
+	Metadata struct {
+		ScalingGroup struct {
+			// Image is the image of the scaling group, used for new domains.
+			Image string `xml:"image,attr"`
+			// NodeImage is the image the domain was created from.
+			NodeImage string `xml:"nodeImage,attr"`
+		} `xml:"https://constellation.edgeless.systems/xmlns/libvirt/scalinggroup scalinggroup"`
+	} `xml:"metadata"`
+	OS struct {
+		NVRAM string `xml:"nvram"`
+	} `xml:"os"`
+	Devices struct {
+		Disks []struct {
+			Device string `xml:"device,attr"`
+			Source struct {
+				File string `xml:"file,attr"`
+			} `xml:"source"`
+		} `xml:"disk"`
+		Interfaces []struct {
+			MAC struct {
+				Address string `xml:"address,attr"`
+			} `xml:"mac"`
+			Source struct {
+				Network string `xml:"network,attr"`
+			} `xml:"source"`
+		} `xml:"interface"`
+	} `xml:"devices"`
+}
+
+// diskPaths returns the file paths of the disks of the domain, in the order of the domain XML.
+func (d *domainXML) diskPaths() []string {
+	var paths []string
+	for _, disk := range d.Devices.Disks {
+		if disk.Device == "disk" && disk.Source.File != "" {
+			paths = append(paths, disk.Source.File)
+		}
+	}
+	return paths
+}
+
+// macOnNetwork returns the MAC address of the interface of the domain attached to the given network.
+func (d *domainXML) macOnNetwork(network string) (string, bool) {
+	for _, iface := range d.Devices.Interfaces {
+		if iface.Source.Network == network && iface.MAC.Address != "" {
+			return strings.ToLower(iface.MAC.Address), true
+		}
+	}
+	return "", false
+}
+
+// networkXML is the subset of the libvirt network XML used to manage scaling groups.
+type networkXML struct {
+	IPs []struct {
+		DHCP struct {
+			Hosts []dhcpHost `xml:"host"`
+		} `xml:"dhcp"`
+	} `xml:"ip"`
+}
+
+// dhcpHosts returns all static DHCP host entries of the network.
+func (n *networkXML) dhcpHosts() []dhcpHost {
+	var hosts []dhcpHost
+	for _, ip := range n.IPs {
+		hosts = append(hosts, ip.DHCP.Hosts...)
+	}
+	return hosts
+}
+
+// dhcpHost is a static DHCP host entry of a libvirt network.
+type dhcpHost struct {
+	XMLName xml.Name `xml:"host"`
+	MAC     string   `xml:"mac,attr"`
+	Name    string   `xml:"name,attr"`
+	IP      string   `xml:"ip,attr"`
+}
+
+// volumeXML is the subset of the libvirt storage volume XML used to manage scaling groups.
+type volumeXML struct {
+	XMLName  xml.Name `xml:"volume"`
+	Name     string   `xml:"name"`
+	Capacity struct {
+		Unit  string `xml:"unit,attr,omitempty"`
+		Value uint64 `xml:",chardata"`
+	} `xml:"capacity"`
+	Target       volumeTarget  `xml:"target"`
+	BackingStore *volumeTarget `xml:"backingStore"`
+}
+
+type volumeTarget struct {
+	Path   string `xml:"path,omitempty"`
+	Format struct {
+		Type string `xml:"type,attr"`
+	} `xml:"format"`
+}
+
+// cloneDomainXML returns the XML of a new domain based on the XML of a template domain.
+// The name, disk paths and NVRAM path are replaced. The UUID and MAC addresses are removed,
+// so libvirt generates new ones when defining the domain.
+// All other parts of the template XML are copied verbatim.
+func cloneDomainXML(template, name string, disks map[string]string, nvram string) (string, error) {
+	type edit struct {
+		start, end  int64
+		replacement string
+	}
+	var edits []edit
+
+	decoder := xml.NewDecoder(strings.NewReader(template))
+	var path []string
+	var starts []int64
+	var diskDevice []string
+	for {
+		offset := decoder.InputOffset()
+		token, err := decoder.Token()
+		if errors.Is(err, io.EOF) {
+			break
+		}
+		if err != nil {
+			return "", fmt.Errorf("parsing domain XML: %w", err)
+		}
+
+		switch token := token.(type) {
+		case xml.StartElement:
+			path = append(path, token.Name.Local)
+			starts = append(starts, offset)
+			switch strings.Join(path, "/") {
+			case "domain/devices/disk":
+				diskDevice = append(diskDevice, attr(token, "device"))
+			case "domain/devices/disk/source":
+				if diskDevice[len(diskDevice)-1] != "disk" {
+					continue
+				}
+				file := attr(token, "file")
+				newFile, ok := disks[file]
+				if !ok {
+					return "", fmt.Errorf("no replacement for disk %q", file)
+				}
+				// the source element is replaced as a whole, dropping any runtime information
+				if err := decoder.Skip(); err != nil {
+					return "", fmt.Errorf("parsing domain XML: %w", err)
+				}
+				edits = append(edits, edit{start: offset, end: decoder.InputOffset(), replacement: `<source file="` + escape(newFile) + `"/>`})
+				path, starts = path[:len(path)-1], starts[:len(starts)-1]
+			}
+		case xml.EndElement:
+			end := decoder.InputOffset()
+			start := starts[len(starts)-1]
+			switch strings.Join(path, "/") {
+			case "domain/name":
+				edits = append(edits, edit{start: start, end: end, replacement: "<name>" + escape(name) + "</name>"})
+			case "domain/uuid", "domain/devices/interface/mac":
+				edits = append(edits, edit{start: start, end: end})
+			case "domain/os/nvram":
+				if nvram == "" {
+					return "", errors.New("no replacement for NVRAM")
+				}
+				edits = append(edits, edit{start: start, end: end, replacement: nvramElement(template[start:end], nvram)})
+			case "domain/devices/disk":
+				diskDevice = diskDevice[:len(diskDevice)-1]
+			}
+			path, starts = path[:len(path)-1], starts[:len(starts)-1]
+		}
+	}
+
+	sort.Slice(edits, func(i, j int) bool { return edits[i].start < edits[j].start })
+	var out strings.Builder
+	var last int64
+	for _, e := range edits {
+		out.WriteString(template[last:e.start])
+		out.WriteString(e.replacement)
+		last = e.end
+	}
+	out.WriteString(template[last:])
+	return out.String(), nil
+}
+
+// nvramElement replaces the content of an NVRAM element, keeping its attributes.
+func nvramElement(element, nvram string) string {
+	startTag, _, _ := strings.Cut(element, ">")
+	startTag = strings.TrimSuffix(startTag, "/")
+	return startTag + ">" + escape(nvram) + "</nvram>"
+}
+
+// scalingGroupMetadata returns the XML element storing the images in the domain metadata.
+func scalingGroupMetadata(image, nodeImage string) string {
+	return `<scalinggroup image="` + escape(image) + `" nodeImage="` + escape(nodeImage) + `"/>`
+}
+
+func attr(element xml.StartElement, name string) string {
+	for _, a := range element.Attr {
+		if a.Name.Local == name {
+			return a.Value
+		}
+	}
+	return ""
+}
+
+func escape(s string) string {
+	var b strings.Builder
+	_ = xml.EscapeText(&b, []byte(s))
+	return b.String()
+}
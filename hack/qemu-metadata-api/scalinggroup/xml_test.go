@@ -0,0 +1,128 @@
+/*
+Copyright (c) Edgeless Systems GmbH
+
+SPDX-License-Identifier: BUSL-1.1
+*/
+
+package scalinggroup
+
+import (
+	"encoding/xml"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+const templateDomainXML = `<domain type='kvm' xmlns:qemu='http://libvirt.org/schemas/domain/qemu/1.0'>
+  <name>constell-worker-1a2b3c4d-0</name>
+  <uuid>0b4e4c1c-8ef4-4bb3-9b3f-6b8b2c1c3e4d</uuid>
+  <metadata>
+    <constellation:scalinggroup xmlns:constellation="https://constellation.edgeless.systems/xmlns/libvirt/scalinggroup" image="/var/lib/libvirt/images/image" nodeImage="/var/lib/libvirt/images/image"/>
+  </metadata>
+  <memory unit='KiB'>2097152</memory>
+  <os>
+    <type arch='x86_64' machine='pc-q35-6.2'>hvm</type>
+    <loader readonly='yes' secure='no' type='pflash'>/usr/share/OVMF/OVMF_CODE.fd</loader>
+    <nvram template='/usr/share/OVMF/OVMF_VARS.fd'>/var/lib/libvirt/qemu/nvram/worker-0_VARS.fd</nvram>
+  </os>
+  <devices>
+    <disk type='file' device='disk'>
+      <driver name='qemu' type='qcow2'/>
+      <source file='/var/lib/libvirt/images/constellation-worker-1a2b3c4d-0-boot'/>
+      <target dev='vda' bus='virtio'/>
+    </disk>
+    <disk type='file' device='disk'>
+      <driver name='qemu' type='qcow2'/>
+      <source file='/var/lib/libvirt/images/constellation-worker-1a2b3c4d-0-state'/>
+      <target dev='vdb' bus='virtio'/>
+    </disk>
+    <disk type='file' device='cdrom'>
+      <source file='/var/lib/libvirt/images/cloudinit.iso'/>
+      <target dev='sda' bus='sata'/>
+    </disk>
+    <interface type='network'>
+      <mac address='52:54:00:aa:bb:01'/>
+      <source network='constell-network'/>
+      <model type='virtio'/>
+    </interface>
+    <tpm model='tpm-crb'>
+      <backend type='emulator' version='2.0'/>
+    </tpm>
+  </devices>
+  <qemu:commandline>
+    <qemu:arg value='-object'/>
+  </qemu:commandline>
+</domain>
+`
+
+func TestCloneDomainXML(t *testing.T) {
+	testCases := map[string]struct {
+		template string
+		disks    map[string]string
+		nvram    string
+		wantErr  bool
+	}{
+		"clone works": {
+			template: templateDomainXML,
+			disks: map[string]string{
+				"/var/lib/libvirt/images/constellation-worker-1a2b3c4d-0-boot":  "/var/lib/libvirt/images/constell-worker-1a2b3c4d-1-boot",
+				"/var/lib/libvirt/images/constellation-worker-1a2b3c4d-0-state": "/var/lib/libvirt/images/constell-worker-1a2b3c4d-1-state",
+			},
+			nvram: "/var/lib/libvirt/qemu/nvram/constell-worker-1a2b3c4d-1_VARS.fd",
+		},
+		"missing disk replacement": {
+			template: templateDomainXML,
+			disks: map[string]string{
+				"/var/lib/libvirt/images/constellation-worker-1a2b3c4d-0-boot": "/var/lib/libvirt/images/constell-worker-1a2b3c4d-1-boot",
+			},
+			nvram:   "/var/lib/libvirt/qemu/nvram/constell-worker-1a2b3c4d-1_VARS.fd",
+			wantErr: true,
+		},
+		"missing NVRAM replacement": {
+			template: templateDomainXML,
+			disks: map[string]string{
+				"/var/lib/libvirt/images/constellation-worker-1a2b3c4d-0-boot":  "/var/lib/libvirt/images/constell-worker-1a2b3c4d-1-boot",
+				"/var/lib/libvirt/images/constellation-worker-1a2b3c4d-0-state": "/var/lib/libvirt/images/constell-worker-1a2b3c4d-1-state",
+			},
+			wantErr: true,
+		},
+		"invalid XML": {
+			template: "<domain><name>",
+			wantErr:  true,
+		},
+	}
+
+	for name, tc := range testCases {
+		t.Run(name, func(t *testing.T) {
+			assert := assert.New(t)
+			require := require.New(t)
+
+			got, err := cloneDomainXML(tc.template, "constell-worker-1a2b3c4d-1", tc.disks, tc.nvram)
+			if tc.wantErr {
+				assert.Error(err)
+				return
+			}
+			require.NoError(err)
+
+			var parsed domainXML
+			require.NoError(xml.Unmarshal([]byte(got), &parsed))
+			assert.Equal("constell-worker-1a2b3c4d-1", parsed.Name)
+			assert.Equal(tc.nvram, parsed.OS.NVRAM)
+			assert.Equal([]string{
+				"/var/lib/libvirt/images/constell-worker-1a2b3c4d-1-boot",
+				"/var/lib/libvirt/images/constell-worker-1a2b3c4d-1-state",
+			}, parsed.diskPaths())
+			_, ok := parsed.macOnNetwork("constell-network")
+			assert.False(ok)
+			assert.NotContains(got, "<uuid>")
+			assert.NotContains(got, "52:54:00:aa:bb:01")
+			// everything else is copied verbatim
+			assert.Contains(got, "<nvram template='/usr/share/OVMF/OVMF_VARS.fd'>")
+			assert.Contains(got, "<source file='/var/lib/libvirt/images/cloudinit.iso'/>")
+			assert.Contains(got, "<source network='constell-network'/>")
+			assert.Contains(got, "<qemu:arg value='-object'/>")
+			assert.Contains(got, `nodeImage="/var/lib/libvirt/images/image"`)
+		})
+	}
+}
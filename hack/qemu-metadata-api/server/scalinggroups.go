@@ -0,0 +1,218 @@
+/*
+Copyright (c) Edgeless Systems GmbH
+
+SPDX-License-Identifier: BUSL-1.1
+*/
+
+package server
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net"
+	"net/http"
+
+	"github.com/edgelesssys/constellation/v2/hack/qemu-metadata-api/scalinggroup"
+	"github.com/edgelesssys/constellation/v2/internal/role"
+)
+
+// ImageRequest is the body of requests setting the image of a scaling group,
+// and of responses returning it.
+type ImageRequest struct {
+	Image string `json:"image"`
+}
+
+// handleScalingGroups registers the handlers used by the node operator to manage scaling groups.
+func (s *Server) handleScalingGroups(mux *http.ServeMux) {
+	mux.Handle("GET /scalinggroups", http.HandlerFunc(s.listScalingGroups))
+	mux.Handle("GET /scalinggroups/{id}/image", http.HandlerFunc(s.getScalingGroupImage))
+	mux.Handle("PUT /scalinggroups/{id}/image", http.HandlerFunc(s.setScalingGroupImage))
+	mux.Handle("POST /scalinggroups/{id}/instances", http.HandlerFunc(s.createInstance))
+	mux.Handle("GET /instances/{name}", http.HandlerFunc(s.getInstance))
+	mux.Handle("DELETE /instances/{name}", http.HandlerFunc(s.deleteInstance))
+}
+
+// controlPlaneOnly rejects requests that are not sent by a control-plane instance.
+// The node operator runs on the control plane, so workloads on worker instances can't create or delete instances.
+// Instances are identified by the source address of the request.
+func (s *Server) controlPlaneOnly(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		log := s.log.With(slog.String("peer", r.RemoteAddr))
+
+		remoteIP, _, err := net.SplitHostPort(r.RemoteAddr)
+		if err != nil {
+			log.With(slog.Any("error", err)).Error("Failed to parse remote address")
+			http.Error(w, fmt.Sprintf("Failed to parse remote address: %s\n", err), http.StatusInternalServerError)
+			return
+		}
+		peers, err := s.listAll()
+		if err != nil {
+			log.With(slog.Any("error", err)).Error("Failed to list peer metadata")
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		for _, peer := range peers {
+			if peer.VPCIP == remoteIP && peer.Role == role.ControlPlane {
+				next.ServeHTTP(w, r)
+				return
+			}
+		}
+
+		log.Error("Rejecting request from peer that is not a control-plane instance")
+		http.Error(w, "Scaling groups can only be managed from control-plane instances", http.StatusForbidden)
+	})
+}
+
+// listScalingGroups returns all scaling groups.
+func (s *Server) listScalingGroups(w http.ResponseWriter, r *http.Request) {
+	log := s.log.With(slog.String("peer", r.RemoteAddr))
+	log.Info("Serving GET request for /scalinggroups")
+	if !s.scalingGroupsEnabled(w, log) {
+		return
+	}
+
+	groups, err := s.scalingGroups.ListScalingGroups()
+	if err != nil {
+		s.scalingGroupError(w, log, "Failed to list scaling groups", err)
+		return
+	}
+	writeJSON(w, log, groups)
+}
+
+// getScalingGroupImage returns the image used for new instances of a scaling group.
+func (s *Server) getScalingGroupImage(w http.ResponseWriter, r *http.Request) {
+	log := s.log.With(slog.String("peer", r.RemoteAddr), slog.String("scalingGroup", r.PathValue("id")))
+	log.Info("Serving GET request for /scalinggroups/{id}/image")
+	if !s.scalingGroupsEnabled(w, log) {
+		return
+	}
+
+	image, err := s.scalingGroups.GetImage(r.PathValue("id"))
+	if err != nil {
+		s.scalingGroupError(w, log, "Failed to get scaling group image", err)
+		return
+	}
+	writeJSON(w, log, ImageRequest{Image: image})
+}
+
+// setScalingGroupImage sets the image used for new instances of a scaling group.
+func (s *Server) setScalingGroupImage(w http.ResponseWriter, r *http.Request) {
+	log := s.log.With(slog.String("peer", r.RemoteAddr), slog.String("scalingGroup", r.PathValue("id")))
+	log.Info("Serving PUT request for /scalinggroups/{id}/image")
+	if !s.scalingGroupsEnabled(w, log) {
+		return
+	}
+
+	var req ImageRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil || req.Image == "" {
+		log.With(slog.Any("error", err)).Error("Invalid request body")
+		http.Error(w, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+	if err := s.scalingGroups.SetImage(r.PathValue("id"), req.Image); err != nil {
+		s.scalingGroupError(w, log, "Failed to set scaling group image", err)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+	log.Info("Request successful")
+}
+
+// createInstance creates a new instance in a scaling group.
+func (s *Server) createInstance(w http.ResponseWriter, r *http.Request) {
+	log := s.log.With(slog.String("peer", r.RemoteAddr), slog.String("scalingGroup", r.PathValue("id")))
+	log.Info("Serving POST request for /scalinggroups/{id}/instances")
+	if !s.scalingGroupsEnabled(w, log) {
+		return
+	}
+
+	instance, err := s.scalingGroups.CreateInstance(r.Context(), r.PathValue("id"))
+	if err != nil {
+		s.scalingGroupError(w, log, "Failed to create instance", err)
+		return
+	}
+	log.Info("Created instance", slog.String("instance", instance.Name))
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusCreated)
+	if err := json.NewEncoder(w).Encode(instance); err != nil {
+		log.With(slog.Any("error", err)).Error("Failed to write response")
+	}
+}
+
+// getInstance returns an instance by its hostname.
+func (s *Server) getInstance(w http.ResponseWriter, r *http.Request) {
+	log := s.log.With(slog.String("peer", r.RemoteAddr), slog.String("instance", r.PathValue("name")))
+	log.Info("Serving GET request for /instances/{name}")
+	if !s.scalingGroupsEnabled(w, log) {
+		return
+	}
+
+	instance, err := s.scalingGroups.GetInstance(r.PathValue("name"))
+	if err != nil {
+		s.scalingGroupError(w, log, "Failed to get instance", err)
+		return
+	}
+	writeJSON(w, log, instance)
+}
+
+// deleteInstance deletes an instance by its hostname.
+// Deleting an instance that does not exist succeeds.
+func (s *Server) deleteInstance(w http.ResponseWriter, r *http.Request) {
+	log := s.log.With(slog.String("peer", r.RemoteAddr), slog.String("instance", r.PathValue("name")))
+	log.Info("Serving DELETE request for /instances/{name}")
+	if !s.scalingGroupsEnabled(w, log) {
+		return
+	}
+
+	if err := s.scalingGroups.DeleteInstance(r.PathValue("name")); err != nil {
+		s.scalingGroupError(w, log, "Failed to delete instance", err)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+	log.Info("Request successful")
+}
+
+// scalingGroupsEnabled writes an error response if no scaling group manager is configured,
+// which is the case if the server uses a dnsmasq leases file instead of libvirt.
+func (s *Server) scalingGroupsEnabled(w http.ResponseWriter, log *slog.Logger) bool {
+	if s.scalingGroups == nil {
+		log.Error("Scaling groups are not supported without a libvirt connection")
+		http.Error(w, "Scaling groups are not supported without a libvirt connection", http.StatusNotImplemented)
+		return false
+	}
+	return true
+}
+
+func (s *Server) scalingGroupError(w http.ResponseWriter, log *slog.Logger, msg string, err error) {
+	log.With(slog.Any("error", err)).Error(msg)
+	if errors.Is(err, scalinggroup.ErrNotFound) {
+		http.Error(w, err.Error(), http.StatusNotFound)
+		return
+	}
+	if errors.Is(err, scalinggroup.ErrImageNotAllowed) {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	http.Error(w, err.Error(), http.StatusInternalServerError)
+}
+
+func writeJSON(w http.ResponseWriter, log *slog.Logger, v any) {
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(v); err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	log.Info("Request successful")
+}
+
+// ScalingGroupManager manages the libvirt domains of the cluster as scaling groups.
+type ScalingGroupManager interface {
+	ListScalingGroups() ([]scalinggroup.ScalingGroup, error)
+	GetImage(scalingGroupID string) (string, error)
+	SetImage(scalingGroupID, image string) error
+	GetInstance(name string) (scalinggroup.Instance, error)
+	CreateInstance(ctx context.Context, scalingGroupID string) (scalinggroup.Instance, error)
+	DeleteInstance(name string) error
+}
@@ -0,0 +1,271 @@
+/*
+Copyright (c) Edgeless Systems GmbH
+
+SPDX-License-Identifier: BUSL-1.1
+*/
+
+package server
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/edgelesssys/constellation/v2/hack/qemu-metadata-api/dhcp"
+	"github.com/edgelesssys/constellation/v2/hack/qemu-metadata-api/scalinggroup"
+	"github.com/edgelesssys/constellation/v2/internal/logger"
+	"github.com/edgelesssys/constellation/v2/internal/role"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestScalingGroups(t *testing.T) {
+	notFound := fmt.Errorf("scaling group: %w", scalinggroup.ErrNotFound)
+
+	testCases := map[string]struct {
+		method       string
+		path         string
+		body         string
+		manager      *stubScalingGroupManager
+		wantCode     int
+		wantResponse string
+		wantImage    string
+	}{
+		"list scaling groups": {
+			method: http.MethodGet,
+			path:   "/scalinggroups",
+			manager: &stubScalingGroupManager{
+				groups: []scalinggroup.ScalingGroup{{ID: "constell-worker-abcd", Role: role.Worker}},
+			},
+			wantCode:     http.StatusOK,
+			wantResponse: `[{"id":"constell-worker-abcd","role":"Worker"}]`,
+		},
+		"list scaling groups fails": {
+			method:   http.MethodGet,
+			path:     "/scalinggroups",
+			manager:  &stubScalingGroupManager{err: assert.AnError},
+			wantCode: http.StatusInternalServerError,
+		},
+		"get image": {
+			method:       http.MethodGet,
+			path:         "/scalinggroups/constell-worker-abcd/image",
+			manager:      &stubScalingGroupManager{image: "/pool/image"},
+			wantCode:     http.StatusOK,
+			wantResponse: `{"image":"/pool/image"}`,
+		},
+		"get image of unknown scaling group": {
+			method:   http.MethodGet,
+			path:     "/scalinggroups/unknown/image",
+			manager:  &stubScalingGroupManager{err: notFound},
+			wantCode: http.StatusNotFound,
+		},
+		"set image": {
+			method:    http.MethodPut,
+			path:      "/scalinggroups/constell-worker-abcd/image",
+			body:      `{"image":"https://example.com/image.raw"}`,
+			manager:   &stubScalingGroupManager{},
+			wantCode:  http.StatusNoContent,
+			wantImage: "https://example.com/image.raw",
+		},
+		"set image that is not allowed": {
+			method:   http.MethodPut,
+			path:     "/scalinggroups/constell-worker-abcd/image",
+			body:     `{"image":"http://169.254.169.254/latest"}`,
+			manager:  &stubScalingGroupManager{err: fmt.Errorf("image: %w", scalinggroup.ErrImageNotAllowed)},
+			wantCode: http.StatusBadRequest,
+		},
+		"set empty image": {
+			method:   http.MethodPut,
+			path:     "/scalinggroups/constell-worker-abcd/image",
+			body:     `{"image":""}`,
+			manager:  &stubScalingGroupManager{},
+			wantCode: http.StatusBadRequest,
+		},
+		"set image with invalid body": {
+			method:   http.MethodPut,
+			path:     "/scalinggroups/constell-worker-abcd/image",
+			body:     `image`,
+			manager:  &stubScalingGroupManager{},
+			wantCode: http.StatusBadRequest,
+		},
+		"create instance": {
+			method: http.MethodPost,
+			path:   "/scalinggroups/constell-worker-abcd/instances",
+			manager: &stubScalingGroupManager{
+				instance: scalinggroup.Instance{Name: "worker-2", ScalingGroupID: "constell-worker-abcd", Image: "/pool/image", State: scalinggroup.StateRunning},
+			},
+			wantCode:     http.StatusCreated,
+			wantResponse: `{"name":"worker-2","scalingGroupID":"constell-worker-abcd","image":"/pool/image","state":"running"}`,
+		},
+		"create instance fails": {
+			method:   http.MethodPost,
+			path:     "/scalinggroups/constell-worker-abcd/instances",
+			manager:  &stubScalingGroupManager{err: assert.AnError},
+			wantCode: http.StatusInternalServerError,
+		},
+		"get instance": {
+			method: http.MethodGet,
+			path:   "/instances/worker-0",
+			manager: &stubScalingGroupManager{
+				instance: scalinggroup.Instance{Name: "worker-0", ScalingGroupID: "constell-worker-abcd", Image: "/pool/image", State: scalinggroup.StateStopped},
+			},
+			wantCode:     http.StatusOK,
+			wantResponse: `{"name":"worker-0","scalingGroupID":"constell-worker-abcd","image":"/pool/image","state":"stopped"}`,
+		},
+		"get unknown instance": {
+			method:   http.MethodGet,
+			path:     "/instances/worker-5",
+			manager:  &stubScalingGroupManager{err: notFound},
+			wantCode: http.StatusNotFound,
+		},
+		"delete instance": {
+			method:   http.MethodDelete,
+			path:     "/instances/worker-0",
+			manager:  &stubScalingGroupManager{},
+			wantCode: http.StatusNoContent,
+		},
+		"delete instance fails": {
+			method:   http.MethodDelete,
+			path:     "/instances/worker-0",
+			manager:  &stubScalingGroupManager{err: assert.AnError},
+			wantCode: http.StatusInternalServerError,
+		},
+		"wrong method": {
+			method:   http.MethodPost,
+			path:     "/instances/worker-0",
+			manager:  &stubScalingGroupManager{},
+			wantCode: http.StatusMethodNotAllowed,
+		},
+		"no scaling group manager": {
+			method:   http.MethodGet,
+			path:     "/scalinggroups",
+			wantCode: http.StatusNotImplemented,
+		},
+	}
+
+	for name, tc := range testCases {
+		t.Run(name, func(t *testing.T) {
+			assert := assert.New(t)
+			require := require.New(t)
+
+			var manager ScalingGroupManager
+			if tc.manager != nil {
+				manager = tc.manager
+			}
+			server := New(logger.NewTest(t), "test", "initSecretHash", &stubLeaseGetter{}, manager)
+			mux := http.NewServeMux()
+			server.handleScalingGroups(mux)
+
+			req, err := http.NewRequestWithContext(t.Context(), tc.method, "http://10.42.0.1:8080"+tc.path, strings.NewReader(tc.body))
+			require.NoError(err)
+
+			w := httptest.NewRecorder()
+			mux.ServeHTTP(w, req)
+
+			assert.Equal(tc.wantCode, w.Code)
+			if tc.wantResponse != "" {
+				assert.JSONEq(tc.wantResponse, w.Body.String())
+			}
+			if tc.wantImage != "" {
+				assert.Equal(tc.wantImage, tc.manager.setImage)
+			}
+		})
+	}
+}
+
+func TestControlPlaneOnly(t *testing.T) {
+	leases := []dhcp.NetworkDHCPLease{
+		{IPaddr: "10.42.1.100", Hostname: "control-plane-0"},
+		{IPaddr: "10.42.2.100", Hostname: "worker-0"},
+	}
+
+	testCases := map[string]struct {
+		remoteAddr  string
+		leaseGetter *stubLeaseGetter
+		wantCode    int
+	}{
+		"control-plane instance": {
+			remoteAddr:  "10.42.1.100:1234",
+			leaseGetter: &stubLeaseGetter{leases: leases},
+			wantCode:    http.StatusNoContent,
+		},
+		"worker instance": {
+			remoteAddr:  "10.42.2.100:1234",
+			leaseGetter: &stubLeaseGetter{leases: leases},
+			wantCode:    http.StatusForbidden,
+		},
+		"unknown peer": {
+			remoteAddr:  "192.0.2.1:1234",
+			leaseGetter: &stubLeaseGetter{leases: leases},
+			wantCode:    http.StatusForbidden,
+		},
+		"invalid remote address": {
+			remoteAddr:  "10.42.1.100",
+			leaseGetter: &stubLeaseGetter{leases: leases},
+			wantCode:    http.StatusInternalServerError,
+		},
+		"getting leases fails": {
+			remoteAddr:  "10.42.1.100:1234",
+			leaseGetter: &stubLeaseGetter{getErr: assert.AnError},
+			wantCode:    http.StatusInternalServerError,
+		},
+	}
+
+	for name, tc := range testCases {
+		t.Run(name, func(t *testing.T) {
+			assert := assert.New(t)
+			require := require.New(t)
+
+			manager := &stubScalingGroupManager{}
+			server := New(logger.NewTest(t), "test", "initSecretHash", tc.leaseGetter, manager)
+			mux := http.NewServeMux()
+			server.handleScalingGroups(mux)
+
+			req, err := http.NewRequestWithContext(t.Context(), http.MethodDelete, "http://10.42.0.1:8081/instances/worker-0", http.NoBody)
+			require.NoError(err)
+			req.RemoteAddr = tc.remoteAddr
+
+			w := httptest.NewRecorder()
+			server.controlPlaneOnly(mux).ServeHTTP(w, req)
+
+			assert.Equal(tc.wantCode, w.Code)
+		})
+	}
+}
+
+type stubScalingGroupManager struct {
+	groups   []scalinggroup.ScalingGroup
+	image    string
+	instance scalinggroup.Instance
+	err      error
+
+	setImage string
+}
+
+func (m *stubScalingGroupManager) ListScalingGroups() ([]scalinggroup.ScalingGroup, error) {
+	return m.groups, m.err
+}
+
+func (m *stubScalingGroupManager) GetImage(_ string) (string, error) {
+	return m.image, m.err
+}
+
+func (m *stubScalingGroupManager) SetImage(_, image string) error {
+	m.setImage = image
+	return m.err
+}
+
+func (m *stubScalingGroupManager) GetInstance(_ string) (scalinggroup.Instance, error) {
+	return m.instance, m.err
+}
+
+func (m *stubScalingGroupManager) CreateInstance(_ context.Context, _ string) (scalinggroup.Instance, error) {
+	return m.instance, m.err
+}
+
+func (m *stubScalingGroupManager) DeleteInstance(_ string) error {
+	return m.err
+}
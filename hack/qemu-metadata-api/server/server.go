@@ -12,6 +12,7 @@ import (
 	"log/slog"
 	"net"
 	"net/http"
+	"strconv"
 	"strings"
 
 	"github.com/edgelesssys/constellation/v2/hack/qemu-metadata-api/dhcp"
@@ -25,15 +26,18 @@ type Server struct {
 	dhcpLeaseGetter   LeaseGetter
 	network           string
 	initSecretHashVal []byte
+	scalingGroups     ScalingGroupManager
 }
 
 // New creates a new Server.
-func New(log *slog.Logger, network, initSecretHash string, getter LeaseGetter) *Server {
+// If scalingGroups is nil, the scaling group endpoints used by the node operator are disabled.
+func New(log *slog.Logger, network, initSecretHash string, getter LeaseGetter, scalingGroups ScalingGroupManager) *Server {
 	return &Server{
 		log:               log,
 		dhcpLeaseGetter:   getter,
 		network:           network,
 		initSecretHashVal: []byte(initSecretHash),
+		scalingGroups:     scalingGroups,
 	}
 }
 
@@ -58,6 +62,25 @@ func (s *Server) ListenAndServe(port string) error {
 	return server.Serve(lis)
 }
 
+// ListenAndServeOperator serves the scaling group endpoints used by the node operator on a given port.
+// The endpoints create and delete instances, so they are only served to control-plane instances.
+func (s *Server) ListenAndServeOperator(port string) error {
+	mux := http.NewServeMux()
+	s.handleScalingGroups(mux)
+
+	server := http.Server{
+		Handler: s.controlPlaneOnly(mux),
+	}
+
+	lis, err := net.Listen("tcp", net.JoinHostPort("", port))
+	if err != nil {
+		return err
+	}
+
+	s.log.Info(fmt.Sprintf("Starting QEMU metadata operator API on %s", lis.Addr()))
+	return server.Serve(lis)
+}
+
 // listSelf returns peer information about the instance issuing the request.
 func (s *Server) listSelf(w http.ResponseWriter, r *http.Request) {
 	log := s.log.With(slog.String("peer", r.RemoteAddr))
@@ -133,7 +156,7 @@ func (s *Server) initSecretHash(w http.ResponseWriter, r *http.Request) {
 	log.Info("Request successful")
 }
 
-// getEndpoint returns the IP address of the first control-plane instance.
+// getEndpoint returns the IP address of the control-plane instance with the lowest index.
 // This allows us to fake a load balancer for QEMU instances.
 func (s *Server) getEndpoint(w http.ResponseWriter, r *http.Request) {
 	log := s.log.With(slog.String("peer", r.RemoteAddr))
@@ -143,23 +166,38 @@ func (s *Server) getEndpoint(w http.ResponseWriter, r *http.Request) {
 	if err != nil {
 		log.With(slog.Any("error", err)).Error("Failed to get DHCP leases")
 		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
 	}
 
+	// control-plane-0 may have been replaced by the node operator,
+	// in which case the control-plane instance with the next lowest index is used.
+	endpoint := ""
+	lowestIndex := -1
 	for _, lease := range leases {
-		if strings.HasPrefix(lease.Hostname, "control-plane") &&
-			strings.HasSuffix(lease.Hostname, "0") {
-			w.Header().Set("Content-Type", "application/json")
-			if err := json.NewEncoder(w).Encode(lease.IPaddr); err != nil {
-				http.Error(w, err.Error(), http.StatusInternalServerError)
-				return
-			}
-			log.Info("Request successful")
-			return
+		indexStr, ok := strings.CutPrefix(lease.Hostname, "control-plane-")
+		if !ok {
+			continue
+		}
+		index, err := strconv.Atoi(indexStr)
+		if err != nil {
+			continue
+		}
+		if lowestIndex == -1 || index < lowestIndex {
+			endpoint, lowestIndex = lease.IPaddr, index
 		}
 	}
 
-	log.Error("Failed to find control-plane peer in active leases")
-	http.Error(w, "No matching peer found", http.StatusNotFound)
+	if lowestIndex == -1 {
+		log.Error("Failed to find control-plane peer in active leases")
+		http.Error(w, "No matching peer found", http.StatusNotFound)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(endpoint); err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	log.Info("Request successful")
 }
 
 // listAll returns a list of all active peers.
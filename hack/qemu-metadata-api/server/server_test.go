@@ -55,7 +55,7 @@ func TestListAll(t *testing.T) {
 		t.Run(name, func(t *testing.T) {
 			assert := assert.New(t)
 
-			server := New(logger.NewTest(t), "test", "initSecretHash", tc.stubLeaseGetter)
+			server := New(logger.NewTest(t), "test", "initSecretHash", tc.stubLeaseGetter, nil)
 
 			res, err := server.listAll()
 
@@ -124,7 +124,7 @@ func TestListSelf(t *testing.T) {
 			assert := assert.New(t)
 			require := require.New(t)
 
-			server := New(logger.NewTest(t), "test", "initSecretHash", tc.stubLeaseGetter)
+			server := New(logger.NewTest(t), "test", "initSecretHash", tc.stubLeaseGetter, nil)
 
 			req, err := http.NewRequestWithContext(t.Context(), http.MethodGet, "http://192.0.0.1/self", nil)
 			require.NoError(err)
@@ -184,7 +184,7 @@ func TestListPeers(t *testing.T) {
 			assert := assert.New(t)
 			require := require.New(t)
 
-			server := New(logger.NewTest(t), "test", "initSecretHash", tc.stubNetworkGetter)
+			server := New(logger.NewTest(t), "test", "initSecretHash", tc.stubNetworkGetter, nil)
 
 			req, err := http.NewRequestWithContext(t.Context(), http.MethodGet, "http://192.0.0.1/peers", nil)
 			require.NoError(err)
@@ -240,7 +240,7 @@ func TestInitSecretHash(t *testing.T) {
 			assert := assert.New(t)
 			require := require.New(t)
 
-			server := New(logger.NewTest(t), "test", tc.wantHash, defaultConnect)
+			server := New(logger.NewTest(t), "test", tc.wantHash, defaultConnect, nil)
 
 			req, err := http.NewRequestWithContext(t.Context(), tc.method, "http://192.0.0.1/initsecrethash", nil)
 			require.NoError(err)
@@ -259,6 +259,73 @@ func TestInitSecretHash(t *testing.T) {
 	}
 }
 
+func TestGetEndpoint(t *testing.T) {
+	testCases := map[string]struct {
+		stubLeaseGetter *stubLeaseGetter
+		wantEndpoint    string
+		wantErr         bool
+	}{
+		"success": {
+			stubLeaseGetter: &stubLeaseGetter{
+				leases: []dhcp.NetworkDHCPLease{
+					{IPaddr: "192.0.200.1", Hostname: "worker-0"},
+					{IPaddr: "192.0.100.2", Hostname: "control-plane-1"},
+					{IPaddr: "192.0.100.1", Hostname: "control-plane-0"},
+				},
+			},
+			wantEndpoint: "192.0.100.1",
+		},
+		"control-plane-0 was replaced": {
+			stubLeaseGetter: &stubLeaseGetter{
+				leases: []dhcp.NetworkDHCPLease{
+					{IPaddr: "192.0.100.11", Hostname: "control-plane-10"},
+					{IPaddr: "192.0.100.3", Hostname: "control-plane-2"},
+					{IPaddr: "192.0.200.1", Hostname: "worker-0"},
+				},
+			},
+			wantEndpoint: "192.0.100.3",
+		},
+		"no control-plane lease": {
+			stubLeaseGetter: &stubLeaseGetter{
+				leases: []dhcp.NetworkDHCPLease{
+					{IPaddr: "192.0.200.1", Hostname: "worker-0"},
+				},
+			},
+			wantErr: true,
+		},
+		"GetDHCPLeases error": {
+			stubLeaseGetter: &stubLeaseGetter{
+				getErr: assert.AnError,
+			},
+			wantErr: true,
+		},
+	}
+
+	for name, tc := range testCases {
+		t.Run(name, func(t *testing.T) {
+			assert := assert.New(t)
+			require := require.New(t)
+
+			server := New(logger.NewTest(t), "test", "initSecretHash", tc.stubLeaseGetter, nil)
+
+			req, err := http.NewRequestWithContext(t.Context(), http.MethodGet, "http://192.0.0.1/endpoint", nil)
+			require.NoError(err)
+
+			w := httptest.NewRecorder()
+			server.getEndpoint(w, req)
+
+			if tc.wantErr {
+				assert.NotEqual(http.StatusOK, w.Code)
+				return
+			}
+			assert.Equal(http.StatusOK, w.Code)
+			var endpoint string
+			require.NoError(json.NewDecoder(w.Body).Decode(&endpoint))
+			assert.Equal(tc.wantEndpoint, endpoint)
+		})
+	}
+}
+
 type stubLeaseGetter struct {
 	leases []dhcp.NetworkDHCPLease
 	getErr error
@@ -118,8 +118,8 @@ func precalculatePCR4(simulator *measure.Simulator, fs afero.Fs, ukiFile string)
 	}
 
 	bootStages := []measure.EFIBootStage{
-		{Name: "Unified Kernel Image (UKI)", Digest: measure.PCR256(ukiMeasurement)},
-		{Name: "Linux", Digest: measure.PCR256(linuxMeasurement)},
+		{Name: measure.UKIBootStageName, Digest: measure.PCR256(ukiMeasurement)},
+		{Name: measure.LinuxBootStageName, Digest: measure.PCR256(linuxMeasurement)},
 	}
 
 	if err := measure.DescribeBootStages(os.Stderr, bootStages); err != nil {
@@ -11,6 +11,17 @@ import (
 	"io"
 )
 
+const (
+	// EVEFIActionDescription describes the EV_EFI_ACTION event measured before calling the EFI application of a boot option.
+	EVEFIActionDescription = "EV_EFI_ACTION: Calling EFI Application from Boot Option"
+	// EVSeparatorDescription describes the EV_SEPARATOR event.
+	EVSeparatorDescription = "EV_SEPARATOR"
+	// UKIBootStageName is the name of the boot stage loading the unified kernel image.
+	UKIBootStageName = "Unified Kernel Image (UKI)"
+	// LinuxBootStageName is the name of the boot stage loading the Linux kernel image from the UKI.
+	LinuxBootStageName = "Linux"
+)
+
 // EFIBootStage is a stage (bootloader) of the EFI boot process.
 type EFIBootStage struct {
 	Name   string
@@ -39,17 +50,17 @@ func DescribeBootStages(w io.Writer, bootStages []EFIBootStage) error {
 // PredictPCR4 predicts the PCR4 value based on the EFIBootStages.
 func PredictPCR4(simulator *Simulator, efiBootStages []EFIBootStage) error {
 	// TCG PC Client Platform Firmware Profile Family "2.0 Section" 7.2.4.4.a
-	if err := simulator.ExtendPCR(4, EVEFIActionPCR256(), nil, "EV_EFI_ACTION: Calling EFI Application from Boot Option"); err != nil {
+	if err := simulator.ExtendPCR(4, EVEFIActionPCR256(), nil, EVEFIActionDescription); err != nil {
 		return err
 	}
 	// TCG PC Client Platform Firmware Profile Family "2.0 Section" 7.2.4.4.b
-	if err := simulator.ExtendPCR(4, EVSeparatorPCR256(), []byte{0x00, 0x00, 0x00, 0x00}, "EV_SEPARATOR"); err != nil {
+	if err := simulator.ExtendPCR(4, EVSeparatorPCR256(), []byte{0x00, 0x00, 0x00, 0x00}, EVSeparatorDescription); err != nil {
 		return err
 	}
 
 	for i, efiBootStage := range efiBootStages {
 		// TCG PC Client Platform Firmware Profile Family "2.0 Section" 7.2.4.4.e
-		err := simulator.ExtendPCR(4, efiBootStage.Digest, nil, fmt.Sprintf("Boot Stage %d: %s", i+1, efiBootStage.Name))
+		err := simulator.ExtendPCR(4, efiBootStage.Digest, nil, BootStageDescription(i+1, efiBootStage.Name))
 		if err != nil {
 			return err
 		}
@@ -57,3 +68,8 @@ func PredictPCR4(simulator *Simulator, efiBootStages []EFIBootStage) error {
 
 	return nil
 }
+
+// BootStageDescription describes the event measuring the EFI boot stage with the given number, counted from 1.
+func BootStageDescription(stage int, name string) string {
+	return fmt.Sprintf("Boot Stage %d: %s", stage, name)
+}
@@ -43,7 +43,7 @@ func PredictPCR9(simulator *Simulator, cmdline []byte, initrdDigest [32]byte) er
 	if err != nil {
 		return err
 	}
-	err = simulator.ExtendPCR(9, sha256.Sum256(cmdlineUTF16LE), cmdlineUTF16LE, fmt.Sprintf("EV_EVENT_TAG: Linux LOAD_FILE2 protocol: cmdline %q", cmdline))
+	err = simulator.ExtendPCR(9, sha256.Sum256(cmdlineUTF16LE), cmdlineUTF16LE, LinuxLoad2CmdlineDescription(cmdline))
 	if err != nil {
 		return err
 	}
@@ -51,10 +51,20 @@ func PredictPCR9(simulator *Simulator, cmdline []byte, initrdDigest [32]byte) er
 	// Linux LOAD_FILE2 protocol - efi_load_initrd
 	// https://github.com/torvalds/linux/blob/42dc814987c1feb6410904e58cfd4c36c4146150/drivers/firmware/efi/libstub/efi-stub-helper.c#L559
 	// initrd is hashed as-is and measured
-	err = simulator.ExtendPCR(9, initrdDigest, nil, fmt.Sprintf("EV_EVENT_TAG: Linux LOAD_FILE2 protocol: initrd (digest %x)", initrdDigest))
+	err = simulator.ExtendPCR(9, initrdDigest, nil, LinuxLoad2InitrdDescription(initrdDigest))
 	if err != nil {
 		return err
 	}
 
 	return nil
 }
+
+// LinuxLoad2CmdlineDescription describes the event measuring the kernel command line.
+func LinuxLoad2CmdlineDescription(cmdline []byte) string {
+	return fmt.Sprintf("EV_EVENT_TAG: Linux LOAD_FILE2 protocol: cmdline %q", cmdline)
+}
+
+// LinuxLoad2InitrdDescription describes the event measuring the initrd.
+func LinuxLoad2InitrdDescription(initrdDigest [32]byte) string {
+	return fmt.Sprintf("EV_EVENT_TAG: Linux LOAD_FILE2 protocol: initrd (digest %x)", initrdDigest)
+}
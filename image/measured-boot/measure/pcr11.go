@@ -52,13 +52,13 @@ func PredictPCR11(simulator *Simulator, ukiSections []pesection.PESection) error
 
 		// first, measure the name
 		name := ukiSection.NullTerminatedName()
-		err := simulator.ExtendPCR(11, sha256.Sum256(name), name, fmt.Sprintf("EV_IPL: UKI section %d name: %s", i+1, ukiSection.Name))
+		err := simulator.ExtendPCR(11, sha256.Sum256(name), name, UKISectionNameDescription(i+1, ukiSection.Name))
 		if err != nil {
 			return err
 		}
 
 		// then, measure the data
-		err = simulator.ExtendPCR(11, ukiSection.Digest, nil, fmt.Sprintf("EV_IPL: UKI section %d data: %x", i+1, ukiSection.Digest))
+		err = simulator.ExtendPCR(11, ukiSection.Digest, nil, UKISectionDataDescription(i+1, ukiSection.Digest))
 		if err != nil {
 			return err
 		}
@@ -66,3 +66,13 @@ func PredictPCR11(simulator *Simulator, ukiSections []pesection.PESection) error
 
 	return nil
 }
+
+// UKISectionNameDescription describes the event measuring the name of the UKI section with the given number, counted from 1.
+func UKISectionNameDescription(section int, name string) string {
+	return fmt.Sprintf("EV_IPL: UKI section %d name: %s", section, name)
+}
+
+// UKISectionDataDescription describes the event measuring the data of the UKI section with the given number, counted from 1.
+func UKISectionDataDescription(section int, digest [32]byte) string {
+	return fmt.Sprintf("EV_IPL: UKI section %d data: %x", section, digest)
+}
@@ -39,6 +39,7 @@ func NewValidator(cfg *config.AWSNitroTPM, log attestation.Logger) *Validator {
 		v.tpmEnabled,
 		log,
 	)
+	v.SetPolicy(cfg.Policy, nil)
 	v.getDescribeClient = getEC2Client
 	return v
 }
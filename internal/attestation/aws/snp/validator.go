@@ -15,6 +15,7 @@ import (
 	"fmt"
 
 	"github.com/edgelesssys/constellation/v2/internal/attestation"
+	"github.com/edgelesssys/constellation/v2/internal/attestation/policy"
 	"github.com/edgelesssys/constellation/v2/internal/attestation/snp"
 	"github.com/edgelesssys/constellation/v2/internal/attestation/variant"
 	"github.com/edgelesssys/constellation/v2/internal/attestation/vtpm"
@@ -45,10 +46,18 @@ type Validator struct {
 
 // NewValidator create a new Validator structure and returns it.
 func NewValidator(cfg *config.AWSSEVSNP, log attestation.Logger) *Validator {
+	getter := trust.DefaultHTTPSGetter()
 	v := &Validator{
-		cfg:             cfg,
-		reportValidator: &awsValidator{httpsGetter: trust.DefaultHTTPSGetter(), verifier: &reportVerifierImpl{}, validator: &reportValidatorImpl{}},
-		log:             log,
+		cfg: cfg,
+		reportValidator: &awsValidator{
+			httpsGetter: getter,
+			verifier:    &reportVerifierImpl{},
+			validator:   &reportValidatorImpl{},
+			revocationChecker: snp.NewRevocationChecker(
+				(*x509.RevocationList)(&cfg.AMDCRL), abi.VlekReportSigner, cfg.RequireCRL, getter, log,
+			),
+		},
+		log: log,
 	}
 
 	v.Validator = vtpm.NewValidator(
@@ -57,6 +66,9 @@ func NewValidator(cfg *config.AWSSEVSNP, log attestation.Logger) *Validator {
 		func(vtpm.AttestationDocument, *attest.MachineState) error { return nil },
 		log,
 	)
+	v.SetPolicy(cfg.Policy, func(attDoc vtpm.AttestationDocument) (policy.Claims, error) {
+		return snp.PolicyClaims(attDoc.InstanceInfo)
+	})
 	return v
 }
 
@@ -105,14 +117,18 @@ type snpReportValidator interface {
 // awsValidator implements the validation for AWS SNP attestation.
 // The properties exist for unittesting.
 type awsValidator struct {
-	verifier    reportVerifier
-	validator   reportValidator
-	httpsGetter trust.HTTPSGetter
+	verifier          reportVerifier
+	validator         reportValidator
+	revocationChecker revocationChecker
+	httpsGetter       trust.HTTPSGetter
 }
 
 type reportVerifier interface {
 	SnpAttestation(att *sevsnp.Attestation, opts *verify.Options) error
 }
+type revocationChecker interface {
+	CheckCertificateChain(chain *sevsnp.CertificateChain, ark *x509.Certificate) error
+}
 type reportValidator interface {
 	SnpAttestation(att *sevsnp.Attestation, opts *validate.Options) error
 }
@@ -130,7 +146,7 @@ func (r *reportVerifierImpl) SnpAttestation(att *sevsnp.Attestation, opts *verif
 }
 
 // validate the report by checking if it has a valid VLEK signature.
-// The certificate chain ARK -> ASK -> VLEK is also validated.
+// The certificate chain ARK -> ASK -> VLEK is also validated and checked for revoked certificates.
 // Checks that the report's userData matches the connection's userData.
 func (a *awsValidator) validate(attestation vtpm.AttestationDocument, ask *x509.Certificate, ark *x509.Certificate, akDigest [64]byte, config *config.AWSSEVSNP, log attestation.Logger) error {
 	var info snp.InstanceInfo
@@ -154,6 +170,10 @@ func (a *awsValidator) validate(attestation vtpm.AttestationDocument, ask *x509.
 		return newValidationError(fmt.Errorf("verifying SNP attestation: %w", err))
 	}
 
+	if err := a.revocationChecker.CheckCertificateChain(att.CertificateChain, ark); err != nil {
+		return newValidationError(fmt.Errorf("checking SNP certificate revocation: %w", err))
+	}
+
 	validateOpts := &validate.Options{
 		// Check that the attestation key's digest is included in the report.
 		ReportData: akDigest[:],
@@ -119,6 +119,7 @@ func TestValidateSNPReport(t *testing.T) {
 		reportTransformer func(string, func(*spb.Report)) string
 		verifier          reportVerifier
 		validator         reportValidator
+		revocationErr     error
 		wantErr           bool
 	}{
 		"success": {
@@ -127,6 +128,14 @@ func TestValidateSNPReport(t *testing.T) {
 			verifier:  &reportVerifierImpl{},
 			validator: &reportValidatorImpl{},
 		},
+		"revoked certificate": {
+			ak:            testdata.AKDigest,
+			report:        testdata.SNPReport,
+			verifier:      &reportVerifierImpl{},
+			validator:     &reportValidatorImpl{},
+			revocationErr: assert.AnError,
+			wantErr:       true,
+		},
 		"invalid report data": {
 			ak: testdata.AKDigest,
 			report: reportTransformer(testdata.SNPReport, func(r *spb.Report) {
@@ -159,7 +168,12 @@ func TestValidateSNPReport(t *testing.T) {
 			infoMarshalled, err := json.Marshal(info)
 			require.NoError(err)
 
-			v := awsValidator{httpsGetter: newStubHTTPSGetter(&urlResponseMatcher{}, nil), verifier: tc.verifier, validator: tc.validator}
+			v := awsValidator{
+				httpsGetter:       newStubHTTPSGetter(&urlResponseMatcher{}, nil),
+				verifier:          tc.verifier,
+				validator:         tc.validator,
+				revocationChecker: &stubRevocationChecker{err: tc.revocationErr},
+			}
 			err = v.validate(vtpm.AttestationDocument{InstanceInfo: infoMarshalled}, ask, ark, [64]byte(hash), config.DefaultForAWSSEVSNP(), logger.NewTest(t))
 			if tc.wantErr {
 				assert.Error(err)
@@ -302,3 +316,11 @@ type stubReportVerifier struct{}
 func (stubReportVerifier) SnpAttestation(_ *sevsnp.Attestation, _ *verify.Options) error {
 	return nil
 }
+
+type stubRevocationChecker struct {
+	err error
+}
+
+func (s *stubRevocationChecker) CheckCertificateChain(_ *sevsnp.CertificateChain, _ *x509.Certificate) error {
+	return s.err
+}
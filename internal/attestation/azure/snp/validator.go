@@ -18,6 +18,7 @@ import (
 	"github.com/edgelesssys/constellation/v2/internal/attestation"
 	"github.com/edgelesssys/constellation/v2/internal/attestation/azure"
 	"github.com/edgelesssys/constellation/v2/internal/attestation/idkeydigest"
+	"github.com/edgelesssys/constellation/v2/internal/attestation/policy"
 	"github.com/edgelesssys/constellation/v2/internal/attestation/snp"
 	"github.com/edgelesssys/constellation/v2/internal/attestation/variant"
 	"github.com/edgelesssys/constellation/v2/internal/attestation/vtpm"
@@ -42,6 +43,7 @@ type Validator struct {
 
 	attestationVerifier  attestationVerifier
 	attestationValidator attestationValidator
+	revocationChecker    revocationChecker
 
 	config *config.AzureSEVSNP
 
@@ -56,6 +58,10 @@ type attestationValidator interface {
 	SNPAttestation(attestation *spb.Attestation, options *validate.Options) error
 }
 
+type revocationChecker interface {
+	CheckCertificateChain(chain *spb.CertificateChain, ark *x509.Certificate) error
+}
+
 type attestationVerifierImpl struct{}
 
 // SNPAttestation verifies the report signature, the VCEK certificate, as well as the certificate chain of the attestation report.
@@ -75,14 +81,18 @@ func NewValidator(cfg *config.AzureSEVSNP, log attestation.Logger) *Validator {
 	if log == nil {
 		log = nopAttestationLogger{}
 	}
+	getter := trust.DefaultHTTPSGetter()
 	v := &Validator{
 		hclValidator:         &azure.HCLAkValidator{},
 		maa:                  newMAAClient(),
 		config:               cfg,
 		log:                  log,
-		getter:               trust.DefaultHTTPSGetter(),
+		getter:               getter,
 		attestationVerifier:  attestationVerifierImpl{},
 		attestationValidator: attestationValidatorImpl{},
+		revocationChecker: snp.NewRevocationChecker(
+			(*x509.RevocationList)(&cfg.AMDCRL), abi.VcekReportSigner, cfg.RequireCRL, getter, log,
+		),
 	}
 	v.Validator = vtpm.NewValidator(
 		cfg.Measurements,
@@ -93,6 +103,9 @@ func NewValidator(cfg *config.AzureSEVSNP, log attestation.Logger) *Validator {
 		},
 		log,
 	)
+	v.SetPolicy(cfg.Policy, func(attDoc vtpm.AttestationDocument) (policy.Claims, error) {
+		return snp.PolicyClaims(attDoc.InstanceInfo)
+	})
 	return v
 }
 
@@ -125,6 +138,11 @@ func (v *Validator) getTrustedKey(ctx context.Context, attDoc vtpm.AttestationDo
 		return nil, fmt.Errorf("verifying SNP attestation: %w", err)
 	}
 
+	// Checks that neither the ASK nor the VCEK were revoked by AMD.
+	if err := v.revocationChecker.CheckCertificateChain(att.CertificateChain, trustedArk); err != nil {
+		return nil, fmt.Errorf("checking SNP certificate revocation: %w", err)
+	}
+
 	// Checks if the attestation report matches the given constraints.
 	// Some constraints are implicitly checked by validate.SnpAttestation:
 	// - the report is not expired
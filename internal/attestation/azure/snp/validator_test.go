@@ -10,6 +10,7 @@ import (
 	"bytes"
 	"context"
 	"crypto/sha256"
+	"crypto/x509"
 	"encoding/hex"
 	"encoding/json"
 	"errors"
@@ -248,6 +249,7 @@ func TestTrustedKeyFromSNP(t *testing.T) {
 		getter               *stubHTTPSGetter
 		verifier             *stubAttestationVerifier
 		validator            *stubAttestationValidator
+		revocationErr        error
 		wantErr              bool
 		assertion            func(*assert.Assertions, error)
 	}{
@@ -265,6 +267,25 @@ func TestTrustedKeyFromSNP(t *testing.T) {
 				nil,
 			),
 		},
+		"revoked certificate": {
+			report:               defaultReport,
+			runtimeData:          defaultRuntimeData,
+			acceptedIDKeyDigests: defaultIDKeyDigest,
+			enforcementPolicy:    idkeydigest.Equal,
+			verifier:             defaultVerifier,
+			validator:            defaultValidator,
+			vcek:                 testdata.AzureThimVCEK,
+			certChain:            testdata.CertChain,
+			getter: newStubHTTPSGetter(
+				&urlResponseMatcher{},
+				nil,
+			),
+			revocationErr: assert.AnError,
+			wantErr:       true,
+			assertion: func(assert *assert.Assertions, err error) {
+				assert.ErrorContains(err, "checking SNP certificate revocation")
+			},
+		},
 		"certificate fetch error": {
 			report:               defaultReport,
 			runtimeData:          defaultRuntimeData,
@@ -648,6 +669,7 @@ func TestTrustedKeyFromSNP(t *testing.T) {
 				getter:               tc.getter,
 				attestationVerifier:  tc.verifier,
 				attestationValidator: tc.validator,
+				revocationChecker:    &stubRevocationChecker{err: tc.revocationErr},
 			}
 
 			key, err := validator.getTrustedKey(t.Context(), attDoc, nil)
@@ -676,6 +698,14 @@ func (v *stubAttestationVerifier) SNPAttestation(attestation *spb.Attestation, o
 	return verify.SnpAttestation(attestation, options)
 }
 
+type stubRevocationChecker struct {
+	err error
+}
+
+func (s *stubRevocationChecker) CheckCertificateChain(_ *spb.CertificateChain, _ *x509.Certificate) error {
+	return s.err
+}
+
 type stubAttestationValidator struct {
 	skipCheck bool // whether the verification function should be called
 }
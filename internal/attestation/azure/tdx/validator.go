@@ -15,6 +15,7 @@ import (
 
 	"github.com/edgelesssys/constellation/v2/internal/attestation"
 	"github.com/edgelesssys/constellation/v2/internal/attestation/azure"
+	"github.com/edgelesssys/constellation/v2/internal/attestation/policy"
 	"github.com/edgelesssys/constellation/v2/internal/attestation/variant"
 	"github.com/edgelesssys/constellation/v2/internal/attestation/vtpm"
 	"github.com/edgelesssys/constellation/v2/internal/config"
@@ -53,6 +54,7 @@ func NewValidator(cfg *config.AzureTDX, log attestation.Logger) *Validator {
 		},
 		log,
 	)
+	v.SetPolicy(cfg.Policy, policyClaims)
 
 	return v
 }
@@ -88,6 +90,37 @@ func (v *Validator) getTrustedTPMKey(_ context.Context, attDoc vtpm.AttestationD
 	return pubArea.Key()
 }
 
+// policyClaims returns the claims of the TDX quote for the evaluation of the attestation policy.
+func policyClaims(attDoc vtpm.AttestationDocument) (policy.Claims, error) {
+	var instanceInfo InstanceInfo
+	if err := json.Unmarshal(attDoc.InstanceInfo, &instanceInfo); err != nil {
+		return policy.Claims{}, fmt.Errorf("unmarshalling instance info: %w", err)
+	}
+
+	quotePb, err := abi.QuoteToProto(instanceInfo.AttestationReport)
+	if err != nil {
+		return policy.Claims{}, fmt.Errorf("parsing TDX quote: %w", err)
+	}
+	quote, ok := quotePb.(*tdx.QuoteV4)
+	if !ok {
+		return policy.Claims{}, fmt.Errorf("unexpected quote type: %T", quotePb)
+	}
+
+	body := quote.GetTdQuoteBody()
+	return policy.Claims{TDX: &policy.TDXClaims{
+		TEETCBSVN:     body.GetTeeTcbSvn(),
+		MRSeam:        body.GetMrSeam(),
+		TDAttributes:  body.GetTdAttributes(),
+		XFAM:          body.GetXfam(),
+		MRTD:          body.GetMrTd(),
+		MRConfigID:    body.GetMrConfigId(),
+		MROwner:       body.GetMrOwner(),
+		MROwnerConfig: body.GetMrOwnerConfig(),
+		RTMRs:         body.GetRtmrs(),
+		ReportData:    body.GetReportData(),
+	}}, nil
+}
+
 func (v *Validator) validateQuote(tdxQuote *tdx.QuoteV4) error {
 	roots := x509.NewCertPool()
 	roots.AddCert((*x509.Certificate)(&v.cfg.IntelRootKey))
@@ -46,6 +46,7 @@ func NewValidator(cfg *config.AzureTrustedLaunch, log attestation.Logger) *Valid
 		validateVM,
 		log,
 	)
+	v.SetPolicy(cfg.Policy, nil)
 	return v
 }
 
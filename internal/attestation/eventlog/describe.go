@@ -0,0 +1,246 @@
+/*
+Copyright (c) Edgeless Systems GmbH
+
+SPDX-License-Identifier: BUSL-1.1
+*/
+
+package eventlog
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/binary"
+	"fmt"
+	"strings"
+	"unicode"
+	"unicode/utf16"
+
+	"github.com/edgelesssys/constellation/v2/image/measured-boot/measure"
+)
+
+// EventType is the type of an event log event.
+type EventType uint32
+
+// Event types defined by the TCG PC Client Platform Firmware Profile Specification, Section 10.4.1.
+const (
+	EVPrebootCert                EventType = 0x00000000
+	EVPostCode                   EventType = 0x00000001
+	EVNoAction                   EventType = 0x00000003
+	EVSeparator                  EventType = 0x00000004
+	EVAction                     EventType = 0x00000005
+	EVEventTag                   EventType = 0x00000006
+	EVSCRTMContents              EventType = 0x00000007
+	EVSCRTMVersion               EventType = 0x00000008
+	EVCPUMicrocode               EventType = 0x00000009
+	EVPlatformConfigFlags        EventType = 0x0000000A
+	EVTableOfDevices             EventType = 0x0000000B
+	EVCompactHash                EventType = 0x0000000C
+	EVIPL                        EventType = 0x0000000D
+	EVIPLPartitionData           EventType = 0x0000000E
+	EVNonhostCode                EventType = 0x0000000F
+	EVNonhostConfig              EventType = 0x00000010
+	EVNonhostInfo                EventType = 0x00000011
+	EVOmitBootDeviceEvents       EventType = 0x00000012
+	EVEFIVariableDriverConfig    EventType = 0x80000001
+	EVEFIVariableBoot            EventType = 0x80000002
+	EVEFIBootServicesApplication EventType = 0x80000003
+	EVEFIBootServicesDriver      EventType = 0x80000004
+	EVEFIRuntimeServicesDriver   EventType = 0x80000005
+	EVEFIGPTEvent                EventType = 0x80000006
+	EVEFIAction                  EventType = 0x80000007
+	EVEFIPlatformFirmwareBlob    EventType = 0x80000008
+	EVEFIHandoffTables           EventType = 0x80000009
+	EVEFIPlatformFirmwareBlob2   EventType = 0x8000000A
+	EVEFIHandoffTables2          EventType = 0x8000000B
+	EVEFIVariableBoot2           EventType = 0x8000000C
+	EVEFIHCRTMEvent              EventType = 0x80000010
+	EVEFIVariableAuthority       EventType = 0x800000E0
+)
+
+var eventTypeNames = map[EventType]string{
+	EVPrebootCert:                "EV_PREBOOT_CERT",
+	EVPostCode:                   "EV_POST_CODE",
+	EVNoAction:                   "EV_NO_ACTION",
+	EVSeparator:                  "EV_SEPARATOR",
+	EVAction:                     "EV_ACTION",
+	EVEventTag:                   "EV_EVENT_TAG",
+	EVSCRTMContents:              "EV_S_CRTM_CONTENTS",
+	EVSCRTMVersion:               "EV_S_CRTM_VERSION",
+	EVCPUMicrocode:               "EV_CPU_MICROCODE",
+	EVPlatformConfigFlags:        "EV_PLATFORM_CONFIG_FLAGS",
+	EVTableOfDevices:             "EV_TABLE_OF_DEVICES",
+	EVCompactHash:                "EV_COMPACT_HASH",
+	EVIPL:                        "EV_IPL",
+	EVIPLPartitionData:           "EV_IPL_PARTITION_DATA",
+	EVNonhostCode:                "EV_NONHOST_CODE",
+	EVNonhostConfig:              "EV_NONHOST_CONFIG",
+	EVNonhostInfo:                "EV_NONHOST_INFO",
+	EVOmitBootDeviceEvents:       "EV_OMIT_BOOT_DEVICE_EVENTS",
+	EVEFIVariableDriverConfig:    "EV_EFI_VARIABLE_DRIVER_CONFIG",
+	EVEFIVariableBoot:            "EV_EFI_VARIABLE_BOOT",
+	EVEFIBootServicesApplication: "EV_EFI_BOOT_SERVICES_APPLICATION",
+	EVEFIBootServicesDriver:      "EV_EFI_BOOT_SERVICES_DRIVER",
+	EVEFIRuntimeServicesDriver:   "EV_EFI_RUNTIME_SERVICES_DRIVER",
+	EVEFIGPTEvent:                "EV_EFI_GPT_EVENT",
+	EVEFIAction:                  "EV_EFI_ACTION",
+	EVEFIPlatformFirmwareBlob:    "EV_EFI_PLATFORM_FIRMWARE_BLOB",
+	EVEFIHandoffTables:           "EV_EFI_HANDOFF_TABLES",
+	EVEFIPlatformFirmwareBlob2:   "EV_EFI_PLATFORM_FIRMWARE_BLOB2",
+	EVEFIHandoffTables2:          "EV_EFI_HANDOFF_TABLES2",
+	EVEFIVariableBoot2:           "EV_EFI_VARIABLE_BOOT2",
+	EVEFIHCRTMEvent:              "EV_EFI_HCRTM_EVENT",
+	EVEFIVariableAuthority:       "EV_EFI_VARIABLE_AUTHORITY",
+}
+
+// String returns the name of the event type as used in the specification.
+func (t EventType) String() string {
+	if name, ok := eventTypeNames[t]; ok {
+		return name
+	}
+	return fmt.Sprintf("EV_UNKNOWN(0x%08x)", uint32(t))
+}
+
+const (
+	// pcrBootStages is the PCR the EFI applications of the boot process are measured into.
+	pcrBootStages = 4
+	// pcrLinuxLoad2 is the PCR the kernel command line and initrd are measured into by the Linux EFI stub.
+	pcrLinuxLoad2 = 9
+	// pcrUKISections is the PCR the sections of the unified kernel image are measured into by systemd-stub.
+	pcrUKISections = 11
+
+	// Tagged event IDs used by the Linux EFI stub.
+	// See https://github.com/torvalds/linux/blob/v6.9/drivers/firmware/efi/libstub/efistub.h
+	linuxInitrdEventTagID      = 0x8F3B22EC
+	linuxLoadOptionsEventTagID = 0x8F3B22ED
+)
+
+// Static reports whether the event has the same digest on every boot of every image.
+// A static event can't be the cause of an unexpected PCR value.
+func (e Event) Static() bool {
+	switch e.Type {
+	case EVNoAction:
+		return true
+	case EVSeparator:
+		return bytes.Equal(e.Digest, sliceOf(measure.EVSeparatorPCR256()))
+	case EVEFIAction:
+		return bytes.Equal(e.Digest, sliceOf(measure.EVEFIActionPCR256()))
+	default:
+		return false
+	}
+}
+
+// Describe returns a description for each of the events.
+// Events of the Constellation boot chain are described in the same way
+// as by the measured boot precalculation of the OS image build.
+func Describe(events []Event) []string {
+	var bootStage, ukiSection int
+	descriptions := make([]string, len(events))
+	for i, event := range events {
+		switch {
+		case event.Type == EVEFIAction && event.Static():
+			descriptions[i] = measure.EVEFIActionDescription
+		case event.Type == EVSeparator:
+			descriptions[i] = measure.EVSeparatorDescription
+		case event.Type == EVEFIBootServicesApplication && event.PCR == pcrBootStages:
+			bootStage++
+			descriptions[i] = measure.BootStageDescription(bootStage, bootStageName(bootStage))
+		case event.Type == EVEventTag && event.PCR == pcrLinuxLoad2:
+			descriptions[i] = describeLinuxLoad2(event)
+		case event.Type == EVIPL && event.PCR == pcrUKISections:
+			name := decodeString(event.Data)
+			if bytes.Equal(event.Digest, sliceOf(sha256.Sum256([]byte(name+"\x00")))) {
+				ukiSection++
+				descriptions[i] = measure.UKISectionNameDescription(ukiSection, name)
+			} else {
+				descriptions[i] = measure.UKISectionDataDescription(ukiSection, [32]byte(event.Digest))
+			}
+		case isEFIVariableEvent(event.Type):
+			descriptions[i] = fmt.Sprintf("%s: %s", event.Type, efiVariableName(event.Data))
+		default:
+			descriptions[i] = event.Type.String()
+			if data := decodeString(event.Data); data != "" {
+				descriptions[i] += ": " + data
+			}
+		}
+	}
+	return descriptions
+}
+
+// bootStageName returns the name of the boot stage in the Constellation boot chain.
+func bootStageName(stage int) string {
+	switch stage {
+	case 1:
+		return measure.UKIBootStageName
+	case 2:
+		return measure.LinuxBootStageName
+	default:
+		return "EFI application"
+	}
+}
+
+// describeLinuxLoad2 describes the tagged events of the Linux EFI stub.
+// The event log only contains the digest of the kernel command line, not the command line itself.
+func describeLinuxLoad2(event Event) string {
+	if len(event.Data) >= 4 {
+		switch binary.LittleEndian.Uint32(event.Data) {
+		case linuxInitrdEventTagID:
+			return measure.LinuxLoad2InitrdDescription([32]byte(event.Digest))
+		case linuxLoadOptionsEventTagID:
+			return fmt.Sprintf("EV_EVENT_TAG: Linux LOAD_FILE2 protocol: cmdline (digest %x)", event.Digest)
+		}
+	}
+	return EVEventTag.String()
+}
+
+func isEFIVariableEvent(t EventType) bool {
+	switch t {
+	case EVEFIVariableDriverConfig, EVEFIVariableBoot, EVEFIVariableBoot2, EVEFIVariableAuthority:
+		return true
+	default:
+		return false
+	}
+}
+
+// efiVariableName returns the name of the variable of an UEFI_VARIABLE_DATA structure.
+func efiVariableName(data []byte) string {
+	// VariableName (GUID, 16 bytes) || UnicodeNameLength (8 bytes) || VariableDataLength (8 bytes) || UnicodeName
+	const nameOffset = 32
+	if len(data) < nameOffset {
+		return "unknown variable"
+	}
+	nameLen := binary.LittleEndian.Uint64(data[16:24])
+	if nameLen > uint64(len(data)-nameOffset)/2 {
+		return "unknown variable"
+	}
+	return decodeUTF16(data[nameOffset : nameOffset+2*nameLen])
+}
+
+// decodeString decodes event data holding a human readable string, encoded as UTF-16 or ASCII.
+// It returns an empty string if the data is not printable.
+func decodeString(data []byte) string {
+	var s string
+	if len(data) >= 2 && len(data)%2 == 0 && data[1] == 0 {
+		s = decodeUTF16(data)
+	} else {
+		s = string(data)
+	}
+	s = strings.TrimRight(s, "\x00")
+	for _, r := range s {
+		if !unicode.IsPrint(r) {
+			return ""
+		}
+	}
+	return s
+}
+
+func decodeUTF16(data []byte) string {
+	u16 := make([]uint16, len(data)/2)
+	for i := range u16 {
+		u16[i] = binary.LittleEndian.Uint16(data[2*i:])
+	}
+	return strings.TrimRight(string(utf16.Decode(u16)), "\x00")
+}
+
+func sliceOf(digest [32]byte) []byte {
+	return digest[:]
+}
@@ -0,0 +1,115 @@
+/*
+Copyright (c) Edgeless Systems GmbH
+
+SPDX-License-Identifier: BUSL-1.1
+*/
+
+package eventlog
+
+import (
+	"crypto/sha256"
+	"encoding/binary"
+	"fmt"
+	"testing"
+	"unicode/utf16"
+
+	"github.com/edgelesssys/constellation/v2/image/measured-boot/measure"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestDescribe(t *testing.T) {
+	efiAction := measure.EVEFIActionPCR256()
+	separator := measure.EVSeparatorPCR256()
+	linuxName := sha256.Sum256([]byte(".linux\x00"))
+
+	events := []Event{
+		{PCR: 4, Type: EVEFIAction, Digest: efiAction[:], Data: []byte("Calling EFI Application from Boot Option")},
+		{PCR: 4, Type: EVSeparator, Digest: separator[:], Data: []byte{0, 0, 0, 0}},
+		{PCR: 4, Type: EVEFIBootServicesApplication, Digest: digest("uki")},
+		{PCR: 4, Type: EVEFIBootServicesApplication, Digest: digest("linux")},
+		{PCR: 9, Type: EVEventTag, Digest: digest("cmdline"), Data: taggedEvent(linuxLoadOptionsEventTagID, "LOADED_IMAGE::LoadOptions")},
+		{PCR: 9, Type: EVEventTag, Digest: digest("initrd"), Data: taggedEvent(linuxInitrdEventTagID, "Linux initrd")},
+		{PCR: 11, Type: EVIPL, Digest: linuxName[:], Data: utf16String(".linux")},
+		{PCR: 11, Type: EVIPL, Digest: digest("kernel"), Data: utf16String(".linux")},
+		{PCR: 7, Type: EVEFIVariableDriverConfig, Digest: digest("secure boot"), Data: efiVariable("SecureBoot")},
+		{PCR: 0, Type: EVSCRTMVersion, Digest: digest("version"), Data: utf16String("1.0")},
+		{PCR: 2, Type: EVEFIBootServicesDriver, Digest: digest("driver"), Data: []byte{0x01, 0x02, 0xff}},
+	}
+
+	assert.Equal(t, []string{
+		"EV_EFI_ACTION: Calling EFI Application from Boot Option",
+		"EV_SEPARATOR",
+		"Boot Stage 1: Unified Kernel Image (UKI)",
+		"Boot Stage 2: Linux",
+		"EV_EVENT_TAG: Linux LOAD_FILE2 protocol: cmdline (digest " + hexDigest("cmdline") + ")",
+		"EV_EVENT_TAG: Linux LOAD_FILE2 protocol: initrd (digest " + hexDigest("initrd") + ")",
+		"EV_IPL: UKI section 1 name: .linux",
+		"EV_IPL: UKI section 1 data: " + hexDigest("kernel"),
+		"EV_EFI_VARIABLE_DRIVER_CONFIG: SecureBoot",
+		"EV_S_CRTM_VERSION: 1.0",
+		"EV_EFI_BOOT_SERVICES_DRIVER",
+	}, Describe(events))
+}
+
+func TestStatic(t *testing.T) {
+	efiAction := measure.EVEFIActionPCR256()
+	separator := measure.EVSeparatorPCR256()
+
+	testCases := map[string]struct {
+		event      Event
+		wantStatic bool
+	}{
+		"EV_EFI_ACTION": {
+			event:      Event{Type: EVEFIAction, Digest: efiAction[:]},
+			wantStatic: true,
+		},
+		"EV_SEPARATOR": {
+			event:      Event{Type: EVSeparator, Digest: separator[:]},
+			wantStatic: true,
+		},
+		"EV_SEPARATOR signaling an error": {
+			event: Event{Type: EVSeparator, Digest: digest("\xff\xff\xff\xff")},
+		},
+		"EV_EFI_BOOT_SERVICES_APPLICATION": {
+			event: Event{Type: EVEFIBootServicesApplication, Digest: efiAction[:]},
+		},
+	}
+
+	for name, tc := range testCases {
+		t.Run(name, func(t *testing.T) {
+			assert.Equal(t, tc.wantStatic, tc.event.Static())
+		})
+	}
+}
+
+func TestEventTypeString(t *testing.T) {
+	assert := assert.New(t)
+	assert.Equal("EV_EFI_BOOT_SERVICES_APPLICATION", EVEFIBootServicesApplication.String())
+	assert.Equal("EV_UNKNOWN(0x0000abcd)", EventType(0xabcd).String())
+}
+
+func taggedEvent(id uint32, data string) []byte {
+	event := binary.LittleEndian.AppendUint32(nil, id)
+	event = binary.LittleEndian.AppendUint32(event, uint32(len(data)))
+	return append(event, data...)
+}
+
+func utf16String(s string) []byte {
+	var data []byte
+	for _, r := range utf16.Encode([]rune(s + "\x00")) {
+		data = binary.LittleEndian.AppendUint16(data, r)
+	}
+	return data
+}
+
+func efiVariable(name string) []byte {
+	data := make([]byte, 16) // variable GUID
+	data = binary.LittleEndian.AppendUint64(data, uint64(len(name)))
+	data = binary.LittleEndian.AppendUint64(data, 1)
+	data = append(data, utf16String(name)[:2*len(name)]...)
+	return append(data, 0x01)
+}
+
+func hexDigest(s string) string {
+	return fmt.Sprintf("%x", digest(s))
+}
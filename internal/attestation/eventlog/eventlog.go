@@ -0,0 +1,250 @@
+/*
+Copyright (c) Edgeless Systems GmbH
+
+SPDX-License-Identifier: BUSL-1.1
+*/
+
+/*
+Package eventlog parses and replays TCG PC Client event logs.
+
+The firmware and the boot loaders record every PCR extension of the measured boot in the event log.
+Replaying the log against the PCR values of a TPM quote proves that the log is complete,
+and the individual events explain which boot component caused a PCR value.
+
+Only the crypto agile log format is supported, and only the SHA-256 PCR bank is replayed.
+See the [TCG PC Client Platform Firmware Profile Specification], Section 10.
+
+[TCG PC Client Platform Firmware Profile Specification]: https://trustedcomputinggroup.org/resource/pc-client-specific-platform-firmware-profile-specification/
+*/
+package eventlog
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"sort"
+)
+
+const (
+	// algSHA256 is the TPM algorithm ID of SHA-256.
+	algSHA256 = 0x000B
+	// maxEventDataSize limits the size of a single event, to not allocate arbitrary memory for corrupted logs.
+	maxEventDataSize = 1 << 24
+)
+
+var (
+	// specIDEventSignature is the signature of the first event of a crypto agile event log.
+	specIDEventSignature = []byte("Spec ID Event03\x00")
+	// startupLocalitySignature is the signature of the EV_NO_ACTION event recording the locality of TPM2_Startup.
+	startupLocalitySignature = []byte("StartupLocality\x00")
+)
+
+// Event is an event of the event log, with its SHA-256 digest.
+type Event struct {
+	// Sequence is the position of the event in the event log. The spec ID event at the start of the log has sequence 0.
+	Sequence int
+	// PCR is the index of the PCR extended by the event.
+	PCR uint32
+	// Type is the event type.
+	Type EventType
+	// Digest is the SHA-256 digest extended into the PCR.
+	Digest []byte
+	// Data is the event data. Depending on the event type, it contains the measured data or a description of it.
+	Data []byte
+}
+
+// Parse parses a crypto agile TCG PC Client event log, e.g. read from /sys/kernel/security/tpm0/binary_bios_measurements.
+// The returned events include the EV_NO_ACTION events, which are not extended into the PCRs.
+func Parse(raw []byte) ([]Event, error) {
+	r := bytes.NewReader(raw)
+
+	// The first event uses the SHA-1 log format and describes the digest sizes of all following events.
+	var header struct {
+		PCR    uint32
+		Type   uint32
+		Digest [20]byte
+	}
+	if err := binary.Read(r, binary.LittleEndian, &header); err != nil {
+		return nil, fmt.Errorf("reading spec ID event: %w", err)
+	}
+	specID, err := readEventData(r)
+	if err != nil {
+		return nil, fmt.Errorf("reading spec ID event: %w", err)
+	}
+	if EventType(header.Type) != EVNoAction || !bytes.HasPrefix(specID, specIDEventSignature) {
+		return nil, errors.New("event log is not in crypto agile format")
+	}
+	digestSizes, err := parseSpecIDEvent(specID)
+	if err != nil {
+		return nil, fmt.Errorf("parsing spec ID event: %w", err)
+	}
+
+	var events []Event
+	for sequence := 1; r.Len() > 0; sequence++ {
+		event, err := readEvent(r, digestSizes)
+		if err != nil {
+			return nil, fmt.Errorf("reading event %d: %w", sequence, err)
+		}
+		event.Sequence = sequence
+		events = append(events, event)
+	}
+	return events, nil
+}
+
+// Replay replays the events and returns the resulting SHA-256 PCR values.
+// Only PCRs extended by at least one event are returned.
+func Replay(events []Event) map[uint32][]byte {
+	pcrs := make(map[uint32][]byte)
+	for _, event := range events {
+		if event.Type == EVNoAction {
+			// A locality other than 0 is encoded in the initial value of PCR[0].
+			if locality, ok := event.startupLocality(); ok {
+				initial := make([]byte, sha256.Size)
+				initial[sha256.Size-1] = locality
+				pcrs[event.PCR] = initial
+			}
+			continue
+		}
+
+		old, ok := pcrs[event.PCR]
+		if !ok {
+			old = make([]byte, sha256.Size)
+		}
+		extended := sha256.Sum256(append(old, event.Digest...))
+		pcrs[event.PCR] = extended[:]
+	}
+	return pcrs
+}
+
+// Verify replays the events and checks that the resulting PCR values match the given SHA-256 PCR values, e.g. those of a TPM quote.
+// PCRs not extended by any event are not checked, since they may be extended after boot.
+func Verify(events []Event, pcrs map[uint32][]byte) error {
+	replayed := Replay(events)
+
+	var errs []error
+	for _, idx := range sortedPCRs(replayed) {
+		quoted, ok := pcrs[idx]
+		if !ok {
+			continue
+		}
+		if !bytes.Equal(replayed[idx], quoted) {
+			errs = append(errs, fmt.Errorf("PCR[%d]: replayed value %x does not match quoted value %x", idx, replayed[idx], quoted))
+		}
+	}
+	if len(errs) > 0 {
+		return fmt.Errorf("event log does not match PCR values:\n%w", errors.Join(errs...))
+	}
+	return nil
+}
+
+// startupLocality returns the locality recorded by a StartupLocality event.
+func (e Event) startupLocality() (byte, bool) {
+	if e.Type != EVNoAction || e.PCR != 0 || len(e.Data) != len(startupLocalitySignature)+1 {
+		return 0, false
+	}
+	if !bytes.HasPrefix(e.Data, startupLocalitySignature) {
+		return 0, false
+	}
+	return e.Data[len(startupLocalitySignature)], true
+}
+
+// parseSpecIDEvent returns the digest size of each algorithm listed in the TCG_EfiSpecIDEvent.
+func parseSpecIDEvent(data []byte) (map[uint16]uint16, error) {
+	r := bytes.NewReader(data[len(specIDEventSignature):])
+	var info struct {
+		PlatformClass    uint32
+		SpecVersionMinor uint8
+		SpecVersionMajor uint8
+		SpecErrata       uint8
+		UintnSize        uint8
+		NumAlgorithms    uint32
+	}
+	if err := binary.Read(r, binary.LittleEndian, &info); err != nil {
+		return nil, err
+	}
+
+	digestSizes := make(map[uint16]uint16)
+	for i := uint32(0); i < info.NumAlgorithms; i++ {
+		var alg struct {
+			ID         uint16
+			DigestSize uint16
+		}
+		if err := binary.Read(r, binary.LittleEndian, &alg); err != nil {
+			return nil, err
+		}
+		digestSizes[alg.ID] = alg.DigestSize
+	}
+	if digestSizes[algSHA256] != sha256.Size {
+		return nil, errors.New("event log does not contain SHA-256 digests")
+	}
+	return digestSizes, nil
+}
+
+// readEvent reads a TCG_PCR_EVENT2 structure.
+func readEvent(r *bytes.Reader, digestSizes map[uint16]uint16) (Event, error) {
+	var header struct {
+		PCR         uint32
+		Type        uint32
+		DigestCount uint32
+	}
+	if err := binary.Read(r, binary.LittleEndian, &header); err != nil {
+		return Event{}, err
+	}
+
+	event := Event{PCR: header.PCR, Type: EventType(header.Type)}
+	for i := uint32(0); i < header.DigestCount; i++ {
+		var alg uint16
+		if err := binary.Read(r, binary.LittleEndian, &alg); err != nil {
+			return Event{}, err
+		}
+		size, ok := digestSizes[alg]
+		if !ok {
+			return Event{}, fmt.Errorf("unknown digest algorithm 0x%04x", alg)
+		}
+		digest := make([]byte, size)
+		if _, err := io.ReadFull(r, digest); err != nil {
+			return Event{}, err
+		}
+		if alg == algSHA256 {
+			event.Digest = digest
+		}
+	}
+	if event.Digest == nil {
+		return Event{}, errors.New("event has no SHA-256 digest")
+	}
+
+	data, err := readEventData(r)
+	if err != nil {
+		return Event{}, err
+	}
+	event.Data = data
+	return event, nil
+}
+
+// readEventData reads the size prefixed event data.
+func readEventData(r *bytes.Reader) ([]byte, error) {
+	var size uint32
+	if err := binary.Read(r, binary.LittleEndian, &size); err != nil {
+		return nil, err
+	}
+	if size > maxEventDataSize || int64(size) > int64(r.Len()) {
+		return nil, fmt.Errorf("invalid event data size %d", size)
+	}
+	data := make([]byte, size)
+	if _, err := io.ReadFull(r, data); err != nil {
+		return nil, err
+	}
+	return data, nil
+}
+
+func sortedPCRs(pcrs map[uint32][]byte) []uint32 {
+	var idxs []uint32
+	for idx := range pcrs {
+		idxs = append(idxs, idx)
+	}
+	sort.Slice(idxs, func(i, j int) bool { return idxs[i] < idxs[j] })
+	return idxs
+}
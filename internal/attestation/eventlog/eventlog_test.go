@@ -0,0 +1,193 @@
+/*
+Copyright (c) Edgeless Systems GmbH
+
+SPDX-License-Identifier: BUSL-1.1
+*/
+
+package eventlog
+
+import (
+	"bytes"
+	"crypto/sha1"
+	"crypto/sha256"
+	"encoding/binary"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.uber.org/goleak"
+)
+
+func TestMain(m *testing.M) {
+	goleak.VerifyTestMain(m)
+}
+
+func TestParse(t *testing.T) {
+	events := []Event{
+		{PCR: 0, Type: EVNoAction, Digest: make([]byte, 32), Data: append([]byte("StartupLocality\x00"), 3)},
+		{PCR: 0, Type: EVSCRTMVersion, Digest: digest("version"), Data: []byte("1.0\x00")},
+		{PCR: 4, Type: EVEFIAction, Digest: digest("Calling EFI Application from Boot Option"), Data: []byte("Calling EFI Application from Boot Option")},
+	}
+
+	testCases := map[string]struct {
+		raw        []byte
+		wantEvents []Event
+		wantErr    bool
+	}{
+		"valid log": {
+			raw: newLog(t, events...),
+			wantEvents: []Event{
+				{Sequence: 1, PCR: 0, Type: EVNoAction, Digest: make([]byte, 32), Data: append([]byte("StartupLocality\x00"), 3)},
+				{Sequence: 2, PCR: 0, Type: EVSCRTMVersion, Digest: digest("version"), Data: []byte("1.0\x00")},
+				{Sequence: 3, PCR: 4, Type: EVEFIAction, Digest: digest("Calling EFI Application from Boot Option"), Data: []byte("Calling EFI Application from Boot Option")},
+			},
+		},
+		"log without events": {
+			raw: newLog(t),
+		},
+		"empty log": {
+			raw:     []byte{},
+			wantErr: true,
+		},
+		"SHA-1 log": {
+			raw: func() []byte {
+				raw := newLog(t, events...)
+				copy(raw[32:], "Spec ID Event00")
+				return raw
+			}(),
+			wantErr: true,
+		},
+		"truncated log": {
+			raw: func() []byte {
+				raw := newLog(t, events...)
+				return raw[:len(raw)-5]
+			}(),
+			wantErr: true,
+		},
+	}
+
+	for name, tc := range testCases {
+		t.Run(name, func(t *testing.T) {
+			assert := assert.New(t)
+
+			events, err := Parse(tc.raw)
+			if tc.wantErr {
+				assert.Error(err)
+				return
+			}
+			assert.NoError(err)
+			assert.Equal(tc.wantEvents, events)
+		})
+	}
+}
+
+func TestReplay(t *testing.T) {
+	assert := assert.New(t)
+
+	events := []Event{
+		{PCR: 0, Type: EVNoAction, Data: append([]byte("StartupLocality\x00"), 3)},
+		{PCR: 0, Type: EVSCRTMVersion, Digest: digest("version")},
+		{PCR: 4, Type: EVNoAction, Digest: make([]byte, 32)},
+		{PCR: 4, Type: EVEFIAction, Digest: digest("action")},
+		{PCR: 4, Type: EVSeparator, Digest: digest("separator")},
+	}
+
+	locality := make([]byte, 32)
+	locality[31] = 3
+	wantPCR0 := extend(locality, digest("version"))
+	wantPCR4 := extend(extend(make([]byte, 32), digest("action")), digest("separator"))
+
+	pcrs := Replay(events)
+	assert.Equal(map[uint32][]byte{0: wantPCR0, 4: wantPCR4}, pcrs)
+}
+
+func TestVerify(t *testing.T) {
+	events := []Event{
+		{PCR: 4, Type: EVEFIAction, Digest: digest("action")},
+		{PCR: 9, Type: EVEventTag, Digest: digest("initrd")},
+	}
+	pcr4 := extend(make([]byte, 32), digest("action"))
+	pcr9 := extend(make([]byte, 32), digest("initrd"))
+
+	testCases := map[string]struct {
+		pcrs    map[uint32][]byte
+		wantErr bool
+	}{
+		"all PCRs match": {
+			pcrs: map[uint32][]byte{4: pcr4, 9: pcr9},
+		},
+		"PCRs without events are ignored": {
+			pcrs: map[uint32][]byte{4: pcr4, 9: pcr9, 15: digest("cluster ID")},
+		},
+		"PCRs not in quote are ignored": {
+			pcrs: map[uint32][]byte{4: pcr4},
+		},
+		"PCR mismatch": {
+			pcrs:    map[uint32][]byte{4: pcr4, 9: pcr4},
+			wantErr: true,
+		},
+	}
+
+	for name, tc := range testCases {
+		t.Run(name, func(t *testing.T) {
+			err := Verify(events, tc.pcrs)
+			if tc.wantErr {
+				assert.Error(t, err)
+			} else {
+				assert.NoError(t, err)
+			}
+		})
+	}
+}
+
+// newLog serializes a crypto agile event log with SHA-1 and SHA-256 digests.
+func newLog(t *testing.T, events ...Event) []byte {
+	t.Helper()
+	require := require.New(t)
+
+	specID := &bytes.Buffer{}
+	specID.WriteString("Spec ID Event03\x00")
+	require.NoError(binary.Write(specID, binary.LittleEndian, struct {
+		PlatformClass uint32
+		Minor, Major  uint8
+		Errata, Uintn uint8
+		NumAlgorithms uint32
+		SHA1ID        uint16
+		SHA1Size      uint16
+		SHA256ID      uint16
+		SHA256Size    uint16
+		VendorInfo    uint8
+	}{Major: 2, Uintn: 2, NumAlgorithms: 2, SHA1ID: 0x0004, SHA1Size: sha1.Size, SHA256ID: 0x000B, SHA256Size: sha256.Size}))
+
+	log := &bytes.Buffer{}
+	require.NoError(binary.Write(log, binary.LittleEndian, struct {
+		PCR, Type uint32
+		Digest    [20]byte
+		Size      uint32
+	}{Type: uint32(EVNoAction), Size: uint32(specID.Len())}))
+	log.Write(specID.Bytes())
+
+	for _, event := range events {
+		sha1Digest := sha1.Sum(event.Digest)
+		require.NoError(binary.Write(log, binary.LittleEndian, struct {
+			PCR, Type, Count uint32
+			SHA1ID           uint16
+			SHA1             [20]byte
+			SHA256ID         uint16
+		}{PCR: event.PCR, Type: uint32(event.Type), Count: 2, SHA1ID: 0x0004, SHA1: sha1Digest, SHA256ID: 0x000B}))
+		log.Write(event.Digest)
+		require.NoError(binary.Write(log, binary.LittleEndian, uint32(len(event.Data))))
+		log.Write(event.Data)
+	}
+	return log.Bytes()
+}
+
+func digest(s string) []byte {
+	d := sha256.Sum256([]byte(s))
+	return d[:]
+}
+
+func extend(pcr, digest []byte) []byte {
+	extended := sha256.Sum256(append(append([]byte{}, pcr...), digest...))
+	return extended[:]
+}
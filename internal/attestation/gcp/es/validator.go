@@ -32,14 +32,16 @@ func NewValidator(cfg *config.GCPSEVES, log attestation.Logger) (*Validator, err
 		return nil, fmt.Errorf("create trusted key getter: %v", err)
 	}
 
-	return &Validator{
+	v := &Validator{
 		Validator: vtpm.NewValidator(
 			cfg.Measurements,
 			getTrustedKey,
 			validateCVM,
 			log,
 		),
-	}, nil
+	}
+	v.SetPolicy(cfg.Policy, nil)
+	return v, nil
 }
 
 // validateCVM checks that the machine state represents a GCE AMD-SEV VM.
@@ -15,6 +15,7 @@ import (
 
 	"github.com/edgelesssys/constellation/v2/internal/attestation"
 	"github.com/edgelesssys/constellation/v2/internal/attestation/gcp"
+	"github.com/edgelesssys/constellation/v2/internal/attestation/policy"
 	"github.com/edgelesssys/constellation/v2/internal/attestation/snp"
 	"github.com/edgelesssys/constellation/v2/internal/attestation/variant"
 	"github.com/edgelesssys/constellation/v2/internal/attestation/vtpm"
@@ -50,11 +51,19 @@ func NewValidator(cfg *config.GCPSEVSNP, log attestation.Logger) (*Validator, er
 		return nil, fmt.Errorf("creating trusted key getter: %w", err)
 	}
 
+	getter := trust.DefaultHTTPSGetter()
 	v := &Validator{
-		cfg:             cfg,
-		reportValidator: &gcpValidator{httpsGetter: trust.DefaultHTTPSGetter(), verifier: &reportVerifierImpl{}, validator: &reportValidatorImpl{}},
-		gceKeyGetter:    getGCEKey,
-		log:             log,
+		cfg: cfg,
+		reportValidator: &gcpValidator{
+			httpsGetter: getter,
+			verifier:    &reportVerifierImpl{},
+			validator:   &reportValidatorImpl{},
+			revocationChecker: snp.NewRevocationChecker(
+				(*x509.RevocationList)(&cfg.AMDCRL), abi.VcekReportSigner, cfg.RequireCRL, getter, log,
+			),
+		},
+		gceKeyGetter: getGCEKey,
+		log:          log,
 	}
 
 	v.Validator = vtpm.NewValidator(
@@ -63,6 +72,9 @@ func NewValidator(cfg *config.GCPSEVSNP, log attestation.Logger) (*Validator, er
 		func(_ vtpm.AttestationDocument, _ *attest.MachineState) error { return nil },
 		log,
 	)
+	v.SetPolicy(cfg.Policy, func(attDoc vtpm.AttestationDocument) (policy.Claims, error) {
+		return snp.PolicyClaims(attDoc.InstanceInfo)
+	})
 	return v, nil
 }
 
@@ -94,14 +106,18 @@ type snpReportValidator interface {
 // gcpValidator implements the validation for GCP SEV-SNP attestation.
 // The properties exist for unittesting.
 type gcpValidator struct {
-	verifier    reportVerifier
-	validator   reportValidator
-	httpsGetter trust.HTTPSGetter
+	verifier          reportVerifier
+	validator         reportValidator
+	revocationChecker revocationChecker
+	httpsGetter       trust.HTTPSGetter
 }
 
 type reportVerifier interface {
 	SnpAttestation(att *sevsnp.Attestation, opts *verify.Options) error
 }
+type revocationChecker interface {
+	CheckCertificateChain(chain *sevsnp.CertificateChain, ark *x509.Certificate) error
+}
 type reportValidator interface {
 	SnpAttestation(att *sevsnp.Attestation, opts *validate.Options) error
 }
@@ -119,7 +135,7 @@ func (r *reportVerifierImpl) SnpAttestation(att *sevsnp.Attestation, opts *verif
 }
 
 // validate the report by checking if it has a valid VCEK signature.
-// The certificate chain ARK -> ASK -> VCEK is also validated.
+// The certificate chain ARK -> ASK -> VCEK is also validated and checked for revoked certificates.
 // Checks that the report's userData matches the connection's userData.
 func (a *gcpValidator) validate(attestation vtpm.AttestationDocument, ask *x509.Certificate, ark *x509.Certificate, reportData [64]byte, config *config.GCPSEVSNP, log attestation.Logger) error {
 	var info snp.InstanceInfo
@@ -143,6 +159,10 @@ func (a *gcpValidator) validate(attestation vtpm.AttestationDocument, ask *x509.
 		return fmt.Errorf("verifying SNP attestation: %w", err)
 	}
 
+	if err := a.revocationChecker.CheckCertificateChain(att.CertificateChain, ark); err != nil {
+		return fmt.Errorf("checking SNP certificate revocation: %w", err)
+	}
+
 	validateOpts := &validate.Options{
 		// Check that the attestation key's digest is included in the report.
 		ReportData: reportData[:],
@@ -17,6 +17,8 @@ import (
 	"bytes"
 	"context"
 	"crypto/sha256"
+	"crypto/sha512"
+	"encoding/base64"
 	"encoding/hex"
 	"encoding/json"
 	"errors"
@@ -24,12 +26,14 @@ import (
 	"io"
 	"net/http"
 	"net/url"
+	"slices"
 	"sort"
 	"strconv"
 	"strings"
 
 	"github.com/edgelesssys/constellation/v2/internal/attestation/variant"
 	"github.com/edgelesssys/constellation/v2/internal/cloud/cloudprovider"
+	"github.com/edgelesssys/constellation/v2/internal/encoding"
 	"github.com/google/go-tpm/tpmutil"
 	"github.com/siderolabs/talos/pkg/machinery/config/encoder"
 	"gopkg.in/yaml.v3"
@@ -211,6 +215,7 @@ func (m *M) Copy() M {
 
 // EqualTo tests whether the provided other Measurements are equal to these
 // measurements.
+// The allowed values of other images are not compared, since they are added and pruned by the cluster during image upgrades.
 func (m *M) EqualTo(other M) bool {
 	if len(*m) != len(other) {
 		return false
@@ -230,7 +235,46 @@ func (m *M) EqualTo(other M) bool {
 // Compare compares the expected measurements to the given list of measurements.
 // It returns a list of warnings for non matching measurements for WarnOnly entries,
 // and a list of errors for non matching measurements for Enforce entries.
+//
+// The measurements are compared as a whole: they must either all match the expected values,
+// or all match the values of one of the allowed images. Measurements of different images are never mixed.
+// If no image matches, the result of the image closest to the given measurements is returned.
 func (m M) Compare(other map[uint32][]byte) (warnings []string, errs []error) {
+	warnings, errs = m.compareImage(other, "")
+	for _, image := range m.allowedImages() {
+		if len(errs) == 0 {
+			break
+		}
+		imageWarnings, imageErrs := m.compareImage(other, image)
+		if len(imageErrs) < len(errs) {
+			warnings, errs = imageWarnings, imageErrs
+		}
+	}
+	return warnings, errs
+}
+
+// MatchingImage returns the image all given measurements belong to.
+// An empty image means the measurements match the expected values.
+// It returns false if the measurements don't belong to a single image.
+func (m M) MatchingImage(other map[uint32][]byte) (string, bool) {
+	for _, image := range append([]string{""}, m.allowedImages()...) {
+		matches := true
+		for idx, measurement := range m {
+			if !measurement.MatchesImage(other[idx], image) {
+				matches = false
+				break
+			}
+		}
+		if matches {
+			return image, true
+		}
+	}
+	return "", false
+}
+
+// compareImage compares the measurements of an image to the given list of measurements.
+// An empty image compares the expected values.
+func (m M) compareImage(other map[uint32][]byte, image string) (warnings []string, errs []error) {
 	// Get list of indices in expected measurements
 	var mIndices []uint32
 	for idx := range m {
@@ -241,11 +285,14 @@ func (m M) Compare(other map[uint32][]byte) (warnings []string, errs []error) {
 	})
 
 	for _, idx := range mIndices {
-		if !bytes.Equal(m[idx].Expected, other[idx]) {
+		if !m[idx].MatchesImage(other[idx], image) {
 			msg := fmt.Sprintf("untrusted measurement value %x at index %d", other[idx], idx)
 			if len(other[idx]) == 0 {
 				msg = fmt.Sprintf("missing measurement value for index %d", idx)
 			}
+			if image != "" {
+				msg += fmt.Sprintf(" for image %s", image)
+			}
 
 			if m[idx].ValidationOpt == Enforce {
 				errs = append(errs, errors.New(msg))
@@ -258,6 +305,147 @@ func (m M) Compare(other map[uint32][]byte) (warnings []string, errs []error) {
 	return warnings, errs
 }
 
+// allowedImages returns the sorted images that have allowed values.
+func (m M) allowedImages() []string {
+	var images []string
+	for _, measurement := range m {
+		for _, allowed := range measurement.Allowed {
+			if !slices.Contains(images, allowed.Image) {
+				images = append(images, allowed.Image)
+			}
+		}
+	}
+	slices.Sort(images)
+	return images
+}
+
+// AllowPrevious adds the values of the previous measurements to the allowed values of m.
+// The expected values of previous are allowed for the given image, which is the image the previous measurements belong to.
+// If image is empty, only the allowed values of previous are carried over.
+// Values that are already accepted by m are not added.
+func (m M) AllowPrevious(image string, previous M) {
+	for idx, measurement := range m {
+		prev, ok := previous[idx]
+		if !ok {
+			continue
+		}
+		measurement.Allowed = slices.Clone(measurement.Allowed)
+		candidates := prev.Allowed
+		if image != "" {
+			candidates = append([]ImageValue{{Image: image, Value: prev.Expected}}, candidates...)
+		}
+		for _, candidate := range candidates {
+			// Images without an allowed value use the expected value, see [Measurement.MatchesImage].
+			if len(candidate.Value) != len(measurement.Expected) || bytes.Equal(candidate.Value, measurement.Expected) ||
+				slices.ContainsFunc(measurement.Allowed, func(v ImageValue) bool { return v.Image == candidate.Image }) {
+				continue
+			}
+			measurement.Allowed = append(measurement.Allowed, candidate)
+		}
+		m[idx] = measurement
+	}
+}
+
+// PruneAllowed removes the allowed values of all images for which expired returns true.
+// It returns true if any value was removed.
+func (m M) PruneAllowed(expired func(image string) bool) bool {
+	var pruned bool
+	for idx, measurement := range m {
+		var allowed []ImageValue
+		for _, value := range measurement.Allowed {
+			if expired(value.Image) {
+				pruned = true
+				continue
+			}
+			allowed = append(allowed, value)
+		}
+		measurement.Allowed = allowed
+		m[idx] = measurement
+	}
+	return pruned
+}
+
+// UpdateInitMeasurements sets the expected values of the owner and cluster ID measurements depending on the attestation variant.
+// The IDs are hex or base64 encoded. Measurements of empty IDs are removed.
+func (m M) UpdateInitMeasurements(attestationVariant variant.Variant, ownerID, clusterID string) error {
+	switch attestationVariant {
+	case variant.AWSNitroTPM{}, variant.AWSSEVSNP{},
+		variant.AzureTrustedLaunch{}, variant.AzureSEVSNP{}, variant.AzureTDX{}, // AzureTDX also uses a vTPM for measurements
+		variant.GCPSEVES{}, variant.GCPSEVSNP{},
+		variant.QEMUVTPM{}:
+		if err := m.updateMeasurementTPM(uint32(PCRIndexOwnerID), ownerID); err != nil {
+			return err
+		}
+		return m.updateMeasurementTPM(uint32(PCRIndexClusterID), clusterID)
+	case variant.QEMUTDX{}:
+		// Measuring ownerID is currently not implemented for Constellation
+		// Since adding support for measuring ownerID to TDX would require additional code changes,
+		// the current implementation does not support it, but can be changed if we decide to add support in the future
+		return m.updateMeasurementTDX(uint32(TDXIndexClusterID), clusterID)
+	default:
+		return errors.New("selecting attestation variant: unknown attestation variant")
+	}
+}
+
+// updateMeasurementTDX updates the expected TDX measurement value for the given measurement index.
+func (m M) updateMeasurementTDX(measurementIdx uint32, encoded string) error {
+	if encoded == "" {
+		delete(m, measurementIdx)
+		return nil
+	}
+	decoded, err := decodeMeasurement(encoded)
+	if err != nil {
+		return err
+	}
+
+	// new_measurement_value := hash(old_measurement_value || data_to_extend)
+	// Since we use the DG.MR.RTMR.EXTEND call to extend the register, data_to_extend is the hash of our input
+	hashedInput := sha512.Sum384(decoded)
+	oldExpected := m[measurementIdx].Expected
+	expectedMeasurementSum := sha512.Sum384(append(oldExpected[:], hashedInput[:]...))
+	m[measurementIdx] = Measurement{
+		Expected:      expectedMeasurementSum[:],
+		ValidationOpt: m[measurementIdx].ValidationOpt,
+	}
+	return nil
+}
+
+// updateMeasurementTPM updates the expected TPM measurement value for the given measurement index.
+func (m M) updateMeasurementTPM(measurementIdx uint32, encoded string) error {
+	if encoded == "" {
+		delete(m, measurementIdx)
+		return nil
+	}
+	decoded, err := decodeMeasurement(encoded)
+	if err != nil {
+		return err
+	}
+
+	// new_pcr_value := hash(old_pcr_value || data_to_extend)
+	// Since we use the TPM2_PCR_Event call to extend the PCR, data_to_extend is the hash of our input
+	hashedInput := sha256.Sum256(decoded)
+	oldExpected := m[measurementIdx].Expected
+	expectedMeasurement := sha256.Sum256(append(oldExpected[:], hashedInput[:]...))
+	m[measurementIdx] = Measurement{
+		Expected:      expectedMeasurement[:],
+		ValidationOpt: m[measurementIdx].ValidationOpt,
+	}
+	return nil
+}
+
+// decodeMeasurement is a utility function that decodes the given string as hex or base64.
+func decodeMeasurement(encoded string) ([]byte, error) {
+	decoded, err := hex.DecodeString(encoded)
+	if err != nil {
+		hexErr := err
+		decoded, err = base64.StdEncoding.DecodeString(encoded)
+		if err != nil {
+			return nil, fmt.Errorf("input [%s] could neither be hex decoded (%w) nor base64 decoded (%w)", encoded, hexErr, err)
+		}
+	}
+	return decoded, nil
+}
+
 // GetEnforced returns a list of all enforced Measurements,
 // i.e. all Measurements that are not marked as WarnOnly.
 func (m *M) GetEnforced() []uint32 {
@@ -280,6 +468,7 @@ func (m *M) SetEnforced(enforced []uint32) error {
 		newM[idx] = Measurement{
 			Expected:      measurement.Expected,
 			ValidationOpt: WarnOnly,
+			Allowed:       measurement.Allowed,
 		}
 	}
 
@@ -390,6 +579,30 @@ type Measurement struct {
 	Expected []byte `json:"expected" yaml:"expected"`
 	// ValidationOpt indicates how measurement mismatches should be handled.
 	ValidationOpt MeasurementValidationOption `json:"warnOnly" yaml:"warnOnly"`
+	// Allowed are further accepted values of the measurement, each belonging to a specific image.
+	// They allow nodes using another image than the one of Expected to join the cluster, e.g., during an image upgrade.
+	Allowed []ImageValue `json:"allowed,omitempty" yaml:"allowed,omitempty"`
+}
+
+// ImageValue is an accepted measurement value of a specific image.
+type ImageValue struct {
+	// Image is the version of the image the value belongs to.
+	Image string `json:"image" yaml:"image"`
+	// Value is the measurement value of the image.
+	Value encoding.HexBytes `json:"value" yaml:"value"`
+}
+
+// MatchesImage returns true if the given value is the value of the measurement for the given image.
+// Images without an allowed value of the measurement use the expected value, like an empty image.
+func (m Measurement) MatchesImage(value []byte, image string) bool {
+	if image != "" {
+		for _, allowed := range m.Allowed {
+			if allowed.Image == image {
+				return bytes.Equal(allowed.Value, value)
+			}
+		}
+	}
+	return bytes.Equal(m.Expected, value)
 }
 
 // MeasurementValidationOption indicates how measurement mismatches should be handled.
@@ -428,6 +641,7 @@ func (m Measurement) MarshalJSON() ([]byte, error) {
 	return json.Marshal(encodedMeasurement{
 		Expected: hex.EncodeToString(m.Expected[:]),
 		WarnOnly: m.ValidationOpt,
+		Allowed:  m.Allowed,
 	})
 }
 
@@ -457,6 +671,7 @@ func (m Measurement) MarshalYAML() (any, error) {
 	return encodedMeasurement{
 		Expected: hex.EncodeToString(m.Expected[:]),
 		WarnOnly: m.ValidationOpt,
+		Allowed:  m.Allowed,
 	}, nil
 }
 
@@ -470,9 +685,15 @@ func (m *Measurement) unmarshal(eM encodedMeasurement) error {
 	if len(expected) != 32 && len(expected) != 48 {
 		return fmt.Errorf("invalid measurement: invalid length: %d", len(expected))
 	}
+	for _, allowed := range eM.Allowed {
+		if len(allowed.Value) != len(expected) {
+			return fmt.Errorf("invalid allowed measurement for image %q: expected length %d, got %d", allowed.Image, len(expected), len(allowed.Value))
+		}
+	}
 
 	m.Expected = expected
 	m.ValidationOpt = eM.WarnOnly
+	m.Allowed = eM.Allowed
 
 	return nil
 }
@@ -548,6 +769,7 @@ func checkLength(m map[uint32]Measurement) error {
 type encodedMeasurement struct {
 	Expected string                      `json:"expected" yaml:"expected"`
 	WarnOnly MeasurementValidationOption `json:"warnOnly" yaml:"warnOnly"`
+	Allowed  []ImageValue                `json:"allowed,omitempty" yaml:"allowed,omitempty"`
 }
 
 // mYamlContent is the Content of a yaml.Node encoding of an M. It implements sort.Interface.
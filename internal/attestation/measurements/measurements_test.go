@@ -8,6 +8,9 @@ package measurements
 
 import (
 	"bytes"
+	"crypto/sha256"
+	"crypto/sha512"
+	"encoding/base64"
 	"encoding/json"
 	"io"
 	"net/http"
@@ -116,6 +119,21 @@ func TestUnmarshal(t *testing.T) {
 				},
 			},
 		},
+		"allowed values of other images": {
+			inputYAML: "2:\n expected: \"0000000000000000000000000000000000000000000000000000000000000000\"\n allowed:\n  - image: v2.16.0\n    value: \"0101010101010101010101010101010101010101010101010101010101010101\"",
+			inputJSON: `{"2":{"expected":"0000000000000000000000000000000000000000000000000000000000000000","allowed":[{"image":"v2.16.0","value":"0101010101010101010101010101010101010101010101010101010101010101"}]}}`,
+			wantMeasurements: M{
+				2: {
+					Expected: bytes.Repeat([]byte{0x00}, 32),
+					Allowed:  []ImageValue{{Image: "v2.16.0", Value: bytes.Repeat([]byte{0x01}, 32)}},
+				},
+			},
+		},
+		"allowed value of invalid length": {
+			inputYAML: "2:\n expected: \"0000000000000000000000000000000000000000000000000000000000000000\"\n allowed:\n  - image: v2.16.0\n    value: \"0101\"",
+			inputJSON: `{"2":{"expected":"0000000000000000000000000000000000000000000000000000000000000000","allowed":[{"image":"v2.16.0","value":"0101"}]}}`,
+			wantErr:   true,
+		},
 		"invalid base64": {
 			inputYAML: "2:\n expected: \"This is not base64\"\n3:\n expected: \"AQIDBAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAA=\"",
 			inputJSON: `{"2":{"expected":"This is not base64"},"3":{"expected":"AQIDBAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAA="}}`,
@@ -1017,6 +1035,56 @@ func TestMeasurementsCompare(t *testing.T) {
 			wantErrs:     1,
 			wantWarnings: 0,
 		},
+		"measurements of an allowed image are accepted": {
+			expected: multiImageMeasurements,
+			actual: map[uint32][]byte{
+				0: bytes.Repeat([]byte{0x00}, PCRMeasurementLength),
+				1: bytes.Repeat([]byte{0xBB}, PCRMeasurementLength),
+				2: bytes.Repeat([]byte{0x22}, PCRMeasurementLength),
+			},
+			wantErrs:     0,
+			wantWarnings: 0,
+		},
+		"measurements of an allowed image with its own values for every index are accepted": {
+			expected: multiImageMeasurements,
+			actual: map[uint32][]byte{
+				0: bytes.Repeat([]byte{0x00}, PCRMeasurementLength),
+				1: bytes.Repeat([]byte{0xAA}, PCRMeasurementLength),
+				2: bytes.Repeat([]byte{0xAB}, PCRMeasurementLength),
+			},
+			wantErrs:     0,
+			wantWarnings: 0,
+		},
+		"measurements mixing images are rejected": {
+			expected: multiImageMeasurements,
+			actual: map[uint32][]byte{
+				0: bytes.Repeat([]byte{0x00}, PCRMeasurementLength),
+				1: bytes.Repeat([]byte{0xAA}, PCRMeasurementLength),
+				2: bytes.Repeat([]byte{0x22}, PCRMeasurementLength),
+			},
+			wantErrs:     1,
+			wantWarnings: 0,
+		},
+		"measurements mixing allowed images are rejected": {
+			expected: multiImageMeasurements,
+			actual: map[uint32][]byte{
+				0: bytes.Repeat([]byte{0x00}, PCRMeasurementLength),
+				1: bytes.Repeat([]byte{0xBB}, PCRMeasurementLength),
+				2: bytes.Repeat([]byte{0xAB}, PCRMeasurementLength),
+			},
+			wantErrs:     1,
+			wantWarnings: 0,
+		},
+		"mismatches of the closest image are reported": {
+			expected: multiImageMeasurements,
+			actual: map[uint32][]byte{
+				0: bytes.Repeat([]byte{0x00}, PCRMeasurementLength),
+				1: bytes.Repeat([]byte{0xBB}, PCRMeasurementLength),
+				2: bytes.Repeat([]byte{0xFF}, PCRMeasurementLength),
+			},
+			wantErrs:     1,
+			wantWarnings: 0,
+		},
 		"missing measurements cause warnings": {
 			expected: M{
 				0: WithAllBytes(0x00, Enforce, PCRMeasurementLength),
@@ -1042,3 +1110,395 @@ func TestMeasurementsCompare(t *testing.T) {
 		})
 	}
 }
+
+// multiImageMeasurements allow the measurements of the images v2.15.0 and v2.16.0 next to the expected values.
+// v2.15.0 uses the expected value for index 2.
+var multiImageMeasurements = M{
+	0: WithAllBytes(0x00, Enforce, PCRMeasurementLength),
+	1: {
+		Expected: bytes.Repeat([]byte{0x11}, PCRMeasurementLength),
+		Allowed: []ImageValue{
+			{Image: "v2.16.0", Value: bytes.Repeat([]byte{0xAA}, PCRMeasurementLength)},
+			{Image: "v2.15.0", Value: bytes.Repeat([]byte{0xBB}, PCRMeasurementLength)},
+		},
+	},
+	2: {
+		Expected: bytes.Repeat([]byte{0x22}, PCRMeasurementLength),
+		Allowed:  []ImageValue{{Image: "v2.16.0", Value: bytes.Repeat([]byte{0xAB}, PCRMeasurementLength)}},
+	},
+}
+
+func TestMatchingImage(t *testing.T) {
+	testCases := map[string]struct {
+		actual    map[uint32][]byte
+		wantImage string
+		wantOK    bool
+	}{
+		"expected values": {
+			actual: map[uint32][]byte{
+				0: bytes.Repeat([]byte{0x00}, PCRMeasurementLength),
+				1: bytes.Repeat([]byte{0x11}, PCRMeasurementLength),
+				2: bytes.Repeat([]byte{0x22}, PCRMeasurementLength),
+			},
+			wantOK: true,
+		},
+		"allowed image": {
+			actual: map[uint32][]byte{
+				0: bytes.Repeat([]byte{0x00}, PCRMeasurementLength),
+				1: bytes.Repeat([]byte{0xBB}, PCRMeasurementLength),
+				2: bytes.Repeat([]byte{0x22}, PCRMeasurementLength),
+			},
+			wantImage: "v2.15.0",
+			wantOK:    true,
+		},
+		"mixed images": {
+			actual: map[uint32][]byte{
+				0: bytes.Repeat([]byte{0x00}, PCRMeasurementLength),
+				1: bytes.Repeat([]byte{0xBB}, PCRMeasurementLength),
+				2: bytes.Repeat([]byte{0xAB}, PCRMeasurementLength),
+			},
+		},
+	}
+
+	for name, tc := range testCases {
+		t.Run(name, func(t *testing.T) {
+			assert := assert.New(t)
+
+			image, ok := multiImageMeasurements.MatchingImage(tc.actual)
+			assert.Equal(tc.wantOK, ok)
+			assert.Equal(tc.wantImage, image)
+		})
+	}
+}
+
+func TestAllowPrevious(t *testing.T) {
+	testCases := map[string]struct {
+		current  M
+		image    string
+		previous M
+		want     M
+	}{
+		"changed values are allowed for the previous image": {
+			current: M{
+				0: WithAllBytes(0x00, Enforce, PCRMeasurementLength),
+				1: WithAllBytes(0x11, WarnOnly, PCRMeasurementLength),
+			},
+			image: "v2.16.0",
+			previous: M{
+				0: WithAllBytes(0x00, Enforce, PCRMeasurementLength),
+				1: WithAllBytes(0xAA, Enforce, PCRMeasurementLength),
+			},
+			want: M{
+				0: WithAllBytes(0x00, Enforce, PCRMeasurementLength),
+				1: {
+					Expected:      bytes.Repeat([]byte{0x11}, PCRMeasurementLength),
+					ValidationOpt: WarnOnly,
+					Allowed:       []ImageValue{{Image: "v2.16.0", Value: bytes.Repeat([]byte{0xAA}, PCRMeasurementLength)}},
+				},
+			},
+		},
+		"allowed values are carried over": {
+			current: M{
+				0: WithAllBytes(0x00, Enforce, PCRMeasurementLength),
+			},
+			image: "v2.16.0",
+			previous: M{
+				0: {
+					Expected: bytes.Repeat([]byte{0xAA}, PCRMeasurementLength),
+					Allowed: []ImageValue{
+						{Image: "v2.15.0", Value: bytes.Repeat([]byte{0xBB}, PCRMeasurementLength)},
+						{Image: "v2.17.0", Value: bytes.Repeat([]byte{0x00}, PCRMeasurementLength)},
+					},
+				},
+			},
+			want: M{
+				0: {
+					Expected: bytes.Repeat([]byte{0x00}, PCRMeasurementLength),
+					Allowed: []ImageValue{
+						{Image: "v2.16.0", Value: bytes.Repeat([]byte{0xAA}, PCRMeasurementLength)},
+						{Image: "v2.15.0", Value: bytes.Repeat([]byte{0xBB}, PCRMeasurementLength)},
+					},
+				},
+			},
+		},
+		"values of another image are allowed for the previous image": {
+			current: M{
+				0: {
+					Expected: bytes.Repeat([]byte{0x00}, PCRMeasurementLength),
+					Allowed:  []ImageValue{{Image: "v2.17.0", Value: bytes.Repeat([]byte{0xAA}, PCRMeasurementLength)}},
+				},
+			},
+			image: "v2.16.0",
+			previous: M{
+				0: WithAllBytes(0xAA, Enforce, PCRMeasurementLength),
+			},
+			want: M{
+				0: {
+					Expected: bytes.Repeat([]byte{0x00}, PCRMeasurementLength),
+					Allowed: []ImageValue{
+						{Image: "v2.17.0", Value: bytes.Repeat([]byte{0xAA}, PCRMeasurementLength)},
+						{Image: "v2.16.0", Value: bytes.Repeat([]byte{0xAA}, PCRMeasurementLength)},
+					},
+				},
+			},
+		},
+		"no image only carries over allowed values": {
+			current: M{
+				0: WithAllBytes(0x00, Enforce, PCRMeasurementLength),
+			},
+			previous: M{
+				0: {
+					Expected: bytes.Repeat([]byte{0xAA}, PCRMeasurementLength),
+					Allowed:  []ImageValue{{Image: "v2.15.0", Value: bytes.Repeat([]byte{0xBB}, PCRMeasurementLength)}},
+				},
+			},
+			want: M{
+				0: {
+					Expected: bytes.Repeat([]byte{0x00}, PCRMeasurementLength),
+					Allowed:  []ImageValue{{Image: "v2.15.0", Value: bytes.Repeat([]byte{0xBB}, PCRMeasurementLength)}},
+				},
+			},
+		},
+		"removed and mismatching measurements are ignored": {
+			current: M{
+				0: WithAllBytes(0x00, Enforce, TDXMeasurementLength),
+			},
+			image: "v2.16.0",
+			previous: M{
+				0: WithAllBytes(0xAA, Enforce, PCRMeasurementLength),
+				1: WithAllBytes(0xBB, Enforce, PCRMeasurementLength),
+			},
+			want: M{
+				0: WithAllBytes(0x00, Enforce, TDXMeasurementLength),
+			},
+		},
+	}
+
+	for name, tc := range testCases {
+		t.Run(name, func(t *testing.T) {
+			tc.current.AllowPrevious(tc.image, tc.previous)
+			assert.Equal(t, tc.want, tc.current)
+		})
+	}
+}
+
+func TestPruneAllowed(t *testing.T) {
+	assert := assert.New(t)
+
+	m := M{
+		0: WithAllBytes(0x00, Enforce, PCRMeasurementLength),
+		1: {
+			Expected: bytes.Repeat([]byte{0x11}, PCRMeasurementLength),
+			Allowed: []ImageValue{
+				{Image: "v2.15.0", Value: bytes.Repeat([]byte{0xAA}, PCRMeasurementLength)},
+				{Image: "v2.17.0", Value: bytes.Repeat([]byte{0xBB}, PCRMeasurementLength)},
+			},
+		},
+	}
+	expired := func(image string) bool { return image == "v2.15.0" }
+
+	assert.True(m.PruneAllowed(expired))
+	assert.Equal(M{
+		0: WithAllBytes(0x00, Enforce, PCRMeasurementLength),
+		1: {
+			Expected: bytes.Repeat([]byte{0x11}, PCRMeasurementLength),
+			Allowed:  []ImageValue{{Image: "v2.17.0", Value: bytes.Repeat([]byte{0xBB}, PCRMeasurementLength)}},
+		},
+	}, m)
+
+	assert.False(m.PruneAllowed(expired))
+}
+
+func TestUpdateInitMeasurements(t *testing.T) {
+	zero := WithAllBytes(0x00, WarnOnly, PCRMeasurementLength)
+	one := WithAllBytes(0x11, WarnOnly, PCRMeasurementLength)
+	one64 := base64.StdEncoding.EncodeToString(one.Expected[:])
+	oneHash := sha256.Sum256(one.Expected[:])
+	pcrZeroUpdatedOne := sha256.Sum256(append(zero.Expected[:], oneHash[:]...))
+	newTestPCRs := func() M {
+		return M{
+			0:  WithAllBytes(0x00, WarnOnly, PCRMeasurementLength),
+			1:  WithAllBytes(0x00, WarnOnly, PCRMeasurementLength),
+			2:  WithAllBytes(0x00, WarnOnly, PCRMeasurementLength),
+			3:  WithAllBytes(0x00, WarnOnly, PCRMeasurementLength),
+			4:  WithAllBytes(0x00, WarnOnly, PCRMeasurementLength),
+			5:  WithAllBytes(0x00, WarnOnly, PCRMeasurementLength),
+			6:  WithAllBytes(0x00, WarnOnly, PCRMeasurementLength),
+			7:  WithAllBytes(0x00, WarnOnly, PCRMeasurementLength),
+			8:  WithAllBytes(0x00, WarnOnly, PCRMeasurementLength),
+			9:  WithAllBytes(0x00, WarnOnly, PCRMeasurementLength),
+			10: WithAllBytes(0x00, WarnOnly, PCRMeasurementLength),
+			11: WithAllBytes(0x00, WarnOnly, PCRMeasurementLength),
+			12: WithAllBytes(0x00, WarnOnly, PCRMeasurementLength),
+			13: WithAllBytes(0x00, WarnOnly, PCRMeasurementLength),
+			14: WithAllBytes(0x00, WarnOnly, PCRMeasurementLength),
+			15: WithAllBytes(0x00, WarnOnly, PCRMeasurementLength),
+			16: WithAllBytes(0x00, WarnOnly, PCRMeasurementLength),
+			17: WithAllBytes(0x11, WarnOnly, PCRMeasurementLength),
+			18: WithAllBytes(0x11, WarnOnly, PCRMeasurementLength),
+			19: WithAllBytes(0x11, WarnOnly, PCRMeasurementLength),
+			20: WithAllBytes(0x11, WarnOnly, PCRMeasurementLength),
+			21: WithAllBytes(0x11, WarnOnly, PCRMeasurementLength),
+			22: WithAllBytes(0x11, WarnOnly, PCRMeasurementLength),
+			23: WithAllBytes(0x00, WarnOnly, PCRMeasurementLength),
+		}
+	}
+
+	testCases := map[string]struct {
+		variant   variant.Variant
+		ownerID   string
+		clusterID string
+		wantErr   bool
+	}{
+		"gcp update owner ID": {
+			variant: variant.GCPSEVES{},
+			ownerID: one64,
+		},
+		"gcp update cluster ID": {
+			variant:   variant.GCPSEVES{},
+			clusterID: one64,
+		},
+		"gcp update both": {
+			variant:   variant.GCPSEVES{},
+			ownerID:   one64,
+			clusterID: one64,
+		},
+		"azure update owner ID": {
+			variant: variant.AzureSEVSNP{},
+			ownerID: one64,
+		},
+		"azure update cluster ID": {
+			variant:   variant.AzureSEVSNP{},
+			clusterID: one64,
+		},
+		"azure update both": {
+			variant:   variant.AzureSEVSNP{},
+			ownerID:   one64,
+			clusterID: one64,
+		},
+		"owner ID and cluster ID empty": {
+			variant: variant.AzureSEVSNP{},
+		},
+		"invalid encoding": {
+			variant: variant.GCPSEVES{},
+			ownerID: "invalid",
+			wantErr: true,
+		},
+		"unknown attestation variant": {
+			variant: variant.Dummy{},
+			ownerID: one64,
+			wantErr: true,
+		},
+	}
+
+	for name, tc := range testCases {
+		t.Run(name, func(t *testing.T) {
+			assert := assert.New(t)
+
+			m := newTestPCRs()
+			err := m.UpdateInitMeasurements(tc.variant, tc.ownerID, tc.clusterID)
+
+			if tc.wantErr {
+				assert.Error(err)
+				return
+			}
+			require.NoError(t, err)
+			for i := 0; i < len(m); i++ {
+				switch {
+				case i == int(PCRIndexClusterID) && tc.clusterID == "":
+					// should be deleted
+					_, ok := m[uint32(i)]
+					assert.False(ok)
+
+				case i == int(PCRIndexClusterID):
+					pcr, ok := m[uint32(i)]
+					assert.True(ok)
+					assert.Equal(pcrZeroUpdatedOne[:], pcr.Expected)
+
+				case i == int(PCRIndexOwnerID) && tc.ownerID == "":
+					// should be deleted
+					_, ok := m[uint32(i)]
+					assert.False(ok)
+
+				case i == int(PCRIndexOwnerID):
+					pcr, ok := m[uint32(i)]
+					assert.True(ok)
+					assert.Equal(pcrZeroUpdatedOne[:], pcr.Expected)
+
+				default:
+					if i >= 17 && i <= 22 {
+						assert.Equal(one, m[uint32(i)])
+					} else {
+						assert.Equal(zero, m[uint32(i)])
+					}
+				}
+			}
+		})
+	}
+}
+
+func TestUpdateInitMeasurementsTDX(t *testing.T) {
+	zero := WithAllBytes(0x00, true, TDXMeasurementLength)
+	one := WithAllBytes(0x11, true, TDXMeasurementLength)
+	one64 := base64.StdEncoding.EncodeToString(one.Expected[:])
+	oneHash := sha512.Sum384(one.Expected[:])
+	tdxZeroUpdatedOne := sha512.Sum384(append(zero.Expected[:], oneHash[:]...))
+	newTestTDXMeasurements := func() M {
+		return M{
+			0: WithAllBytes(0x00, true, TDXMeasurementLength),
+			1: WithAllBytes(0x00, true, TDXMeasurementLength),
+			2: WithAllBytes(0x00, true, TDXMeasurementLength),
+			3: WithAllBytes(0x00, true, TDXMeasurementLength),
+			4: WithAllBytes(0x00, true, TDXMeasurementLength),
+		}
+	}
+
+	testCases := map[string]struct {
+		measurements M
+		clusterID    string
+		wantErr      bool
+	}{
+		"QEMUT TDX update update cluster ID": {
+			measurements: newTestTDXMeasurements(),
+			clusterID:    one64,
+		},
+		"cluster ID empty": {
+			measurements: newTestTDXMeasurements(),
+		},
+		"invalid encoding": {
+			measurements: newTestTDXMeasurements(),
+			clusterID:    "invalid",
+			wantErr:      true,
+		},
+	}
+
+	for name, tc := range testCases {
+		t.Run(name, func(t *testing.T) {
+			assert := assert.New(t)
+
+			err := tc.measurements.UpdateInitMeasurements(variant.QEMUTDX{}, "", tc.clusterID)
+
+			if tc.wantErr {
+				assert.Error(err)
+				return
+			}
+			assert.NoError(err)
+			for i := 0; i < len(tc.measurements); i++ {
+				switch {
+				case i == TDXIndexClusterID && tc.clusterID == "":
+					// should be deleted
+					_, ok := tc.measurements[uint32(i)]
+					assert.False(ok)
+
+				case i == TDXIndexClusterID:
+					pcr, ok := tc.measurements[uint32(i)]
+					assert.True(ok)
+					assert.Equal(tdxZeroUpdatedOne[:], pcr.Expected)
+
+				default:
+					assert.Equal(zero, tc.measurements[uint32(i)])
+				}
+			}
+		})
+	}
+}
@@ -0,0 +1,328 @@
+/*
+Copyright (c) Edgeless Systems GmbH
+
+SPDX-License-Identifier: BUSL-1.1
+*/
+
+package policy
+
+import (
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"time"
+
+	"github.com/edgelesssys/constellation/v2/internal/encoding"
+)
+
+// Claims are the validated properties of an attestation, over which the policy is evaluated.
+type Claims struct {
+	// PCRs are the quoted PCR values, available as pcrs.
+	PCRs map[uint32][]byte
+	// SNP are the claims of the SEV-SNP attestation report, available as snp.
+	SNP *SNPClaims
+	// TDX are the claims of the TDX quote, available as tdx.
+	TDX *TDXClaims
+}
+
+// SNPClaims are the claims of an SEV-SNP attestation report.
+// The name of the claim in the CEL environment is given in parentheses.
+type SNPClaims struct {
+	// Version of the attestation report (version).
+	Version uint32
+	// GuestSVN is the security version number of the guest (guestSvn).
+	GuestSVN uint32
+	// Policy is the guest policy (policy).
+	// The individual fields of the guest policy are available as policyFlags.abiMinor, policyFlags.abiMajor,
+	// policyFlags.smt, policyFlags.migrateMa, policyFlags.debug and policyFlags.singleSocket.
+	Policy uint64
+	// FamilyID is the family ID provided at launch (familyId).
+	FamilyID []byte
+	// ImageID is the image ID provided at launch (imageId).
+	ImageID []byte
+	// VMPL is the virtual machine privilege level of the report request (vmpl).
+	VMPL uint32
+	// PlatformInfo describes the enabled features of the platform (platformInfo).
+	PlatformInfo uint64
+	// CurrentTCB is the current TCB version of the platform (currentTcb).
+	CurrentTCB TCB
+	// ReportedTCB is the TCB version used to derive the report signing key (reportedTcb).
+	ReportedTCB TCB
+	// CommittedTCB is the committed TCB version of the platform (committedTcb).
+	CommittedTCB TCB
+	// LaunchTCB is the TCB version at the time the guest was launched (launchTcb).
+	LaunchTCB TCB
+	// Measurement is the launch measurement of the guest (measurement).
+	Measurement []byte
+	// HostData is the data provided by the hypervisor at launch (hostData).
+	HostData []byte
+	// IDKeyDigest is the digest of the ID key that signed the ID block (idKeyDigest).
+	IDKeyDigest []byte
+	// AuthorKeyDigest is the digest of the author key that signed the ID key (authorKeyDigest).
+	AuthorKeyDigest []byte
+	// ReportData is the data provided by the guest in the report request (reportData).
+	ReportData []byte
+	// ChipID is the identifier of the processor (chipId).
+	ChipID []byte
+}
+
+// TCB are the security patch levels of an SEV-SNP TCB version.
+// The claims are available as bootloader, tee, snp and microcode.
+type TCB struct {
+	Bootloader uint8 `json:"bootloader"`
+	TEE        uint8 `json:"tee"`
+	SNP        uint8 `json:"snp"`
+	Microcode  uint8 `json:"microcode"`
+}
+
+// TDXClaims are the claims of a TDX quote.
+// The name of the claim in the CEL environment is given in parentheses.
+type TDXClaims struct {
+	// TEETCBSVN is the security version number of the TDX module (teeTcbSvn).
+	TEETCBSVN []byte
+	// MRSeam is the measurement of the TDX module (mrSeam).
+	MRSeam []byte
+	// TDAttributes are the attributes of the trust domain (tdAttributes).
+	TDAttributes []byte
+	// XFAM is the extended features available mask of the trust domain (xfam).
+	XFAM []byte
+	// MRTD is the initial measurement of the trust domain (mrTd).
+	MRTD []byte
+	// MRConfigID is the software defined ID of the trust domain configuration (mrConfigId).
+	MRConfigID []byte
+	// MROwner is the software defined ID of the trust domain owner (mrOwner).
+	MROwner []byte
+	// MROwnerConfig is the software defined ID of the owner defined configuration (mrOwnerConfig).
+	MROwnerConfig []byte
+	// RTMRs are the runtime measurement registers (rtmrs).
+	RTMRs [][]byte
+	// ReportData is the data provided by the trust domain in the report request (reportData).
+	ReportData []byte
+}
+
+// Guest policy bits of an SEV-SNP attestation report.
+// See the SEV-SNP ABI specification, Section 4.3.
+const (
+	snpPolicySMTBit          = 16
+	snpPolicyMigrateMABit    = 18
+	snpPolicyDebugBit        = 19
+	snpPolicySingleSocketBit = 20
+)
+
+// activation returns the variables of the CEL environment.
+func (c Claims) activation(now time.Time) map[string]any {
+	snp := map[string]any{}
+	if c.SNP != nil {
+		snp = c.SNP.claims()
+	}
+	tdx := map[string]any{}
+	if c.TDX != nil {
+		tdx = c.TDX.claims()
+	}
+
+	return map[string]any{
+		"pcrs": c.pcrs(),
+		"snp":  snp,
+		"tdx":  tdx,
+		"now":  now,
+	}
+}
+
+// MarshalJSON encodes the claims using the names and encodings of the CEL environment.
+// Claims that aren't available are omitted.
+func (c Claims) MarshalJSON() ([]byte, error) {
+	claims := map[string]any{}
+	if len(c.PCRs) > 0 {
+		claims["pcrs"] = c.pcrs()
+	}
+	if c.SNP != nil {
+		claims["snp"] = c.SNP.claims()
+	}
+	if c.TDX != nil {
+		claims["tdx"] = c.TDX.claims()
+	}
+	return json.Marshal(claims)
+}
+
+// UnmarshalJSON decodes claims encoded by [Claims.MarshalJSON].
+func (c *Claims) UnmarshalJSON(data []byte) error {
+	var encoded struct {
+		PCRs map[uint32]encoding.HexBytes `json:"pcrs"`
+		SNP  json.RawMessage              `json:"snp"`
+		TDX  json.RawMessage              `json:"tdx"`
+	}
+	if err := json.Unmarshal(data, &encoded); err != nil {
+		return err
+	}
+
+	*c = Claims{}
+	if len(encoded.PCRs) > 0 {
+		c.PCRs = make(map[uint32][]byte, len(encoded.PCRs))
+		for idx, value := range encoded.PCRs {
+			c.PCRs[idx] = value
+		}
+	}
+	if encoded.SNP != nil {
+		c.SNP = &SNPClaims{}
+		if err := c.SNP.unmarshal(encoded.SNP); err != nil {
+			return fmt.Errorf("decoding SNP claims: %w", err)
+		}
+	}
+	if encoded.TDX != nil {
+		c.TDX = &TDXClaims{}
+		if err := c.TDX.unmarshal(encoded.TDX); err != nil {
+			return fmt.Errorf("decoding TDX claims: %w", err)
+		}
+	}
+	return nil
+}
+
+func (c Claims) pcrs() map[int64]string {
+	pcrs := make(map[int64]string, len(c.PCRs))
+	for idx, value := range c.PCRs {
+		pcrs[int64(idx)] = hex.EncodeToString(value)
+	}
+	return pcrs
+}
+
+func (c *SNPClaims) claims() map[string]any {
+	claims := map[string]any{
+		"version":  int64(c.Version),
+		"guestSvn": int64(c.GuestSVN),
+		"policy":   int64(c.Policy),
+		"policyFlags": map[string]any{
+			"abiMinor":     int64(c.Policy & 0xff),
+			"abiMajor":     int64((c.Policy >> 8) & 0xff),
+			"smt":          c.Policy&(1<<snpPolicySMTBit) != 0,
+			"migrateMa":    c.Policy&(1<<snpPolicyMigrateMABit) != 0,
+			"debug":        c.Policy&(1<<snpPolicyDebugBit) != 0,
+			"singleSocket": c.Policy&(1<<snpPolicySingleSocketBit) != 0,
+		},
+		"vmpl":         int64(c.VMPL),
+		"platformInfo": int64(c.PlatformInfo),
+		"currentTcb":   c.CurrentTCB.claims(),
+		"reportedTcb":  c.ReportedTCB.claims(),
+		"committedTcb": c.CommittedTCB.claims(),
+		"launchTcb":    c.LaunchTCB.claims(),
+	}
+	addHexClaims(claims, c.hexClaims())
+	return claims
+}
+
+func (c *SNPClaims) hexClaims() map[string]*[]byte {
+	return map[string]*[]byte{
+		"familyId":        &c.FamilyID,
+		"imageId":         &c.ImageID,
+		"measurement":     &c.Measurement,
+		"hostData":        &c.HostData,
+		"idKeyDigest":     &c.IDKeyDigest,
+		"authorKeyDigest": &c.AuthorKeyDigest,
+		"reportData":      &c.ReportData,
+		"chipId":          &c.ChipID,
+	}
+}
+
+func (c *SNPClaims) unmarshal(data []byte) error {
+	var encoded struct {
+		Version      uint32 `json:"version"`
+		GuestSVN     uint32 `json:"guestSvn"`
+		Policy       uint64 `json:"policy"`
+		VMPL         uint32 `json:"vmpl"`
+		PlatformInfo uint64 `json:"platformInfo"`
+		CurrentTCB   TCB    `json:"currentTcb"`
+		ReportedTCB  TCB    `json:"reportedTcb"`
+		CommittedTCB TCB    `json:"committedTcb"`
+		LaunchTCB    TCB    `json:"launchTcb"`
+	}
+	if err := json.Unmarshal(data, &encoded); err != nil {
+		return err
+	}
+	c.Version = encoded.Version
+	c.GuestSVN = encoded.GuestSVN
+	c.Policy = encoded.Policy
+	c.VMPL = encoded.VMPL
+	c.PlatformInfo = encoded.PlatformInfo
+	c.CurrentTCB = encoded.CurrentTCB
+	c.ReportedTCB = encoded.ReportedTCB
+	c.CommittedTCB = encoded.CommittedTCB
+	c.LaunchTCB = encoded.LaunchTCB
+	return unmarshalHexClaims(data, c.hexClaims())
+}
+
+func (t TCB) claims() map[string]any {
+	return map[string]any{
+		"bootloader": int64(t.Bootloader),
+		"tee":        int64(t.TEE),
+		"snp":        int64(t.SNP),
+		"microcode":  int64(t.Microcode),
+	}
+}
+
+func (c *TDXClaims) claims() map[string]any {
+	claims := map[string]any{}
+	addHexClaims(claims, c.hexClaims())
+	if len(c.RTMRs) > 0 {
+		rtmrs := make([]string, len(c.RTMRs))
+		for i, rtmr := range c.RTMRs {
+			rtmrs[i] = hex.EncodeToString(rtmr)
+		}
+		claims["rtmrs"] = rtmrs
+	}
+	return claims
+}
+
+func (c *TDXClaims) hexClaims() map[string]*[]byte {
+	return map[string]*[]byte{
+		"teeTcbSvn":     &c.TEETCBSVN,
+		"mrSeam":        &c.MRSeam,
+		"tdAttributes":  &c.TDAttributes,
+		"xfam":          &c.XFAM,
+		"mrTd":          &c.MRTD,
+		"mrConfigId":    &c.MRConfigID,
+		"mrOwner":       &c.MROwner,
+		"mrOwnerConfig": &c.MROwnerConfig,
+		"reportData":    &c.ReportData,
+	}
+}
+
+func (c *TDXClaims) unmarshal(data []byte) error {
+	var encoded struct {
+		RTMRs []encoding.HexBytes `json:"rtmrs"`
+	}
+	if err := json.Unmarshal(data, &encoded); err != nil {
+		return err
+	}
+	for _, rtmr := range encoded.RTMRs {
+		c.RTMRs = append(c.RTMRs, rtmr)
+	}
+	return unmarshalHexClaims(data, c.hexClaims())
+}
+
+// addHexClaims adds the hex encoded values to the claims. Empty values are not added.
+func addHexClaims(claims map[string]any, values map[string]*[]byte) {
+	for name, value := range values {
+		if len(*value) > 0 {
+			claims[name] = hex.EncodeToString(*value)
+		}
+	}
+}
+
+// unmarshalHexClaims decodes the hex encoded values of the JSON encoded claims.
+func unmarshalHexClaims(data []byte, values map[string]*[]byte) error {
+	var encoded map[string]json.RawMessage
+	if err := json.Unmarshal(data, &encoded); err != nil {
+		return err
+	}
+	for name, value := range values {
+		raw, ok := encoded[name]
+		if !ok {
+			continue
+		}
+		var decoded encoding.HexBytes
+		if err := json.Unmarshal(raw, &decoded); err != nil {
+			return fmt.Errorf("decoding %s: %w", name, err)
+		}
+		*value = decoded
+	}
+	return nil
+}
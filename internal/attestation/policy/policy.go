@@ -0,0 +1,122 @@
+/*
+Copyright (c) Edgeless Systems GmbH
+
+SPDX-License-Identifier: BUSL-1.1
+*/
+
+/*
+Package policy implements attestation policies written in the Common Expression Language (CEL).
+
+An attestation policy is evaluated after the measurements of an attestation document have been validated.
+It consists of rules, each of which is a CEL expression over the claims of the attestation that must evaluate to true.
+This allows checks beyond the equality of single measurements, e.g., accepting one of multiple values for a PCR,
+or requiring a minimum microcode version only after a given date.
+
+The following variables are available to the rules:
+
+  - pcrs: map of PCR index to the hex encoded PCR value. For QEMU TDX, these are the MRTD and RTMR values, indexed as in the measurements.
+  - snp: claims of the SEV-SNP attestation report, if the attestation variant uses SEV-SNP.
+  - tdx: claims of the TDX quote, if the attestation variant uses TDX.
+  - now: the time of the validation.
+
+See [Claims] for the individual claims. Byte values are hex encoded, using lower case letters.
+Claims that aren't available for an attestation variant are absent from the maps, and can be tested with the has() macro.
+A rule that accesses an absent claim fails the validation.
+*/
+package policy
+
+import (
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/google/cel-go/cel"
+	"github.com/google/cel-go/common/types"
+)
+
+// Rule is a named CEL expression that must evaluate to true for an attestation to be accepted.
+type Rule struct {
+	// Name of the rule, used in error messages.
+	Name string `json:"name" yaml:"name"`
+	// Expression is the CEL expression of the rule.
+	Expression string `json:"expression" yaml:"expression"`
+}
+
+// Policy is a compiled attestation policy.
+type Policy struct {
+	rules []compiledRule
+	now   func() time.Time
+}
+
+type compiledRule struct {
+	name    string
+	program cel.Program
+}
+
+// New compiles the given rules into a policy.
+func New(rules []Rule) (*Policy, error) {
+	env, err := newEnv()
+	if err != nil {
+		return nil, fmt.Errorf("creating CEL environment: %w", err)
+	}
+
+	p := &Policy{now: time.Now}
+	var errs []error
+	for _, rule := range rules {
+		ast, issues := env.Compile(rule.Expression)
+		if issues.Err() != nil {
+			errs = append(errs, fmt.Errorf("compiling rule %q: %w", rule.Name, issues.Err()))
+			continue
+		}
+		if !ast.OutputType().IsAssignableType(types.BoolType) {
+			errs = append(errs, fmt.Errorf("rule %q: expression must evaluate to a bool, got %s", rule.Name, ast.OutputType()))
+			continue
+		}
+		program, err := env.Program(ast)
+		if err != nil {
+			errs = append(errs, fmt.Errorf("rule %q: %w", rule.Name, err))
+			continue
+		}
+		p.rules = append(p.rules, compiledRule{name: rule.Name, program: program})
+	}
+	if len(errs) > 0 {
+		return nil, errors.Join(errs...)
+	}
+	return p, nil
+}
+
+// Evaluate evaluates the policy over the given claims.
+// An error is returned if any of the rules doesn't evaluate to true.
+func (p *Policy) Evaluate(claims Claims) error {
+	activation := claims.activation(p.now())
+
+	var errs []error
+	for _, rule := range p.rules {
+		out, _, err := rule.program.Eval(activation)
+		if err != nil {
+			errs = append(errs, fmt.Errorf("evaluating rule %q: %w", rule.name, err))
+			continue
+		}
+		satisfied, ok := out.Value().(bool)
+		if !ok {
+			errs = append(errs, fmt.Errorf("rule %q evaluated to %v, not a bool", rule.name, out.Value()))
+			continue
+		}
+		if !satisfied {
+			errs = append(errs, fmt.Errorf("rule %q is not satisfied", rule.name))
+		}
+	}
+	if len(errs) > 0 {
+		return fmt.Errorf("attestation policy validation failed:\n%w", errors.Join(errs...))
+	}
+	return nil
+}
+
+func newEnv() (*cel.Env, error) {
+	return cel.NewEnv(
+		cel.Variable("pcrs", cel.MapType(cel.IntType, cel.StringType)),
+		cel.Variable("snp", cel.MapType(cel.StringType, cel.DynType)),
+		cel.Variable("tdx", cel.MapType(cel.StringType, cel.DynType)),
+		cel.Variable("now", cel.TimestampType),
+	)
+}
@@ -0,0 +1,240 @@
+/*
+Copyright (c) Edgeless Systems GmbH
+
+SPDX-License-Identifier: BUSL-1.1
+*/
+
+package policy
+
+import (
+	"bytes"
+	"encoding/json"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.uber.org/goleak"
+)
+
+func TestMain(m *testing.M) {
+	goleak.VerifyTestMain(m)
+}
+
+func TestNew(t *testing.T) {
+	testCases := map[string]struct {
+		rules   []Rule
+		wantErr bool
+	}{
+		"no rules": {},
+		"valid rules": {
+			rules: []Rule{
+				{Name: "pcr", Expression: `pcrs[4] in ["aa", "bb"]`},
+				{Name: "tcb", Expression: `snp.reportedTcb.microcode >= 209`},
+				{Name: "date", Expression: `now < timestamp("2025-01-01T00:00:00Z")`},
+			},
+		},
+		"syntax error": {
+			rules:   []Rule{{Name: "broken", Expression: `pcrs[4] ==`}},
+			wantErr: true,
+		},
+		"unknown variable": {
+			rules:   []Rule{{Name: "unknown", Expression: `sgx.mrEnclave == "aa"`}},
+			wantErr: true,
+		},
+		"not a bool": {
+			rules:   []Rule{{Name: "string", Expression: `pcrs[4]`}},
+			wantErr: true,
+		},
+	}
+
+	for name, tc := range testCases {
+		t.Run(name, func(t *testing.T) {
+			_, err := New(tc.rules)
+			if tc.wantErr {
+				assert.Error(t, err)
+			} else {
+				assert.NoError(t, err)
+			}
+		})
+	}
+}
+
+func TestEvaluate(t *testing.T) {
+	now := time.Date(2025, 6, 1, 0, 0, 0, 0, time.UTC)
+	snpClaims := &SNPClaims{
+		Policy:      0x30000, // SMT allowed, reserved bit set
+		ReportedTCB: TCB{Bootloader: 3, TEE: 0, SNP: 8, Microcode: 115},
+		HostData:    bytes.Repeat([]byte{0xAB}, 32),
+	}
+	pcrs := map[uint32][]byte{
+		4: bytes.Repeat([]byte{0x04}, 32),
+		9: bytes.Repeat([]byte{0x09}, 32),
+	}
+
+	testCases := map[string]struct {
+		rules   []Rule
+		claims  Claims
+		wantErr bool
+	}{
+		"PCR in allow list": {
+			rules: []Rule{{
+				Name:       "allowed kernels",
+				Expression: `pcrs[4] in ["` + hexRepeat("04") + `", "` + hexRepeat("05") + `"]`,
+			}},
+			claims: Claims{PCRs: pcrs},
+		},
+		"PCR not in allow list": {
+			rules: []Rule{{
+				Name:       "allowed kernels",
+				Expression: `pcrs[9] in ["` + hexRepeat("04") + `", "` + hexRepeat("05") + `"]`,
+			}},
+			claims:  Claims{PCRs: pcrs},
+			wantErr: true,
+		},
+		"microcode requirement not yet in effect": {
+			rules: []Rule{{
+				Name:       "microcode",
+				Expression: `now < timestamp("2025-07-01T00:00:00Z") || snp.reportedTcb.microcode >= 209`,
+			}},
+			claims: Claims{SNP: snpClaims},
+		},
+		"microcode requirement in effect": {
+			rules: []Rule{{
+				Name:       "microcode",
+				Expression: `now < timestamp("2025-05-01T00:00:00Z") || snp.reportedTcb.microcode >= 209`,
+			}},
+			claims:  Claims{SNP: snpClaims},
+			wantErr: true,
+		},
+		"host data and guest policy": {
+			rules: []Rule{
+				{Name: "host data", Expression: `snp.hostData == "` + hexRepeat("ab") + `"`},
+				{Name: "no debug", Expression: `!snp.policyFlags.debug && snp.policyFlags.smt`},
+			},
+			claims: Claims{SNP: snpClaims},
+		},
+		"all failing rules are reported": {
+			rules: []Rule{
+				{Name: "host data", Expression: `snp.hostData == "00"`},
+				{Name: "smt", Expression: `!snp.policyFlags.smt`},
+			},
+			claims:  Claims{SNP: snpClaims},
+			wantErr: true,
+		},
+		"missing claim fails": {
+			rules:   []Rule{{Name: "host data", Expression: `snp.hostData == "` + hexRepeat("ab") + `"`}},
+			claims:  Claims{PCRs: pcrs},
+			wantErr: true,
+		},
+		"missing claim tested with has": {
+			rules:  []Rule{{Name: "host data", Expression: `!has(snp.hostData) || snp.hostData == "` + hexRepeat("ab") + `"`}},
+			claims: Claims{PCRs: pcrs},
+		},
+		"TDX claims": {
+			rules: []Rule{{Name: "rtmr", Expression: `tdx.rtmrs[1] == "0102" && tdx.mrTd == "ff"`}},
+			claims: Claims{TDX: &TDXClaims{
+				MRTD:  []byte{0xFF},
+				RTMRs: [][]byte{{0x00}, {0x01, 0x02}},
+			}},
+		},
+		"no rules": {
+			claims: Claims{PCRs: pcrs},
+		},
+	}
+
+	for name, tc := range testCases {
+		t.Run(name, func(t *testing.T) {
+			assert := assert.New(t)
+			require := require.New(t)
+
+			p, err := New(tc.rules)
+			require.NoError(err)
+			p.now = func() time.Time { return now }
+
+			err = p.Evaluate(tc.claims)
+			if tc.wantErr {
+				assert.Error(err)
+			} else {
+				assert.NoError(err)
+			}
+		})
+	}
+}
+
+func TestEvaluateReportsAllRules(t *testing.T) {
+	assert := assert.New(t)
+	require := require.New(t)
+
+	p, err := New([]Rule{
+		{Name: "first", Expression: `pcrs[4] == "00"`},
+		{Name: "second", Expression: `true`},
+		{Name: "third", Expression: `pcrs[5] == "00"`},
+	})
+	require.NoError(err)
+
+	err = p.Evaluate(Claims{PCRs: map[uint32][]byte{4: {0x01}}})
+	require.Error(err)
+	assert.Contains(err.Error(), `rule "first" is not satisfied`)
+	assert.NotContains(err.Error(), `"second"`)
+	assert.Contains(err.Error(), `evaluating rule "third"`)
+}
+
+func TestClaimsJSON(t *testing.T) {
+	testCases := map[string]struct {
+		claims   Claims
+		wantJSON string
+	}{
+		"PCRs": {
+			claims:   Claims{PCRs: map[uint32][]byte{4: {0x04}, 9: {0x09}}},
+			wantJSON: `{"pcrs":{"4":"04","9":"09"}}`,
+		},
+		"SNP claims": {
+			claims: Claims{SNP: &SNPClaims{
+				Version:     2,
+				Policy:      0x30000,
+				ReportedTCB: TCB{Bootloader: 3, SNP: 8, Microcode: 115},
+				HostData:    []byte{0xAB},
+			}},
+			wantJSON: `{"snp":{
+				"version":2,"guestSvn":0,"policy":196608,"vmpl":0,"platformInfo":0,
+				"policyFlags":{"abiMinor":0,"abiMajor":0,"smt":true,"migrateMa":false,"debug":false,"singleSocket":false},
+				"currentTcb":{"bootloader":0,"tee":0,"snp":0,"microcode":0},
+				"reportedTcb":{"bootloader":3,"tee":0,"snp":8,"microcode":115},
+				"committedTcb":{"bootloader":0,"tee":0,"snp":0,"microcode":0},
+				"launchTcb":{"bootloader":0,"tee":0,"snp":0,"microcode":0},
+				"hostData":"ab"
+			}}`,
+		},
+		"TDX claims": {
+			claims: Claims{
+				PCRs: map[uint32][]byte{0: {0xFF}},
+				TDX:  &TDXClaims{MRTD: []byte{0xFF}, RTMRs: [][]byte{{0x01}, {0x02}}},
+			},
+			wantJSON: `{"pcrs":{"0":"ff"},"tdx":{"mrTd":"ff","rtmrs":["01","02"]}}`,
+		},
+		"no claims": {
+			wantJSON: `{}`,
+		},
+	}
+
+	for name, tc := range testCases {
+		t.Run(name, func(t *testing.T) {
+			assert := assert.New(t)
+			require := require.New(t)
+
+			encoded, err := json.Marshal(tc.claims)
+			require.NoError(err)
+			assert.JSONEq(tc.wantJSON, string(encoded))
+
+			var decoded Claims
+			require.NoError(json.Unmarshal(encoded, &decoded))
+			assert.Equal(tc.claims, decoded)
+		})
+	}
+}
+
+// hexRepeat returns the hex encoding of a 32 byte value consisting of the given byte.
+func hexRepeat(b string) string {
+	return string(bytes.Repeat([]byte(b), 32))
+}
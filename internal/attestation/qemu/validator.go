@@ -26,7 +26,7 @@ type Validator struct {
 
 // NewValidator initializes a new QEMU validator with the provided PCR values.
 func NewValidator(cfg *config.QEMUVTPM, log attestation.Logger) *Validator {
-	return &Validator{
+	v := &Validator{
 		Validator: vtpm.NewValidator(
 			cfg.Measurements,
 			unconditionalTrust,
@@ -34,6 +34,8 @@ func NewValidator(cfg *config.QEMUVTPM, log attestation.Logger) *Validator {
 			log,
 		),
 	}
+	v.SetPolicy(cfg.Policy, nil)
+	return v
 }
 
 // unconditionalTrust returns the given public key as the trusted attestation key.
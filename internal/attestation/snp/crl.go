@@ -0,0 +1,174 @@
+/*
+Copyright (c) Edgeless Systems GmbH
+
+SPDX-License-Identifier: BUSL-1.1
+*/
+
+package snp
+
+import (
+	"bytes"
+	"crypto/x509"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/edgelesssys/constellation/v2/internal/attestation"
+	"github.com/google/go-sev-guest/abi"
+	spb "github.com/google/go-sev-guest/proto/sevsnp"
+	"github.com/google/go-sev-guest/verify/trust"
+)
+
+// kdsBaseURL is the base URL of the AMD Key Distribution System (KDS).
+const kdsBaseURL = "https://kdsintf.amd.com"
+
+// CRLURL returns the AMD KDS URL of the certificate revocation list (CRL)
+// for the given product line and report signer (VCEK / VLEK).
+func CRLURL(productLine string, signer abi.ReportSigner) string {
+	keyType := "vcek"
+	if signer == abi.VlekReportSigner {
+		keyType = "vlek"
+	}
+	return fmt.Sprintf("%s/%s/v1/%s/crl", kdsBaseURL, keyType, productLine)
+}
+
+// VerifyCRL checks that the CRL was signed by the ARK and has not expired at the given time.
+func VerifyCRL(crl *x509.RevocationList, ark *x509.Certificate, now time.Time) error {
+	if err := crl.CheckSignatureFrom(ark); err != nil {
+		return fmt.Errorf("verifying CRL signature: %w", err)
+	}
+	if !crl.NextUpdate.IsZero() && now.After(crl.NextUpdate) {
+		return fmt.Errorf("CRL expired at %s", crl.NextUpdate.Format(time.RFC3339))
+	}
+	return nil
+}
+
+// CheckRevocation returns an error if any of the given certificates is listed in the CRL.
+// Only certificates issued by the issuer of the CRL are checked.
+// Since AMD revokes the ASK / ASVK, a revoked intermediate invalidates all VCEKs / VLEKs it signed.
+func CheckRevocation(crl *x509.RevocationList, certs ...*x509.Certificate) error {
+	for _, cert := range certs {
+		if cert == nil || !bytes.Equal(cert.RawIssuer, crl.RawIssuer) {
+			continue
+		}
+		for _, entry := range crl.RevokedCertificateEntries {
+			if entry.SerialNumber.Cmp(cert.SerialNumber) == 0 {
+				return fmt.Errorf("certificate %q (serial number %s) was revoked at %s",
+					cert.Subject.CommonName, cert.SerialNumber, entry.RevocationTime.Format(time.RFC3339))
+			}
+		}
+	}
+	return nil
+}
+
+// sharedCRLCache is the cache of all RevocationCheckers.
+// Validators may be created for a single attestation, e.g., by the verification service,
+// so the CRL must outlive the checker to avoid retrieving it from the AMD KDS for every attestation.
+var sharedCRLCache = newCRLCache()
+
+// crlCache caches CRLs retrieved from the AMD KDS by their URL.
+type crlCache struct {
+	mux  sync.Mutex
+	crls map[string]*x509.RevocationList
+}
+
+func newCRLCache() *crlCache {
+	return &crlCache{crls: make(map[string]*x509.RevocationList)}
+}
+
+// RevocationChecker checks the certificate chain of SEV-SNP attestations against the AMD certificate revocation list.
+// If no valid CRL is available, it is retrieved from the AMD KDS and cached until it expires.
+// The cache is shared by all RevocationCheckers.
+type RevocationChecker struct {
+	getter     trust.HTTPSGetter
+	url        string
+	requireCRL bool
+	log        attestation.Logger
+	now        func() time.Time
+
+	cachedCRL *x509.RevocationList
+	cache     *crlCache
+}
+
+// NewRevocationChecker returns a new RevocationChecker for the CRL of the given report signer.
+// cachedCRL, e.g. the CRL cached by the JoinService, is used as long as it is valid. It may be nil or empty.
+// If requireCRL is true, attestations are rejected if no valid CRL is available. Otherwise, a warning is logged.
+func NewRevocationChecker(cachedCRL *x509.RevocationList, signer abi.ReportSigner, requireCRL bool, getter trust.HTTPSGetter, log attestation.Logger) *RevocationChecker {
+	if cachedCRL != nil && len(cachedCRL.Raw) == 0 {
+		cachedCRL = nil
+	}
+	return &RevocationChecker{
+		getter:     getter,
+		url:        CRLURL("Milan", signer),
+		requireCRL: requireCRL,
+		log:        log,
+		now:        time.Now,
+		cachedCRL:  cachedCRL,
+		cache:      sharedCRLCache,
+	}
+}
+
+// CheckCertificateChain returns an error if the ASK / ASVK or the VCEK / VLEK of the certificate chain was revoked.
+// The CRL has to be signed by the given ARK.
+func (c *RevocationChecker) CheckCertificateChain(chain *spb.CertificateChain, ark *x509.Certificate) error {
+	var certs []*x509.Certificate
+	for _, raw := range [][]byte{chain.GetAskCert(), chain.GetVcekCert(), chain.GetVlekCert()} {
+		if len(raw) == 0 {
+			continue
+		}
+		cert, err := x509.ParseCertificate(raw)
+		if err != nil {
+			return fmt.Errorf("parsing certificate: %w", err)
+		}
+		certs = append(certs, cert)
+	}
+
+	crl, err := c.getCRL(ark)
+	if err != nil {
+		if c.requireCRL {
+			return fmt.Errorf("no valid AMD certificate revocation list available: %w", err)
+		}
+		c.log.Warn(fmt.Sprintf("Skipping SEV-SNP certificate revocation check: %s", err))
+		return nil
+	}
+
+	return CheckRevocation(crl, certs...)
+}
+
+// getCRL returns the CRL passed to the checker or the CRL in the shared cache.
+// If neither is valid, the CRL is retrieved from the AMD KDS and added to the shared cache.
+func (c *RevocationChecker) getCRL(ark *x509.Certificate) (*x509.RevocationList, error) {
+	if c.cachedCRL != nil {
+		err := VerifyCRL(c.cachedCRL, ark, c.now())
+		if err == nil {
+			return c.cachedCRL, nil
+		}
+		c.log.Info(fmt.Sprintf("Cached CRL is invalid, using shared CRL cache: %s", err))
+	}
+
+	c.cache.mux.Lock()
+	defer c.cache.mux.Unlock()
+
+	if crl, ok := c.cache.crls[c.url]; ok {
+		err := VerifyCRL(crl, ark, c.now())
+		if err == nil {
+			return crl, nil
+		}
+		c.log.Info(fmt.Sprintf("Shared CRL is invalid, retrieving CRL from AMD KDS: %s", err))
+	}
+
+	raw, err := c.getter.Get(c.url)
+	if err != nil {
+		return nil, fmt.Errorf("retrieving CRL from AMD KDS: %w", err)
+	}
+	crl, err := x509.ParseRevocationList(raw)
+	if err != nil {
+		return nil, fmt.Errorf("parsing CRL: %w", err)
+	}
+	if err := VerifyCRL(crl, ark, c.now()); err != nil {
+		return nil, err
+	}
+
+	c.cache.crls[c.url] = crl
+	return crl, nil
+}
@@ -0,0 +1,270 @@
+/*
+Copyright (c) Edgeless Systems GmbH
+
+SPDX-License-Identifier: BUSL-1.1
+*/
+
+package snp
+
+import (
+	"crypto/x509"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/edgelesssys/constellation/v2/internal/attestation/snp/testdata"
+	"github.com/edgelesssys/constellation/v2/internal/crypto"
+	"github.com/edgelesssys/constellation/v2/internal/logger"
+	"github.com/google/go-sev-guest/abi"
+	spb "github.com/google/go-sev-guest/proto/sevsnp"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestCRLURL(t *testing.T) {
+	assert := assert.New(t)
+	assert.Equal("https://kdsintf.amd.com/vcek/v1/Milan/crl", CRLURL("Milan", abi.VcekReportSigner))
+	assert.Equal("https://kdsintf.amd.com/vlek/v1/Milan/crl", CRLURL("Milan", abi.VlekReportSigner))
+}
+
+func TestRevocationChecker(t *testing.T) {
+	ark := mustParseCert(t, testdata.TestARK)
+	ask := mustParseCert(t, testdata.TestASK)
+	vcek := mustParseCert(t, testdata.TestVCEK)
+	crl := mustParseCRL(t, testdata.KDSCRL)
+	revokedCRL := mustParseCRL(t, testdata.KDSCRLRevokedASK)
+	chain := &spb.CertificateChain{AskCert: ask.Raw, VcekCert: vcek.Raw}
+	afterExpiry := crl.NextUpdate.Add(time.Hour)
+
+	testCases := map[string]struct {
+		cachedCRL    *x509.RevocationList
+		kds          *stubKDS
+		signer       abi.ReportSigner
+		requireCRL   bool
+		ark          *x509.Certificate
+		now          time.Time
+		chain        *spb.CertificateChain
+		wantRequests []string
+		wantErr      bool
+	}{
+		"cached CRL, not revoked": {
+			cachedCRL:  crl,
+			kds:        &stubKDS{},
+			requireCRL: true,
+		},
+		"cached CRL, ASK revoked": {
+			cachedCRL: revokedCRL,
+			kds:       &stubKDS{},
+			wantErr:   true,
+		},
+		"CRL retrieved from KDS": {
+			kds: &stubKDS{responses: map[string][]byte{
+				"https://kdsintf.amd.com/vcek/v1/Milan/crl": testdata.KDSCRL,
+			}},
+			requireCRL:   true,
+			wantRequests: []string{"https://kdsintf.amd.com/vcek/v1/Milan/crl"},
+		},
+		"empty cached CRL is ignored": {
+			cachedCRL: &x509.RevocationList{},
+			kds: &stubKDS{responses: map[string][]byte{
+				"https://kdsintf.amd.com/vcek/v1/Milan/crl": testdata.KDSCRL,
+			}},
+			requireCRL:   true,
+			wantRequests: []string{"https://kdsintf.amd.com/vcek/v1/Milan/crl"},
+		},
+		"VLEK CRL retrieved from KDS": {
+			kds: &stubKDS{responses: map[string][]byte{
+				"https://kdsintf.amd.com/vlek/v1/Milan/crl": testdata.KDSCRLRevokedASK,
+			}},
+			signer:       abi.VlekReportSigner,
+			chain:        &spb.CertificateChain{AskCert: ask.Raw, VlekCert: vcek.Raw},
+			wantRequests: []string{"https://kdsintf.amd.com/vlek/v1/Milan/crl"},
+			wantErr:      true,
+		},
+		"ASK revoked by CRL from KDS": {
+			kds: &stubKDS{responses: map[string][]byte{
+				"https://kdsintf.amd.com/vcek/v1/Milan/crl": testdata.KDSCRLRevokedASK,
+			}},
+			wantRequests: []string{"https://kdsintf.amd.com/vcek/v1/Milan/crl"},
+			wantErr:      true,
+		},
+		"expired cached CRL, KDS serves expired CRL": {
+			cachedCRL: crl,
+			kds: &stubKDS{responses: map[string][]byte{
+				"https://kdsintf.amd.com/vcek/v1/Milan/crl": testdata.KDSCRL,
+			}},
+			now:          afterExpiry,
+			requireCRL:   true,
+			wantRequests: []string{"https://kdsintf.amd.com/vcek/v1/Milan/crl"},
+			wantErr:      true,
+		},
+		"KDS unavailable, CRL not required": {
+			kds:          &stubKDS{err: errors.New("connection refused")},
+			wantRequests: []string{"https://kdsintf.amd.com/vcek/v1/Milan/crl"},
+		},
+		"KDS unavailable, CRL required": {
+			kds:          &stubKDS{err: errors.New("connection refused")},
+			requireCRL:   true,
+			wantRequests: []string{"https://kdsintf.amd.com/vcek/v1/Milan/crl"},
+			wantErr:      true,
+		},
+		"CRL not signed by ARK, CRL required": {
+			cachedCRL: crl,
+			kds: &stubKDS{responses: map[string][]byte{
+				"https://kdsintf.amd.com/vcek/v1/Milan/crl": testdata.KDSCRL,
+			}},
+			ark:          ask,
+			requireCRL:   true,
+			wantRequests: []string{"https://kdsintf.amd.com/vcek/v1/Milan/crl"},
+			wantErr:      true,
+		},
+		"CRL not signed by ARK, CRL not required": {
+			kds: &stubKDS{responses: map[string][]byte{
+				"https://kdsintf.amd.com/vcek/v1/Milan/crl": testdata.KDSCRLRevokedASK,
+			}},
+			ark:          ask,
+			wantRequests: []string{"https://kdsintf.amd.com/vcek/v1/Milan/crl"},
+		},
+		"invalid CRL from KDS": {
+			kds: &stubKDS{responses: map[string][]byte{
+				"https://kdsintf.amd.com/vcek/v1/Milan/crl": []byte("invalid"),
+			}},
+			requireCRL:   true,
+			wantRequests: []string{"https://kdsintf.amd.com/vcek/v1/Milan/crl"},
+			wantErr:      true,
+		},
+		"invalid certificate in chain": {
+			cachedCRL: crl,
+			kds:       &stubKDS{},
+			chain:     &spb.CertificateChain{AskCert: []byte("invalid")},
+			wantErr:   true,
+		},
+	}
+
+	for name, tc := range testCases {
+		t.Run(name, func(t *testing.T) {
+			assert := assert.New(t)
+
+			if tc.signer == abi.NoneReportSigner {
+				tc.signer = abi.VcekReportSigner
+			}
+			if tc.ark == nil {
+				tc.ark = ark
+			}
+			if tc.chain == nil {
+				tc.chain = chain
+			}
+			checker := NewRevocationChecker(tc.cachedCRL, tc.signer, tc.requireCRL, tc.kds, logger.NewTest(t))
+			checker.cache = newCRLCache()
+			if !tc.now.IsZero() {
+				checker.now = func() time.Time { return tc.now }
+			}
+
+			err := checker.CheckCertificateChain(tc.chain, tc.ark)
+			if tc.wantErr {
+				assert.Error(err)
+			} else {
+				assert.NoError(err)
+			}
+			assert.Equal(tc.wantRequests, tc.kds.requests)
+		})
+	}
+}
+
+func TestRevocationCheckerCachesCRL(t *testing.T) {
+	require := require.New(t)
+	assert := assert.New(t)
+
+	ark := mustParseCert(t, testdata.TestARK)
+	ask := mustParseCert(t, testdata.TestASK)
+	kds := &stubKDS{responses: map[string][]byte{
+		"https://kdsintf.amd.com/vcek/v1/Milan/crl": testdata.KDSCRL,
+	}}
+	cache := newCRLCache()
+
+	// validators may create a new checker for every attestation, which must not retrieve the CRL again
+	for range 3 {
+		checker := NewRevocationChecker(nil, abi.VcekReportSigner, true, kds, logger.NewTest(t))
+		checker.cache = cache
+		require.NoError(checker.CheckCertificateChain(&spb.CertificateChain{AskCert: ask.Raw}, ark))
+	}
+	assert.Len(kds.requests, 1)
+
+	// the cache is keyed by the URL of the CRL
+	checker := NewRevocationChecker(nil, abi.VlekReportSigner, false, kds, logger.NewTest(t))
+	checker.cache = cache
+	require.NoError(checker.CheckCertificateChain(&spb.CertificateChain{AskCert: ask.Raw}, ark))
+	assert.Equal([]string{
+		"https://kdsintf.amd.com/vcek/v1/Milan/crl",
+		"https://kdsintf.amd.com/vlek/v1/Milan/crl",
+	}, kds.requests)
+}
+
+func TestCheckRevocation(t *testing.T) {
+	ask := mustParseCert(t, testdata.TestASK)
+	vcek := mustParseCert(t, testdata.TestVCEK)
+
+	testCases := map[string]struct {
+		crl     []byte
+		certs   []*x509.Certificate
+		wantErr bool
+	}{
+		"not revoked": {
+			crl:   testdata.KDSCRL,
+			certs: []*x509.Certificate{ask, vcek},
+		},
+		"ASK revoked": {
+			crl:     testdata.KDSCRLRevokedASK,
+			certs:   []*x509.Certificate{ask, vcek},
+			wantErr: true,
+		},
+		"certificate of other issuer is ignored": {
+			crl:   testdata.KDSCRLRevokedASK,
+			certs: []*x509.Certificate{vcek, nil},
+		},
+	}
+
+	for name, tc := range testCases {
+		t.Run(name, func(t *testing.T) {
+			err := CheckRevocation(mustParseCRL(t, tc.crl), tc.certs...)
+			if tc.wantErr {
+				assert.Error(t, err)
+			} else {
+				assert.NoError(t, err)
+			}
+		})
+	}
+}
+
+// stubKDS is a local stand-in for the AMD KDS, serving recorded responses.
+type stubKDS struct {
+	responses map[string][]byte
+	err       error
+	requests  []string
+}
+
+func (s *stubKDS) Get(url string) ([]byte, error) {
+	s.requests = append(s.requests, url)
+	if s.err != nil {
+		return nil, s.err
+	}
+	resp, ok := s.responses[url]
+	if !ok {
+		return nil, errors.New("not found")
+	}
+	return resp, nil
+}
+
+func mustParseCert(t *testing.T, pem []byte) *x509.Certificate {
+	t.Helper()
+	cert, err := crypto.PemToX509Cert(pem)
+	require.NoError(t, err)
+	return cert
+}
+
+func mustParseCRL(t *testing.T, der []byte) *x509.RevocationList {
+	t.Helper()
+	crl, err := x509.ParseRevocationList(der)
+	require.NoError(t, err)
+	return crl
+}
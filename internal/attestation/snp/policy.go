@@ -0,0 +1,64 @@
+/*
+Copyright (c) Edgeless Systems GmbH
+
+SPDX-License-Identifier: BUSL-1.1
+*/
+
+package snp
+
+import (
+	"encoding/json"
+	"fmt"
+
+	"github.com/edgelesssys/constellation/v2/internal/attestation/policy"
+	"github.com/google/go-sev-guest/abi"
+	"github.com/google/go-sev-guest/kds"
+	spb "github.com/google/go-sev-guest/proto/sevsnp"
+)
+
+// PolicyClaims returns the claims of the attestation report in the JSON encoded instance info
+// for the evaluation of an attestation policy. The report must have been validated before.
+func PolicyClaims(rawInstanceInfo []byte) (policy.Claims, error) {
+	var info InstanceInfo
+	if err := json.Unmarshal(rawInstanceInfo, &info); err != nil {
+		return policy.Claims{}, fmt.Errorf("unmarshalling instance info: %w", err)
+	}
+	report, err := abi.ReportToProto(info.AttestationReport)
+	if err != nil {
+		return policy.Claims{}, fmt.Errorf("parsing attestation report: %w", err)
+	}
+	return policy.Claims{SNP: ReportClaims(report)}, nil
+}
+
+// ReportClaims returns the claims of the attestation report for the evaluation of an attestation policy.
+func ReportClaims(report *spb.Report) *policy.SNPClaims {
+	return &policy.SNPClaims{
+		Version:         report.Version,
+		GuestSVN:        report.GuestSvn,
+		Policy:          report.Policy,
+		FamilyID:        report.FamilyId,
+		ImageID:         report.ImageId,
+		VMPL:            report.Vmpl,
+		PlatformInfo:    report.PlatformInfo,
+		CurrentTCB:      tcbClaims(report.CurrentTcb),
+		ReportedTCB:     tcbClaims(report.ReportedTcb),
+		CommittedTCB:    tcbClaims(report.CommittedTcb),
+		LaunchTCB:       tcbClaims(report.LaunchTcb),
+		Measurement:     report.Measurement,
+		HostData:        report.HostData,
+		IDKeyDigest:     report.IdKeyDigest,
+		AuthorKeyDigest: report.AuthorKeyDigest,
+		ReportData:      report.ReportData,
+		ChipID:          report.ChipId,
+	}
+}
+
+func tcbClaims(tcb uint64) policy.TCB {
+	parts := kds.DecomposeTCBVersion(kds.TCBVersion(tcb))
+	return policy.TCB{
+		Bootloader: parts.BlSpl,
+		TEE:        parts.TeeSpl,
+		SNP:        parts.SnpSpl,
+		Microcode:  parts.UcodeSpl,
+	}
+}
@@ -0,0 +1,34 @@
+/*
+Copyright (c) Edgeless Systems GmbH
+
+SPDX-License-Identifier: BUSL-1.1
+*/
+
+package snp
+
+import (
+	"testing"
+
+	"github.com/edgelesssys/constellation/v2/internal/attestation/policy"
+	spb "github.com/google/go-sev-guest/proto/sevsnp"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestReportClaims(t *testing.T) {
+	assert := assert.New(t)
+
+	report := &spb.Report{
+		Version:     2,
+		Policy:      0x30000,
+		ReportedTcb: 0x7308000000000003, // microcode 115, SNP 8, TEE 0, bootloader 3
+		LaunchTcb:   0xd116000000000204, // microcode 209, SNP 22, TEE 2, bootloader 4
+		HostData:    []byte{0x01, 0x02},
+	}
+
+	claims := ReportClaims(report)
+	assert.Equal(uint32(2), claims.Version)
+	assert.Equal(uint64(0x30000), claims.Policy)
+	assert.Equal(policy.TCB{Bootloader: 3, TEE: 0, SNP: 8, Microcode: 115}, claims.ReportedTCB)
+	assert.Equal(policy.TCB{Bootloader: 4, TEE: 2, SNP: 22, Microcode: 209}, claims.LaunchTCB)
+	assert.Equal([]byte{0x01, 0x02}, claims.HostData)
+}
@@ -46,3 +46,28 @@ var VlekCertChain []byte
 //
 //go:embed vlek.pem
 var Vlek []byte
+
+// TestARK is a self-signed root certificate standing in for the AMD root key (ARK) in revocation tests.
+//
+//go:embed testark.pem
+var TestARK []byte
+
+// TestASK is an intermediate certificate signed by TestARK, standing in for the AMD signing key (ASK).
+//
+//go:embed testask.pem
+var TestASK []byte
+
+// TestVCEK is a report signer certificate signed by TestASK.
+//
+//go:embed testvcek.pem
+var TestVCEK []byte
+
+// KDSCRL is a CRL (DER, as returned from AMD KDS) signed by TestARK that does not revoke TestASK.
+//
+//go:embed kdscrl.der
+var KDSCRL []byte
+
+// KDSCRLRevokedASK is a CRL (DER, as returned from AMD KDS) signed by TestARK that revokes TestASK.
+//
+//go:embed kdscrlrevokedask.der
+var KDSCRLRevokedASK []byte
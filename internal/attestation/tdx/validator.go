@@ -14,6 +14,7 @@ import (
 
 	"github.com/edgelesssys/constellation/v2/internal/attestation"
 	"github.com/edgelesssys/constellation/v2/internal/attestation/measurements"
+	"github.com/edgelesssys/constellation/v2/internal/attestation/policy"
 	"github.com/edgelesssys/constellation/v2/internal/attestation/variant"
 	"github.com/edgelesssys/constellation/v2/internal/config"
 	"github.com/edgelesssys/go-tdx-qpl/verification"
@@ -31,6 +32,9 @@ type Validator struct {
 	tdx      tdxVerifier
 	expected measurements.M
 
+	policy    *policy.Policy
+	policyErr error
+
 	log attestation.Logger
 }
 
@@ -40,15 +44,25 @@ func NewValidator(cfg *config.QEMUTDX, log attestation.Logger) *Validator {
 		log = attestation.NOPLogger{}
 	}
 
+	attPolicy, err := policy.New(cfg.Policy)
 	return &Validator{
-		tdx:      verification.New(),
-		expected: cfg.Measurements,
-		log:      log,
+		tdx:       verification.New(),
+		expected:  cfg.Measurements,
+		policy:    attPolicy,
+		policyErr: err,
+		log:       log,
 	}
 }
 
 // Validate validates the given attestation document using TDX attestation.
-func (v *Validator) Validate(ctx context.Context, attDocRaw []byte, nonce []byte) (userData []byte, err error) {
+func (v *Validator) Validate(ctx context.Context, attDocRaw []byte, nonce []byte) ([]byte, error) {
+	userData, _, err := v.ValidateClaims(ctx, attDocRaw, nonce)
+	return userData, err
+}
+
+// ValidateClaims validates the given attestation document like [Validator.Validate],
+// and additionally returns the claims of the verified TDX quote.
+func (v *Validator) ValidateClaims(ctx context.Context, attDocRaw []byte, nonce []byte) (userData []byte, claims policy.Claims, err error) {
 	v.log.Info("Validating attestation document")
 	defer func() {
 		if err != nil {
@@ -58,19 +72,19 @@ func (v *Validator) Validate(ctx context.Context, attDocRaw []byte, nonce []byte
 
 	var attDoc tdxAttestationDocument
 	if err := json.Unmarshal(attDocRaw, &attDoc); err != nil {
-		return nil, fmt.Errorf("unmarshaling attestation document: %w", err)
+		return nil, policy.Claims{}, fmt.Errorf("unmarshaling attestation document: %w", err)
 	}
 
 	// Verify the quote.
 	quote, err := v.tdx.Verify(ctx, attDoc.RawQuote)
 	if err != nil {
-		return nil, fmt.Errorf("verifying TDX quote: %w", err)
+		return nil, policy.Claims{}, fmt.Errorf("verifying TDX quote: %w", err)
 	}
 
 	// Report data
 	extraData := attestation.MakeExtraData(attDoc.UserData, nonce)
 	if !attestation.CompareExtraData(quote.Body.ReportData[:], extraData) {
-		return nil, fmt.Errorf("report data in TDX quote does not match provided nonce")
+		return nil, policy.Claims{}, fmt.Errorf("report data in TDX quote does not match provided nonce")
 	}
 
 	// Convert RTMRs and MRTD to map.
@@ -86,8 +100,28 @@ func (v *Validator) Validate(ctx context.Context, attDocRaw []byte, nonce []byte
 		v.log.Warn(warning)
 	}
 	if len(errs) > 0 {
-		return nil, fmt.Errorf("measurement validation failed:\n%w", errors.Join(errs...))
+		return nil, policy.Claims{}, fmt.Errorf("measurement validation failed:\n%w", errors.Join(errs...))
+	}
+
+	// Evaluate the attestation policy over the measurements and the verified quote.
+	if v.policyErr != nil {
+		return nil, policy.Claims{}, fmt.Errorf("compiling attestation policy: %w", v.policyErr)
+	}
+	rtmrs := make([][]byte, len(quote.Body.RTMR))
+	for idx := range quote.Body.RTMR {
+		rtmrs[idx] = quote.Body.RTMR[idx][:]
+	}
+	claims = policy.Claims{
+		PCRs: tdMeasure,
+		TDX: &policy.TDXClaims{
+			MRTD:       quote.Body.MRTD[:],
+			RTMRs:      rtmrs,
+			ReportData: quote.Body.ReportData[:],
+		},
+	}
+	if err := v.policy.Evaluate(claims); err != nil {
+		return nil, policy.Claims{}, err
 	}
 
-	return attDoc.UserData, nil
+	return attDoc.UserData, claims, nil
 }
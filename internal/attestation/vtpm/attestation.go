@@ -24,7 +24,9 @@ import (
 	"github.com/google/go-tpm/legacy/tpm2"
 
 	"github.com/edgelesssys/constellation/v2/internal/attestation"
+	"github.com/edgelesssys/constellation/v2/internal/attestation/eventlog"
 	"github.com/edgelesssys/constellation/v2/internal/attestation/measurements"
+	"github.com/edgelesssys/constellation/v2/internal/attestation/policy"
 )
 
 var (
@@ -67,6 +69,8 @@ type (
 	GetInstanceInfo func(ctx context.Context, tpm io.ReadWriteCloser, extraData []byte) ([]byte, error)
 	// ValidateCVM validates confidential computing capabilities of the instance issuing the attestation.
 	ValidateCVM func(attestation AttestationDocument, state *attest.MachineState) error
+	// GetPolicyClaims returns the confidential computing claims of a validated attestation document for the attestation policy.
+	GetPolicyClaims func(attestation AttestationDocument) (policy.Claims, error)
 )
 
 // AttestationDocument contains the TPM attestation with signed user data.
@@ -135,8 +139,16 @@ func (i *Issuer) Issue(ctx context.Context, userData []byte, nonce []byte) (res
 
 	tpmNonce := makeTpmNonce(instanceInfo, extraData)
 
+	// Include the event log, so verifiers can explain the measured PCR values.
+	// Verifiers don't need the event log to validate the attestation, so it is omitted if it can't be read.
+	eventLog, eventLogErr := tpmClient.GetEventLog(tpm)
+	if eventLogErr != nil {
+		i.log.Warn(fmt.Sprintf("Failed to read event log, issuing attestation statement without it: %s", eventLogErr))
+		eventLog = nil
+	}
+
 	// Create an attestation using the loaded key
-	tpmAttestation, err := aK.Attest(tpmClient.AttestOpts{Nonce: tpmNonce[:]})
+	tpmAttestation, err := aK.Attest(tpmClient.AttestOpts{Nonce: tpmNonce[:], TCGEventLog: eventLog})
 	if err != nil {
 		return nil, fmt.Errorf("creating attestation: %w", err)
 	}
@@ -162,6 +174,10 @@ type Validator struct {
 	getTrustedKey GetTPMTrustedAttestationPublicKey
 	validateCVM   ValidateCVM
 
+	policy          *policy.Policy
+	policyErr       error
+	getPolicyClaims GetPolicyClaims
+
 	log attestation.Logger
 }
 
@@ -180,8 +196,28 @@ func NewValidator(expected measurements.M, getTrustedKey GetTPMTrustedAttestatio
 	}
 }
 
+// SetPolicy sets the attestation policy, which is evaluated after the measurements have been validated.
+// getClaims returns the claims of the attestation document in addition to the PCR values, and may be nil.
+// The claims are also returned by [Validator.ValidateClaims], even if there are no rules.
+// If the policy can't be compiled, every validation fails.
+func (v *Validator) SetPolicy(rules []policy.Rule, getClaims GetPolicyClaims) {
+	v.getPolicyClaims = getClaims
+	if len(rules) == 0 {
+		v.policy, v.policyErr = nil, nil
+		return
+	}
+	v.policy, v.policyErr = policy.New(rules)
+}
+
 // Validate a TPM based attestation.
-func (v *Validator) Validate(ctx context.Context, attDocRaw []byte, nonce []byte) (userData []byte, err error) {
+func (v *Validator) Validate(ctx context.Context, attDocRaw []byte, nonce []byte) ([]byte, error) {
+	userData, _, err := v.ValidateClaims(ctx, attDocRaw, nonce)
+	return userData, err
+}
+
+// ValidateClaims validates a TPM based attestation like [Validator.Validate],
+// and additionally returns the claims of the validated attestation document.
+func (v *Validator) ValidateClaims(ctx context.Context, attDocRaw []byte, nonce []byte) (userData []byte, claims policy.Claims, err error) {
 	v.log.Info("Validating attestation document")
 	defer func() {
 		if err != nil {
@@ -202,7 +238,7 @@ func (v *Validator) Validate(ctx context.Context, attDocRaw []byte, nonce []byte
 		},
 	}
 	if err := json.Unmarshal(attDocRaw, &attDoc); err != nil {
-		return nil, fmt.Errorf("unmarshaling TPM attestation document: %w", err)
+		return nil, policy.Claims{}, fmt.Errorf("unmarshaling TPM attestation document: %w", err)
 	}
 
 	extraData := attestation.MakeExtraData(attDoc.UserData, nonce)
@@ -210,7 +246,7 @@ func (v *Validator) Validate(ctx context.Context, attDocRaw []byte, nonce []byte
 	// Verify and retrieve the trusted attestation public key using the provided instance info
 	aKP, err := v.getTrustedKey(ctx, attDoc, extraData)
 	if err != nil {
-		return nil, fmt.Errorf("validating attestation public key: %w", err)
+		return nil, policy.Claims{}, fmt.Errorf("validating attestation public key: %w", err)
 	}
 
 	tpmNonce := makeTpmNonce(attDoc.InstanceInfo, extraData)
@@ -225,29 +261,81 @@ func (v *Validator) Validate(ctx context.Context, attDocRaw []byte, nonce []byte
 		},
 	)
 	if err != nil {
-		return nil, fmt.Errorf("verifying attestation document: %w", err)
+		return nil, policy.Claims{}, fmt.Errorf("verifying attestation document: %w", err)
 	}
 
 	// Validate confidential computing capabilities of the VM
 	if err := v.validateCVM(attDoc, state); err != nil {
-		return nil, fmt.Errorf("verifying VM confidential computing capabilities: %w", err)
+		return nil, policy.Claims{}, fmt.Errorf("verifying VM confidential computing capabilities: %w", err)
 	}
 
 	// Verify PCRs
 	quoteIdx, err := GetSHA256QuoteIndex(attDoc.Attestation.Quotes)
 	if err != nil {
-		return nil, err
+		return nil, policy.Claims{}, err
 	}
+	v.replayEventLog(attDoc.Attestation.EventLog, attDoc.Attestation.Quotes[quoteIdx].Pcrs.Pcrs)
 	warnings, errs := v.expected.Compare(attDoc.Attestation.Quotes[quoteIdx].Pcrs.Pcrs)
 	for _, warning := range warnings {
 		v.log.Warn(warning)
 	}
 	if len(errs) > 0 {
-		return nil, fmt.Errorf("measurement validation failed:\n%w", errors.Join(errs...))
+		return nil, policy.Claims{}, fmt.Errorf("measurement validation failed:\n%w", errors.Join(errs...))
+	}
+
+	claims, err = v.policyClaims(attDoc, attDoc.Attestation.Quotes[quoteIdx].Pcrs.Pcrs)
+	if err != nil {
+		return nil, policy.Claims{}, err
+	}
+	if err := v.evaluatePolicy(claims); err != nil {
+		return nil, policy.Claims{}, err
 	}
 
 	v.log.Info("Successfully validated attestation document")
-	return attDoc.UserData, nil
+	return attDoc.UserData, claims, nil
+}
+
+// replayEventLog replays the event log against the quoted PCR values.
+// The event log is only used to explain the measurements, the PCR values are trusted because of the quote's signature.
+// Therefore, an event log that can't be replayed is reported, but doesn't fail the validation.
+func (v *Validator) replayEventLog(rawEventLog []byte, pcrs map[uint32][]byte) {
+	if len(rawEventLog) == 0 {
+		v.log.Info("Attestation document contains no event log")
+		return
+	}
+	events, err := eventlog.Parse(rawEventLog)
+	if err != nil {
+		v.log.Warn(fmt.Sprintf("Failed to parse event log: %s", err))
+		return
+	}
+	if err := eventlog.Verify(events, pcrs); err != nil {
+		v.log.Warn(fmt.Sprintf("Failed to replay event log: %s", err))
+	}
+}
+
+// policyClaims returns the quoted PCR values and the claims of the attestation document.
+func (v *Validator) policyClaims(attDoc AttestationDocument, pcrs map[uint32][]byte) (policy.Claims, error) {
+	var claims policy.Claims
+	if v.getPolicyClaims != nil {
+		var err error
+		claims, err = v.getPolicyClaims(attDoc)
+		if err != nil {
+			return policy.Claims{}, fmt.Errorf("getting attestation policy claims: %w", err)
+		}
+	}
+	claims.PCRs = pcrs
+	return claims, nil
+}
+
+// evaluatePolicy evaluates the attestation policy over the claims of the attestation document.
+func (v *Validator) evaluatePolicy(claims policy.Claims) error {
+	if v.policyErr != nil {
+		return fmt.Errorf("compiling attestation policy: %w", v.policyErr)
+	}
+	if v.policy == nil {
+		return nil
+	}
+	return v.policy.Evaluate(claims)
 }
 
 // GetSHA256QuoteIndex performs safety checks and returns the index for SHA256 PCR quotes.
@@ -14,6 +14,7 @@ import (
 	"fmt"
 	"io"
 	"os"
+	"strings"
 	"testing"
 
 	tpmclient "github.com/google/go-tpm-tools/client"
@@ -25,6 +26,7 @@ import (
 
 	"github.com/edgelesssys/constellation/v2/internal/attestation/initialize"
 	"github.com/edgelesssys/constellation/v2/internal/attestation/measurements"
+	"github.com/edgelesssys/constellation/v2/internal/attestation/policy"
 	"github.com/edgelesssys/constellation/v2/internal/attestation/simulator"
 	tpmsim "github.com/edgelesssys/constellation/v2/internal/attestation/simulator"
 	"github.com/edgelesssys/constellation/v2/internal/logger"
@@ -54,6 +56,23 @@ func (s simTPMWithEventLog) EventLog() ([]byte, error) {
 	return header, nil
 }
 
+type simTPMWithFailingEventLog struct {
+	io.ReadWriteCloser
+}
+
+func newSimTPMWithFailingEventLog() (io.ReadWriteCloser, error) {
+	tpmSim, err := simulator.OpenSimulatedTPM()
+	if err != nil {
+		return nil, err
+	}
+	return &simTPMWithFailingEventLog{tpmSim}, nil
+}
+
+// EventLog overrides the default event log getter.
+func (s simTPMWithFailingEventLog) EventLog() ([]byte, error) {
+	return nil, errors.New("failure")
+}
+
 func fakeGetInstanceInfo(_ context.Context, _ io.ReadWriteCloser, _ []byte) ([]byte, error) {
 	return []byte("unit-test"), nil
 }
@@ -154,6 +173,20 @@ func TestValidate(t *testing.T) {
 	assert.Equal(t, challenge, out)
 	assert.Len(t, warnLog.warnings, 4)
 
+	claimsValidator := withPolicy(
+		NewValidator(testExpectedPCRs, fakeGetTrustedKey, fakeValidateCVM, logger.NewTest(t)),
+		nil,
+		func(AttestationDocument) (policy.Claims, error) {
+			return policy.Claims{SNP: &policy.SNPClaims{HostData: []byte{0x01, 0x02}}}, nil
+		},
+	)
+	out, claims, err := claimsValidator.ValidateClaims(ctx, attDocRaw, nonce)
+	require.NoError(err)
+	assert.Equal(t, challenge, out)
+	assert.NotEmpty(t, claims.PCRs)
+	require.NotNil(claims.SNP)
+	assert.Equal(t, []byte{0x01, 0x02}, claims.SNP.HostData)
+
 	testCases := map[string]struct {
 		validator *Validator
 		attDoc    []byte
@@ -265,6 +298,58 @@ func TestValidate(t *testing.T) {
 			nonce:     nonce,
 			wantErr:   true,
 		},
+		"policy satisfied": {
+			validator: withPolicy(
+				NewValidator(testExpectedPCRs, fakeGetTrustedKey, fakeValidateCVM, warnLog),
+				[]policy.Rule{{Name: "pcr0", Expression: `pcrs[0] == "` + strings.Repeat("00", 32) + `"`}},
+				nil,
+			),
+			attDoc: mustMarshalAttestation(attDoc, require),
+			nonce:  nonce,
+		},
+		"policy not satisfied": {
+			validator: withPolicy(
+				NewValidator(testExpectedPCRs, fakeGetTrustedKey, fakeValidateCVM, warnLog),
+				[]policy.Rule{{Name: "pcr0", Expression: `pcrs[0] == "ff"`}},
+				nil,
+			),
+			attDoc:  mustMarshalAttestation(attDoc, require),
+			nonce:   nonce,
+			wantErr: true,
+		},
+		"policy over CVM claims": {
+			validator: withPolicy(
+				NewValidator(testExpectedPCRs, fakeGetTrustedKey, fakeValidateCVM, warnLog),
+				[]policy.Rule{{Name: "host data", Expression: `snp.hostData == "0102"`}},
+				func(AttestationDocument) (policy.Claims, error) {
+					return policy.Claims{SNP: &policy.SNPClaims{HostData: []byte{0x01, 0x02}}}, nil
+				},
+			),
+			attDoc: mustMarshalAttestation(attDoc, require),
+			nonce:  nonce,
+		},
+		"policy claims unavailable": {
+			validator: withPolicy(
+				NewValidator(testExpectedPCRs, fakeGetTrustedKey, fakeValidateCVM, warnLog),
+				[]policy.Rule{{Name: "host data", Expression: `snp.hostData == "0102"`}},
+				func(AttestationDocument) (policy.Claims, error) {
+					return policy.Claims{}, errors.New("failure")
+				},
+			),
+			attDoc:  mustMarshalAttestation(attDoc, require),
+			nonce:   nonce,
+			wantErr: true,
+		},
+		"invalid policy": {
+			validator: withPolicy(
+				NewValidator(testExpectedPCRs, fakeGetTrustedKey, fakeValidateCVM, warnLog),
+				[]policy.Rule{{Name: "broken", Expression: `pcrs[0] ==`}},
+				nil,
+			),
+			attDoc:  mustMarshalAttestation(attDoc, require),
+			nonce:   nonce,
+			wantErr: true,
+		},
 	}
 
 	for name, tc := range testCases {
@@ -281,12 +366,54 @@ func TestValidate(t *testing.T) {
 	}
 }
 
+func withPolicy(v *Validator, rules []policy.Rule, getClaims GetPolicyClaims) *Validator {
+	v.SetPolicy(rules, getClaims)
+	return v
+}
+
 func mustMarshalAttestation(attDoc AttestationDocument, require *require.Assertions) []byte {
 	out, err := json.Marshal(attDoc)
 	require.NoError(err)
 	return out
 }
 
+func TestIssueWithoutEventLog(t *testing.T) {
+	cgo := os.Getenv("CGO_ENABLED")
+	if cgo == "0" {
+		t.Skip("skipping test because CGO is disabled and tpm simulator requires it")
+	}
+	require := require.New(t)
+
+	fakeValidateCVM := func(AttestationDocument, *attest.MachineState) error { return nil }
+	fakeGetTrustedKey := func(_ context.Context, attDoc AttestationDocument, _ []byte) (crypto.PublicKey, error) {
+		pubArea, err := tpm2.DecodePublic(attDoc.Attestation.AkPub)
+		if err != nil {
+			return nil, err
+		}
+		return pubArea.Key()
+	}
+	expectedPCRs := measurements.M{
+		0: measurements.WithAllBytes(0x00, measurements.Enforce, measurements.PCRMeasurementLength),
+	}
+
+	issuer := NewIssuer(newSimTPMWithFailingEventLog, tpmclient.AttestationKeyRSA, fakeGetInstanceInfo, logger.NewTest(t))
+	validator := NewValidator(expectedPCRs, fakeGetTrustedKey, fakeValidateCVM, logger.NewTest(t))
+
+	nonce := []byte{1, 2, 3, 4}
+	challenge := []byte("Constellation")
+
+	attDocRaw, err := issuer.Issue(t.Context(), challenge, nonce)
+	require.NoError(err)
+
+	var attDoc AttestationDocument
+	require.NoError(json.Unmarshal(attDocRaw, &attDoc))
+	require.Empty(attDoc.Attestation.EventLog)
+
+	out, err := validator.Validate(t.Context(), attDocRaw, nonce)
+	require.NoError(err)
+	require.Equal(challenge, out)
+}
+
 func TestFailIssuer(t *testing.T) {
 	testCases := map[string]struct {
 		issuer   *Issuer
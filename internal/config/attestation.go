@@ -131,6 +131,67 @@ func (c *Certificate) unmarshal(unmarshalFunc func(any) error) error {
 	return nil
 }
 
+// CRL is a wrapper around x509.RevocationList allowing custom marshaling.
+type CRL x509.RevocationList
+
+// Equal returns true if the embedded Raw values are equal.
+func (c CRL) Equal(other CRL) bool {
+	return bytes.Equal(c.Raw, other.Raw)
+}
+
+// MarshalJSON marshals the CRL to PEM.
+func (c CRL) MarshalJSON() ([]byte, error) {
+	if len(c.Raw) == 0 {
+		return json.Marshal(new(string))
+	}
+	pem := pem.EncodeToMemory(&pem.Block{Type: "X509 CRL", Bytes: c.Raw})
+	return json.Marshal(string(pem))
+}
+
+// MarshalYAML marshals the CRL to PEM.
+func (c CRL) MarshalYAML() (any, error) {
+	if len(c.Raw) == 0 {
+		return "", nil
+	}
+	pem := pem.EncodeToMemory(&pem.Block{Type: "X509 CRL", Bytes: c.Raw})
+	return string(pem), nil
+}
+
+// UnmarshalJSON unmarshals the CRL from PEM.
+func (c *CRL) UnmarshalJSON(data []byte) error {
+	if len(data) == 0 {
+		return nil
+	}
+	return c.unmarshal(func(val any) error {
+		return json.Unmarshal(data, val)
+	})
+}
+
+// UnmarshalYAML unmarshals the CRL from PEM.
+func (c *CRL) UnmarshalYAML(unmarshal func(any) error) error {
+	return c.unmarshal(unmarshal)
+}
+
+func (c *CRL) unmarshal(unmarshalFunc func(any) error) error {
+	var pemData string
+	if err := unmarshalFunc(&pemData); err != nil {
+		return err
+	}
+	if pemData == "" {
+		return nil
+	}
+	block, _ := pem.Decode([]byte(pemData))
+	if block == nil {
+		return fmt.Errorf("decoding CRL: no PEM data found")
+	}
+	crl, err := x509.ParseRevocationList(block.Bytes)
+	if err != nil {
+		return err
+	}
+	*c = CRL(*crl)
+	return nil
+}
+
 func mustParsePEM(data string) Certificate {
 	jsonData := fmt.Sprintf("\"%s\"", data)
 	var cert Certificate
@@ -7,9 +7,17 @@ SPDX-License-Identifier: BUSL-1.1
 package config
 
 import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/x509"
+	"crypto/x509/pkix"
 	"encoding/json"
+	"encoding/pem"
 	"fmt"
+	"math/big"
 	"testing"
+	"time"
 
 	"github.com/edgelesssys/constellation/v2/internal/attestation/measurements"
 	"github.com/edgelesssys/constellation/v2/internal/attestation/variant"
@@ -118,3 +126,87 @@ func TestEmptyCertificateMarshalYAML(t *testing.T) {
 	require.NoError(err)
 	assert.YAMLEq(yamlCert, string(out))
 }
+
+func TestCRLMarshalJSON(t *testing.T) {
+	require := require.New(t)
+	assert := assert.New(t)
+
+	crlPEM := pem.EncodeToMemory(&pem.Block{Type: "X509 CRL", Bytes: newTestCRL(t)})
+	jsonCRL, err := json.Marshal(string(crlPEM))
+	require.NoError(err)
+	var crl CRL
+	require.NoError(json.Unmarshal(jsonCRL, &crl))
+	require.Len(crl.RevokedCertificateEntries, 1)
+
+	out, err := json.Marshal(crl)
+	require.NoError(err)
+	assert.JSONEq(string(jsonCRL), string(out))
+}
+
+func TestEmptyCRLMarshalJSON(t *testing.T) {
+	require := require.New(t)
+	assert := assert.New(t)
+
+	jsonCRL := "\"\""
+	var crl CRL
+	require.NoError(json.Unmarshal([]byte(jsonCRL), &crl))
+
+	out, err := json.Marshal(crl)
+	require.NoError(err)
+	assert.JSONEq(jsonCRL, string(out))
+}
+
+func TestCRLMarshalYAML(t *testing.T) {
+	require := require.New(t)
+	assert := assert.New(t)
+
+	crlPEM := pem.EncodeToMemory(&pem.Block{Type: "X509 CRL", Bytes: newTestCRL(t)})
+	yamlCRL, err := yaml.Marshal(string(crlPEM))
+	require.NoError(err)
+	var crl CRL
+	require.NoError(yaml.Unmarshal(yamlCRL, &crl))
+	require.Len(crl.RevokedCertificateEntries, 1)
+
+	out, err := yaml.Marshal(crl)
+	require.NoError(err)
+	assert.YAMLEq(string(yamlCRL), string(out))
+}
+
+func TestInvalidCRLUnmarshal(t *testing.T) {
+	var crl CRL
+	assert.Error(t, json.Unmarshal([]byte(`"not a CRL"`), &crl))
+}
+
+// newTestCRL returns a DER encoded CRL revoking a single certificate.
+func newTestCRL(t *testing.T) []byte {
+	t.Helper()
+	require := require.New(t)
+
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	require.NoError(err)
+	issuerTmpl := &x509.Certificate{
+		SerialNumber:          big.NewInt(1),
+		Subject:               pkix.Name{CommonName: "ARK-Test"},
+		NotBefore:             time.Now().Add(-time.Hour),
+		NotAfter:              time.Now().Add(time.Hour),
+		KeyUsage:              x509.KeyUsageCRLSign | x509.KeyUsageCertSign,
+		BasicConstraintsValid: true,
+		IsCA:                  true,
+		SubjectKeyId:          []byte{1, 2, 3, 4},
+	}
+	issuerRaw, err := x509.CreateCertificate(rand.Reader, issuerTmpl, issuerTmpl, key.Public(), key)
+	require.NoError(err)
+	issuer, err := x509.ParseCertificate(issuerRaw)
+	require.NoError(err)
+
+	crl, err := x509.CreateRevocationList(rand.Reader, &x509.RevocationList{
+		Number:     big.NewInt(1),
+		ThisUpdate: time.Now(),
+		NextUpdate: time.Now().Add(time.Hour),
+		RevokedCertificateEntries: []x509.RevocationListEntry{
+			{SerialNumber: big.NewInt(2), RevocationTime: time.Now()},
+		},
+	}, issuer, key)
+	require.NoError(err)
+	return crl
+}
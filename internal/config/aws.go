@@ -9,6 +9,7 @@ import (
 	"bytes"
 	"context"
 	"fmt"
+	"slices"
 
 	"github.com/edgelesssys/constellation/v2/internal/api/attestationconfigapi"
 	"github.com/edgelesssys/constellation/v2/internal/attestation/measurements"
@@ -59,8 +60,10 @@ func (c AWSSEVSNP) EqualTo(other AttestationCfg) (bool, error) {
 	microcodeEqual := c.MicrocodeVersion == otherCfg.MicrocodeVersion
 	rootKeyEqual := bytes.Equal(c.AMDRootKey.Raw, otherCfg.AMDRootKey.Raw)
 	signingKeyEqual := bytes.Equal(c.AMDSigningKey.Raw, otherCfg.AMDSigningKey.Raw)
+	requireCRLEqual := c.RequireCRL == otherCfg.RequireCRL
+	policyEqual := slices.Equal(c.Policy, otherCfg.Policy)
 
-	return measurementsEqual && bootloaderEqual && teeEqual && snpEqual && microcodeEqual && rootKeyEqual && signingKeyEqual, nil
+	return measurementsEqual && bootloaderEqual && teeEqual && snpEqual && microcodeEqual && rootKeyEqual && signingKeyEqual && requireCRLEqual && policyEqual, nil
 }
 
 func (c *AWSSEVSNP) getToMarshallLatestWithResolvedVersions() AttestationCfg {
@@ -124,5 +127,5 @@ func (c AWSNitroTPM) EqualTo(other AttestationCfg) (bool, error) {
 	if !ok {
 		return false, fmt.Errorf("cannot compare %T with %T", c, other)
 	}
-	return c.Measurements.EqualTo(otherCfg.Measurements), nil
+	return c.Measurements.EqualTo(otherCfg.Measurements) && slices.Equal(c.Policy, otherCfg.Policy), nil
 }
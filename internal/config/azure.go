@@ -9,6 +9,7 @@ import (
 	"bytes"
 	"context"
 	"fmt"
+	"slices"
 
 	"github.com/edgelesssys/constellation/v2/internal/api/attestationconfigapi"
 	"github.com/edgelesssys/constellation/v2/internal/attestation/idkeydigest"
@@ -69,8 +70,10 @@ func (c AzureSEVSNP) EqualTo(old AttestationCfg) (bool, error) {
 	snpEqual := c.SNPVersion == otherCfg.SNPVersion
 	microcodeEqual := c.MicrocodeVersion == otherCfg.MicrocodeVersion
 	rootKeyEqual := bytes.Equal(c.AMDRootKey.Raw, otherCfg.AMDRootKey.Raw)
+	requireCRLEqual := c.RequireCRL == otherCfg.RequireCRL
+	policyEqual := slices.Equal(c.Policy, otherCfg.Policy)
 
-	return firmwareSignerCfgEqual && measurementsEqual && bootloaderEqual && teeEqual && snpEqual && microcodeEqual && rootKeyEqual, nil
+	return firmwareSignerCfgEqual && measurementsEqual && bootloaderEqual && teeEqual && snpEqual && microcodeEqual && rootKeyEqual && requireCRLEqual && policyEqual, nil
 }
 
 // FetchAndSetLatestVersionNumbers fetches the latest version numbers from the configapi and sets them.
@@ -134,7 +137,7 @@ func (c AzureTrustedLaunch) EqualTo(other AttestationCfg) (bool, error) {
 	if !ok {
 		return false, fmt.Errorf("cannot compare %T with %T", c, other)
 	}
-	return c.Measurements.EqualTo(otherCfg.Measurements), nil
+	return c.Measurements.EqualTo(otherCfg.Measurements) && slices.Equal(c.Policy, otherCfg.Policy), nil
 }
 
 // DefaultForAzureTDX returns the default configuration for Azure TDX attestation.
@@ -176,7 +179,7 @@ func (c AzureTDX) EqualTo(other AttestationCfg) (bool, error) {
 	if !ok {
 		return false, fmt.Errorf("cannot compare %T with %T", c, other)
 	}
-	return c.Measurements.EqualTo(otherCfg.Measurements), nil
+	return c.Measurements.EqualTo(otherCfg.Measurements) && slices.Equal(c.Policy, otherCfg.Policy), nil
 }
 
 // FetchAndSetLatestVersionNumbers fetches the latest version numbers from the configapi and sets them.
@@ -25,6 +25,7 @@ import (
 	"io/fs"
 	"os"
 	"reflect"
+	"slices"
 	"strings"
 
 	"github.com/go-playground/locales/en"
@@ -37,6 +38,7 @@ import (
 	"github.com/edgelesssys/constellation/v2/internal/api/versionsapi"
 	"github.com/edgelesssys/constellation/v2/internal/attestation/idkeydigest"
 	"github.com/edgelesssys/constellation/v2/internal/attestation/measurements"
+	"github.com/edgelesssys/constellation/v2/internal/attestation/policy"
 	"github.com/edgelesssys/constellation/v2/internal/attestation/variant"
 	"github.com/edgelesssys/constellation/v2/internal/cloud/cloudprovider"
 	"github.com/edgelesssys/constellation/v2/internal/config/imageversion"
@@ -816,6 +818,13 @@ func (c *Config) Validate(force bool) error {
 		return err
 	}
 
+	if err := validate.RegisterValidation("attestation_policy", validateAttestationPolicy); err != nil {
+		return err
+	}
+	if err := validate.RegisterTranslation("attestation_policy", trans, registerAttestationPolicyError, translateAttestationPolicyError); err != nil {
+		return err
+	}
+
 	// Register provider validation
 	validate.RegisterStructValidation(validateProvider, ProviderConfig{})
 
@@ -992,6 +1001,9 @@ type GCPSEVES struct {
 	// description: |
 	//   Expected TPM measurements.
 	Measurements measurements.M `json:"measurements" yaml:"measurements" validate:"required,no_placeholders"`
+	// description: |
+	//   Optional attestation policy. Each rule is a CEL expression over the claims of the attestation, which must evaluate to true for the attestation to succeed.
+	Policy []policy.Rule `json:"policy,omitempty" yaml:"policy,omitempty" validate:"attestation_policy"`
 }
 
 // GCPSEVSNP is the configuration for GCP SEV-SNP attestation.
@@ -1017,6 +1029,15 @@ type GCPSEVSNP struct {
 	// description: |
 	//   AMD Signing Key certificate used to verify the SEV-SNP VCEK / VLEK certificate.
 	AMDSigningKey Certificate `json:"amdSigningKey,omitempty" yaml:"amdSigningKey,omitempty"`
+	// description: |
+	//   AMD certificate revocation list (CRL) used to check the SEV-SNP certificate chain for revoked certificates. If empty, the CRL is retrieved from the AMD KDS.
+	AMDCRL CRL `json:"amdCRL,omitempty" yaml:"amdCRL,omitempty"`
+	// description: |
+	//   Fail attestation if no valid AMD certificate revocation list is available. If false, a missing CRL is only logged as a warning.
+	RequireCRL bool `json:"requireCRL,omitempty" yaml:"requireCRL,omitempty"`
+	// description: |
+	//   Optional attestation policy. Each rule is a CEL expression over the claims of the attestation, which must evaluate to true for the attestation to succeed.
+	Policy []policy.Rule `json:"policy,omitempty" yaml:"policy,omitempty" validate:"attestation_policy"`
 }
 
 // QEMUVTPM is the configuration for QEMU vTPM attestation.
@@ -1024,6 +1045,9 @@ type QEMUVTPM struct {
 	// description: |
 	//   Expected TPM measurements.
 	Measurements measurements.M `json:"measurements" yaml:"measurements" validate:"required,no_placeholders"`
+	// description: |
+	//   Optional attestation policy. Each rule is a CEL expression over the claims of the attestation, which must evaluate to true for the attestation to succeed.
+	Policy []policy.Rule `json:"policy,omitempty" yaml:"policy,omitempty" validate:"attestation_policy"`
 }
 
 // GetVariant returns qemu-vtpm as the variant.
@@ -1047,7 +1071,7 @@ func (c QEMUVTPM) EqualTo(other AttestationCfg) (bool, error) {
 	if !ok {
 		return false, fmt.Errorf("cannot compare %T with %T", c, other)
 	}
-	return c.Measurements.EqualTo(otherCfg.Measurements), nil
+	return c.Measurements.EqualTo(otherCfg.Measurements) && slices.Equal(c.Policy, otherCfg.Policy), nil
 }
 
 // QEMUTDX is the configuration for QEMU TDX attestation.
@@ -1055,6 +1079,9 @@ type QEMUTDX struct {
 	// description: |
 	//   Expected TDX measurements.
 	Measurements measurements.M `json:"measurements" yaml:"measurements" validate:"required,no_placeholders"`
+	// description: |
+	//   Optional attestation policy. Each rule is a CEL expression over the claims of the attestation, which must evaluate to true for the attestation to succeed.
+	Policy []policy.Rule `json:"policy,omitempty" yaml:"policy,omitempty" validate:"attestation_policy"`
 }
 
 // GetVariant returns qemu-tdx as the variant.
@@ -1078,7 +1105,7 @@ func (c QEMUTDX) EqualTo(other AttestationCfg) (bool, error) {
 	if !ok {
 		return false, fmt.Errorf("cannot compare %T with %T", c, other)
 	}
-	return c.Measurements.EqualTo(otherCfg.Measurements), nil
+	return c.Measurements.EqualTo(otherCfg.Measurements) && slices.Equal(c.Policy, otherCfg.Policy), nil
 }
 
 // AWSSEVSNP is the configuration for AWS SEV-SNP attestation.
@@ -1104,6 +1131,15 @@ type AWSSEVSNP struct {
 	// description: |
 	//   AMD Signing Key certificate used to verify the SEV-SNP VCEK / VLEK certificate.
 	AMDSigningKey Certificate `json:"amdSigningKey,omitempty" yaml:"amdSigningKey,omitempty"`
+	// description: |
+	//   AMD certificate revocation list (CRL) used to check the SEV-SNP certificate chain for revoked certificates. If empty, the CRL is retrieved from the AMD KDS.
+	AMDCRL CRL `json:"amdCRL,omitempty" yaml:"amdCRL,omitempty"`
+	// description: |
+	//   Fail attestation if no valid AMD certificate revocation list is available. If false, a missing CRL is only logged as a warning.
+	RequireCRL bool `json:"requireCRL,omitempty" yaml:"requireCRL,omitempty"`
+	// description: |
+	//   Optional attestation policy. Each rule is a CEL expression over the claims of the attestation, which must evaluate to true for the attestation to succeed.
+	Policy []policy.Rule `json:"policy,omitempty" yaml:"policy,omitempty" validate:"attestation_policy"`
 }
 
 // AWSNitroTPM is the configuration for AWS Nitro TPM attestation.
@@ -1111,6 +1147,9 @@ type AWSNitroTPM struct {
 	// description: |
 	//   Expected TPM measurements.
 	Measurements measurements.M `json:"measurements" yaml:"measurements" validate:"required,no_placeholders"`
+	// description: |
+	//   Optional attestation policy. Each rule is a CEL expression over the claims of the attestation, which must evaluate to true for the attestation to succeed.
+	Policy []policy.Rule `json:"policy,omitempty" yaml:"policy,omitempty" validate:"attestation_policy"`
 }
 
 // AzureSEVSNP is the configuration for Azure SEV-SNP attestation.
@@ -1139,6 +1178,15 @@ type AzureSEVSNP struct {
 	// description: |
 	//   AMD Signing Key certificate used to verify the SEV-SNP VCEK / VLEK certificate.
 	AMDSigningKey Certificate `json:"amdSigningKey,omitempty" yaml:"amdSigningKey,omitempty"`
+	// description: |
+	//   AMD certificate revocation list (CRL) used to check the SEV-SNP certificate chain for revoked certificates. If empty, the CRL is retrieved from the AMD KDS.
+	AMDCRL CRL `json:"amdCRL,omitempty" yaml:"amdCRL,omitempty"`
+	// description: |
+	//   Fail attestation if no valid AMD certificate revocation list is available. If false, a missing CRL is only logged as a warning.
+	RequireCRL bool `json:"requireCRL,omitempty" yaml:"requireCRL,omitempty"`
+	// description: |
+	//   Optional attestation policy. Each rule is a CEL expression over the claims of the attestation, which must evaluate to true for the attestation to succeed.
+	Policy []policy.Rule `json:"policy,omitempty" yaml:"policy,omitempty" validate:"attestation_policy"`
 }
 
 // AzureTrustedLaunch is the configuration for Azure Trusted Launch attestation.
@@ -1146,6 +1194,9 @@ type AzureTrustedLaunch struct {
 	// description: |
 	//   Expected TPM measurements.
 	Measurements measurements.M `json:"measurements" yaml:"measurements" validate:"required,no_placeholders"`
+	// description: |
+	//   Optional attestation policy. Each rule is a CEL expression over the claims of the attestation, which must evaluate to true for the attestation to succeed.
+	Policy []policy.Rule `json:"policy,omitempty" yaml:"policy,omitempty" validate:"attestation_policy"`
 }
 
 // AzureTDX is the configuration for Azure TDX attestation.
@@ -1174,6 +1225,9 @@ type AzureTDX struct {
 	// description: |
 	//   Intel Root Key certificate used to verify the TDX certificate chain.
 	IntelRootKey Certificate `json:"intelRootKey" yaml:"intelRootKey"`
+	// description: |
+	//   Optional attestation policy. Each rule is a CEL expression over the claims of the attestation, which must evaluate to true for the attestation to succeed.
+	Policy []policy.Rule `json:"policy,omitempty" yaml:"policy,omitempty" validate:"attestation_policy"`
 }
 
 func toPtr[T any](v T) *T {
@@ -527,12 +527,17 @@ func init() {
 			FieldName: "gcpSEVES",
 		},
 	}
-	GCPSEVESDoc.Fields = make([]encoder.Doc, 1)
+	GCPSEVESDoc.Fields = make([]encoder.Doc, 2)
 	GCPSEVESDoc.Fields[0].Name = "measurements"
 	GCPSEVESDoc.Fields[0].Type = "M"
 	GCPSEVESDoc.Fields[0].Note = ""
 	GCPSEVESDoc.Fields[0].Description = "Expected TPM measurements."
 	GCPSEVESDoc.Fields[0].Comments[encoder.LineComment] = "Expected TPM measurements."
+	GCPSEVESDoc.Fields[1].Name = "policy"
+	GCPSEVESDoc.Fields[1].Type = "[]Rule"
+	GCPSEVESDoc.Fields[1].Note = ""
+	GCPSEVESDoc.Fields[1].Description = "Optional attestation policy. Each rule is a CEL expression over the claims of the attestation, which must evaluate to true for the attestation to succeed."
+	GCPSEVESDoc.Fields[1].Comments[encoder.LineComment] = "Optional attestation policy. Each rule is a CEL expression over the claims of the attestation, which must evaluate to true for the attestation to succeed."
 
 	GCPSEVSNPDoc.Type = "GCPSEVSNP"
 	GCPSEVSNPDoc.Comments[encoder.LineComment] = "GCPSEVSNP is the configuration for GCP SEV-SNP attestation."
@@ -543,7 +548,7 @@ func init() {
 			FieldName: "gcpSEVSNP",
 		},
 	}
-	GCPSEVSNPDoc.Fields = make([]encoder.Doc, 7)
+	GCPSEVSNPDoc.Fields = make([]encoder.Doc, 10)
 	GCPSEVSNPDoc.Fields[0].Name = "measurements"
 	GCPSEVSNPDoc.Fields[0].Type = "M"
 	GCPSEVSNPDoc.Fields[0].Note = ""
@@ -579,6 +584,21 @@ func init() {
 	GCPSEVSNPDoc.Fields[6].Note = ""
 	GCPSEVSNPDoc.Fields[6].Description = "AMD Signing Key certificate used to verify the SEV-SNP VCEK / VLEK certificate."
 	GCPSEVSNPDoc.Fields[6].Comments[encoder.LineComment] = "AMD Signing Key certificate used to verify the SEV-SNP VCEK / VLEK certificate."
+	GCPSEVSNPDoc.Fields[7].Name = "amdCRL"
+	GCPSEVSNPDoc.Fields[7].Type = "CRL"
+	GCPSEVSNPDoc.Fields[7].Note = ""
+	GCPSEVSNPDoc.Fields[7].Description = "AMD certificate revocation list (CRL) used to check the SEV-SNP certificate chain for revoked certificates. If empty, the CRL is retrieved from the AMD KDS."
+	GCPSEVSNPDoc.Fields[7].Comments[encoder.LineComment] = "AMD certificate revocation list (CRL) used to check the SEV-SNP certificate chain for revoked certificates. If empty, the CRL is retrieved from the AMD KDS."
+	GCPSEVSNPDoc.Fields[8].Name = "requireCRL"
+	GCPSEVSNPDoc.Fields[8].Type = "bool"
+	GCPSEVSNPDoc.Fields[8].Note = ""
+	GCPSEVSNPDoc.Fields[8].Description = "Fail attestation if no valid AMD certificate revocation list is available. If false, a missing CRL is only logged as a warning."
+	GCPSEVSNPDoc.Fields[8].Comments[encoder.LineComment] = "Fail attestation if no valid AMD certificate revocation list is available. If false, a missing CRL is only logged as a warning."
+	GCPSEVSNPDoc.Fields[9].Name = "policy"
+	GCPSEVSNPDoc.Fields[9].Type = "[]Rule"
+	GCPSEVSNPDoc.Fields[9].Note = ""
+	GCPSEVSNPDoc.Fields[9].Description = "Optional attestation policy. Each rule is a CEL expression over the claims of the attestation, which must evaluate to true for the attestation to succeed."
+	GCPSEVSNPDoc.Fields[9].Comments[encoder.LineComment] = "Optional attestation policy. Each rule is a CEL expression over the claims of the attestation, which must evaluate to true for the attestation to succeed."
 
 	QEMUVTPMDoc.Type = "QEMUVTPM"
 	QEMUVTPMDoc.Comments[encoder.LineComment] = "QEMUVTPM is the configuration for QEMU vTPM attestation."
@@ -589,12 +609,17 @@ func init() {
 			FieldName: "qemuVTPM",
 		},
 	}
-	QEMUVTPMDoc.Fields = make([]encoder.Doc, 1)
+	QEMUVTPMDoc.Fields = make([]encoder.Doc, 2)
 	QEMUVTPMDoc.Fields[0].Name = "measurements"
 	QEMUVTPMDoc.Fields[0].Type = "M"
 	QEMUVTPMDoc.Fields[0].Note = ""
 	QEMUVTPMDoc.Fields[0].Description = "Expected TPM measurements."
 	QEMUVTPMDoc.Fields[0].Comments[encoder.LineComment] = "Expected TPM measurements."
+	QEMUVTPMDoc.Fields[1].Name = "policy"
+	QEMUVTPMDoc.Fields[1].Type = "[]Rule"
+	QEMUVTPMDoc.Fields[1].Note = ""
+	QEMUVTPMDoc.Fields[1].Description = "Optional attestation policy. Each rule is a CEL expression over the claims of the attestation, which must evaluate to true for the attestation to succeed."
+	QEMUVTPMDoc.Fields[1].Comments[encoder.LineComment] = "Optional attestation policy. Each rule is a CEL expression over the claims of the attestation, which must evaluate to true for the attestation to succeed."
 
 	QEMUTDXDoc.Type = "QEMUTDX"
 	QEMUTDXDoc.Comments[encoder.LineComment] = "QEMUTDX is the configuration for QEMU TDX attestation."
@@ -605,12 +630,17 @@ func init() {
 			FieldName: "qemuTDX",
 		},
 	}
-	QEMUTDXDoc.Fields = make([]encoder.Doc, 1)
+	QEMUTDXDoc.Fields = make([]encoder.Doc, 2)
 	QEMUTDXDoc.Fields[0].Name = "measurements"
 	QEMUTDXDoc.Fields[0].Type = "M"
 	QEMUTDXDoc.Fields[0].Note = ""
 	QEMUTDXDoc.Fields[0].Description = "Expected TDX measurements."
 	QEMUTDXDoc.Fields[0].Comments[encoder.LineComment] = "Expected TDX measurements."
+	QEMUTDXDoc.Fields[1].Name = "policy"
+	QEMUTDXDoc.Fields[1].Type = "[]Rule"
+	QEMUTDXDoc.Fields[1].Note = ""
+	QEMUTDXDoc.Fields[1].Description = "Optional attestation policy. Each rule is a CEL expression over the claims of the attestation, which must evaluate to true for the attestation to succeed."
+	QEMUTDXDoc.Fields[1].Comments[encoder.LineComment] = "Optional attestation policy. Each rule is a CEL expression over the claims of the attestation, which must evaluate to true for the attestation to succeed."
 
 	AWSSEVSNPDoc.Type = "AWSSEVSNP"
 	AWSSEVSNPDoc.Comments[encoder.LineComment] = "AWSSEVSNP is the configuration for AWS SEV-SNP attestation."
@@ -621,7 +651,7 @@ func init() {
 			FieldName: "awsSEVSNP",
 		},
 	}
-	AWSSEVSNPDoc.Fields = make([]encoder.Doc, 7)
+	AWSSEVSNPDoc.Fields = make([]encoder.Doc, 10)
 	AWSSEVSNPDoc.Fields[0].Name = "measurements"
 	AWSSEVSNPDoc.Fields[0].Type = "M"
 	AWSSEVSNPDoc.Fields[0].Note = ""
@@ -657,6 +687,21 @@ func init() {
 	AWSSEVSNPDoc.Fields[6].Note = ""
 	AWSSEVSNPDoc.Fields[6].Description = "AMD Signing Key certificate used to verify the SEV-SNP VCEK / VLEK certificate."
 	AWSSEVSNPDoc.Fields[6].Comments[encoder.LineComment] = "AMD Signing Key certificate used to verify the SEV-SNP VCEK / VLEK certificate."
+	AWSSEVSNPDoc.Fields[7].Name = "amdCRL"
+	AWSSEVSNPDoc.Fields[7].Type = "CRL"
+	AWSSEVSNPDoc.Fields[7].Note = ""
+	AWSSEVSNPDoc.Fields[7].Description = "AMD certificate revocation list (CRL) used to check the SEV-SNP certificate chain for revoked certificates. If empty, the CRL is retrieved from the AMD KDS."
+	AWSSEVSNPDoc.Fields[7].Comments[encoder.LineComment] = "AMD certificate revocation list (CRL) used to check the SEV-SNP certificate chain for revoked certificates. If empty, the CRL is retrieved from the AMD KDS."
+	AWSSEVSNPDoc.Fields[8].Name = "requireCRL"
+	AWSSEVSNPDoc.Fields[8].Type = "bool"
+	AWSSEVSNPDoc.Fields[8].Note = ""
+	AWSSEVSNPDoc.Fields[8].Description = "Fail attestation if no valid AMD certificate revocation list is available. If false, a missing CRL is only logged as a warning."
+	AWSSEVSNPDoc.Fields[8].Comments[encoder.LineComment] = "Fail attestation if no valid AMD certificate revocation list is available. If false, a missing CRL is only logged as a warning."
+	AWSSEVSNPDoc.Fields[9].Name = "policy"
+	AWSSEVSNPDoc.Fields[9].Type = "[]Rule"
+	AWSSEVSNPDoc.Fields[9].Note = ""
+	AWSSEVSNPDoc.Fields[9].Description = "Optional attestation policy. Each rule is a CEL expression over the claims of the attestation, which must evaluate to true for the attestation to succeed."
+	AWSSEVSNPDoc.Fields[9].Comments[encoder.LineComment] = "Optional attestation policy. Each rule is a CEL expression over the claims of the attestation, which must evaluate to true for the attestation to succeed."
 
 	AWSNitroTPMDoc.Type = "AWSNitroTPM"
 	AWSNitroTPMDoc.Comments[encoder.LineComment] = "AWSNitroTPM is the configuration for AWS Nitro TPM attestation."
@@ -667,12 +712,17 @@ func init() {
 			FieldName: "awsNitroTPM",
 		},
 	}
-	AWSNitroTPMDoc.Fields = make([]encoder.Doc, 1)
+	AWSNitroTPMDoc.Fields = make([]encoder.Doc, 2)
 	AWSNitroTPMDoc.Fields[0].Name = "measurements"
 	AWSNitroTPMDoc.Fields[0].Type = "M"
 	AWSNitroTPMDoc.Fields[0].Note = ""
 	AWSNitroTPMDoc.Fields[0].Description = "Expected TPM measurements."
 	AWSNitroTPMDoc.Fields[0].Comments[encoder.LineComment] = "Expected TPM measurements."
+	AWSNitroTPMDoc.Fields[1].Name = "policy"
+	AWSNitroTPMDoc.Fields[1].Type = "[]Rule"
+	AWSNitroTPMDoc.Fields[1].Note = ""
+	AWSNitroTPMDoc.Fields[1].Description = "Optional attestation policy. Each rule is a CEL expression over the claims of the attestation, which must evaluate to true for the attestation to succeed."
+	AWSNitroTPMDoc.Fields[1].Comments[encoder.LineComment] = "Optional attestation policy. Each rule is a CEL expression over the claims of the attestation, which must evaluate to true for the attestation to succeed."
 
 	AzureSEVSNPDoc.Type = "AzureSEVSNP"
 	AzureSEVSNPDoc.Comments[encoder.LineComment] = "AzureSEVSNP is the configuration for Azure SEV-SNP attestation."
@@ -683,7 +733,7 @@ func init() {
 			FieldName: "azureSEVSNP",
 		},
 	}
-	AzureSEVSNPDoc.Fields = make([]encoder.Doc, 8)
+	AzureSEVSNPDoc.Fields = make([]encoder.Doc, 11)
 	AzureSEVSNPDoc.Fields[0].Name = "measurements"
 	AzureSEVSNPDoc.Fields[0].Type = "M"
 	AzureSEVSNPDoc.Fields[0].Note = ""
@@ -724,6 +774,21 @@ func init() {
 	AzureSEVSNPDoc.Fields[7].Note = ""
 	AzureSEVSNPDoc.Fields[7].Description = "AMD Signing Key certificate used to verify the SEV-SNP VCEK / VLEK certificate."
 	AzureSEVSNPDoc.Fields[7].Comments[encoder.LineComment] = "AMD Signing Key certificate used to verify the SEV-SNP VCEK / VLEK certificate."
+	AzureSEVSNPDoc.Fields[8].Name = "amdCRL"
+	AzureSEVSNPDoc.Fields[8].Type = "CRL"
+	AzureSEVSNPDoc.Fields[8].Note = ""
+	AzureSEVSNPDoc.Fields[8].Description = "AMD certificate revocation list (CRL) used to check the SEV-SNP certificate chain for revoked certificates. If empty, the CRL is retrieved from the AMD KDS."
+	AzureSEVSNPDoc.Fields[8].Comments[encoder.LineComment] = "AMD certificate revocation list (CRL) used to check the SEV-SNP certificate chain for revoked certificates. If empty, the CRL is retrieved from the AMD KDS."
+	AzureSEVSNPDoc.Fields[9].Name = "requireCRL"
+	AzureSEVSNPDoc.Fields[9].Type = "bool"
+	AzureSEVSNPDoc.Fields[9].Note = ""
+	AzureSEVSNPDoc.Fields[9].Description = "Fail attestation if no valid AMD certificate revocation list is available. If false, a missing CRL is only logged as a warning."
+	AzureSEVSNPDoc.Fields[9].Comments[encoder.LineComment] = "Fail attestation if no valid AMD certificate revocation list is available. If false, a missing CRL is only logged as a warning."
+	AzureSEVSNPDoc.Fields[10].Name = "policy"
+	AzureSEVSNPDoc.Fields[10].Type = "[]Rule"
+	AzureSEVSNPDoc.Fields[10].Note = ""
+	AzureSEVSNPDoc.Fields[10].Description = "Optional attestation policy. Each rule is a CEL expression over the claims of the attestation, which must evaluate to true for the attestation to succeed."
+	AzureSEVSNPDoc.Fields[10].Comments[encoder.LineComment] = "Optional attestation policy. Each rule is a CEL expression over the claims of the attestation, which must evaluate to true for the attestation to succeed."
 
 	AzureTrustedLaunchDoc.Type = "AzureTrustedLaunch"
 	AzureTrustedLaunchDoc.Comments[encoder.LineComment] = "AzureTrustedLaunch is the configuration for Azure Trusted Launch attestation."
@@ -734,12 +799,17 @@ func init() {
 			FieldName: "azureTrustedLaunch",
 		},
 	}
-	AzureTrustedLaunchDoc.Fields = make([]encoder.Doc, 1)
+	AzureTrustedLaunchDoc.Fields = make([]encoder.Doc, 2)
 	AzureTrustedLaunchDoc.Fields[0].Name = "measurements"
 	AzureTrustedLaunchDoc.Fields[0].Type = "M"
 	AzureTrustedLaunchDoc.Fields[0].Note = ""
 	AzureTrustedLaunchDoc.Fields[0].Description = "Expected TPM measurements."
 	AzureTrustedLaunchDoc.Fields[0].Comments[encoder.LineComment] = "Expected TPM measurements."
+	AzureTrustedLaunchDoc.Fields[1].Name = "policy"
+	AzureTrustedLaunchDoc.Fields[1].Type = "[]Rule"
+	AzureTrustedLaunchDoc.Fields[1].Note = ""
+	AzureTrustedLaunchDoc.Fields[1].Description = "Optional attestation policy. Each rule is a CEL expression over the claims of the attestation, which must evaluate to true for the attestation to succeed."
+	AzureTrustedLaunchDoc.Fields[1].Comments[encoder.LineComment] = "Optional attestation policy. Each rule is a CEL expression over the claims of the attestation, which must evaluate to true for the attestation to succeed."
 
 	AzureTDXDoc.Type = "AzureTDX"
 	AzureTDXDoc.Comments[encoder.LineComment] = "AzureTDX is the configuration for Azure TDX attestation."
@@ -750,7 +820,7 @@ func init() {
 			FieldName: "azureTDX",
 		},
 	}
-	AzureTDXDoc.Fields = make([]encoder.Doc, 8)
+	AzureTDXDoc.Fields = make([]encoder.Doc, 9)
 	AzureTDXDoc.Fields[0].Name = "measurements"
 	AzureTDXDoc.Fields[0].Type = "M"
 	AzureTDXDoc.Fields[0].Note = ""
@@ -791,6 +861,11 @@ func init() {
 	AzureTDXDoc.Fields[7].Note = ""
 	AzureTDXDoc.Fields[7].Description = "Intel Root Key certificate used to verify the TDX certificate chain."
 	AzureTDXDoc.Fields[7].Comments[encoder.LineComment] = "Intel Root Key certificate used to verify the TDX certificate chain."
+	AzureTDXDoc.Fields[8].Name = "policy"
+	AzureTDXDoc.Fields[8].Type = "[]Rule"
+	AzureTDXDoc.Fields[8].Note = ""
+	AzureTDXDoc.Fields[8].Description = "Optional attestation policy. Each rule is a CEL expression over the claims of the attestation, which must evaluate to true for the attestation to succeed."
+	AzureTDXDoc.Fields[8].Comments[encoder.LineComment] = "Optional attestation policy. Each rule is a CEL expression over the claims of the attestation, which must evaluate to true for the attestation to succeed."
 }
 
 func (_ Config) Doc() *encoder.Doc {
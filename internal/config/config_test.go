@@ -10,6 +10,7 @@ import (
 	"context"
 	"errors"
 	"reflect"
+	"strings"
 	"testing"
 
 	"github.com/go-playground/locales/en"
@@ -23,6 +24,7 @@ import (
 
 	"github.com/edgelesssys/constellation/v2/internal/api/attestationconfigapi"
 	"github.com/edgelesssys/constellation/v2/internal/attestation/measurements"
+	"github.com/edgelesssys/constellation/v2/internal/attestation/policy"
 	"github.com/edgelesssys/constellation/v2/internal/attestation/variant"
 	"github.com/edgelesssys/constellation/v2/internal/cloud/cloudprovider"
 	"github.com/edgelesssys/constellation/v2/internal/config/instancetypes"
@@ -333,6 +335,42 @@ func TestValidate(t *testing.T) {
 	const awsErrCount = 8
 	const gcpErrCount = 8
 
+	validGCPConfig := func() *Config {
+		cnf := Default()
+		cnf.RemoveProviderAndAttestationExcept(cloudprovider.GCP)
+		cnf.Image = constants.BinaryVersion().String()
+		gcp := cnf.Provider.GCP
+		gcp.Region = "test-region"
+		gcp.Project = "test-project"
+		gcp.Zone = "test-zone"
+		gcp.ServiceAccountKeyPath = "test-key-path"
+		gcp.IAMServiceAccountVM = "example@example.com"
+		cnf.Provider = ProviderConfig{}
+		cnf.Provider.GCP = gcp
+		cnf.Attestation.GCPSEVSNP.Measurements = measurements.M{
+			0: measurements.WithAllBytes(0x00, measurements.Enforce, measurements.PCRMeasurementLength),
+		}
+		cnf.NodeGroups = map[string]NodeGroup{
+			constants.ControlPlaneDefault: {
+				Role:            "control-plane",
+				Zone:            "europe-west1-b",
+				InstanceType:    "n2d-standard-4",
+				StateDiskSizeGB: 30,
+				StateDiskType:   "pd-ssd",
+				InitialCount:    3,
+			},
+			constants.WorkerDefault: {
+				Role:            "worker",
+				Zone:            "europe-west1-b",
+				InstanceType:    "n2d-standard-4",
+				StateDiskSizeGB: 30,
+				StateDiskType:   "pd-ssd",
+				InitialCount:    3,
+			},
+		}
+		return cnf
+	}
+
 	// TODO(AB#3132): refactor config validation tests
 	// Note that the `cnf.Image = ""` is a hack to align `bazel test` with `go test` behavior
 	// since first does version stamping.
@@ -455,41 +493,28 @@ func TestValidate(t *testing.T) {
 		},
 
 		"GCP config with all required fields is valid": {
+			cnf: validGCPConfig(),
+		},
+		"valid attestation policy": {
 			cnf: func() *Config {
-				cnf := Default()
-				cnf.RemoveProviderAndAttestationExcept(cloudprovider.GCP)
-				cnf.Image = constants.BinaryVersion().String()
-				gcp := cnf.Provider.GCP
-				gcp.Region = "test-region"
-				gcp.Project = "test-project"
-				gcp.Zone = "test-zone"
-				gcp.ServiceAccountKeyPath = "test-key-path"
-				gcp.IAMServiceAccountVM = "example@example.com"
-				cnf.Provider = ProviderConfig{}
-				cnf.Provider.GCP = gcp
-				cnf.Attestation.GCPSEVSNP.Measurements = measurements.M{
-					0: measurements.WithAllBytes(0x00, measurements.Enforce, measurements.PCRMeasurementLength),
+				cnf := validGCPConfig()
+				cnf.Attestation.GCPSEVSNP.Policy = []policy.Rule{
+					{Name: "kernel", Expression: `pcrs[4] in ["` + strings.Repeat("00", 32) + `"]`},
+					{Name: "microcode", Expression: `snp.reportedTcb.microcode >= 209`},
 				}
-				cnf.NodeGroups = map[string]NodeGroup{
-					constants.ControlPlaneDefault: {
-						Role:            "control-plane",
-						Zone:            "europe-west1-b",
-						InstanceType:    "n2d-standard-4",
-						StateDiskSizeGB: 30,
-						StateDiskType:   "pd-ssd",
-						InitialCount:    3,
-					},
-					constants.WorkerDefault: {
-						Role:            "worker",
-						Zone:            "europe-west1-b",
-						InstanceType:    "n2d-standard-4",
-						StateDiskSizeGB: 30,
-						StateDiskType:   "pd-ssd",
-						InitialCount:    3,
-					},
+				return cnf
+			}(),
+		},
+		"invalid attestation policy": {
+			cnf: func() *Config {
+				cnf := validGCPConfig()
+				cnf.Attestation.GCPSEVSNP.Policy = []policy.Rule{
+					{Name: "broken", Expression: `pcrs[4] ==`},
 				}
 				return cnf
 			}(),
+			wantErr:      true,
+			wantErrCount: 1,
 		},
 		"miniup default config is not valid because image and measurements are missing in OSS": {
 			cnf: func() *Config {
@@ -22,6 +22,7 @@ import (
 
 	"github.com/edgelesssys/constellation/v2/internal/api/versionsapi"
 	"github.com/edgelesssys/constellation/v2/internal/attestation/measurements"
+	"github.com/edgelesssys/constellation/v2/internal/attestation/policy"
 	"github.com/edgelesssys/constellation/v2/internal/attestation/variant"
 	"github.com/edgelesssys/constellation/v2/internal/cloud/cloudprovider"
 	"github.com/edgelesssys/constellation/v2/internal/compatibility"
@@ -624,6 +625,30 @@ func validateMeasurement(sl validator.StructLevel) {
 	}
 }
 
+// validateAttestationPolicy checks that the rules of the attestation policy compile.
+func validateAttestationPolicy(fl validator.FieldLevel) bool {
+	rules, ok := fl.Field().Interface().([]policy.Rule)
+	if !ok {
+		return false
+	}
+	_, err := policy.New(rules)
+	return err == nil
+}
+
+func registerAttestationPolicyError(ut ut.Translator) error {
+	return ut.Add("attestation_policy", "{0}: invalid attestation policy: {1}", true)
+}
+
+func translateAttestationPolicyError(ut ut.Translator, fe validator.FieldError) string {
+	var msg string
+	rules, _ := fe.Value().([]policy.Rule)
+	if _, err := policy.New(rules); err != nil {
+		msg = err.Error()
+	}
+	t, _ := ut.T("attestation_policy", fe.Field(), msg)
+	return t
+}
+
 func registerContainsPlaceholderError(ut ut.Translator) error {
 	return ut.Add("no_placeholders", "{0} placeholder values (repeated 1234...)", true)
 }
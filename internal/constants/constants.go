@@ -32,6 +32,9 @@ const (
 	ConstellationMasterSecretKey = "mastersecret"
 	// ConstellationSaltKey is the name of the key for the salt in the master secret kubernetes secret.
 	ConstellationSaltKey = "salt"
+	// ConstellationMasterSecretRotationsStoreName is the name of the Kubernetes secret holding the rotated master secrets.
+	// Generation N of the master secret and salt is stored under the keys ConstellationMasterSecretKey-N and ConstellationSaltKey-N.
+	ConstellationMasterSecretRotationsStoreName = "constellation-mastersecret-rotations"
 	// ConstellationVerifyServiceUserData is the user data that the verification service includes in the attestation.
 	ConstellationVerifyServiceUserData = "VerifyService"
 	// AttestationVariant is the name of the environment variable that contains the attestation variant.
@@ -144,12 +147,18 @@ const (
 	CertCacheAskKey = "ask"
 	// CertCacheArkKey is the name of the key holding the ARK certificate in the SEV-SNP certificate cache.
 	CertCacheArkKey = "ark"
+	// CertCacheCRLKey is the name of the key holding the AMD certificate revocation list in the SEV-SNP certificate cache.
+	CertCacheCRLKey = "crl"
 	// NodeVersionResourceName resource name used for NodeVersion in constellation-operator and CLI.
 	NodeVersionResourceName = "constellation-version"
 	// NodeKubernetesComponentsAnnotationKey is the name of the annotation holding the reference to the ConfigMap listing all K8s components.
 	NodeKubernetesComponentsAnnotationKey = "constellation.edgeless.systems/kubernetes-components"
 	// JoiningNodesConfigMapName is the name of the configMap holding the joining nodes with the components hashes the node-operator should annotate the nodes with.
 	JoiningNodesConfigMapName = "joining-nodes"
+	// KeyVersionsConfigMapName is the name prefix of the configMaps holding the versions of rotated data keys in the key service.
+	KeyVersionsConfigMapName = "key-service-key-versions"
+	// KeyServiceDaemonSetName is the name of the key service DaemonSet.
+	KeyServiceDaemonSetName = "key-service"
 
 	//
 	// CLI.
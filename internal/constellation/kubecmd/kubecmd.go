@@ -104,6 +104,11 @@ func (k *KubeCmd) UpgradeNodeImage(ctx context.Context, imageVersion semver.Semv
 	}
 
 	k.log.Debug("Updating local copy of nodeVersion image version", "oldVersion", nodeVersion.Spec.ImageVersion, "newVersion", imageVersion.String())
+	// Remember the current image, so the node operator can roll back if the canary nodes of the upgrade fail.
+	if nodeVersion.Spec.ImageReference != "" && nodeVersion.Spec.ImageReference != imageReference {
+		nodeVersion.Spec.PreviousImageReference = nodeVersion.Spec.ImageReference
+		nodeVersion.Spec.PreviousImageVersion = nodeVersion.Spec.ImageVersion
+	}
 	nodeVersion.Spec.ImageReference = imageReference
 	nodeVersion.Spec.ImageVersion = imageVersion.String()
 
@@ -209,18 +214,21 @@ func (k *KubeCmd) GetClusterAttestationConfig(ctx context.Context, variant varia
 // ApplyJoinConfig creates or updates the Constellation cluster's join-config ConfigMap.
 // This ConfigMap holds the attestation config and measurement salt of the cluster.
 // A backup of the previous attestation config is created with the suffix `_backup` in the config map data.
-func (k *KubeCmd) ApplyJoinConfig(ctx context.Context, newAttestConfig config.AttestationCfg, measurementSalt []byte) error {
-	newConfigJSON, err := json.Marshal(newAttestConfig)
-	if err != nil {
-		return fmt.Errorf("marshaling attestation config: %w", err)
-	}
-
+// If the measurements change while the cluster uses another image than imageVersion, the previous measurements
+// stay allowed for the image currently used by the cluster, so that nodes can keep joining during the image upgrade.
+// The node operator prunes these values once the upgrade is completed.
+func (k *KubeCmd) ApplyJoinConfig(ctx context.Context, newAttestConfig config.AttestationCfg, measurementSalt []byte, imageVersion semver.Semver) error {
 	joinConfig, err := k.retryGetJoinConfig(ctx)
 	if err != nil {
 		if !k8serrors.IsNotFound(err) {
 			return fmt.Errorf("getting %s ConfigMap: %w", constants.JoinConfigMap, err)
 		}
 
+		newConfigJSON, err := json.Marshal(newAttestConfig)
+		if err != nil {
+			return fmt.Errorf("marshaling attestation config: %w", err)
+		}
+
 		k.log.Debug("ConfigMap does not exist, creating it now", "name", constants.JoinConfigMap, "namespace", constants.ConstellationNamespace)
 		if err := k.retryAction(ctx, func(ctx context.Context) error {
 			return k.kubectl.CreateConfigMap(ctx, joinConfigMap(newConfigJSON, measurementSalt))
@@ -231,6 +239,15 @@ func (k *KubeCmd) ApplyJoinConfig(ctx context.Context, newAttestConfig config.At
 		return nil
 	}
 
+	newAttestConfig, err = k.allowPreviousMeasurements(ctx, newAttestConfig, joinConfig.Data[constants.AttestationConfigFilename], imageVersion)
+	if err != nil {
+		return fmt.Errorf("allowing previous measurements: %w", err)
+	}
+	newConfigJSON, err := json.Marshal(newAttestConfig)
+	if err != nil {
+		return fmt.Errorf("marshaling attestation config: %w", err)
+	}
+
 	// create backup of previous config
 	joinConfig.Data[constants.AttestationConfigFilename+"_backup"] = joinConfig.Data[constants.AttestationConfigFilename]
 	joinConfig.Data[constants.AttestationConfigFilename] = string(newConfigJSON)
@@ -245,6 +262,53 @@ func (k *KubeCmd) ApplyJoinConfig(ctx context.Context, newAttestConfig config.At
 	return nil
 }
 
+// allowPreviousMeasurements returns a copy of the new attestation config, whose measurements also allow the values
+// of the previous attestation config.
+// The expected values of the previous config are only allowed if the cluster uses another image than imageVersion.
+// Values that were already allowed by the previous config are always carried over.
+func (k *KubeCmd) allowPreviousMeasurements(
+	ctx context.Context, newAttestConfig config.AttestationCfg, previousConfigJSON string, imageVersion semver.Semver,
+) (config.AttestationCfg, error) {
+	previousConfig, err := config.UnmarshalAttestationConfig([]byte(previousConfigJSON), newAttestConfig.GetVariant())
+	if err != nil {
+		k.log.Debug("Previous attestation config can't be used for the new attestation variant, not allowing previous measurements", "error", err)
+		return newAttestConfig, nil
+	}
+	previousMeasurements := previousConfig.GetMeasurements()
+	newMeasurements := newAttestConfig.GetMeasurements()
+
+	var previousImage string
+	if !previousMeasurements.EqualTo(newMeasurements) {
+		nodeVersion, err := k.getConstellationVersion(ctx)
+		switch {
+		case k8serrors.IsNotFound(err):
+			k.log.Debug("NodeVersion does not exist, not allowing previous measurements")
+		case err != nil:
+			return nil, fmt.Errorf("getting NodeVersion: %w", err)
+		case nodeVersion.Spec.ImageVersion != imageVersion.String():
+			previousImage = nodeVersion.Spec.ImageVersion
+		}
+	}
+
+	// copy the config, so the caller's config isn't modified
+	newConfigJSON, err := json.Marshal(newAttestConfig)
+	if err != nil {
+		return nil, fmt.Errorf("marshaling attestation config: %w", err)
+	}
+	mergedConfig, err := config.UnmarshalAttestationConfig(newConfigJSON, newAttestConfig.GetVariant())
+	if err != nil {
+		return nil, fmt.Errorf("unmarshaling attestation config: %w", err)
+	}
+	mergedMeasurements := mergedConfig.GetMeasurements()
+	mergedMeasurements.AllowPrevious(previousImage, previousMeasurements)
+	mergedConfig.SetMeasurements(mergedMeasurements)
+
+	if previousImage != "" {
+		k.log.Debug("Allowing measurements of the image currently used by the cluster", "image", previousImage)
+	}
+	return mergedConfig, nil
+}
+
 // ExtendClusterConfigCertSANs extends the ClusterConfig stored under "kube-system/kubeadm-config" with the given SANs.
 // Empty strings are ignored, existing SANs are preserved.
 func (k *KubeCmd) ExtendClusterConfigCertSANs(ctx context.Context, alternativeNames []string) error {
@@ -530,6 +594,10 @@ type kubectlInterface interface {
 	GetConfigMap(ctx context.Context, namespace, name string) (*corev1.ConfigMap, error)
 	UpdateConfigMap(ctx context.Context, configMap *corev1.ConfigMap) (*corev1.ConfigMap, error)
 	CreateConfigMap(ctx context.Context, configMap *corev1.ConfigMap) error
+	GetSecret(ctx context.Context, namespace, name string) (*corev1.Secret, error)
+	CreateSecret(ctx context.Context, secret *corev1.Secret) error
+	UpdateSecret(ctx context.Context, secret *corev1.Secret) (*corev1.Secret, error)
+	RestartDaemonSet(ctx context.Context, namespace, name string) error
 	KubernetesVersion() (string, error)
 	GetCR(ctx context.Context, gvr schema.GroupVersionResource, name string) (*unstructured.Unstructured, error)
 	UpdateCR(ctx context.Context, gvr schema.GroupVersionResource, obj *unstructured.Unstructured) (*unstructured.Unstructured, error)
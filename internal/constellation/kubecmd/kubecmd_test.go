@@ -7,6 +7,7 @@ SPDX-License-Identifier: BUSL-1.1
 package kubecmd
 
 import (
+	"bytes"
 	"context"
 	"encoding/json"
 	"errors"
@@ -140,6 +141,7 @@ func TestUpgradeNodeImage(t *testing.T) {
 
 			nodeVersion := updatev1alpha1.NodeVersion{
 				Spec: updatev1alpha1.NodeVersionSpec{
+					ImageReference:           fmt.Sprintf("/path/to/image:%s", tc.currentImageVersion.String()),
 					ImageVersion:             tc.currentImageVersion.String(),
 					KubernetesClusterVersion: "v1.2.3",
 				},
@@ -183,7 +185,13 @@ func TestUpgradeNodeImage(t *testing.T) {
 			err = upgrader.UpgradeNodeImage(t.Context(), tc.newImageVersion, fmt.Sprintf("/path/to/image:%s", tc.newImageVersion.String()), tc.force)
 			// Check upgrades first because if we checked err first, UpgradeImage may error due to other reasons and still trigger an upgrade.
 			if tc.wantUpdate {
-				assert.NotNil(unstructuredClient.updatedObject)
+				require.NotNil(unstructuredClient.updatedObject)
+				previousImage, _, err := unstructured.NestedString(unstructuredClient.updatedObject.Object, "spec", "previousImage")
+				require.NoError(err)
+				assert.Equal(fmt.Sprintf("/path/to/image:%s", tc.currentImageVersion.String()), previousImage)
+				previousImageVersion, _, err := unstructured.NestedString(unstructuredClient.updatedObject.Object, "spec", "previousImageVersion")
+				require.NoError(err)
+				assert.Equal(tc.currentImageVersion.String(), previousImageVersion)
 			} else {
 				assert.Nil(unstructuredClient.updatedObject)
 			}
@@ -462,6 +470,7 @@ func TestApplyJoinConfig(t *testing.T) {
 		newAttestationCfg config.AttestationCfg
 		kubectl           *fakeConfigMapClient
 		wantUpdate        bool
+		wantAttestation   config.AttestationCfg
 		wantErr           bool
 	}{
 		"success": {
@@ -481,6 +490,108 @@ func TestApplyJoinConfig(t *testing.T) {
 			},
 			wantUpdate: true,
 		},
+		"previous measurements are allowed during image upgrade": {
+			newAttestationCfg: &config.QEMUVTPM{
+				Measurements: measurements.M{
+					0: measurements.WithAllBytes(0x00, measurements.WarnOnly, measurements.PCRMeasurementLength),
+					1: measurements.WithAllBytes(0x11, measurements.Enforce, measurements.PCRMeasurementLength),
+				},
+			},
+			kubectl: &fakeConfigMapClient{
+				configMaps: map[string]*corev1.ConfigMap{
+					constants.JoinConfigMap: newJoinConfigMap(mustMarshal(&config.QEMUVTPM{
+						Measurements: measurements.M{
+							0: measurements.WithAllBytes(0xFF, measurements.WarnOnly, measurements.PCRMeasurementLength),
+							1: measurements.WithAllBytes(0x11, measurements.Enforce, measurements.PCRMeasurementLength),
+						},
+					})),
+				},
+				nodeVersion: &updatev1alpha1.NodeVersion{Spec: updatev1alpha1.NodeVersionSpec{ImageVersion: "v1.1.0"}},
+			},
+			wantUpdate: true,
+			wantAttestation: &config.QEMUVTPM{
+				Measurements: measurements.M{
+					0: {
+						Expected:      bytes.Repeat([]byte{0x00}, measurements.PCRMeasurementLength),
+						ValidationOpt: measurements.WarnOnly,
+						Allowed: []measurements.ImageValue{
+							{Image: "v1.1.0", Value: bytes.Repeat([]byte{0xFF}, measurements.PCRMeasurementLength)},
+						},
+					},
+					1: measurements.WithAllBytes(0x11, measurements.Enforce, measurements.PCRMeasurementLength),
+				},
+			},
+		},
+		"previous measurements are not allowed for the same image": {
+			newAttestationCfg: &config.QEMUVTPM{
+				Measurements: measurements.M{
+					0: measurements.WithAllBytes(0x00, measurements.WarnOnly, measurements.PCRMeasurementLength),
+				},
+			},
+			kubectl: &fakeConfigMapClient{
+				configMaps: map[string]*corev1.ConfigMap{
+					constants.JoinConfigMap: newJoinConfigMap(mustMarshal(&config.QEMUVTPM{
+						Measurements: measurements.M{
+							0: measurements.WithAllBytes(0xFF, measurements.WarnOnly, measurements.PCRMeasurementLength),
+						},
+					})),
+				},
+				nodeVersion: &updatev1alpha1.NodeVersion{Spec: updatev1alpha1.NodeVersionSpec{ImageVersion: "v1.2.0"}},
+			},
+			wantUpdate: true,
+		},
+		"allowed measurements are carried over": {
+			newAttestationCfg: &config.QEMUVTPM{
+				Measurements: measurements.M{
+					0: measurements.WithAllBytes(0x00, measurements.WarnOnly, measurements.PCRMeasurementLength),
+				},
+			},
+			kubectl: &fakeConfigMapClient{
+				configMaps: map[string]*corev1.ConfigMap{
+					constants.JoinConfigMap: newJoinConfigMap(mustMarshal(&config.QEMUVTPM{
+						Measurements: measurements.M{
+							0: {
+								Expected:      bytes.Repeat([]byte{0x00}, measurements.PCRMeasurementLength),
+								ValidationOpt: measurements.WarnOnly,
+								Allowed: []measurements.ImageValue{
+									{Image: "v1.1.0", Value: bytes.Repeat([]byte{0xFF}, measurements.PCRMeasurementLength)},
+								},
+							},
+						},
+					})),
+				},
+			},
+			wantUpdate: true,
+			wantAttestation: &config.QEMUVTPM{
+				Measurements: measurements.M{
+					0: {
+						Expected:      bytes.Repeat([]byte{0x00}, measurements.PCRMeasurementLength),
+						ValidationOpt: measurements.WarnOnly,
+						Allowed: []measurements.ImageValue{
+							{Image: "v1.1.0", Value: bytes.Repeat([]byte{0xFF}, measurements.PCRMeasurementLength)},
+						},
+					},
+				},
+			},
+		},
+		"Get NodeVersion error": {
+			newAttestationCfg: &config.QEMUVTPM{
+				Measurements: measurements.M{
+					0: measurements.WithAllBytes(0x00, measurements.WarnOnly, measurements.PCRMeasurementLength),
+				},
+			},
+			kubectl: &fakeConfigMapClient{
+				configMaps: map[string]*corev1.ConfigMap{
+					constants.JoinConfigMap: newJoinConfigMap(mustMarshal(&config.QEMUVTPM{
+						Measurements: measurements.M{
+							0: measurements.WithAllBytes(0xFF, measurements.WarnOnly, measurements.PCRMeasurementLength),
+						},
+					})),
+				},
+				getCRErr: assert.AnError,
+			},
+			wantErr: true,
+		},
 		"Get ConfigMap error": {
 			newAttestationCfg: &config.QEMUVTPM{
 				Measurements: measurements.M{
@@ -603,7 +714,7 @@ func TestApplyJoinConfig(t *testing.T) {
 				maxAttempts:   5,
 			}
 
-			err := cmd.ApplyJoinConfig(t.Context(), tc.newAttestationCfg, []byte{0x11})
+			err := cmd.ApplyJoinConfig(t.Context(), tc.newAttestationCfg, []byte{0x11}, semver.NewFromInt(1, 2, 0, ""))
 			if tc.wantErr {
 				assert.Error(err)
 				return
@@ -618,7 +729,11 @@ func TestApplyJoinConfig(t *testing.T) {
 				cfg, ok = tc.kubectl.configMaps[constants.JoinConfigMap]
 			}
 			require.True(ok)
-			assert.Equal(mustMarshal(tc.newAttestationCfg), cfg.Data[constants.AttestationConfigFilename])
+			wantAttestation := tc.wantAttestation
+			if wantAttestation == nil {
+				wantAttestation = tc.newAttestationCfg
+			}
+			assert.Equal(mustMarshal(wantAttestation), cfg.Data[constants.AttestationConfigFilename])
 		})
 	}
 }
@@ -780,6 +895,12 @@ type stubKubectl struct {
 	getCRDsError      error
 	crs               []unstructured.Unstructured
 	getCRsError       error
+	secrets           map[string]*corev1.Secret
+	getSecretErr      error
+	storedSecrets     map[string]*corev1.Secret
+	storeSecretErr    error
+	restartedDaemons  []string
+	restartErr        error
 }
 
 func (s *stubKubectl) GetConfigMap(_ context.Context, _, name string) (*corev1.ConfigMap, error) {
@@ -802,6 +923,44 @@ func (s *stubKubectl) CreateConfigMap(_ context.Context, configMap *corev1.Confi
 	return s.createCMErr
 }
 
+func (s *stubKubectl) GetSecret(_ context.Context, _, name string) (*corev1.Secret, error) {
+	if s.getSecretErr != nil {
+		return nil, s.getSecretErr
+	}
+	secret, ok := s.secrets[name]
+	if !ok {
+		return nil, k8serrors.NewNotFound(schema.GroupResource{}, name)
+	}
+	return secret.DeepCopy(), nil
+}
+
+func (s *stubKubectl) CreateSecret(_ context.Context, secret *corev1.Secret) error {
+	if _, ok := s.secrets[secret.Name]; ok {
+		return k8serrors.NewAlreadyExists(schema.GroupResource{}, secret.Name)
+	}
+	return s.storeSecret(secret)
+}
+
+func (s *stubKubectl) UpdateSecret(_ context.Context, secret *corev1.Secret) (*corev1.Secret, error) {
+	return secret, s.storeSecret(secret)
+}
+
+func (s *stubKubectl) storeSecret(secret *corev1.Secret) error {
+	if s.storeSecretErr != nil {
+		return s.storeSecretErr
+	}
+	if s.storedSecrets == nil {
+		s.storedSecrets = map[string]*corev1.Secret{}
+	}
+	s.storedSecrets[secret.Name] = secret
+	return nil
+}
+
+func (s *stubKubectl) RestartDaemonSet(_ context.Context, _, name string) error {
+	s.restartedDaemons = append(s.restartedDaemons, name)
+	return s.restartErr
+}
+
 func (s *stubKubectl) KubernetesVersion() (string, error) {
 	return s.k8sVersion, s.k8sErr
 }
@@ -823,9 +982,21 @@ type fakeConfigMapClient struct {
 	updateErrs        []error
 	configMaps        map[string]*corev1.ConfigMap
 	createErrs        []error
+	nodeVersion       *updatev1alpha1.NodeVersion
+	getCRErr          error
 	kubectlInterface
 }
 
+func (f *fakeConfigMapClient) GetCR(_ context.Context, _ schema.GroupVersionResource, name string) (*unstructured.Unstructured, error) {
+	if f.getCRErr != nil {
+		return nil, f.getCRErr
+	}
+	if f.nodeVersion == nil {
+		return nil, k8serrors.NewNotFound(schema.GroupResource{}, name)
+	}
+	return unstructedObjectWithGeneration(*f.nodeVersion, 1), nil
+}
+
 func (f *fakeConfigMapClient) GetConfigMap(_ context.Context, _, name string) (*corev1.ConfigMap, error) {
 	if len(f.getErrs) > 0 {
 		err := f.getErrs[0]
@@ -0,0 +1,119 @@
+/*
+Copyright (c) Edgeless Systems GmbH
+
+SPDX-License-Identifier: BUSL-1.1
+*/
+
+package kubecmd
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+
+	"github.com/edgelesssys/constellation/v2/internal/constants"
+	"github.com/edgelesssys/constellation/v2/internal/kms/uri"
+	corev1 "k8s.io/api/core/v1"
+	k8serrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+// ErrMasterSecretMismatch is returned if the master secret doesn't belong to the cluster.
+var ErrMasterSecretMismatch = errors.New("master secret doesn't match the master secret of the cluster")
+
+// ApplyMasterSecret adds the rotations of the given master secret to the cluster.
+// The initial master secret and all rotations known to the cluster must match the given master secret.
+// If rotations were added, the key service is restarted to use the latest master secret for new key versions.
+// It reports whether rotations were added.
+func (k *KubeCmd) ApplyMasterSecret(ctx context.Context, masterSecret uri.MasterSecret) (bool, error) {
+	var initial *corev1.Secret
+	if err := k.retryAction(ctx, func(ctx context.Context) error {
+		var err error
+		initial, err = k.kubectl.GetSecret(ctx, constants.ConstellationNamespace, constants.ConstellationMasterSecretStoreName)
+		return err
+	}); err != nil {
+		return false, fmt.Errorf("getting %s Secret: %w", constants.ConstellationMasterSecretStoreName, err)
+	}
+	if !bytes.Equal(initial.Data[constants.ConstellationMasterSecretKey], masterSecret.Key) ||
+		!bytes.Equal(initial.Data[constants.ConstellationSaltKey], masterSecret.Salt) {
+		return false, ErrMasterSecretMismatch
+	}
+
+	rotations, err := k.kubectl.GetSecret(ctx, constants.ConstellationNamespace, constants.ConstellationMasterSecretRotationsStoreName)
+	if err != nil && !k8serrors.IsNotFound(err) {
+		return false, fmt.Errorf("getting %s Secret: %w", constants.ConstellationMasterSecretRotationsStoreName, err)
+	}
+	exists := err == nil
+	if !exists {
+		rotations = &corev1.Secret{
+			ObjectMeta: metav1.ObjectMeta{
+				Name:      constants.ConstellationMasterSecretRotationsStoreName,
+				Namespace: constants.ConstellationNamespace,
+			},
+			Type: corev1.SecretTypeOpaque,
+		}
+	}
+	if rotations.Data == nil {
+		rotations.Data = map[string][]byte{}
+	}
+
+	clusterGeneration := masterSecretGeneration(rotations)
+	if clusterGeneration > masterSecret.Generation() {
+		return false, fmt.Errorf("cluster uses master secret generation %d, but the master secret only has %d generations: %w",
+			clusterGeneration, masterSecret.Generation(), ErrMasterSecretMismatch)
+	}
+	for i, rotation := range masterSecret.Rotations {
+		generation := i + 1
+		keyName, saltName := masterSecretRotationKeys(generation)
+		if uint32(generation) <= clusterGeneration {
+			if !bytes.Equal(rotations.Data[keyName], rotation.Key) || !bytes.Equal(rotations.Data[saltName], rotation.Salt) {
+				return false, fmt.Errorf("master secret generation %d: %w", generation, ErrMasterSecretMismatch)
+			}
+			continue
+		}
+		rotations.Data[keyName] = rotation.Key
+		rotations.Data[saltName] = rotation.Salt
+	}
+	if clusterGeneration == masterSecret.Generation() {
+		k.log.Debug("Master secret is up to date", "generation", clusterGeneration)
+		return false, nil
+	}
+
+	k.log.Debug("Rotating master secret", "oldGeneration", clusterGeneration, "newGeneration", masterSecret.Generation())
+	if err := k.retryAction(ctx, func(ctx context.Context) error {
+		if exists {
+			_, err := k.kubectl.UpdateSecret(ctx, rotations)
+			return err
+		}
+		return k.kubectl.CreateSecret(ctx, rotations)
+	}); err != nil {
+		return false, fmt.Errorf("storing rotated master secret: %w", err)
+	}
+
+	k.log.Debug("Restarting key service")
+	if err := k.retryAction(ctx, func(ctx context.Context) error {
+		return k.kubectl.RestartDaemonSet(ctx, constants.ConstellationNamespace, constants.KeyServiceDaemonSetName)
+	}); err != nil {
+		return false, fmt.Errorf("restarting key service: %w", err)
+	}
+	return true, nil
+}
+
+// masterSecretGeneration returns the latest generation of the master secret stored in the rotations Secret.
+func masterSecretGeneration(rotations *corev1.Secret) uint32 {
+	var generation uint32
+	for {
+		keyName, _ := masterSecretRotationKeys(int(generation) + 1)
+		if _, ok := rotations.Data[keyName]; !ok {
+			return generation
+		}
+		generation++
+	}
+}
+
+// masterSecretRotationKeys returns the keys of a generation of the master secret and salt in the rotations Secret.
+func masterSecretRotationKeys(generation int) (string, string) {
+	return fmt.Sprintf("%s-%d", constants.ConstellationMasterSecretKey, generation),
+		fmt.Sprintf("%s-%d", constants.ConstellationSaltKey, generation)
+}
@@ -0,0 +1,154 @@
+/*
+Copyright (c) Edgeless Systems GmbH
+
+SPDX-License-Identifier: BUSL-1.1
+*/
+
+package kubecmd
+
+import (
+	"testing"
+	"time"
+
+	"github.com/edgelesssys/constellation/v2/internal/constants"
+	"github.com/edgelesssys/constellation/v2/internal/kms/uri"
+	"github.com/edgelesssys/constellation/v2/internal/logger"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+func TestApplyMasterSecret(t *testing.T) {
+	initialSecret := &corev1.Secret{
+		ObjectMeta: metav1.ObjectMeta{Name: constants.ConstellationMasterSecretStoreName},
+		Data: map[string][]byte{
+			constants.ConstellationMasterSecretKey: []byte("key"),
+			constants.ConstellationSaltKey:         []byte("salt"),
+		},
+	}
+	rotationsSecret := &corev1.Secret{
+		ObjectMeta: metav1.ObjectMeta{Name: constants.ConstellationMasterSecretRotationsStoreName},
+		Data: map[string][]byte{
+			constants.ConstellationMasterSecretKey + "-1": []byte("key-1"),
+			constants.ConstellationSaltKey + "-1":         []byte("salt-1"),
+		},
+	}
+	rotations := []uri.MasterSecretRotation{
+		{Key: []byte("key-1"), Salt: []byte("salt-1")},
+		{Key: []byte("key-2"), Salt: []byte("salt-2")},
+	}
+
+	testCases := map[string]struct {
+		kubectl       *stubKubectl
+		masterSecret  uri.MasterSecret
+		wantChanged   bool
+		wantRotations map[string][]byte
+		wantErr       error
+	}{
+		"first rotation": {
+			kubectl: &stubKubectl{secrets: map[string]*corev1.Secret{
+				constants.ConstellationMasterSecretStoreName: initialSecret,
+			}},
+			masterSecret: uri.MasterSecret{Key: []byte("key"), Salt: []byte("salt"), Rotations: rotations[:1]},
+			wantChanged:  true,
+			wantRotations: map[string][]byte{
+				"mastersecret-1": []byte("key-1"),
+				"salt-1":         []byte("salt-1"),
+			},
+		},
+		"second rotation": {
+			kubectl: &stubKubectl{secrets: map[string]*corev1.Secret{
+				constants.ConstellationMasterSecretStoreName:          initialSecret,
+				constants.ConstellationMasterSecretRotationsStoreName: rotationsSecret,
+			}},
+			masterSecret: uri.MasterSecret{Key: []byte("key"), Salt: []byte("salt"), Rotations: rotations},
+			wantChanged:  true,
+			wantRotations: map[string][]byte{
+				"mastersecret-1": []byte("key-1"),
+				"salt-1":         []byte("salt-1"),
+				"mastersecret-2": []byte("key-2"),
+				"salt-2":         []byte("salt-2"),
+			},
+		},
+		"up to date": {
+			kubectl: &stubKubectl{secrets: map[string]*corev1.Secret{
+				constants.ConstellationMasterSecretStoreName:          initialSecret,
+				constants.ConstellationMasterSecretRotationsStoreName: rotationsSecret,
+			}},
+			masterSecret: uri.MasterSecret{Key: []byte("key"), Salt: []byte("salt"), Rotations: rotations[:1]},
+		},
+		"initial master secret mismatch": {
+			kubectl: &stubKubectl{secrets: map[string]*corev1.Secret{
+				constants.ConstellationMasterSecretStoreName: initialSecret,
+			}},
+			masterSecret: uri.MasterSecret{Key: []byte("other"), Salt: []byte("salt"), Rotations: rotations[:1]},
+			wantErr:      ErrMasterSecretMismatch,
+		},
+		"rotation mismatch": {
+			kubectl: &stubKubectl{secrets: map[string]*corev1.Secret{
+				constants.ConstellationMasterSecretStoreName:          initialSecret,
+				constants.ConstellationMasterSecretRotationsStoreName: rotationsSecret,
+			}},
+			masterSecret: uri.MasterSecret{Key: []byte("key"), Salt: []byte("salt"), Rotations: rotations[1:]},
+			wantErr:      ErrMasterSecretMismatch,
+		},
+		"outdated master secret": {
+			kubectl: &stubKubectl{secrets: map[string]*corev1.Secret{
+				constants.ConstellationMasterSecretStoreName:          initialSecret,
+				constants.ConstellationMasterSecretRotationsStoreName: rotationsSecret,
+			}},
+			masterSecret: uri.MasterSecret{Key: []byte("key"), Salt: []byte("salt")},
+			wantErr:      ErrMasterSecretMismatch,
+		},
+		"storing fails": {
+			kubectl: &stubKubectl{
+				secrets: map[string]*corev1.Secret{
+					constants.ConstellationMasterSecretStoreName: initialSecret,
+				},
+				storeSecretErr: assert.AnError,
+			},
+			masterSecret: uri.MasterSecret{Key: []byte("key"), Salt: []byte("salt"), Rotations: rotations[:1]},
+			wantErr:      assert.AnError,
+		},
+		"restart fails": {
+			kubectl: &stubKubectl{
+				secrets: map[string]*corev1.Secret{
+					constants.ConstellationMasterSecretStoreName: initialSecret,
+				},
+				restartErr: assert.AnError,
+			},
+			masterSecret: uri.MasterSecret{Key: []byte("key"), Salt: []byte("salt"), Rotations: rotations[:1]},
+			wantErr:      assert.AnError,
+		},
+	}
+
+	for name, tc := range testCases {
+		t.Run(name, func(t *testing.T) {
+			assert := assert.New(t)
+			require := require.New(t)
+
+			cmd := &KubeCmd{
+				kubectl:       tc.kubectl,
+				log:           logger.NewTest(t),
+				retryInterval: time.Millisecond,
+				maxAttempts:   5,
+			}
+
+			changed, err := cmd.ApplyMasterSecret(t.Context(), tc.masterSecret)
+			if tc.wantErr != nil {
+				assert.ErrorIs(err, tc.wantErr)
+				return
+			}
+			require.NoError(err)
+			assert.Equal(tc.wantChanged, changed)
+			if !tc.wantChanged {
+				assert.Empty(tc.kubectl.storedSecrets)
+				assert.Empty(tc.kubectl.restartedDaemons)
+				return
+			}
+			assert.Equal(tc.wantRotations, tc.kubectl.storedSecrets[constants.ConstellationMasterSecretRotationsStoreName].Data)
+			assert.Equal([]string{constants.KeyServiceDaemonSetName}, tc.kubectl.restartedDaemons)
+		})
+	}
+}
@@ -44,12 +44,13 @@ func (a *Applier) GetClusterAttestationConfig(ctx context.Context, variant varia
 }
 
 // ApplyJoinConfig creates or updates the Constellation cluster's join-config ConfigMap.
-func (a *Applier) ApplyJoinConfig(ctx context.Context, newAttestConfig config.AttestationCfg, measurementSalt []byte) error {
+// The measurements of the image currently used by the cluster stay allowed until the upgrade to imageVersion is completed.
+func (a *Applier) ApplyJoinConfig(ctx context.Context, newAttestConfig config.AttestationCfg, measurementSalt []byte, imageVersion semver.Semver) error {
 	if a.kubecmdClient == nil {
 		return errKubecmdNotInitialised
 	}
 
-	return a.kubecmdClient.ApplyJoinConfig(ctx, newAttestConfig, measurementSalt)
+	return a.kubecmdClient.ApplyJoinConfig(ctx, newAttestConfig, measurementSalt, imageVersion)
 }
 
 // UpgradeNodeImage upgrades the node image of the cluster to the given version.
@@ -93,7 +94,7 @@ type kubecmdClient interface {
 	UpgradeKubernetesVersion(ctx context.Context, kubernetesVersion versions.ValidK8sVersion, force bool) error
 	ExtendClusterConfigCertSANs(ctx context.Context, alternativeNames []string) error
 	GetClusterAttestationConfig(ctx context.Context, variant variant.Variant) (config.AttestationCfg, error)
-	ApplyJoinConfig(ctx context.Context, newAttestConfig config.AttestationCfg, measurementSalt []byte) error
+	ApplyJoinConfig(ctx context.Context, newAttestConfig config.AttestationCfg, measurementSalt []byte, imageVersion semver.Semver) error
 	BackupCRs(ctx context.Context, fileHandler file.Handler, crds []apiextensionsv1.CustomResourceDefinition, upgradeDir string) error
 	BackupCRDs(ctx context.Context, fileHandler file.Handler, upgradeDir string) ([]apiextensionsv1.CustomResourceDefinition, error)
 }
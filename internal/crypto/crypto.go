@@ -17,6 +17,8 @@ import (
 	"fmt"
 	"io"
 	"math/big"
+	"strconv"
+	"strings"
 	"time"
 
 	"golang.org/x/crypto/hkdf"
@@ -36,8 +38,19 @@ const (
 	RNGLengthDefault = 32
 	// DEKPrefix is the prefix used to prefix DEK IDs. Originally introduced as a requirement for the HKDF info parameter.
 	DEKPrefix = "key-"
+	// VersionedDEKPrefix is the prefix of DEK IDs for rotated keys.
+	// It differs from DEKPrefix, so versioned DEK IDs never collide with the IDs of unversioned keys.
+	VersionedDEKPrefix = "versioned-key-"
 	// MeasurementSecretKeyID is name used for the measurementSecret DEK.
 	MeasurementSecretKeyID = "measurementSecret"
+	// StateDiskKeyGenerationID is the ID of the data key whose latest version is the target version of all state disk keys.
+	// Only the version of this key is used. Rotating it rotates the state disk keys of all nodes when they rejoin the cluster.
+	StateDiskKeyGenerationID = "stateDiskKeyGeneration"
+	// StateDiskRecoveryKeyPrefix is the prefix of DEK IDs for state disk recovery keys escrowed in an external KMS.
+	StateDiskRecoveryKeyPrefix = DEKPrefix + "state-disk-recovery-"
+	// StateDiskRecoveryMeasurementSecretID is the DEK ID of the measurement secret escrowed next to the state disk recovery keys.
+	// It allows retainting nodes recovered using their recovery key without a control-plane node.
+	StateDiskRecoveryMeasurementSecretID = StateDiskRecoveryKeyPrefix + "measurement-secret"
 )
 
 // DeriveKey derives a key from a secret.
@@ -50,6 +63,50 @@ func DeriveKey(secret, salt, info []byte, length uint) ([]byte, error) {
 	return key, nil
 }
 
+// VersionedDEKID returns the DEK ID for a version of a key.
+// Version 0 is the key that existed before the first rotation, its DEK ID is DEKPrefix followed by the key ID.
+func VersionedDEKID(keyID string, version uint32) string {
+	if version == 0 {
+		return DEKPrefix + keyID
+	}
+	return fmt.Sprintf("%sv%d-%s", VersionedDEKPrefix, version, keyID)
+}
+
+// keyVersionGenerationShift is the number of low bits of a key version that count the rotations of a key
+// within one generation of the master secret. The high bits are the generation of the master secret.
+const keyVersionGenerationShift = 24
+
+// FirstKeyVersion returns the first key version derived from a generation of the master secret.
+// Generation 0 is the master secret the cluster was initialized with, every rotation of the master secret adds a generation.
+func FirstKeyVersion(generation uint32) uint32 {
+	return generation << keyVersionGenerationShift
+}
+
+// KeyVersionGeneration returns the generation of the master secret a key version is derived from.
+func KeyVersionGeneration(version uint32) uint32 {
+	return version >> keyVersionGenerationShift
+}
+
+// DEKIDGeneration returns the generation of the master secret the key with the given DEK ID is derived from.
+// Only versioned DEK IDs can be derived from a rotated master secret.
+func DEKIDGeneration(dekID string) uint32 {
+	versionedID, ok := strings.CutPrefix(dekID, VersionedDEKPrefix+"v")
+	if !ok {
+		return 0
+	}
+	versionStr, _, _ := strings.Cut(versionedID, "-")
+	version, err := strconv.ParseUint(versionStr, 10, 32)
+	if err != nil {
+		return 0
+	}
+	return KeyVersionGeneration(uint32(version))
+}
+
+// StateDiskRecoveryKeyID returns the DEK ID of the escrowed recovery key for the state disk with the given UUID.
+func StateDiskRecoveryKeyID(diskUUID string) string {
+	return StateDiskRecoveryKeyPrefix + diskUUID
+}
+
 // GenerateCertificateSerialNumber generates a random serial number for an X.509 certificate.
 func GenerateCertificateSerialNumber() (*big.Int, error) {
 	serialNumberLimit := new(big.Int).Lsh(big.NewInt(1), 128)
@@ -123,3 +180,27 @@ func X509CertToPem(cert *x509.Certificate) ([]byte, error) {
 	}
 	return outWriter.Bytes(), nil
 }
+
+// PemToX509CRL takes a PEM-encoded certificate revocation list (CRL) and returns it
+// as an x.509 revocation list.
+func PemToX509CRL(raw []byte) (*x509.RevocationList, error) {
+	decoded, _ := pem.Decode(raw)
+	if decoded == nil {
+		return nil, fmt.Errorf("decoding pem: no PEM data found")
+	}
+	crl, err := x509.ParseRevocationList(decoded.Bytes)
+	if err != nil {
+		return nil, fmt.Errorf("parsing revocation list: %w", err)
+	}
+	return crl, nil
+}
+
+// X509CRLToPem takes an x.509 revocation list and returns it as a PEM-encoded CRL.
+func X509CRLToPem(crl *x509.RevocationList) ([]byte, error) {
+	outWriter := &bytes.Buffer{}
+	err := pem.Encode(outWriter, &pem.Block{Type: "X509 CRL", Bytes: crl.Raw})
+	if err != nil {
+		return nil, fmt.Errorf("encode revocation list: %w", err)
+	}
+	return outWriter.Bytes(), nil
+}
@@ -7,9 +7,15 @@ SPDX-License-Identifier: BUSL-1.1
 package crypto
 
 import (
+	"crypto/ecdsa"
 	"crypto/ed25519"
+	"crypto/elliptic"
+	"crypto/rand"
 	"crypto/x509"
+	"crypto/x509/pkix"
+	"math/big"
 	"testing"
+	"time"
 
 	"github.com/edgelesssys/constellation/v2/internal/crypto/testvector"
 	"github.com/stretchr/testify/assert"
@@ -49,6 +55,46 @@ func TestDeriveKey(t *testing.T) {
 	assert.Equal(fInput.Output, out)
 }
 
+func TestVersionedDEKID(t *testing.T) {
+	assert := assert.New(t)
+
+	assert.Equal(DEKPrefix+"volume01", VersionedDEKID("volume01", 0))
+	assert.Equal("versioned-key-v1-volume01", VersionedDEKID("volume01", 1))
+	assert.Equal("versioned-key-v12-volume01", VersionedDEKID("volume01", 12))
+
+	// Key IDs that look like versions don't lead to collisions.
+	assert.NotEqual(VersionedDEKID("v1-volume01", 0), VersionedDEKID("volume01", 1))
+	assert.NotEqual(VersionedDEKID("1-volume01", 1), VersionedDEKID("volume01", 11))
+}
+
+func TestKeyVersionGeneration(t *testing.T) {
+	testCases := map[string]struct {
+		version        uint32
+		wantGeneration uint32
+	}{
+		"initial version":               {version: 0, wantGeneration: 0},
+		"rotated version":               {version: 12, wantGeneration: 0},
+		"last version of generation":    {version: FirstKeyVersion(1) - 1, wantGeneration: 0},
+		"first version of generation":   {version: FirstKeyVersion(1), wantGeneration: 1},
+		"rotated version of generation": {version: FirstKeyVersion(2) + 3, wantGeneration: 2},
+	}
+
+	for name, tc := range testCases {
+		t.Run(name, func(t *testing.T) {
+			assert := assert.New(t)
+
+			assert.Equal(tc.wantGeneration, KeyVersionGeneration(tc.version))
+			assert.Equal(tc.wantGeneration, DEKIDGeneration(VersionedDEKID("volume01", tc.version)))
+		})
+	}
+
+	// DEK IDs that aren't versioned are derived from the initial master secret.
+	assert := assert.New(t)
+	assert.Zero(DEKIDGeneration(DEKPrefix + MeasurementSecretKeyID))
+	assert.Zero(DEKIDGeneration(VersionedDEKPrefix + "volume01"))
+	assert.Zero(DEKIDGeneration(StateDiskRecoveryKeyID("volume01")))
+}
+
 func TestVectorsHKDF(t *testing.T) {
 	testCases := map[string]struct {
 		secret  []byte
@@ -217,3 +263,50 @@ func TestX509ToPemCert(t *testing.T) {
 		})
 	}
 }
+
+func TestX509CRLPemRoundTrip(t *testing.T) {
+	assert := assert.New(t)
+	require := require.New(t)
+
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	require.NoError(err)
+	issuerTmpl := &x509.Certificate{
+		SerialNumber:          big.NewInt(1),
+		Subject:               pkix.Name{CommonName: "issuer"},
+		NotBefore:             time.Now().Add(-time.Hour),
+		NotAfter:              time.Now().Add(time.Hour),
+		KeyUsage:              x509.KeyUsageCRLSign | x509.KeyUsageCertSign,
+		BasicConstraintsValid: true,
+		IsCA:                  true,
+		SubjectKeyId:          []byte{1, 2, 3, 4},
+	}
+	issuerRaw, err := x509.CreateCertificate(rand.Reader, issuerTmpl, issuerTmpl, key.Public(), key)
+	require.NoError(err)
+	issuer, err := x509.ParseCertificate(issuerRaw)
+	require.NoError(err)
+
+	crlRaw, err := x509.CreateRevocationList(rand.Reader, &x509.RevocationList{
+		Number:     big.NewInt(1),
+		ThisUpdate: time.Now(),
+		NextUpdate: time.Now().Add(time.Hour),
+		RevokedCertificateEntries: []x509.RevocationListEntry{
+			{SerialNumber: big.NewInt(42), RevocationTime: time.Now()},
+		},
+	}, issuer, key)
+	require.NoError(err)
+	crl, err := x509.ParseRevocationList(crlRaw)
+	require.NoError(err)
+
+	pemCRL, err := X509CRLToPem(crl)
+	require.NoError(err)
+	parsed, err := PemToX509CRL(pemCRL)
+	require.NoError(err)
+	assert.Equal(crl.Raw, parsed.Raw)
+	require.Len(parsed.RevokedCertificateEntries, 1)
+	assert.Equal(big.NewInt(42), parsed.RevokedCertificateEntries[0].SerialNumber)
+
+	_, err = PemToX509CRL([]byte("invalid"))
+	assert.Error(err)
+	_, err = PemToX509CRL(pemCRL[:len(pemCRL)/2])
+	assert.Error(err)
+}
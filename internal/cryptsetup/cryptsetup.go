@@ -30,6 +30,9 @@ const (
 	// SetDiskNotInitialized is a flag to set the Constellation state disk token to not initialized.
 	SetDiskNotInitialized = false
 
+	// AnyKeyslot selects the first key slot that can be unlocked with a given passphrase.
+	AnyKeyslot = -1
+
 	// FormatIntegrity is a flag to enable dm-integrity for a crypt device when formatting.
 	FormatIntegrity = true
 	// FormatNoIntegrity is a flag to disable dm-integrity for a crypt device when formatting.
@@ -144,15 +147,52 @@ func (c *CryptSetup) Deactivate(deviceName string) error {
 	return nil
 }
 
+// FormatParams are the parameters used to format a LUKS2 crypt device.
+type FormatParams struct {
+	// Cipher is the cipher used for encryption, e.g. "aes".
+	Cipher string
+	// CipherMode is the mode of the cipher, e.g. "xts-plain64".
+	CipherMode string
+	// VolumeKeySize is the size of the volume key in bytes.
+	// The key for integrity protection is part of the volume key.
+	VolumeKeySize int
+	// Integrity is the integrity algorithm, e.g. "hmac(sha256)", or "aead" for authenticated ciphers.
+	// Leave empty to disable dm-integrity.
+	Integrity string
+	// SectorSize is the encryption sector size in bytes.
+	SectorSize int
+}
+
+// DefaultFormatParams returns the parameters used by Format.
+// The device is encrypted using AES-XTS, and optionally integrity protected using HMAC-SHA256.
+func DefaultFormatParams(integrity bool) FormatParams {
+	params := FormatParams{
+		Cipher:        "aes",
+		CipherMode:    "xts-plain64",
+		VolumeKeySize: 64, // 32*2 bytes for aes-xts-plain64 encryption
+		SectorSize:    4096,
+	}
+	if integrity {
+		params.Integrity = "hmac(sha256)"
+		params.VolumeKeySize += 32 // 32 bytes for hmac(sha256) integrity
+	}
+	return params
+}
+
 // Format formats a disk as a LUKS2 crypt device.
 // Optionally set integrity to true to enable dm-integrity for the device.
 func (c *CryptSetup) Format(integrity bool) error {
+	return c.FormatWithParams(DefaultFormatParams(integrity))
+}
+
+// FormatWithParams formats a disk as a LUKS2 crypt device using the given parameters.
+func (c *CryptSetup) FormatWithParams(params FormatParams) error {
 	packageLock.Lock()
 	defer packageLock.Unlock()
 	if c.device == nil {
 		return errDeviceNotOpen
 	}
-	if err := format(c.device, integrity); err != nil {
+	if err := format(c.device, params); err != nil {
 		return fmt.Errorf("formatting crypt device %q: %w", c.device.GetDeviceName(), err)
 	}
 	return nil
@@ -192,6 +232,53 @@ func (c *CryptSetup) KeyslotAddByVolumeKey(keyslot int, volumeKey string, passph
 	return nil
 }
 
+// KeyslotAddByPassphrase adds a key slot to a device using the passphrase of an existing key slot.
+// The new key slot can be unlocked using newPassphrase.
+// Returns the number of the new key slot.
+func (c *CryptSetup) KeyslotAddByPassphrase(passphrase, newPassphrase string) (int, error) {
+	packageLock.Lock()
+	defer packageLock.Unlock()
+	if c.device == nil {
+		return -1, errDeviceNotOpen
+	}
+	keyslot, err := keyslotAddByPassphrase(c.device, passphrase, newPassphrase)
+	if err != nil {
+		return -1, fmt.Errorf("adding keyslot to device %q: %w", c.device.GetDeviceName(), err)
+	}
+	if err := c.reload(); err != nil {
+		return -1, err
+	}
+	return keyslot, nil
+}
+
+// KeyslotByPassphrase returns the number of the key slot that can be unlocked using the passphrase.
+func (c *CryptSetup) KeyslotByPassphrase(passphrase string) (int, error) {
+	packageLock.Lock()
+	defer packageLock.Unlock()
+	if c.device == nil {
+		return -1, errDeviceNotOpen
+	}
+	keyslot, err := keyslotByPassphrase(c.device, passphrase)
+	if err != nil {
+		return -1, fmt.Errorf("unlocking keyslot of device %q: %w", c.device.GetDeviceName(), err)
+	}
+	return keyslot, nil
+}
+
+// KeyslotDestroy removes a key slot from a device.
+// The key slot can no longer be used to activate the device.
+func (c *CryptSetup) KeyslotDestroy(keyslot int) error {
+	packageLock.Lock()
+	defer packageLock.Unlock()
+	if c.device == nil {
+		return errDeviceNotOpen
+	}
+	if err := keyslotDestroy(c.device, keyslot); err != nil {
+		return fmt.Errorf("destroying keyslot %d of device %q: %w", keyslot, c.device.GetDeviceName(), err)
+	}
+	return c.reload()
+}
+
 // KeyslotChangeByPassphrase changes the passphrase for a keyslot.
 func (c *CryptSetup) KeyslotChangeByPassphrase(currentKeyslot, newKeyslot int, currentPassphrase, newPassphrase string) error {
 	packageLock.Lock()
@@ -213,6 +300,26 @@ func (c *CryptSetup) LoadLUKS2() error {
 	return nil
 }
 
+// Reencrypt replaces the volume key of a device with a newly generated key using LUKS2 online reencryption.
+// name must be equal to the mapped device name, and the device must be active.
+// The new volume key is protected by the same passphrase as the current volume key.
+// Key slots of the old volume key are removed once the reencryption is finished.
+// If a previous reencryption of the device was interrupted, it is resumed instead.
+// Reencryption of devices with integrity protection is not supported by libcryptsetup.
+//
+// Reencryption rewrites the whole device and blocks until it is finished.
+func (c *CryptSetup) Reencrypt(name, passphrase string) error {
+	packageLock.Lock()
+	defer packageLock.Unlock()
+	if c.device == nil {
+		return errDeviceNotOpen
+	}
+	if err := reencrypt(c.device, name, passphrase); err != nil {
+		return fmt.Errorf("reencrypting device %q: %w", c.device.GetDeviceName(), err)
+	}
+	return c.reload()
+}
+
 // Resize resizes a device to the given size.
 // name must be equal to the mapped device name.
 // Set newSize to 0 to use the maximum available size.
@@ -263,12 +370,63 @@ func (c *CryptSetup) TokenJSONSet(token int, json string) (int, error) {
 }
 
 // SetConstellationStateDiskToken sets the Constellation state disk token.
+// Key information already stored in the token is kept.
 func (c *CryptSetup) SetConstellationStateDiskToken(diskIsInitialized bool) error {
-	token := constellationLUKS2Token{
-		Type:              "constellation-state-disk",
-		Keyslots:          []string{},
-		DiskIsInitialized: diskIsInitialized,
+	token := c.constellationStateDiskToken()
+	token.DiskIsInitialized = diskIsInitialized
+	return c.setConstellationStateDiskToken(token)
+}
+
+// ConstellationStateDiskTokenIsInitialized returns true if the Constellation state disk token is set to initialized.
+func (c *CryptSetup) ConstellationStateDiskTokenIsInitialized() bool {
+	return c.constellationStateDiskToken().DiskIsInitialized
+}
+
+// SetConstellationStateDiskKeyVersion records the version of the state disk key in the Constellation state disk token.
+func (c *CryptSetup) SetConstellationStateDiskKeyVersion(version uint32) error {
+	token := c.constellationStateDiskToken()
+	token.KeyVersion = version
+	return c.setConstellationStateDiskToken(token)
+}
+
+// ConstellationStateDiskKeyVersion returns the version of the state disk key recorded in the Constellation state disk token.
+// Disks without a recorded version use version 0.
+func (c *CryptSetup) ConstellationStateDiskKeyVersion() uint32 {
+	return c.constellationStateDiskToken().KeyVersion
+}
+
+// SetConstellationStateDiskRecoveryKeyslot records the keyslot of the escrowed recovery key in the Constellation state disk token.
+func (c *CryptSetup) SetConstellationStateDiskRecoveryKeyslot(keyslot int) error {
+	token := c.constellationStateDiskToken()
+	token.RecoveryKeyslot = &keyslot
+	return c.setConstellationStateDiskToken(token)
+}
+
+// ConstellationStateDiskRecoveryKeyslot returns the keyslot of the escrowed recovery key recorded in the Constellation state disk token.
+// The keyslot is -1 if no recovery key was added to the disk.
+func (c *CryptSetup) ConstellationStateDiskRecoveryKeyslot() int {
+	token := c.constellationStateDiskToken()
+	if token.RecoveryKeyslot == nil {
+		return -1
+	}
+	return *token.RecoveryKeyslot
+}
+
+// constellationStateDiskToken returns the Constellation state disk token.
+// An empty token is returned if the device has no valid token.
+func (c *CryptSetup) constellationStateDiskToken() constellationLUKS2Token {
+	var token constellationLUKS2Token
+	if stateDiskToken, err := c.device.TokenJSONGet(ConstellationStateDiskTokenID); err == nil {
+		if err := json.Unmarshal([]byte(stateDiskToken), &token); err != nil {
+			token = constellationLUKS2Token{}
+		}
 	}
+	token.Type = "constellation-state-disk"
+	token.Keyslots = []string{}
+	return token
+}
+
+func (c *CryptSetup) setConstellationStateDiskToken(token constellationLUKS2Token) error {
 	json, err := json.Marshal(token)
 	if err != nil {
 		return fmt.Errorf("marshaling token: %w", err)
@@ -279,19 +437,6 @@ func (c *CryptSetup) SetConstellationStateDiskToken(diskIsInitialized bool) erro
 	return nil
 }
 
-// ConstellationStateDiskTokenIsInitialized returns true if the Constellation state disk token is set to initialized.
-func (c *CryptSetup) ConstellationStateDiskTokenIsInitialized() bool {
-	stateDiskToken, err := c.device.TokenJSONGet(ConstellationStateDiskTokenID)
-	if err != nil {
-		return false
-	}
-	var token constellationLUKS2Token
-	if err := json.Unmarshal([]byte(stateDiskToken), &token); err != nil {
-		return false
-	}
-	return token.DiskIsInitialized
-}
-
 // Wipe overwrites the device with zeros to initialize integrity checksums.
 func (c *CryptSetup) Wipe(
 	name string, blockWipeSize int, flags int, logCallback func(size, offset uint64), logFrequency time.Duration,
@@ -336,10 +481,24 @@ func (c *CryptSetup) Wipe(
 	return nil
 }
 
+// reload reloads the LUKS2 header of the device.
+// Keyslot operations use a separate libcryptsetup context,
+// so the header cached by the device is outdated afterwards.
+func (c *CryptSetup) reload() error {
+	if err := loadLUKS2(c.device); err != nil {
+		return fmt.Errorf("reloading LUKS2 header of device %q: %w", c.device.GetDeviceName(), err)
+	}
+	return nil
+}
+
 type constellationLUKS2Token struct {
 	Type              string   `json:"type"`
 	Keyslots          []string `json:"keyslots"`
 	DiskIsInitialized bool     `json:"diskIsInitialized"`
+	// KeyVersion is the version of the state disk key.
+	KeyVersion uint32 `json:"keyVersion,omitempty"`
+	// RecoveryKeyslot is the keyslot of the escrowed recovery key, if one was added.
+	RecoveryKeyslot *int `json:"recoveryKeyslot,omitempty"`
 }
 
 type cryptDevice interface {
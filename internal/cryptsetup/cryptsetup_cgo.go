@@ -7,11 +7,144 @@ SPDX-License-Identifier: BUSL-1.1
 */
 package cryptsetup
 
-// #include <libcryptsetup.h>
+/*
+#include <stdlib.h>
+#include <string.h>
+#include <libcryptsetup.h>
+
+// Use the same low memory PBKDF parameters as format() for all new keyslots.
+static int set_pbkdf(struct crypt_device *cd) {
+	struct crypt_pbkdf_type pbkdf = {
+		.type = CRYPT_KDF_ARGON2ID,
+		.time_ms = 2000,
+		.iterations = 3,
+		.max_memory_kb = 65536,
+		.parallel_threads = 4,
+	};
+	return crypt_set_pbkdf_type(cd, &pbkdf);
+}
+
+static int init_luks2(struct crypt_device **cd, const char *device_path) {
+	int r = crypt_init(cd, device_path);
+	if (r < 0)
+		return r;
+	r = crypt_load(*cd, CRYPT_LUKS2, NULL);
+	if (r < 0)
+		goto err;
+	r = set_pbkdf(*cd);
+	if (r < 0)
+		goto err;
+	return 0;
+err:
+	crypt_free(*cd);
+	*cd = NULL;
+	return r;
+}
+
+static int keyslot_by_passphrase(const char *device_path, const char *passphrase, size_t passphrase_size) {
+	struct crypt_device *cd = NULL;
+	int r = init_luks2(&cd, device_path);
+	if (r < 0)
+		return r;
+	// Activating without a name only checks the passphrase and returns the unlocked keyslot.
+	r = crypt_activate_by_passphrase(cd, NULL, CRYPT_ANY_SLOT, passphrase, passphrase_size, 0);
+	crypt_free(cd);
+	return r;
+}
+
+static int keyslot_add_by_passphrase(const char *device_path, const char *passphrase, size_t passphrase_size,
+	const char *new_passphrase, size_t new_passphrase_size) {
+	struct crypt_device *cd = NULL;
+	int r = init_luks2(&cd, device_path);
+	if (r < 0)
+		return r;
+	r = crypt_keyslot_add_by_passphrase(cd, CRYPT_ANY_SLOT, passphrase, passphrase_size, new_passphrase, new_passphrase_size);
+	crypt_free(cd);
+	return r;
+}
+
+static int keyslot_destroy(const char *device_path, int keyslot) {
+	struct crypt_device *cd = NULL;
+	int r = init_luks2(&cd, device_path);
+	if (r < 0)
+		return r;
+	r = crypt_keyslot_destroy(cd, keyslot);
+	crypt_free(cd);
+	return r;
+}
+
+// reencrypt replaces the volume key of the active device name with a newly generated key.
+// The new volume key is protected by the same passphrase as the current one.
+// The sector size of the device is kept, since file systems on the device depend on it.
+// An interrupted reencryption is resumed.
+static int reencrypt(const char *device_path, const char *name, const char *passphrase, size_t passphrase_size) {
+	struct crypt_device *cd = NULL;
+	struct crypt_params_luks2 luks2_params = { 0 };
+	struct crypt_params_reencrypt params = {
+		.mode = CRYPT_REENCRYPT_REENCRYPT,
+		.direction = CRYPT_REENCRYPT_FORWARD,
+		.resilience = "checksum",
+		.hash = "sha256",
+		.luks2 = &luks2_params,
+	};
+	char cipher[32], cipher_mode[32];
+	int r, keyslot_old, keyslot_new, keyslot;
+
+	r = init_luks2(&cd, device_path);
+	if (r < 0)
+		return r;
+	luks2_params.sector_size = crypt_get_sector_size(cd);
+
+	if (crypt_reencrypt_status(cd, NULL) == CRYPT_REENCRYPT_NONE) {
+		keyslot_old = crypt_activate_by_passphrase(cd, NULL, CRYPT_ANY_SLOT, passphrase, passphrase_size, 0);
+		if (keyslot_old < 0) {
+			r = keyslot_old;
+			goto out;
+		}
+		keyslot_new = crypt_keyslot_add_by_key(cd, CRYPT_ANY_SLOT, NULL, crypt_get_volume_key_size(cd),
+			passphrase, passphrase_size, CRYPT_VOLUME_KEY_NO_SEGMENT);
+		if (keyslot_new < 0) {
+			r = keyslot_new;
+			goto out;
+		}
+		strncpy(cipher, crypt_get_cipher(cd), sizeof(cipher) - 1);
+		cipher[sizeof(cipher) - 1] = '\0';
+		strncpy(cipher_mode, crypt_get_cipher_mode(cd), sizeof(cipher_mode) - 1);
+		cipher_mode[sizeof(cipher_mode) - 1] = '\0';
+		r = crypt_reencrypt_init_by_passphrase(cd, name, passphrase, passphrase_size,
+			keyslot_old, keyslot_new, cipher, cipher_mode, &params);
+	} else {
+		params.flags = CRYPT_REENCRYPT_RESUME_ONLY;
+		r = crypt_reencrypt_init_by_passphrase(cd, name, passphrase, passphrase_size,
+			CRYPT_ANY_SLOT, CRYPT_ANY_SLOT, NULL, NULL, &params);
+	}
+	if (r < 0)
+		goto out;
+
+	r = crypt_reencrypt_run(cd, NULL, NULL);
+	if (r < 0)
+		goto out;
+
+	// Keyslots that are not bound to a segment anymore protect the old volume key.
+	for (keyslot = 0; keyslot < crypt_keyslot_max(CRYPT_LUKS2); keyslot++) {
+		if (crypt_keyslot_status(cd, keyslot) != CRYPT_SLOT_UNBOUND)
+			continue;
+		r = crypt_keyslot_destroy(cd, keyslot);
+		if (r < 0)
+			goto out;
+	}
+out:
+	crypt_free(cd);
+	return r;
+}
+*/
 import "C"
 
 import (
 	"errors"
+	"fmt"
+	"syscall"
+	"unsafe"
 
 	"github.com/martinjungblut/go-cryptsetup"
 )
@@ -19,17 +152,20 @@ import (
 const (
 	// ReadWriteQueueBypass is a flag to disable the write and read workqueues for a crypt device.
 	ReadWriteQueueBypass = C.CRYPT_ACTIVATE_NO_WRITE_WORKQUEUE | C.CRYPT_ACTIVATE_NO_READ_WORKQUEUE
-	wipeFlags            = cryptsetup.CRYPT_ACTIVATE_PRIVATE | cryptsetup.CRYPT_ACTIVATE_NO_JOURNAL
-	wipePattern          = cryptsetup.CRYPT_WIPE_ZERO
+	// NoJournal is a flag to disable the journal of a dm-integrity device.
+	NoJournal   = C.CRYPT_ACTIVATE_NO_JOURNAL
+	wipeFlags   = cryptsetup.CRYPT_ACTIVATE_PRIVATE | cryptsetup.CRYPT_ACTIVATE_NO_JOURNAL
+	wipePattern = cryptsetup.CRYPT_WIPE_ZERO
 )
 
 var errInvalidType = errors.New("device is not a *cryptsetup.Device")
 
-func format(device cryptDevice, integrity bool) error {
+func format(device cryptDevice, params FormatParams) error {
 	switch d := device.(type) {
 	case cgoFormatter:
 		luks2Params := cryptsetup.LUKS2{
-			SectorSize: 4096,
+			SectorSize: params.SectorSize,
+			Integrity:  params.Integrity,
 			PBKDFType: &cryptsetup.PbkdfType{
 				// Use low memory recommendation from https://datatracker.ietf.org/doc/html/rfc9106#section-7
 				Type:            "argon2id",
@@ -40,14 +176,9 @@ func format(device cryptDevice, integrity bool) error {
 			},
 		}
 		genericParams := cryptsetup.GenericParams{
-			Cipher:        "aes",
-			CipherMode:    "xts-plain64",
-			VolumeKeySize: 64, // 32*2 bytes for aes-xts-plain64 encryption
-		}
-
-		if integrity {
-			luks2Params.Integrity = "hmac(sha256)"
-			genericParams.VolumeKeySize += 32 // 32 bytes for hmac(sha256) integrity
+			Cipher:        params.Cipher,
+			CipherMode:    params.CipherMode,
+			VolumeKeySize: params.VolumeKeySize,
 		}
 
 		return d.Format(luks2Params, genericParams)
@@ -56,6 +187,57 @@ func format(device cryptDevice, integrity bool) error {
 	}
 }
 
+func keyslotByPassphrase(device cryptDevice, passphrase string) (int, error) {
+	devicePath := C.CString(device.GetDeviceName())
+	defer C.free(unsafe.Pointer(devicePath))
+	cPassphrase := C.CString(passphrase)
+	defer C.free(unsafe.Pointer(cPassphrase))
+
+	return cryptError(C.keyslot_by_passphrase(devicePath, cPassphrase, C.size_t(len(passphrase))))
+}
+
+func keyslotAddByPassphrase(device cryptDevice, passphrase, newPassphrase string) (int, error) {
+	devicePath := C.CString(device.GetDeviceName())
+	defer C.free(unsafe.Pointer(devicePath))
+	cPassphrase := C.CString(passphrase)
+	defer C.free(unsafe.Pointer(cPassphrase))
+	cNewPassphrase := C.CString(newPassphrase)
+	defer C.free(unsafe.Pointer(cNewPassphrase))
+
+	return cryptError(C.keyslot_add_by_passphrase(
+		devicePath, cPassphrase, C.size_t(len(passphrase)), cNewPassphrase, C.size_t(len(newPassphrase)),
+	))
+}
+
+func keyslotDestroy(device cryptDevice, keyslot int) error {
+	devicePath := C.CString(device.GetDeviceName())
+	defer C.free(unsafe.Pointer(devicePath))
+
+	_, err := cryptError(C.keyslot_destroy(devicePath, C.int(keyslot)))
+	return err
+}
+
+func reencrypt(device cryptDevice, name, passphrase string) error {
+	devicePath := C.CString(device.GetDeviceName())
+	defer C.free(unsafe.Pointer(devicePath))
+	cName := C.CString(name)
+	defer C.free(unsafe.Pointer(cName))
+	cPassphrase := C.CString(passphrase)
+	defer C.free(unsafe.Pointer(cPassphrase))
+
+	_, err := cryptError(C.reencrypt(devicePath, cName, cPassphrase, C.size_t(len(passphrase))))
+	return err
+}
+
+// cryptError converts the return code of a libcryptsetup function to an error.
+// libcryptsetup returns negative errno values on failure.
+func cryptError(r C.int) (int, error) {
+	if r < 0 {
+		return -1, fmt.Errorf("libcryptsetup: %w", syscall.Errno(-r))
+	}
+	return int(r), nil
+}
+
 func initByDevicePath(devicePath string) (cryptDevice, error) {
 	return cryptsetup.Init(devicePath)
 }
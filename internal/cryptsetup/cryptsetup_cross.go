@@ -13,7 +13,9 @@ import (
 
 const (
 	// ReadWriteQueueBypass is a flag to disable the write and read workqueues for a crypt device.
-	ReadWriteQueueBypass          = cryptActivateNoReadWorkqueue | cryptActivateNoWriteWorkqueue
+	ReadWriteQueueBypass = cryptActivateNoReadWorkqueue | cryptActivateNoWriteWorkqueue
+	// NoJournal is a flag to disable the journal of a dm-integrity device.
+	NoJournal                     = 0x1000
 	cryptActivateNoReadWorkqueue  = 0x1000000
 	cryptActivateNoWriteWorkqueue = 0x2000000
 	wipeFlags                     = 0x10 | 0x1000
@@ -22,7 +24,23 @@ const (
 
 var errCGONotSupported = errors.New("using cryptsetup requires building with CGO")
 
-func format(_ cryptDevice, _ bool) error {
+func format(_ cryptDevice, _ FormatParams) error {
+	return errCGONotSupported
+}
+
+func keyslotByPassphrase(_ cryptDevice, _ string) (int, error) {
+	return -1, errCGONotSupported
+}
+
+func keyslotAddByPassphrase(_ cryptDevice, _, _ string) (int, error) {
+	return -1, errCGONotSupported
+}
+
+func keyslotDestroy(_ cryptDevice, _ int) error {
+	return errCGONotSupported
+}
+
+func reencrypt(_ cryptDevice, _, _ string) error {
 	return errCGONotSupported
 }
 
@@ -0,0 +1,56 @@
+/*
+Copyright (c) Edgeless Systems GmbH
+
+SPDX-License-Identifier: BUSL-1.1
+*/
+
+// Package tokencredentials handles authentication of gRPC requests using Kubernetes service account tokens.
+package tokencredentials
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"strings"
+)
+
+const (
+	// ServiceAccountTokenPath is the path of the service account token the kubelet mounts into pods.
+	ServiceAccountTokenPath = "/var/run/secrets/kubernetes.io/serviceaccount/token"
+	// AuthorizationHeader is the metadata key of the token.
+	AuthorizationHeader = "authorization"
+	// bearerPrefix is the prefix of the token in the authorization header.
+	bearerPrefix = "Bearer "
+)
+
+// Credentials send the service account token of a pod with every request.
+// The token is read for every request, since the kubelet rotates it.
+type Credentials struct {
+	tokenPath string
+}
+
+// New creates new Credentials reading the token from the given path.
+func New(tokenPath string) *Credentials {
+	return &Credentials{tokenPath: tokenPath}
+}
+
+// GetRequestMetadata returns the token as bearer token in the authorization header.
+func (c *Credentials) GetRequestMetadata(context.Context, ...string) (map[string]string, error) {
+	token, err := os.ReadFile(c.tokenPath)
+	if err != nil {
+		return nil, fmt.Errorf("reading service account token: %w", err)
+	}
+	return map[string]string{AuthorizationHeader: bearerPrefix + strings.TrimSpace(string(token))}, nil
+}
+
+// RequireTransportSecurity returns false.
+// The token is sent over cluster internal connections, which are considered trustworthy.
+func (c *Credentials) RequireTransportSecurity() bool {
+	return false
+}
+
+// TokenFromHeader returns the bearer token of an authorization header.
+func TokenFromHeader(header string) (string, bool) {
+	token, ok := strings.CutPrefix(header, bearerPrefix)
+	return token, ok && token != ""
+}
@@ -0,0 +1,72 @@
+/*
+Copyright (c) Edgeless Systems GmbH
+
+SPDX-License-Identifier: BUSL-1.1
+*/
+
+package tokencredentials
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.uber.org/goleak"
+)
+
+func TestMain(m *testing.M) {
+	goleak.VerifyTestMain(m, goleak.IgnoreAnyFunction("github.com/bazelbuild/rules_go/go/tools/bzltestutil.RegisterTimeoutHandler.func1"))
+}
+
+func TestGetRequestMetadata(t *testing.T) {
+	assert := assert.New(t)
+	require := require.New(t)
+
+	tokenPath := filepath.Join(t.TempDir(), "token")
+	creds := New(tokenPath)
+
+	_, err := creds.GetRequestMetadata(t.Context())
+	assert.Error(err)
+
+	require.NoError(os.WriteFile(tokenPath, []byte("token-1\n"), 0o600))
+	md, err := creds.GetRequestMetadata(t.Context())
+	require.NoError(err)
+	assert.Equal(map[string]string{AuthorizationHeader: "Bearer token-1"}, md)
+
+	token, ok := TokenFromHeader(md[AuthorizationHeader])
+	assert.True(ok)
+	assert.Equal("token-1", token)
+
+	// Rotated tokens are picked up.
+	require.NoError(os.WriteFile(tokenPath, []byte("token-2"), 0o600))
+	md, err = creds.GetRequestMetadata(t.Context())
+	require.NoError(err)
+	assert.Equal(map[string]string{AuthorizationHeader: "Bearer token-2"}, md)
+}
+
+func TestTokenFromHeader(t *testing.T) {
+	testCases := map[string]struct {
+		header    string
+		wantToken string
+		wantOK    bool
+	}{
+		"bearer token": {header: "Bearer token", wantToken: "token", wantOK: true},
+		"empty token":  {header: "Bearer "},
+		"basic auth":   {header: "Basic dXNlcjpwYXNz"},
+		"no header":    {},
+	}
+
+	for name, tc := range testCases {
+		t.Run(name, func(t *testing.T) {
+			assert := assert.New(t)
+
+			token, ok := TokenFromHeader(tc.header)
+			assert.Equal(tc.wantOK, ok)
+			if tc.wantOK {
+				assert.Equal(tc.wantToken, token)
+			}
+		})
+	}
+}
@@ -55,5 +55,15 @@ func (c *KMSClient) GetDEK(ctx context.Context, keyID string, dekSize int) ([]by
 	return c.kms.GetDEK(ctx, keyID, dekSize)
 }
 
+// PutDEK encrypts a Data Encryption Key and saves it to storage, e.g., to escrow an existing key.
+func (c *KMSClient) PutDEK(ctx context.Context, keyID string, dek []byte) error {
+	return c.kms.PutDEK(ctx, keyID, dek)
+}
+
+// LoadDEK fetches an existing Data Encryption Key from storage and decrypts it.
+func (c *KMSClient) LoadDEK(ctx context.Context, keyID string) ([]byte, error) {
+	return c.kms.LoadDEK(ctx, keyID)
+}
+
 // Close is a no-op for Azure.
 func (c *KMSClient) Close() {}
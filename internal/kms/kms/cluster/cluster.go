@@ -10,6 +10,10 @@ Package cluster implements a KMS backend for in cluster key management.
 The cluster backend holds a master key, and corresponding salt.
 Data Encryption Keys (DEK) are derived from master key and salt using HKDF.
 
+The master secret can be rotated. Every rotation adds a generation of master key and salt.
+Versioned DEKs are derived from the generation encoded in their version, see [crypto.KeyVersionGeneration].
+All other DEKs are derived from the first generation, so they don't change when the master secret is rotated.
+
 This backend does not require a storage backend, as keys are derived on demand and not stored anywhere.
 For that purpose the special NoStoreURI can be used during KMS initialization.
 */
@@ -19,33 +23,71 @@ import (
 	"context"
 	"errors"
 
+	"fmt"
+
 	"github.com/edgelesssys/constellation/v2/internal/crypto"
+	"github.com/edgelesssys/constellation/v2/internal/kms/uri"
 )
 
 // KMS implements the kms.CloudKMS interface for in cluster key management.
 type KMS struct {
+	// generations are the master keys and salts, indexed by their generation.
+	generations []generation
+}
+
+// generation is one generation of the master secret.
+type generation struct {
 	masterKey []byte
 	salt      []byte
 }
 
 // New creates a new ClusterKMS.
 func New(key []byte, salt []byte) (*KMS, error) {
-	if len(key) == 0 {
-		return nil, errors.New("missing master key")
+	return NewFromMasterSecret(uri.MasterSecret{Key: key, Salt: salt})
+}
+
+// NewFromMasterSecret creates a new ClusterKMS holding all generations of a master secret.
+func NewFromMasterSecret(secret uri.MasterSecret) (*KMS, error) {
+	kms := &KMS{}
+	if err := kms.addGeneration(secret.Key, secret.Salt); err != nil {
+		return nil, err
 	}
-	if len(salt) == 0 {
-		return nil, errors.New("missing salt")
+	for _, rotation := range secret.Rotations {
+		if err := kms.addGeneration(rotation.Key, rotation.Salt); err != nil {
+			return nil, fmt.Errorf("master secret generation %d: %w", len(kms.generations), err)
+		}
 	}
+	return kms, nil
+}
 
-	return &KMS{masterKey: key, salt: salt}, nil
+// Generation returns the generation of the latest master secret.
+func (c *KMS) Generation() uint32 {
+	return uint32(len(c.generations) - 1)
 }
 
 // GetDEK derives a key from the KMS masterKey.
+// Versioned keys are derived from the generation of the master secret their version belongs to.
 func (c *KMS) GetDEK(_ context.Context, dekID string, dekSize int) ([]byte, error) {
-	if len(c.masterKey) == 0 {
+	if len(c.generations) == 0 {
 		return nil, errors.New("master key not set for Constellation KMS")
 	}
-	return crypto.DeriveKey(c.masterKey, c.salt, []byte(dekID), uint(dekSize))
+	gen := crypto.DEKIDGeneration(dekID)
+	if gen >= uint32(len(c.generations)) {
+		return nil, fmt.Errorf("master secret generation %d of key %q is unknown, latest generation is %d", gen, dekID, c.Generation())
+	}
+	return crypto.DeriveKey(c.generations[gen].masterKey, c.generations[gen].salt, []byte(dekID), uint(dekSize))
+}
+
+// addGeneration adds the next generation of the master secret.
+func (c *KMS) addGeneration(key, salt []byte) error {
+	if len(key) == 0 {
+		return errors.New("missing master key")
+	}
+	if len(salt) == 0 {
+		return errors.New("missing salt")
+	}
+	c.generations = append(c.generations, generation{masterKey: key, salt: salt})
+	return nil
 }
 
 // Close is a no-op for cKMS.
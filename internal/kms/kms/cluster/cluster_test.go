@@ -10,7 +10,9 @@ import (
 	"strings"
 	"testing"
 
+	"github.com/edgelesssys/constellation/v2/internal/crypto"
 	"github.com/edgelesssys/constellation/v2/internal/crypto/testvector"
+	"github.com/edgelesssys/constellation/v2/internal/kms/uri"
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
 	"go.uber.org/goleak"
@@ -45,6 +47,52 @@ func TestClusterKMS(t *testing.T) {
 	assert.NotEqual(keyLower, keyUpper)
 }
 
+func TestClusterKMSRotations(t *testing.T) {
+	assert := assert.New(t)
+	require := require.New(t)
+
+	secret := uri.MasterSecret{
+		Key:  []byte("key-0"),
+		Salt: []byte("salt-0"),
+		Rotations: []uri.MasterSecretRotation{
+			{Key: []byte("key-1"), Salt: []byte("salt-1")},
+		},
+	}
+	kms, err := NewFromMasterSecret(secret)
+	require.NoError(err)
+	assert.EqualValues(1, kms.Generation())
+	initialKMS, err := New(secret.Key, secret.Salt)
+	require.NoError(err)
+
+	// unversioned keys and versions of the first generation are derived from the initial master secret
+	for _, dekID := range []string{"key", crypto.VersionedDEKID("key", 1), crypto.VersionedDEKID("key", crypto.FirstKeyVersion(1)-1)} {
+		got, err := kms.GetDEK(t.Context(), dekID, 32)
+		require.NoError(err)
+		want, err := initialKMS.GetDEK(t.Context(), dekID, 32)
+		require.NoError(err)
+		assert.Equal(want, got, dekID)
+	}
+
+	// later versions are derived from the rotated master secret
+	dekID := crypto.VersionedDEKID("key", crypto.FirstKeyVersion(1)+1)
+	got, err := kms.GetDEK(t.Context(), dekID, 32)
+	require.NoError(err)
+	want, err := crypto.DeriveKey(secret.Rotations[0].Key, secret.Rotations[0].Salt, []byte(dekID), 32)
+	require.NoError(err)
+	assert.Equal(want, got)
+
+	// versions of unknown generations can't be derived
+	_, err = kms.GetDEK(t.Context(), crypto.VersionedDEKID("key", crypto.FirstKeyVersion(2)), 32)
+	assert.Error(err)
+
+	_, err = NewFromMasterSecret(uri.MasterSecret{
+		Key:       secret.Key,
+		Salt:      secret.Salt,
+		Rotations: []uri.MasterSecretRotation{{Key: []byte("key-1")}},
+	})
+	assert.Error(err)
+}
+
 func TestVectorsHKDF(t *testing.T) {
 	testCases := map[string]struct {
 		kek     []byte
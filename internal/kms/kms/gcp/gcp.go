@@ -64,6 +64,16 @@ func (c *KMSClient) GetDEK(ctx context.Context, keyID string, dekSize int) ([]by
 	return c.kms.GetDEK(ctx, keyID, dekSize)
 }
 
+// PutDEK encrypts a Data Encryption Key and saves it to storage, e.g., to escrow an existing key.
+func (c *KMSClient) PutDEK(ctx context.Context, keyID string, dek []byte) error {
+	return c.kms.PutDEK(ctx, keyID, dek)
+}
+
+// LoadDEK fetches an existing Data Encryption Key from storage and decrypts it.
+func (c *KMSClient) LoadDEK(ctx context.Context, keyID string) ([]byte, error) {
+	return c.kms.LoadDEK(ctx, keyID)
+}
+
 // Close closes the KMS client.
 func (c *KMSClient) Close() {
 	_ = c.client.Close()
@@ -50,24 +50,23 @@ func (c *KMSClient) GetDEK(ctx context.Context, keyID string, dekSize int) ([]by
 		if err != nil {
 			return nil, fmt.Errorf("key generation: %w", err)
 		}
-		return newDEK, c.putDEK(ctx, keyID, newDEK)
-	}
-
-	wrappedKey := &wrapping.BlobInfo{}
-	if err := json.Unmarshal(encryptedDEK, wrappedKey); err != nil {
-		return nil, fmt.Errorf("unmarshaling wrapped DEK: %w", err)
+		return newDEK, c.PutDEK(ctx, keyID, newDEK)
 	}
+	return c.decryptDEK(ctx, encryptedDEK)
+}
 
-	dek, err := c.Wrapper.Decrypt(ctx, wrappedKey)
+// LoadDEK fetches an encrypted Data Encryption Key from storage and decrypts it.
+// If no such key exists, storage.ErrDEKUnset is returned.
+func (c *KMSClient) LoadDEK(ctx context.Context, keyID string) ([]byte, error) {
+	encryptedDEK, err := c.Storage.Get(ctx, keyID)
 	if err != nil {
-		return nil, fmt.Errorf("decrypting DEK: %w", err)
+		return nil, fmt.Errorf("loading encrypted DEK from storage: %w", err)
 	}
-
-	return dek, nil
+	return c.decryptDEK(ctx, encryptedDEK)
 }
 
-// putDEK encrypts a Data Encryption Key and saves it to storage.
-func (c *KMSClient) putDEK(ctx context.Context, keyID string, plainDEK []byte) error {
+// PutDEK encrypts a Data Encryption Key and saves it to storage.
+func (c *KMSClient) PutDEK(ctx context.Context, keyID string, plainDEK []byte) error {
 	wrappedKey, err := c.Wrapper.Encrypt(ctx, plainDEK)
 	if err != nil {
 		return fmt.Errorf("encrypting DEK: %w", err)
@@ -80,3 +79,18 @@ func (c *KMSClient) putDEK(ctx context.Context, keyID string, plainDEK []byte) e
 
 	return c.Storage.Put(ctx, keyID, encryptedDEK)
 }
+
+// decryptDEK decrypts a Data Encryption Key loaded from storage.
+func (c *KMSClient) decryptDEK(ctx context.Context, encryptedDEK []byte) ([]byte, error) {
+	wrappedKey := &wrapping.BlobInfo{}
+	if err := json.Unmarshal(encryptedDEK, wrappedKey); err != nil {
+		return nil, fmt.Errorf("unmarshaling wrapped DEK: %w", err)
+	}
+
+	dek, err := c.Wrapper.Decrypt(ctx, wrappedKey)
+	if err != nil {
+		return nil, fmt.Errorf("decrypting DEK: %w", err)
+	}
+
+	return dek, nil
+}
@@ -145,3 +145,60 @@ func TestGetDEK(t *testing.T) {
 		})
 	}
 }
+
+func TestLoadDEK(t *testing.T) {
+	someErr := errors.New("failed")
+	testKey := []byte("00112233445566778899aabbccddeeff")
+	savedTestKey, err := json.Marshal(&wrapping.BlobInfo{Ciphertext: []byte("encrypted-dek")})
+	require.NoError(t, err)
+
+	testCases := map[string]struct {
+		wrapper   *stubWrapper
+		storage   *stubStorage
+		wantErrIs error
+		wantErr   bool
+	}{
+		"existing key": {
+			wrapper: &stubWrapper{decryptResponse: testKey},
+			storage: &stubStorage{key: savedTestKey},
+		},
+		"missing key isn't created": {
+			wrapper:   &stubWrapper{},
+			storage:   &stubStorage{getErr: storage.ErrDEKUnset, putErr: errors.New("unexpected put")},
+			wantErrIs: storage.ErrDEKUnset,
+			wantErr:   true,
+		},
+		"Get from storage fails": {
+			wrapper: &stubWrapper{},
+			storage: &stubStorage{getErr: someErr},
+			wantErr: true,
+		},
+		"Decrypt fails": {
+			wrapper: &stubWrapper{decryptErr: someErr},
+			storage: &stubStorage{key: savedTestKey},
+			wantErr: true,
+		},
+	}
+
+	for name, tc := range testCases {
+		t.Run(name, func(t *testing.T) {
+			assert := assert.New(t)
+
+			client := &KMSClient{
+				Wrapper: tc.wrapper,
+				Storage: tc.storage,
+			}
+
+			dek, err := client.LoadDEK(t.Context(), "volume-01")
+			if tc.wantErr {
+				assert.Error(err)
+				if tc.wantErrIs != nil {
+					assert.ErrorIs(err, tc.wantErrIs)
+				}
+				return
+			}
+			assert.NoError(err)
+			assert.Equal(testKey, dek)
+		})
+	}
+}
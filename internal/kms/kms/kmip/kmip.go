@@ -0,0 +1,389 @@
+/*
+Copyright (c) Edgeless Systems GmbH
+
+SPDX-License-Identifier: BUSL-1.1
+*/
+
+/*
+Package kmip implements a KMS backend for key management servers and HSMs that speak KMIP.
+
+DEKs are wrapped and unwrapped by the KMIP server using AES-GCM with a symmetric KEK,
+so the KEK never leaves the server. The client authenticates using mutual TLS.
+The KEK is looked up by its Name attribute once, and referenced by its unique identifier afterwards.
+*/
+package kmip
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"fmt"
+	"net"
+	"os"
+	"sync"
+	"time"
+
+	kmsInterface "github.com/edgelesssys/constellation/v2/internal/kms/kms"
+	"github.com/edgelesssys/constellation/v2/internal/kms/kms/internal"
+	"github.com/edgelesssys/constellation/v2/internal/kms/uri"
+	wrapping "github.com/hashicorp/go-kms-wrapping/v2"
+)
+
+const (
+	// Operations as defined in the KMIP specification.
+	operationLocate  uint32 = 0x08
+	operationEncrypt uint32 = 0x1F
+	operationDecrypt uint32 = 0x20
+
+	// resultStatusSuccess is the result status of successful operations.
+	resultStatusSuccess uint32 = 0x00
+	// blockCipherModeGCM selects AES-GCM in the cryptographic parameters.
+	blockCipherModeGCM uint32 = 0x09
+	// cryptographicAlgorithmAES selects AES in the cryptographic parameters.
+	cryptographicAlgorithmAES uint32 = 0x03
+	// nameTypeText is the type of names given as plain text.
+	nameTypeText uint32 = 0x01
+
+	// protocolVersionMajor and protocolVersionMinor are the KMIP version used by the client.
+	// Authenticated encryption tags were introduced in KMIP 1.4.
+	protocolVersionMajor = 1
+	protocolVersionMinor = 4
+
+	// ivSize is the size of the AES-GCM nonce.
+	ivSize = 12
+	// tagSize is the size of the AES-GCM authentication tag.
+	tagSize = 16
+	// requestTimeout limits the duration of a single request if the context has no deadline.
+	requestTimeout = 30 * time.Second
+)
+
+// KMSClient implements the CloudKMS interface for KMIP.
+type KMSClient struct {
+	kms *internal.KMSClient
+}
+
+// New creates and initializes a new KMSClient for KMIP.
+func New(_ context.Context, store kmsInterface.Storage, cfg uri.KMIPConfig) (*KMSClient, error) {
+	if store == nil {
+		return nil, errors.New("no storage backend provided for KMS")
+	}
+
+	wrapper, err := newKMIPWrapper(cfg)
+	if err != nil {
+		return nil, fmt.Errorf("setting KMIP config: %w", err)
+	}
+	return &KMSClient{
+		kms: &internal.KMSClient{
+			Storage: store,
+			Wrapper: wrapper,
+		},
+	}, nil
+}
+
+// GetDEK fetches an encrypted Data Encryption Key from storage and decrypts it using a KEK held by the KMIP server.
+func (c *KMSClient) GetDEK(ctx context.Context, keyID string, dekSize int) ([]byte, error) {
+	return c.kms.GetDEK(ctx, keyID, dekSize)
+}
+
+// PutDEK encrypts a Data Encryption Key and saves it to storage, e.g., to escrow an existing key.
+func (c *KMSClient) PutDEK(ctx context.Context, keyID string, dek []byte) error {
+	return c.kms.PutDEK(ctx, keyID, dek)
+}
+
+// LoadDEK fetches an existing Data Encryption Key from storage and decrypts it.
+func (c *KMSClient) LoadDEK(ctx context.Context, keyID string) ([]byte, error) {
+	return c.kms.LoadDEK(ctx, keyID)
+}
+
+// Close is a no-op for KMIP, since a new connection is used for every request.
+func (c *KMSClient) Close() {}
+
+// kmipWrapper wraps and unwraps keys using the Encrypt and Decrypt operations of a KMIP server.
+type kmipWrapper struct {
+	address   string
+	tlsConfig *tls.Config
+	keyName   string
+
+	mux      sync.Mutex
+	uniqueID string
+}
+
+func newKMIPWrapper(cfg uri.KMIPConfig) (*kmipWrapper, error) {
+	if _, _, err := net.SplitHostPort(cfg.Address); err != nil {
+		return nil, fmt.Errorf("invalid KMIP server address %q: %w", cfg.Address, err)
+	}
+	if cfg.KeyName == "" {
+		return nil, errors.New("no key name provided")
+	}
+
+	cert, err := tls.LoadX509KeyPair(cfg.ClientCertPath, cfg.ClientKeyPath)
+	if err != nil {
+		return nil, fmt.Errorf("loading client certificate: %w", err)
+	}
+	tlsConfig := &tls.Config{
+		Certificates: []tls.Certificate{cert},
+		MinVersion:   tls.VersionTLS12,
+		ServerName:   cfg.ServerName,
+	}
+	if cfg.CACertPath != "" {
+		pem, err := os.ReadFile(cfg.CACertPath)
+		if err != nil {
+			return nil, fmt.Errorf("reading CA certificate: %w", err)
+		}
+		roots := x509.NewCertPool()
+		if !roots.AppendCertsFromPEM(pem) {
+			return nil, fmt.Errorf("no certificates found in %s", cfg.CACertPath)
+		}
+		tlsConfig.RootCAs = roots
+	}
+
+	return &kmipWrapper{
+		address:   cfg.Address,
+		tlsConfig: tlsConfig,
+		keyName:   cfg.KeyName,
+	}, nil
+}
+
+// Encrypt wraps plaintext with the KEK using AES-GCM.
+// The authentication tag is appended to the ciphertext.
+// A random IV is sent with the request, but the IV returned by the server takes precedence.
+func (w *kmipWrapper) Encrypt(ctx context.Context, plaintext []byte, _ ...wrapping.Option) (*wrapping.BlobInfo, error) {
+	uniqueID, err := w.getUniqueID(ctx)
+	if err != nil {
+		return nil, err
+	}
+	iv := make([]byte, ivSize)
+	if _, err := rand.Read(iv); err != nil {
+		return nil, fmt.Errorf("generating IV: %w", err)
+	}
+
+	payload, err := w.send(ctx, operationEncrypt, structure(tagRequestPayload,
+		textString(tagUniqueIdentifier, uniqueID),
+		cryptographicParameters(),
+		byteString(tagData, plaintext),
+		byteString(tagIVCounterNonce, iv),
+	))
+	if err != nil {
+		return nil, fmt.Errorf("encrypting with KMIP key %s: %w", uniqueID, err)
+	}
+	ciphertext, ok := payload.child(tagData)
+	if !ok {
+		return nil, errors.New("encrypt response contains no data")
+	}
+	authTag, ok := payload.child(tagAuthenticatedEncryptionTag)
+	if !ok {
+		return nil, errors.New("encrypt response contains no authentication tag")
+	}
+	ciphertextData, ok := ciphertext.value.([]byte)
+	if !ok {
+		return nil, errors.New("encrypt response data is not a byte string")
+	}
+	authTagData, ok := authTag.value.([]byte)
+	if !ok {
+		return nil, errors.New("encrypt response authentication tag is not a byte string")
+	}
+	// Decrypt splits the tag off the end of the ciphertext, so it must have the expected size.
+	if len(authTagData) != tagSize {
+		return nil, fmt.Errorf("encrypt response authentication tag has %d bytes, expected %d", len(authTagData), tagSize)
+	}
+	// Servers that generate IVs themselves ignore the one sent and return the IV they used.
+	if serverIV, ok := payload.child(tagIVCounterNonce); ok {
+		ivData, ok := serverIV.value.([]byte)
+		if !ok || len(ivData) == 0 {
+			return nil, errors.New("encrypt response IV is not a byte string")
+		}
+		iv = ivData
+	}
+
+	return &wrapping.BlobInfo{
+		Ciphertext: append(ciphertextData, authTagData...),
+		Iv:         iv,
+		KeyInfo:    &wrapping.KeyInfo{KeyId: uniqueID},
+	}, nil
+}
+
+// Decrypt unwraps a ciphertext that was wrapped by Encrypt.
+// The KEK that wrapped the ciphertext is referenced by its unique identifier,
+// so DEKs stay readable if the name is moved to a new key.
+func (w *kmipWrapper) Decrypt(ctx context.Context, blob *wrapping.BlobInfo, _ ...wrapping.Option) ([]byte, error) {
+	if blob == nil || len(blob.Ciphertext) < tagSize || len(blob.Iv) == 0 {
+		return nil, errors.New("invalid wrapped key")
+	}
+	var uniqueID string
+	if blob.KeyInfo != nil {
+		uniqueID = blob.KeyInfo.KeyId
+	}
+	if uniqueID == "" {
+		var err error
+		if uniqueID, err = w.getUniqueID(ctx); err != nil {
+			return nil, err
+		}
+	}
+
+	split := len(blob.Ciphertext) - tagSize
+	payload, err := w.send(ctx, operationDecrypt, structure(tagRequestPayload,
+		textString(tagUniqueIdentifier, uniqueID),
+		cryptographicParameters(),
+		byteString(tagData, blob.Ciphertext[:split]),
+		byteString(tagIVCounterNonce, blob.Iv),
+		byteString(tagAuthenticatedEncryptionTag, blob.Ciphertext[split:]),
+	))
+	if err != nil {
+		return nil, fmt.Errorf("decrypting with KMIP key %s: %w", uniqueID, err)
+	}
+	plaintext, ok := payload.child(tagData)
+	if !ok {
+		return nil, errors.New("decrypt response contains no data")
+	}
+	plaintextData, ok := plaintext.value.([]byte)
+	if !ok {
+		return nil, errors.New("decrypt response data is not a byte string")
+	}
+	return plaintextData, nil
+}
+
+// getUniqueID returns the unique identifier of the KEK, looking it up by name on first use.
+func (w *kmipWrapper) getUniqueID(ctx context.Context) (string, error) {
+	w.mux.Lock()
+	defer w.mux.Unlock()
+	if w.uniqueID != "" {
+		return w.uniqueID, nil
+	}
+
+	payload, err := w.send(ctx, operationLocate, structure(tagRequestPayload,
+		structure(tagAttribute,
+			textString(tagAttributeName, "Name"),
+			structure(tagAttributeValue,
+				textString(tagNameValue, w.keyName),
+				enumeration(tagNameType, nameTypeText),
+			),
+		),
+	))
+	if err != nil {
+		return "", fmt.Errorf("locating KMIP key %q: %w", w.keyName, err)
+	}
+
+	children, ok := payload.value.([]item)
+	if !ok {
+		return "", errors.New("locate response payload is not a structure")
+	}
+	var ids []string
+	for _, c := range children {
+		if c.tag != tagUniqueIdentifier {
+			continue
+		}
+		id, ok := c.value.(string)
+		if !ok {
+			return "", errors.New("locate response unique identifier is not a text string")
+		}
+		ids = append(ids, id)
+	}
+	switch len(ids) {
+	case 0:
+		return "", fmt.Errorf("KMIP key %q not found", w.keyName)
+	case 1:
+		w.uniqueID = ids[0]
+		return w.uniqueID, nil
+	default:
+		return "", fmt.Errorf("KMIP key name %q is ambiguous: found %d keys", w.keyName, len(ids))
+	}
+}
+
+// send sends a request with a single batch item to the server and returns the response payload.
+func (w *kmipWrapper) send(ctx context.Context, operation uint32, payload item) (item, error) {
+	request, err := structure(tagRequestMessage,
+		structure(tagRequestHeader,
+			protocolVersion(),
+			integer(tagBatchCount, 1),
+		),
+		structure(tagBatchItem,
+			enumeration(tagOperation, operation),
+			payload,
+		),
+	).marshal()
+	if err != nil {
+		return item{}, err
+	}
+
+	if _, ok := ctx.Deadline(); !ok {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, requestTimeout)
+		defer cancel()
+	}
+	dialer := &tls.Dialer{Config: w.tlsConfig}
+	conn, err := dialer.DialContext(ctx, "tcp", w.address)
+	if err != nil {
+		return item{}, fmt.Errorf("connecting to KMIP server: %w", err)
+	}
+	defer conn.Close()
+	deadline, _ := ctx.Deadline()
+	if err := conn.SetDeadline(deadline); err != nil {
+		return item{}, err
+	}
+
+	if _, err := conn.Write(request); err != nil {
+		return item{}, fmt.Errorf("sending request: %w", err)
+	}
+	data, err := readMessage(conn)
+	if err != nil {
+		return item{}, err
+	}
+	return parseResponse(data, operation)
+}
+
+// parseResponse checks the result of a response with a single batch item and returns its payload.
+func parseResponse(data []byte, operation uint32) (item, error) {
+	response, _, err := unmarshalItem(data)
+	if err != nil {
+		return item{}, fmt.Errorf("decoding response: %w", err)
+	}
+	if response.tag != tagResponseMessage {
+		return item{}, fmt.Errorf("unexpected response message tag %06x", response.tag)
+	}
+	batchItem, ok := response.child(tagBatchItem)
+	if !ok {
+		return item{}, errors.New("response contains no batch item")
+	}
+	if op, ok := batchItem.child(tagOperation); ok && op.value != operation {
+		return item{}, fmt.Errorf("response is for operation %v, expected %d", op.value, operation)
+	}
+
+	status, ok := batchItem.child(tagResultStatus)
+	if !ok {
+		return item{}, errors.New("response contains no result status")
+	}
+	if status.value != resultStatusSuccess {
+		var message string
+		if m, ok := batchItem.child(tagResultMessage); ok {
+			message, _ = m.value.(string)
+		}
+		var reason any
+		if r, ok := batchItem.child(tagResultReason); ok {
+			reason = r.value
+		}
+		return item{}, fmt.Errorf("operation failed with status %v, reason %v: %s", status.value, reason, message)
+	}
+
+	payload, ok := batchItem.child(tagResponsePayload)
+	if !ok {
+		return item{}, errors.New("response contains no payload")
+	}
+	return payload, nil
+}
+
+func protocolVersion() item {
+	return structure(tagProtocolVersion,
+		integer(tagProtocolVersionMajor, protocolVersionMajor),
+		integer(tagProtocolVersionMinor, protocolVersionMinor),
+	)
+}
+
+func cryptographicParameters() item {
+	return structure(tagCryptographicParameters,
+		enumeration(tagBlockCipherMode, blockCipherModeGCM),
+		enumeration(tagCryptographicAlgorithm, cryptographicAlgorithmAES),
+		integer(tagTagLength, tagSize),
+	)
+}
@@ -0,0 +1,498 @@
+/*
+Copyright (c) Edgeless Systems GmbH
+
+SPDX-License-Identifier: BUSL-1.1
+*/
+
+package kmip
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"errors"
+	"math/big"
+	"net"
+	"os"
+	"path/filepath"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/edgelesssys/constellation/v2/internal/kms/storage/memfs"
+	"github.com/edgelesssys/constellation/v2/internal/kms/uri"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.uber.org/goleak"
+)
+
+func TestMain(m *testing.M) {
+	goleak.VerifyTestMain(m,
+		goleak.IgnoreAnyFunction("github.com/bazelbuild/rules_go/go/tools/bzltestutil.RegisterTimeoutHandler.func1"),
+	)
+}
+
+func TestGetDEK(t *testing.T) {
+	testCases := map[string]struct {
+		keyName       string
+		untrusted     bool
+		malformed     malformedResponse
+		generateIV    bool
+		rotate        bool
+		wantLocates   int
+		wantErr       bool
+		wantSecondErr bool
+	}{
+		"success": {
+			keyName:     "kek",
+			wantLocates: 1,
+		},
+		"name moved to new key": {
+			keyName:     "kek",
+			rotate:      true,
+			wantLocates: 1,
+		},
+		"unknown key": {
+			keyName: "other",
+			wantErr: true,
+		},
+		"ambiguous key name": {
+			keyName: "duplicate",
+			wantErr: true,
+		},
+		"short authentication tag": {
+			keyName:   "kek",
+			malformed: malformedAuthTag,
+			wantErr:   true,
+		},
+		"ciphertext is not a byte string": {
+			keyName:   "kek",
+			malformed: malformedCiphertext,
+			wantErr:   true,
+		},
+		"server generates IV": {
+			keyName:     "kek",
+			generateIV:  true,
+			wantLocates: 1,
+		},
+		"IV is not a byte string": {
+			keyName:    "kek",
+			generateIV: true,
+			malformed:  malformedIV,
+			wantErr:    true,
+		},
+		"unique identifier is not a text string": {
+			keyName:   "kek",
+			malformed: malformedUniqueID,
+			wantErr:   true,
+		},
+		"client certificate not trusted by server": {
+			keyName:   "kek",
+			untrusted: true,
+			wantErr:   true,
+		},
+	}
+
+	for name, tc := range testCases {
+		t.Run(name, func(t *testing.T) {
+			assert := assert.New(t)
+			require := require.New(t)
+
+			pki := newTestPKI(t)
+			server := newFakeServer(t, pki)
+			defer server.close()
+			server.malformed = tc.malformed
+			server.generateIV = tc.generateIV
+
+			cfg := pki.clientConfig(server.address(), tc.keyName)
+			if tc.untrusted {
+				cfg = newTestPKI(t).clientConfig(server.address(), tc.keyName)
+				cfg.CACertPath = pki.caCertPath
+			}
+			client, err := New(t.Context(), memfs.New(), cfg)
+			require.NoError(err)
+			defer client.Close()
+
+			dek, err := client.GetDEK(t.Context(), "volume-01", 32)
+			if tc.wantErr {
+				assert.Error(err)
+				return
+			}
+			require.NoError(err)
+			assert.Len(dek, 32)
+
+			if tc.rotate {
+				server.rotate(tc.keyName)
+			}
+
+			// The second request unwraps the DEK stored by the first one.
+			dek2, err := client.GetDEK(t.Context(), "volume-01", 32)
+			if tc.wantSecondErr {
+				assert.Error(err)
+				return
+			}
+			require.NoError(err)
+			assert.Equal(dek, dek2)
+
+			// A new DEK is wrapped with the key that was located first.
+			dek3, err := client.GetDEK(t.Context(), "volume-02", 32)
+			require.NoError(err)
+			assert.NotEqual(dek, dek3)
+			assert.Equal(tc.wantLocates, server.locateCount())
+		})
+	}
+}
+
+func TestNewErrors(t *testing.T) {
+	pki := newTestPKI(t)
+
+	testCases := map[string]func(*uri.KMIPConfig){
+		"invalid address":      func(c *uri.KMIPConfig) { c.Address = "kmip.example.com" },
+		"missing key name":     func(c *uri.KMIPConfig) { c.KeyName = "" },
+		"missing client key":   func(c *uri.KMIPConfig) { c.ClientKeyPath = "/does/not/exist" },
+		"mismatched key":       func(c *uri.KMIPConfig) { c.ClientKeyPath = newTestPKI(t).clientKeyPath },
+		"missing CA file":      func(c *uri.KMIPConfig) { c.CACertPath = "/does/not/exist" },
+		"no certificate in CA": func(c *uri.KMIPConfig) { c.CACertPath = pki.clientKeyPath },
+	}
+
+	for name, modify := range testCases {
+		t.Run(name, func(t *testing.T) {
+			cfg := pki.clientConfig("kmip.example.com:5696", "kek")
+			modify(&cfg)
+			_, err := New(t.Context(), memfs.New(), cfg)
+			assert.Error(t, err)
+		})
+	}
+
+	_, err := New(t.Context(), nil, pki.clientConfig("kmip.example.com:5696", "kek"))
+	assert.Error(t, err)
+}
+
+func TestTTLV(t *testing.T) {
+	assert := assert.New(t)
+	require := require.New(t)
+
+	msg := structure(tagRequestMessage,
+		integer(tagBatchCount, -1),
+		enumeration(tagOperation, operationDecrypt),
+		textString(tagUniqueIdentifier, "id"),
+		byteString(tagData, []byte("eleven byte")),
+		dateTime(tagTimeStamp, time.Unix(1700000000, 0)),
+		item{tag: tagBatchItem, typ: typeBoolean, value: true},
+		item{tag: tagBatchItem, typ: typeLongInteger, value: int64(-2)},
+		structure(tagBatchItem),
+	)
+	data, err := msg.marshal()
+	require.NoError(err)
+	assert.Zero(len(data) % 8)
+
+	// Padding of the byte string, see KMIP 1.4 section 9.1.1.
+	encoded, err := byteString(tagData, []byte("eleven byte")).marshal()
+	require.NoError(err)
+	assert.Equal([]byte{0x42, 0x00, 0xC2, 0x08, 0, 0, 0, 11}, encoded[:8])
+	assert.Len(encoded, 24)
+
+	decoded, n, err := unmarshalItem(data)
+	require.NoError(err)
+	assert.Equal(len(data), n)
+	assert.Equal(msg.tag, decoded.tag)
+	for _, want := range msg.value.([]item) {
+		got, ok := decoded.child(want.tag)
+		require.True(ok)
+		if want.tag != tagBatchItem {
+			assert.Equal(want, got)
+		}
+	}
+
+	_, _, err = unmarshalItem(data[:len(data)-8])
+	assert.Error(err)
+	_, err = item{tag: tagData, typ: typeInteger, value: 1}.marshal()
+	assert.Error(err)
+}
+
+// testPKI holds a CA and server and client certificates issued by it.
+type testPKI struct {
+	caCertPath     string
+	clientCertPath string
+	clientKeyPath  string
+	roots          *x509.CertPool
+	serverCert     tls.Certificate
+}
+
+func newTestPKI(t *testing.T) testPKI {
+	t.Helper()
+	require := require.New(t)
+	dir := t.TempDir()
+
+	caKey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	require.NoError(err)
+	caTemplate := &x509.Certificate{
+		SerialNumber:          big.NewInt(1),
+		Subject:               pkix.Name{CommonName: "test CA"},
+		NotBefore:             time.Now().Add(-time.Hour),
+		NotAfter:              time.Now().Add(time.Hour),
+		IsCA:                  true,
+		BasicConstraintsValid: true,
+		KeyUsage:              x509.KeyUsageCertSign,
+	}
+	caDER, err := x509.CreateCertificate(rand.Reader, caTemplate, caTemplate, &caKey.PublicKey, caKey)
+	require.NoError(err)
+	caCert, err := x509.ParseCertificate(caDER)
+	require.NoError(err)
+
+	issue := func(serial int64, template *x509.Certificate) ([]byte, []byte) {
+		key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+		require.NoError(err)
+		template.SerialNumber = big.NewInt(serial)
+		template.NotBefore = caTemplate.NotBefore
+		template.NotAfter = caTemplate.NotAfter
+		der, err := x509.CreateCertificate(rand.Reader, template, caCert, &key.PublicKey, caKey)
+		require.NoError(err)
+		keyDER, err := x509.MarshalECPrivateKey(key)
+		require.NoError(err)
+		return pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der}),
+			pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: keyDER})
+	}
+
+	serverCertPEM, serverKeyPEM := issue(2, &x509.Certificate{
+		Subject:     pkix.Name{CommonName: "kmip server"},
+		IPAddresses: []net.IP{net.IPv4(127, 0, 0, 1)},
+		ExtKeyUsage: []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth},
+	})
+	serverCert, err := tls.X509KeyPair(serverCertPEM, serverKeyPEM)
+	require.NoError(err)
+	clientCertPEM, clientKeyPEM := issue(3, &x509.Certificate{
+		Subject:     pkix.Name{CommonName: "constellation"},
+		ExtKeyUsage: []x509.ExtKeyUsage{x509.ExtKeyUsageClientAuth},
+	})
+
+	pki := testPKI{
+		caCertPath:     filepath.Join(dir, "ca.pem"),
+		clientCertPath: filepath.Join(dir, "client.pem"),
+		clientKeyPath:  filepath.Join(dir, "client-key.pem"),
+		roots:          x509.NewCertPool(),
+		serverCert:     serverCert,
+	}
+	pki.roots.AddCert(caCert)
+	require.NoError(os.WriteFile(pki.caCertPath, pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: caDER}), 0o600))
+	require.NoError(os.WriteFile(pki.clientCertPath, clientCertPEM, 0o600))
+	require.NoError(os.WriteFile(pki.clientKeyPath, clientKeyPEM, 0o600))
+	return pki
+}
+
+func (p testPKI) clientConfig(address, keyName string) uri.KMIPConfig {
+	return uri.KMIPConfig{
+		Address:        address,
+		KeyName:        keyName,
+		ClientCertPath: p.clientCertPath,
+		ClientKeyPath:  p.clientKeyPath,
+		CACertPath:     p.caCertPath,
+	}
+}
+
+// malformedResponse selects a response field the fake server sends with an unexpected type or size.
+type malformedResponse int
+
+const (
+	wellformed malformedResponse = iota
+	malformedAuthTag
+	malformedCiphertext
+	malformedUniqueID
+	malformedIV
+)
+
+// fakeServer implements the Locate, Encrypt and Decrypt operations of a KMIP server with AES-GCM keys.
+// If generateIV is set, it encrypts with an IV of its own and returns it, as some HSMs do.
+type fakeServer struct {
+	listener net.Listener
+	wg       sync.WaitGroup
+
+	mux        sync.Mutex
+	names      map[string][]string
+	keys       map[string][]byte
+	locates    int
+	malformed  malformedResponse
+	generateIV bool
+}
+
+func newFakeServer(t *testing.T, pki testPKI) *fakeServer {
+	t.Helper()
+	listener, err := tls.Listen("tcp", "127.0.0.1:0", &tls.Config{
+		Certificates: []tls.Certificate{pki.serverCert},
+		ClientCAs:    pki.roots,
+		ClientAuth:   tls.RequireAndVerifyClientCert,
+		MinVersion:   tls.VersionTLS12,
+	})
+	require.NoError(t, err)
+
+	s := &fakeServer{
+		listener: listener,
+		names:    map[string][]string{},
+		keys:     map[string][]byte{},
+	}
+	s.rotate("kek")
+	s.rotate("duplicate")
+	s.names["duplicate"] = append(s.names["duplicate"], "extra")
+
+	s.wg.Add(1)
+	go func() {
+		defer s.wg.Done()
+		for {
+			conn, err := listener.Accept()
+			if err != nil {
+				return
+			}
+			s.wg.Add(1)
+			go func() {
+				defer s.wg.Done()
+				s.serve(conn)
+			}()
+		}
+	}()
+	return s
+}
+
+func (s *fakeServer) address() string {
+	return s.listener.Addr().String()
+}
+
+func (s *fakeServer) close() {
+	s.listener.Close()
+	s.wg.Wait()
+}
+
+// rotate creates a new key and moves the name to it.
+func (s *fakeServer) rotate(name string) {
+	s.mux.Lock()
+	defer s.mux.Unlock()
+	id := name + "-" + string(rune('a'+len(s.keys)))
+	key := make([]byte, 32)
+	_, _ = rand.Read(key)
+	s.keys[id] = key
+	s.names[name] = []string{id}
+}
+
+func (s *fakeServer) locateCount() int {
+	s.mux.Lock()
+	defer s.mux.Unlock()
+	return s.locates
+}
+
+func (s *fakeServer) serve(conn net.Conn) {
+	defer conn.Close()
+	data, err := readMessage(conn)
+	if err != nil {
+		return
+	}
+	request, _, err := unmarshalItem(data)
+	if err != nil {
+		return
+	}
+	batchItem, _ := request.child(tagBatchItem)
+	operation, _ := batchItem.child(tagOperation)
+	payload, _ := batchItem.child(tagRequestPayload)
+
+	s.mux.Lock()
+	result, err := s.handle(operation.value, payload)
+	s.mux.Unlock()
+
+	responseItem := structure(tagBatchItem, operation, enumeration(tagResultStatus, resultStatusSuccess), result)
+	if err != nil {
+		responseItem = structure(tagBatchItem,
+			operation,
+			enumeration(tagResultStatus, 0x01),
+			enumeration(tagResultReason, 0x01),
+			textString(tagResultMessage, err.Error()),
+		)
+	}
+	response, _ := structure(tagResponseMessage,
+		structure(tagResponseHeader,
+			protocolVersion(),
+			dateTime(tagTimeStamp, time.Now()),
+			integer(tagBatchCount, 1),
+		),
+		responseItem,
+	).marshal()
+	_, _ = conn.Write(response)
+}
+
+func (s *fakeServer) handle(operation any, payload item) (item, error) {
+	if operation == operationLocate {
+		s.locates++
+		attribute, _ := payload.child(tagAttribute)
+		value, _ := attribute.child(tagAttributeValue)
+		name, _ := value.child(tagNameValue)
+		result := structure(tagResponsePayload)
+		for _, id := range s.names[name.value.(string)] {
+			uniqueID := textString(tagUniqueIdentifier, id)
+			if s.malformed == malformedUniqueID {
+				uniqueID = integer(tagUniqueIdentifier, 1)
+			}
+			result.value = append(result.value.([]item), uniqueID)
+		}
+		return result, nil
+	}
+
+	id, _ := payload.child(tagUniqueIdentifier)
+	key, ok := s.keys[id.value.(string)]
+	if !ok {
+		return item{}, errors.New("item not found")
+	}
+	params, _ := payload.child(tagCryptographicParameters)
+	if mode, _ := params.child(tagBlockCipherMode); mode.value != blockCipherModeGCM {
+		return item{}, errors.New("unsupported block cipher mode")
+	}
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return item{}, err
+	}
+	gcm, err := cipher.NewGCM(block)
+	if err != nil {
+		return item{}, err
+	}
+	data, _ := payload.child(tagData)
+	iv, _ := payload.child(tagIVCounterNonce)
+
+	switch operation {
+	case operationEncrypt:
+		nonce := iv.value.([]byte)
+		if s.generateIV {
+			nonce = make([]byte, gcm.NonceSize())
+			_, _ = rand.Read(nonce)
+		}
+		sealed := gcm.Seal(nil, nonce, data.value.([]byte), nil)
+		split := len(sealed) - gcm.Overhead()
+		ciphertext := byteString(tagData, sealed[:split])
+		authTag := byteString(tagAuthenticatedEncryptionTag, sealed[split:])
+		switch s.malformed {
+		case malformedAuthTag:
+			authTag = byteString(tagAuthenticatedEncryptionTag, sealed[split+1:])
+		case malformedCiphertext:
+			ciphertext = textString(tagData, string(sealed[:split]))
+		}
+		result := structure(tagResponsePayload, id, ciphertext, authTag)
+		if s.generateIV {
+			returnedIV := byteString(tagIVCounterNonce, nonce)
+			if s.malformed == malformedIV {
+				returnedIV = textString(tagIVCounterNonce, string(nonce))
+			}
+			result.value = append(result.value.([]item), returnedIV)
+		}
+		return result, nil
+	case operationDecrypt:
+		authTag, _ := payload.child(tagAuthenticatedEncryptionTag)
+		plaintext, err := gcm.Open(nil, iv.value.([]byte), append(data.value.([]byte), authTag.value.([]byte)...), nil)
+		if err != nil {
+			return item{}, err
+		}
+		return structure(tagResponsePayload, id, byteString(tagData, plaintext)), nil
+	default:
+		return item{}, errors.New("operation not supported")
+	}
+}
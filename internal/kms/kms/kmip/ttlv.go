@@ -0,0 +1,243 @@
+/*
+Copyright (c) Edgeless Systems GmbH
+
+SPDX-License-Identifier: BUSL-1.1
+*/
+
+package kmip
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"time"
+)
+
+// KMIP messages are encoded as Tag-Type-Length-Value (TTLV) items.
+// Each item has a 3 byte tag, a 1 byte type, a 4 byte length and a value that is padded to a multiple of 8 bytes.
+
+// itemType is the type of a TTLV item.
+type itemType byte
+
+const (
+	typeStructure   itemType = 0x01
+	typeInteger     itemType = 0x02
+	typeLongInteger itemType = 0x03
+	typeEnumeration itemType = 0x05
+	typeBoolean     itemType = 0x06
+	typeTextString  itemType = 0x07
+	typeByteString  itemType = 0x08
+	typeDateTime    itemType = 0x09
+	typeInterval    itemType = 0x0A
+)
+
+// tag identifies the meaning of a TTLV item.
+type tag uint32
+
+// Tags used by the KMS client, as defined in the KMIP 1.4 specification.
+const (
+	tagAttribute                  tag = 0x420008
+	tagAttributeName              tag = 0x42000A
+	tagAttributeValue             tag = 0x42000B
+	tagBatchCount                 tag = 0x42000D
+	tagBatchItem                  tag = 0x42000F
+	tagBlockCipherMode            tag = 0x420011
+	tagCryptographicAlgorithm     tag = 0x420028
+	tagCryptographicParameters    tag = 0x42002B
+	tagIVCounterNonce             tag = 0x42003D
+	tagNameType                   tag = 0x420054
+	tagNameValue                  tag = 0x420055
+	tagOperation                  tag = 0x42005C
+	tagProtocolVersion            tag = 0x420069
+	tagProtocolVersionMajor       tag = 0x42006A
+	tagProtocolVersionMinor       tag = 0x42006B
+	tagRequestHeader              tag = 0x420077
+	tagRequestMessage             tag = 0x420078
+	tagRequestPayload             tag = 0x420079
+	tagResponseHeader             tag = 0x42007A
+	tagResponseMessage            tag = 0x42007B
+	tagResponsePayload            tag = 0x42007C
+	tagResultMessage              tag = 0x42007D
+	tagResultReason               tag = 0x42007E
+	tagResultStatus               tag = 0x42007F
+	tagTimeStamp                  tag = 0x420092
+	tagUniqueIdentifier           tag = 0x420094
+	tagData                       tag = 0x4200C2
+	tagTagLength                  tag = 0x4200C7
+	tagAuthenticatedEncryptionTag tag = 0x4200FF
+)
+
+// maxMessageSize limits the size of messages read from the server.
+const maxMessageSize = 1 << 20
+
+// item is a decoded TTLV item.
+// The type of value depends on the item type:
+// []item for structures, int32 for integers and intervals, uint32 for enumerations, int64 for long integers,
+// bool for booleans, string for text strings, []byte for byte strings and time.Time for date-times.
+type item struct {
+	tag   tag
+	typ   itemType
+	value any
+}
+
+func structure(t tag, children ...item) item {
+	return item{tag: t, typ: typeStructure, value: children}
+}
+
+func integer(t tag, v int32) item {
+	return item{tag: t, typ: typeInteger, value: v}
+}
+
+func enumeration(t tag, v uint32) item {
+	return item{tag: t, typ: typeEnumeration, value: v}
+}
+
+func textString(t tag, v string) item {
+	return item{tag: t, typ: typeTextString, value: v}
+}
+
+func byteString(t tag, v []byte) item {
+	return item{tag: t, typ: typeByteString, value: v}
+}
+
+func dateTime(t tag, v time.Time) item {
+	return item{tag: t, typ: typeDateTime, value: v}
+}
+
+// child returns the first child of a structure with the given tag.
+func (i item) child(t tag) (item, bool) {
+	children, _ := i.value.([]item)
+	for _, c := range children {
+		if c.tag == t {
+			return c, true
+		}
+	}
+	return item{}, false
+}
+
+// marshal encodes the item as TTLV.
+func (i item) marshal() ([]byte, error) {
+	var value []byte
+	switch v := i.value.(type) {
+	case []item:
+		for _, c := range v {
+			encoded, err := c.marshal()
+			if err != nil {
+				return nil, err
+			}
+			value = append(value, encoded...)
+		}
+	case int32:
+		value = binary.BigEndian.AppendUint32(nil, uint32(v))
+	case uint32:
+		value = binary.BigEndian.AppendUint32(nil, v)
+	case int64:
+		value = binary.BigEndian.AppendUint64(nil, uint64(v))
+	case bool:
+		var b uint64
+		if v {
+			b = 1
+		}
+		value = binary.BigEndian.AppendUint64(nil, b)
+	case string:
+		value = []byte(v)
+	case []byte:
+		value = v
+	case time.Time:
+		value = binary.BigEndian.AppendUint64(nil, uint64(v.Unix()))
+	default:
+		return nil, fmt.Errorf("unsupported value of type %T for tag %06x", i.value, i.tag)
+	}
+
+	out := make([]byte, 8, 8+len(value)+padding(len(value)))
+	out[0], out[1], out[2] = byte(i.tag>>16), byte(i.tag>>8), byte(i.tag)
+	out[3] = byte(i.typ)
+	binary.BigEndian.PutUint32(out[4:], uint32(len(value)))
+	out = append(out, value...)
+	return append(out, make([]byte, padding(len(value)))...), nil
+}
+
+// unmarshalItem decodes a single TTLV item from data and returns the number of bytes read.
+func unmarshalItem(data []byte) (item, int, error) {
+	if len(data) < 8 {
+		return item{}, 0, errors.New("TTLV item too short")
+	}
+	i := item{
+		tag: tag(uint32(data[0])<<16 | uint32(data[1])<<8 | uint32(data[2])),
+		typ: itemType(data[3]),
+	}
+	length := int(binary.BigEndian.Uint32(data[4:8]))
+	size := 8 + length + padding(length)
+	if length > len(data)-8 || size > len(data) {
+		return item{}, 0, fmt.Errorf("TTLV item %06x exceeds message", i.tag)
+	}
+	value := data[8 : 8+length]
+
+	switch i.typ {
+	case typeStructure:
+		var children []item
+		for len(value) > 0 {
+			c, n, err := unmarshalItem(value)
+			if err != nil {
+				return item{}, 0, err
+			}
+			children = append(children, c)
+			value = value[n:]
+		}
+		i.value = children
+	case typeInteger, typeInterval, typeEnumeration:
+		if length != 4 {
+			return item{}, 0, fmt.Errorf("invalid length %d of TTLV item %06x", length, i.tag)
+		}
+		if i.typ == typeEnumeration {
+			i.value = binary.BigEndian.Uint32(value)
+		} else {
+			i.value = int32(binary.BigEndian.Uint32(value))
+		}
+	case typeLongInteger, typeBoolean, typeDateTime:
+		if length != 8 {
+			return item{}, 0, fmt.Errorf("invalid length %d of TTLV item %06x", length, i.tag)
+		}
+		v := binary.BigEndian.Uint64(value)
+		switch i.typ {
+		case typeLongInteger:
+			i.value = int64(v)
+		case typeBoolean:
+			i.value = v != 0
+		default:
+			i.value = time.Unix(int64(v), 0)
+		}
+	case typeTextString:
+		i.value = string(value)
+	case typeByteString:
+		i.value = append([]byte(nil), value...)
+	default:
+		// Other types, e.g. big integers, are not used by the client and are kept as raw bytes.
+		i.value = append([]byte(nil), value...)
+	}
+	return i, size, nil
+}
+
+// readMessage reads a single TTLV encoded message from r.
+func readMessage(r io.Reader) ([]byte, error) {
+	header := make([]byte, 8)
+	if _, err := io.ReadFull(r, header); err != nil {
+		return nil, fmt.Errorf("reading message header: %w", err)
+	}
+	length := binary.BigEndian.Uint32(header[4:])
+	if itemType(header[3]) != typeStructure || length > maxMessageSize {
+		return nil, fmt.Errorf("invalid message header %x", header)
+	}
+	message := make([]byte, 8+int(length))
+	copy(message, header)
+	if _, err := io.ReadFull(r, message[8:]); err != nil {
+		return nil, fmt.Errorf("reading message: %w", err)
+	}
+	return message, nil
+}
+
+// padding returns the number of bytes needed to pad a value of the given length to a multiple of 8 bytes.
+func padding(length int) int {
+	return (8 - length%8) % 8
+}
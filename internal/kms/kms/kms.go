@@ -20,6 +20,17 @@ type CloudKMS interface {
 	Close()
 }
 
+// KeyEscrow is implemented by KMSs that can escrow existing keys.
+// All KMSs that wrap DEKs with a KEK and save them to a storage backend implement it.
+type KeyEscrow interface {
+	CloudKMS
+	// PutDEK encrypts the given DEK and saves it to storage, replacing any existing DEK with the same ID.
+	PutDEK(ctx context.Context, dekID string, dek []byte) error
+	// LoadDEK returns the DEK with the given ID from the KMS.
+	// Unlike GetDEK, it doesn't create missing DEKs, but returns storage.ErrDEKUnset.
+	LoadDEK(ctx context.Context, dekID string) ([]byte, error)
+}
+
 // Storage provides an abstract interface for the storage backend used for DEKs.
 type Storage interface {
 	// Get returns a DEK from the storage by key ID. If the DEK does not exist, returns storage.ErrDEKUnset.
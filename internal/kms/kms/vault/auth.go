@@ -0,0 +1,121 @@
+/*
+Copyright (c) Edgeless Systems GmbH
+
+SPDX-License-Identifier: BUSL-1.1
+*/
+
+package vault
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/edgelesssys/constellation/v2/internal/kms/uri"
+)
+
+// authenticator obtains Vault tokens.
+type authenticator interface {
+	// login returns a token and its time to live. A zero TTL means the token doesn't expire.
+	login(ctx context.Context, w *transitWrapper) (string, time.Duration, error)
+	// canRenew reports whether login can return a new token after the current one was rejected.
+	canRenew() bool
+}
+
+func newAuthenticator(cfg uri.VaultConfig) (authenticator, error) {
+	switch cfg.AuthMethod {
+	case uri.VaultAuthToken:
+		if cfg.Token == "" {
+			return nil, errors.New("no Vault token provided")
+		}
+		return tokenAuth{token: cfg.Token}, nil
+
+	case uri.VaultAuthAppRole:
+		if cfg.RoleID == "" || cfg.SecretID == "" {
+			return nil, errors.New("authentication with AppRole requires a role ID and a secret ID")
+		}
+		return loginAuth{
+			mount: authMount(cfg, "approle"),
+			credentials: func() (map[string]string, error) {
+				return map[string]string{"role_id": cfg.RoleID, "secret_id": cfg.SecretID}, nil
+			},
+		}, nil
+
+	case uri.VaultAuthKubernetes:
+		if cfg.Role == "" {
+			return nil, errors.New("authentication with Kubernetes requires a Vault role")
+		}
+		jwtPath := cfg.JWTPath
+		if jwtPath == "" {
+			jwtPath = defaultJWTPath
+		}
+		return loginAuth{
+			mount: authMount(cfg, "kubernetes"),
+			// The service account token is rotated by Kubernetes, so it is read on every login.
+			credentials: func() (map[string]string, error) {
+				jwt, err := os.ReadFile(jwtPath)
+				if err != nil {
+					return nil, fmt.Errorf("reading service account token: %w", err)
+				}
+				return map[string]string{"role": cfg.Role, "jwt": strings.TrimSpace(string(jwt))}, nil
+			},
+		}, nil
+
+	default:
+		return nil, fmt.Errorf("unknown Vault auth method: %q", cfg.AuthMethod)
+	}
+}
+
+func authMount(cfg uri.VaultConfig, defaultMount string) string {
+	if cfg.AuthMount == "" {
+		return defaultMount
+	}
+	return strings.Trim(cfg.AuthMount, "/")
+}
+
+// tokenAuth uses a static token.
+type tokenAuth struct {
+	token string
+}
+
+func (a tokenAuth) login(context.Context, *transitWrapper) (string, time.Duration, error) {
+	return a.token, 0, nil
+}
+
+func (a tokenAuth) canRenew() bool {
+	return false
+}
+
+// loginAuth logs in to an auth method that exchanges credentials for a token, e.g. AppRole or Kubernetes.
+type loginAuth struct {
+	mount       string
+	credentials func() (map[string]string, error)
+}
+
+func (a loginAuth) login(ctx context.Context, w *transitWrapper) (string, time.Duration, error) {
+	credentials, err := a.credentials()
+	if err != nil {
+		return "", 0, err
+	}
+
+	var resp struct {
+		Auth struct {
+			ClientToken   string `json:"client_token"`
+			LeaseDuration int64  `json:"lease_duration"`
+		} `json:"auth"`
+	}
+	if err := w.do(ctx, fmt.Sprintf("/v1/auth/%s/login", a.mount), "", credentials, &resp); err != nil {
+		return "", 0, err
+	}
+	if resp.Auth.ClientToken == "" {
+		return "", 0, errors.New("no client token returned by Vault")
+	}
+	return resp.Auth.ClientToken, time.Duration(resp.Auth.LeaseDuration) * time.Second, nil
+}
+
+func (a loginAuth) canRenew() bool {
+	return true
+}
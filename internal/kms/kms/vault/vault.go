@@ -0,0 +1,309 @@
+/*
+Copyright (c) Edgeless Systems GmbH
+
+SPDX-License-Identifier: BUSL-1.1
+*/
+
+/*
+Package vault implements a KMS backend for the transit secrets engine of HashiCorp Vault and OpenBao.
+
+DEKs are wrapped and unwrapped by Vault using a transit key, the KEK never leaves Vault.
+The client talks to the Vault HTTP API directly and supports token, AppRole and Kubernetes authentication.
+*/
+package vault
+
+import (
+	"bytes"
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	kmsInterface "github.com/edgelesssys/constellation/v2/internal/kms/kms"
+	"github.com/edgelesssys/constellation/v2/internal/kms/kms/internal"
+	"github.com/edgelesssys/constellation/v2/internal/kms/uri"
+	wrapping "github.com/hashicorp/go-kms-wrapping/v2"
+)
+
+const (
+	// defaultTransitMount is the default path of the transit secrets engine.
+	defaultTransitMount = "transit"
+	// defaultJWTPath is the path of the service account token in Kubernetes pods.
+	defaultJWTPath = "/var/run/secrets/kubernetes.io/serviceaccount/token"
+	// tokenRenewalMargin is the time before a token expires at which a new token is requested.
+	tokenRenewalMargin = 30 * time.Second
+)
+
+// KMSClient implements the CloudKMS interface for Vault.
+type KMSClient struct {
+	kms    *internal.KMSClient
+	client *http.Client
+}
+
+// New creates and initializes a new KMSClient for Vault.
+func New(_ context.Context, store kmsInterface.Storage, cfg uri.VaultConfig) (*KMSClient, error) {
+	if store == nil {
+		return nil, errors.New("no storage backend provided for KMS")
+	}
+
+	wrapper, err := newTransitWrapper(cfg)
+	if err != nil {
+		return nil, fmt.Errorf("setting Vault config: %w", err)
+	}
+	return &KMSClient{
+		kms: &internal.KMSClient{
+			Storage: store,
+			Wrapper: wrapper,
+		},
+		client: wrapper.client,
+	}, nil
+}
+
+// GetDEK fetches an encrypted Data Encryption Key from storage and decrypts it using a transit key stored in Vault.
+func (c *KMSClient) GetDEK(ctx context.Context, keyID string, dekSize int) ([]byte, error) {
+	return c.kms.GetDEK(ctx, keyID, dekSize)
+}
+
+// PutDEK encrypts a Data Encryption Key and saves it to storage, e.g., to escrow an existing key.
+func (c *KMSClient) PutDEK(ctx context.Context, keyID string, dek []byte) error {
+	return c.kms.PutDEK(ctx, keyID, dek)
+}
+
+// LoadDEK fetches an existing Data Encryption Key from storage and decrypts it.
+func (c *KMSClient) LoadDEK(ctx context.Context, keyID string) ([]byte, error) {
+	return c.kms.LoadDEK(ctx, keyID)
+}
+
+// Close closes idle connections to Vault.
+func (c *KMSClient) Close() {
+	c.client.CloseIdleConnections()
+}
+
+// transitWrapper wraps and unwraps keys using the transit secrets engine.
+type transitWrapper struct {
+	client       *http.Client
+	address      *url.URL
+	namespace    string
+	transitMount string
+	keyName      string
+	auth         authenticator
+
+	mux         sync.Mutex
+	token       string
+	tokenExpiry time.Time
+}
+
+func newTransitWrapper(cfg uri.VaultConfig) (*transitWrapper, error) {
+	address, err := url.Parse(cfg.Address)
+	if err != nil {
+		return nil, fmt.Errorf("parsing Vault address: %w", err)
+	}
+	if address.Scheme != "http" && address.Scheme != "https" {
+		return nil, fmt.Errorf("invalid Vault address %q: must use http or https", cfg.Address)
+	}
+	if cfg.KeyName == "" {
+		return nil, errors.New("no transit key name provided")
+	}
+
+	auth, err := newAuthenticator(cfg)
+	if err != nil {
+		return nil, err
+	}
+	client, err := newHTTPClient(cfg.CACertPath)
+	if err != nil {
+		return nil, err
+	}
+
+	transitMount := cfg.TransitMount
+	if transitMount == "" {
+		transitMount = defaultTransitMount
+	}
+
+	return &transitWrapper{
+		client:       client,
+		address:      address,
+		namespace:    cfg.Namespace,
+		transitMount: strings.Trim(transitMount, "/"),
+		keyName:      cfg.KeyName,
+		auth:         auth,
+	}, nil
+}
+
+// Encrypt wraps plaintext with the transit key.
+func (w *transitWrapper) Encrypt(ctx context.Context, plaintext []byte, _ ...wrapping.Option) (*wrapping.BlobInfo, error) {
+	var resp struct {
+		Data struct {
+			Ciphertext string `json:"ciphertext"`
+		} `json:"data"`
+	}
+	req := map[string]string{"plaintext": base64.StdEncoding.EncodeToString(plaintext)}
+	if err := w.authenticatedRequest(ctx, w.transitPath("encrypt"), req, &resp); err != nil {
+		return nil, err
+	}
+	if resp.Data.Ciphertext == "" {
+		return nil, errors.New("no ciphertext returned by Vault")
+	}
+
+	return &wrapping.BlobInfo{
+		Ciphertext: []byte(resp.Data.Ciphertext),
+		KeyInfo:    &wrapping.KeyInfo{KeyId: w.keyName},
+	}, nil
+}
+
+// Decrypt unwraps a ciphertext that was wrapped with the transit key.
+// Vault chooses the key version based on the ciphertext's prefix, so rotated transit keys are supported.
+func (w *transitWrapper) Decrypt(ctx context.Context, blob *wrapping.BlobInfo, _ ...wrapping.Option) ([]byte, error) {
+	if blob == nil || len(blob.Ciphertext) == 0 {
+		return nil, errors.New("no ciphertext provided")
+	}
+
+	var resp struct {
+		Data struct {
+			Plaintext string `json:"plaintext"`
+		} `json:"data"`
+	}
+	req := map[string]string{"ciphertext": string(blob.Ciphertext)}
+	if err := w.authenticatedRequest(ctx, w.transitPath("decrypt"), req, &resp); err != nil {
+		return nil, err
+	}
+
+	plaintext, err := base64.StdEncoding.DecodeString(resp.Data.Plaintext)
+	if err != nil {
+		return nil, fmt.Errorf("decoding plaintext: %w", err)
+	}
+	return plaintext, nil
+}
+
+func (w *transitWrapper) transitPath(operation string) string {
+	return fmt.Sprintf("/v1/%s/%s/%s", w.transitMount, operation, url.PathEscape(w.keyName))
+}
+
+// authenticatedRequest sends a request with a valid Vault token.
+// If Vault rejects the token, for example because it was revoked, a new token is requested once.
+func (w *transitWrapper) authenticatedRequest(ctx context.Context, path string, body, result any) error {
+	token, err := w.getToken(ctx, false)
+	if err != nil {
+		return err
+	}
+	err = w.do(ctx, path, token, body, result)
+	var respErr *responseError
+	if !errors.As(err, &respErr) || respErr.statusCode != http.StatusForbidden || !w.auth.canRenew() {
+		return err
+	}
+
+	if token, err = w.getToken(ctx, true); err != nil {
+		return err
+	}
+	return w.do(ctx, path, token, body, result)
+}
+
+// getToken returns a cached token, or logs in to Vault if there is no valid token.
+func (w *transitWrapper) getToken(ctx context.Context, forceLogin bool) (string, error) {
+	w.mux.Lock()
+	defer w.mux.Unlock()
+
+	if !forceLogin && w.token != "" && (w.tokenExpiry.IsZero() || time.Now().Before(w.tokenExpiry.Add(-tokenRenewalMargin))) {
+		return w.token, nil
+	}
+
+	token, ttl, err := w.auth.login(ctx, w)
+	if err != nil {
+		return "", fmt.Errorf("authenticating with Vault: %w", err)
+	}
+	w.token = token
+	w.tokenExpiry = time.Time{}
+	if ttl > 0 {
+		w.tokenExpiry = time.Now().Add(ttl)
+	}
+	return w.token, nil
+}
+
+// do sends a POST request to the Vault API and decodes the JSON response into result.
+func (w *transitWrapper) do(ctx context.Context, path, token string, body, result any) error {
+	data, err := json.Marshal(body)
+	if err != nil {
+		return fmt.Errorf("marshaling request: %w", err)
+	}
+
+	endpoint := w.address.JoinPath(path)
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, endpoint.String(), bytes.NewReader(data))
+	if err != nil {
+		return fmt.Errorf("creating request: %w", err)
+	}
+	req.Header.Set("Content-Type", "application/json")
+	if token != "" {
+		req.Header.Set("X-Vault-Token", token)
+	}
+	if w.namespace != "" {
+		req.Header.Set("X-Vault-Namespace", w.namespace)
+	}
+
+	resp, err := w.client.Do(req)
+	if err != nil {
+		return fmt.Errorf("sending request to Vault: %w", err)
+	}
+	defer resp.Body.Close()
+
+	respBody, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return fmt.Errorf("reading Vault response: %w", err)
+	}
+	if resp.StatusCode != http.StatusOK {
+		return newResponseError(resp.StatusCode, respBody)
+	}
+	if err := json.Unmarshal(respBody, result); err != nil {
+		return fmt.Errorf("unmarshaling Vault response: %w", err)
+	}
+	return nil
+}
+
+// responseError is an error returned by the Vault API.
+type responseError struct {
+	statusCode int
+	errors     []string
+}
+
+func newResponseError(statusCode int, body []byte) *responseError {
+	var resp struct {
+		Errors []string `json:"errors"`
+	}
+	_ = json.Unmarshal(body, &resp)
+	return &responseError{statusCode: statusCode, errors: resp.Errors}
+}
+
+func (e *responseError) Error() string {
+	if len(e.errors) == 0 {
+		return fmt.Sprintf("request to Vault failed with status code %d", e.statusCode)
+	}
+	return fmt.Sprintf("request to Vault failed with status code %d: %s", e.statusCode, strings.Join(e.errors, "; "))
+}
+
+// newHTTPClient returns an HTTP client that trusts the CA certificates in caCertPath in addition to the system roots.
+func newHTTPClient(caCertPath string) (*http.Client, error) {
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+	if caCertPath != "" {
+		pem, err := os.ReadFile(caCertPath)
+		if err != nil {
+			return nil, fmt.Errorf("reading Vault CA certificate: %w", err)
+		}
+		roots, err := x509.SystemCertPool()
+		if err != nil {
+			return nil, fmt.Errorf("loading system CA certificates: %w", err)
+		}
+		if !roots.AppendCertsFromPEM(pem) {
+			return nil, fmt.Errorf("no certificates found in %s", caCertPath)
+		}
+		transport.TLSClientConfig = &tls.Config{RootCAs: roots, MinVersion: tls.VersionTLS12}
+	}
+	return &http.Client{Transport: transport, Timeout: 30 * time.Second}, nil
+}
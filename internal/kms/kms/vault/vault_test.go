@@ -0,0 +1,254 @@
+/*
+Copyright (c) Edgeless Systems GmbH
+
+SPDX-License-Identifier: BUSL-1.1
+*/
+
+package vault
+
+import (
+	"bytes"
+	"encoding/base64"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/edgelesssys/constellation/v2/internal/kms/storage/memfs"
+	"github.com/edgelesssys/constellation/v2/internal/kms/uri"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.uber.org/goleak"
+)
+
+func TestMain(m *testing.M) {
+	goleak.VerifyTestMain(m,
+		goleak.IgnoreAnyFunction("github.com/bazelbuild/rules_go/go/tools/bzltestutil.RegisterTimeoutHandler.func1"),
+	)
+}
+
+func TestGetDEK(t *testing.T) {
+	jwtPath := filepath.Join(t.TempDir(), "token")
+	require.NoError(t, os.WriteFile(jwtPath, []byte("service-account-jwt\n"), 0o600))
+
+	testCases := map[string]struct {
+		cfg           func(address string) uri.VaultConfig
+		revoke        bool
+		wantLogins    int
+		wantErr       bool
+		wantSecondErr bool
+	}{
+		"token": {
+			cfg: func(address string) uri.VaultConfig {
+				return uri.VaultConfig{Address: address, KeyName: "kek", AuthMethod: uri.VaultAuthToken, Token: "root"}
+			},
+		},
+		"approle": {
+			cfg: func(address string) uri.VaultConfig {
+				return uri.VaultConfig{
+					Address: address, KeyName: "kek", AuthMethod: uri.VaultAuthAppRole,
+					RoleID: "role-id", SecretID: "secret-id",
+				}
+			},
+			wantLogins: 1,
+		},
+		"kubernetes with custom mounts and namespace": {
+			cfg: func(address string) uri.VaultConfig {
+				return uri.VaultConfig{
+					Address: address, Namespace: "team", TransitMount: "/keys/", KeyName: "kek",
+					AuthMethod: uri.VaultAuthKubernetes, AuthMount: "k8s", Role: "constellation", JWTPath: jwtPath,
+				}
+			},
+			wantLogins: 1,
+		},
+		"approle token revoked": {
+			cfg: func(address string) uri.VaultConfig {
+				return uri.VaultConfig{
+					Address: address, KeyName: "kek", AuthMethod: uri.VaultAuthAppRole,
+					RoleID: "role-id", SecretID: "secret-id",
+				}
+			},
+			revoke:     true,
+			wantLogins: 2,
+		},
+		"static token revoked": {
+			cfg: func(address string) uri.VaultConfig {
+				return uri.VaultConfig{Address: address, KeyName: "kek", AuthMethod: uri.VaultAuthToken, Token: "root"}
+			},
+			revoke:        true,
+			wantSecondErr: true,
+		},
+		"invalid secret ID": {
+			cfg: func(address string) uri.VaultConfig {
+				return uri.VaultConfig{
+					Address: address, KeyName: "kek", AuthMethod: uri.VaultAuthAppRole,
+					RoleID: "role-id", SecretID: "wrong",
+				}
+			},
+			wantErr: true,
+		},
+		"unknown key": {
+			cfg: func(address string) uri.VaultConfig {
+				return uri.VaultConfig{Address: address, KeyName: "other", AuthMethod: uri.VaultAuthToken, Token: "root"}
+			},
+			wantErr: true,
+		},
+	}
+
+	for name, tc := range testCases {
+		t.Run(name, func(t *testing.T) {
+			assert := assert.New(t)
+			require := require.New(t)
+
+			vault := newFakeVault()
+			server := httptest.NewServer(vault)
+			defer server.Close()
+
+			client, err := New(t.Context(), memfs.New(), tc.cfg(server.URL))
+			require.NoError(err)
+			defer client.Close()
+
+			dek, err := client.GetDEK(t.Context(), "volume-01", 32)
+			if tc.wantErr {
+				assert.Error(err)
+				return
+			}
+			require.NoError(err)
+			assert.Len(dek, 32)
+
+			if tc.revoke {
+				vault.revokeTokens()
+			}
+
+			// The second request decrypts the DEK stored by the first one.
+			dek2, err := client.GetDEK(t.Context(), "volume-01", 32)
+			if tc.wantSecondErr {
+				assert.Error(err)
+				return
+			}
+			require.NoError(err)
+			assert.Equal(dek, dek2)
+			assert.Equal(tc.wantLogins, vault.loginCount())
+		})
+	}
+}
+
+func TestNewErrors(t *testing.T) {
+	testCases := map[string]uri.VaultConfig{
+		"invalid address":     {Address: "vault:8200", KeyName: "kek", AuthMethod: uri.VaultAuthToken, Token: "t"},
+		"missing key name":    {Address: "https://vault:8200", AuthMethod: uri.VaultAuthToken, Token: "t"},
+		"missing token":       {Address: "https://vault:8200", KeyName: "kek", AuthMethod: uri.VaultAuthToken},
+		"missing secret ID":   {Address: "https://vault:8200", KeyName: "kek", AuthMethod: uri.VaultAuthAppRole, RoleID: "r"},
+		"missing role":        {Address: "https://vault:8200", KeyName: "kek", AuthMethod: uri.VaultAuthKubernetes},
+		"unknown auth method": {Address: "https://vault:8200", KeyName: "kek", AuthMethod: "ldap"},
+		"missing CA file":     {Address: "https://vault:8200", KeyName: "kek", AuthMethod: uri.VaultAuthToken, Token: "t", CACertPath: "/does/not/exist"},
+	}
+
+	for name, cfg := range testCases {
+		t.Run(name, func(t *testing.T) {
+			_, err := New(t.Context(), memfs.New(), cfg)
+			assert.Error(t, err)
+		})
+	}
+
+	_, err := New(t.Context(), nil, uri.VaultConfig{Address: "https://vault:8200", KeyName: "kek", AuthMethod: uri.VaultAuthToken, Token: "t"})
+	assert.Error(t, err)
+}
+
+// fakeVault implements the parts of the Vault HTTP API used by the client.
+// The transit engine "encrypts" by prefixing the base64 plaintext with the key version.
+type fakeVault struct {
+	mux    sync.Mutex
+	tokens map[string]bool
+	logins int
+}
+
+func newFakeVault() *fakeVault {
+	return &fakeVault{tokens: map[string]bool{"root": true}}
+}
+
+func (v *fakeVault) revokeTokens() {
+	v.mux.Lock()
+	defer v.mux.Unlock()
+	v.tokens = map[string]bool{}
+}
+
+func (v *fakeVault) loginCount() int {
+	v.mux.Lock()
+	defer v.mux.Unlock()
+	return v.logins
+}
+
+func (v *fakeVault) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	v.mux.Lock()
+	defer v.mux.Unlock()
+
+	var body map[string]string
+	if r.Method != http.MethodPost || json.NewDecoder(r.Body).Decode(&body) != nil {
+		writeErrors(w, http.StatusBadRequest, "invalid request")
+		return
+	}
+
+	switch r.URL.Path {
+	case "/v1/auth/approle/login":
+		if body["role_id"] != "role-id" || body["secret_id"] != "secret-id" {
+			writeErrors(w, http.StatusBadRequest, "invalid role or secret ID")
+			return
+		}
+		v.login(w)
+		return
+	case "/v1/auth/k8s/login":
+		if r.Header.Get("X-Vault-Namespace") != "team" || body["role"] != "constellation" || body["jwt"] != "service-account-jwt" {
+			writeErrors(w, http.StatusForbidden, "permission denied")
+			return
+		}
+		v.login(w)
+		return
+	}
+
+	if !v.tokens[r.Header.Get("X-Vault-Token")] {
+		writeErrors(w, http.StatusForbidden, "permission denied")
+		return
+	}
+
+	switch r.URL.Path {
+	case "/v1/transit/encrypt/kek", "/v1/keys/encrypt/kek":
+		writeData(w, map[string]string{"ciphertext": "vault:v1:" + body["plaintext"]})
+	case "/v1/transit/decrypt/kek", "/v1/keys/decrypt/kek":
+		plaintext, ok := strings.CutPrefix(body["ciphertext"], "vault:v1:")
+		if _, err := base64.StdEncoding.DecodeString(plaintext); !ok || err != nil {
+			writeErrors(w, http.StatusBadRequest, "invalid ciphertext")
+			return
+		}
+		writeData(w, map[string]string{"plaintext": plaintext})
+	default:
+		writeErrors(w, http.StatusBadRequest, "encryption key not found")
+	}
+}
+
+func (v *fakeVault) login(w http.ResponseWriter) {
+	v.logins++
+	token := "token-" + strings.Repeat("x", v.logins)
+	v.tokens[token] = true
+	w.Header().Set("Content-Type", "application/json")
+	_ = json.NewEncoder(w).Encode(map[string]any{
+		"auth": map[string]any{"client_token": token, "lease_duration": 3600, "renewable": true},
+	})
+}
+
+func writeData(w http.ResponseWriter, data map[string]string) {
+	w.Header().Set("Content-Type", "application/json")
+	_ = json.NewEncoder(w).Encode(map[string]any{"data": data})
+}
+
+func writeErrors(w http.ResponseWriter, statusCode int, errors ...string) {
+	var buf bytes.Buffer
+	_ = json.NewEncoder(&buf).Encode(map[string]any{"errors": errors})
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(statusCode)
+	_, _ = w.Write(buf.Bytes())
+}
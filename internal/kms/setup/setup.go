@@ -25,9 +25,13 @@ import (
 	"github.com/edgelesssys/constellation/v2/internal/kms/kms/azure"
 	"github.com/edgelesssys/constellation/v2/internal/kms/kms/cluster"
 	"github.com/edgelesssys/constellation/v2/internal/kms/kms/gcp"
+	"github.com/edgelesssys/constellation/v2/internal/kms/kms/kmip"
+	"github.com/edgelesssys/constellation/v2/internal/kms/kms/vault"
 	"github.com/edgelesssys/constellation/v2/internal/kms/storage/awss3"
 	"github.com/edgelesssys/constellation/v2/internal/kms/storage/azureblob"
 	"github.com/edgelesssys/constellation/v2/internal/kms/storage/gcs"
+	"github.com/edgelesssys/constellation/v2/internal/kms/storage/k8ssecret"
+	"github.com/edgelesssys/constellation/v2/internal/kms/storage/localfs"
 	"github.com/edgelesssys/constellation/v2/internal/kms/uri"
 )
 
@@ -80,6 +84,20 @@ func getStore(ctx context.Context, storageURI string) (kms.Storage, error) {
 		}
 		return gcs.New(ctx, cfg)
 
+	case "file":
+		cfg, err := uri.DecodeFileStorageConfigFromURI(storageURI)
+		if err != nil {
+			return nil, err
+		}
+		return localfs.New(ctx, cfg)
+
+	case "k8s-secret":
+		cfg, err := uri.DecodeK8sSecretConfigFromURI(storageURI)
+		if err != nil {
+			return nil, err
+		}
+		return k8ssecret.New(ctx, cfg)
+
 	case "no-store":
 		return nil, nil
 
@@ -120,12 +138,26 @@ func getKMS(ctx context.Context, kmsURI string, store kms.Storage) (kms.CloudKMS
 		}
 		return gcp.New(ctx, store, cfg)
 
+	case "vault":
+		cfg, err := uri.DecodeVaultConfigFromURI(kmsURI)
+		if err != nil {
+			return nil, fmt.Errorf("invalid Vault KMS URI: %w", err)
+		}
+		return vault.New(ctx, store, cfg)
+
+	case "kmip":
+		cfg, err := uri.DecodeKMIPConfigFromURI(kmsURI)
+		if err != nil {
+			return nil, fmt.Errorf("invalid KMIP KMS URI: %w", err)
+		}
+		return kmip.New(ctx, store, cfg)
+
 	case "cluster-kms":
 		cfg, err := uri.DecodeMasterSecretFromURI(kmsURI)
 		if err != nil {
 			return nil, err
 		}
-		return cluster.New(cfg.Key, cfg.Salt)
+		return cluster.NewFromMasterSecret(cfg)
 
 	default:
 		return nil, fmt.Errorf("unknown KMS type: %s", url.Host)
@@ -33,4 +33,8 @@ func TestSetUpKMS(t *testing.T) {
 	kms, err = KMS(t.Context(), "storage://no-store", masterSecret.EncodeToURI())
 	assert.NoError(err)
 	assert.NotNil(kms)
+
+	store, err := getStore(t.Context(), uri.FileStorageConfig{Path: t.TempDir()}.EncodeToURI())
+	assert.NoError(err)
+	assert.NotNil(store)
 }
@@ -0,0 +1,151 @@
+/*
+Copyright (c) Edgeless Systems GmbH
+
+SPDX-License-Identifier: BUSL-1.1
+*/
+
+/*
+Package k8ssecret implements a storage backend for the KMS that stores keys in Kubernetes Secrets.
+
+Each DEK is stored in its own Secret. Secret names are derived from a hash of the key ID,
+since key IDs may contain characters that are not allowed in object names.
+The key ID is kept in an annotation of the Secret.
+*/
+package k8ssecret
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"strings"
+
+	"github.com/edgelesssys/constellation/v2/internal/kms/storage"
+	"github.com/edgelesssys/constellation/v2/internal/kms/uri"
+	corev1 "k8s.io/api/core/v1"
+	k8serrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/util/validation"
+	"k8s.io/client-go/kubernetes"
+	"k8s.io/client-go/tools/clientcmd"
+	"k8s.io/client-go/util/retry"
+)
+
+const (
+	// defaultNamePrefix is prepended to Secret names if no prefix is configured.
+	defaultNamePrefix = "dek-"
+	// dataKey is the key of the encrypted DEK in the Secret's data.
+	dataKey = "dek"
+	// keyIDAnnotation holds the key ID of the DEK stored in a Secret.
+	keyIDAnnotation = "constellation.edgeless.systems/key-id"
+	// managedByLabel marks Secrets created by the storage backend.
+	managedByLabel = "app.kubernetes.io/managed-by"
+	managedByValue = "constellation-kms"
+)
+
+// Storage is an implementation of the Storage interface, storing keys in Kubernetes Secrets.
+type Storage struct {
+	client     kubernetes.Interface
+	namespace  string
+	namePrefix string
+}
+
+// New creates a Storage client for Kubernetes Secrets using the provided config.
+// If no kubeconfig is configured, the in-cluster configuration is used.
+func New(_ context.Context, cfg uri.K8sSecretConfig) (*Storage, error) {
+	restConfig, err := clientcmd.BuildConfigFromFlags("", cfg.KubeconfigPath)
+	if err != nil {
+		return nil, fmt.Errorf("loading Kubernetes client config: %w", err)
+	}
+	client, err := kubernetes.NewForConfig(restConfig)
+	if err != nil {
+		return nil, fmt.Errorf("creating Kubernetes client: %w", err)
+	}
+	return newStorage(client, cfg)
+}
+
+func newStorage(client kubernetes.Interface, cfg uri.K8sSecretConfig) (*Storage, error) {
+	if errs := validation.IsDNS1123Label(cfg.Namespace); len(errs) > 0 {
+		return nil, fmt.Errorf("invalid namespace %q: %s", cfg.Namespace, strings.Join(errs, ", "))
+	}
+	namePrefix := cfg.NamePrefix
+	if namePrefix == "" {
+		namePrefix = defaultNamePrefix
+	}
+	s := &Storage{
+		client:     client,
+		namespace:  cfg.Namespace,
+		namePrefix: namePrefix,
+	}
+	if errs := validation.IsDNS1123Subdomain(s.secretName("")); len(errs) > 0 {
+		return nil, fmt.Errorf("invalid Secret name prefix %q: %s", cfg.NamePrefix, strings.Join(errs, ", "))
+	}
+	return s, nil
+}
+
+// Get returns a DEK from Kubernetes Secrets by key ID.
+func (s *Storage) Get(ctx context.Context, keyID string) ([]byte, error) {
+	secret, err := s.client.CoreV1().Secrets(s.namespace).Get(ctx, s.secretName(keyID), metav1.GetOptions{})
+	if k8serrors.IsNotFound(err) {
+		return nil, storage.ErrDEKUnset
+	}
+	if err != nil {
+		return nil, fmt.Errorf("getting Secret: %w", err)
+	}
+	if secret.Annotations[keyIDAnnotation] != keyID {
+		return nil, fmt.Errorf("secret %s holds key %q, expected %q", secret.Name, secret.Annotations[keyIDAnnotation], keyID)
+	}
+	encDEK, ok := secret.Data[dataKey]
+	if !ok {
+		return nil, fmt.Errorf("secret %s contains no DEK", secret.Name)
+	}
+	return encDEK, nil
+}
+
+// Put saves a DEK to a Kubernetes Secret by key ID.
+// An existing DEK with the same key ID is replaced.
+func (s *Storage) Put(ctx context.Context, keyID string, encDEK []byte) error {
+	secrets := s.client.CoreV1().Secrets(s.namespace)
+	secret := &corev1.Secret{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:        s.secretName(keyID),
+			Namespace:   s.namespace,
+			Labels:      map[string]string{managedByLabel: managedByValue},
+			Annotations: map[string]string{keyIDAnnotation: keyID},
+		},
+		Type: corev1.SecretTypeOpaque,
+		Data: map[string][]byte{dataKey: encDEK},
+	}
+
+	_, err := secrets.Create(ctx, secret, metav1.CreateOptions{})
+	if !k8serrors.IsAlreadyExists(err) {
+		if err != nil {
+			return fmt.Errorf("creating Secret: %w", err)
+		}
+		return nil
+	}
+
+	err = retry.RetryOnConflict(retry.DefaultRetry, func() error {
+		existing, err := secrets.Get(ctx, secret.Name, metav1.GetOptions{})
+		if err != nil {
+			return err
+		}
+		if existing.Annotations == nil {
+			existing.Annotations = map[string]string{}
+		}
+		existing.Annotations[keyIDAnnotation] = keyID
+		existing.Data = secret.Data
+		_, err = secrets.Update(ctx, existing, metav1.UpdateOptions{})
+		return err
+	})
+	if err != nil {
+		return fmt.Errorf("updating Secret: %w", err)
+	}
+	return nil
+}
+
+// secretName returns the name of the Secret holding the DEK with the given key ID.
+func (s *Storage) secretName(keyID string) string {
+	hash := sha256.Sum256([]byte(keyID))
+	return s.namePrefix + hex.EncodeToString(hash[:])
+}
@@ -0,0 +1,154 @@
+/*
+Copyright (c) Edgeless Systems GmbH
+
+SPDX-License-Identifier: BUSL-1.1
+*/
+
+package k8ssecret
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/edgelesssys/constellation/v2/internal/kms/storage"
+	"github.com/edgelesssys/constellation/v2/internal/kms/uri"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.uber.org/goleak"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/client-go/kubernetes/fake"
+	k8stesting "k8s.io/client-go/testing"
+)
+
+func TestMain(m *testing.M) {
+	goleak.VerifyTestMain(m,
+		goleak.IgnoreAnyFunction("github.com/bazelbuild/rules_go/go/tools/bzltestutil.RegisterTimeoutHandler.func1"),
+	)
+}
+
+func TestStorage(t *testing.T) {
+	assert := assert.New(t)
+	require := require.New(t)
+
+	client := fake.NewClientset()
+	store, err := newStorage(client, uri.K8sSecretConfig{Namespace: "kube-system"})
+	require.NoError(err)
+	ctx := t.Context()
+
+	testDEK1 := []byte("test DEK")
+	testDEK2 := []byte("more test DEK")
+
+	_, err = store.Get(ctx, "test:input")
+	assert.ErrorIs(err, storage.ErrDEKUnset)
+
+	assert.NoError(store.Put(ctx, "volume01", testDEK1))
+	assert.NoError(store.Put(ctx, "pvc-0a1b/Volume_02", testDEK2))
+
+	val, err := store.Get(ctx, "volume01")
+	assert.NoError(err)
+	assert.Equal(testDEK1, val)
+	val, err = store.Get(ctx, "pvc-0a1b/Volume_02")
+	assert.NoError(err)
+	assert.Equal(testDEK2, val)
+
+	// Put replaces existing keys.
+	assert.NoError(store.Put(ctx, "volume01", testDEK2))
+	val, err = store.Get(ctx, "volume01")
+	assert.NoError(err)
+	assert.Equal(testDEK2, val)
+
+	secrets, err := client.CoreV1().Secrets("kube-system").List(ctx, metav1.ListOptions{})
+	require.NoError(err)
+	assert.Len(secrets.Items, 2)
+	for _, secret := range secrets.Items {
+		assert.Equal(managedByValue, secret.Labels[managedByLabel])
+		assert.Contains([]string{"volume01", "pvc-0a1b/Volume_02"}, secret.Annotations[keyIDAnnotation])
+	}
+}
+
+func TestGetErrors(t *testing.T) {
+	store, err := newStorage(fake.NewClientset(), uri.K8sSecretConfig{Namespace: "kube-system", NamePrefix: "constellation-"})
+	require.NoError(t, err)
+
+	testCases := map[string]struct {
+		secret  *corev1.Secret
+		wantErr error
+	}{
+		"key ID mismatch": {
+			secret: &corev1.Secret{
+				ObjectMeta: metav1.ObjectMeta{
+					Name:        store.secretName("volume01"),
+					Namespace:   "kube-system",
+					Annotations: map[string]string{keyIDAnnotation: "other"},
+				},
+				Data: map[string][]byte{dataKey: []byte("dek")},
+			},
+		},
+		"no DEK in Secret": {
+			secret: &corev1.Secret{
+				ObjectMeta: metav1.ObjectMeta{
+					Name:        store.secretName("volume01"),
+					Namespace:   "kube-system",
+					Annotations: map[string]string{keyIDAnnotation: "volume01"},
+				},
+			},
+		},
+	}
+
+	for name, tc := range testCases {
+		t.Run(name, func(t *testing.T) {
+			store.client = fake.NewClientset(tc.secret)
+			_, err := store.Get(t.Context(), "volume01")
+			assert.Error(t, err)
+			assert.NotErrorIs(t, err, storage.ErrDEKUnset)
+		})
+	}
+
+	client := fake.NewClientset()
+	client.PrependReactor("get", "secrets", func(k8stesting.Action) (bool, runtime.Object, error) {
+		return true, nil, errors.New("forbidden")
+	})
+	store.client = client
+	_, err = store.Get(t.Context(), "volume01")
+	assert.Error(t, err)
+	assert.NotErrorIs(t, err, storage.ErrDEKUnset)
+}
+
+func TestNewStorage(t *testing.T) {
+	testCases := map[string]struct {
+		cfg     uri.K8sSecretConfig
+		wantErr bool
+	}{
+		"default prefix": {
+			cfg: uri.K8sSecretConfig{Namespace: "kube-system"},
+		},
+		"custom prefix": {
+			cfg: uri.K8sSecretConfig{Namespace: "kube-system", NamePrefix: "constellation-dek."},
+		},
+		"invalid namespace": {
+			cfg:     uri.K8sSecretConfig{Namespace: "Kube_System"},
+			wantErr: true,
+		},
+		"missing namespace": {
+			cfg:     uri.K8sSecretConfig{},
+			wantErr: true,
+		},
+		"invalid prefix": {
+			cfg:     uri.K8sSecretConfig{Namespace: "kube-system", NamePrefix: "DEK/"},
+			wantErr: true,
+		},
+	}
+
+	for name, tc := range testCases {
+		t.Run(name, func(t *testing.T) {
+			_, err := newStorage(fake.NewClientset(), tc.cfg)
+			if tc.wantErr {
+				assert.Error(t, err)
+				return
+			}
+			assert.NoError(t, err)
+		})
+	}
+}
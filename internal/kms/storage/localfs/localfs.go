@@ -0,0 +1,140 @@
+/*
+Copyright (c) Edgeless Systems GmbH
+
+SPDX-License-Identifier: BUSL-1.1
+*/
+
+/*
+Package localfs implements a storage backend for the KMS that stores keys as files in a local directory.
+
+Each DEK is stored in its own file, named after the SHA-256 hash of its key ID, so that key IDs of any length
+and with any characters can be stored. The key ID is stored in the file next to the DEK.
+Files are written atomically, so a crash while storing a DEK never leaves a partially written key behind.
+*/
+package localfs
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+
+	"github.com/edgelesssys/constellation/v2/internal/kms/storage"
+	"github.com/edgelesssys/constellation/v2/internal/kms/uri"
+)
+
+// tempFilePrefix is the prefix of files that are being written.
+// Hashed key IDs never start with a dot, so temporary files don't collide with stored keys.
+const tempFilePrefix = ".tmp-"
+
+// keyFile is the content of the file a DEK is stored in.
+type keyFile struct {
+	// KeyID is the key ID the DEK is stored under. The file name only holds its hash.
+	KeyID string `json:"keyID"`
+	// EncDEK is the encrypted DEK.
+	EncDEK []byte `json:"encDEK"`
+}
+
+// Storage is an implementation of the Storage interface, storing keys in a local directory.
+type Storage struct {
+	dir string
+}
+
+// New creates a Storage that keeps keys in the directory given by the config.
+// The directory is created if it doesn't exist.
+func New(_ context.Context, cfg uri.FileStorageConfig) (*Storage, error) {
+	if cfg.Path == "" {
+		return nil, errors.New("no storage directory provided")
+	}
+	if err := os.MkdirAll(cfg.Path, 0o700); err != nil {
+		return nil, fmt.Errorf("creating storage directory: %w", err)
+	}
+	return &Storage{dir: cfg.Path}, nil
+}
+
+// Get returns a DEK from the storage directory by key ID.
+func (s *Storage) Get(_ context.Context, keyID string) ([]byte, error) {
+	path, err := s.path(keyID)
+	if err != nil {
+		return nil, err
+	}
+	data, err := os.ReadFile(path)
+	if errors.Is(err, fs.ErrNotExist) {
+		return nil, storage.ErrDEKUnset
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	var file keyFile
+	if err := json.Unmarshal(data, &file); err != nil {
+		return nil, fmt.Errorf("decoding key file: %w", err)
+	}
+	if file.KeyID != keyID {
+		return nil, fmt.Errorf("key file %s holds key ID %q, expected %q", filepath.Base(path), file.KeyID, keyID)
+	}
+	return file.EncDEK, nil
+}
+
+// Put saves a DEK to the storage directory by key ID.
+// An existing DEK with the same key ID is replaced.
+func (s *Storage) Put(_ context.Context, keyID string, encDEK []byte) error {
+	path, err := s.path(keyID)
+	if err != nil {
+		return err
+	}
+	data, err := json.Marshal(keyFile{KeyID: keyID, EncDEK: encDEK})
+	if err != nil {
+		return fmt.Errorf("encoding key file: %w", err)
+	}
+
+	tmp, err := os.CreateTemp(s.dir, tempFilePrefix)
+	if err != nil {
+		return fmt.Errorf("creating temporary file: %w", err)
+	}
+	defer os.Remove(tmp.Name())
+	if _, err := tmp.Write(data); err != nil {
+		tmp.Close()
+		return fmt.Errorf("writing DEK: %w", err)
+	}
+	if err := tmp.Sync(); err != nil {
+		tmp.Close()
+		return fmt.Errorf("syncing DEK: %w", err)
+	}
+	if err := tmp.Close(); err != nil {
+		return fmt.Errorf("closing temporary file: %w", err)
+	}
+	if err := os.Rename(tmp.Name(), path); err != nil {
+		return fmt.Errorf("storing DEK: %w", err)
+	}
+	return syncDir(s.dir)
+}
+
+// path returns the file name for a key ID.
+// Key IDs are hashed, since they may contain characters that are not allowed in file names, such as slashes,
+// and may be longer than the maximum length of a file name.
+func (s *Storage) path(keyID string) (string, error) {
+	if keyID == "" {
+		return "", errors.New("empty key ID")
+	}
+	hash := sha256.Sum256([]byte(keyID))
+	return filepath.Join(s.dir, hex.EncodeToString(hash[:])), nil
+}
+
+// syncDir persists the directory entry of a renamed file.
+func syncDir(dir string) error {
+	d, err := os.Open(dir)
+	if err != nil {
+		return fmt.Errorf("opening storage directory: %w", err)
+	}
+	defer d.Close()
+	if err := d.Sync(); err != nil {
+		return fmt.Errorf("syncing storage directory: %w", err)
+	}
+	return nil
+}
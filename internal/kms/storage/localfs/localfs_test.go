@@ -0,0 +1,156 @@
+/*
+Copyright (c) Edgeless Systems GmbH
+
+SPDX-License-Identifier: BUSL-1.1
+*/
+
+package localfs
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/edgelesssys/constellation/v2/internal/kms/storage"
+	"github.com/edgelesssys/constellation/v2/internal/kms/uri"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.uber.org/goleak"
+)
+
+func TestMain(m *testing.M) {
+	goleak.VerifyTestMain(m,
+		goleak.IgnoreAnyFunction("github.com/bazelbuild/rules_go/go/tools/bzltestutil.RegisterTimeoutHandler.func1"),
+	)
+}
+
+func TestStorage(t *testing.T) {
+	assert := assert.New(t)
+	require := require.New(t)
+
+	dir := filepath.Join(t.TempDir(), "keys")
+	store, err := New(t.Context(), uri.FileStorageConfig{Path: dir})
+	require.NoError(err)
+	ctx := t.Context()
+
+	testDEK1 := []byte("test DEK")
+	testDEK2 := []byte("more test DEK")
+
+	_, err = store.Get(ctx, "test:input")
+	assert.ErrorIs(err, storage.ErrDEKUnset)
+
+	assert.NoError(store.Put(ctx, "volume01", testDEK1))
+	assert.NoError(store.Put(ctx, "../volume02", testDEK2))
+
+	val, err := store.Get(ctx, "volume01")
+	assert.NoError(err)
+	assert.Equal(testDEK1, val)
+	val, err = store.Get(ctx, "../volume02")
+	assert.NoError(err)
+	assert.Equal(testDEK2, val)
+
+	// Put replaces existing keys.
+	assert.NoError(store.Put(ctx, "volume01", testDEK2))
+	val, err = store.Get(ctx, "volume01")
+	assert.NoError(err)
+	assert.Equal(testDEK2, val)
+
+	// Keys are stored inside the directory, without leftover temporary files.
+	entries, err := os.ReadDir(dir)
+	require.NoError(err)
+	assert.Len(entries, 2)
+	for _, entry := range entries {
+		info, err := entry.Info()
+		require.NoError(err)
+		assert.Equal(os.FileMode(0o600), info.Mode().Perm())
+	}
+
+	// A new Storage on the same directory sees the stored keys.
+	store, err = New(t.Context(), uri.FileStorageConfig{Path: dir})
+	require.NoError(err)
+	val, err = store.Get(ctx, "../volume02")
+	assert.NoError(err)
+	assert.Equal(testDEK2, val)
+
+	_, err = store.Get(ctx, "")
+	assert.Error(err)
+	assert.NotErrorIs(err, storage.ErrDEKUnset)
+}
+
+func TestStorageLongKeyID(t *testing.T) {
+	assert := assert.New(t)
+	require := require.New(t)
+
+	store, err := New(t.Context(), uri.FileStorageConfig{Path: t.TempDir()})
+	require.NoError(err)
+	ctx := t.Context()
+
+	// The key ID is longer than the maximum length of a file name.
+	keyID := strings.Repeat("volume/", 100)
+	require.NoError(store.Put(ctx, keyID, []byte("test DEK")))
+	val, err := store.Get(ctx, keyID)
+	assert.NoError(err)
+	assert.Equal([]byte("test DEK"), val)
+
+	_, err = store.Get(ctx, keyID+"other")
+	assert.ErrorIs(err, storage.ErrDEKUnset)
+}
+
+func TestStorageKeyIDMismatch(t *testing.T) {
+	assert := assert.New(t)
+	require := require.New(t)
+
+	store, err := New(t.Context(), uri.FileStorageConfig{Path: t.TempDir()})
+	require.NoError(err)
+	ctx := t.Context()
+	require.NoError(store.Put(ctx, "volume01", []byte("test DEK")))
+
+	// A file holding the DEK of another key ID is never returned.
+	path01, err := store.path("volume01")
+	require.NoError(err)
+	path02, err := store.path("volume02")
+	require.NoError(err)
+	require.NoError(os.Rename(path01, path02))
+
+	_, err = store.Get(ctx, "volume02")
+	assert.Error(err)
+	assert.NotErrorIs(err, storage.ErrDEKUnset)
+}
+
+func TestNew(t *testing.T) {
+	testCases := map[string]struct {
+		path    func(t *testing.T) string
+		wantErr bool
+	}{
+		"existing directory": {
+			path: func(t *testing.T) string { return t.TempDir() },
+		},
+		"nested directory": {
+			path: func(t *testing.T) string { return filepath.Join(t.TempDir(), "a", "b") },
+		},
+		"empty path": {
+			path:    func(*testing.T) string { return "" },
+			wantErr: true,
+		},
+		"path is a file": {
+			path: func(t *testing.T) string {
+				path := filepath.Join(t.TempDir(), "file")
+				require.NoError(t, os.WriteFile(path, nil, 0o600))
+				return path
+			},
+			wantErr: true,
+		},
+	}
+
+	for name, tc := range testCases {
+		t.Run(name, func(t *testing.T) {
+			_, err := New(t.Context(), uri.FileStorageConfig{Path: tc.path(t)})
+			if tc.wantErr {
+				assert.Error(t, err)
+				return
+			}
+			assert.NoError(t, err)
+		})
+	}
+}
@@ -51,6 +51,17 @@ var (
 	gcpProjectID       = flag.String("gcp-project", "", "Project ID to use for Google tests. Required for Google KMS and Google storage test.")
 	gcpKeyRing         = flag.String("gcp-keyring", "", "Key ring to use for Google KMS test. Required for Google KMS test.")
 	gcpLocation        = flag.String("gcp-location", "global", "Location of the keyring. Required for Google KMS test.")
+
+	runVaultKms  = flag.Bool("vault-kms", false, "set to run Vault transit KMS test")
+	vaultAddress = flag.String("vault-address", "http://127.0.0.1:8200", "Address of the Vault server, e.g. a dev server started with 'vault server -dev'. Required for Vault KMS test.")
+	vaultToken   = flag.String("vault-token", "", "Token to authenticate with Vault. Required for Vault KMS test.")
+	vaultMount   = flag.String("vault-transit-mount", "transit", "Path the transit secrets engine is mounted at. Optional for Vault KMS test.")
+
+	runKMIPKms     = flag.Bool("kmip-kms", false, "set to run KMIP KMS test")
+	kmipAddress    = flag.String("kmip-address", "127.0.0.1:5696", "Host and port of the KMIP server. Required for KMIP KMS test.")
+	kmipClientCert = flag.String("kmip-client-cert", "", "Path to the PEM encoded client certificate. Required for KMIP KMS test.")
+	kmipClientKey  = flag.String("kmip-client-key", "", "Path to the PEM encoded client key. Required for KMIP KMS test.")
+	kmipCACert     = flag.String("kmip-ca-cert", "", "Path to the CA certificate of the KMIP server. Optional for KMIP KMS test.")
 )
 
 func TestMain(m *testing.M) {
@@ -0,0 +1,51 @@
+//go:build integration
+
+/*
+Copyright (c) Edgeless Systems GmbH
+
+SPDX-License-Identifier: BUSL-1.1
+*/
+
+package test
+
+import (
+	"context"
+	"flag"
+	"testing"
+	"time"
+
+	"github.com/edgelesssys/constellation/v2/internal/kms/kms/kmip"
+	"github.com/edgelesssys/constellation/v2/internal/kms/storage/memfs"
+	"github.com/edgelesssys/constellation/v2/internal/kms/uri"
+	"github.com/stretchr/testify/require"
+)
+
+// TestKMIPKMS runs against a KMIP server that supports authenticated encryption (KMIP 1.4 or later)
+// and holds a 256 bit AES key whose Name attribute is set to the value of --kek-id.
+func TestKMIPKMS(t *testing.T) {
+	if !*runKMIPKms {
+		t.Skip("Skipping KMIP KMS test")
+	}
+	if *kmipAddress == "" || *kmipClientCert == "" || *kmipClientKey == "" || *kekID == "" {
+		flag.Usage()
+		t.Fatal("Required flags not set: --kmip-address, --kmip-client-cert, --kmip-client-key, --kek-id")
+	}
+	require := require.New(t)
+
+	store := memfs.New()
+	ctx, cancel := context.WithTimeout(t.Context(), time.Second*30)
+	defer cancel()
+
+	cfg := uri.KMIPConfig{
+		Address:        *kmipAddress,
+		KeyName:        *kekID,
+		ClientCertPath: *kmipClientCert,
+		ClientKeyPath:  *kmipClientKey,
+		CACertPath:     *kmipCACert,
+	}
+	kmsClient, err := kmip.New(ctx, store, cfg)
+	require.NoError(err)
+	defer kmsClient.Close()
+
+	runKMSTest(t, kmsClient)
+}
@@ -0,0 +1,54 @@
+//go:build integration
+
+/*
+Copyright (c) Edgeless Systems GmbH
+
+SPDX-License-Identifier: BUSL-1.1
+*/
+
+package test
+
+import (
+	"context"
+	"flag"
+	"testing"
+	"time"
+
+	"github.com/edgelesssys/constellation/v2/internal/kms/kms/vault"
+	"github.com/edgelesssys/constellation/v2/internal/kms/storage/memfs"
+	"github.com/edgelesssys/constellation/v2/internal/kms/uri"
+	"github.com/stretchr/testify/require"
+)
+
+// TestVaultKMS runs against a Vault or OpenBao server with an enabled transit secrets engine, for example:
+//
+//	vault server -dev -dev-root-token-id=root
+//	vault secrets enable transit
+//	vault write -f transit/keys/constellation
+func TestVaultKMS(t *testing.T) {
+	if !*runVaultKms {
+		t.Skip("Skipping Vault KMS test")
+	}
+	if *vaultAddress == "" || *vaultToken == "" || *kekID == "" {
+		flag.Usage()
+		t.Fatal("Required flags not set: --vault-address, --vault-token, --kek-id")
+	}
+	require := require.New(t)
+
+	store := memfs.New()
+	ctx, cancel := context.WithTimeout(t.Context(), time.Second*30)
+	defer cancel()
+
+	cfg := uri.VaultConfig{
+		Address:      *vaultAddress,
+		TransitMount: *vaultMount,
+		KeyName:      *kekID,
+		AuthMethod:   uri.VaultAuthToken,
+		Token:        *vaultToken,
+	}
+	kmsClient, err := vault.New(ctx, store, cfg)
+	require.NoError(err)
+	defer kmsClient.Close()
+
+	runKMSTest(t, kmsClient)
+}
@@ -47,10 +47,14 @@ const (
 	awsKMSURI     = "kms://aws?region=%s&accessKeyID=%s&accessKey=%s&keyName=%s"
 	azureKMSURI   = "kms://azure?tenantID=%s&clientID=%s&clientSecret=%s&vaultName=%s&vaultType=%s&keyName=%s"
 	gcpKMSURI     = "kms://gcp?projectID=%s&location=%s&keyRing=%s&credentialsPath=%s&keyName=%s"
+	vaultKMSURI   = "kms://vault?%s"
+	kmipKMSURI    = "kms://kmip?%s"
 	clusterKMSURI = "kms://cluster-kms?key=%s&salt=%s"
 	awsS3URI      = "storage://aws?bucket=%s&region=%s&accessKeyID=%s&accessKey=%s"
 	azureBlobURI  = "storage://azure?account=%s&container=%s&tenantID=%s&clientID=%s&clientSecret=%s"
 	gcpStorageURI = "storage://gcp?projectID=%s&bucket=%s&credentialsPath=%s"
+	localFileURI  = "storage://file?path=%s"
+	k8sSecretURI  = "storage://k8s-secret?%s"
 	// NoStoreURI is a URI that indicates that no storage is used.
 	// Should only be used with cluster KMS.
 	NoStoreURI = "storage://no-store"
@@ -62,15 +66,40 @@ type MasterSecret struct {
 	Key []byte `json:"key"`
 	// Salt is the salt used in HKDF to derive keys.
 	Salt []byte `json:"salt"`
+	// Rotations are the master secrets that replaced Key and Salt, oldest first.
+	// Rotation i is generation i+1 of the master secret. Key and Salt are generation 0.
+	// Keys of older generations are kept, so data encrypted with them can still be decrypted.
+	Rotations []MasterSecretRotation `json:"rotations,omitempty"`
+}
+
+// MasterSecretRotation is a master secret that replaced an older one.
+type MasterSecretRotation struct {
+	// Key is the secret value used in HKDF to derive keys.
+	Key []byte `json:"key"`
+	// Salt is the salt used in HKDF to derive keys.
+	Salt []byte `json:"salt"`
+}
+
+// Generation returns the generation of the latest master secret.
+func (m MasterSecret) Generation() uint32 {
+	return uint32(len(m.Rotations))
 }
 
 // EncodeToURI returns a URI encoding the master secret.
 func (m MasterSecret) EncodeToURI() string {
-	return fmt.Sprintf(
+	uri := fmt.Sprintf(
 		clusterKMSURI,
 		base64.URLEncoding.EncodeToString(m.Key),
 		base64.URLEncoding.EncodeToString(m.Salt),
 	)
+	for i, rotation := range m.Rotations {
+		uri += fmt.Sprintf(
+			"&key-%d=%s&salt-%d=%s",
+			i+1, base64.URLEncoding.EncodeToString(rotation.Key),
+			i+1, base64.URLEncoding.EncodeToString(rotation.Salt),
+		)
+	}
+	return uri
 }
 
 // DecodeMasterSecretFromURI decodes a master secret from a URI.
@@ -96,10 +125,22 @@ func DecodeMasterSecretFromURI(uri string) (MasterSecret, error) {
 	if err != nil {
 		return MasterSecret{}, err
 	}
-	return MasterSecret{
+	secret := MasterSecret{
 		Key:  key,
 		Salt: salt,
-	}, nil
+	}
+	for generation := 1; q.Has(fmt.Sprintf("key-%d", generation)); generation++ {
+		key, err := getBase64QueryParameter(q, fmt.Sprintf("key-%d", generation))
+		if err != nil {
+			return MasterSecret{}, err
+		}
+		salt, err := getBase64QueryParameter(q, fmt.Sprintf("salt-%d", generation))
+		if err != nil {
+			return MasterSecret{}, err
+		}
+		secret.Rotations = append(secret.Rotations, MasterSecretRotation{Key: key, Salt: salt})
+	}
+	return secret, nil
 }
 
 // AWSConfig is the configuration to authenticate with AWS KMS.
@@ -505,6 +546,314 @@ func (g GoogleCloudStorageConfig) EncodeToURI() string {
 	)
 }
 
+// FileStorageConfig is the configuration to store DEKs in a directory of the local filesystem.
+type FileStorageConfig struct {
+	// Path is the directory the DEKs are stored in.
+	Path string
+}
+
+// DecodeFileStorageConfigFromURI decodes a local filesystem storage configuration from a URI.
+func DecodeFileStorageConfigFromURI(uri string) (FileStorageConfig, error) {
+	u, err := url.Parse(uri)
+	if err != nil {
+		return FileStorageConfig{}, err
+	}
+
+	if u.Scheme != "storage" {
+		return FileStorageConfig{}, fmt.Errorf("invalid scheme: %q", u.Scheme)
+	}
+	if u.Host != "file" {
+		return FileStorageConfig{}, fmt.Errorf("invalid host: %q", u.Host)
+	}
+
+	path, err := getQueryParameter(u.Query(), "path")
+	if err != nil {
+		return FileStorageConfig{}, err
+	}
+
+	return FileStorageConfig{
+		Path: path,
+	}, nil
+}
+
+// EncodeToURI returns a URI encoding the local filesystem storage configuration.
+func (f FileStorageConfig) EncodeToURI() string {
+	return fmt.Sprintf(
+		localFileURI,
+		url.QueryEscape(url.QueryEscape(f.Path)),
+	)
+}
+
+// K8sSecretConfig is the configuration to store DEKs in Kubernetes Secrets.
+type K8sSecretConfig struct {
+	// Namespace is the namespace the Secrets are created in.
+	Namespace string
+	// NamePrefix is prepended to the names of the Secrets. Optional.
+	NamePrefix string
+	// KubeconfigPath is the path to a kubeconfig file. Optional.
+	// If not set, the in-cluster configuration is used.
+	KubeconfigPath string
+}
+
+// DecodeK8sSecretConfigFromURI decodes a Kubernetes Secret storage configuration from a URI.
+func DecodeK8sSecretConfigFromURI(uri string) (K8sSecretConfig, error) {
+	u, err := url.Parse(uri)
+	if err != nil {
+		return K8sSecretConfig{}, err
+	}
+
+	if u.Scheme != "storage" {
+		return K8sSecretConfig{}, fmt.Errorf("invalid scheme: %q", u.Scheme)
+	}
+	if u.Host != "k8s-secret" {
+		return K8sSecretConfig{}, fmt.Errorf("invalid host: %q", u.Host)
+	}
+
+	q := u.Query()
+	namespace, err := getQueryParameter(q, "namespace")
+	if err != nil {
+		return K8sSecretConfig{}, err
+	}
+	namePrefix, err := getOptionalQueryParameter(q, "namePrefix")
+	if err != nil {
+		return K8sSecretConfig{}, err
+	}
+	kubeconfigPath, err := getOptionalQueryParameter(q, "kubeconfigPath")
+	if err != nil {
+		return K8sSecretConfig{}, err
+	}
+
+	return K8sSecretConfig{
+		Namespace:      namespace,
+		NamePrefix:     namePrefix,
+		KubeconfigPath: kubeconfigPath,
+	}, nil
+}
+
+// EncodeToURI returns a URI encoding the Kubernetes Secret storage configuration.
+// Only the parameters that are set are included.
+func (k K8sSecretConfig) EncodeToURI() string {
+	params := map[string]string{
+		"namespace":      k.Namespace,
+		"namePrefix":     k.NamePrefix,
+		"kubeconfigPath": k.KubeconfigPath,
+	}
+	return fmt.Sprintf(k8sSecretURI, encodeQueryParameters(params))
+}
+
+// VaultAuthMethod is the method used to authenticate with HashiCorp Vault or OpenBao.
+type VaultAuthMethod string
+
+const (
+	// VaultAuthToken authenticates using a static token.
+	VaultAuthToken VaultAuthMethod = "token"
+	// VaultAuthAppRole authenticates using an AppRole role ID and secret ID.
+	VaultAuthAppRole VaultAuthMethod = "approle"
+	// VaultAuthKubernetes authenticates using the token of a Kubernetes service account.
+	VaultAuthKubernetes VaultAuthMethod = "kubernetes"
+)
+
+// VaultConfig is the configuration to use the transit secrets engine of HashiCorp Vault or OpenBao.
+type VaultConfig struct {
+	// Address is the URL of the Vault server, e.g. https://vault.example.com:8200.
+	Address string
+	// Namespace is the Vault namespace to use. Optional.
+	Namespace string
+	// TransitMount is the path the transit secrets engine is mounted at. Defaults to "transit".
+	TransitMount string
+	// KeyName is the name of the transit key used as KEK.
+	KeyName string
+	// AuthMethod is the method used to authenticate with Vault.
+	AuthMethod VaultAuthMethod
+	// AuthMount is the path the auth method is mounted at. Defaults to the name of the auth method.
+	AuthMount string
+	// Token is the Vault token used for token authentication.
+	Token string
+	// RoleID is the role ID used for AppRole authentication.
+	RoleID string
+	// SecretID is the secret ID used for AppRole authentication.
+	SecretID string
+	// Role is the Vault role used for Kubernetes authentication.
+	Role string
+	// JWTPath is the path to the service account token used for Kubernetes authentication.
+	// Defaults to the token mounted into Kubernetes pods.
+	JWTPath string
+	// CACertPath is the path to a PEM file with CA certificates used to verify the Vault server. Optional.
+	CACertPath string
+}
+
+// DecodeVaultConfigFromURI decodes a Vault configuration from a URI.
+func DecodeVaultConfigFromURI(uri string) (VaultConfig, error) {
+	u, err := url.Parse(uri)
+	if err != nil {
+		return VaultConfig{}, err
+	}
+
+	if u.Scheme != "kms" {
+		return VaultConfig{}, fmt.Errorf("invalid scheme: %q", u.Scheme)
+	}
+	if u.Host != "vault" {
+		return VaultConfig{}, fmt.Errorf("invalid host: %q", u.Host)
+	}
+
+	q := u.Query()
+	address, err := getQueryParameter(q, "address")
+	if err != nil {
+		return VaultConfig{}, err
+	}
+	keyName, err := getQueryParameter(q, "keyName")
+	if err != nil {
+		return VaultConfig{}, err
+	}
+	authMethod, err := getQueryParameter(q, "authMethod")
+	if err != nil {
+		return VaultConfig{}, err
+	}
+
+	cfg := VaultConfig{
+		Address:    address,
+		KeyName:    keyName,
+		AuthMethod: VaultAuthMethod(authMethod),
+	}
+	optional := map[string]*string{
+		"namespace":    &cfg.Namespace,
+		"transitMount": &cfg.TransitMount,
+		"authMount":    &cfg.AuthMount,
+		"jwtPath":      &cfg.JWTPath,
+		"caCertPath":   &cfg.CACertPath,
+	}
+	for key, value := range optional {
+		if *value, err = getOptionalQueryParameter(q, key); err != nil {
+			return VaultConfig{}, err
+		}
+	}
+
+	switch cfg.AuthMethod {
+	case VaultAuthToken:
+		if cfg.Token, err = getQueryParameter(q, "token"); err != nil {
+			return VaultConfig{}, err
+		}
+	case VaultAuthAppRole:
+		if cfg.RoleID, err = getQueryParameter(q, "roleID"); err != nil {
+			return VaultConfig{}, err
+		}
+		if cfg.SecretID, err = getQueryParameter(q, "secretID"); err != nil {
+			return VaultConfig{}, err
+		}
+	case VaultAuthKubernetes:
+		if cfg.Role, err = getQueryParameter(q, "role"); err != nil {
+			return VaultConfig{}, err
+		}
+	default:
+		return VaultConfig{}, fmt.Errorf("unknown Vault auth method: %q", cfg.AuthMethod)
+	}
+
+	return cfg, nil
+}
+
+// EncodeToURI returns a URI encoding the Vault configuration.
+// Only the parameters that are set are included.
+func (v VaultConfig) EncodeToURI() string {
+	params := map[string]string{
+		"address":      v.Address,
+		"namespace":    v.Namespace,
+		"transitMount": v.TransitMount,
+		"keyName":      v.KeyName,
+		"authMethod":   string(v.AuthMethod),
+		"authMount":    v.AuthMount,
+		"token":        v.Token,
+		"roleID":       v.RoleID,
+		"secretID":     v.SecretID,
+		"role":         v.Role,
+		"jwtPath":      v.JWTPath,
+		"caCertPath":   v.CACertPath,
+	}
+	return fmt.Sprintf(vaultKMSURI, encodeQueryParameters(params))
+}
+
+// KMIPConfig is the configuration to use a KEK held by a KMIP server.
+type KMIPConfig struct {
+	// Address is the host and port of the KMIP server, e.g. kmip.example.com:5696.
+	Address string
+	// ServerName overrides the name used to verify the server certificate. Optional.
+	ServerName string
+	// KeyName is the value of the Name attribute of the symmetric KEK on the KMIP server.
+	KeyName string
+	// ClientCertPath is the path to the PEM encoded client certificate used for mutual TLS.
+	ClientCertPath string
+	// ClientKeyPath is the path to the PEM encoded private key of the client certificate.
+	ClientKeyPath string
+	// CACertPath is the path to a PEM file with CA certificates used to verify the KMIP server. Optional.
+	CACertPath string
+}
+
+// DecodeKMIPConfigFromURI decodes a KMIP configuration from a URI.
+func DecodeKMIPConfigFromURI(uri string) (KMIPConfig, error) {
+	u, err := url.Parse(uri)
+	if err != nil {
+		return KMIPConfig{}, err
+	}
+
+	if u.Scheme != "kms" {
+		return KMIPConfig{}, fmt.Errorf("invalid scheme: %q", u.Scheme)
+	}
+	if u.Host != "kmip" {
+		return KMIPConfig{}, fmt.Errorf("invalid host: %q", u.Host)
+	}
+
+	q := u.Query()
+	var cfg KMIPConfig
+	required := map[string]*string{
+		"address":        &cfg.Address,
+		"keyName":        &cfg.KeyName,
+		"clientCertPath": &cfg.ClientCertPath,
+		"clientKeyPath":  &cfg.ClientKeyPath,
+	}
+	for key, value := range required {
+		if *value, err = getQueryParameter(q, key); err != nil {
+			return KMIPConfig{}, err
+		}
+	}
+	optional := map[string]*string{
+		"serverName": &cfg.ServerName,
+		"caCertPath": &cfg.CACertPath,
+	}
+	for key, value := range optional {
+		if *value, err = getOptionalQueryParameter(q, key); err != nil {
+			return KMIPConfig{}, err
+		}
+	}
+
+	return cfg, nil
+}
+
+// EncodeToURI returns a URI encoding the KMIP configuration.
+// Only the parameters that are set are included.
+func (k KMIPConfig) EncodeToURI() string {
+	params := map[string]string{
+		"address":        k.Address,
+		"serverName":     k.ServerName,
+		"keyName":        k.KeyName,
+		"clientCertPath": k.ClientCertPath,
+		"clientKeyPath":  k.ClientKeyPath,
+		"caCertPath":     k.CACertPath,
+	}
+	return fmt.Sprintf(kmipKMSURI, encodeQueryParameters(params))
+}
+
+// encodeQueryParameters returns the query of a URI holding the given parameters.
+// Parameters with empty values are omitted.
+func encodeQueryParameters(params map[string]string) string {
+	q := url.Values{}
+	for key, value := range params {
+		if value != "" {
+			// Values are escaped twice, since getQueryParameter unescapes them after parsing the URI.
+			q.Set(key, url.QueryEscape(value))
+		}
+	}
+	return q.Encode()
+}
+
 // getBase64QueryParameter returns the url-base64-decoded value for the given key from the query parameters.
 func getBase64QueryParameter(q url.Values, key string) ([]byte, error) {
 	value, err := getQueryParameter(q, key)
@@ -527,3 +876,12 @@ func getQueryParameter(q url.Values, key string) (string, error) {
 	}
 	return value, nil
 }
+
+// getOptionalQueryParameter returns the unescaped value for the given key from the query parameters,
+// or an empty string if the parameter is not set.
+func getOptionalQueryParameter(q url.Values, key string) (string, error) {
+	if q.Get(key) == "" {
+		return "", nil
+	}
+	return getQueryParameter(q, key)
+}
@@ -27,6 +27,23 @@ func TestMasterSecretURI(t *testing.T) {
 	checkURI(t, cfg, DecodeMasterSecretFromURI)
 }
 
+func TestMasterSecretURIRotations(t *testing.T) {
+	cfg := MasterSecret{
+		Key:  []byte("key"),
+		Salt: []byte("salt"),
+		Rotations: []MasterSecretRotation{
+			{Key: []byte("key-1"), Salt: []byte("salt-1")},
+			{Key: []byte("key-2"), Salt: []byte("salt-2")},
+		},
+	}
+
+	checkURI(t, cfg, DecodeMasterSecretFromURI)
+	assert.EqualValues(t, 2, cfg.Generation())
+
+	_, err := DecodeMasterSecretFromURI("kms://cluster-kms?key=a2V5&salt=c2FsdA==&key-1=a2V5")
+	assert.Error(t, err, "rotation without salt")
+}
+
 func TestAWSURI(t *testing.T) {
 	cfg := AWSConfig{
 		KeyName:     "key",
@@ -96,6 +113,126 @@ func TestGoogleCloudStorageURI(t *testing.T) {
 	checkURI(t, cfg, DecodeGoogleCloudStorageConfigFromURI)
 }
 
+func TestFileStorageURI(t *testing.T) {
+	cfg := FileStorageConfig{
+		Path: "/var/lib/constellation/deks with spaces+%",
+	}
+	checkURI(t, cfg, DecodeFileStorageConfigFromURI)
+}
+
+func TestK8sSecretURI(t *testing.T) {
+	testCases := map[string]K8sSecretConfig{
+		"in-cluster": {
+			Namespace: "kube-system",
+		},
+		"kubeconfig": {
+			Namespace:      "constellation",
+			NamePrefix:     "dek-",
+			KubeconfigPath: "/path/to/kubeconfig",
+		},
+	}
+
+	for name, cfg := range testCases {
+		t.Run(name, func(t *testing.T) {
+			checkURI(t, cfg, DecodeK8sSecretConfigFromURI)
+		})
+	}
+}
+
+func TestVaultURI(t *testing.T) {
+	testCases := map[string]VaultConfig{
+		"token": {
+			Address:    "https://vault.example.com:8200",
+			KeyName:    "key",
+			AuthMethod: VaultAuthToken,
+			Token:      "hvs.token+with%special&chars",
+		},
+		"approle": {
+			Address:      "https://vault.example.com:8200",
+			Namespace:    "team/constellation",
+			TransitMount: "constellation-transit",
+			KeyName:      "key",
+			AuthMethod:   VaultAuthAppRole,
+			AuthMount:    "approle-constellation",
+			RoleID:       "roleID",
+			SecretID:     "secretID",
+			CACertPath:   "/path/to/ca.pem",
+		},
+		"kubernetes": {
+			Address:    "http://127.0.0.1:8200",
+			KeyName:    "key",
+			AuthMethod: VaultAuthKubernetes,
+			Role:       "constellation",
+			JWTPath:    "/path/to/token",
+		},
+	}
+
+	for name, cfg := range testCases {
+		t.Run(name, func(t *testing.T) {
+			checkURI(t, cfg, DecodeVaultConfigFromURI)
+		})
+	}
+}
+
+func TestDecodeVaultConfigFromURIErrors(t *testing.T) {
+	testCases := map[string]string{
+		"wrong host":              "kms://aws?address=https%253A%252F%252Fvault&keyName=key&authMethod=token&token=t",
+		"missing address":         "kms://vault?keyName=key&authMethod=token&token=t",
+		"unknown auth method":     "kms://vault?address=vault&keyName=key&authMethod=ldap",
+		"missing token":           "kms://vault?address=vault&keyName=key&authMethod=token",
+		"missing secret ID":       "kms://vault?address=vault&keyName=key&authMethod=approle&roleID=r",
+		"missing kubernetes role": "kms://vault?address=vault&keyName=key&authMethod=kubernetes",
+	}
+
+	for name, uri := range testCases {
+		t.Run(name, func(t *testing.T) {
+			_, err := DecodeVaultConfigFromURI(uri)
+			assert.Error(t, err)
+		})
+	}
+}
+
+func TestKMIPURI(t *testing.T) {
+	testCases := map[string]KMIPConfig{
+		"required parameters": {
+			Address:        "kmip.example.com:5696",
+			KeyName:        "constellation-kek",
+			ClientCertPath: "/path/to/client.pem",
+			ClientKeyPath:  "/path/to/client-key.pem",
+		},
+		"all parameters": {
+			Address:        "[2001:db8::1]:5696",
+			ServerName:     "kmip.example.com",
+			KeyName:        "kek with spaces&special%chars",
+			ClientCertPath: "/path/to/client.pem",
+			ClientKeyPath:  "/path/to/client-key.pem",
+			CACertPath:     "/path/to/ca.pem",
+		},
+	}
+
+	for name, cfg := range testCases {
+		t.Run(name, func(t *testing.T) {
+			checkURI(t, cfg, DecodeKMIPConfigFromURI)
+		})
+	}
+}
+
+func TestDecodeKMIPConfigFromURIErrors(t *testing.T) {
+	testCases := map[string]string{
+		"wrong host":         "kms://vault?address=kmip%253A5696&keyName=key&clientCertPath=c&clientKeyPath=k",
+		"missing address":    "kms://kmip?keyName=key&clientCertPath=c&clientKeyPath=k",
+		"missing key name":   "kms://kmip?address=kmip%253A5696&clientCertPath=c&clientKeyPath=k",
+		"missing client key": "kms://kmip?address=kmip%253A5696&keyName=key&clientCertPath=c",
+	}
+
+	for name, uri := range testCases {
+		t.Run(name, func(t *testing.T) {
+			_, err := DecodeKMIPConfigFromURI(uri)
+			assert.Error(t, err)
+		})
+	}
+}
+
 type cfgStruct interface {
 	EncodeToURI() string
 }
@@ -14,6 +14,7 @@ import (
 	"context"
 	"errors"
 	"fmt"
+	"time"
 
 	corev1 "k8s.io/api/core/v1"
 	apiextensionsv1 "k8s.io/apiextensions-apiserver/pkg/apis/apiextensions/v1"
@@ -133,6 +134,29 @@ func (k *Kubectl) UpdateConfigMap(ctx context.Context, configMap *corev1.ConfigM
 	return k.CoreV1().ConfigMaps(configMap.ObjectMeta.Namespace).Update(ctx, configMap, metav1.UpdateOptions{})
 }
 
+// GetSecret returns a Secret given it's name and namespace.
+func (k *Kubectl) GetSecret(ctx context.Context, namespace, name string) (*corev1.Secret, error) {
+	return k.CoreV1().Secrets(namespace).Get(ctx, name, metav1.GetOptions{})
+}
+
+// CreateSecret creates the provided Secret.
+func (k *Kubectl) CreateSecret(ctx context.Context, secret *corev1.Secret) error {
+	_, err := k.CoreV1().Secrets(secret.ObjectMeta.Namespace).Create(ctx, secret, metav1.CreateOptions{})
+	return err
+}
+
+// UpdateSecret updates the given Secret.
+func (k *Kubectl) UpdateSecret(ctx context.Context, secret *corev1.Secret) (*corev1.Secret, error) {
+	return k.CoreV1().Secrets(secret.ObjectMeta.Namespace).Update(ctx, secret, metav1.UpdateOptions{})
+}
+
+// RestartDaemonSet triggers a rolling restart of the pods of a DaemonSet, like "kubectl rollout restart".
+func (k *Kubectl) RestartDaemonSet(ctx context.Context, namespace, name string) error {
+	patch := fmt.Sprintf(`{"spec":{"template":{"metadata":{"annotations":{"kubectl.kubernetes.io/restartedAt":%q}}}}}`, time.Now().Format(time.RFC3339))
+	_, err := k.AppsV1().DaemonSets(namespace).Patch(ctx, name, types.StrategicMergePatchType, []byte(patch), metav1.PatchOptions{})
+	return err
+}
+
 // AnnotateNode adds the provided annotations to the node, identified by name.
 func (k *Kubectl) AnnotateNode(ctx context.Context, nodeName, annotationKey, annotationValue string) error {
 	return retry.RetryOnConflict(retry.DefaultRetry, func() error {
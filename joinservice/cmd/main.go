@@ -16,6 +16,7 @@ import (
 	"os"
 	"path/filepath"
 	"strconv"
+	"strings"
 	"time"
 
 	"github.com/edgelesssys/constellation/v2/internal/atls"
@@ -30,6 +31,9 @@ import (
 	"github.com/edgelesssys/constellation/v2/internal/constants"
 	"github.com/edgelesssys/constellation/v2/internal/file"
 	"github.com/edgelesssys/constellation/v2/internal/grpc/atlscredentials"
+	kmsapi "github.com/edgelesssys/constellation/v2/internal/kms/kms"
+	kmssetup "github.com/edgelesssys/constellation/v2/internal/kms/setup"
+	"github.com/edgelesssys/constellation/v2/internal/kms/uri"
 	"github.com/edgelesssys/constellation/v2/internal/logger"
 	"github.com/edgelesssys/constellation/v2/joinservice/internal/certcache"
 	"github.com/edgelesssys/constellation/v2/joinservice/internal/kms"
@@ -48,6 +52,8 @@ func main() {
 	provider := flag.String("cloud-provider", "", "cloud service provider this binary is running on")
 	keyServiceEndpoint := flag.String("key-service-endpoint", "", "endpoint of Constellations key management service")
 	attestationVariant := flag.String("attestation-variant", "", "attestation variant to use for aTLS connections")
+	recoveryKMSURIPath := flag.String("recovery-kms-uri", "", "path to a file containing the URI of a KMS escrowing state disk recovery keys, recovery key escrow is disabled if empty")
+	recoveryStorageURIPath := flag.String("recovery-storage-uri", "", "path to a file containing the URI of the storage used by the recovery key KMS, required if recovery key escrow is enabled")
 	verbosity := flag.Int("v", 0, logger.CmdLineVerbosityDescription)
 	flag.Parse()
 
@@ -103,6 +109,16 @@ func main() {
 	}
 	keyServiceClient := kms.New(log.WithGroup("keyServiceClient"), *keyServiceEndpoint)
 
+	recoveryKMS, err := newRecoveryKMS(context.Background(), handler, *recoveryKMSURIPath, *recoveryStorageURIPath)
+	if err != nil {
+		log.With(slog.Any("error", err)).Error("Failed to set up recovery key KMS")
+		os.Exit(1)
+	}
+	if recoveryKMS != nil {
+		defer recoveryKMS.Close()
+		log.Info("Escrowing state disk recovery keys")
+	}
+
 	measurementSalt, err := handler.Read(filepath.Join(constants.ServiceBasePath, constants.MeasurementSaltFilename))
 	if err != nil {
 		log.With(slog.Any("error", err)).Error("Failed to read measurement salt")
@@ -114,6 +130,7 @@ func main() {
 		kubernetesca.New(log.WithGroup("certificateAuthority"), handler),
 		kubeadm,
 		keyServiceClient,
+		recoveryKMS,
 		kubeClient,
 		log.WithGroup("server"),
 		file.NewHandler(afero.NewOsFs()),
@@ -144,6 +161,40 @@ func main() {
 	}
 }
 
+// newRecoveryKMS sets up the KMS escrowing state disk recovery keys.
+// It returns nil if recovery key escrow is disabled.
+func newRecoveryKMS(ctx context.Context, handler file.Handler, kmsURIPath, storageURIPath string) (kmsapi.KeyEscrow, error) {
+	if kmsURIPath == "" {
+		return nil, nil
+	}
+	kmsURI, err := handler.Read(kmsURIPath)
+	if err != nil {
+		return nil, fmt.Errorf("reading recovery KMS URI: %w", err)
+	}
+	// External KMSs store the wrapped recovery keys in a separate storage backend.
+	if storageURIPath == "" {
+		return nil, errors.New("recovery key escrow requires a storage URI")
+	}
+	storageURI, err := handler.Read(storageURIPath)
+	if err != nil {
+		return nil, fmt.Errorf("reading recovery storage URI: %w", err)
+	}
+	if strings.TrimSpace(string(storageURI)) == uri.NoStoreURI {
+		return nil, errors.New("recovery key escrow requires a storage URI, got no-store")
+	}
+	recoveryKMS, err := kmssetup.KMS(ctx, strings.TrimSpace(string(storageURI)), strings.TrimSpace(string(kmsURI)))
+	if err != nil {
+		return nil, err
+	}
+	// The measurement secret is escrowed next to the recovery keys, which requires storing existing keys.
+	escrow, ok := recoveryKMS.(kmsapi.KeyEscrow)
+	if !ok {
+		recoveryKMS.Close()
+		return nil, errors.New("recovery KMS doesn't support escrowing keys")
+	}
+	return escrow, nil
+}
+
 func getVPCIP(ctx context.Context, provider string) (string, error) {
 	var metadataClient metadataAPI
 	var err error
@@ -11,6 +11,7 @@ import (
 	"crypto/x509"
 	"fmt"
 
+	"github.com/edgelesssys/constellation/v2/internal/attestation/snp"
 	"github.com/google/go-sev-guest/abi"
 	"github.com/google/go-sev-guest/verify/trust"
 )
@@ -36,3 +37,18 @@ func (c *KDSClient) CertChain(signingType abi.ReportSigner) (ask, ark *x509.Cert
 
 	return askark.Ask, askark.Ark, nil
 }
+
+// CRL queries the AMD KDS for the certificate revocation list for given signing type (VCEK / VLEK).
+// The CRL is returned as is, verifying its signature is up to the caller.
+func (c *KDSClient) CRL(signingType abi.ReportSigner) (*x509.RevocationList, error) {
+	raw, err := c.getter.Get(snp.CRLURL("Milan", signingType))
+	if err != nil {
+		return nil, fmt.Errorf("retrieving CRL: %w", err)
+	}
+	crl, err := x509.ParseRevocationList(raw)
+	if err != nil {
+		return nil, fmt.Errorf("parsing CRL: %w", err)
+	}
+
+	return crl, nil
+}
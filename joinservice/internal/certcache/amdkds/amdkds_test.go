@@ -11,6 +11,7 @@ import (
 	"log/slog"
 	"testing"
 
+	snptestdata "github.com/edgelesssys/constellation/v2/internal/attestation/snp/testdata"
 	"github.com/edgelesssys/constellation/v2/internal/logger"
 	"github.com/edgelesssys/constellation/v2/joinservice/internal/certcache/amdkds/testdata"
 	"github.com/google/go-sev-guest/abi"
@@ -64,13 +65,76 @@ func TestCertChain(t *testing.T) {
 	}
 }
 
+func TestCRL(t *testing.T) {
+	testCases := map[string]struct {
+		getter  *stubGetter
+		signer  abi.ReportSigner
+		wantURL string
+		wantErr bool
+	}{
+		"vcek": {
+			getter: &stubGetter{
+				log: logger.NewTest(t),
+				ret: snptestdata.KDSCRL,
+			},
+			signer:  abi.VcekReportSigner,
+			wantURL: "https://kdsintf.amd.com/vcek/v1/Milan/crl",
+		},
+		"vlek": {
+			getter: &stubGetter{
+				log: logger.NewTest(t),
+				ret: snptestdata.KDSCRL,
+			},
+			signer:  abi.VlekReportSigner,
+			wantURL: "https://kdsintf.amd.com/vlek/v1/Milan/crl",
+		},
+		"getter error": {
+			getter: &stubGetter{
+				log: logger.NewTest(t),
+				err: assert.AnError,
+			},
+			signer:  abi.VcekReportSigner,
+			wantURL: "https://kdsintf.amd.com/vcek/v1/Milan/crl",
+			wantErr: true,
+		},
+		"invalid CRL": {
+			getter: &stubGetter{
+				log: logger.NewTest(t),
+				ret: []byte("invalid"),
+			},
+			signer:  abi.VcekReportSigner,
+			wantURL: "https://kdsintf.amd.com/vcek/v1/Milan/crl",
+			wantErr: true,
+		},
+	}
+
+	for name, tc := range testCases {
+		t.Run(name, func(t *testing.T) {
+			assert := assert.New(t)
+
+			kdsClient := NewKDSClient(tc.getter)
+
+			crl, err := kdsClient.CRL(tc.signer)
+			if tc.wantErr {
+				assert.Error(err)
+			} else {
+				assert.NoError(err)
+				assert.NotNil(crl)
+			}
+			assert.Equal(tc.wantURL, tc.getter.lastURL)
+		})
+	}
+}
+
 type stubGetter struct {
-	log *slog.Logger
-	ret []byte
-	err error
+	log     *slog.Logger
+	ret     []byte
+	err     error
+	lastURL string
 }
 
 func (s *stubGetter) Get(url string) ([]byte, error) {
 	s.log.Debug(fmt.Sprintf("Request to %q", url))
+	s.lastURL = url
 	return s.ret, s.err
 }
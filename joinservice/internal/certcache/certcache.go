@@ -5,6 +5,7 @@ SPDX-License-Identifier: BUSL-1.1
 */
 
 // Package certcache implements an in-cluster SEV-SNP certificate cache.
+// Besides the ASK and ARK, the cache holds the AMD certificate revocation list (CRL) for the report signer.
 package certcache
 
 import (
@@ -12,7 +13,9 @@ import (
 	"crypto/x509"
 	"fmt"
 	"log/slog"
+	"time"
 
+	"github.com/edgelesssys/constellation/v2/internal/attestation/snp"
 	"github.com/edgelesssys/constellation/v2/internal/attestation/variant"
 	"github.com/edgelesssys/constellation/v2/internal/constants"
 	"github.com/edgelesssys/constellation/v2/internal/crypto"
@@ -48,7 +51,7 @@ func NewClient(log *slog.Logger, kubeClient kubeClient, attVariant variant.Varia
 func (c *Client) CreateCertChainCache(ctx context.Context) (*CachedCerts, error) {
 	var reportSigner abi.ReportSigner
 	switch c.attVariant {
-	case variant.AzureSEVSNP{}:
+	case variant.AzureSEVSNP{}, variant.GCPSEVSNP{}:
 		reportSigner = abi.VcekReportSigner
 	case variant.AWSSEVSNP{}:
 		reportSigner = abi.VlekReportSigner
@@ -62,9 +65,18 @@ func (c *Client) CreateCertChainCache(ctx context.Context) (*CachedCerts, error)
 	if err != nil {
 		return nil, fmt.Errorf("creating %s certificate chain cache: %w", c.attVariant, err)
 	}
+
+	// A missing CRL is not fatal here: the validators retrieve the CRL themselves if it is not cached,
+	// and decide whether a missing CRL fails the attestation.
+	crl, err := c.createCRLCache(ctx, reportSigner, ark)
+	if err != nil {
+		c.log.With(slog.Any("error", err)).Warn("Failed to create certificate revocation list cache")
+	}
+
 	return &CachedCerts{
 		ask: ask,
 		ark: ark,
+		crl: crl,
 	}, nil
 }
 
@@ -72,6 +84,7 @@ func (c *Client) CreateCertChainCache(ctx context.Context) (*CachedCerts, error)
 type CachedCerts struct {
 	ask *x509.Certificate
 	ark *x509.Certificate
+	crl *x509.RevocationList
 }
 
 // SevSnpCerts returns the cached SEV-SNP ASK and ARK certificates.
@@ -79,6 +92,11 @@ func (c *CachedCerts) SevSnpCerts() (ask, ark *x509.Certificate) {
 	return c.ask, c.ark
 }
 
+// SevSnpCRL returns the cached AMD certificate revocation list, or nil if no CRL is cached.
+func (c *CachedCerts) SevSnpCRL() *x509.RevocationList {
+	return c.crl
+}
+
 // createCertChainCache creates a certificate chain cache configmap with the ASK and ARK
 // retrieved from the KDS and returns ASK and ARK. If the configmap already exists and both ASK and ARK are present,
 // nothing is done and the existing ASK and ARK are returned. If the configmap already exists but either ASK or ARK
@@ -196,6 +214,63 @@ func (c *Client) getCertChainCache(ctx context.Context) (ask, ark *x509.Certific
 	return ask, ark, nil
 }
 
+// createCRLCache returns the CRL cached in the certificate chain cache configmap, if it is valid for the given ARK.
+// Otherwise, the CRL is retrieved from the KDS and the configmap is updated with the new CRL.
+// The certificate chain cache configmap must exist.
+func (c *Client) createCRLCache(ctx context.Context, signingType abi.ReportSigner, ark *x509.Certificate) (*x509.RevocationList, error) {
+	c.log.Debug("Creating certificate revocation list cache")
+	cacheCRL, err := c.getCRLCache(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("getting CRL cache: %w", err)
+	}
+	if cacheCRL != nil {
+		err := snp.VerifyCRL(cacheCRL, ark, time.Now())
+		if err == nil {
+			c.log.Debug("CRL present in cache, returning cached value")
+			return cacheCRL, nil
+		}
+		c.log.Debug(fmt.Sprintf("Cached CRL is invalid: %s", err))
+	}
+
+	c.log.Debug("Retrieving CRL from KDS")
+	crl, err := c.kdsClient.CRL(signingType)
+	if err != nil {
+		return nil, fmt.Errorf("retrieving CRL from KDS: %w", err)
+	}
+	if err := snp.VerifyCRL(crl, ark, time.Now()); err != nil {
+		return nil, fmt.Errorf("verifying CRL from KDS: %w", err)
+	}
+
+	crlPem, err := crypto.X509CRLToPem(crl)
+	if err != nil {
+		return nil, fmt.Errorf("encoding CRL: %w", err)
+	}
+	if err := c.kubeClient.UpdateConfigMap(ctx, constants.SevSnpCertCacheConfigMapName,
+		constants.CertCacheCRLKey, string(crlPem)); err != nil {
+		return nil, fmt.Errorf("updating CRL in certificate chain cache configmap: %w", err)
+	}
+
+	return crl, nil
+}
+
+// getCRLCache returns the cached CRL, if available. If the key is not present in the configmap, no error is returned.
+func (c *Client) getCRLCache(ctx context.Context) (*x509.RevocationList, error) {
+	c.log.Debug("Retrieving CRL from cache")
+	crlRaw, err := c.kubeClient.GetConfigMapData(ctx, constants.SevSnpCertCacheConfigMapName, constants.CertCacheCRLKey)
+	if err != nil {
+		return nil, fmt.Errorf("getting CRL from configmap: %w", err)
+	}
+	if crlRaw == "" {
+		return nil, nil
+	}
+	c.log.Debug("CRL cache hit")
+	crl, err := crypto.PemToX509CRL([]byte(crlRaw))
+	if err != nil {
+		return nil, fmt.Errorf("parsing CRL: %w", err)
+	}
+	return crl, nil
+}
+
 type kubeClient interface {
 	CreateConfigMap(ctx context.Context, name string, data map[string]string) error
 	GetConfigMapData(ctx context.Context, name, key string) (string, error)
@@ -204,4 +279,5 @@ type kubeClient interface {
 
 type kdsClient interface {
 	CertChain(signingType abi.ReportSigner) (ask, ark *x509.Certificate, err error)
+	CRL(signingType abi.ReportSigner) (*x509.RevocationList, error)
 }
@@ -11,6 +11,7 @@ import (
 	"crypto/x509"
 	"testing"
 
+	snptestdata "github.com/edgelesssys/constellation/v2/internal/attestation/snp/testdata"
 	"github.com/edgelesssys/constellation/v2/internal/attestation/variant"
 	"github.com/edgelesssys/constellation/v2/internal/constants"
 	"github.com/edgelesssys/constellation/v2/internal/crypto"
@@ -141,6 +142,8 @@ type stubKdsClient struct {
 	askResponse  []byte
 	arkResponse  []byte
 	certChainErr error
+	crlResponse  []byte
+	crlErr       error
 }
 
 func (c *stubKdsClient) CertChain(abi.ReportSigner) (ask, ark *x509.Certificate, err error) {
@@ -153,6 +156,13 @@ func (c *stubKdsClient) CertChain(abi.ReportSigner) (ask, ark *x509.Certificate,
 	return ask, ark, c.certChainErr
 }
 
+func (c *stubKdsClient) CRL(abi.ReportSigner) (*x509.RevocationList, error) {
+	if c.crlErr != nil {
+		return nil, c.crlErr
+	}
+	return x509.ParseRevocationList(c.crlResponse)
+}
+
 func mustParsePEM(pemBytes []byte) *x509.Certificate {
 	cert, err := crypto.PemToX509Cert(pemBytes)
 	if err != nil {
@@ -161,6 +171,114 @@ func mustParsePEM(pemBytes []byte) *x509.Certificate {
 	return cert
 }
 
+func TestCreateCRLCache(t *testing.T) {
+	crlPEM := mustCRLToPEM(snptestdata.KDSCRL)
+
+	testCases := map[string]struct {
+		kubeClient      *stubKubeClient
+		kdsClient       *stubKdsClient
+		ark             []byte
+		wantUpdatedKeys []string
+		wantErr         bool
+	}{
+		"available in configmap": {
+			kubeClient: &stubKubeClient{
+				crlResponse: crlPEM,
+			},
+			kdsClient: &stubKdsClient{
+				crlErr: assert.AnError,
+			},
+		},
+		"query from kds": {
+			kubeClient: &stubKubeClient{},
+			kdsClient: &stubKdsClient{
+				crlResponse: snptestdata.KDSCRL,
+			},
+			wantUpdatedKeys: []string{constants.CertCacheCRLKey},
+		},
+		"cached CRL not signed by ARK": {
+			kubeClient: &stubKubeClient{
+				crlResponse: crlPEM,
+			},
+			kdsClient: &stubKdsClient{
+				crlResponse: snptestdata.KDSCRL,
+			},
+			ark:     testdata.Ark,
+			wantErr: true,
+		},
+		"kds error": {
+			kubeClient: &stubKubeClient{},
+			kdsClient: &stubKdsClient{
+				crlErr: assert.AnError,
+			},
+			wantErr: true,
+		},
+		"get config map data err": {
+			kubeClient: &stubKubeClient{
+				getConfigMapDataErr: assert.AnError,
+			},
+			kdsClient: &stubKdsClient{},
+			wantErr:   true,
+		},
+		"invalid CRL in configmap": {
+			kubeClient: &stubKubeClient{
+				crlResponse: "invalid",
+			},
+			kdsClient: &stubKdsClient{},
+			wantErr:   true,
+		},
+		"update configmap err": {
+			kubeClient: &stubKubeClient{
+				updateConfigMapErr: assert.AnError,
+			},
+			kdsClient: &stubKdsClient{
+				crlResponse: snptestdata.KDSCRL,
+			},
+			wantUpdatedKeys: []string{constants.CertCacheCRLKey},
+			wantErr:         true,
+		},
+	}
+
+	for name, tc := range testCases {
+		t.Run(name, func(t *testing.T) {
+			assert := assert.New(t)
+			require := require.New(t)
+
+			if tc.ark == nil {
+				tc.ark = snptestdata.TestARK
+			}
+
+			c := &Client{
+				attVariant: variant.Dummy{},
+				log:        logger.NewTest(t),
+				kubeClient: tc.kubeClient,
+				kdsClient:  tc.kdsClient,
+			}
+
+			crl, err := c.createCRLCache(t.Context(), abi.VcekReportSigner, mustParsePEM(tc.ark))
+			if tc.wantErr {
+				assert.Error(err)
+			} else {
+				require.NoError(err)
+				assert.Equal(snptestdata.KDSCRL, crl.Raw)
+			}
+			assert.Equal(tc.wantUpdatedKeys, tc.kubeClient.updatedKeys)
+		})
+	}
+}
+
+func mustCRLToPEM(der []byte) string {
+	crl, err := x509.ParseRevocationList(der)
+	if err != nil {
+		panic(err)
+	}
+	crlPEM, err := crypto.X509CRLToPem(crl)
+	if err != nil {
+		panic(err)
+	}
+	return string(crlPEM)
+}
+
 func TestGetCertChainCache(t *testing.T) {
 	testCases := map[string]struct {
 		kubeClient  *stubKubeClient
@@ -223,9 +341,11 @@ func TestGetCertChainCache(t *testing.T) {
 type stubKubeClient struct {
 	askResponse         string
 	arkResponse         string
+	crlResponse         string
 	createConfigMapErr  error
 	updateConfigMapErr  error
 	getConfigMapDataErr error
+	updatedKeys         []string
 }
 
 func (s *stubKubeClient) CreateConfigMap(context.Context, string, map[string]string) error {
@@ -239,9 +359,13 @@ func (s *stubKubeClient) GetConfigMapData(_ context.Context, _ string, key strin
 	if key == constants.CertCacheArkKey {
 		return s.arkResponse, s.getConfigMapDataErr
 	}
+	if key == constants.CertCacheCRLKey {
+		return s.crlResponse, s.getConfigMapDataErr
+	}
 	return "", s.getConfigMapDataErr
 }
 
-func (s *stubKubeClient) UpdateConfigMap(context.Context, string, string, string) error {
+func (s *stubKubeClient) UpdateConfigMap(_ context.Context, _ string, key string, _ string) error {
+	s.updatedKeys = append(s.updatedKeys, key)
 	return s.updateConfigMapErr
 }
@@ -12,6 +12,7 @@ import (
 	"fmt"
 	"log/slog"
 
+	"github.com/edgelesssys/constellation/v2/internal/grpc/tokencredentials"
 	"github.com/edgelesssys/constellation/v2/keyservice/keyserviceproto"
 	"google.golang.org/grpc"
 	"google.golang.org/grpc/credentials/insecure"
@@ -35,7 +36,88 @@ func New(log *slog.Logger, endpoint string) Client {
 
 // GetDataKey returns a data encryption key for the given UUID.
 func (c Client) GetDataKey(ctx context.Context, keyID string, length int) ([]byte, error) {
+	res, err := c.getDataKey(ctx, &keyserviceproto.GetDataKeyRequest{
+		DataKeyId: keyID,
+		Length:    uint32(length),
+	})
+	if err != nil {
+		return nil, err
+	}
+	return res.DataKey, nil
+}
+
+// GetVersionedDataKey returns a version of a data encryption key.
+func (c Client) GetVersionedDataKey(ctx context.Context, keyID string, length int, version uint32) ([]byte, error) {
+	res, err := c.getDataKey(ctx, &keyserviceproto.GetDataKeyRequest{
+		DataKeyId: keyID,
+		Length:    uint32(length),
+		Version:   version,
+	})
+	if err != nil {
+		return nil, err
+	}
+	return res.DataKey, nil
+}
+
+// GetLatestDataKey returns the latest version of a data encryption key, and its version.
+func (c Client) GetLatestDataKey(ctx context.Context, keyID string, length int) ([]byte, uint32, error) {
+	res, err := c.getDataKey(ctx, &keyserviceproto.GetDataKeyRequest{
+		DataKeyId: keyID,
+		Length:    uint32(length),
+		Latest:    true,
+	})
+	if err != nil {
+		return nil, 0, err
+	}
+	return res.DataKey, res.Version, nil
+}
+
+// RotateDataKey creates a new version of a data encryption key and returns the new version.
+// The request is authenticated with the service account token of the join service.
+func (c Client) RotateDataKey(ctx context.Context, keyID string) (uint32, error) {
 	log := c.log.With(slog.String("keyID", keyID), slog.String("endpoint", c.endpoint))
+	conn, err := grpc.NewClient(c.endpoint,
+		grpc.WithTransportCredentials(insecure.NewCredentials()),
+		grpc.WithPerRPCCredentials(tokencredentials.New(tokencredentials.ServiceAccountTokenPath)),
+	)
+	if err != nil {
+		return 0, err
+	}
+	defer conn.Close()
+
+	log.Info("Rotating data key")
+	res, err := c.grpc.RotateDataKey(ctx, &keyserviceproto.RotateDataKeyRequest{DataKeyId: keyID}, conn)
+	if err != nil {
+		return 0, fmt.Errorf("rotating data encryption key in Constellation KMS: %w", err)
+	}
+
+	log.Info(fmt.Sprintf("Rotated data key to version %d", res.Version))
+	return res.Version, nil
+}
+
+// LatestVersion returns the latest version of a data encryption key.
+// Keys the KMS doesn't know yet have version 0.
+func (c Client) LatestVersion(ctx context.Context, keyID string) (uint32, error) {
+	conn, err := grpc.NewClient(c.endpoint, grpc.WithTransportCredentials(insecure.NewCredentials()))
+	if err != nil {
+		return 0, err
+	}
+	defer conn.Close()
+
+	res, err := c.grpc.ListDataKeys(ctx, &keyserviceproto.ListDataKeysRequest{}, conn)
+	if err != nil {
+		return 0, fmt.Errorf("listing data encryption keys of Constellation KMS: %w", err)
+	}
+	for _, key := range res.DataKeys {
+		if key.DataKeyId == keyID {
+			return key.LatestVersion, nil
+		}
+	}
+	return 0, nil
+}
+
+func (c Client) getDataKey(ctx context.Context, req *keyserviceproto.GetDataKeyRequest) (*keyserviceproto.GetDataKeyResponse, error) {
+	log := c.log.With(slog.String("keyID", req.DataKeyId), slog.String("endpoint", c.endpoint))
 	// the KMS does not use aTLS since traffic is only routed through the Constellation cluster
 	// cluster internal connections are considered trustworthy
 	log.Info(fmt.Sprintf("Connecting to KMS at %s", c.endpoint))
@@ -46,24 +128,19 @@ func (c Client) GetDataKey(ctx context.Context, keyID string, length int) ([]byt
 	defer conn.Close()
 
 	log.Info("Requesting data key")
-	res, err := c.grpc.GetDataKey(
-		ctx,
-		&keyserviceproto.GetDataKeyRequest{
-			DataKeyId: keyID,
-			Length:    uint32(length),
-		},
-		conn,
-	)
+	res, err := c.grpc.GetDataKey(ctx, req, conn)
 	if err != nil {
 		return nil, fmt.Errorf("fetching data encryption key from Constellation KMS: %w", err)
 	}
 
 	log.Info("Data key request successful")
-	return res.DataKey, nil
+	return res, nil
 }
 
 type grpcClient interface {
 	GetDataKey(context.Context, *keyserviceproto.GetDataKeyRequest, *grpc.ClientConn) (*keyserviceproto.GetDataKeyResponse, error)
+	RotateDataKey(context.Context, *keyserviceproto.RotateDataKeyRequest, *grpc.ClientConn) (*keyserviceproto.RotateDataKeyResponse, error)
+	ListDataKeys(context.Context, *keyserviceproto.ListDataKeysRequest, *grpc.ClientConn) (*keyserviceproto.ListDataKeysResponse, error)
 }
 
 type client struct{}
@@ -71,3 +148,11 @@ type client struct{}
 func (c client) GetDataKey(ctx context.Context, req *keyserviceproto.GetDataKeyRequest, conn *grpc.ClientConn) (*keyserviceproto.GetDataKeyResponse, error) {
 	return keyserviceproto.NewAPIClient(conn).GetDataKey(ctx, req)
 }
+
+func (c client) RotateDataKey(ctx context.Context, req *keyserviceproto.RotateDataKeyRequest, conn *grpc.ClientConn) (*keyserviceproto.RotateDataKeyResponse, error) {
+	return keyserviceproto.NewAPIClient(conn).RotateDataKey(ctx, req)
+}
+
+func (c client) ListDataKeys(ctx context.Context, req *keyserviceproto.ListDataKeysRequest, conn *grpc.ClientConn) (*keyserviceproto.ListDataKeysResponse, error) {
+	return keyserviceproto.NewAPIClient(conn).ListDataKeys(ctx, req)
+}
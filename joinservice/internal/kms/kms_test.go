@@ -14,18 +14,34 @@ import (
 	"github.com/edgelesssys/constellation/v2/internal/logger"
 	"github.com/edgelesssys/constellation/v2/keyservice/keyserviceproto"
 	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
 	"go.uber.org/goleak"
 	"google.golang.org/grpc"
 	"google.golang.org/grpc/test/bufconn"
 )
 
 type stubClient struct {
-	getDataKeyErr error
-	dataKey       []byte
+	getDataKeyErr    error
+	dataKey          []byte
+	version          uint32
+	rotateDataKeyErr error
+	dataKeys         []*keyserviceproto.DataKeyInfo
+	listDataKeysErr  error
+
+	gotRequest *keyserviceproto.GetDataKeyRequest
+}
+
+func (c *stubClient) GetDataKey(_ context.Context, req *keyserviceproto.GetDataKeyRequest, _ *grpc.ClientConn) (*keyserviceproto.GetDataKeyResponse, error) {
+	c.gotRequest = req
+	return &keyserviceproto.GetDataKeyResponse{DataKey: c.dataKey, Version: c.version}, c.getDataKeyErr
 }
 
-func (c *stubClient) GetDataKey(context.Context, *keyserviceproto.GetDataKeyRequest, *grpc.ClientConn) (*keyserviceproto.GetDataKeyResponse, error) {
-	return &keyserviceproto.GetDataKeyResponse{DataKey: c.dataKey}, c.getDataKeyErr
+func (c *stubClient) RotateDataKey(context.Context, *keyserviceproto.RotateDataKeyRequest, *grpc.ClientConn) (*keyserviceproto.RotateDataKeyResponse, error) {
+	return &keyserviceproto.RotateDataKeyResponse{Version: c.version}, c.rotateDataKeyErr
+}
+
+func (c *stubClient) ListDataKeys(context.Context, *keyserviceproto.ListDataKeysRequest, *grpc.ClientConn) (*keyserviceproto.ListDataKeysResponse, error) {
+	return &keyserviceproto.ListDataKeysResponse{DataKeys: c.dataKeys}, c.listDataKeysErr
 }
 
 func TestMain(m *testing.M) {
@@ -70,3 +86,107 @@ func TestGetDataKey(t *testing.T) {
 		})
 	}
 }
+
+func TestGetVersionedDataKey(t *testing.T) {
+	assert := assert.New(t)
+	require := require.New(t)
+
+	stub := &stubClient{dataKey: []byte{0x1, 0x2, 0x3}, version: 2}
+	client := New(logger.NewTest(t), "192.0.2.1:9000")
+	client.grpc = stub
+
+	key, err := client.GetVersionedDataKey(t.Context(), "disk-uuid", 32, 2)
+	require.NoError(err)
+	assert.Equal(stub.dataKey, key)
+	assert.Equal(uint32(2), stub.gotRequest.Version)
+	assert.False(stub.gotRequest.Latest)
+
+	key, version, err := client.GetLatestDataKey(t.Context(), "disk-uuid", 32)
+	require.NoError(err)
+	assert.Equal(stub.dataKey, key)
+	assert.Equal(uint32(2), version)
+	assert.True(stub.gotRequest.Latest)
+
+	stub.getDataKeyErr = errors.New("error")
+	_, err = client.GetVersionedDataKey(t.Context(), "disk-uuid", 32, 2)
+	assert.Error(err)
+	_, _, err = client.GetLatestDataKey(t.Context(), "disk-uuid", 32)
+	assert.Error(err)
+}
+
+func TestRotateDataKey(t *testing.T) {
+	testCases := map[string]struct {
+		client      *stubClient
+		wantVersion uint32
+		wantErr     bool
+	}{
+		"success": {
+			client:      &stubClient{version: 3},
+			wantVersion: 3,
+		},
+		"error": {
+			client:  &stubClient{rotateDataKeyErr: errors.New("error")},
+			wantErr: true,
+		},
+	}
+
+	for name, tc := range testCases {
+		t.Run(name, func(t *testing.T) {
+			assert := assert.New(t)
+
+			client := New(logger.NewTest(t), "192.0.2.1:9000")
+			client.grpc = tc.client
+
+			version, err := client.RotateDataKey(t.Context(), "disk-uuid")
+			if tc.wantErr {
+				assert.Error(err)
+				return
+			}
+			assert.NoError(err)
+			assert.Equal(tc.wantVersion, version)
+		})
+	}
+}
+
+func TestLatestVersion(t *testing.T) {
+	testCases := map[string]struct {
+		client      *stubClient
+		wantVersion uint32
+		wantErr     bool
+	}{
+		"known key": {
+			client: &stubClient{dataKeys: []*keyserviceproto.DataKeyInfo{
+				{DataKeyId: "other", LatestVersion: 5},
+				{DataKeyId: "disk-uuid", LatestVersion: 2},
+			}},
+			wantVersion: 2,
+		},
+		"unknown key": {
+			client: &stubClient{dataKeys: []*keyserviceproto.DataKeyInfo{
+				{DataKeyId: "other", LatestVersion: 5},
+			}},
+			wantVersion: 0,
+		},
+		"error": {
+			client:  &stubClient{listDataKeysErr: errors.New("error")},
+			wantErr: true,
+		},
+	}
+
+	for name, tc := range testCases {
+		t.Run(name, func(t *testing.T) {
+			assert := assert.New(t)
+
+			client := New(logger.NewTest(t), "192.0.2.1:9000")
+			client.grpc = tc.client
+
+			version, err := client.LatestVersion(t.Context(), "disk-uuid")
+			if tc.wantErr {
+				assert.Error(err)
+				return
+			}
+			assert.NoError(err)
+			assert.Equal(tc.wantVersion, version)
+		})
+	}
+}
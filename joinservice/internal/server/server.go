@@ -14,6 +14,7 @@ import (
 	"log/slog"
 	"net"
 	"strings"
+	"sync"
 	"time"
 
 	"github.com/edgelesssys/constellation/v2/internal/attestation"
@@ -40,23 +41,31 @@ type Server struct {
 	log             *slog.Logger
 	joinTokenGetter joinTokenGetter
 	dataKeyGetter   dataKeyGetter
+	recoveryKMS     recoveryKeyEscrow
 	ca              certificateAuthority
 	kubeClient      kubeClient
 	fileHandler     file.Handler
+
+	// escrowMux guards measurementSecretEscrowed.
+	escrowMux                 sync.Mutex
+	measurementSecretEscrowed bool
+
 	joinproto.UnimplementedAPIServer
 }
 
 // New initializes a new Server.
+// recoveryKMS escrows the recovery keys of state disks. It may be nil if recovery key escrow is disabled.
 func New(
 	measurementSalt []byte, ca certificateAuthority,
-	joinTokenGetter joinTokenGetter, dataKeyGetter dataKeyGetter, kubeClient kubeClient, log *slog.Logger,
-	fileHandler file.Handler,
+	joinTokenGetter joinTokenGetter, dataKeyGetter dataKeyGetter, recoveryKMS recoveryKeyEscrow,
+	kubeClient kubeClient, log *slog.Logger, fileHandler file.Handler,
 ) (*Server, error) {
 	return &Server{
 		measurementSalt: measurementSalt,
 		log:             log,
 		joinTokenGetter: joinTokenGetter,
 		dataKeyGetter:   dataKeyGetter,
+		recoveryKMS:     recoveryKMS,
 		ca:              ca,
 		kubeClient:      kubeClient,
 		fileHandler:     fileHandler,
@@ -87,6 +96,7 @@ func (s *Server) Run(creds credentials.TransportCredentials, port string) error
 // - stateful disk encryption key.
 // - Kubernetes join token.
 // - measurement salt and secret, to mark the node as initialized.
+// - an escrowed recovery key for the stateful disk, if recovery key escrow is configured.
 // In addition, control plane nodes receive:
 // - a decryption key for CA certificates uploaded to the Kubernetes cluster.
 func (s *Server) IssueJoinTicket(ctx context.Context, req *joinproto.IssueJoinTicketRequest) (*joinproto.IssueJoinTicketResponse, error) {
@@ -101,10 +111,17 @@ func (s *Server) IssueJoinTicket(ctx context.Context, req *joinproto.IssueJoinTi
 	}
 
 	log.Info("Requesting disk encryption key")
-	stateDiskKey, err := s.dataKeyGetter.GetDataKey(ctx, req.DiskUuid, crypto.StateDiskKeyLength)
+	stateDiskKey, stateDiskKeyVersion, err := s.latestStateDiskKey(ctx, req.DiskUuid)
 	if err != nil {
-		log.With(slog.Any("error", err)).Error("Failed to get key for stateful disk")
-		return nil, status.Errorf(codes.Internal, "getting key for stateful disk: %s", err)
+		// Version 0 doesn't depend on the key registry, so nodes can still join if the registry is unavailable.
+		// The key is rotated when the node rejoins the cluster.
+		log.With(slog.Any("error", err)).Warn("Failed to get latest key for stateful disk, using version 0")
+		stateDiskKeyVersion = 0
+		stateDiskKey, err = s.dataKeyGetter.GetDataKey(ctx, req.DiskUuid, crypto.StateDiskKeyLength)
+		if err != nil {
+			log.With(slog.Any("error", err)).Error("Failed to get key for stateful disk")
+			return nil, status.Errorf(codes.Internal, "getting key for stateful disk: %s", err)
+		}
 	}
 
 	log.Info("Requesting emergency SSH CA derivation key")
@@ -194,9 +211,18 @@ func (s *Server) IssueJoinTicket(ctx context.Context, req *joinproto.IssueJoinTi
 		return nil, status.Errorf(codes.Internal, "adding node to joining nodes: %s", err)
 	}
 
+	// Failing to escrow the recovery key doesn't prevent the node from joining.
+	// The key is escrowed when the node rejoins the cluster.
+	recoveryKey, err := s.escrowedRecoveryKey(ctx, req.DiskUuid, measurementSecret, log)
+	if err != nil {
+		log.With(slog.Any("error", err)).Warn("Unable to get escrowed recovery key for stateful disk")
+	}
+
 	log.Info("IssueJoinTicket successful")
 	return &joinproto.IssueJoinTicketResponse{
 		StateDiskKey:             stateDiskKey,
+		StateDiskKeyVersion:      stateDiskKeyVersion,
+		StateDiskRecoveryKey:     recoveryKey,
 		MeasurementSalt:          s.measurementSalt,
 		MeasurementSecret:        measurementSecret,
 		ApiServerEndpoint:        kubeArgs.APIServerEndpoint,
@@ -222,18 +248,99 @@ func (s *Server) IssueRejoinTicket(ctx context.Context, req *joinproto.IssueRejo
 		return nil, status.Errorf(codes.Internal, "unable to get measurement secret: %s", err)
 	}
 
+	log = log.With(slog.Uint64("stateDiskKeyVersion", uint64(req.StateDiskKeyVersion)))
 	log.Info("Requesting disk encryption key")
-	stateDiskKey, err := s.dataKeyGetter.GetDataKey(ctx, req.DiskUuid, crypto.StateDiskKeyLength)
+	stateDiskKey, err := s.dataKeyGetter.GetVersionedDataKey(ctx, req.DiskUuid, crypto.StateDiskKeyLength, req.StateDiskKeyVersion)
 	if err != nil {
 		log.With(slog.Any("error", err)).Error("Unable to get key for stateful disk")
 		return nil, status.Errorf(codes.Internal, "unable to get key for stateful disk: %s", err)
 	}
-
-	log.Info("IssueRejoinTicket successful")
-	return &joinproto.IssueRejoinTicketResponse{
+	resp := &joinproto.IssueRejoinTicketResponse{
 		StateDiskKey:      stateDiskKey,
 		MeasurementSecret: measurementSecret,
-	}, nil
+	}
+
+	// Failing to rotate or escrow the state disk key doesn't prevent the node from rejoining.
+	// The node retries the next time it rejoins the cluster.
+	latestKey, latestVersion, err := s.latestStateDiskKey(ctx, req.DiskUuid)
+	if err != nil {
+		log.With(slog.Any("error", err)).Warn("Unable to get latest key for stateful disk, skipping key rotation")
+	} else if latestVersion > req.StateDiskKeyVersion {
+		log.Info(fmt.Sprintf("Requesting rotation of state disk key to version %d", latestVersion))
+		resp.LatestStateDiskKey = latestKey
+		resp.LatestStateDiskKeyVersion = latestVersion
+	}
+
+	recoveryKey, err := s.escrowedRecoveryKey(ctx, req.DiskUuid, measurementSecret, log)
+	if err != nil {
+		log.With(slog.Any("error", err)).Warn("Unable to get escrowed recovery key for stateful disk")
+	} else {
+		resp.StateDiskRecoveryKey = recoveryKey
+	}
+
+	log.Info("IssueRejoinTicket successful")
+	return resp, nil
+}
+
+// escrowedRecoveryKey returns the escrowed recovery key of a state disk, or nil if recovery key escrow is disabled.
+// Before any recovery key is returned, the measurement secret is escrowed next to it,
+// so nodes recovered using their recovery key can be retainted without a control-plane node.
+func (s *Server) escrowedRecoveryKey(ctx context.Context, diskUUID string, measurementSecret []byte, log *slog.Logger) ([]byte, error) {
+	if s.recoveryKMS == nil {
+		return nil, nil
+	}
+	if err := s.escrowMeasurementSecret(ctx, measurementSecret, log); err != nil {
+		return nil, err
+	}
+	log.Info("Requesting escrowed state disk recovery key")
+	recoveryKey, err := s.recoveryKMS.GetDEK(ctx, crypto.StateDiskRecoveryKeyID(diskUUID), crypto.StateDiskKeyLength)
+	if err != nil {
+		return nil, fmt.Errorf("getting recovery key: %w", err)
+	}
+	return recoveryKey, nil
+}
+
+// escrowMeasurementSecret escrows the measurement secret in the recovery KMS once per join service instance.
+func (s *Server) escrowMeasurementSecret(ctx context.Context, measurementSecret []byte, log *slog.Logger) error {
+	s.escrowMux.Lock()
+	defer s.escrowMux.Unlock()
+	if s.measurementSecretEscrowed {
+		return nil
+	}
+	log.Info("Escrowing measurement secret")
+	if err := s.recoveryKMS.PutDEK(ctx, crypto.StateDiskRecoveryMeasurementSecretID, measurementSecret); err != nil {
+		return fmt.Errorf("escrowing measurement secret: %w", err)
+	}
+	s.measurementSecretEscrowed = true
+	return nil
+}
+
+// latestStateDiskKey returns the latest version of a state disk key.
+// The key is rotated until its version reaches the cluster-wide state disk key generation.
+func (s *Server) latestStateDiskKey(ctx context.Context, diskUUID string) ([]byte, uint32, error) {
+	generation, err := s.dataKeyGetter.LatestVersion(ctx, crypto.StateDiskKeyGenerationID)
+	if err != nil {
+		return nil, 0, fmt.Errorf("getting state disk key generation: %w", err)
+	}
+	key, version, err := s.dataKeyGetter.GetLatestDataKey(ctx, diskUUID, crypto.StateDiskKeyLength)
+	if err != nil {
+		return nil, 0, fmt.Errorf("getting latest state disk key: %w", err)
+	}
+	if version >= generation {
+		return key, version, nil
+	}
+
+	for version < generation {
+		version, err = s.dataKeyGetter.RotateDataKey(ctx, diskUUID)
+		if err != nil {
+			return nil, 0, fmt.Errorf("rotating state disk key: %w", err)
+		}
+	}
+	key, err = s.dataKeyGetter.GetVersionedDataKey(ctx, diskUUID, crypto.StateDiskKeyLength, version)
+	if err != nil {
+		return nil, 0, fmt.Errorf("getting rotated state disk key: %w", err)
+	}
+	return key, version, nil
 }
 
 // getK8sComponentsConfigMapName reads the k8s components config map name from a VolumeMount that is backed by the k8s-version ConfigMap.
@@ -256,6 +363,22 @@ type joinTokenGetter interface {
 type dataKeyGetter interface {
 	// GetDataKey returns a key derived from Constellation's KMS.
 	GetDataKey(ctx context.Context, uuid string, length int) ([]byte, error)
+	// GetVersionedDataKey returns a version of a key derived from Constellation's KMS.
+	GetVersionedDataKey(ctx context.Context, uuid string, length int, version uint32) ([]byte, error)
+	// GetLatestDataKey returns the latest version of a key derived from Constellation's KMS, and its version.
+	GetLatestDataKey(ctx context.Context, uuid string, length int) ([]byte, uint32, error)
+	// RotateDataKey creates a new version of a key and returns the new version.
+	RotateDataKey(ctx context.Context, uuid string) (uint32, error)
+	// LatestVersion returns the latest version of a key.
+	LatestVersion(ctx context.Context, uuid string) (uint32, error)
+}
+
+// recoveryKeyEscrow interacts with an external KMS escrowing state disk recovery keys.
+type recoveryKeyEscrow interface {
+	// GetDEK returns the key with the given ID, creating it if it doesn't exist yet.
+	GetDEK(ctx context.Context, dekID string, dekSize int) ([]byte, error)
+	// PutDEK saves the given key under the given ID.
+	PutDEK(ctx context.Context, dekID string, dek []byte) error
 }
 
 type certificateAuthority interface {
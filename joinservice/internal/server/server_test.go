@@ -15,6 +15,7 @@ import (
 
 	"github.com/edgelesssys/constellation/v2/internal/attestation"
 	"github.com/edgelesssys/constellation/v2/internal/constants"
+	"github.com/edgelesssys/constellation/v2/internal/crypto"
 	"github.com/edgelesssys/constellation/v2/internal/file"
 	"github.com/edgelesssys/constellation/v2/internal/logger"
 	"github.com/edgelesssys/constellation/v2/internal/versions/components"
@@ -37,6 +38,7 @@ func TestIssueJoinTicket(t *testing.T) {
 	testCaKey := make([]byte, ed25519.SeedSize)
 	testCert := []byte{0x4, 0x5, 0x6}
 	measurementSecret := []byte{0x7, 0x8, 0x9}
+	recoveryKey := []byte{0xA, 0xB, 0xC}
 	uuid := "uuid"
 
 	pubkey, _, err := ed25519.GenerateKey(nil)
@@ -68,6 +70,9 @@ func TestIssueJoinTicket(t *testing.T) {
 		missingComponentsReferenceFile  bool
 		missingAdditionalPrincipalsFile bool
 		missingSSHHostKey               bool
+		recoveryKMS                     *stubRecoveryKMS
+		wantKeyVersion                  uint32
+		wantRecoveryKey                 []byte
 		wantErr                         bool
 	}{
 		"worker node": {
@@ -80,6 +85,67 @@ func TestIssueJoinTicket(t *testing.T) {
 			ca:         stubCA{cert: testCert, nodeName: "node"},
 			kubeClient: stubKubeClient{getComponentsVal: clusterComponents, getK8sComponentsRefFromNodeVersionCRDVal: "k8s-components-ref"},
 		},
+		"worker node with rotated state disk keys": {
+			kubeadm: stubTokenGetter{token: testJoinToken},
+			kms: stubKeyGetter{
+				dataKeys: map[string][]byte{
+					crypto.VersionedDEKID(uuid, 2):       testKey,
+					attestation.MeasurementSecretContext: measurementSecret,
+					constants.SSHCAKeySuffix:             testCaKey,
+				},
+				latestVersions: map[string]uint32{crypto.StateDiskKeyGenerationID: 2},
+			},
+			ca:             stubCA{cert: testCert, nodeName: "node"},
+			kubeClient:     stubKubeClient{getComponentsVal: clusterComponents, getK8sComponentsRefFromNodeVersionCRDVal: "k8s-components-ref"},
+			wantKeyVersion: 2,
+		},
+		"recovery key escrow": {
+			kubeadm: stubTokenGetter{token: testJoinToken},
+			kms: stubKeyGetter{dataKeys: map[string][]byte{
+				uuid:                                 testKey,
+				attestation.MeasurementSecretContext: measurementSecret,
+				constants.SSHCAKeySuffix:             testCaKey,
+			}},
+			ca:              stubCA{cert: testCert, nodeName: "node"},
+			kubeClient:      stubKubeClient{getComponentsVal: clusterComponents, getK8sComponentsRefFromNodeVersionCRDVal: "k8s-components-ref"},
+			recoveryKMS:     &stubRecoveryKMS{dek: recoveryKey},
+			wantRecoveryKey: recoveryKey,
+		},
+		"recovery key escrow fails": {
+			kubeadm: stubTokenGetter{token: testJoinToken},
+			kms: stubKeyGetter{dataKeys: map[string][]byte{
+				uuid:                                 testKey,
+				attestation.MeasurementSecretContext: measurementSecret,
+				constants.SSHCAKeySuffix:             testCaKey,
+			}},
+			ca:          stubCA{cert: testCert, nodeName: "node"},
+			kubeClient:  stubKubeClient{getComponentsVal: clusterComponents, getK8sComponentsRefFromNodeVersionCRDVal: "k8s-components-ref"},
+			recoveryKMS: &stubRecoveryKMS{getDEKErr: someErr},
+		},
+		"measurement secret escrow fails": {
+			kubeadm: stubTokenGetter{token: testJoinToken},
+			kms: stubKeyGetter{dataKeys: map[string][]byte{
+				uuid:                                 testKey,
+				attestation.MeasurementSecretContext: measurementSecret,
+				constants.SSHCAKeySuffix:             testCaKey,
+			}},
+			ca:          stubCA{cert: testCert, nodeName: "node"},
+			kubeClient:  stubKubeClient{getComponentsVal: clusterComponents, getK8sComponentsRefFromNodeVersionCRDVal: "k8s-components-ref"},
+			recoveryKMS: &stubRecoveryKMS{dek: recoveryKey, putDEKErr: someErr},
+		},
+		"key registry unavailable": {
+			kubeadm: stubTokenGetter{token: testJoinToken},
+			kms: stubKeyGetter{
+				dataKeys: map[string][]byte{
+					uuid:                                 testKey,
+					attestation.MeasurementSecretContext: measurementSecret,
+					constants.SSHCAKeySuffix:             testCaKey,
+				},
+				latestVersionErr: someErr,
+			},
+			ca:         stubCA{cert: testCert, nodeName: "node"},
+			kubeClient: stubKubeClient{getComponentsVal: clusterComponents, getK8sComponentsRefFromNodeVersionCRDVal: "k8s-components-ref"},
+		},
 		"kubeclient fails": {
 			kubeadm: stubTokenGetter{token: testJoinToken},
 			kms: stubKeyGetter{dataKeys: map[string][]byte{
@@ -236,6 +302,9 @@ func TestIssueJoinTicket(t *testing.T) {
 				log:             logger.NewTest(t),
 				fileHandler:     fh,
 			}
+			if tc.recoveryKMS != nil {
+				api.recoveryKMS = tc.recoveryKMS
+			}
 
 			var keyToSend []byte
 			if tc.missingSSHHostKey {
@@ -256,7 +325,12 @@ func TestIssueJoinTicket(t *testing.T) {
 			}
 
 			require.NoError(err)
-			assert.Equal(tc.kms.dataKeys[uuid], resp.StateDiskKey)
+			assert.Equal(testKey, resp.StateDiskKey)
+			assert.Equal(tc.wantKeyVersion, resp.StateDiskKeyVersion)
+			assert.Equal(tc.wantRecoveryKey, resp.StateDiskRecoveryKey)
+			if tc.wantRecoveryKey != nil {
+				assert.Equal(measurementSecret, tc.recoveryKMS.escrowed[crypto.StateDiskRecoveryMeasurementSecretID])
+			}
 			assert.Equal(salt, resp.MeasurementSalt)
 			assert.Equal(tc.kms.dataKeys[attestation.MeasurementSecretContext], resp.MeasurementSecret)
 			assert.Equal(tc.kubeadm.token.APIServerEndpoint, resp.ApiServerEndpoint)
@@ -276,23 +350,97 @@ func TestIssueJoinTicket(t *testing.T) {
 
 func TestIssueRejoinTicker(t *testing.T) {
 	uuid := "uuid"
+	someErr := errors.New("error")
+	measurementSecret := []byte{0x4, 0x5, 0x6}
+	keyV0 := []byte{0x1, 0x2, 0x3}
+	keyV1 := []byte{0x1, 0x2, 0x4}
+	keyV2 := []byte{0x1, 0x2, 0x5}
+	recoveryKey := []byte{0x7, 0x8, 0x9}
+	dataKeys := func() map[string][]byte {
+		return map[string][]byte{
+			uuid:                                 keyV0,
+			crypto.VersionedDEKID(uuid, 1):       keyV1,
+			crypto.VersionedDEKID(uuid, 2):       keyV2,
+			attestation.MeasurementSecretContext: measurementSecret,
+		}
+	}
 
 	testCases := map[string]struct {
-		keyGetter stubKeyGetter
-		wantErr   bool
+		keyGetter         stubKeyGetter
+		recoveryKMS       *stubRecoveryKMS
+		keyVersion        uint32
+		wantKey           []byte
+		wantLatestKey     []byte
+		wantLatestVersion uint32
+		wantRecoveryKey   []byte
+		wantErr           bool
 	}{
 		"success": {
+			keyGetter: stubKeyGetter{dataKeys: dataKeys()},
+			wantKey:   keyV0,
+		},
+		"key is up to date": {
 			keyGetter: stubKeyGetter{
-				dataKeys: map[string][]byte{
-					uuid:                                 {0x1, 0x2, 0x3},
-					attestation.MeasurementSecretContext: {0x4, 0x5, 0x6},
-				},
+				dataKeys:       dataKeys(),
+				latestVersions: map[string]uint32{uuid: 1, crypto.StateDiskKeyGenerationID: 1},
+			},
+			keyVersion: 1,
+			wantKey:    keyV1,
+		},
+		"newer key exists": {
+			keyGetter: stubKeyGetter{
+				dataKeys:       dataKeys(),
+				latestVersions: map[string]uint32{uuid: 1},
 			},
+			wantKey:           keyV0,
+			wantLatestKey:     keyV1,
+			wantLatestVersion: 1,
+		},
+		"key is rotated to generation": {
+			keyGetter: stubKeyGetter{
+				dataKeys:       dataKeys(),
+				latestVersions: map[string]uint32{uuid: 1, crypto.StateDiskKeyGenerationID: 2},
+			},
+			keyVersion:        1,
+			wantKey:           keyV1,
+			wantLatestKey:     keyV2,
+			wantLatestVersion: 2,
+		},
+		"key registry unavailable": {
+			keyGetter: stubKeyGetter{
+				dataKeys:         dataKeys(),
+				latestVersionErr: someErr,
+			},
+			wantKey: keyV0,
+		},
+		"rotation fails": {
+			keyGetter: stubKeyGetter{
+				dataKeys:         dataKeys(),
+				latestVersions:   map[string]uint32{crypto.StateDiskKeyGenerationID: 1},
+				rotateDataKeyErr: someErr,
+			},
+			wantKey: keyV0,
+		},
+		"recovery key escrow": {
+			keyGetter:       stubKeyGetter{dataKeys: dataKeys()},
+			recoveryKMS:     &stubRecoveryKMS{dek: recoveryKey},
+			wantKey:         keyV0,
+			wantRecoveryKey: recoveryKey,
+		},
+		"recovery key escrow fails": {
+			keyGetter:   stubKeyGetter{dataKeys: dataKeys()},
+			recoveryKMS: &stubRecoveryKMS{getDEKErr: someErr},
+			wantKey:     keyV0,
+		},
+		"measurement secret escrow fails": {
+			keyGetter:   stubKeyGetter{dataKeys: dataKeys()},
+			recoveryKMS: &stubRecoveryKMS{dek: recoveryKey, putDEKErr: someErr},
+			wantKey:     keyV0,
 		},
 		"failure": {
 			keyGetter: stubKeyGetter{
 				dataKeys:      make(map[string][]byte),
-				getDataKeyErr: errors.New("error"),
+				getDataKeyErr: someErr,
 			},
 			wantErr: true,
 		},
@@ -310,9 +458,13 @@ func TestIssueRejoinTicker(t *testing.T) {
 				log:             logger.NewTest(t),
 				fileHandler:     file.NewHandler(afero.NewMemMapFs()),
 			}
+			if tc.recoveryKMS != nil {
+				api.recoveryKMS = tc.recoveryKMS
+			}
 
 			req := &joinproto.IssueRejoinTicketRequest{
-				DiskUuid: uuid,
+				DiskUuid:            uuid,
+				StateDiskKeyVersion: tc.keyVersion,
 			}
 			resp, err := api.IssueRejoinTicket(t.Context(), req)
 			if tc.wantErr {
@@ -321,8 +473,14 @@ func TestIssueRejoinTicker(t *testing.T) {
 			}
 
 			require.NoError(err)
-			assert.Equal(tc.keyGetter.dataKeys[attestation.MeasurementSecretContext], resp.MeasurementSecret)
-			assert.Equal(tc.keyGetter.dataKeys[uuid], resp.StateDiskKey)
+			assert.Equal(measurementSecret, resp.MeasurementSecret)
+			assert.Equal(tc.wantKey, resp.StateDiskKey)
+			assert.Equal(tc.wantLatestKey, resp.LatestStateDiskKey)
+			assert.Equal(tc.wantLatestVersion, resp.LatestStateDiskKeyVersion)
+			assert.Equal(tc.wantRecoveryKey, resp.StateDiskRecoveryKey)
+			if tc.wantRecoveryKey != nil {
+				assert.Equal(measurementSecret, tc.recoveryKMS.escrowed[crypto.StateDiskRecoveryMeasurementSecretID])
+			}
 		})
 	}
 }
@@ -343,14 +501,64 @@ func (f stubTokenGetter) GetControlPlaneCertificatesAndKeys() (map[string][]byte
 }
 
 type stubKeyGetter struct {
-	dataKeys      map[string][]byte
-	getDataKeyErr error
+	dataKeys         map[string][]byte
+	latestVersions   map[string]uint32
+	getDataKeyErr    error
+	rotateDataKeyErr error
+	latestVersionErr error
 }
 
 func (f stubKeyGetter) GetDataKey(_ context.Context, name string, _ int) ([]byte, error) {
 	return f.dataKeys[name], f.getDataKeyErr
 }
 
+func (f stubKeyGetter) GetVersionedDataKey(_ context.Context, name string, _ int, version uint32) ([]byte, error) {
+	if version > 0 {
+		name = crypto.VersionedDEKID(name, version)
+	}
+	return f.dataKeys[name], f.getDataKeyErr
+}
+
+func (f stubKeyGetter) GetLatestDataKey(ctx context.Context, name string, length int) ([]byte, uint32, error) {
+	version := f.latestVersions[name]
+	key, err := f.GetVersionedDataKey(ctx, name, length, version)
+	return key, version, err
+}
+
+func (f stubKeyGetter) RotateDataKey(_ context.Context, name string) (uint32, error) {
+	if f.rotateDataKeyErr != nil {
+		return 0, f.rotateDataKeyErr
+	}
+	f.latestVersions[name]++
+	return f.latestVersions[name], nil
+}
+
+func (f stubKeyGetter) LatestVersion(_ context.Context, name string) (uint32, error) {
+	return f.latestVersions[name], f.latestVersionErr
+}
+
+type stubRecoveryKMS struct {
+	dek       []byte
+	getDEKErr error
+	escrowed  map[string][]byte
+	putDEKErr error
+}
+
+func (f *stubRecoveryKMS) GetDEK(_ context.Context, _ string, _ int) ([]byte, error) {
+	return f.dek, f.getDEKErr
+}
+
+func (f *stubRecoveryKMS) PutDEK(_ context.Context, dekID string, dek []byte) error {
+	if f.putDEKErr != nil {
+		return f.putDEKErr
+	}
+	if f.escrowed == nil {
+		f.escrowed = make(map[string][]byte)
+	}
+	f.escrowed[dekID] = dek
+	return nil
+}
+
 type stubCA struct {
 	cert       []byte
 	getCertErr error
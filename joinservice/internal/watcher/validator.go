@@ -48,6 +48,7 @@ func NewValidator(log *slog.Logger, variant variant.Variant, fileHandler file.Ha
 
 type cachedCerts interface {
 	SevSnpCerts() (ask *x509.Certificate, ark *x509.Certificate)
+	SevSnpCRL() *x509.RevocationList
 }
 
 // Validate calls the validators Validate method, and prevents any updates during the call.
@@ -104,6 +105,7 @@ func (u *Updatable) configWithCerts(cfg config.AttestationCfg) (config.Attestati
 			return nil, fmt.Errorf("getting cached ASK certificate: %w", err)
 		}
 		c.AMDSigningKey = config.Certificate(ask)
+		c.AMDCRL = u.cachedCRLOr(c.AMDCRL)
 		return c, nil
 	case *config.AWSSEVSNP:
 		ask, err := u.getCachedAskCert()
@@ -111,6 +113,15 @@ func (u *Updatable) configWithCerts(cfg config.AttestationCfg) (config.Attestati
 			return nil, fmt.Errorf("getting cached ASK certificate: %w", err)
 		}
 		c.AMDSigningKey = config.Certificate(ask)
+		c.AMDCRL = u.cachedCRLOr(c.AMDCRL)
+		return c, nil
+	case *config.GCPSEVSNP:
+		ask, err := u.getCachedAskCert()
+		if err != nil {
+			return nil, fmt.Errorf("getting cached ASK certificate: %w", err)
+		}
+		c.AMDSigningKey = config.Certificate(ask)
+		c.AMDCRL = u.cachedCRLOr(c.AMDCRL)
 		return c, nil
 	}
 
@@ -128,3 +139,16 @@ func (u *Updatable) getCachedAskCert() (x509.Certificate, error) {
 	}
 	return *ask, nil
 }
+
+// cachedCRLOr returns the cached AMD certificate revocation list.
+// If the config already specifies a CRL, or no CRL is cached, the configured CRL is returned.
+func (u *Updatable) cachedCRLOr(configured config.CRL) config.CRL {
+	if len(configured.Raw) > 0 || u.cachedCerts == nil {
+		return configured
+	}
+	crl := u.cachedCerts.SevSnpCRL()
+	if crl == nil {
+		return configured
+	}
+	return config.CRL(*crl)
+}
@@ -104,12 +104,92 @@ func TestNewUpdateableValidator(t *testing.T) {
 type stubSnpCerts struct {
 	ask *x509.Certificate
 	ark *x509.Certificate
+	crl *x509.RevocationList
 }
 
 func (s *stubSnpCerts) SevSnpCerts() (ask *x509.Certificate, ark *x509.Certificate) {
 	return s.ask, s.ark
 }
 
+func (s *stubSnpCerts) SevSnpCRL() *x509.RevocationList {
+	return s.crl
+}
+
+func TestConfigWithCerts(t *testing.T) {
+	ask := &x509.Certificate{Raw: []byte("ask")}
+	cachedCRL := &x509.RevocationList{Raw: []byte("cached")}
+	configuredCRL := config.CRL{Raw: []byte("configured")}
+
+	testCases := map[string]struct {
+		config   config.AttestationCfg
+		snpCerts *stubSnpCerts
+		wantCRL  []byte
+		wantErr  bool
+	}{
+		"azure": {
+			config:   config.DefaultForAzureSEVSNP(),
+			snpCerts: &stubSnpCerts{ask: ask, crl: cachedCRL},
+			wantCRL:  cachedCRL.Raw,
+		},
+		"aws": {
+			config:   config.DefaultForAWSSEVSNP(),
+			snpCerts: &stubSnpCerts{ask: ask, crl: cachedCRL},
+			wantCRL:  cachedCRL.Raw,
+		},
+		"gcp": {
+			config:   config.DefaultForGCPSEVSNP(),
+			snpCerts: &stubSnpCerts{ask: ask, crl: cachedCRL},
+			wantCRL:  cachedCRL.Raw,
+		},
+		"no cached CRL": {
+			config:   config.DefaultForAWSSEVSNP(),
+			snpCerts: &stubSnpCerts{ask: ask},
+		},
+		"configured CRL takes precedence": {
+			config: func() config.AttestationCfg {
+				cfg := config.DefaultForAWSSEVSNP()
+				cfg.AMDCRL = configuredCRL
+				return cfg
+			}(),
+			snpCerts: &stubSnpCerts{ask: ask, crl: cachedCRL},
+			wantCRL:  configuredCRL.Raw,
+		},
+		"no cached ASK": {
+			config:   config.DefaultForGCPSEVSNP(),
+			snpCerts: &stubSnpCerts{crl: cachedCRL},
+			wantErr:  true,
+		},
+	}
+
+	for name, tc := range testCases {
+		t.Run(name, func(t *testing.T) {
+			assert := assert.New(t)
+			require := require.New(t)
+
+			u := &Updatable{log: logger.NewTest(t), cachedCerts: tc.snpCerts}
+			cfg, err := u.configWithCerts(tc.config)
+			if tc.wantErr {
+				assert.Error(err)
+				return
+			}
+			require.NoError(err)
+
+			var signingKey config.Certificate
+			var crl config.CRL
+			switch c := cfg.(type) {
+			case *config.AzureSEVSNP:
+				signingKey, crl = c.AMDSigningKey, c.AMDCRL
+			case *config.AWSSEVSNP:
+				signingKey, crl = c.AMDSigningKey, c.AMDCRL
+			case *config.GCPSEVSNP:
+				signingKey, crl = c.AMDSigningKey, c.AMDCRL
+			}
+			assert.Equal(ask.Raw, signingKey.Raw)
+			assert.Equal(tc.wantCRL, crl.Raw)
+		})
+	}
+}
+
 func TestUpdate(t *testing.T) {
 	assert := assert.New(t)
 	require := require.New(t)
@@ -116,6 +116,8 @@ type IssueJoinTicketResponse struct {
 	KubernetesComponents     []*components.Component  `protobuf:"bytes,10,rep,name=kubernetes_components,json=kubernetesComponents,proto3" json:"kubernetes_components,omitempty"`
 	AuthorizedCaPublicKey    []byte                   `protobuf:"bytes,11,opt,name=authorized_ca_public_key,json=authorizedCaPublicKey,proto3" json:"authorized_ca_public_key,omitempty"`
 	HostCertificate          []byte                   `protobuf:"bytes,12,opt,name=host_certificate,json=hostCertificate,proto3" json:"host_certificate,omitempty"`
+	StateDiskKeyVersion      uint32                   `protobuf:"varint,13,opt,name=state_disk_key_version,json=stateDiskKeyVersion,proto3" json:"state_disk_key_version,omitempty"`
+	StateDiskRecoveryKey     []byte                   `protobuf:"bytes,14,opt,name=state_disk_recovery_key,json=stateDiskRecoveryKey,proto3" json:"state_disk_recovery_key,omitempty"`
 	unknownFields            protoimpl.UnknownFields
 	sizeCache                protoimpl.SizeCache
 }
@@ -234,6 +236,20 @@ func (x *IssueJoinTicketResponse) GetHostCertificate() []byte {
 	return nil
 }
 
+func (x *IssueJoinTicketResponse) GetStateDiskKeyVersion() uint32 {
+	if x != nil {
+		return x.StateDiskKeyVersion
+	}
+	return 0
+}
+
+func (x *IssueJoinTicketResponse) GetStateDiskRecoveryKey() []byte {
+	if x != nil {
+		return x.StateDiskRecoveryKey
+	}
+	return nil
+}
+
 type ControlPlaneCertOrKey struct {
 	state         protoimpl.MessageState `protogen:"open.v1"`
 	Name          string                 `protobuf:"bytes,1,opt,name=name,proto3" json:"name,omitempty"`
@@ -287,10 +303,11 @@ func (x *ControlPlaneCertOrKey) GetData() []byte {
 }
 
 type IssueRejoinTicketRequest struct {
-	state         protoimpl.MessageState `protogen:"open.v1"`
-	DiskUuid      string                 `protobuf:"bytes,1,opt,name=disk_uuid,json=diskUuid,proto3" json:"disk_uuid,omitempty"`
-	unknownFields protoimpl.UnknownFields
-	sizeCache     protoimpl.SizeCache
+	state               protoimpl.MessageState `protogen:"open.v1"`
+	DiskUuid            string                 `protobuf:"bytes,1,opt,name=disk_uuid,json=diskUuid,proto3" json:"disk_uuid,omitempty"`
+	StateDiskKeyVersion uint32                 `protobuf:"varint,2,opt,name=state_disk_key_version,json=stateDiskKeyVersion,proto3" json:"state_disk_key_version,omitempty"`
+	unknownFields       protoimpl.UnknownFields
+	sizeCache           protoimpl.SizeCache
 }
 
 func (x *IssueRejoinTicketRequest) Reset() {
@@ -330,12 +347,22 @@ func (x *IssueRejoinTicketRequest) GetDiskUuid() string {
 	return ""
 }
 
+func (x *IssueRejoinTicketRequest) GetStateDiskKeyVersion() uint32 {
+	if x != nil {
+		return x.StateDiskKeyVersion
+	}
+	return 0
+}
+
 type IssueRejoinTicketResponse struct {
-	state             protoimpl.MessageState `protogen:"open.v1"`
-	StateDiskKey      []byte                 `protobuf:"bytes,1,opt,name=state_disk_key,json=stateDiskKey,proto3" json:"state_disk_key,omitempty"`
-	MeasurementSecret []byte                 `protobuf:"bytes,2,opt,name=measurement_secret,json=measurementSecret,proto3" json:"measurement_secret,omitempty"`
-	unknownFields     protoimpl.UnknownFields
-	sizeCache         protoimpl.SizeCache
+	state                     protoimpl.MessageState `protogen:"open.v1"`
+	StateDiskKey              []byte                 `protobuf:"bytes,1,opt,name=state_disk_key,json=stateDiskKey,proto3" json:"state_disk_key,omitempty"`
+	MeasurementSecret         []byte                 `protobuf:"bytes,2,opt,name=measurement_secret,json=measurementSecret,proto3" json:"measurement_secret,omitempty"`
+	LatestStateDiskKey        []byte                 `protobuf:"bytes,3,opt,name=latest_state_disk_key,json=latestStateDiskKey,proto3" json:"latest_state_disk_key,omitempty"`
+	LatestStateDiskKeyVersion uint32                 `protobuf:"varint,4,opt,name=latest_state_disk_key_version,json=latestStateDiskKeyVersion,proto3" json:"latest_state_disk_key_version,omitempty"`
+	StateDiskRecoveryKey      []byte                 `protobuf:"bytes,5,opt,name=state_disk_recovery_key,json=stateDiskRecoveryKey,proto3" json:"state_disk_recovery_key,omitempty"`
+	unknownFields             protoimpl.UnknownFields
+	sizeCache                 protoimpl.SizeCache
 }
 
 func (x *IssueRejoinTicketResponse) Reset() {
@@ -382,6 +409,27 @@ func (x *IssueRejoinTicketResponse) GetMeasurementSecret() []byte {
 	return nil
 }
 
+func (x *IssueRejoinTicketResponse) GetLatestStateDiskKey() []byte {
+	if x != nil {
+		return x.LatestStateDiskKey
+	}
+	return nil
+}
+
+func (x *IssueRejoinTicketResponse) GetLatestStateDiskKeyVersion() uint32 {
+	if x != nil {
+		return x.LatestStateDiskKeyVersion
+	}
+	return 0
+}
+
+func (x *IssueRejoinTicketResponse) GetStateDiskRecoveryKey() []byte {
+	if x != nil {
+		return x.StateDiskRecoveryKey
+	}
+	return nil
+}
+
 var File_joinservice_joinproto_join_proto protoreflect.FileDescriptor
 
 const file_joinservice_joinproto_join_proto_rawDesc = "" +
@@ -392,7 +440,7 @@ const file_joinservice_joinproto_join_proto_rawDesc = "" +
 	"\x13certificate_request\x18\x02 \x01(\fR\x12certificateRequest\x12(\n" +
 	"\x10is_control_plane\x18\x03 \x01(\bR\x0eisControlPlane\x12&\n" +
 	"\x0fhost_public_key\x18\x04 \x01(\fR\rhostPublicKey\x12>\n" +
-	"\x1bhost_certificate_principals\x18\x05 \x03(\tR\x19hostCertificatePrincipals\"\xf2\x04\n" +
+	"\x1bhost_certificate_principals\x18\x05 \x03(\tR\x19hostCertificatePrincipals\"\xde\x05\n" +
 	"\x17IssueJoinTicketResponse\x12$\n" +
 	"\x0estate_disk_key\x18\x01 \x01(\fR\fstateDiskKey\x12)\n" +
 	"\x10measurement_salt\x18\x02 \x01(\fR\x0fmeasurementSalt\x12-\n" +
@@ -406,15 +454,21 @@ const file_joinservice_joinproto_join_proto_rawDesc = "" +
 	"\x15kubernetes_components\x18\n" +
 	" \x03(\v2\x15.components.ComponentR\x14kubernetesComponents\x127\n" +
 	"\x18authorized_ca_public_key\x18\v \x01(\fR\x15authorizedCaPublicKey\x12)\n" +
-	"\x10host_certificate\x18\f \x01(\fR\x0fhostCertificate\"C\n" +
+	"\x10host_certificate\x18\f \x01(\fR\x0fhostCertificate\x123\n" +
+	"\x16state_disk_key_version\x18\r \x01(\rR\x13stateDiskKeyVersion\x125\n" +
+	"\x17state_disk_recovery_key\x18\x0e \x01(\fR\x14stateDiskRecoveryKey\"C\n" +
 	"\x19control_plane_cert_or_key\x12\x12\n" +
 	"\x04name\x18\x01 \x01(\tR\x04name\x12\x12\n" +
-	"\x04data\x18\x02 \x01(\fR\x04data\"7\n" +
+	"\x04data\x18\x02 \x01(\fR\x04data\"l\n" +
 	"\x18IssueRejoinTicketRequest\x12\x1b\n" +
-	"\tdisk_uuid\x18\x01 \x01(\tR\bdiskUuid\"p\n" +
+	"\tdisk_uuid\x18\x01 \x01(\tR\bdiskUuid\x123\n" +
+	"\x16state_disk_key_version\x18\x02 \x01(\rR\x13stateDiskKeyVersion\"\x9c\x02\n" +
 	"\x19IssueRejoinTicketResponse\x12$\n" +
 	"\x0estate_disk_key\x18\x01 \x01(\fR\fstateDiskKey\x12-\n" +
-	"\x12measurement_secret\x18\x02 \x01(\fR\x11measurementSecret2\xab\x01\n" +
+	"\x12measurement_secret\x18\x02 \x01(\fR\x11measurementSecret\x121\n" +
+	"\x15latest_state_disk_key\x18\x03 \x01(\fR\x12latestStateDiskKey\x12@\n" +
+	"\x1dlatest_state_disk_key_version\x18\x04 \x01(\rR\x19latestStateDiskKeyVersion\x125\n" +
+	"\x17state_disk_recovery_key\x18\x05 \x01(\fR\x14stateDiskRecoveryKey2\xab\x01\n" +
 	"\x03API\x12N\n" +
 	"\x0fIssueJoinTicket\x12\x1c.join.IssueJoinTicketRequest\x1a\x1d.join.IssueJoinTicketResponse\x12T\n" +
 	"\x11IssueRejoinTicket\x12\x1e.join.IssueRejoinTicketRequest\x1a\x1f.join.IssueRejoinTicketResponseB?Z=github.com/edgelesssys/constellation/v2/joinservice/joinprotob\x06proto3"
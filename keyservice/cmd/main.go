@@ -11,6 +11,7 @@ import (
 	"errors"
 	"flag"
 	"fmt"
+	"io/fs"
 	"log/slog"
 	"os"
 	"path/filepath"
@@ -23,8 +24,11 @@ import (
 	"github.com/edgelesssys/constellation/v2/internal/kms/setup"
 	"github.com/edgelesssys/constellation/v2/internal/kms/uri"
 	"github.com/edgelesssys/constellation/v2/internal/logger"
+	"github.com/edgelesssys/constellation/v2/keyservice/internal/registry"
 	"github.com/edgelesssys/constellation/v2/keyservice/internal/server"
 	"github.com/spf13/afero"
+	"k8s.io/client-go/kubernetes"
+	"k8s.io/client-go/rest"
 )
 
 func main() {
@@ -61,6 +65,29 @@ func main() {
 	}
 	masterSecret := uri.MasterSecret{Key: masterKey, Salt: salt}
 
+	// read rotated master secrets, numbered by their generation
+	for generation := 1; ; generation++ {
+		rotatedKey, err := file.Read(fmt.Sprintf("%s-%d", *masterSecretPath, generation))
+		if errors.Is(err, fs.ErrNotExist) {
+			break
+		}
+		if err != nil {
+			log.With(slog.Any("error", err)).Error(fmt.Sprintf("Failed to read master secret generation %d", generation))
+			os.Exit(1)
+		}
+		rotatedSalt, err := file.Read(fmt.Sprintf("%s-%d", *saltPath, generation))
+		if err != nil {
+			log.With(slog.Any("error", err)).Error(fmt.Sprintf("Failed to read salt generation %d", generation))
+			os.Exit(1)
+		}
+		if len(rotatedKey) < crypto.MasterSecretLengthMin || len(rotatedSalt) < crypto.RNGLengthDefault {
+			log.With(slog.Any("error", errors.New("invalid key length"))).Error(fmt.Sprintf("Master secret generation %d is too short", generation))
+			os.Exit(1)
+		}
+		masterSecret.Rotations = append(masterSecret.Rotations, uri.MasterSecretRotation{Key: rotatedKey, Salt: rotatedSalt})
+	}
+	log.Info(fmt.Sprintf("Using master secret generation %d", masterSecret.Generation()))
+
 	// set up Key Management Service
 	ctx, cancel := context.WithTimeout(context.Background(), 1*time.Minute)
 	defer cancel()
@@ -71,7 +98,30 @@ func main() {
 	}
 	defer conKMS.Close()
 
-	if err := server.New(log.WithGroup("keyService"), conKMS).Run(*port); err != nil {
+	// set up registry of data key versions
+	kubeConfig, err := rest.InClusterConfig()
+	if err != nil {
+		log.With(slog.Any("error", err)).Error("Failed to create in-cluster config")
+		os.Exit(1)
+	}
+	kubeClient, err := kubernetes.NewForConfig(kubeConfig)
+	if err != nil {
+		log.With(slog.Any("error", err)).Error("Failed to create Kubernetes client")
+		os.Exit(1)
+	}
+	keyRegistry := registry.New(kubeClient, constants.ConstellationNamespace, constants.KeyVersionsConfigMapName)
+
+	// After a rotation of the master secret, state disks are re-keyed with keys of the new generation when their nodes rejoin.
+	stateDiskGeneration, err := keyRegistry.Advance(ctx, crypto.StateDiskKeyGenerationID, crypto.FirstKeyVersion(masterSecret.Generation()))
+	if err != nil {
+		log.With(slog.Any("error", err)).Error("Failed to advance state disk key generation")
+		os.Exit(1)
+	}
+	log.Info(fmt.Sprintf("State disk key generation is %d", stateDiskGeneration))
+
+	tokenReviewer := kubeClient.AuthenticationV1().TokenReviews()
+
+	if err := server.New(log.WithGroup("keyService"), conKMS, keyRegistry, tokenReviewer, constants.ConstellationNamespace, masterSecret.Generation()).Run(*port); err != nil {
 		log.With(slog.Any("error", err)).Error("Failed to run key-service server")
 		os.Exit(1)
 	}
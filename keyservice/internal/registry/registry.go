@@ -0,0 +1,283 @@
+/*
+Copyright (c) Edgeless Systems GmbH
+
+SPDX-License-Identifier: BUSL-1.1
+*/
+
+/*
+Package registry keeps track of data keys and their versions.
+
+Every rotated key is stored in its own ConfigMap, so all instances of the key service share it,
+and the size of a single object doesn't grow with the number of keys.
+Keys that were never rotated only have version 0 and aren't stored.
+The registry only holds key IDs and version numbers, key material is never stored.
+*/
+package registry
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"maps"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+
+	corev1 "k8s.io/api/core/v1"
+	k8serrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes"
+	"k8s.io/client-go/util/retry"
+)
+
+const (
+	// dataKey is the key of the registered key in the ConfigMap's data.
+	dataKey = "key.json"
+	// registryLabel is the label of all ConfigMaps of a registry. Its value is the name of the registry.
+	registryLabel = "constellation.edgeless.systems/key-registry"
+)
+
+// ErrVersionInUse is returned when deleting the latest version of a key.
+// Consumers are migrated to the latest version, so it is always in use.
+var ErrVersionInUse = errors.New("the latest version of a key is in use")
+
+// Key is a data key known to the registry.
+type Key struct {
+	// ID is the ID of the data key.
+	ID string `json:"id"`
+	// LatestVersion is the latest version of the key.
+	LatestVersion uint32 `json:"latestVersion"`
+	// OldestVersion is the oldest version of the key that wasn't deleted.
+	// All versions from OldestVersion up to LatestVersion are valid.
+	OldestVersion uint32 `json:"oldestVersion,omitempty"`
+}
+
+// cacheTTL is the time after which cached keys are read from their ConfigMap again.
+// Rotations and deletions by other instances are picked up after at most cacheTTL.
+const cacheTTL = time.Minute
+
+// cachedKey is a key read from its ConfigMap.
+type cachedKey struct {
+	key    Key
+	readAt time.Time
+}
+
+// Registry stores the versions of data keys in one ConfigMap per key.
+// The keys are cached in memory, so a ConfigMap is only written when its key is rotated or old versions are deleted.
+type Registry struct {
+	client    kubernetes.Interface
+	namespace string
+	name      string
+	now       func() time.Time
+
+	mux  sync.Mutex
+	keys map[string]cachedKey
+}
+
+// New creates a new Registry stored in ConfigMaps in the given namespace.
+// The names of the ConfigMaps start with the given name, which also identifies the registry.
+func New(client kubernetes.Interface, namespace, name string) *Registry {
+	return &Registry{
+		client:    client,
+		namespace: namespace,
+		name:      name,
+		now:       time.Now,
+		keys:      map[string]cachedKey{},
+	}
+}
+
+// Get returns the versions of a key. Keys that are not known have version 0 only.
+// Known keys are served from memory. The ConfigMap of the key is read again if the cache is older than cacheTTL,
+// or if it doesn't hold the given version of the key yet, e.g., because another instance rotated the key.
+func (r *Registry) Get(ctx context.Context, keyID string, version uint32) (Key, error) {
+	r.mux.Lock()
+	defer r.mux.Unlock()
+
+	if cached, ok := r.keys[keyID]; ok && cached.key.LatestVersion >= version && r.now().Sub(cached.readAt) < cacheTTL {
+		return cached.key, nil
+	}
+	readAt := r.now()
+	key, _, err := r.read(ctx, keyID)
+	if err != nil {
+		return Key{}, err
+	}
+	r.keys[keyID] = cachedKey{key: key, readAt: readAt}
+	return key, nil
+}
+
+// Rotate increments the latest version of a key and returns the new version.
+// The new version is at least minVersion, which skips the versions of older master secret generations.
+// Keys that are not known yet are stored with version 1, or minVersion if it is larger.
+func (r *Registry) Rotate(ctx context.Context, keyID string, minVersion uint32) (uint32, error) {
+	r.mux.Lock()
+	defer r.mux.Unlock()
+
+	var version uint32
+	err := r.update(ctx, keyID, func(key *Key) (bool, error) {
+		key.LatestVersion = max(key.LatestVersion+1, minVersion)
+		version = key.LatestVersion
+		return true, nil
+	})
+	return version, err
+}
+
+// Advance rotates a key to the given version, unless its latest version is already at least that version.
+// It returns the latest version of the key.
+func (r *Registry) Advance(ctx context.Context, keyID string, version uint32) (uint32, error) {
+	r.mux.Lock()
+	defer r.mux.Unlock()
+
+	var latest uint32
+	err := r.update(ctx, keyID, func(key *Key) (bool, error) {
+		latest = key.LatestVersion
+		if key.LatestVersion >= version {
+			return false, nil
+		}
+		key.LatestVersion = version
+		latest = version
+		return true, nil
+	})
+	return latest, err
+}
+
+// Delete deletes all versions of a key older than the given version.
+// Deleted versions can't be requested anymore. The latest version can't be deleted.
+func (r *Registry) Delete(ctx context.Context, keyID string, version uint32) error {
+	r.mux.Lock()
+	defer r.mux.Unlock()
+
+	return r.update(ctx, keyID, func(key *Key) (bool, error) {
+		if version > key.LatestVersion {
+			return false, fmt.Errorf("deleting version %d: %w", key.LatestVersion, ErrVersionInUse)
+		}
+		if version <= key.OldestVersion {
+			return false, nil
+		}
+		key.OldestVersion = version
+		return true, nil
+	})
+}
+
+// List returns all keys that were rotated, sorted by ID.
+func (r *Registry) List(ctx context.Context) ([]Key, error) {
+	r.mux.Lock()
+	defer r.mux.Unlock()
+
+	readAt := r.now()
+	configMaps, err := r.client.CoreV1().ConfigMaps(r.namespace).List(ctx, metav1.ListOptions{
+		LabelSelector: fmt.Sprintf("%s=%s", registryLabel, r.name),
+	})
+	if err != nil {
+		return nil, fmt.Errorf("listing key registry: %w", err)
+	}
+
+	keys := map[string]Key{}
+	for _, cm := range configMaps.Items {
+		key, err := decodeKey(&cm)
+		if err != nil {
+			return nil, err
+		}
+		keys[key.ID] = key
+	}
+	list := make([]Key, 0, len(keys))
+	for _, id := range slices.Sorted(maps.Keys(keys)) {
+		list = append(list, keys[id])
+		r.keys[id] = cachedKey{key: keys[id], readAt: readAt}
+	}
+	return list, nil
+}
+
+// read returns a key stored in its ConfigMap, and the ConfigMap itself if it exists.
+func (r *Registry) read(ctx context.Context, keyID string) (Key, *corev1.ConfigMap, error) {
+	cm, err := r.client.CoreV1().ConfigMaps(r.namespace).Get(ctx, r.configMapName(keyID), metav1.GetOptions{})
+	if k8serrors.IsNotFound(err) {
+		return Key{ID: keyID}, nil, nil
+	}
+	if err != nil {
+		return Key{}, nil, fmt.Errorf("getting key registry: %w", err)
+	}
+
+	key, err := decodeKey(cm)
+	if err != nil {
+		return Key{}, nil, err
+	}
+	if key.ID != keyID {
+		return Key{}, nil, fmt.Errorf("key registry %q holds key %q instead of %q", cm.Name, key.ID, keyID)
+	}
+	return key, cm, nil
+}
+
+// update applies modify to a stored key and caches the result.
+// The ConfigMap is only written if modify reports a change.
+// Concurrent updates by other instances are detected by the API server, in which case the update is retried.
+func (r *Registry) update(ctx context.Context, keyID string, modify func(*Key) (bool, error)) error {
+	configMaps := r.client.CoreV1().ConfigMaps(r.namespace)
+
+	readAt := r.now()
+	var key Key
+	err := retry.OnError(retry.DefaultRetry, isConflict, func() error {
+		var cm *corev1.ConfigMap
+		var err error
+		key, cm, err = r.read(ctx, keyID)
+		if err != nil {
+			return err
+		}
+		changed, err := modify(&key)
+		if err != nil || !changed {
+			return err
+		}
+		data, err := json.Marshal(key)
+		if err != nil {
+			return err
+		}
+
+		if cm == nil {
+			cm = &corev1.ConfigMap{
+				ObjectMeta: metav1.ObjectMeta{
+					Name:      r.configMapName(keyID),
+					Namespace: r.namespace,
+					Labels:    map[string]string{registryLabel: r.name},
+				},
+				Data: map[string]string{dataKey: string(data)},
+			}
+			_, err = configMaps.Create(ctx, cm, metav1.CreateOptions{})
+			return err
+		}
+		if cm.Data == nil {
+			cm.Data = map[string]string{}
+		}
+		cm.Data[dataKey] = string(data)
+		_, err = configMaps.Update(ctx, cm, metav1.UpdateOptions{})
+		return err
+	})
+	if err != nil {
+		return fmt.Errorf("updating key registry: %w", err)
+	}
+	r.keys[keyID] = cachedKey{key: key, readAt: readAt}
+	return nil
+}
+
+// configMapName returns the name of the ConfigMap storing a key.
+// Key IDs may contain characters that aren't allowed in names, so the name is derived from a hash of the ID.
+func (r *Registry) configMapName(keyID string) string {
+	hash := sha256.Sum256([]byte(keyID))
+	return r.name + "-" + hex.EncodeToString(hash[:])
+}
+
+// decodeKey decodes the key stored in a ConfigMap.
+func decodeKey(cm *corev1.ConfigMap) (Key, error) {
+	var key Key
+	if err := json.NewDecoder(strings.NewReader(cm.Data[dataKey])).Decode(&key); err != nil {
+		return Key{}, fmt.Errorf("decoding key registry %q: %w", cm.Name, err)
+	}
+	return key, nil
+}
+
+// isConflict reports whether another instance modified or created the ConfigMap concurrently.
+func isConflict(err error) bool {
+	return k8serrors.IsConflict(err) || k8serrors.IsAlreadyExists(err)
+}
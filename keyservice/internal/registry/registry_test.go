@@ -0,0 +1,275 @@
+/*
+Copyright (c) Edgeless Systems GmbH
+
+SPDX-License-Identifier: BUSL-1.1
+*/
+
+package registry
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.uber.org/goleak"
+	corev1 "k8s.io/api/core/v1"
+	k8serrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/client-go/kubernetes/fake"
+	k8stesting "k8s.io/client-go/testing"
+)
+
+func TestMain(m *testing.M) {
+	goleak.VerifyTestMain(m, goleak.IgnoreAnyFunction("github.com/bazelbuild/rules_go/go/tools/bzltestutil.RegisterTimeoutHandler.func1"))
+}
+
+func TestRegistry(t *testing.T) {
+	assert := assert.New(t)
+	require := require.New(t)
+	ctx := t.Context()
+
+	client := fake.NewClientset()
+	r := New(client, "kube-system", "key-versions")
+
+	keys, err := r.List(ctx)
+	require.NoError(err)
+	assert.Empty(keys)
+
+	// Unknown keys only have version 0 and aren't stored.
+	key, err := r.Get(ctx, "volume01", 0)
+	require.NoError(err)
+	assert.Equal(Key{ID: "volume01"}, key)
+	keys, err = r.List(ctx)
+	require.NoError(err)
+	assert.Empty(keys)
+
+	version, err := r.Rotate(ctx, "volume01", 0)
+	require.NoError(err)
+	assert.Equal(uint32(1), version)
+	version, err = r.Rotate(ctx, "volume01", 0)
+	require.NoError(err)
+	assert.Equal(uint32(2), version)
+	key, err = r.Get(ctx, "volume01", 0)
+	require.NoError(err)
+	assert.Equal(Key{ID: "volume01", LatestVersion: 2}, key)
+
+	version, err = r.Rotate(ctx, "measurementSecret", 0)
+	require.NoError(err)
+	assert.Equal(uint32(1), version)
+
+	// Another instance sees the same registry.
+	keys, err = New(client, "kube-system", "key-versions").List(ctx)
+	require.NoError(err)
+	assert.Equal([]Key{{ID: "measurementSecret", LatestVersion: 1}, {ID: "volume01", LatestVersion: 2}}, keys)
+
+	// Every key is stored in its own ConfigMap.
+	configMaps, err := client.CoreV1().ConfigMaps("kube-system").List(ctx, metav1.ListOptions{})
+	require.NoError(err)
+	assert.Len(configMaps.Items, 2)
+
+	// Old versions can be deleted,
+	require.NoError(r.Delete(ctx, "volume01", 2))
+	key, err = r.Get(ctx, "volume01", 0)
+	require.NoError(err)
+	assert.Equal(Key{ID: "volume01", LatestVersion: 2, OldestVersion: 2}, key)
+	// and deleting them again is a no-op.
+	require.NoError(r.Delete(ctx, "volume01", 1))
+	key, err = r.Get(ctx, "volume01", 0)
+	require.NoError(err)
+	assert.Equal(uint32(2), key.OldestVersion)
+
+	// The latest version is in use and can't be deleted.
+	assert.ErrorIs(r.Delete(ctx, "volume01", 3), ErrVersionInUse)
+	assert.ErrorIs(r.Delete(ctx, "volume02", 1), ErrVersionInUse)
+	require.NoError(r.Delete(ctx, "volume02", 0))
+	keys, err = r.List(ctx)
+	require.NoError(err)
+	assert.Equal([]Key{{ID: "measurementSecret", LatestVersion: 1}, {ID: "volume01", LatestVersion: 2, OldestVersion: 2}}, keys)
+
+	// Rotating a key keeps its deleted versions deleted.
+	version, err = r.Rotate(ctx, "volume01", 0)
+	require.NoError(err)
+	assert.Equal(uint32(3), version)
+	key, err = r.Get(ctx, "volume01", 3)
+	require.NoError(err)
+	assert.Equal(Key{ID: "volume01", LatestVersion: 3, OldestVersion: 2}, key)
+}
+
+func TestRegistryMinVersion(t *testing.T) {
+	assert := assert.New(t)
+	require := require.New(t)
+	ctx := t.Context()
+
+	r := New(fake.NewClientset(), "kube-system", "key-versions")
+
+	// Rotations skip the versions below the minimum version.
+	version, err := r.Rotate(ctx, "volume01", 0)
+	require.NoError(err)
+	assert.Equal(uint32(1), version)
+	version, err = r.Rotate(ctx, "volume01", 1<<24)
+	require.NoError(err)
+	assert.Equal(uint32(1<<24), version)
+	version, err = r.Rotate(ctx, "volume01", 1<<24)
+	require.NoError(err)
+	assert.Equal(uint32(1<<24+1), version)
+
+	// Advancing a key only rotates it if it is older than the given version.
+	version, err = r.Advance(ctx, "volume01", 1<<24)
+	require.NoError(err)
+	assert.Equal(uint32(1<<24+1), version)
+	version, err = r.Advance(ctx, "volume02", 1<<24)
+	require.NoError(err)
+	assert.Equal(uint32(1<<24), version)
+	key, err := r.Get(ctx, "volume02", 0)
+	require.NoError(err)
+	assert.Equal(Key{ID: "volume02", LatestVersion: 1 << 24}, key)
+}
+
+func TestRegistryCache(t *testing.T) {
+	assert := assert.New(t)
+	require := require.New(t)
+	ctx := t.Context()
+
+	client := fake.NewClientset()
+	var gets, writes int
+	client.PrependReactor("get", "configmaps", func(k8stesting.Action) (bool, runtime.Object, error) {
+		gets++
+		return false, nil, nil
+	})
+	client.PrependReactor("*", "configmaps", func(action k8stesting.Action) (bool, runtime.Object, error) {
+		if action.GetVerb() == "create" || action.GetVerb() == "update" {
+			writes++
+		}
+		return false, nil, nil
+	})
+
+	now := time.Now()
+	r := New(client, "kube-system", "key-versions")
+	r.now = func() time.Time { return now }
+
+	// The first request reads the registry, but doesn't write it.
+	key, err := r.Get(ctx, "volume01", 0)
+	require.NoError(err)
+	assert.Zero(key.LatestVersion)
+	assert.Equal(1, gets)
+	assert.Zero(writes)
+
+	// Known keys are served from memory.
+	gets = 0
+	for range 10 {
+		key, err = r.Get(ctx, "volume01", 0)
+		require.NoError(err)
+		assert.Zero(key.LatestVersion)
+	}
+	assert.Zero(gets)
+	assert.Zero(writes)
+
+	// Another instance rotates the key.
+	other := New(client, "kube-system", "key-versions")
+	version, err := other.Rotate(ctx, "volume01", 0)
+	require.NoError(err)
+	assert.Equal(uint32(1), version)
+	assert.Equal(1, writes)
+	gets = 0
+
+	// The rotation isn't seen until the cache expires,
+	key, err = r.Get(ctx, "volume01", 0)
+	require.NoError(err)
+	assert.Zero(key.LatestVersion)
+	assert.Zero(gets)
+
+	// unless the new version is requested.
+	key, err = r.Get(ctx, "volume01", 1)
+	require.NoError(err)
+	assert.Equal(uint32(1), key.LatestVersion)
+	assert.Equal(1, gets)
+
+	// Requesting a version that doesn't exist reads the registry, but doesn't write it.
+	key, err = r.Get(ctx, "volume01", 2)
+	require.NoError(err)
+	assert.Equal(uint32(1), key.LatestVersion)
+	assert.Equal(2, gets)
+
+	// Expired caches are read again.
+	require.NoError(other.Delete(ctx, "volume01", 1))
+	gets = 0
+	now = now.Add(cacheTTL)
+	key, err = r.Get(ctx, "volume01", 0)
+	require.NoError(err)
+	assert.Equal(Key{ID: "volume01", LatestVersion: 1, OldestVersion: 1}, key)
+	assert.Equal(1, gets)
+	assert.Equal(2, writes)
+}
+
+func TestRegistryConflict(t *testing.T) {
+	assert := assert.New(t)
+	require := require.New(t)
+
+	r := New(fake.NewClientset(), "kube-system", "key-versions")
+	_, err := r.Rotate(t.Context(), "volume01", 0)
+	require.NoError(err)
+
+	client := r.client.(*fake.Clientset)
+	conflicts := 2
+	client.PrependReactor("update", "configmaps", func(k8stesting.Action) (bool, runtime.Object, error) {
+		if conflicts == 0 {
+			return false, nil, nil
+		}
+		conflicts--
+		return true, nil, k8serrors.NewConflict(schema.GroupResource{Resource: "configmaps"}, r.configMapName("volume01"), errors.New("modified"))
+	})
+
+	version, err := r.Rotate(t.Context(), "volume01", 0)
+	require.NoError(err)
+	assert.Equal(uint32(2), version)
+	assert.Zero(conflicts)
+}
+
+func TestRegistryErrors(t *testing.T) {
+	testCases := map[string]struct {
+		objects  []runtime.Object
+		reactors func(*fake.Clientset)
+	}{
+		"invalid registry data": {
+			objects: []runtime.Object{&corev1.ConfigMap{
+				ObjectMeta: metav1.ObjectMeta{
+					Name:      New(nil, "kube-system", "key-versions").configMapName("volume01"),
+					Namespace: "kube-system",
+					Labels:    map[string]string{registryLabel: "key-versions"},
+				},
+				Data: map[string]string{dataKey: "not json"},
+			}},
+		},
+		"API server fails": {
+			reactors: func(c *fake.Clientset) {
+				c.PrependReactor("*", "configmaps", func(k8stesting.Action) (bool, runtime.Object, error) {
+					return true, nil, errors.New("forbidden")
+				})
+			},
+		},
+	}
+
+	for name, tc := range testCases {
+		t.Run(name, func(t *testing.T) {
+			assert := assert.New(t)
+
+			client := fake.NewClientset(tc.objects...)
+			if tc.reactors != nil {
+				tc.reactors(client)
+			}
+			r := New(client, "kube-system", "key-versions")
+
+			_, err := r.Get(t.Context(), "volume01", 0)
+			assert.Error(err)
+			_, err = r.Rotate(t.Context(), "volume01", 0)
+			assert.Error(err)
+			assert.Error(r.Delete(t.Context(), "volume01", 0))
+			_, err = r.List(t.Context())
+			assert.Error(err)
+		})
+	}
+}
@@ -9,34 +9,55 @@ package server
 
 import (
 	"context"
+	"errors"
 	"fmt"
 	"log/slog"
 	"net"
+	"strings"
 
 	"github.com/edgelesssys/constellation/v2/internal/crypto"
 	"github.com/edgelesssys/constellation/v2/internal/grpc/grpclog"
+	"github.com/edgelesssys/constellation/v2/internal/grpc/tokencredentials"
 	"github.com/edgelesssys/constellation/v2/internal/kms/kms"
 	"github.com/edgelesssys/constellation/v2/internal/logger"
+	"github.com/edgelesssys/constellation/v2/keyservice/internal/registry"
 	"github.com/edgelesssys/constellation/v2/keyservice/keyserviceproto"
 	"google.golang.org/grpc"
 	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
 	"google.golang.org/grpc/status"
+	authenticationv1 "k8s.io/api/authentication/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 )
 
 // Server implements an encryption key management server.
 // The server serves aTLS for cluster external requests
 // and plain gRPC for cluster internal requests.
+//
+// Requests that rotate or delete keys must be authenticated with the token of
+// a service account in the admin namespace, which is verified using the Kubernetes API.
+//
+// New key versions are derived from the latest generation of the master secret.
 type Server struct {
-	log    *slog.Logger
-	conKMS kms.CloudKMS
+	log            *slog.Logger
+	conKMS         kms.CloudKMS
+	registry       keyRegistry
+	tokenReviewer  tokenReviewer
+	adminNamespace string
+	generation     uint32
 	keyserviceproto.UnimplementedAPIServer
 }
 
 // New creates a new Server.
-func New(log *slog.Logger, conKMS kms.CloudKMS) *Server {
+// generation is the latest generation of the master secret held by conKMS.
+func New(log *slog.Logger, conKMS kms.CloudKMS, registry keyRegistry, tokenReviewer tokenReviewer, adminNamespace string, generation uint32) *Server {
 	return &Server{
-		log:    log,
-		conKMS: conKMS,
+		log:            log,
+		conKMS:         conKMS,
+		registry:       registry,
+		tokenReviewer:  tokenReviewer,
+		adminNamespace: adminNamespace,
+		generation:     generation,
 	}
 }
 
@@ -59,7 +80,8 @@ func (s *Server) Run(port string) error {
 	return server.Serve(listener)
 }
 
-// GetDataKey returns a data key.
+// GetDataKey returns a version of a data key.
+// Requests without a version return version 0, which is the key that existed before the first rotation.
 func (s *Server) GetDataKey(ctx context.Context, in *keyserviceproto.GetDataKeyRequest) (*keyserviceproto.GetDataKeyResponse, error) {
 	log := s.log.With("peerAddress", grpclog.PeerAddrFromContext(ctx))
 
@@ -74,11 +96,164 @@ func (s *Server) GetDataKey(ctx context.Context, in *keyserviceproto.GetDataKeyR
 		log.Error("No data key ID specified")
 		return nil, status.Error(codes.InvalidArgument, "no data key ID specified")
 	}
+	log = log.With("dataKeyID", in.DataKeyId)
 
-	key, err := s.conKMS.GetDEK(ctx, crypto.DEKPrefix+in.DataKeyId, int(in.Length))
+	key, err := s.registry.Get(ctx, in.DataKeyId, in.Version)
+	if err != nil {
+		log.With(slog.Any("error", err)).Error("Failed to get key versions")
+		return nil, status.Errorf(codes.Unavailable, "getting key versions: %v", err)
+	}
+	version := in.Version
+	if in.Latest {
+		version = key.LatestVersion
+	}
+	switch {
+	case version > key.LatestVersion:
+		log.Error(fmt.Sprintf("Requested key version %d doesn't exist, latest version is %d", version, key.LatestVersion))
+		return nil, status.Errorf(codes.NotFound, "version %d of key %q doesn't exist, latest version is %d", version, in.DataKeyId, key.LatestVersion)
+	case version < key.OldestVersion:
+		log.Error(fmt.Sprintf("Requested key version %d was deleted, oldest version is %d", version, key.OldestVersion))
+		return nil, status.Errorf(codes.NotFound, "version %d of key %q was deleted, oldest version is %d", version, in.DataKeyId, key.OldestVersion)
+	}
+
+	dataKey, err := s.conKMS.GetDEK(ctx, crypto.VersionedDEKID(in.DataKeyId, version), int(in.Length))
 	if err != nil {
 		log.With(slog.Any("error", err)).Error("Failed to get data key")
 		return nil, status.Errorf(codes.Internal, "%v", err)
 	}
-	return &keyserviceproto.GetDataKeyResponse{DataKey: key}, nil
+	return &keyserviceproto.GetDataKeyResponse{DataKey: dataKey, Version: version}, nil
+}
+
+// RotateDataKey creates a new version of a data key.
+// Previous versions stay available, so consumers can migrate to the new version without downtime.
+// The new version is derived from the latest generation of the master secret.
+func (s *Server) RotateDataKey(ctx context.Context, in *keyserviceproto.RotateDataKeyRequest) (*keyserviceproto.RotateDataKeyResponse, error) {
+	log := s.log.With("peerAddress", grpclog.PeerAddrFromContext(ctx))
+
+	if err := s.authorize(ctx, log); err != nil {
+		return nil, err
+	}
+
+	if in.DataKeyId == "" {
+		log.Error("No data key ID specified")
+		return nil, status.Error(codes.InvalidArgument, "no data key ID specified")
+	}
+	log = log.With("dataKeyID", in.DataKeyId)
+
+	version, err := s.registry.Rotate(ctx, in.DataKeyId, crypto.FirstKeyVersion(s.generation))
+	if err != nil {
+		log.With(slog.Any("error", err)).Error("Failed to rotate data key")
+		return nil, status.Errorf(codes.Unavailable, "rotating data key: %v", err)
+	}
+	log.Info(fmt.Sprintf("Rotated data key to version %d", version))
+	return &keyserviceproto.RotateDataKeyResponse{Version: version}, nil
+}
+
+// ListDataKeys returns the IDs and versions of all rotated data keys.
+// Keys that were never rotated only have version 0 and aren't listed.
+func (s *Server) ListDataKeys(ctx context.Context, _ *keyserviceproto.ListDataKeysRequest) (*keyserviceproto.ListDataKeysResponse, error) {
+	keys, err := s.registry.List(ctx)
+	if err != nil {
+		s.log.With(slog.Any("error", err)).Error("Failed to list data keys")
+		return nil, status.Errorf(codes.Unavailable, "listing data keys: %v", err)
+	}
+
+	resp := &keyserviceproto.ListDataKeysResponse{}
+	for _, key := range keys {
+		resp.DataKeys = append(resp.DataKeys, &keyserviceproto.DataKeyInfo{
+			DataKeyId:     key.ID,
+			LatestVersion: key.LatestVersion,
+			OldestVersion: key.OldestVersion,
+		})
+	}
+	return resp, nil
+}
+
+// DeleteDataKey deletes all versions of a data key older than the given version, e.g., once all data was migrated to newer versions.
+// The latest version is in use, since consumers are migrated to it, so it can't be deleted.
+func (s *Server) DeleteDataKey(ctx context.Context, in *keyserviceproto.DeleteDataKeyRequest) (*keyserviceproto.DeleteDataKeyResponse, error) {
+	log := s.log.With("peerAddress", grpclog.PeerAddrFromContext(ctx))
+
+	if err := s.authorize(ctx, log); err != nil {
+		return nil, err
+	}
+
+	if in.DataKeyId == "" {
+		log.Error("No data key ID specified")
+		return nil, status.Error(codes.InvalidArgument, "no data key ID specified")
+	}
+	log = log.With("dataKeyID", in.DataKeyId)
+
+	err := s.registry.Delete(ctx, in.DataKeyId, in.Version)
+	if errors.Is(err, registry.ErrVersionInUse) {
+		log.With(slog.Any("error", err)).Error("Refusing to delete data key version in use")
+		return nil, status.Errorf(codes.FailedPrecondition, "deleting data key: %v", err)
+	}
+	if err != nil {
+		log.With(slog.Any("error", err)).Error("Failed to delete data key")
+		return nil, status.Errorf(codes.Unavailable, "deleting data key: %v", err)
+	}
+	log.Info(fmt.Sprintf("Deleted data key versions older than %d", in.Version))
+	return &keyserviceproto.DeleteDataKeyResponse{}, nil
+}
+
+// authorize checks that a request is authenticated with the token of a service account in the admin namespace.
+func (s *Server) authorize(ctx context.Context, log *slog.Logger) error {
+	md, _ := metadata.FromIncomingContext(ctx)
+	headers := md.Get(tokencredentials.AuthorizationHeader)
+	if len(headers) != 1 {
+		log.Error("Request isn't authenticated")
+		return status.Error(codes.Unauthenticated, "request must be authenticated with a service account token")
+	}
+	token, ok := tokencredentials.TokenFromHeader(headers[0])
+	if !ok {
+		log.Error("Request isn't authenticated with a bearer token")
+		return status.Error(codes.Unauthenticated, "request must be authenticated with a service account token")
+	}
+
+	review, err := s.tokenReviewer.Create(ctx, &authenticationv1.TokenReview{
+		Spec: authenticationv1.TokenReviewSpec{Token: token},
+	}, metav1.CreateOptions{})
+	if err != nil {
+		log.With(slog.Any("error", err)).Error("Failed to review token")
+		return status.Errorf(codes.Unavailable, "reviewing token: %v", err)
+	}
+	if !review.Status.Authenticated {
+		log.With(slog.String("error", review.Status.Error)).Error("Token isn't valid")
+		return status.Error(codes.Unauthenticated, "invalid service account token")
+	}
+
+	// Usernames of service accounts have the format system:serviceaccount:<namespace>:<name>.
+	username := review.Status.User.Username
+	serviceAccount, ok := strings.CutPrefix(username, serviceAccountUsernamePrefix)
+	namespace, _, _ := strings.Cut(serviceAccount, ":")
+	if !ok || namespace != s.adminNamespace {
+		log.Error(fmt.Sprintf("User %q isn't allowed to modify keys", username))
+		return status.Errorf(codes.PermissionDenied, "user %q isn't a service account in namespace %q", username, s.adminNamespace)
+	}
+	log.Info(fmt.Sprintf("Authorized %q", username))
+	return nil
+}
+
+// serviceAccountUsernamePrefix is the prefix of the usernames of service accounts.
+const serviceAccountUsernamePrefix = "system:serviceaccount:"
+
+// keyRegistry keeps track of data keys and their versions.
+type keyRegistry interface {
+	// Get returns the versions of a key. Keys that are not known have version 0 only.
+	// The registry makes sure the returned latest version is at least the given version, if that version exists.
+	Get(ctx context.Context, keyID string, version uint32) (registry.Key, error)
+	// Rotate increments the latest version of a key and returns the new version.
+	// The new version is at least minVersion.
+	Rotate(ctx context.Context, keyID string, minVersion uint32) (uint32, error)
+	// Delete deletes all versions of a key older than the given version.
+	// It returns registry.ErrVersionInUse if the latest version would be deleted.
+	Delete(ctx context.Context, keyID string, version uint32) error
+	// List returns all known keys.
+	List(ctx context.Context) ([]registry.Key, error)
+}
+
+// tokenReviewer verifies Kubernetes tokens.
+type tokenReviewer interface {
+	Create(ctx context.Context, tokenReview *authenticationv1.TokenReview, opts metav1.CreateOptions) (*authenticationv1.TokenReview, error)
 }
@@ -13,10 +13,16 @@ import (
 
 	"github.com/edgelesssys/constellation/v2/internal/kms/kms"
 	"github.com/edgelesssys/constellation/v2/internal/logger"
+	"github.com/edgelesssys/constellation/v2/keyservice/internal/registry"
 	"github.com/edgelesssys/constellation/v2/keyservice/keyserviceproto"
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
 	"go.uber.org/goleak"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+	authenticationv1 "k8s.io/api/authentication/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 )
 
 func TestMain(m *testing.M) {
@@ -30,7 +36,7 @@ func TestGetDataKey(t *testing.T) {
 	log := logger.NewTest(t)
 
 	kms := &stubKMS{derivedKey: []byte{0x0, 0x1, 0x2, 0x3, 0x4, 0x5}}
-	api := New(log, kms)
+	api := New(log, kms, &stubRegistry{}, &stubTokenReviewer{}, "kube-system", 0)
 
 	res, err := api.GetDataKey(t.Context(), &keyserviceproto.GetDataKeyRequest{DataKeyId: "1", Length: 32})
 	require.NoError(err)
@@ -47,17 +53,292 @@ func TestGetDataKey(t *testing.T) {
 	assert.Nil(res)
 
 	// Test derive key error
-	api = New(log, &stubKMS{deriveKeyErr: errors.New("error")})
+	api = New(log, &stubKMS{deriveKeyErr: errors.New("error")}, &stubRegistry{}, &stubTokenReviewer{}, "kube-system", 0)
 	res, err = api.GetDataKey(t.Context(), &keyserviceproto.GetDataKeyRequest{DataKeyId: "1", Length: 32})
 	assert.Error(err)
 	assert.Nil(res)
 }
 
+func TestGetDataKeyVersions(t *testing.T) {
+	someErr := errors.New("failed")
+
+	testCases := map[string]struct {
+		req         *keyserviceproto.GetDataKeyRequest
+		registry    *stubRegistry
+		wantDEKID   string
+		wantVersion uint32
+		wantCode    codes.Code
+	}{
+		"no version": {
+			req:       &keyserviceproto.GetDataKeyRequest{DataKeyId: "volume01", Length: 32},
+			registry:  &stubRegistry{latest: 2},
+			wantDEKID: "key-volume01",
+		},
+		"specific version": {
+			req:         &keyserviceproto.GetDataKeyRequest{DataKeyId: "volume01", Length: 32, Version: 1},
+			registry:    &stubRegistry{latest: 2},
+			wantDEKID:   "versioned-key-v1-volume01",
+			wantVersion: 1,
+		},
+		"latest version": {
+			req:         &keyserviceproto.GetDataKeyRequest{DataKeyId: "volume01", Length: 32, Version: 1, Latest: true},
+			registry:    &stubRegistry{latest: 2},
+			wantDEKID:   "versioned-key-v2-volume01",
+			wantVersion: 2,
+		},
+		"latest version of unrotated key": {
+			req:       &keyserviceproto.GetDataKeyRequest{DataKeyId: "volume01", Length: 32, Latest: true},
+			registry:  &stubRegistry{},
+			wantDEKID: "key-volume01",
+		},
+		"future version": {
+			req:      &keyserviceproto.GetDataKeyRequest{DataKeyId: "volume01", Length: 32, Version: 3},
+			registry: &stubRegistry{latest: 2},
+			wantCode: codes.NotFound,
+		},
+		"deleted version": {
+			req:      &keyserviceproto.GetDataKeyRequest{DataKeyId: "volume01", Length: 32},
+			registry: &stubRegistry{latest: 2, oldest: 1},
+			wantCode: codes.NotFound,
+		},
+		"oldest version": {
+			req:         &keyserviceproto.GetDataKeyRequest{DataKeyId: "volume01", Length: 32, Version: 1},
+			registry:    &stubRegistry{latest: 2, oldest: 1},
+			wantDEKID:   "versioned-key-v1-volume01",
+			wantVersion: 1,
+		},
+		"latest version of key with deleted versions": {
+			req:         &keyserviceproto.GetDataKeyRequest{DataKeyId: "volume01", Length: 32, Latest: true},
+			registry:    &stubRegistry{latest: 2, oldest: 2},
+			wantDEKID:   "versioned-key-v2-volume01",
+			wantVersion: 2,
+		},
+		"registry error without version": {
+			req:      &keyserviceproto.GetDataKeyRequest{DataKeyId: "volume01", Length: 32},
+			registry: &stubRegistry{err: someErr},
+			wantCode: codes.Unavailable,
+		},
+		"registry error with version": {
+			req:      &keyserviceproto.GetDataKeyRequest{DataKeyId: "volume01", Length: 32, Version: 1},
+			registry: &stubRegistry{err: someErr},
+			wantCode: codes.Unavailable,
+		},
+		"registry error with latest": {
+			req:      &keyserviceproto.GetDataKeyRequest{DataKeyId: "volume01", Length: 32, Latest: true},
+			registry: &stubRegistry{err: someErr},
+			wantCode: codes.Unavailable,
+		},
+	}
+
+	for name, tc := range testCases {
+		t.Run(name, func(t *testing.T) {
+			assert := assert.New(t)
+			require := require.New(t)
+
+			kms := &stubKMS{derivedKey: []byte{0x1, 0x2}}
+			api := New(logger.NewTest(t), kms, tc.registry, &stubTokenReviewer{}, "kube-system", 0)
+
+			res, err := api.GetDataKey(t.Context(), tc.req)
+			if tc.wantCode != codes.OK {
+				assert.Equal(tc.wantCode, status.Code(err))
+				return
+			}
+			require.NoError(err)
+			assert.Equal(kms.derivedKey, res.DataKey)
+			assert.Equal(tc.wantVersion, res.Version)
+			assert.Equal(tc.wantDEKID, kms.dekID)
+		})
+	}
+}
+
+func TestRotateDataKey(t *testing.T) {
+	testCases := map[string]struct {
+		req         *keyserviceproto.RotateDataKeyRequest
+		registry    *stubRegistry
+		generation  uint32
+		wantVersion uint32
+		wantCode    codes.Code
+	}{
+		"success": {
+			req:         &keyserviceproto.RotateDataKeyRequest{DataKeyId: "volume01"},
+			registry:    &stubRegistry{latest: 2},
+			wantVersion: 3,
+		},
+		"rotated master secret": {
+			req:         &keyserviceproto.RotateDataKeyRequest{DataKeyId: "volume01"},
+			registry:    &stubRegistry{latest: 2},
+			generation:  1,
+			wantVersion: 1 << 24,
+		},
+		"no data key ID": {
+			req:      &keyserviceproto.RotateDataKeyRequest{},
+			registry: &stubRegistry{},
+			wantCode: codes.InvalidArgument,
+		},
+		"registry error": {
+			req:      &keyserviceproto.RotateDataKeyRequest{DataKeyId: "volume01"},
+			registry: &stubRegistry{err: errors.New("failed")},
+			wantCode: codes.Unavailable,
+		},
+	}
+
+	for name, tc := range testCases {
+		t.Run(name, func(t *testing.T) {
+			assert := assert.New(t)
+
+			api := New(logger.NewTest(t), &stubKMS{}, tc.registry, adminTokenReviewer(), "kube-system", tc.generation)
+			res, err := api.RotateDataKey(authenticatedContext(t), tc.req)
+			if tc.wantCode != codes.OK {
+				assert.Equal(tc.wantCode, status.Code(err))
+				return
+			}
+			assert.NoError(err)
+			assert.Equal(tc.wantVersion, res.Version)
+		})
+	}
+}
+
+func TestListDataKeys(t *testing.T) {
+	assert := assert.New(t)
+	require := require.New(t)
+
+	keys := []registry.Key{{ID: "measurementSecret", LatestVersion: 1}, {ID: "volume01", LatestVersion: 2, OldestVersion: 1}}
+	api := New(logger.NewTest(t), &stubKMS{}, &stubRegistry{keys: keys}, &stubTokenReviewer{}, "kube-system", 0)
+	res, err := api.ListDataKeys(t.Context(), &keyserviceproto.ListDataKeysRequest{})
+	require.NoError(err)
+	require.Len(res.DataKeys, 2)
+	assert.Equal("measurementSecret", res.DataKeys[0].DataKeyId)
+	assert.Equal("volume01", res.DataKeys[1].DataKeyId)
+	assert.Equal(uint32(2), res.DataKeys[1].LatestVersion)
+	assert.Equal(uint32(1), res.DataKeys[1].OldestVersion)
+
+	api = New(logger.NewTest(t), &stubKMS{}, &stubRegistry{err: errors.New("failed")}, &stubTokenReviewer{}, "kube-system", 0)
+	_, err = api.ListDataKeys(t.Context(), &keyserviceproto.ListDataKeysRequest{})
+	assert.Equal(codes.Unavailable, status.Code(err))
+}
+
+func TestDeleteDataKey(t *testing.T) {
+	testCases := map[string]struct {
+		req      *keyserviceproto.DeleteDataKeyRequest
+		registry *stubRegistry
+		wantCode codes.Code
+	}{
+		"success": {
+			req:      &keyserviceproto.DeleteDataKeyRequest{DataKeyId: "volume01", Version: 2},
+			registry: &stubRegistry{latest: 2},
+		},
+		"no data key ID": {
+			req:      &keyserviceproto.DeleteDataKeyRequest{},
+			registry: &stubRegistry{},
+			wantCode: codes.InvalidArgument,
+		},
+		"latest version in use": {
+			req:      &keyserviceproto.DeleteDataKeyRequest{DataKeyId: "volume01", Version: 3},
+			registry: &stubRegistry{latest: 2},
+			wantCode: codes.FailedPrecondition,
+		},
+		"registry error": {
+			req:      &keyserviceproto.DeleteDataKeyRequest{DataKeyId: "volume01"},
+			registry: &stubRegistry{err: errors.New("failed")},
+			wantCode: codes.Unavailable,
+		},
+	}
+
+	for name, tc := range testCases {
+		t.Run(name, func(t *testing.T) {
+			assert := assert.New(t)
+
+			api := New(logger.NewTest(t), &stubKMS{}, tc.registry, adminTokenReviewer(), "kube-system", 0)
+			_, err := api.DeleteDataKey(authenticatedContext(t), tc.req)
+			assert.Equal(tc.wantCode, status.Code(err))
+		})
+	}
+}
+
+func TestAuthorize(t *testing.T) {
+	testCases := map[string]struct {
+		md       metadata.MD
+		reviewer *stubTokenReviewer
+		wantCode codes.Code
+	}{
+		"service account in admin namespace": {
+			md:       metadata.Pairs("authorization", "Bearer token"),
+			reviewer: adminTokenReviewer(),
+		},
+		"no token": {
+			reviewer: adminTokenReviewer(),
+			wantCode: codes.Unauthenticated,
+		},
+		"no bearer token": {
+			md:       metadata.Pairs("authorization", "Basic dXNlcjpwYXNz"),
+			reviewer: adminTokenReviewer(),
+			wantCode: codes.Unauthenticated,
+		},
+		"invalid token": {
+			md:       metadata.Pairs("authorization", "Bearer token"),
+			reviewer: &stubTokenReviewer{status: authenticationv1.TokenReviewStatus{Error: "invalid bearer token"}},
+			wantCode: codes.Unauthenticated,
+		},
+		"service account in other namespace": {
+			md: metadata.Pairs("authorization", "Bearer token"),
+			reviewer: &stubTokenReviewer{status: authenticationv1.TokenReviewStatus{
+				Authenticated: true,
+				User:          authenticationv1.UserInfo{Username: "system:serviceaccount:default:kube-system"},
+			}},
+			wantCode: codes.PermissionDenied,
+		},
+		"user": {
+			md: metadata.Pairs("authorization", "Bearer token"),
+			reviewer: &stubTokenReviewer{status: authenticationv1.TokenReviewStatus{
+				Authenticated: true,
+				User:          authenticationv1.UserInfo{Username: "kube-system"},
+			}},
+			wantCode: codes.PermissionDenied,
+		},
+		"token review fails": {
+			md:       metadata.Pairs("authorization", "Bearer token"),
+			reviewer: &stubTokenReviewer{err: errors.New("failed")},
+			wantCode: codes.Unavailable,
+		},
+	}
+
+	for name, tc := range testCases {
+		t.Run(name, func(t *testing.T) {
+			assert := assert.New(t)
+
+			api := New(logger.NewTest(t), &stubKMS{}, &stubRegistry{latest: 1}, tc.reviewer, "kube-system", 0)
+			ctx := metadata.NewIncomingContext(t.Context(), tc.md)
+
+			_, err := api.RotateDataKey(ctx, &keyserviceproto.RotateDataKeyRequest{DataKeyId: "volume01"})
+			assert.Equal(tc.wantCode, status.Code(err))
+			_, err = api.DeleteDataKey(ctx, &keyserviceproto.DeleteDataKeyRequest{DataKeyId: "volume01", Version: 1})
+			assert.Equal(tc.wantCode, status.Code(err))
+			if tc.wantCode == codes.OK {
+				assert.Equal("token", tc.reviewer.token)
+			}
+		})
+	}
+}
+
+// authenticatedContext returns a context of a request authenticated with a bearer token.
+func authenticatedContext(t *testing.T) context.Context {
+	return metadata.NewIncomingContext(t.Context(), metadata.Pairs("authorization", "Bearer token"))
+}
+
+// adminTokenReviewer returns a token reviewer accepting tokens of a service account in the admin namespace.
+func adminTokenReviewer() *stubTokenReviewer {
+	return &stubTokenReviewer{status: authenticationv1.TokenReviewStatus{
+		Authenticated: true,
+		User:          authenticationv1.UserInfo{Username: "system:serviceaccount:kube-system:join-service"},
+	}}
+}
+
 type stubKMS struct {
 	kms.CloudKMS
 	masterKey    []byte
 	derivedKey   []byte
 	deriveKeyErr error
+	dekID        string
 }
 
 func (c *stubKMS) CreateKEK(_ context.Context, _ string, kek []byte) error {
@@ -65,9 +346,54 @@ func (c *stubKMS) CreateKEK(_ context.Context, _ string, kek []byte) error {
 	return nil
 }
 
-func (c *stubKMS) GetDEK(_ context.Context, _ string, _ int) ([]byte, error) {
+func (c *stubKMS) GetDEK(_ context.Context, dekID string, _ int) ([]byte, error) {
+	c.dekID = dekID
 	if c.deriveKeyErr != nil {
 		return nil, c.deriveKeyErr
 	}
 	return c.derivedKey, nil
 }
+
+type stubRegistry struct {
+	latest uint32
+	oldest uint32
+	keys   []registry.Key
+	err    error
+}
+
+func (r *stubRegistry) Get(_ context.Context, keyID string, _ uint32) (registry.Key, error) {
+	return registry.Key{ID: keyID, LatestVersion: r.latest, OldestVersion: r.oldest}, r.err
+}
+
+func (r *stubRegistry) Rotate(_ context.Context, _ string, minVersion uint32) (uint32, error) {
+	return max(r.latest+1, minVersion), r.err
+}
+
+func (r *stubRegistry) Delete(_ context.Context, _ string, version uint32) error {
+	if r.err != nil {
+		return r.err
+	}
+	if version > r.latest {
+		return registry.ErrVersionInUse
+	}
+	return nil
+}
+
+func (r *stubRegistry) List(context.Context) ([]registry.Key, error) {
+	return r.keys, r.err
+}
+
+type stubTokenReviewer struct {
+	status authenticationv1.TokenReviewStatus
+	err    error
+	token  string
+}
+
+func (r *stubTokenReviewer) Create(_ context.Context, review *authenticationv1.TokenReview, _ metav1.CreateOptions) (*authenticationv1.TokenReview, error) {
+	r.token = review.Spec.Token
+	if r.err != nil {
+		return nil, r.err
+	}
+	review.Status = r.status
+	return review, nil
+}
@@ -26,9 +26,13 @@ const (
 )
 
 type GetDataKeyRequest struct {
-	state         protoimpl.MessageState `protogen:"open.v1"`
-	DataKeyId     string                 `protobuf:"bytes,1,opt,name=data_key_id,json=dataKeyId,proto3" json:"data_key_id,omitempty"`
-	Length        uint32                 `protobuf:"varint,2,opt,name=length,proto3" json:"length,omitempty"`
+	state     protoimpl.MessageState `protogen:"open.v1"`
+	DataKeyId string                 `protobuf:"bytes,1,opt,name=data_key_id,json=dataKeyId,proto3" json:"data_key_id,omitempty"`
+	Length    uint32                 `protobuf:"varint,2,opt,name=length,proto3" json:"length,omitempty"`
+	// version of the key. Version 0 is the key that existed before the first rotation.
+	Version uint32 `protobuf:"varint,3,opt,name=version,proto3" json:"version,omitempty"`
+	// latest requests the latest version of the key. If set, version is ignored.
+	Latest        bool `protobuf:"varint,4,opt,name=latest,proto3" json:"latest,omitempty"`
 	unknownFields protoimpl.UnknownFields
 	sizeCache     protoimpl.SizeCache
 }
@@ -77,9 +81,24 @@ func (x *GetDataKeyRequest) GetLength() uint32 {
 	return 0
 }
 
+func (x *GetDataKeyRequest) GetVersion() uint32 {
+	if x != nil {
+		return x.Version
+	}
+	return 0
+}
+
+func (x *GetDataKeyRequest) GetLatest() bool {
+	if x != nil {
+		return x.Latest
+	}
+	return false
+}
+
 type GetDataKeyResponse struct {
 	state         protoimpl.MessageState `protogen:"open.v1"`
 	DataKey       []byte                 `protobuf:"bytes,1,opt,name=data_key,json=dataKey,proto3" json:"data_key,omitempty"`
+	Version       uint32                 `protobuf:"varint,2,opt,name=version,proto3" json:"version,omitempty"`
 	unknownFields protoimpl.UnknownFields
 	sizeCache     protoimpl.SizeCache
 }
@@ -121,19 +140,368 @@ func (x *GetDataKeyResponse) GetDataKey() []byte {
 	return nil
 }
 
+func (x *GetDataKeyResponse) GetVersion() uint32 {
+	if x != nil {
+		return x.Version
+	}
+	return 0
+}
+
+type RotateDataKeyRequest struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	DataKeyId     string                 `protobuf:"bytes,1,opt,name=data_key_id,json=dataKeyId,proto3" json:"data_key_id,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *RotateDataKeyRequest) Reset() {
+	*x = RotateDataKeyRequest{}
+	mi := &file_keyservice_keyserviceproto_keyservice_proto_msgTypes[2]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *RotateDataKeyRequest) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*RotateDataKeyRequest) ProtoMessage() {}
+
+func (x *RotateDataKeyRequest) ProtoReflect() protoreflect.Message {
+	mi := &file_keyservice_keyserviceproto_keyservice_proto_msgTypes[2]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use RotateDataKeyRequest.ProtoReflect.Descriptor instead.
+func (*RotateDataKeyRequest) Descriptor() ([]byte, []int) {
+	return file_keyservice_keyserviceproto_keyservice_proto_rawDescGZIP(), []int{2}
+}
+
+func (x *RotateDataKeyRequest) GetDataKeyId() string {
+	if x != nil {
+		return x.DataKeyId
+	}
+	return ""
+}
+
+type RotateDataKeyResponse struct {
+	state protoimpl.MessageState `protogen:"open.v1"`
+	// version is the new latest version of the key.
+	Version       uint32 `protobuf:"varint,1,opt,name=version,proto3" json:"version,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *RotateDataKeyResponse) Reset() {
+	*x = RotateDataKeyResponse{}
+	mi := &file_keyservice_keyserviceproto_keyservice_proto_msgTypes[3]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *RotateDataKeyResponse) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*RotateDataKeyResponse) ProtoMessage() {}
+
+func (x *RotateDataKeyResponse) ProtoReflect() protoreflect.Message {
+	mi := &file_keyservice_keyserviceproto_keyservice_proto_msgTypes[3]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use RotateDataKeyResponse.ProtoReflect.Descriptor instead.
+func (*RotateDataKeyResponse) Descriptor() ([]byte, []int) {
+	return file_keyservice_keyserviceproto_keyservice_proto_rawDescGZIP(), []int{3}
+}
+
+func (x *RotateDataKeyResponse) GetVersion() uint32 {
+	if x != nil {
+		return x.Version
+	}
+	return 0
+}
+
+type ListDataKeysRequest struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *ListDataKeysRequest) Reset() {
+	*x = ListDataKeysRequest{}
+	mi := &file_keyservice_keyserviceproto_keyservice_proto_msgTypes[4]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *ListDataKeysRequest) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*ListDataKeysRequest) ProtoMessage() {}
+
+func (x *ListDataKeysRequest) ProtoReflect() protoreflect.Message {
+	mi := &file_keyservice_keyserviceproto_keyservice_proto_msgTypes[4]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use ListDataKeysRequest.ProtoReflect.Descriptor instead.
+func (*ListDataKeysRequest) Descriptor() ([]byte, []int) {
+	return file_keyservice_keyserviceproto_keyservice_proto_rawDescGZIP(), []int{4}
+}
+
+type ListDataKeysResponse struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	DataKeys      []*DataKeyInfo         `protobuf:"bytes,1,rep,name=data_keys,json=dataKeys,proto3" json:"data_keys,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *ListDataKeysResponse) Reset() {
+	*x = ListDataKeysResponse{}
+	mi := &file_keyservice_keyserviceproto_keyservice_proto_msgTypes[5]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *ListDataKeysResponse) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*ListDataKeysResponse) ProtoMessage() {}
+
+func (x *ListDataKeysResponse) ProtoReflect() protoreflect.Message {
+	mi := &file_keyservice_keyserviceproto_keyservice_proto_msgTypes[5]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use ListDataKeysResponse.ProtoReflect.Descriptor instead.
+func (*ListDataKeysResponse) Descriptor() ([]byte, []int) {
+	return file_keyservice_keyserviceproto_keyservice_proto_rawDescGZIP(), []int{5}
+}
+
+func (x *ListDataKeysResponse) GetDataKeys() []*DataKeyInfo {
+	if x != nil {
+		return x.DataKeys
+	}
+	return nil
+}
+
+type DataKeyInfo struct {
+	state     protoimpl.MessageState `protogen:"open.v1"`
+	DataKeyId string                 `protobuf:"bytes,1,opt,name=data_key_id,json=dataKeyId,proto3" json:"data_key_id,omitempty"`
+	// latest_version is the latest version of the key. All versions from oldest_version to latest_version can be requested.
+	LatestVersion uint32 `protobuf:"varint,2,opt,name=latest_version,json=latestVersion,proto3" json:"latest_version,omitempty"`
+	// oldest_version is the oldest version of the key that wasn't deleted.
+	OldestVersion uint32 `protobuf:"varint,3,opt,name=oldest_version,json=oldestVersion,proto3" json:"oldest_version,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *DataKeyInfo) Reset() {
+	*x = DataKeyInfo{}
+	mi := &file_keyservice_keyserviceproto_keyservice_proto_msgTypes[6]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *DataKeyInfo) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*DataKeyInfo) ProtoMessage() {}
+
+func (x *DataKeyInfo) ProtoReflect() protoreflect.Message {
+	mi := &file_keyservice_keyserviceproto_keyservice_proto_msgTypes[6]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use DataKeyInfo.ProtoReflect.Descriptor instead.
+func (*DataKeyInfo) Descriptor() ([]byte, []int) {
+	return file_keyservice_keyserviceproto_keyservice_proto_rawDescGZIP(), []int{6}
+}
+
+func (x *DataKeyInfo) GetDataKeyId() string {
+	if x != nil {
+		return x.DataKeyId
+	}
+	return ""
+}
+
+func (x *DataKeyInfo) GetLatestVersion() uint32 {
+	if x != nil {
+		return x.LatestVersion
+	}
+	return 0
+}
+
+func (x *DataKeyInfo) GetOldestVersion() uint32 {
+	if x != nil {
+		return x.OldestVersion
+	}
+	return 0
+}
+
+type DeleteDataKeyRequest struct {
+	state     protoimpl.MessageState `protogen:"open.v1"`
+	DataKeyId string                 `protobuf:"bytes,1,opt,name=data_key_id,json=dataKeyId,proto3" json:"data_key_id,omitempty"`
+	// version is the oldest version of the key that is still in use. All older versions are deleted.
+	// The latest version can't be deleted, since consumers are migrated to it.
+	Version       uint32 `protobuf:"varint,2,opt,name=version,proto3" json:"version,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *DeleteDataKeyRequest) Reset() {
+	*x = DeleteDataKeyRequest{}
+	mi := &file_keyservice_keyserviceproto_keyservice_proto_msgTypes[7]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *DeleteDataKeyRequest) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*DeleteDataKeyRequest) ProtoMessage() {}
+
+func (x *DeleteDataKeyRequest) ProtoReflect() protoreflect.Message {
+	mi := &file_keyservice_keyserviceproto_keyservice_proto_msgTypes[7]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use DeleteDataKeyRequest.ProtoReflect.Descriptor instead.
+func (*DeleteDataKeyRequest) Descriptor() ([]byte, []int) {
+	return file_keyservice_keyserviceproto_keyservice_proto_rawDescGZIP(), []int{7}
+}
+
+func (x *DeleteDataKeyRequest) GetDataKeyId() string {
+	if x != nil {
+		return x.DataKeyId
+	}
+	return ""
+}
+
+func (x *DeleteDataKeyRequest) GetVersion() uint32 {
+	if x != nil {
+		return x.Version
+	}
+	return 0
+}
+
+type DeleteDataKeyResponse struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *DeleteDataKeyResponse) Reset() {
+	*x = DeleteDataKeyResponse{}
+	mi := &file_keyservice_keyserviceproto_keyservice_proto_msgTypes[8]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *DeleteDataKeyResponse) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*DeleteDataKeyResponse) ProtoMessage() {}
+
+func (x *DeleteDataKeyResponse) ProtoReflect() protoreflect.Message {
+	mi := &file_keyservice_keyserviceproto_keyservice_proto_msgTypes[8]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use DeleteDataKeyResponse.ProtoReflect.Descriptor instead.
+func (*DeleteDataKeyResponse) Descriptor() ([]byte, []int) {
+	return file_keyservice_keyserviceproto_keyservice_proto_rawDescGZIP(), []int{8}
+}
+
 var File_keyservice_keyserviceproto_keyservice_proto protoreflect.FileDescriptor
 
 const file_keyservice_keyserviceproto_keyservice_proto_rawDesc = "" +
 	"\n" +
-	"+keyservice/keyserviceproto/keyservice.proto\x12\x03kms\"K\n" +
+	"+keyservice/keyserviceproto/keyservice.proto\x12\x03kms\"}\n" +
 	"\x11GetDataKeyRequest\x12\x1e\n" +
 	"\vdata_key_id\x18\x01 \x01(\tR\tdataKeyId\x12\x16\n" +
-	"\x06length\x18\x02 \x01(\rR\x06length\"/\n" +
+	"\x06length\x18\x02 \x01(\rR\x06length\x12\x18\n" +
+	"\aversion\x18\x03 \x01(\rR\aversion\x12\x16\n" +
+	"\x06latest\x18\x04 \x01(\bR\x06latest\"I\n" +
 	"\x12GetDataKeyResponse\x12\x19\n" +
-	"\bdata_key\x18\x01 \x01(\fR\adataKey2D\n" +
+	"\bdata_key\x18\x01 \x01(\fR\adataKey\x12\x18\n" +
+	"\aversion\x18\x02 \x01(\rR\aversion\"6\n" +
+	"\x14RotateDataKeyRequest\x12\x1e\n" +
+	"\vdata_key_id\x18\x01 \x01(\tR\tdataKeyId\"1\n" +
+	"\x15RotateDataKeyResponse\x12\x18\n" +
+	"\aversion\x18\x01 \x01(\rR\aversion\"\x15\n" +
+	"\x13ListDataKeysRequest\"E\n" +
+	"\x14ListDataKeysResponse\x12-\n" +
+	"\tdata_keys\x18\x01 \x03(\v2\x10.kms.DataKeyInfoR\bdataKeys\"{\n" +
+	"\vDataKeyInfo\x12\x1e\n" +
+	"\vdata_key_id\x18\x01 \x01(\tR\tdataKeyId\x12%\n" +
+	"\x0elatest_version\x18\x02 \x01(\rR\rlatestVersion\x12%\n" +
+	"\x0eoldest_version\x18\x03 \x01(\rR\roldestVersion\"P\n" +
+	"\x14DeleteDataKeyRequest\x12\x1e\n" +
+	"\vdata_key_id\x18\x01 \x01(\tR\tdataKeyId\x12\x18\n" +
+	"\aversion\x18\x02 \x01(\rR\aversion\"\x17\n" +
+	"\x15DeleteDataKeyResponse2\x99\x02\n" +
 	"\x03API\x12=\n" +
 	"\n" +
-	"GetDataKey\x12\x16.kms.GetDataKeyRequest\x1a\x17.kms.GetDataKeyResponseBDZBgithub.com/edgelesssys/constellation/v2/keyservice/keyserviceprotob\x06proto3"
+	"GetDataKey\x12\x16.kms.GetDataKeyRequest\x1a\x17.kms.GetDataKeyResponse\x12F\n" +
+	"\rRotateDataKey\x12\x19.kms.RotateDataKeyRequest\x1a\x1a.kms.RotateDataKeyResponse\x12C\n" +
+	"\fListDataKeys\x12\x18.kms.ListDataKeysRequest\x1a\x19.kms.ListDataKeysResponse\x12F\n" +
+	"\rDeleteDataKey\x12\x19.kms.DeleteDataKeyRequest\x1a\x1a.kms.DeleteDataKeyResponseBDZBgithub.com/edgelesssys/constellation/v2/keyservice/keyserviceprotob\x06proto3"
 
 var (
 	file_keyservice_keyserviceproto_keyservice_proto_rawDescOnce sync.Once
@@ -147,19 +515,33 @@ func file_keyservice_keyserviceproto_keyservice_proto_rawDescGZIP() []byte {
 	return file_keyservice_keyserviceproto_keyservice_proto_rawDescData
 }
 
-var file_keyservice_keyserviceproto_keyservice_proto_msgTypes = make([]protoimpl.MessageInfo, 2)
+var file_keyservice_keyserviceproto_keyservice_proto_msgTypes = make([]protoimpl.MessageInfo, 9)
 var file_keyservice_keyserviceproto_keyservice_proto_goTypes = []any{
-	(*GetDataKeyRequest)(nil),  // 0: kms.GetDataKeyRequest
-	(*GetDataKeyResponse)(nil), // 1: kms.GetDataKeyResponse
+	(*GetDataKeyRequest)(nil),     // 0: kms.GetDataKeyRequest
+	(*GetDataKeyResponse)(nil),    // 1: kms.GetDataKeyResponse
+	(*RotateDataKeyRequest)(nil),  // 2: kms.RotateDataKeyRequest
+	(*RotateDataKeyResponse)(nil), // 3: kms.RotateDataKeyResponse
+	(*ListDataKeysRequest)(nil),   // 4: kms.ListDataKeysRequest
+	(*ListDataKeysResponse)(nil),  // 5: kms.ListDataKeysResponse
+	(*DataKeyInfo)(nil),           // 6: kms.DataKeyInfo
+	(*DeleteDataKeyRequest)(nil),  // 7: kms.DeleteDataKeyRequest
+	(*DeleteDataKeyResponse)(nil), // 8: kms.DeleteDataKeyResponse
 }
 var file_keyservice_keyserviceproto_keyservice_proto_depIdxs = []int32{
-	0, // 0: kms.API.GetDataKey:input_type -> kms.GetDataKeyRequest
-	1, // 1: kms.API.GetDataKey:output_type -> kms.GetDataKeyResponse
-	1, // [1:2] is the sub-list for method output_type
-	0, // [0:1] is the sub-list for method input_type
-	0, // [0:0] is the sub-list for extension type_name
-	0, // [0:0] is the sub-list for extension extendee
-	0, // [0:0] is the sub-list for field type_name
+	6, // 0: kms.ListDataKeysResponse.data_keys:type_name -> kms.DataKeyInfo
+	0, // 1: kms.API.GetDataKey:input_type -> kms.GetDataKeyRequest
+	2, // 2: kms.API.RotateDataKey:input_type -> kms.RotateDataKeyRequest
+	4, // 3: kms.API.ListDataKeys:input_type -> kms.ListDataKeysRequest
+	7, // 4: kms.API.DeleteDataKey:input_type -> kms.DeleteDataKeyRequest
+	1, // 5: kms.API.GetDataKey:output_type -> kms.GetDataKeyResponse
+	3, // 6: kms.API.RotateDataKey:output_type -> kms.RotateDataKeyResponse
+	5, // 7: kms.API.ListDataKeys:output_type -> kms.ListDataKeysResponse
+	8, // 8: kms.API.DeleteDataKey:output_type -> kms.DeleteDataKeyResponse
+	5, // [5:9] is the sub-list for method output_type
+	1, // [1:5] is the sub-list for method input_type
+	1, // [1:1] is the sub-list for extension type_name
+	1, // [1:1] is the sub-list for extension extendee
+	0, // [0:1] is the sub-list for field type_name
 }
 
 func init() { file_keyservice_keyserviceproto_keyservice_proto_init() }
@@ -173,7 +555,7 @@ func file_keyservice_keyserviceproto_keyservice_proto_init() {
 			GoPackagePath: reflect.TypeOf(x{}).PkgPath(),
 			RawDescriptor: unsafe.Slice(unsafe.StringData(file_keyservice_keyserviceproto_keyservice_proto_rawDesc), len(file_keyservice_keyserviceproto_keyservice_proto_rawDesc)),
 			NumEnums:      0,
-			NumMessages:   2,
+			NumMessages:   9,
 			NumExtensions: 0,
 			NumServices:   1,
 		},
@@ -199,6 +581,9 @@ const _ = grpc.SupportPackageIsVersion6
 // For semantics around ctx use and closing/ending streaming RPCs, please refer to https://godoc.org/google.golang.org/grpc#ClientConn.NewStream.
 type APIClient interface {
 	GetDataKey(ctx context.Context, in *GetDataKeyRequest, opts ...grpc.CallOption) (*GetDataKeyResponse, error)
+	RotateDataKey(ctx context.Context, in *RotateDataKeyRequest, opts ...grpc.CallOption) (*RotateDataKeyResponse, error)
+	ListDataKeys(ctx context.Context, in *ListDataKeysRequest, opts ...grpc.CallOption) (*ListDataKeysResponse, error)
+	DeleteDataKey(ctx context.Context, in *DeleteDataKeyRequest, opts ...grpc.CallOption) (*DeleteDataKeyResponse, error)
 }
 
 type aPIClient struct {
@@ -218,9 +603,39 @@ func (c *aPIClient) GetDataKey(ctx context.Context, in *GetDataKeyRequest, opts
 	return out, nil
 }
 
+func (c *aPIClient) RotateDataKey(ctx context.Context, in *RotateDataKeyRequest, opts ...grpc.CallOption) (*RotateDataKeyResponse, error) {
+	out := new(RotateDataKeyResponse)
+	err := c.cc.Invoke(ctx, "/kms.API/RotateDataKey", in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *aPIClient) ListDataKeys(ctx context.Context, in *ListDataKeysRequest, opts ...grpc.CallOption) (*ListDataKeysResponse, error) {
+	out := new(ListDataKeysResponse)
+	err := c.cc.Invoke(ctx, "/kms.API/ListDataKeys", in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *aPIClient) DeleteDataKey(ctx context.Context, in *DeleteDataKeyRequest, opts ...grpc.CallOption) (*DeleteDataKeyResponse, error) {
+	out := new(DeleteDataKeyResponse)
+	err := c.cc.Invoke(ctx, "/kms.API/DeleteDataKey", in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
 // APIServer is the server API for API service.
 type APIServer interface {
 	GetDataKey(context.Context, *GetDataKeyRequest) (*GetDataKeyResponse, error)
+	RotateDataKey(context.Context, *RotateDataKeyRequest) (*RotateDataKeyResponse, error)
+	ListDataKeys(context.Context, *ListDataKeysRequest) (*ListDataKeysResponse, error)
+	DeleteDataKey(context.Context, *DeleteDataKeyRequest) (*DeleteDataKeyResponse, error)
 }
 
 // UnimplementedAPIServer can be embedded to have forward compatible implementations.
@@ -230,6 +645,15 @@ type UnimplementedAPIServer struct {
 func (*UnimplementedAPIServer) GetDataKey(context.Context, *GetDataKeyRequest) (*GetDataKeyResponse, error) {
 	return nil, status.Errorf(codes.Unimplemented, "method GetDataKey not implemented")
 }
+func (*UnimplementedAPIServer) RotateDataKey(context.Context, *RotateDataKeyRequest) (*RotateDataKeyResponse, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method RotateDataKey not implemented")
+}
+func (*UnimplementedAPIServer) ListDataKeys(context.Context, *ListDataKeysRequest) (*ListDataKeysResponse, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method ListDataKeys not implemented")
+}
+func (*UnimplementedAPIServer) DeleteDataKey(context.Context, *DeleteDataKeyRequest) (*DeleteDataKeyResponse, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method DeleteDataKey not implemented")
+}
 
 func RegisterAPIServer(s *grpc.Server, srv APIServer) {
 	s.RegisterService(&_API_serviceDesc, srv)
@@ -253,6 +677,60 @@ func _API_GetDataKey_Handler(srv interface{}, ctx context.Context, dec func(inte
 	return interceptor(ctx, in, info, handler)
 }
 
+func _API_RotateDataKey_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(RotateDataKeyRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(APIServer).RotateDataKey(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: "/kms.API/RotateDataKey",
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(APIServer).RotateDataKey(ctx, req.(*RotateDataKeyRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _API_ListDataKeys_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(ListDataKeysRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(APIServer).ListDataKeys(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: "/kms.API/ListDataKeys",
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(APIServer).ListDataKeys(ctx, req.(*ListDataKeysRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _API_DeleteDataKey_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(DeleteDataKeyRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(APIServer).DeleteDataKey(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: "/kms.API/DeleteDataKey",
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(APIServer).DeleteDataKey(ctx, req.(*DeleteDataKeyRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
 var _API_serviceDesc = grpc.ServiceDesc{
 	ServiceName: "kms.API",
 	HandlerType: (*APIServer)(nil),
@@ -261,6 +739,18 @@ var _API_serviceDesc = grpc.ServiceDesc{
 			MethodName: "GetDataKey",
 			Handler:    _API_GetDataKey_Handler,
 		},
+		{
+			MethodName: "RotateDataKey",
+			Handler:    _API_RotateDataKey_Handler,
+		},
+		{
+			MethodName: "ListDataKeys",
+			Handler:    _API_ListDataKeys_Handler,
+		},
+		{
+			MethodName: "DeleteDataKey",
+			Handler:    _API_DeleteDataKey_Handler,
+		},
 	},
 	Streams:  []grpc.StreamDesc{},
 	Metadata: "keyservice/keyserviceproto/keyservice.proto",
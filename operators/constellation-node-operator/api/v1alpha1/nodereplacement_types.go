@@ -0,0 +1,99 @@
+/*
+Copyright (c) Edgeless Systems GmbH
+
+SPDX-License-Identifier: BUSL-1.1
+*/
+
+package v1alpha1
+
+import (
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+const (
+	// ConditionReplacementCompleted is used to signal that all nodes selected by a NodeReplacement were replaced.
+	ConditionReplacementCompleted = "Completed"
+
+	// NodeReplacementPhasePending is the phase of a selected node that is waiting for a replacement node.
+	NodeReplacementPhasePending NodeReplacementPhase = "Pending"
+	// NodeReplacementPhaseReplacing is the phase of a selected node that is paired with a replacement node (heir)
+	// and is being drained and removed from the cluster.
+	NodeReplacementPhaseReplacing NodeReplacementPhase = "Replacing"
+	// NodeReplacementPhaseReplaced is the phase of a selected node that was removed from the cluster.
+	NodeReplacementPhaseReplaced NodeReplacementPhase = "Replaced"
+)
+
+// NodeReplacementPhase is the replacement progress of a single node.
+// +kubebuilder:validation:Enum=Pending;Replacing;Replaced
+type NodeReplacementPhase string
+
+// NodeReplacementSpec defines the desired state of NodeReplacement.
+// A node is selected for replacement if it matches all of the specified criteria.
+// +kubebuilder:validation:XValidation:rule="has(self.nodeNames) || has(self.nodeSelector) || has(self.maxAge)",message="at least one of nodeNames, nodeSelector or maxAge must be set"
+type NodeReplacementSpec struct {
+	// NodeNames selects nodes by name.
+	// +optional
+	NodeNames []string `json:"nodeNames,omitempty"`
+	// NodeSelector selects nodes by their labels.
+	// +optional
+	NodeSelector *metav1.LabelSelector `json:"nodeSelector,omitempty"`
+	// MaxAge selects nodes that are older than the given duration.
+	// If set, nodes are replaced continuously whenever they exceed the maximum age.
+	// If unset, only nodes that exist when the NodeReplacement is created are replaced.
+	// +optional
+	MaxAge *metav1.Duration `json:"maxAge,omitempty"`
+	// Reason is a human readable reason for the replacement.
+	// It is used as reason of the node maintenance that drains the replaced nodes.
+	// +optional
+	Reason string `json:"reason,omitempty"`
+}
+
+// NodeReplacementNodeStatus is the replacement progress of a single node.
+type NodeReplacementNodeStatus struct {
+	// Name is the name of the replaced node.
+	Name string `json:"name"`
+	// Phase is the replacement progress of the node.
+	Phase NodeReplacementPhase `json:"phase"`
+	// Heir is the name of the node that replaces this node.
+	// +optional
+	Heir string `json:"heir,omitempty"`
+	// LastTransitionTime is the last time the phase changed.
+	LastTransitionTime metav1.Time `json:"lastTransitionTime"`
+}
+
+// NodeReplacementStatus defines the observed state of NodeReplacement.
+type NodeReplacementStatus struct {
+	// Nodes is the replacement progress of every node selected by the NodeReplacement.
+	// +optional
+	Nodes []NodeReplacementNodeStatus `json:"nodes,omitempty"`
+	// Conditions represent the latest available observations of an object's state
+	// +optional
+	Conditions []metav1.Condition `json:"conditions,omitempty"`
+}
+
+//+kubebuilder:object:root=true
+//+kubebuilder:subresource:status
+//+kubebuilder:resource:scope=Cluster
+
+// NodeReplacement is the Schema for the nodereplacements API.
+// It requests the replacement of nodes by new nodes using the current node version.
+type NodeReplacement struct {
+	metav1.TypeMeta   `json:",inline"`
+	metav1.ObjectMeta `json:"metadata,omitempty"`
+
+	Spec   NodeReplacementSpec   `json:"spec,omitempty"`
+	Status NodeReplacementStatus `json:"status,omitempty"`
+}
+
+//+kubebuilder:object:root=true
+
+// NodeReplacementList contains a list of NodeReplacement.
+type NodeReplacementList struct {
+	metav1.TypeMeta `json:",inline"`
+	metav1.ListMeta `json:"metadata,omitempty"`
+	Items           []NodeReplacement `json:"items"`
+}
+
+func init() {
+	SchemeBuilder.Register(&NodeReplacement{}, &NodeReplacementList{})
+}
@@ -11,6 +11,22 @@ import (
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 )
 
+const (
+	// ConditionUpgradeHalted is used to signal that the replacement of outdated nodes is halted.
+	ConditionUpgradeHalted = "UpgradeHalted"
+	// ConditionRolledBack is used to signal that an image upgrade was rolled back after a failed canary phase.
+	ConditionRolledBack = "RolledBack"
+
+	// CanaryPhaseReplacing is the phase in which canary nodes are created.
+	CanaryPhaseReplacing CanaryPhase = "Replacing"
+	// CanaryPhaseSoaking is the phase in which the health of the canary nodes is observed.
+	CanaryPhaseSoaking CanaryPhase = "Soaking"
+	// CanaryPhaseSucceeded is the phase after the canary nodes stayed healthy for the soak period.
+	CanaryPhaseSucceeded CanaryPhase = "Succeeded"
+	// CanaryPhaseFailed is the phase after a canary node became unhealthy.
+	CanaryPhaseFailed CanaryPhase = "Failed"
+)
+
 // NodeVersionSpec defines the desired state of NodeVersion.
 type NodeVersionSpec struct {
 	// ImageReference is the image to use for all nodes.
@@ -21,8 +37,67 @@ type NodeVersionSpec struct {
 	KubernetesComponentsReference string `json:"kubernetesComponentsReference,omitempty"`
 	// KubernetesClusterVersion is the advertised Kubernetes version of the cluster.
 	KubernetesClusterVersion string `json:"kubernetesClusterVersion,omitempty"`
+	// PreviousImageReference is the image that was used for all nodes before the current image upgrade.
+	// The image is restored if the canary phase of the upgrade fails.
+	PreviousImageReference string `json:"previousImage,omitempty"`
+	// PreviousImageVersion is the CSP independent version of the previous image.
+	PreviousImageVersion string `json:"previousImageVersion,omitempty"`
+	// UpgradeStrategy configures how outdated nodes are replaced.
+	UpgradeStrategy UpgradeStrategy `json:"upgradeStrategy,omitempty"`
+}
+
+// UpgradeStrategy configures how outdated nodes are replaced.
+type UpgradeStrategy struct {
+	// MaxSurge is the maximum number of extra nodes created during the upgrade at any point in time.
+	// Defaults to 1.
+	// +kubebuilder:validation:Minimum=1
+	MaxSurge int32 `json:"maxSurge,omitempty"`
+	// MaxSurgePerRole further limits the number of extra nodes in scaling groups of the given role.
+	MaxSurgePerRole map[NodeRole]int32 `json:"maxSurgePerRole,omitempty"`
+	// MaxSurgePerNodeGroup further limits the number of extra nodes in the scaling group with the given node group name.
+	MaxSurgePerNodeGroup map[string]int32 `json:"maxSurgePerNodeGroup,omitempty"`
+	// Paused stops the creation of new nodes and the replacement of outdated nodes.
+	Paused bool `json:"paused,omitempty"`
+	// MaintenanceWindows are the time windows in which outdated nodes may be replaced.
+	// If empty, nodes may be replaced at any time.
+	MaintenanceWindows []MaintenanceWindow `json:"maintenanceWindows,omitempty"`
+	// NodeTimeout is the time limit for replacing a single node.
+	// If a replacement takes longer, the upgrade halts until the spec is changed.
+	// If unset, there is no time limit.
+	NodeTimeout *metav1.Duration `json:"nodeTimeout,omitempty"`
+	// Canary configures a canary phase for image upgrades.
+	// If unset, all nodes are replaced without a canary phase.
+	Canary *CanaryStrategy `json:"canary,omitempty"`
+}
+
+// CanaryStrategy configures a canary phase for image upgrades.
+// After the control plane nodes are replaced, a subset of the worker nodes is replaced first.
+// The remaining worker nodes are only replaced if the canary nodes stay healthy for the soak period.
+// Otherwise, the previous image is restored.
+type CanaryStrategy struct {
+	// Nodes is the number of worker nodes that are replaced in the canary phase.
+	// +kubebuilder:validation:Minimum=1
+	Nodes int32 `json:"nodes"`
+	// SoakPeriod is the time the canary nodes have to stay healthy.
+	SoakPeriod metav1.Duration `json:"soakPeriod"`
 }
 
+// MaintenanceWindow is a recurring time window in which outdated nodes may be replaced.
+type MaintenanceWindow struct {
+	// Days are the days of the week on which the window starts.
+	// If empty, the window starts every day.
+	Days []Weekday `json:"days,omitempty"`
+	// Start is the time of day in UTC at which the window starts, formatted as HH:MM.
+	// +kubebuilder:validation:Pattern=`^([01][0-9]|2[0-3]):[0-5][0-9]$`
+	Start string `json:"start"`
+	// Duration is the length of the window.
+	Duration metav1.Duration `json:"duration"`
+}
+
+// Weekday is a day of the week.
+// +kubebuilder:validation:Enum=Monday;Tuesday;Wednesday;Thursday;Friday;Saturday;Sunday
+type Weekday string
+
 // NodeVersionStatus defines the observed state of NodeVersion.
 type NodeVersionStatus struct {
 	// Outdated is a list of nodes that are using an outdated image.
@@ -49,6 +124,30 @@ type NodeVersionStatus struct {
 	Conditions []metav1.Condition `json:"conditions"`
 	// ActiveClusterVersionUpgrade indicates whether the cluster is currently upgrading.
 	ActiveClusterVersionUpgrade bool `json:"activeclusterversionupgrade"`
+	// Canary is the state of the canary phase of the latest image upgrade.
+	Canary *CanaryStatus `json:"canary,omitempty"`
+}
+
+// CanaryPhase is the phase of a canary upgrade.
+// +kubebuilder:validation:Enum=Replacing;Soaking;Succeeded;Failed
+type CanaryPhase string
+
+// CanaryStatus is the observed state of the canary phase of an image upgrade.
+type CanaryStatus struct {
+	// ImageReference is the image that is tested by the canary nodes.
+	ImageReference string `json:"image"`
+	// PreviousImageReference is the image that is restored if the canary phase fails.
+	PreviousImageReference string `json:"previousImage,omitempty"`
+	// ObservedGeneration is the generation of the NodeVersion the canary phase was last evaluated for.
+	ObservedGeneration int64 `json:"observedGeneration,omitempty"`
+	// Phase is the phase of the canary upgrade.
+	Phase CanaryPhase `json:"phase"`
+	// Nodes are the names of the canary nodes.
+	Nodes []string `json:"nodes,omitempty"`
+	// SoakStartTime is the time at which all canary nodes were replaced.
+	SoakStartTime *metav1.Time `json:"soakStartTime,omitempty"`
+	// Message describes why the canary phase failed.
+	Message string `json:"message,omitempty"`
 }
 
 //+kubebuilder:object:root=true
@@ -0,0 +1,396 @@
+/*
+Copyright (c) Edgeless Systems GmbH
+
+SPDX-License-Identifier: BUSL-1.1
+*/
+
+package controllers
+
+import (
+	"context"
+	"time"
+
+	"github.com/edgelesssys/constellation/v2/operators/constellation-node-operator/internal/patch"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/labels"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/client-go/util/retry"
+	"k8s.io/utils/clock"
+	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/builder"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/event"
+	"sigs.k8s.io/controller-runtime/pkg/handler"
+	"sigs.k8s.io/controller-runtime/pkg/log"
+	"sigs.k8s.io/controller-runtime/pkg/predicate"
+	"sigs.k8s.io/controller-runtime/pkg/reconcile"
+
+	updatev1alpha1 "github.com/edgelesssys/constellation/v2/operators/constellation-node-operator/api/v1alpha1"
+)
+
+const (
+	// replaceAnnotation marks a node for replacement by the NodeVersion reconciler.
+	// Its value is the name of the NodeReplacement that selected the node.
+	replaceAnnotation = "constellation.edgeless.systems/replace"
+	// replacedNodeRetention is the time replaced nodes are kept in the status of a NodeReplacement with a maximum age.
+	replacedNodeRetention = time.Hour * 24
+
+	conditionReplacementCompletedReason       = "NodesReplaced"
+	conditionReplacementCompletedMessage      = "All selected nodes were replaced"
+	conditionReplacementInProgressReason      = "ReplacementInProgress"
+	conditionReplacementInProgressMessage     = "Selected nodes are replaced according to the upgrade strategy of the NodeVersion"
+	conditionReplacementRecurringReason       = "MaxAgeRecurring"
+	conditionReplacementRecurringMessage      = "Nodes are replaced whenever they exceed the maximum age"
+	conditionReplacementInvalidSelectorReason = "InvalidNodeSelector"
+)
+
+// NodeReplacementReconciler reconciles a NodeReplacement object.
+type NodeReplacementReconciler struct {
+	client.Client
+	Scheme *runtime.Scheme
+	clock.Clock
+}
+
+// NewNodeReplacementReconciler creates a new NodeReplacementReconciler.
+func NewNodeReplacementReconciler(client client.Client, scheme *runtime.Scheme) *NodeReplacementReconciler {
+	return &NodeReplacementReconciler{
+		Client: client,
+		Scheme: scheme,
+		Clock:  clock.RealClock{},
+	}
+}
+
+//+kubebuilder:rbac:groups=update.edgeless.systems,resources=nodereplacements,verbs=get;list;watch;create;update;patch;delete
+//+kubebuilder:rbac:groups=update.edgeless.systems,resources=nodereplacements/status,verbs=get;update;patch
+//+kubebuilder:rbac:groups=update.edgeless.systems,resources=nodereplacements/finalizers,verbs=update
+//+kubebuilder:rbac:groups="",resources=nodes,verbs=get;list;watch;patch
+
+// Reconcile marks the nodes selected by a NodeReplacement for replacement and tracks their progress.
+// The replacement itself is done by the NodeVersion reconciler, which treats marked nodes like outdated nodes.
+func (r *NodeReplacementReconciler) Reconcile(ctx context.Context, req ctrl.Request) (ctrl.Result, error) {
+	logr := log.FromContext(ctx)
+	logr.Info("Reconciling NodeReplacement")
+
+	var nodeList corev1.NodeList
+	if err := r.List(ctx, &nodeList); err != nil {
+		logr.Error(err, "Unable to list nodes")
+		return ctrl.Result{}, err
+	}
+
+	var nodeReplacement updatev1alpha1.NodeReplacement
+	if err := r.Get(ctx, req.NamespacedName, &nodeReplacement); err != nil {
+		if !errors.IsNotFound(err) {
+			logr.Error(err, "Unable to fetch NodeReplacement")
+			return ctrl.Result{}, err
+		}
+		// the NodeReplacement was deleted: stop replacing nodes that are not yet paired with an heir
+		return ctrl.Result{}, r.unmarkNodes(ctx, req.Name, nodeList.Items, nil)
+	}
+
+	now := r.Now()
+	selector, err := nodeReplacementSelector(&nodeReplacement)
+	if err != nil {
+		logr.Error(err, "Invalid node selector")
+		status := nodeReplacement.Status.DeepCopy()
+		meta.SetStatusCondition(&status.Conditions, metav1.Condition{
+			Type:               updatev1alpha1.ConditionReplacementCompleted,
+			Status:             metav1.ConditionFalse,
+			Reason:             conditionReplacementInvalidSelectorReason,
+			Message:            err.Error(),
+			ObservedGeneration: nodeReplacement.Generation,
+		})
+		return ctrl.Result{}, r.tryUpdateStatus(ctx, req.NamespacedName, *status)
+	}
+	selected, requeueAfter := selectNodes(&nodeReplacement, selector, nodeList.Items, now)
+
+	for _, node := range selected {
+		// nodes that are already marked, possibly by another NodeReplacement, keep their annotation
+		if node.Annotations[replaceAnnotation] != "" {
+			continue
+		}
+		logr.Info("Marking node for replacement", "node", node.Name)
+		if err := r.patchNodeAnnotations(ctx, node.Name, map[string]string{replaceAnnotation: nodeReplacement.Name}); err != nil {
+			logr.Error(err, "Unable to mark node for replacement", "node", node.Name)
+			return ctrl.Result{}, err
+		}
+	}
+	// nodes that no longer match the selection are only replaced if their replacement already started
+	if err := r.unmarkNodes(ctx, nodeReplacement.Name, nodeList.Items, selected); err != nil {
+		return ctrl.Result{}, err
+	}
+
+	status := nodeReplacementStatus(&nodeReplacement, selected, nodeList.Items, now)
+	if err := r.tryUpdateStatus(ctx, req.NamespacedName, status); err != nil {
+		logr.Error(err, "Updating status")
+		return ctrl.Result{}, err
+	}
+	return ctrl.Result{RequeueAfter: requeueAfter}, nil
+}
+
+// SetupWithManager sets up the controller with the Manager.
+func (r *NodeReplacementReconciler) SetupWithManager(mgr ctrl.Manager) error {
+	return ctrl.NewControllerManagedBy(mgr).
+		For(&updatev1alpha1.NodeReplacement{}, builder.WithPredicates(predicate.GenerationChangedPredicate{})).
+		Watches(
+			client.Object(&corev1.Node{}),
+			handler.EnqueueRequestsFromMapFunc(r.findObjectsForNode),
+			builder.WithPredicates(nodeReplacementProgressPredicate()),
+		).
+		Complete(r)
+}
+
+// unmarkNodes removes the replace annotation of a NodeReplacement from all nodes except the kept ones.
+// Nodes that are already paired with an heir keep the annotation, since their replacement is in progress.
+func (r *NodeReplacementReconciler) unmarkNodes(ctx context.Context, nodeReplacementName string, nodes, keep []corev1.Node) error {
+	logr := log.FromContext(ctx)
+	kept := make(map[string]struct{}, len(keep))
+	for _, node := range keep {
+		kept[node.Name] = struct{}{}
+	}
+	for _, node := range nodes {
+		if node.Annotations[replaceAnnotation] != nodeReplacementName || node.Annotations[heirAnnotation] != "" {
+			continue
+		}
+		if _, ok := kept[node.Name]; ok {
+			continue
+		}
+		logr.Info("Removing replacement mark from node", "node", node.Name)
+		if err := r.patchUnsetNodeAnnotations(ctx, node.Name, []string{replaceAnnotation}); err != nil {
+			logr.Error(err, "Unable to remove replacement mark from node", "node", node.Name)
+			return err
+		}
+	}
+	return nil
+}
+
+// findObjectsForNode requests a reconcile call for all node replacements,
+// and for the node replacement that marked the node, even if it no longer exists.
+func (r *NodeReplacementReconciler) findObjectsForNode(ctx context.Context, rawNode client.Object) []reconcile.Request {
+	var nodeReplacementList updatev1alpha1.NodeReplacementList
+	if err := r.List(ctx, &nodeReplacementList); err != nil {
+		return []reconcile.Request{}
+	}
+	requests := make([]reconcile.Request, 0, len(nodeReplacementList.Items)+1)
+	marked := rawNode.GetAnnotations()[replaceAnnotation]
+	for _, item := range nodeReplacementList.Items {
+		if item.GetName() == marked {
+			marked = ""
+		}
+		requests = append(requests, reconcile.Request{
+			NamespacedName: types.NamespacedName{Name: item.GetName()},
+		})
+	}
+	if marked != "" {
+		requests = append(requests, reconcile.Request{
+			NamespacedName: types.NamespacedName{Name: marked},
+		})
+	}
+	return requests
+}
+
+// patchNodeAnnotations attempts to patch node annotations in a retry loop.
+func (r *NodeReplacementReconciler) patchNodeAnnotations(ctx context.Context, nodeName string, annotations map[string]string) error {
+	return retry.RetryOnConflict(retry.DefaultRetry, func() error {
+		var node corev1.Node
+		if err := r.Get(ctx, types.NamespacedName{Name: nodeName}, &node); err != nil {
+			return err
+		}
+		patchedNode := node.DeepCopy()
+		patch := patch.SetAnnotations(&node, patchedNode, annotations)
+		return r.Client.Patch(ctx, patchedNode, patch)
+	})
+}
+
+// patchUnsetNodeAnnotations attempts to remove node annotations using a patch in a retry loop.
+func (r *NodeReplacementReconciler) patchUnsetNodeAnnotations(ctx context.Context, nodeName string, annotationKeys []string) error {
+	return retry.RetryOnConflict(retry.DefaultRetry, func() error {
+		var node corev1.Node
+		if err := r.Get(ctx, types.NamespacedName{Name: nodeName}, &node); err != nil {
+			return client.IgnoreNotFound(err)
+		}
+		patchedNode := node.DeepCopy()
+		patch := patch.UnsetAnnotations(&node, patchedNode, annotationKeys)
+		return r.Client.Patch(ctx, patchedNode, patch)
+	})
+}
+
+// tryUpdateStatus attempts to update the NodeReplacement status field in a retry loop.
+func (r *NodeReplacementReconciler) tryUpdateStatus(ctx context.Context, name types.NamespacedName, status updatev1alpha1.NodeReplacementStatus) error {
+	return retry.RetryOnConflict(retry.DefaultRetry, func() error {
+		var nodeReplacement updatev1alpha1.NodeReplacement
+		if err := r.Get(ctx, name, &nodeReplacement); err != nil {
+			return err
+		}
+		nodeReplacement.Status = *status.DeepCopy()
+		return r.Status().Update(ctx, &nodeReplacement)
+	})
+}
+
+// nodeReplacementSelector returns the label selector of a NodeReplacement.
+// A NodeReplacement without node selector matches all labels.
+func nodeReplacementSelector(nodeReplacement *updatev1alpha1.NodeReplacement) (labels.Selector, error) {
+	if nodeReplacement.Spec.NodeSelector == nil {
+		return labels.Everything(), nil
+	}
+	return metav1.LabelSelectorAsSelector(nodeReplacement.Spec.NodeSelector)
+}
+
+// selectNodes returns the nodes matching all criteria of a NodeReplacement.
+// For a NodeReplacement with a maximum age, it also returns the time until the next node exceeds the maximum age.
+func selectNodes(nodeReplacement *updatev1alpha1.NodeReplacement, selector labels.Selector, nodes []corev1.Node, now time.Time) ([]corev1.Node, time.Duration) {
+	spec := nodeReplacement.Spec
+	if len(spec.NodeNames) == 0 && spec.NodeSelector == nil && spec.MaxAge == nil {
+		// an empty spec must not select every node of the cluster
+		return nil, 0
+	}
+	names := make(map[string]struct{}, len(spec.NodeNames))
+	for _, name := range spec.NodeNames {
+		names[name] = struct{}{}
+	}
+
+	var selected []corev1.Node
+	var requeueAfter time.Duration
+	for _, node := range nodes {
+		// obsolete nodes are removed anyway
+		if node.Annotations[obsoleteAnnotation] == "true" {
+			continue
+		}
+		if _, ok := names[node.Name]; len(names) > 0 && !ok {
+			continue
+		}
+		if !selector.Matches(labels.Set(node.Labels)) {
+			continue
+		}
+		if spec.MaxAge == nil {
+			// without a maximum age, only nodes that existed before the request are replaced.
+			// this prevents heirs, which inherit the labels of their donors, from being replaced again.
+			if !node.CreationTimestamp.Before(&nodeReplacement.CreationTimestamp) {
+				continue
+			}
+		} else if age := now.Sub(node.CreationTimestamp.Time); age < spec.MaxAge.Duration {
+			if untilMaxAge := spec.MaxAge.Duration - age; requeueAfter == 0 || untilMaxAge < requeueAfter {
+				requeueAfter = untilMaxAge
+			}
+			continue
+		}
+		selected = append(selected, node)
+	}
+	return selected, requeueAfter
+}
+
+// nodeReplacementStatus computes the replacement progress of the nodes selected by a NodeReplacement.
+// Nodes that were tracked before keep being tracked until they are removed from the cluster.
+func nodeReplacementStatus(nodeReplacement *updatev1alpha1.NodeReplacement, selected, nodes []corev1.Node, now time.Time) updatev1alpha1.NodeReplacementStatus {
+	nodesByName := make(map[string]*corev1.Node, len(nodes))
+	for i := range nodes {
+		nodesByName[nodes[i].Name] = &nodes[i]
+	}
+	selectedNames := make(map[string]struct{}, len(selected))
+	for _, node := range selected {
+		selectedNames[node.Name] = struct{}{}
+	}
+	previousByName := make(map[string]updatev1alpha1.NodeReplacementNodeStatus, len(nodeReplacement.Status.Nodes))
+	for _, previous := range nodeReplacement.Status.Nodes {
+		previousByName[previous.Name] = previous
+	}
+
+	status := updatev1alpha1.NodeReplacementStatus{
+		Conditions: nodeReplacement.Status.Conditions,
+	}
+	track := func(name string, phase updatev1alpha1.NodeReplacementPhase, heir string) {
+		transitionTime := metav1.NewTime(now)
+		if previous, ok := previousByName[name]; ok && previous.Phase == phase {
+			transitionTime = previous.LastTransitionTime
+		}
+		status.Nodes = append(status.Nodes, updatev1alpha1.NodeReplacementNodeStatus{
+			Name:               name,
+			Phase:              phase,
+			Heir:               heir,
+			LastTransitionTime: transitionTime,
+		})
+	}
+
+	for _, previous := range nodeReplacement.Status.Nodes {
+		node, ok := nodesByName[previous.Name]
+		switch {
+		case !ok:
+			if nodeReplacement.Spec.MaxAge != nil && previous.Phase == updatev1alpha1.NodeReplacementPhaseReplaced &&
+				now.Sub(previous.LastTransitionTime.Time) > replacedNodeRetention {
+				// recurring replacements would otherwise grow their status indefinitely
+				continue
+			}
+			track(previous.Name, updatev1alpha1.NodeReplacementPhaseReplaced, previous.Heir)
+		case node.Annotations[heirAnnotation] != "" && node.Annotations[replaceAnnotation] != "":
+			track(node.Name, updatev1alpha1.NodeReplacementPhaseReplacing, node.Annotations[heirAnnotation])
+		default:
+			if _, ok := selectedNames[node.Name]; ok {
+				track(node.Name, updatev1alpha1.NodeReplacementPhasePending, "")
+			}
+		}
+	}
+	for _, node := range selected {
+		if _, ok := previousByName[node.Name]; ok {
+			continue
+		}
+		if heir := node.Annotations[heirAnnotation]; heir != "" {
+			track(node.Name, updatev1alpha1.NodeReplacementPhaseReplacing, heir)
+		} else {
+			track(node.Name, updatev1alpha1.NodeReplacementPhasePending, "")
+		}
+	}
+
+	completedCondition := metav1.Condition{
+		Type:               updatev1alpha1.ConditionReplacementCompleted,
+		ObservedGeneration: nodeReplacement.Generation,
+	}
+	switch {
+	case nodeReplacement.Spec.MaxAge != nil:
+		completedCondition.Status = metav1.ConditionFalse
+		completedCondition.Reason = conditionReplacementRecurringReason
+		completedCondition.Message = conditionReplacementRecurringMessage
+	case replacementCompleted(status.Nodes):
+		completedCondition.Status = metav1.ConditionTrue
+		completedCondition.Reason = conditionReplacementCompletedReason
+		completedCondition.Message = conditionReplacementCompletedMessage
+	default:
+		completedCondition.Status = metav1.ConditionFalse
+		completedCondition.Reason = conditionReplacementInProgressReason
+		completedCondition.Message = conditionReplacementInProgressMessage
+	}
+	meta.SetStatusCondition(&status.Conditions, completedCondition)
+	return status
+}
+
+// replacementCompleted checks if all tracked nodes were replaced.
+func replacementCompleted(nodes []updatev1alpha1.NodeReplacementNodeStatus) bool {
+	for _, node := range nodes {
+		if node.Phase != updatev1alpha1.NodeReplacementPhaseReplaced {
+			return false
+		}
+	}
+	return true
+}
+
+// nodeReplacementProgressPredicate checks if a node was created, deleted,
+// or changed in a way that affects its selection or replacement progress.
+func nodeReplacementProgressPredicate() predicate.Predicate {
+	return predicate.Funcs{
+		UpdateFunc: func(e event.UpdateEvent) bool {
+			oldNode, ok := e.ObjectOld.(*corev1.Node)
+			if !ok {
+				return false
+			}
+			newNode, ok := e.ObjectNew.(*corev1.Node)
+			if !ok {
+				return false
+			}
+			return oldNode.Annotations[replaceAnnotation] != newNode.Annotations[replaceAnnotation] ||
+				oldNode.Annotations[heirAnnotation] != newNode.Annotations[heirAnnotation] ||
+				!labels.Equals(oldNode.Labels, newNode.Labels)
+		},
+	}
+}
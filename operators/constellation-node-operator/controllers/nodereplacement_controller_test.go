@@ -0,0 +1,363 @@
+/*
+Copyright (c) Edgeless Systems GmbH
+
+SPDX-License-Identifier: BUSL-1.1
+*/
+
+package controllers
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/types"
+	"sigs.k8s.io/controller-runtime/pkg/event"
+	"sigs.k8s.io/controller-runtime/pkg/reconcile"
+
+	updatev1alpha1 "github.com/edgelesssys/constellation/v2/operators/constellation-node-operator/api/v1alpha1"
+)
+
+func TestSelectNodes(t *testing.T) {
+	now := time.Date(2024, 1, 10, 12, 0, 0, 0, time.UTC)
+	requestTime := metav1.NewTime(now.Add(-time.Hour))
+	newNode := func(name string, age time.Duration, labels, annotations map[string]string) corev1.Node {
+		return corev1.Node{
+			ObjectMeta: metav1.ObjectMeta{
+				Name:              name,
+				CreationTimestamp: metav1.NewTime(now.Add(-age)),
+				Labels:            labels,
+				Annotations:       annotations,
+			},
+		}
+	}
+	nodes := []corev1.Node{
+		newNode("worker-0", 48*time.Hour, map[string]string{"pool": "a"}, nil),
+		newNode("worker-1", 12*time.Hour, map[string]string{"pool": "b"}, nil),
+		newNode("worker-2", 30*time.Minute, map[string]string{"pool": "a"}, nil),
+		newNode("obsolete", 72*time.Hour, map[string]string{"pool": "a"}, map[string]string{obsoleteAnnotation: "true"}),
+	}
+
+	testCases := map[string]struct {
+		spec             updatev1alpha1.NodeReplacementSpec
+		wantSelected     []string
+		wantRequeueAfter time.Duration
+		wantErr          bool
+	}{
+		"empty spec selects no nodes": {},
+		"select by name": {
+			spec:         updatev1alpha1.NodeReplacementSpec{NodeNames: []string{"worker-1", "unknown"}},
+			wantSelected: []string{"worker-1"},
+		},
+		"select by label": {
+			spec: updatev1alpha1.NodeReplacementSpec{
+				NodeSelector: &metav1.LabelSelector{MatchLabels: map[string]string{"pool": "a"}},
+			},
+			// worker-2 was created after the request
+			wantSelected: []string{"worker-0"},
+		},
+		"select by name and label": {
+			spec: updatev1alpha1.NodeReplacementSpec{
+				NodeNames:    []string{"worker-0", "worker-1"},
+				NodeSelector: &metav1.LabelSelector{MatchLabels: map[string]string{"pool": "b"}},
+			},
+			wantSelected: []string{"worker-1"},
+		},
+		"select by max age": {
+			spec:             updatev1alpha1.NodeReplacementSpec{MaxAge: &metav1.Duration{Duration: 24 * time.Hour}},
+			wantSelected:     []string{"worker-0"},
+			wantRequeueAfter: 12 * time.Hour,
+		},
+		"max age includes nodes created after the request": {
+			spec:         updatev1alpha1.NodeReplacementSpec{MaxAge: &metav1.Duration{Duration: 10 * time.Minute}},
+			wantSelected: []string{"worker-0", "worker-1", "worker-2"},
+		},
+		"select by label and max age": {
+			spec: updatev1alpha1.NodeReplacementSpec{
+				NodeSelector: &metav1.LabelSelector{MatchLabels: map[string]string{"pool": "a"}},
+				MaxAge:       &metav1.Duration{Duration: time.Hour},
+			},
+			wantSelected:     []string{"worker-0"},
+			wantRequeueAfter: 30 * time.Minute,
+		},
+		"invalid label selector": {
+			spec: updatev1alpha1.NodeReplacementSpec{
+				NodeSelector: &metav1.LabelSelector{MatchExpressions: []metav1.LabelSelectorRequirement{
+					{Key: "pool", Operator: "invalid"},
+				}},
+			},
+			wantErr: true,
+		},
+	}
+
+	for name, tc := range testCases {
+		t.Run(name, func(t *testing.T) {
+			assert := assert.New(t)
+			require := require.New(t)
+
+			nodeReplacement := &updatev1alpha1.NodeReplacement{
+				ObjectMeta: metav1.ObjectMeta{Name: "replacement", CreationTimestamp: requestTime},
+				Spec:       tc.spec,
+			}
+			selector, err := nodeReplacementSelector(nodeReplacement)
+			if tc.wantErr {
+				assert.Error(err)
+				return
+			}
+			require.NoError(err)
+
+			selected, requeueAfter := selectNodes(nodeReplacement, selector, nodes, now)
+			var selectedNames []string
+			for _, node := range selected {
+				selectedNames = append(selectedNames, node.Name)
+			}
+			assert.Equal(tc.wantSelected, selectedNames)
+			assert.Equal(tc.wantRequeueAfter, requeueAfter)
+		})
+	}
+}
+
+func TestNodeReplacementStatus(t *testing.T) {
+	now := time.Date(2024, 1, 10, 12, 0, 0, 0, time.UTC)
+	earlier := metav1.NewTime(now.Add(-time.Hour))
+	longAgo := metav1.NewTime(now.Add(-48 * time.Hour))
+	nodeWithAnnotations := func(name string, annotations map[string]string) corev1.Node {
+		return corev1.Node{ObjectMeta: metav1.ObjectMeta{Name: name, Annotations: annotations}}
+	}
+
+	testCases := map[string]struct {
+		spec           updatev1alpha1.NodeReplacementSpec
+		previous       []updatev1alpha1.NodeReplacementNodeStatus
+		selected       []corev1.Node
+		nodes          []corev1.Node
+		wantNodes      []updatev1alpha1.NodeReplacementNodeStatus
+		wantCompleted  metav1.ConditionStatus
+		wantReasonText string
+	}{
+		"newly selected nodes are pending": {
+			selected: []corev1.Node{nodeWithAnnotations("worker-0", nil)},
+			nodes:    []corev1.Node{nodeWithAnnotations("worker-0", nil)},
+			wantNodes: []updatev1alpha1.NodeReplacementNodeStatus{
+				{Name: "worker-0", Phase: updatev1alpha1.NodeReplacementPhasePending, LastTransitionTime: metav1.NewTime(now)},
+			},
+			wantCompleted:  metav1.ConditionFalse,
+			wantReasonText: conditionReplacementInProgressReason,
+		},
+		"node paired with heir is replacing": {
+			previous: []updatev1alpha1.NodeReplacementNodeStatus{
+				{Name: "worker-0", Phase: updatev1alpha1.NodeReplacementPhasePending, LastTransitionTime: earlier},
+			},
+			selected: []corev1.Node{nodeWithAnnotations("worker-0", map[string]string{replaceAnnotation: "replacement", heirAnnotation: "worker-3"})},
+			nodes:    []corev1.Node{nodeWithAnnotations("worker-0", map[string]string{replaceAnnotation: "replacement", heirAnnotation: "worker-3"})},
+			wantNodes: []updatev1alpha1.NodeReplacementNodeStatus{
+				{Name: "worker-0", Phase: updatev1alpha1.NodeReplacementPhaseReplacing, Heir: "worker-3", LastTransitionTime: metav1.NewTime(now)},
+			},
+			wantCompleted:  metav1.ConditionFalse,
+			wantReasonText: conditionReplacementInProgressReason,
+		},
+		"unchanged phase keeps transition time": {
+			previous: []updatev1alpha1.NodeReplacementNodeStatus{
+				{Name: "worker-0", Phase: updatev1alpha1.NodeReplacementPhasePending, LastTransitionTime: earlier},
+			},
+			selected: []corev1.Node{nodeWithAnnotations("worker-0", map[string]string{replaceAnnotation: "replacement"})},
+			nodes:    []corev1.Node{nodeWithAnnotations("worker-0", map[string]string{replaceAnnotation: "replacement"})},
+			wantNodes: []updatev1alpha1.NodeReplacementNodeStatus{
+				{Name: "worker-0", Phase: updatev1alpha1.NodeReplacementPhasePending, LastTransitionTime: earlier},
+			},
+			wantCompleted:  metav1.ConditionFalse,
+			wantReasonText: conditionReplacementInProgressReason,
+		},
+		"removed node is replaced": {
+			previous: []updatev1alpha1.NodeReplacementNodeStatus{
+				{Name: "worker-0", Phase: updatev1alpha1.NodeReplacementPhaseReplacing, Heir: "worker-3", LastTransitionTime: earlier},
+			},
+			nodes: []corev1.Node{nodeWithAnnotations("worker-3", nil)},
+			wantNodes: []updatev1alpha1.NodeReplacementNodeStatus{
+				{Name: "worker-0", Phase: updatev1alpha1.NodeReplacementPhaseReplaced, Heir: "worker-3", LastTransitionTime: metav1.NewTime(now)},
+			},
+			wantCompleted:  metav1.ConditionTrue,
+			wantReasonText: conditionReplacementCompletedReason,
+		},
+		"deselected node that is still replacing is tracked": {
+			previous: []updatev1alpha1.NodeReplacementNodeStatus{
+				{Name: "worker-0", Phase: updatev1alpha1.NodeReplacementPhaseReplacing, Heir: "worker-3", LastTransitionTime: earlier},
+			},
+			nodes: []corev1.Node{nodeWithAnnotations("worker-0", map[string]string{replaceAnnotation: "replacement", heirAnnotation: "worker-3"})},
+			wantNodes: []updatev1alpha1.NodeReplacementNodeStatus{
+				{Name: "worker-0", Phase: updatev1alpha1.NodeReplacementPhaseReplacing, Heir: "worker-3", LastTransitionTime: earlier},
+			},
+			wantCompleted:  metav1.ConditionFalse,
+			wantReasonText: conditionReplacementInProgressReason,
+		},
+		"deselected pending node is no longer tracked": {
+			previous: []updatev1alpha1.NodeReplacementNodeStatus{
+				{Name: "worker-0", Phase: updatev1alpha1.NodeReplacementPhasePending, LastTransitionTime: earlier},
+			},
+			nodes:          []corev1.Node{nodeWithAnnotations("worker-0", nil)},
+			wantCompleted:  metav1.ConditionTrue,
+			wantReasonText: conditionReplacementCompletedReason,
+		},
+		"max age never completes": {
+			spec:           updatev1alpha1.NodeReplacementSpec{MaxAge: &metav1.Duration{Duration: time.Hour}},
+			wantCompleted:  metav1.ConditionFalse,
+			wantReasonText: conditionReplacementRecurringReason,
+		},
+		"max age forgets nodes replaced long ago": {
+			spec: updatev1alpha1.NodeReplacementSpec{MaxAge: &metav1.Duration{Duration: time.Hour}},
+			previous: []updatev1alpha1.NodeReplacementNodeStatus{
+				{Name: "worker-0", Phase: updatev1alpha1.NodeReplacementPhaseReplaced, LastTransitionTime: longAgo},
+				{Name: "worker-1", Phase: updatev1alpha1.NodeReplacementPhaseReplaced, LastTransitionTime: earlier},
+			},
+			wantNodes: []updatev1alpha1.NodeReplacementNodeStatus{
+				{Name: "worker-1", Phase: updatev1alpha1.NodeReplacementPhaseReplaced, LastTransitionTime: earlier},
+			},
+			wantCompleted:  metav1.ConditionFalse,
+			wantReasonText: conditionReplacementRecurringReason,
+		},
+	}
+
+	for name, tc := range testCases {
+		t.Run(name, func(t *testing.T) {
+			assert := assert.New(t)
+			require := require.New(t)
+
+			nodeReplacement := &updatev1alpha1.NodeReplacement{
+				ObjectMeta: metav1.ObjectMeta{Name: "replacement", Generation: 2},
+				Spec:       tc.spec,
+				Status:     updatev1alpha1.NodeReplacementStatus{Nodes: tc.previous},
+			}
+			status := nodeReplacementStatus(nodeReplacement, tc.selected, tc.nodes, now)
+			assert.Equal(tc.wantNodes, status.Nodes)
+			completed := meta.FindStatusCondition(status.Conditions, updatev1alpha1.ConditionReplacementCompleted)
+			require.NotNil(completed)
+			assert.Equal(tc.wantCompleted, completed.Status)
+			assert.Equal(tc.wantReasonText, completed.Reason)
+			assert.Equal(int64(2), completed.ObservedGeneration)
+		})
+	}
+}
+
+func TestNodeReplacementProgressPredicate(t *testing.T) {
+	testCases := map[string]struct {
+		event          event.UpdateEvent
+		wantProcessing bool
+	}{
+		"old object is not a node": {
+			event: event.UpdateEvent{
+				ObjectNew: &corev1.Node{},
+			},
+		},
+		"new object is not a node": {
+			event: event.UpdateEvent{
+				ObjectOld: &corev1.Node{},
+			},
+		},
+		"node is unchanged": {
+			event: event.UpdateEvent{
+				ObjectOld: &corev1.Node{},
+				ObjectNew: &corev1.Node{},
+			},
+		},
+		"node was marked for replacement": {
+			event: event.UpdateEvent{
+				ObjectOld: &corev1.Node{},
+				ObjectNew: &corev1.Node{
+					ObjectMeta: metav1.ObjectMeta{Annotations: map[string]string{replaceAnnotation: "replacement"}},
+				},
+			},
+			wantProcessing: true,
+		},
+		"node was paired with heir": {
+			event: event.UpdateEvent{
+				ObjectOld: &corev1.Node{},
+				ObjectNew: &corev1.Node{
+					ObjectMeta: metav1.ObjectMeta{Annotations: map[string]string{heirAnnotation: "heir"}},
+				},
+			},
+			wantProcessing: true,
+		},
+		"node labels changed": {
+			event: event.UpdateEvent{
+				ObjectOld: &corev1.Node{},
+				ObjectNew: &corev1.Node{
+					ObjectMeta: metav1.ObjectMeta{Labels: map[string]string{"pool": "a"}},
+				},
+			},
+			wantProcessing: true,
+		},
+	}
+
+	for name, tc := range testCases {
+		t.Run(name, func(t *testing.T) {
+			assert := assert.New(t)
+			predicate := nodeReplacementProgressPredicate()
+			assert.Equal(tc.wantProcessing, predicate.Update(tc.event))
+		})
+	}
+
+	t.Run("create", func(t *testing.T) {
+		assert := assert.New(t)
+		predicate := nodeReplacementProgressPredicate()
+		assert.True(predicate.Create(event.CreateEvent{}))
+	})
+
+	t.Run("delete", func(t *testing.T) {
+		assert := assert.New(t)
+		predicate := nodeReplacementProgressPredicate()
+		assert.True(predicate.Delete(event.DeleteEvent{}))
+	})
+}
+
+func TestFindNodeReplacementsForNode(t *testing.T) {
+	testCases := map[string]struct {
+		nodeReplacements []runtime.Object
+		listErr          error
+		annotations      map[string]string
+		wantRequests     []reconcile.Request
+	}{
+		"listing node replacements fails": {
+			listErr: errors.New("list-err"),
+		},
+		"all node replacements are requested": {
+			nodeReplacements: []runtime.Object{
+				&updatev1alpha1.NodeReplacement{ObjectMeta: metav1.ObjectMeta{Name: "replacement-a"}},
+				&updatev1alpha1.NodeReplacement{ObjectMeta: metav1.ObjectMeta{Name: "replacement-b"}},
+			},
+			annotations: map[string]string{replaceAnnotation: "replacement-a"},
+			wantRequests: []reconcile.Request{
+				{NamespacedName: types.NamespacedName{Name: "replacement-a"}},
+				{NamespacedName: types.NamespacedName{Name: "replacement-b"}},
+			},
+		},
+		"deleted node replacement that marked the node is requested": {
+			nodeReplacements: []runtime.Object{
+				&updatev1alpha1.NodeReplacement{ObjectMeta: metav1.ObjectMeta{Name: "replacement-a"}},
+			},
+			annotations: map[string]string{replaceAnnotation: "deleted"},
+			wantRequests: []reconcile.Request{
+				{NamespacedName: types.NamespacedName{Name: "replacement-a"}},
+				{NamespacedName: types.NamespacedName{Name: "deleted"}},
+			},
+		},
+	}
+
+	for name, tc := range testCases {
+		t.Run(name, func(t *testing.T) {
+			assert := assert.New(t)
+
+			reconciler := NodeReplacementReconciler{
+				Client: newStubReaderClient(t, tc.nodeReplacements, nil, tc.listErr),
+			}
+			requests := reconciler.findObjectsForNode(t.Context(), &corev1.Node{
+				ObjectMeta: metav1.ObjectMeta{Name: "worker-0", Annotations: tc.annotations},
+			})
+			assert.ElementsMatch(tc.wantRequests, requests)
+		})
+	}
+}
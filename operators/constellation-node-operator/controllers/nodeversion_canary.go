@@ -0,0 +1,300 @@
+/*
+Copyright (c) Edgeless Systems GmbH
+
+SPDX-License-Identifier: BUSL-1.1
+*/
+
+package controllers
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	nodeutil "github.com/edgelesssys/constellation/v2/operators/constellation-node-operator/internal/node"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/client-go/util/retry"
+
+	updatev1alpha1 "github.com/edgelesssys/constellation/v2/operators/constellation-node-operator/api/v1alpha1"
+)
+
+// nextCanaryStatus advances the canary phase of an image upgrade.
+// It returns nil if the NodeVersion has never been upgraded with a canary phase.
+// It also returns the duration after which the NodeVersion should be reconciled again to check the health of the canary nodes.
+//
+// An image upgrade has a canary phase if a canary strategy is configured and the previous image is known.
+// The canary phase passes through the following phases:
+// - Replacing: outdated worker nodes are replaced by up to the configured number of canary nodes.
+// - Soaking: the canary nodes are observed for the soak period.
+// - Succeeded: the canary nodes stayed healthy and the remaining nodes are replaced.
+// - Failed: a canary node became unhealthy and the previous image should be restored.
+func nextCanaryStatus(nodeVersion *updatev1alpha1.NodeVersion, groups nodeGroups, nodes []corev1.Node,
+	pendingNodes []updatev1alpha1.PendingNode, pods []corev1.Pod, now time.Time,
+) (*updatev1alpha1.CanaryStatus, time.Duration) {
+	spec := nodeVersion.Spec
+	strategy := spec.UpgradeStrategy.Canary
+	canary := nodeVersion.Status.Canary.DeepCopy()
+	if strategy == nil || spec.PreviousImageReference == "" || strings.EqualFold(spec.PreviousImageReference, spec.ImageReference) {
+		// no canary upgrade in progress: keep the result of the latest canary upgrade
+		return canary, 0
+	}
+	if canaryOutdated(canary, nodeVersion) {
+		canary = &updatev1alpha1.CanaryStatus{
+			ImageReference:         spec.ImageReference,
+			PreviousImageReference: spec.PreviousImageReference,
+			Phase:                  updatev1alpha1.CanaryPhaseReplacing,
+		}
+	}
+	canary.ObservedGeneration = nodeVersion.Generation
+
+	nodesByName := make(map[string]*corev1.Node, len(nodes))
+	for i := range nodes {
+		nodesByName[nodes[i].Name] = &nodes[i]
+	}
+
+	switch canary.Phase {
+	case updatev1alpha1.CanaryPhaseReplacing:
+		// canary nodes that became obsolete are no longer tracked, since they will be removed
+		canary.Nodes = filterNodeNames(canary.Nodes, groups.Obsolete)
+		if failure := canaryJoinFailure(canary.Nodes, nodesByName, pendingNodes); failure != "" {
+			return failCanary(canary, failure), 0
+		}
+
+		var outdatedWorkers int
+		for _, node := range append(append([]corev1.Node{}, groups.Outdated...), groups.Donors...) {
+			if !nodeutil.IsControlPlaneNode(&node) {
+				outdatedWorkers++
+			}
+		}
+		if len(canary.Nodes) == 0 && outdatedWorkers == 0 {
+			// all worker nodes were replaced outside of the canary phase, or there are no worker nodes at all
+			canary.Phase = updatev1alpha1.CanaryPhaseSucceeded
+			return canary, 0
+		}
+		if len(canary.Nodes) < int(strategy.Nodes) && outdatedWorkers > 0 {
+			return canary, 0
+		}
+		upToDate := make(map[string]struct{}, len(groups.UpToDate))
+		for _, node := range groups.UpToDate {
+			upToDate[node.Name] = struct{}{}
+		}
+		for _, name := range canary.Nodes {
+			if _, ok := upToDate[name]; !ok {
+				// replacement of the canary node is still in progress
+				return canary, 0
+			}
+		}
+		canary.Phase = updatev1alpha1.CanaryPhaseSoaking
+		soakStartTime := metav1.NewTime(now)
+		canary.SoakStartTime = &soakStartTime
+		return canary, canaryRequeueAfter(strategy.SoakPeriod.Duration)
+
+	case updatev1alpha1.CanaryPhaseSoaking:
+		soakEnd := now
+		if canary.SoakStartTime != nil {
+			soakEnd = canary.SoakStartTime.Add(strategy.SoakPeriod.Duration)
+		}
+		soaked := !now.Before(soakEnd)
+		if failure := canaryHealthFailure(canary.Nodes, nodesByName, pods, soaked); failure != "" {
+			return failCanary(canary, failure), 0
+		}
+		if soaked {
+			canary.Phase = updatev1alpha1.CanaryPhaseSucceeded
+			return canary, 0
+		}
+		return canary, canaryRequeueAfter(soakEnd.Sub(now))
+	}
+	return canary, 0
+}
+
+// canaryOutdated checks if a new canary phase has to be started for the image upgrade of the NodeVersion.
+// This is the case if the image or the previous image changed, or if the NodeVersion changed since the canary phase was last evaluated,
+// e.g., because an image upgrade that was rolled back is retried or the canary strategy changed.
+// A succeeded canary phase is kept for the same image upgrade, since the image already proved healthy.
+func canaryOutdated(canary *updatev1alpha1.CanaryStatus, nodeVersion *updatev1alpha1.NodeVersion) bool {
+	if canary == nil ||
+		!strings.EqualFold(canary.ImageReference, nodeVersion.Spec.ImageReference) ||
+		!strings.EqualFold(canary.PreviousImageReference, nodeVersion.Spec.PreviousImageReference) {
+		return true
+	}
+	return canary.Phase != updatev1alpha1.CanaryPhaseSucceeded && canary.ObservedGeneration != nodeVersion.Generation
+}
+
+// limitCanaryBudget restricts the creation of new worker nodes to the canary nodes until the canary phase succeeded.
+func limitCanaryBudget(budget *surgeBudget, canary *updatev1alpha1.CanaryStatus, strategy *updatev1alpha1.CanaryStrategy) {
+	if canary == nil || strategy == nil {
+		return
+	}
+	var remaining int
+	switch canary.Phase {
+	case updatev1alpha1.CanaryPhaseSucceeded:
+		return
+	case updatev1alpha1.CanaryPhaseReplacing:
+		remaining = remainingSurge(int(strategy.Nodes), len(canary.Nodes))
+	}
+	if budget.perRole == nil {
+		budget.perRole = make(map[updatev1alpha1.NodeRole]int)
+	}
+	if limit, ok := budget.perRole[updatev1alpha1.WorkerRole]; !ok || remaining < limit {
+		budget.perRole[updatev1alpha1.WorkerRole] = remaining
+	}
+}
+
+// canaryCondition generates the RolledBack condition from the state of the canary phase.
+func canaryCondition(canary *updatev1alpha1.CanaryStatus, generation int64) metav1.Condition {
+	condition := metav1.Condition{
+		Type:               updatev1alpha1.ConditionRolledBack,
+		Status:             metav1.ConditionFalse,
+		ObservedGeneration: generation,
+		Reason:             conditionCanaryHealthyReason,
+		Message:            conditionCanaryHealthyMessage,
+	}
+	if canary.Phase == updatev1alpha1.CanaryPhaseFailed {
+		condition.Status = metav1.ConditionTrue
+		condition.Reason = conditionCanaryFailedReason
+		condition.Message = fmt.Sprintf("Image upgrade to %s was rolled back: %s", canary.ImageReference, canary.Message)
+	}
+	return condition
+}
+
+// canaryJoinFailure checks if a canary node failed to join the cluster.
+// Nodes that fail the attestation by the join service never join the cluster,
+// so their pending node reaches its deadline and is turned into a leaving node.
+// The join service doesn't record failed attestations, since they fail during the aTLS handshake
+// before the node is known by name. An attestation failure is therefore only detected after the
+// deadline of the pending node and can't be told apart from other reasons for not joining.
+func canaryJoinFailure(canaryNodes []string, nodesByName map[string]*corev1.Node, pendingNodes []updatev1alpha1.PendingNode) string {
+	for _, name := range canaryNodes {
+		if _, ok := nodesByName[name]; ok {
+			continue
+		}
+		var joining bool
+		for _, pendingNode := range pendingNodes {
+			if pendingNode.Spec.NodeName != name {
+				continue
+			}
+			if pendingNode.Status.CSPNodeState == updatev1alpha1.NodeStateFailed {
+				return fmt.Sprintf("canary node %s failed at the cloud provider", name)
+			}
+			joining = pendingNode.Spec.Goal == updatev1alpha1.NodeGoalJoin
+		}
+		if !joining {
+			return fmt.Sprintf("canary node %s failed to join the cluster", name)
+		}
+	}
+	return ""
+}
+
+// canaryHealthFailure checks the health of the canary nodes and the pods running on them.
+// If soaked is set, all pods on canary nodes are also expected to be started.
+func canaryHealthFailure(canaryNodes []string, nodesByName map[string]*corev1.Node, pods []corev1.Pod, soaked bool) string {
+	canaries := make(map[string]struct{}, len(canaryNodes))
+	for _, name := range canaryNodes {
+		node, ok := nodesByName[name]
+		if !ok {
+			return fmt.Sprintf("canary node %s left the cluster", name)
+		}
+		if !nodeutil.Ready(node) {
+			return fmt.Sprintf("canary node %s is not ready", name)
+		}
+		canaries[name] = struct{}{}
+	}
+	for _, pod := range pods {
+		if _, ok := canaries[pod.Spec.NodeName]; !ok {
+			continue
+		}
+		if failure := podFailure(&pod); failure != "" {
+			return fmt.Sprintf("pod %s/%s on canary node %s %s", pod.Namespace, pod.Name, pod.Spec.NodeName, failure)
+		}
+		if soaked && pod.Status.Phase == corev1.PodPending {
+			return fmt.Sprintf("pod %s/%s on canary node %s was not started within the soak period", pod.Namespace, pod.Name, pod.Spec.NodeName)
+		}
+	}
+	return ""
+}
+
+// podFailure describes why a pod is failing, or returns an empty string.
+// Pods that fail on their own, for example the pods of failed jobs, are not considered.
+// Only pods rejected or evicted by the kubelet, which sets a reason, and crashing containers are reported.
+func podFailure(pod *corev1.Pod) string {
+	if pod.Status.Phase == corev1.PodFailed && pod.Status.Reason != "" {
+		return fmt.Sprintf("failed: %s", pod.Status.Reason)
+	}
+	for _, status := range append(append([]corev1.ContainerStatus{}, pod.Status.InitContainerStatuses...), pod.Status.ContainerStatuses...) {
+		if status.State.Waiting != nil && status.State.Waiting.Reason == "CrashLoopBackOff" {
+			return fmt.Sprintf("has crashing container %s", status.Name)
+		}
+	}
+	return ""
+}
+
+// failCanary marks the canary phase as failed.
+func failCanary(canary *updatev1alpha1.CanaryStatus, message string) *updatev1alpha1.CanaryStatus {
+	canary.Phase = updatev1alpha1.CanaryPhaseFailed
+	canary.Message = message
+	return canary
+}
+
+// filterNodeNames removes the names of the given nodes from names.
+func filterNodeNames(names []string, remove []corev1.Node) []string {
+	var filtered []string
+	for _, name := range names {
+		var found bool
+		for _, node := range remove {
+			if node.Name == name {
+				found = true
+				break
+			}
+		}
+		if !found {
+			filtered = append(filtered, name)
+		}
+	}
+	return filtered
+}
+
+// canaryRequeueAfter limits the time until the canary nodes are checked again.
+func canaryRequeueAfter(d time.Duration) time.Duration {
+	if d > canaryCheckInterval {
+		return canaryCheckInterval
+	}
+	return d
+}
+
+// rollbackImage restores the previous image after the canary phase of the upgrade to the given image failed.
+func (r *NodeVersionReconciler) rollbackImage(ctx context.Context, name types.NamespacedName, failedImage string) error {
+	return retry.RetryOnConflict(retry.DefaultRetry, func() error {
+		var nodeVersion updatev1alpha1.NodeVersion
+		if err := r.Get(ctx, name, &nodeVersion); err != nil {
+			return err
+		}
+		if !strings.EqualFold(nodeVersion.Spec.ImageReference, failedImage) {
+			// image was already changed
+			return nil
+		}
+		if nodeVersion.Spec.PreviousImageReference == "" {
+			return errors.New("previous image is unknown")
+		}
+		nodeVersion.Spec.ImageReference = nodeVersion.Spec.PreviousImageReference
+		nodeVersion.Spec.ImageVersion = nodeVersion.Spec.PreviousImageVersion
+		nodeVersion.Spec.PreviousImageReference = ""
+		nodeVersion.Spec.PreviousImageVersion = ""
+		return r.Update(ctx, &nodeVersion)
+	})
+}
+
+// tryUpdateCanaryStatus attempts to update the canary state of the NodeVersion status in a retry loop.
+func (r *NodeVersionReconciler) tryUpdateCanaryStatus(ctx context.Context, name types.NamespacedName, canary *updatev1alpha1.CanaryStatus) error {
+	return retry.RetryOnConflict(retry.DefaultRetry, func() error {
+		var nodeVersion updatev1alpha1.NodeVersion
+		if err := r.Get(ctx, name, &nodeVersion); err != nil {
+			return err
+		}
+		nodeVersion.Status.Canary = canary.DeepCopy()
+		return r.Status().Update(ctx, &nodeVersion)
+	})
+}
@@ -0,0 +1,609 @@
+/*
+Copyright (c) Edgeless Systems GmbH
+
+SPDX-License-Identifier: BUSL-1.1
+*/
+
+package controllers
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+
+	updatev1alpha1 "github.com/edgelesssys/constellation/v2/operators/constellation-node-operator/api/v1alpha1"
+)
+
+func TestNextCanaryStatus(t *testing.T) {
+	now := time.Date(2024, time.January, 1, 12, 0, 0, 0, time.UTC)
+	soakStart := metav1.NewTime(now.Add(-5 * time.Minute))
+	readyNode := func(name string) corev1.Node {
+		return corev1.Node{
+			ObjectMeta: metav1.ObjectMeta{Name: name},
+			Status: corev1.NodeStatus{
+				Conditions: []corev1.NodeCondition{{Type: corev1.NodeReady, Status: corev1.ConditionTrue}},
+			},
+		}
+	}
+	notReadyNode := func(name string) corev1.Node {
+		return corev1.Node{
+			ObjectMeta: metav1.ObjectMeta{Name: name},
+			Status: corev1.NodeStatus{
+				Conditions: []corev1.NodeCondition{{Type: corev1.NodeReady, Status: corev1.ConditionFalse}},
+			},
+		}
+	}
+	controlPlaneNode := corev1.Node{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:   "control-plane-node",
+			Labels: map[string]string{"node-role.kubernetes.io/control-plane": ""},
+		},
+	}
+	canaryStrategy := &updatev1alpha1.CanaryStrategy{
+		Nodes:      1,
+		SoakPeriod: metav1.Duration{Duration: 10 * time.Minute},
+	}
+
+	testCases := map[string]struct {
+		strategy         *updatev1alpha1.CanaryStrategy
+		previousImage    string
+		generation       int64
+		canary           *updatev1alpha1.CanaryStatus
+		groups           nodeGroups
+		nodes            []corev1.Node
+		pendingNodes     []updatev1alpha1.PendingNode
+		pods             []corev1.Pod
+		wantCanary       *updatev1alpha1.CanaryStatus
+		wantRequeueAfter time.Duration
+	}{
+		"no canary strategy": {
+			previousImage: "image-1",
+		},
+		"previous image unknown": {
+			strategy: canaryStrategy,
+		},
+		"previous status is kept after upgrade": {
+			strategy:      canaryStrategy,
+			previousImage: "image-2",
+			canary:        &updatev1alpha1.CanaryStatus{ImageReference: "image-1", Phase: updatev1alpha1.CanaryPhaseFailed, Message: "failure"},
+			wantCanary:    &updatev1alpha1.CanaryStatus{ImageReference: "image-1", Phase: updatev1alpha1.CanaryPhaseFailed, Message: "failure"},
+		},
+		"canary phase starts": {
+			strategy:      canaryStrategy,
+			previousImage: "image-1",
+			groups:        nodeGroups{Outdated: []corev1.Node{readyNode("outdated-node")}},
+			wantCanary:    &updatev1alpha1.CanaryStatus{ImageReference: "image-2", PreviousImageReference: "image-1", Phase: updatev1alpha1.CanaryPhaseReplacing},
+		},
+		"canary phase of previous upgrade is reset": {
+			strategy:      canaryStrategy,
+			previousImage: "image-1",
+			canary:        &updatev1alpha1.CanaryStatus{ImageReference: "image-1", Phase: updatev1alpha1.CanaryPhaseSucceeded, Nodes: []string{"old-canary"}},
+			groups:        nodeGroups{Outdated: []corev1.Node{readyNode("outdated-node")}},
+			wantCanary:    &updatev1alpha1.CanaryStatus{ImageReference: "image-2", PreviousImageReference: "image-1", Phase: updatev1alpha1.CanaryPhaseReplacing},
+		},
+		"canary phase is reset when previous image changes": {
+			strategy:      canaryStrategy,
+			previousImage: "image-1",
+			canary: &updatev1alpha1.CanaryStatus{
+				ImageReference:         "image-2",
+				PreviousImageReference: "image-0",
+				Phase:                  updatev1alpha1.CanaryPhaseSoaking,
+				Nodes:                  []string{"old-canary"},
+				SoakStartTime:          &soakStart,
+			},
+			groups:     nodeGroups{Outdated: []corev1.Node{readyNode("outdated-node")}},
+			wantCanary: &updatev1alpha1.CanaryStatus{ImageReference: "image-2", PreviousImageReference: "image-1", Phase: updatev1alpha1.CanaryPhaseReplacing},
+		},
+		"canary phase is reset when retrying a rolled back upgrade": {
+			strategy:      canaryStrategy,
+			previousImage: "image-1",
+			generation:    3,
+			canary: &updatev1alpha1.CanaryStatus{
+				ImageReference:         "image-2",
+				PreviousImageReference: "image-1",
+				ObservedGeneration:     1,
+				Phase:                  updatev1alpha1.CanaryPhaseFailed,
+				Nodes:                  []string{"old-canary"},
+				Message:                "failure",
+			},
+			groups: nodeGroups{Outdated: []corev1.Node{readyNode("outdated-node")}},
+			wantCanary: &updatev1alpha1.CanaryStatus{
+				ImageReference:         "image-2",
+				PreviousImageReference: "image-1",
+				ObservedGeneration:     3,
+				Phase:                  updatev1alpha1.CanaryPhaseReplacing,
+			},
+		},
+		"canary phase is reset when NodeVersion changes": {
+			strategy:      canaryStrategy,
+			previousImage: "image-1",
+			generation:    2,
+			canary: &updatev1alpha1.CanaryStatus{
+				ImageReference:         "image-2",
+				PreviousImageReference: "image-1",
+				ObservedGeneration:     1,
+				Phase:                  updatev1alpha1.CanaryPhaseSoaking,
+				Nodes:                  []string{"canary-node"},
+				SoakStartTime:          &soakStart,
+			},
+			groups: nodeGroups{Outdated: []corev1.Node{readyNode("outdated-node")}},
+			wantCanary: &updatev1alpha1.CanaryStatus{
+				ImageReference:         "image-2",
+				PreviousImageReference: "image-1",
+				ObservedGeneration:     2,
+				Phase:                  updatev1alpha1.CanaryPhaseReplacing,
+			},
+		},
+		"succeeded canary phase is kept when NodeVersion changes": {
+			strategy:      canaryStrategy,
+			previousImage: "image-1",
+			generation:    2,
+			canary: &updatev1alpha1.CanaryStatus{
+				ImageReference:         "image-2",
+				PreviousImageReference: "image-1",
+				ObservedGeneration:     1,
+				Phase:                  updatev1alpha1.CanaryPhaseSucceeded,
+				Nodes:                  []string{"canary-node"},
+			},
+			groups: nodeGroups{Outdated: []corev1.Node{readyNode("outdated-node")}},
+			wantCanary: &updatev1alpha1.CanaryStatus{
+				ImageReference:         "image-2",
+				PreviousImageReference: "image-1",
+				ObservedGeneration:     2,
+				Phase:                  updatev1alpha1.CanaryPhaseSucceeded,
+				Nodes:                  []string{"canary-node"},
+			},
+		},
+		"only control plane nodes outdated": {
+			strategy:      canaryStrategy,
+			previousImage: "image-1",
+			groups:        nodeGroups{Outdated: []corev1.Node{controlPlaneNode}},
+			wantCanary:    &updatev1alpha1.CanaryStatus{ImageReference: "image-2", PreviousImageReference: "image-1", Phase: updatev1alpha1.CanaryPhaseSucceeded},
+		},
+		"canary node joining": {
+			strategy:      canaryStrategy,
+			previousImage: "image-1",
+			canary:        &updatev1alpha1.CanaryStatus{ImageReference: "image-2", PreviousImageReference: "image-1", Phase: updatev1alpha1.CanaryPhaseReplacing, Nodes: []string{"canary-node"}},
+			groups:        nodeGroups{Outdated: []corev1.Node{readyNode("outdated-node")}},
+			pendingNodes: []updatev1alpha1.PendingNode{
+				{Spec: updatev1alpha1.PendingNodeSpec{NodeName: "canary-node", Goal: updatev1alpha1.NodeGoalJoin}},
+			},
+			wantCanary: &updatev1alpha1.CanaryStatus{ImageReference: "image-2", PreviousImageReference: "image-1", Phase: updatev1alpha1.CanaryPhaseReplacing, Nodes: []string{"canary-node"}},
+		},
+		"canary node replacing outdated node": {
+			strategy:      canaryStrategy,
+			previousImage: "image-1",
+			canary:        &updatev1alpha1.CanaryStatus{ImageReference: "image-2", PreviousImageReference: "image-1", Phase: updatev1alpha1.CanaryPhaseReplacing, Nodes: []string{"canary-node"}},
+			groups: nodeGroups{
+				Heirs:  []corev1.Node{readyNode("canary-node")},
+				Donors: []corev1.Node{readyNode("outdated-node")},
+			},
+			nodes:      []corev1.Node{readyNode("canary-node"), readyNode("outdated-node")},
+			wantCanary: &updatev1alpha1.CanaryStatus{ImageReference: "image-2", PreviousImageReference: "image-1", Phase: updatev1alpha1.CanaryPhaseReplacing, Nodes: []string{"canary-node"}},
+		},
+		"canary node replaced outdated node": {
+			strategy:      canaryStrategy,
+			previousImage: "image-1",
+			canary:        &updatev1alpha1.CanaryStatus{ImageReference: "image-2", PreviousImageReference: "image-1", Phase: updatev1alpha1.CanaryPhaseReplacing, Nodes: []string{"canary-node"}},
+			groups: nodeGroups{
+				UpToDate: []corev1.Node{readyNode("canary-node")},
+				Outdated: []corev1.Node{readyNode("outdated-node")},
+			},
+			nodes: []corev1.Node{readyNode("canary-node"), readyNode("outdated-node")},
+			wantCanary: &updatev1alpha1.CanaryStatus{
+				ImageReference:         "image-2",
+				PreviousImageReference: "image-1",
+				Phase:                  updatev1alpha1.CanaryPhaseSoaking,
+				Nodes:                  []string{"canary-node"},
+				SoakStartTime:          &metav1.Time{Time: now},
+			},
+			wantRequeueAfter: time.Minute,
+		},
+		"obsolete canary node is no longer tracked": {
+			strategy:      canaryStrategy,
+			previousImage: "image-1",
+			canary:        &updatev1alpha1.CanaryStatus{ImageReference: "image-2", PreviousImageReference: "image-1", Phase: updatev1alpha1.CanaryPhaseReplacing, Nodes: []string{"canary-node"}},
+			groups: nodeGroups{
+				Outdated: []corev1.Node{readyNode("outdated-node")},
+				Obsolete: []corev1.Node{readyNode("canary-node")},
+			},
+			nodes:      []corev1.Node{readyNode("canary-node"), readyNode("outdated-node")},
+			wantCanary: &updatev1alpha1.CanaryStatus{ImageReference: "image-2", PreviousImageReference: "image-1", Phase: updatev1alpha1.CanaryPhaseReplacing},
+		},
+		"canary node failed to join": {
+			strategy:      canaryStrategy,
+			previousImage: "image-1",
+			canary:        &updatev1alpha1.CanaryStatus{ImageReference: "image-2", PreviousImageReference: "image-1", Phase: updatev1alpha1.CanaryPhaseReplacing, Nodes: []string{"canary-node"}},
+			groups:        nodeGroups{Outdated: []corev1.Node{readyNode("outdated-node")}},
+			pendingNodes: []updatev1alpha1.PendingNode{
+				{Spec: updatev1alpha1.PendingNodeSpec{NodeName: "canary-node", Goal: updatev1alpha1.NodeGoalLeave}},
+			},
+			wantCanary: &updatev1alpha1.CanaryStatus{
+				ImageReference:         "image-2",
+				PreviousImageReference: "image-1",
+				Phase:                  updatev1alpha1.CanaryPhaseFailed,
+				Nodes:                  []string{"canary-node"},
+				Message:                "canary node canary-node failed to join the cluster",
+			},
+		},
+		"canary node failed at cloud provider": {
+			strategy:      canaryStrategy,
+			previousImage: "image-1",
+			canary:        &updatev1alpha1.CanaryStatus{ImageReference: "image-2", PreviousImageReference: "image-1", Phase: updatev1alpha1.CanaryPhaseReplacing, Nodes: []string{"canary-node"}},
+			groups:        nodeGroups{Outdated: []corev1.Node{readyNode("outdated-node")}},
+			pendingNodes: []updatev1alpha1.PendingNode{
+				{
+					Spec:   updatev1alpha1.PendingNodeSpec{NodeName: "canary-node", Goal: updatev1alpha1.NodeGoalJoin},
+					Status: updatev1alpha1.PendingNodeStatus{CSPNodeState: updatev1alpha1.NodeStateFailed},
+				},
+			},
+			wantCanary: &updatev1alpha1.CanaryStatus{
+				ImageReference:         "image-2",
+				PreviousImageReference: "image-1",
+				Phase:                  updatev1alpha1.CanaryPhaseFailed,
+				Nodes:                  []string{"canary-node"},
+				Message:                "canary node canary-node failed at the cloud provider",
+			},
+		},
+		"canary node soaking": {
+			strategy:      canaryStrategy,
+			previousImage: "image-1",
+			canary: &updatev1alpha1.CanaryStatus{
+				ImageReference:         "image-2",
+				PreviousImageReference: "image-1",
+				Phase:                  updatev1alpha1.CanaryPhaseSoaking,
+				Nodes:                  []string{"canary-node"},
+				SoakStartTime:          &soakStart,
+			},
+			nodes: []corev1.Node{readyNode("canary-node")},
+			pods: []corev1.Pod{
+				{Spec: corev1.PodSpec{NodeName: "canary-node"}, Status: corev1.PodStatus{Phase: corev1.PodPending}},
+			},
+			wantCanary: &updatev1alpha1.CanaryStatus{
+				ImageReference:         "image-2",
+				PreviousImageReference: "image-1",
+				Phase:                  updatev1alpha1.CanaryPhaseSoaking,
+				Nodes:                  []string{"canary-node"},
+				SoakStartTime:          &soakStart,
+			},
+			wantRequeueAfter: time.Minute,
+		},
+		"canary node soaking until end of soak period": {
+			strategy: &updatev1alpha1.CanaryStrategy{
+				Nodes:      1,
+				SoakPeriod: metav1.Duration{Duration: 5*time.Minute + 30*time.Second},
+			},
+			previousImage: "image-1",
+			canary: &updatev1alpha1.CanaryStatus{
+				ImageReference:         "image-2",
+				PreviousImageReference: "image-1",
+				Phase:                  updatev1alpha1.CanaryPhaseSoaking,
+				Nodes:                  []string{"canary-node"},
+				SoakStartTime:          &soakStart,
+			},
+			nodes: []corev1.Node{readyNode("canary-node")},
+			wantCanary: &updatev1alpha1.CanaryStatus{
+				ImageReference:         "image-2",
+				PreviousImageReference: "image-1",
+				Phase:                  updatev1alpha1.CanaryPhaseSoaking,
+				Nodes:                  []string{"canary-node"},
+				SoakStartTime:          &soakStart,
+			},
+			wantRequeueAfter: 30 * time.Second,
+		},
+		"canary node not ready": {
+			strategy:      canaryStrategy,
+			previousImage: "image-1",
+			canary: &updatev1alpha1.CanaryStatus{
+				ImageReference:         "image-2",
+				PreviousImageReference: "image-1",
+				Phase:                  updatev1alpha1.CanaryPhaseSoaking,
+				Nodes:                  []string{"canary-node"},
+				SoakStartTime:          &soakStart,
+			},
+			nodes: []corev1.Node{notReadyNode("canary-node")},
+			wantCanary: &updatev1alpha1.CanaryStatus{
+				ImageReference:         "image-2",
+				PreviousImageReference: "image-1",
+				Phase:                  updatev1alpha1.CanaryPhaseFailed,
+				Nodes:                  []string{"canary-node"},
+				SoakStartTime:          &soakStart,
+				Message:                "canary node canary-node is not ready",
+			},
+		},
+		"canary node left cluster": {
+			strategy:      canaryStrategy,
+			previousImage: "image-1",
+			canary: &updatev1alpha1.CanaryStatus{
+				ImageReference:         "image-2",
+				PreviousImageReference: "image-1",
+				Phase:                  updatev1alpha1.CanaryPhaseSoaking,
+				Nodes:                  []string{"canary-node"},
+				SoakStartTime:          &soakStart,
+			},
+			wantCanary: &updatev1alpha1.CanaryStatus{
+				ImageReference:         "image-2",
+				PreviousImageReference: "image-1",
+				Phase:                  updatev1alpha1.CanaryPhaseFailed,
+				Nodes:                  []string{"canary-node"},
+				SoakStartTime:          &soakStart,
+				Message:                "canary node canary-node left the cluster",
+			},
+		},
+		"crashing pod on canary node": {
+			strategy:      canaryStrategy,
+			previousImage: "image-1",
+			canary: &updatev1alpha1.CanaryStatus{
+				ImageReference:         "image-2",
+				PreviousImageReference: "image-1",
+				Phase:                  updatev1alpha1.CanaryPhaseSoaking,
+				Nodes:                  []string{"canary-node"},
+				SoakStartTime:          &soakStart,
+			},
+			nodes: []corev1.Node{readyNode("canary-node")},
+			pods: []corev1.Pod{
+				{
+					ObjectMeta: metav1.ObjectMeta{Namespace: "kube-system", Name: "cilium"},
+					Spec:       corev1.PodSpec{NodeName: "canary-node"},
+					Status: corev1.PodStatus{
+						Phase: corev1.PodRunning,
+						ContainerStatuses: []corev1.ContainerStatus{
+							{Name: "agent", State: corev1.ContainerState{Waiting: &corev1.ContainerStateWaiting{Reason: "CrashLoopBackOff"}}},
+						},
+					},
+				},
+			},
+			wantCanary: &updatev1alpha1.CanaryStatus{
+				ImageReference:         "image-2",
+				PreviousImageReference: "image-1",
+				Phase:                  updatev1alpha1.CanaryPhaseFailed,
+				Nodes:                  []string{"canary-node"},
+				SoakStartTime:          &soakStart,
+				Message:                "pod kube-system/cilium on canary node canary-node has crashing container agent",
+			},
+		},
+		"crashing pod on other node": {
+			strategy:      canaryStrategy,
+			previousImage: "image-1",
+			canary: &updatev1alpha1.CanaryStatus{
+				ImageReference:         "image-2",
+				PreviousImageReference: "image-1",
+				Phase:                  updatev1alpha1.CanaryPhaseSoaking,
+				Nodes:                  []string{"canary-node"},
+				SoakStartTime:          &soakStart,
+			},
+			nodes: []corev1.Node{readyNode("canary-node")},
+			pods: []corev1.Pod{
+				{
+					Spec: corev1.PodSpec{NodeName: "other-node"},
+					Status: corev1.PodStatus{
+						ContainerStatuses: []corev1.ContainerStatus{
+							{Name: "agent", State: corev1.ContainerState{Waiting: &corev1.ContainerStateWaiting{Reason: "CrashLoopBackOff"}}},
+						},
+					},
+				},
+			},
+			wantCanary: &updatev1alpha1.CanaryStatus{
+				ImageReference:         "image-2",
+				PreviousImageReference: "image-1",
+				Phase:                  updatev1alpha1.CanaryPhaseSoaking,
+				Nodes:                  []string{"canary-node"},
+				SoakStartTime:          &soakStart,
+			},
+			wantRequeueAfter: time.Minute,
+		},
+		"pod pending after soak period": {
+			strategy: &updatev1alpha1.CanaryStrategy{
+				Nodes:      1,
+				SoakPeriod: metav1.Duration{Duration: 5 * time.Minute},
+			},
+			previousImage: "image-1",
+			canary: &updatev1alpha1.CanaryStatus{
+				ImageReference:         "image-2",
+				PreviousImageReference: "image-1",
+				Phase:                  updatev1alpha1.CanaryPhaseSoaking,
+				Nodes:                  []string{"canary-node"},
+				SoakStartTime:          &soakStart,
+			},
+			nodes: []corev1.Node{readyNode("canary-node")},
+			pods: []corev1.Pod{
+				{
+					ObjectMeta: metav1.ObjectMeta{Namespace: "default", Name: "app"},
+					Spec:       corev1.PodSpec{NodeName: "canary-node"},
+					Status:     corev1.PodStatus{Phase: corev1.PodPending},
+				},
+			},
+			wantCanary: &updatev1alpha1.CanaryStatus{
+				ImageReference:         "image-2",
+				PreviousImageReference: "image-1",
+				Phase:                  updatev1alpha1.CanaryPhaseFailed,
+				Nodes:                  []string{"canary-node"},
+				SoakStartTime:          &soakStart,
+				Message:                "pod default/app on canary node canary-node was not started within the soak period",
+			},
+		},
+		"canary phase succeeded": {
+			strategy: &updatev1alpha1.CanaryStrategy{
+				Nodes:      1,
+				SoakPeriod: metav1.Duration{Duration: 5 * time.Minute},
+			},
+			previousImage: "image-1",
+			canary: &updatev1alpha1.CanaryStatus{
+				ImageReference:         "image-2",
+				PreviousImageReference: "image-1",
+				Phase:                  updatev1alpha1.CanaryPhaseSoaking,
+				Nodes:                  []string{"canary-node"},
+				SoakStartTime:          &soakStart,
+			},
+			nodes: []corev1.Node{readyNode("canary-node")},
+			pods: []corev1.Pod{
+				{Spec: corev1.PodSpec{NodeName: "canary-node"}, Status: corev1.PodStatus{Phase: corev1.PodRunning}},
+			},
+			wantCanary: &updatev1alpha1.CanaryStatus{
+				ImageReference:         "image-2",
+				PreviousImageReference: "image-1",
+				Phase:                  updatev1alpha1.CanaryPhaseSucceeded,
+				Nodes:                  []string{"canary-node"},
+				SoakStartTime:          &soakStart,
+			},
+		},
+	}
+
+	for name, tc := range testCases {
+		t.Run(name, func(t *testing.T) {
+			assert := assert.New(t)
+
+			nodeVersion := &updatev1alpha1.NodeVersion{
+				ObjectMeta: metav1.ObjectMeta{Generation: tc.generation},
+				Spec: updatev1alpha1.NodeVersionSpec{
+					ImageReference:         "image-2",
+					PreviousImageReference: tc.previousImage,
+					UpgradeStrategy:        updatev1alpha1.UpgradeStrategy{Canary: tc.strategy},
+				},
+				Status: updatev1alpha1.NodeVersionStatus{Canary: tc.canary},
+			}
+
+			canary, requeueAfter := nextCanaryStatus(nodeVersion, tc.groups, tc.nodes, tc.pendingNodes, tc.pods, now)
+			assert.Equal(tc.wantCanary, canary)
+			assert.Equal(tc.wantRequeueAfter, requeueAfter)
+		})
+	}
+}
+
+func TestLimitCanaryBudget(t *testing.T) {
+	strategy := &updatev1alpha1.CanaryStrategy{Nodes: 2}
+
+	testCases := map[string]struct {
+		canary      *updatev1alpha1.CanaryStatus
+		strategy    *updatev1alpha1.CanaryStrategy
+		perRole     map[updatev1alpha1.NodeRole]int
+		wantPerRole map[updatev1alpha1.NodeRole]int
+	}{
+		"no canary phase": {
+			strategy:    strategy,
+			perRole:     map[updatev1alpha1.NodeRole]int{},
+			wantPerRole: map[updatev1alpha1.NodeRole]int{},
+		},
+		"replacing": {
+			canary:      &updatev1alpha1.CanaryStatus{Phase: updatev1alpha1.CanaryPhaseReplacing, Nodes: []string{"canary-node"}},
+			strategy:    strategy,
+			wantPerRole: map[updatev1alpha1.NodeRole]int{updatev1alpha1.WorkerRole: 1},
+		},
+		"replacing with lower role limit": {
+			canary:      &updatev1alpha1.CanaryStatus{Phase: updatev1alpha1.CanaryPhaseReplacing},
+			strategy:    strategy,
+			perRole:     map[updatev1alpha1.NodeRole]int{updatev1alpha1.WorkerRole: 1},
+			wantPerRole: map[updatev1alpha1.NodeRole]int{updatev1alpha1.WorkerRole: 1},
+		},
+		"soaking": {
+			canary:      &updatev1alpha1.CanaryStatus{Phase: updatev1alpha1.CanaryPhaseSoaking, Nodes: []string{"canary-node"}},
+			strategy:    strategy,
+			perRole:     map[updatev1alpha1.NodeRole]int{updatev1alpha1.ControlPlaneRole: 1},
+			wantPerRole: map[updatev1alpha1.NodeRole]int{updatev1alpha1.ControlPlaneRole: 1, updatev1alpha1.WorkerRole: 0},
+		},
+		"failed": {
+			canary:      &updatev1alpha1.CanaryStatus{Phase: updatev1alpha1.CanaryPhaseFailed},
+			strategy:    strategy,
+			perRole:     map[updatev1alpha1.NodeRole]int{updatev1alpha1.WorkerRole: 3},
+			wantPerRole: map[updatev1alpha1.NodeRole]int{updatev1alpha1.WorkerRole: 0},
+		},
+		"succeeded": {
+			canary:      &updatev1alpha1.CanaryStatus{Phase: updatev1alpha1.CanaryPhaseSucceeded},
+			strategy:    strategy,
+			perRole:     map[updatev1alpha1.NodeRole]int{updatev1alpha1.WorkerRole: 3},
+			wantPerRole: map[updatev1alpha1.NodeRole]int{updatev1alpha1.WorkerRole: 3},
+		},
+	}
+
+	for name, tc := range testCases {
+		t.Run(name, func(t *testing.T) {
+			budget := surgeBudget{total: 5, perRole: tc.perRole}
+			limitCanaryBudget(&budget, tc.canary, tc.strategy)
+			assert.Equal(t, tc.wantPerRole, budget.perRole)
+			assert.Equal(t, 5, budget.total)
+		})
+	}
+}
+
+func TestCanaryCondition(t *testing.T) {
+	testCases := map[string]struct {
+		canary     *updatev1alpha1.CanaryStatus
+		wantStatus metav1.ConditionStatus
+		wantReason string
+	}{
+		"soaking": {
+			canary:     &updatev1alpha1.CanaryStatus{Phase: updatev1alpha1.CanaryPhaseSoaking},
+			wantStatus: metav1.ConditionFalse,
+			wantReason: conditionCanaryHealthyReason,
+		},
+		"succeeded": {
+			canary:     &updatev1alpha1.CanaryStatus{Phase: updatev1alpha1.CanaryPhaseSucceeded},
+			wantStatus: metav1.ConditionFalse,
+			wantReason: conditionCanaryHealthyReason,
+		},
+		"failed": {
+			canary:     &updatev1alpha1.CanaryStatus{ImageReference: "image", Phase: updatev1alpha1.CanaryPhaseFailed, Message: "failure"},
+			wantStatus: metav1.ConditionTrue,
+			wantReason: conditionCanaryFailedReason,
+		},
+	}
+
+	for name, tc := range testCases {
+		t.Run(name, func(t *testing.T) {
+			assert := assert.New(t)
+
+			condition := canaryCondition(tc.canary, 2)
+			assert.Equal(updatev1alpha1.ConditionRolledBack, condition.Type)
+			assert.Equal(tc.wantStatus, condition.Status)
+			assert.Equal(tc.wantReason, condition.Reason)
+			assert.Equal(int64(2), condition.ObservedGeneration)
+		})
+	}
+}
+
+func TestPodFailure(t *testing.T) {
+	testCases := map[string]struct {
+		status      corev1.PodStatus
+		wantFailure string
+	}{
+		"running": {
+			status: corev1.PodStatus{Phase: corev1.PodRunning},
+		},
+		"completed": {
+			status: corev1.PodStatus{Phase: corev1.PodSucceeded},
+		},
+		"failed on its own": {
+			status: corev1.PodStatus{Phase: corev1.PodFailed},
+		},
+		"evicted": {
+			status:      corev1.PodStatus{Phase: corev1.PodFailed, Reason: "Evicted"},
+			wantFailure: "failed: Evicted",
+		},
+		"crashing init container": {
+			status: corev1.PodStatus{
+				Phase: corev1.PodPending,
+				InitContainerStatuses: []corev1.ContainerStatus{
+					{Name: "init", State: corev1.ContainerState{Waiting: &corev1.ContainerStateWaiting{Reason: "CrashLoopBackOff"}}},
+				},
+			},
+			wantFailure: "has crashing container init",
+		},
+		"container waiting for image": {
+			status: corev1.PodStatus{
+				Phase: corev1.PodPending,
+				ContainerStatuses: []corev1.ContainerStatus{
+					{Name: "app", State: corev1.ContainerState{Waiting: &corev1.ContainerStateWaiting{Reason: "ContainerCreating"}}},
+				},
+			},
+		},
+	}
+
+	for name, tc := range testCases {
+		t.Run(name, func(t *testing.T) {
+			assert.Equal(t, tc.wantFailure, podFailure(&corev1.Pod{Status: tc.status}))
+		})
+	}
+}
@@ -10,6 +10,7 @@ import (
 	"context"
 	"encoding/json"
 	"errors"
+	"fmt"
 	"reflect"
 	"strings"
 	"time"
@@ -32,16 +33,20 @@ import (
 	"sigs.k8s.io/controller-runtime/pkg/client"
 	"sigs.k8s.io/controller-runtime/pkg/handler"
 	"sigs.k8s.io/controller-runtime/pkg/log"
+	"sigs.k8s.io/controller-runtime/pkg/predicate"
 
 	nodemaintenancev1beta1 "github.com/edgelesssys/constellation/v2/3rdparty/node-maintenance-operator/api/v1beta1"
 	updatev1alpha1 "github.com/edgelesssys/constellation/v2/operators/constellation-node-operator/api/v1alpha1"
 )
 
 const (
-	// nodeOverprovisionLimit is the maximum number of extra nodes created during the update procedure at any point in time.
+	// nodeOverprovisionLimit is the default maximum number of extra nodes created during the update procedure at any point in time.
+	// It can be overridden by the upgrade strategy of the NodeVersion.
 	nodeOverprovisionLimit = 1
 	// nodeJoinTimeout is the time limit pending nodes have to join the cluster before being terminated.
 	nodeJoinTimeout = time.Minute * 30
+	// canaryCheckInterval is the interval in which the health of canary nodes is checked during the soak period.
+	canaryCheckInterval = time.Minute
 	// nodeLeaveTimeout is the time limit pending nodes have to leave the cluster and being terminated.
 	nodeLeaveTimeout                     = time.Minute
 	donorAnnotation                      = "constellation.edgeless.systems/donor"
@@ -53,6 +58,17 @@ const (
 	conditionNodeVersionUpToDateMessage  = "Node version of every node is up to date"
 	conditionNodeVersionOutOfDateReason  = "NodeVersionsOutOfDate"
 	conditionNodeVersionOutOfDateMessage = "Some node versions are out of date"
+
+	conditionUpgradeProceedingReason         = "UpgradeProceeding"
+	conditionUpgradeProceedingMessage        = "Outdated nodes are replaced according to the upgrade strategy"
+	conditionUpgradePausedReason             = "UpgradePaused"
+	conditionUpgradePausedMessage            = "The upgrade is paused"
+	conditionOutsideMaintenanceWindowReason  = "OutsideMaintenanceWindow"
+	conditionOutsideMaintenanceWindowMessage = "Outdated nodes are only replaced during maintenance windows"
+	conditionNodeTimeoutReason               = "NodeTimeout"
+	conditionCanaryHealthyReason             = "CanaryHealthy"
+	conditionCanaryHealthyMessage            = "Canary nodes of the image upgrade are healthy"
+	conditionCanaryFailedReason              = "CanaryFailed"
 )
 
 // NodeVersionReconciler reconciles a NodeVersion object.
@@ -83,7 +99,8 @@ func NewNodeVersionReconciler(nodeReplacer nodeReplacer, etcdRemover etcdRemover
 //+kubebuilder:rbac:groups=nodemaintenance.medik8s.io,resources=nodemaintenances,verbs=get;list;watch;create;update;patch;delete
 //+kubebuilder:rbac:groups="",resources=nodes,verbs=get;list;watch;create;update;patch;delete
 //+kubebuilder:rbac:groups="",resources=nodes/status,verbs=get
-//+kubebuilder:rbac:groups="",resources=configmaps,verbs=list;get;watch
+//+kubebuilder:rbac:groups="",resources=configmaps,verbs=list;get;watch;update
+//+kubebuilder:rbac:groups="",resources=pods,verbs=list;watch
 
 // Reconcile replaces outdated nodes with new nodes as specified in the NodeVersion spec.
 func (r *NodeVersionReconciler) Reconcile(ctx context.Context, req ctrl.Request) (ctrl.Result, error) {
@@ -163,17 +180,58 @@ func (r *NodeVersionReconciler) Reconcile(ctx context.Context, req ctrl.Request)
 	// - heirs to outdated nodes
 	extraNodes := len(groups.Heirs) + len(groups.AwaitingAnnotation) + len(pendingNodeList.Items)
 	// newNodesBudget is the maximum number of new nodes that can be created in this Reconcile call.
-	var newNodesBudget int
-	if extraNodes < nodeOverprovisionLimit {
-		newNodesBudget = nodeOverprovisionLimit - extraNodes
+	newNodesBudget := newSurgeBudget(desiredNodeVersion.Spec.UpgradeStrategy, scalingGroupByID, extraNodes, extraNodesPerScalingGroup(groups, pendingNodeList.Items))
+	// the upgrade strategy may halt the replacement of outdated nodes.
+	haltedCondition, requeueAfter := upgradeHaltedCondition(&desiredNodeVersion, groups, pendingNodeList.Items, time.Now())
+	halted := haltedCondition.Status == metav1.ConditionTrue
+	if halted {
+		logr.Info("Replacement of outdated nodes is halted", "reason", haltedCondition.Reason, "message", haltedCondition.Message)
+		newNodesBudget.total = 0
 	}
-	logr.Info("Budget for new nodes", "newNodesBudget", newNodesBudget)
 
-	status := nodeVersionStatus(r.Scheme, groups, pendingNodeList.Items, invalidNodes, newNodesBudget)
+	// an image upgrade may start with a canary phase, which only replaces a subset of the worker nodes.
+	// the health of the pods on the canary nodes is only checked while soaking.
+	var pods []corev1.Pod
+	if canary := desiredNodeVersion.Status.Canary; canary != nil && canary.Phase == updatev1alpha1.CanaryPhaseSoaking {
+		for _, nodeName := range canary.Nodes {
+			var podList corev1.PodList
+			if err := r.List(ctx, &podList, client.MatchingFields{nodeNameKey: nodeName}); err != nil {
+				logr.Error(err, "Unable to list pods", "node", nodeName)
+				return ctrl.Result{}, err
+			}
+			pods = append(pods, podList.Items...)
+		}
+	}
+	canary, canaryRequeueAfter := nextCanaryStatus(&desiredNodeVersion, groups, nodeList.Items, pendingNodeList.Items, pods, time.Now())
+	if canaryRequeueAfter > 0 && (requeueAfter == 0 || canaryRequeueAfter < requeueAfter) {
+		requeueAfter = canaryRequeueAfter
+	}
+	limitCanaryBudget(&newNodesBudget, canary, desiredNodeVersion.Spec.UpgradeStrategy.Canary)
+	rollback := canary != nil && canary.Phase == updatev1alpha1.CanaryPhaseFailed &&
+		strings.EqualFold(canary.ImageReference, desiredNodeVersion.Spec.ImageReference)
+	if rollback {
+		newNodesBudget.total = 0
+	}
+	logr.Info("Budget for new nodes", "newNodesBudget", newNodesBudget.total)
+
+	status := nodeVersionStatus(r.Scheme, groups, pendingNodeList.Items, invalidNodes, newNodesBudget.total, haltedCondition)
+	status.Canary = canary
+	if canary != nil {
+		meta.SetStatusCondition(&status.Conditions, canaryCondition(canary, desiredNodeVersion.Generation))
+	}
 	if err := r.tryUpdateStatus(ctx, req.NamespacedName, status); err != nil {
 		logr.Error(err, "Updating status")
 	}
 
+	if rollback {
+		logr.Info("Canary nodes are unhealthy, rolling back image upgrade", "image", canary.ImageReference, "reason", canary.Message)
+		if err := r.rollbackImage(ctx, req.NamespacedName, canary.ImageReference); err != nil {
+			logr.Error(err, "Rolling back image upgrade")
+			return ctrl.Result{}, err
+		}
+		return ctrl.Result{Requeue: true}, nil
+	}
+
 	allNodesUpToDate := len(groups.Outdated)+len(groups.Heirs)+len(groups.AwaitingAnnotation)+len(pendingNodeList.Items)+len(groups.Obsolete) == 0
 	if err := r.ensureAutoscaling(ctx, autoscalingEnabled, allNodesUpToDate); err != nil {
 		logr.Error(err, "Ensure autoscaling", "autoscalingEnabledIs", autoscalingEnabled, "autoscalingEnabledWant", allNodesUpToDate)
@@ -182,6 +240,13 @@ func (r *NodeVersionReconciler) Reconcile(ctx context.Context, req ctrl.Request)
 
 	if allNodesUpToDate {
 		logr.Info("All node versions up to date")
+		// the measurements of other images are no longer needed once all nodes run the current image,
+		// whatever the state of the canary phase. nodes using another image can't join afterwards,
+		// so going back to another image requires applying its measurements again.
+		if err := r.pruneAllowedMeasurements(ctx, desiredNodeVersion.Spec.ImageVersion); err != nil {
+			logr.Error(err, "Pruning measurements of other images")
+			return ctrl.Result{}, err
+		}
 		return ctrl.Result{}, nil
 	}
 
@@ -191,6 +256,10 @@ func (r *NodeVersionReconciler) Reconcile(ctx context.Context, req ctrl.Request)
 	replacementPairs := r.pairDonorsAndHeirs(ctx, &desiredNodeVersion, groups.Outdated, groups.Mint)
 	// extend replacement pairs to include existing pairs of donors and heirs
 	replacementPairs = r.matchDonorsAndHeirs(ctx, replacementPairs, groups.Donors, groups.Heirs)
+	if halted {
+		// keep donors and heirs paired up, but do not replace nodes while the upgrade is halted
+		replacementPairs = nil
+	}
 	// replace donor nodes by heirs
 	for _, pair := range replacementPairs {
 		logr.Info("Replacing node", "donorNode", pair.donor.Name, "heirNode", pair.heir.Name)
@@ -211,13 +280,29 @@ func (r *NodeVersionReconciler) Reconcile(ctx context.Context, req ctrl.Request)
 	// only create new nodes if the autoscaler is disabled.
 	// otherwise, new nodes will also be created by the autoscaler
 	if autoscalingEnabled {
-		return ctrl.Result{Requeue: shouldRequeue}, nil
+		return ctrl.Result{Requeue: shouldRequeue, RequeueAfter: requeueAfter}, nil
 	}
 
 	newNodeConfig := newNodeConfig{desiredNodeVersion, groups.Outdated, groups.Donors, pendingNodeList.Items, scalingGroupByID, newNodesBudget}
-	if err := r.createNewNodes(ctx, newNodeConfig); err != nil {
+	createdNodes, err := r.createNewNodes(ctx, newNodeConfig)
+	if canary != nil && canary.Phase == updatev1alpha1.CanaryPhaseReplacing {
+		// new worker nodes are canary nodes until the canary phase is over
+		var createdWorkers bool
+		for _, pendingNode := range createdNodes {
+			if scalingGroupByID[strings.ToLower(pendingNode.Spec.ScalingGroupID)].Spec.Role == updatev1alpha1.WorkerRole {
+				canary.Nodes = append(canary.Nodes, pendingNode.Spec.NodeName)
+				createdWorkers = true
+			}
+		}
+		if createdWorkers {
+			if err := r.tryUpdateCanaryStatus(ctx, req.NamespacedName, canary); err != nil {
+				logr.Error(err, "Updating canary status")
+			}
+		}
+	}
+	if err != nil {
 		logr.Error(err, "Creating new nodes")
-		return ctrl.Result{Requeue: shouldRequeue}, nil
+		return ctrl.Result{Requeue: shouldRequeue, RequeueAfter: requeueAfter}, nil
 	}
 	// cleanup obsolete nodes
 	for _, node := range groups.Obsolete {
@@ -230,11 +315,19 @@ func (r *NodeVersionReconciler) Reconcile(ctx context.Context, req ctrl.Request)
 		}
 	}
 
-	return ctrl.Result{Requeue: shouldRequeue}, nil
+	return ctrl.Result{Requeue: shouldRequeue, RequeueAfter: requeueAfter}, nil
 }
 
 // SetupWithManager sets up the controller with the Manager.
 func (r *NodeVersionReconciler) SetupWithManager(mgr ctrl.Manager) error {
+	// index pods by nodename, so only the pods of canary nodes are listed.
+	if err := mgr.GetFieldIndexer().IndexField(context.Background(), &corev1.Pod{}, nodeNameKey, func(rawObj client.Object) []string {
+		pod := rawObj.(*corev1.Pod)
+		return []string{pod.Spec.NodeName}
+	}); err != nil {
+		return err
+	}
+
 	return ctrl.NewControllerManagedBy(mgr).
 		For(&updatev1alpha1.NodeVersion{}).
 		Watches(
@@ -250,7 +343,7 @@ func (r *NodeVersionReconciler) SetupWithManager(mgr ctrl.Manager) error {
 		Watches(
 			client.Object(&corev1.Node{}),
 			handler.EnqueueRequestsFromMapFunc(r.findAllNodeVersions),
-			builder.WithPredicates(nodeReadyPredicate()),
+			builder.WithPredicates(predicate.Or(nodeReadyPredicate(), nodeReplaceAnnotationChangedPredicate())),
 		).
 		Watches(
 			client.Object(&nodemaintenancev1beta1.NodeMaintenance{}),
@@ -551,7 +644,7 @@ func (r *NodeVersionReconciler) deleteNode(ctx context.Context, controller metav
 			},
 			Spec: nodemaintenancev1beta1.NodeMaintenanceSpec{
 				NodeName: node.Name,
-				Reason:   "node is replaced due to OS image update",
+				Reason:   r.nodeMaintenanceReason(ctx, node),
 			},
 		}
 		return false, r.Create(ctx, &nodeMaintenance)
@@ -608,11 +701,25 @@ func (r *NodeVersionReconciler) deleteNode(ctx context.Context, controller metav
 	return true, nil
 }
 
+// nodeMaintenanceReason returns the reason for cordoning and draining a node that is replaced.
+func (r *NodeVersionReconciler) nodeMaintenanceReason(ctx context.Context, node corev1.Node) string {
+	nodeReplacementName := node.Annotations[replaceAnnotation]
+	if nodeReplacementName == "" {
+		return "node is replaced due to OS image update"
+	}
+	var nodeReplacement updatev1alpha1.NodeReplacement
+	if err := r.Get(ctx, types.NamespacedName{Name: nodeReplacementName}, &nodeReplacement); err == nil && nodeReplacement.Spec.Reason != "" {
+		return nodeReplacement.Spec.Reason
+	}
+	return fmt.Sprintf("node is replaced as requested by NodeReplacement %s", nodeReplacementName)
+}
+
 // createNewNodes creates new nodes using up to date images as replacement for outdated nodes.
-func (r *NodeVersionReconciler) createNewNodes(ctx context.Context, config newNodeConfig) error {
+// The pending node resources of the created nodes are returned, even if an error occurs.
+func (r *NodeVersionReconciler) createNewNodes(ctx context.Context, config newNodeConfig) ([]updatev1alpha1.PendingNode, error) {
 	logr := log.FromContext(ctx)
-	if config.newNodesBudget < 1 || len(config.outdatedNodes) == 0 {
-		return nil
+	if config.newNodesBudget.total < 1 || len(config.outdatedNodes) == 0 {
+		return nil, nil
 	}
 	// We need to look at both the outdated nodes *and* the nodes that have already
 	// been moved to the donors here because even if a CP node has already been moved to
@@ -646,6 +753,7 @@ func (r *NodeVersionReconciler) createNewNodes(ctx context.Context, config newNo
 			requiredNodesPerScalingGroup[scalingGroupID] = outdatedNodesPerScalingGroup[scalingGroupID] - pendingJoiningNodesPerScalingGroup[scalingGroupID]
 		}
 	}
+	var created []updatev1alpha1.PendingNode
 	for scalingGroupID := range requiredNodesPerScalingGroup {
 		scalingGroup, ok := config.scalingGroupByID[scalingGroupID]
 		if !ok {
@@ -666,16 +774,20 @@ func (r *NodeVersionReconciler) createNewNodes(ctx context.Context, config newNo
 			continue
 		}
 		for {
-			if config.newNodesBudget == 0 {
-				return nil
+			if config.newNodesBudget.total == 0 {
+				return created, nil
 			}
 			if requiredNodesPerScalingGroup[scalingGroupID] == 0 {
 				break
 			}
+			if !config.newNodesBudget.allows(scalingGroupID, scalingGroup.Spec.Role) {
+				logr.Info("Upgrade strategy does not allow more new nodes for scaling group", "scalingGroup", scalingGroupID)
+				break
+			}
 			logr.Info("Creating new node", "scalingGroup", scalingGroupID)
 			nodeName, providerID, err := r.CreateNode(ctx, scalingGroup.Spec.GroupID)
 			if err != nil {
-				return err
+				return created, err
 			}
 			deadline := metav1.NewTime(time.Now().Add(nodeJoinTimeout))
 			pendingNode := &updatev1alpha1.PendingNode{
@@ -689,17 +801,18 @@ func (r *NodeVersionReconciler) createNewNodes(ctx context.Context, config newNo
 				},
 			}
 			if err := ctrl.SetControllerReference(&config.desiredNodeVersion, pendingNode, r.Scheme); err != nil {
-				return err
+				return created, err
 			}
 			if err := r.Create(ctx, pendingNode); err != nil {
-				return err
+				return created, err
 			}
+			created = append(created, *pendingNode)
 			logr.Info("Created new node", "createdNode", nodeName, "scalingGroup", scalingGroupID, "requiredNodes", requiredNodesPerScalingGroup[scalingGroupID])
 			requiredNodesPerScalingGroup[scalingGroupID]--
-			config.newNodesBudget--
+			config.newNodesBudget.consume(scalingGroupID, scalingGroup.Spec.Role)
 		}
 	}
-	return nil
+	return created, nil
 }
 
 // patchNodeAnnotations attempts to patch node annotations in a retry loop.
@@ -757,8 +870,10 @@ func (r *NodeVersionReconciler) tryUpdateStatus(ctx context.Context, name types.
 	})
 }
 
-// nodeVersionStatus generates the NodeVersion.Status field given node groups and the budget for new nodes.
-func nodeVersionStatus(scheme *runtime.Scheme, groups nodeGroups, pendingNodes []updatev1alpha1.PendingNode, invalidNodes []corev1.Node, newNodesBudget int) updatev1alpha1.NodeVersionStatus {
+// nodeVersionStatus generates the NodeVersion.Status field given node groups, the budget for new nodes and the halted condition of the upgrade.
+func nodeVersionStatus(scheme *runtime.Scheme, groups nodeGroups, pendingNodes []updatev1alpha1.PendingNode, invalidNodes []corev1.Node, newNodesBudget int,
+	haltedCondition metav1.Condition,
+) updatev1alpha1.NodeVersionStatus {
 	var status updatev1alpha1.NodeVersionStatus
 	outdatedCondition := metav1.Condition{
 		Type: updatev1alpha1.ConditionOutdated,
@@ -773,6 +888,7 @@ func nodeVersionStatus(scheme *runtime.Scheme, groups nodeGroups, pendingNodes [
 		outdatedCondition.Message = conditionNodeVersionOutOfDateMessage
 	}
 	meta.SetStatusCondition(&status.Conditions, outdatedCondition)
+	meta.SetStatusCondition(&status.Conditions, haltedCondition)
 	for _, node := range groups.Outdated {
 		nodeRef, err := ref.GetReference(scheme, &node)
 		if err != nil {
@@ -858,7 +974,7 @@ type replacementPair struct {
 // every properly annotated kubernetes node can be placed in exactly one of the sets.
 type nodeGroups struct {
 	// Outdated nodes are nodes that
-	// do not use the most recent version AND
+	// do not use the most recent version or are marked for replacement AND
 	// are not yet a donor to an up to date heir node
 	Outdated,
 	// UpToDate nodes are nodes that
@@ -867,7 +983,7 @@ type nodeGroups struct {
 	// are not mint nodes
 	UpToDate,
 	// Donors are nodes that
-	// do not use the most recent version AND
+	// do not use the most recent version or are marked for replacement AND
 	// are paired up with an up to date heir node
 	Donors,
 	// Heirs are nodes that
@@ -901,8 +1017,10 @@ func groupNodes(nodes []corev1.Node, pendingNodes []updatev1alpha1.PendingNode,
 			groups.AwaitingAnnotation = append(groups.AwaitingAnnotation, node)
 			continue
 		}
+		// nodes marked by a NodeReplacement are replaced like outdated nodes
 		if !strings.EqualFold(node.Annotations[nodeImageAnnotation], latestImageReference) ||
-			!strings.EqualFold(node.Annotations[mainconstants.NodeKubernetesComponentsAnnotationKey], latestK8sComponentsReference) {
+			!strings.EqualFold(node.Annotations[mainconstants.NodeKubernetesComponentsAnnotationKey], latestK8sComponentsReference) ||
+			node.Annotations[replaceAnnotation] != "" {
 			if heir := node.Annotations[heirAnnotation]; heir != "" {
 				groups.Donors = append(groups.Donors, node)
 			} else {
@@ -957,5 +1075,5 @@ type newNodeConfig struct {
 	donors             []corev1.Node
 	pendingNodes       []updatev1alpha1.PendingNode
 	scalingGroupByID   map[string]updatev1alpha1.ScalingGroup
-	newNodesBudget     int
+	newNodesBudget     surgeBudget
 }
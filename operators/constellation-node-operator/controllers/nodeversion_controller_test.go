@@ -329,12 +329,14 @@ func TestMatchDonorsAndHeirs(t *testing.T) {
 
 func TestCreateNewNodes(t *testing.T) {
 	testCases := map[string]struct {
-		outdatedNodes    []corev1.Node
-		donors           []corev1.Node
-		pendingNodes     []updatev1alpha1.PendingNode
-		scalingGroupByID map[string]updatev1alpha1.ScalingGroup
-		budget           int
-		wantCreateCalls  []string
+		outdatedNodes         []corev1.Node
+		donors                []corev1.Node
+		pendingNodes          []updatev1alpha1.PendingNode
+		scalingGroupByID      map[string]updatev1alpha1.ScalingGroup
+		budget                int
+		perRoleBudget         map[updatev1alpha1.NodeRole]int
+		perScalingGroupBudget map[string]int
+		wantCreateCalls       []string
 	}{
 		"no outdated nodes": {
 			scalingGroupByID: map[string]updatev1alpha1.ScalingGroup{
@@ -673,6 +675,124 @@ func TestCreateNewNodes(t *testing.T) {
 			},
 			budget: 1,
 		},
+		"per role budget exhausted": {
+			outdatedNodes: []corev1.Node{
+				{
+					ObjectMeta: metav1.ObjectMeta{
+						Name: "node",
+						Annotations: map[string]string{
+							scalingGroupAnnotation: "scaling-group",
+						},
+					},
+				},
+			},
+			scalingGroupByID: map[string]updatev1alpha1.ScalingGroup{
+				"scaling-group": {
+					Spec: updatev1alpha1.ScalingGroupSpec{
+						GroupID: "scaling-group",
+						Role:    updatev1alpha1.WorkerRole,
+					},
+					Status: updatev1alpha1.ScalingGroupStatus{
+						ImageReference: "image",
+					},
+				},
+			},
+			budget:        1,
+			perRoleBudget: map[updatev1alpha1.NodeRole]int{updatev1alpha1.WorkerRole: 0},
+		},
+		"per role budget limits new nodes": {
+			outdatedNodes: []corev1.Node{
+				{
+					ObjectMeta: metav1.ObjectMeta{
+						Name: "node-1",
+						Annotations: map[string]string{
+							scalingGroupAnnotation: "scaling-group",
+						},
+					},
+				},
+				{
+					ObjectMeta: metav1.ObjectMeta{
+						Name: "node-2",
+						Annotations: map[string]string{
+							scalingGroupAnnotation: "scaling-group",
+						},
+					},
+				},
+				{
+					ObjectMeta: metav1.ObjectMeta{
+						Name: "node-3",
+						Annotations: map[string]string{
+							scalingGroupAnnotation: "scaling-group",
+						},
+					},
+				},
+			},
+			scalingGroupByID: map[string]updatev1alpha1.ScalingGroup{
+				"scaling-group": {
+					Spec: updatev1alpha1.ScalingGroupSpec{
+						GroupID: "scaling-group",
+						Role:    updatev1alpha1.WorkerRole,
+					},
+					Status: updatev1alpha1.ScalingGroupStatus{
+						ImageReference: "image",
+					},
+				},
+			},
+			budget:          5,
+			perRoleBudget:   map[updatev1alpha1.NodeRole]int{updatev1alpha1.WorkerRole: 2},
+			wantCreateCalls: []string{"scaling-group", "scaling-group"},
+		},
+		"per scaling group budget exhausted for one group": {
+			outdatedNodes: []corev1.Node{
+				{
+					ObjectMeta: metav1.ObjectMeta{
+						Name: "node-1",
+						Annotations: map[string]string{
+							scalingGroupAnnotation: "scaling-group-1",
+						},
+					},
+				},
+				{
+					ObjectMeta: metav1.ObjectMeta{
+						Name: "node-2",
+						Annotations: map[string]string{
+							scalingGroupAnnotation: "scaling-group-2",
+						},
+					},
+				},
+				{
+					ObjectMeta: metav1.ObjectMeta{
+						Name: "node-3",
+						Annotations: map[string]string{
+							scalingGroupAnnotation: "scaling-group-2",
+						},
+					},
+				},
+			},
+			scalingGroupByID: map[string]updatev1alpha1.ScalingGroup{
+				"scaling-group-1": {
+					Spec: updatev1alpha1.ScalingGroupSpec{
+						GroupID: "scaling-group-1",
+						Role:    updatev1alpha1.WorkerRole,
+					},
+					Status: updatev1alpha1.ScalingGroupStatus{
+						ImageReference: "image",
+					},
+				},
+				"scaling-group-2": {
+					Spec: updatev1alpha1.ScalingGroupSpec{
+						GroupID: "scaling-group-2",
+						Role:    updatev1alpha1.WorkerRole,
+					},
+					Status: updatev1alpha1.ScalingGroupStatus{
+						ImageReference: "image",
+					},
+				},
+			},
+			budget:                3,
+			perScalingGroupBudget: map[string]int{"scaling-group-1": 0},
+			wantCreateCalls:       []string{"scaling-group-2", "scaling-group-2"},
+		},
 	}
 
 	for name, tc := range testCases {
@@ -692,10 +812,12 @@ func TestCreateNewNodes(t *testing.T) {
 				},
 				Scheme: getScheme(t),
 			}
-			newNodeConfig := newNodeConfig{desiredNodeImage, tc.outdatedNodes, tc.donors, tc.pendingNodes, tc.scalingGroupByID, tc.budget}
-			err := reconciler.createNewNodes(t.Context(), newNodeConfig)
+			budget := surgeBudget{total: tc.budget, perRole: tc.perRoleBudget, perScalingGroup: tc.perScalingGroupBudget}
+			newNodeConfig := newNodeConfig{desiredNodeImage, tc.outdatedNodes, tc.donors, tc.pendingNodes, tc.scalingGroupByID, budget}
+			created, err := reconciler.createNewNodes(t.Context(), newNodeConfig)
 			require.NoError(err)
 			assert.Equal(tc.wantCreateCalls, reconciler.nodeReplacer.(*stubNodeReplacerWriter).createCalls)
+			assert.Len(created, len(tc.wantCreateCalls))
 		})
 	}
 }
@@ -726,6 +848,17 @@ func TestGroupNodes(t *testing.T) {
 					},
 				},
 			},
+			{
+				ObjectMeta: metav1.ObjectMeta{
+					Name: "marked-for-replacement",
+					Annotations: map[string]string{
+						scalingGroupAnnotation:                              scalingGroup,
+						mainconstants.NodeKubernetesComponentsAnnotationKey: latestK8sComponentsReference,
+						nodeImageAnnotation:                                 latestImageReference,
+						replaceAnnotation:                                   "replacement",
+					},
+				},
+			},
 		},
 		UpToDate: []corev1.Node{
 			{
@@ -762,6 +895,18 @@ func TestGroupNodes(t *testing.T) {
 					},
 				},
 			},
+			{
+				ObjectMeta: metav1.ObjectMeta{
+					Name: "marked-donor",
+					Annotations: map[string]string{
+						scalingGroupAnnotation:                              scalingGroup,
+						nodeImageAnnotation:                                 latestImageReference,
+						mainconstants.NodeKubernetesComponentsAnnotationKey: latestK8sComponentsReference,
+						replaceAnnotation:                                   "replacement",
+						heirAnnotation:                                      "heir",
+					},
+				},
+			},
 		},
 		Heirs: []corev1.Node{
 			{
@@ -0,0 +1,79 @@
+/*
+Copyright (c) Edgeless Systems GmbH
+
+SPDX-License-Identifier: BUSL-1.1
+*/
+
+package controllers
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+
+	"github.com/edgelesssys/constellation/v2/internal/attestation/measurements"
+	mainconstants "github.com/edgelesssys/constellation/v2/internal/constants"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/client-go/util/retry"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+)
+
+// pruneAllowedMeasurements removes the measurements of all images except imageVersion from the join-config.
+// During an image upgrade, the measurements of the previous image are allowed, so that nodes using it can still join the cluster.
+// They are no longer needed once all nodes use the new image.
+func (r *NodeVersionReconciler) pruneAllowedMeasurements(ctx context.Context, imageVersion string) error {
+	return retry.RetryOnConflict(retry.DefaultRetry, func() error {
+		var joinConfig corev1.ConfigMap
+		if err := r.Get(ctx, types.NamespacedName{Name: mainconstants.JoinConfigMap, Namespace: mainconstants.ConstellationNamespace}, &joinConfig); err != nil {
+			return client.IgnoreNotFound(err)
+		}
+		attestationConfig, pruned, err := pruneAttestationConfig(joinConfig.Data[mainconstants.AttestationConfigFilename], imageVersion)
+		if err != nil || !pruned {
+			return err
+		}
+		joinConfig.Data[mainconstants.AttestationConfigFilename] = attestationConfig
+		return r.Update(ctx, &joinConfig)
+	})
+}
+
+// pruneAttestationConfig removes the allowed measurements of all images except imageVersion from the JSON encoded attestation config.
+// This includes newer images, e.g., after a rollback, and images that don't use semantic versioning.
+// The other fields of the attestation config are kept as is, since they depend on the attestation variant.
+// It returns true if any measurement was removed.
+func pruneAttestationConfig(attestationConfig, imageVersion string) (string, bool, error) {
+	if attestationConfig == "" || imageVersion == "" {
+		return attestationConfig, false, nil
+	}
+
+	var cfg map[string]json.RawMessage
+	if err := json.Unmarshal([]byte(attestationConfig), &cfg); err != nil {
+		return "", false, fmt.Errorf("unmarshaling attestation config: %w", err)
+	}
+	rawMeasurements, ok := cfg["measurements"]
+	if !ok {
+		return attestationConfig, false, nil
+	}
+	var m measurements.M
+	if err := json.Unmarshal(rawMeasurements, &m); err != nil {
+		return "", false, fmt.Errorf("unmarshaling measurements: %w", err)
+	}
+
+	expired := func(image string) bool {
+		return image != imageVersion
+	}
+	if !m.PruneAllowed(expired) {
+		return attestationConfig, false, nil
+	}
+
+	rawMeasurements, err := json.Marshal(m)
+	if err != nil {
+		return "", false, fmt.Errorf("marshaling measurements: %w", err)
+	}
+	cfg["measurements"] = rawMeasurements
+	prunedConfig, err := json.Marshal(cfg)
+	if err != nil {
+		return "", false, fmt.Errorf("marshaling attestation config: %w", err)
+	}
+	return string(prunedConfig), true, nil
+}
@@ -0,0 +1,114 @@
+/*
+Copyright (c) Edgeless Systems GmbH
+
+SPDX-License-Identifier: BUSL-1.1
+*/
+
+package controllers
+
+import (
+	"encoding/json"
+	"strings"
+	"testing"
+
+	"github.com/edgelesssys/constellation/v2/internal/attestation/measurements"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestPruneAttestationConfig(t *testing.T) {
+	oldValue := strings.Repeat("aa", 32)
+	newValue := strings.Repeat("bb", 32)
+	expected := strings.Repeat("00", 32)
+	configWithAllowed := func(allowed string) string {
+		return `{"measurements":{"4":{"expected":"` + expected + `","warnOnly":false` + allowed + `}},"bootloaderVersion":"latest"}`
+	}
+
+	testCases := map[string]struct {
+		attestationConfig string
+		imageVersion      string
+		wantPruned        bool
+		wantAllowed       []string
+		wantErr           bool
+	}{
+		"older image is pruned": {
+			attestationConfig: configWithAllowed(`,"allowed":[{"image":"v2.16.0","value":"` + oldValue + `"},{"image":"v2.17.0","value":"` + newValue + `"}]`),
+			imageVersion:      "v2.17.0",
+			wantPruned:        true,
+			wantAllowed:       []string{"v2.17.0"},
+		},
+		"newer image is pruned": {
+			attestationConfig: configWithAllowed(`,"allowed":[{"image":"v2.17.0","value":"` + oldValue + `"},{"image":"v2.18.0","value":"` + newValue + `"}]`),
+			imageVersion:      "v2.17.0",
+			wantPruned:        true,
+			wantAllowed:       []string{"v2.17.0"},
+		},
+		"current image is kept": {
+			attestationConfig: configWithAllowed(`,"allowed":[{"image":"v2.17.0","value":"` + oldValue + `"}]`),
+			imageVersion:      "v2.17.0",
+		},
+		"pre-release of current image is pruned": {
+			attestationConfig: configWithAllowed(`,"allowed":[{"image":"v2.17.0-pre.0.20240101000000-abcdef","value":"` + oldValue + `"}]`),
+			imageVersion:      "v2.17.0",
+			wantPruned:        true,
+		},
+		"image without semantic version is pruned": {
+			attestationConfig: configWithAllowed(`,"allowed":[{"image":"custom","value":"` + oldValue + `"}]`),
+			imageVersion:      "v2.17.0",
+			wantPruned:        true,
+		},
+		"current image without semantic version is kept": {
+			attestationConfig: configWithAllowed(`,"allowed":[{"image":"custom","value":"` + oldValue + `"},{"image":"v2.16.0","value":"` + newValue + `"}]`),
+			imageVersion:      "custom",
+			wantPruned:        true,
+			wantAllowed:       []string{"custom"},
+		},
+		"no allowed measurements": {
+			attestationConfig: configWithAllowed(""),
+			imageVersion:      "v2.17.0",
+		},
+		"unknown image version of cluster": {
+			attestationConfig: configWithAllowed(`,"allowed":[{"image":"v2.16.0","value":"` + oldValue + `"}]`),
+		},
+		"no measurements": {
+			attestationConfig: `{"bootloaderVersion":"latest"}`,
+			imageVersion:      "v2.17.0",
+		},
+		"invalid attestation config": {
+			attestationConfig: `{"measurements":`,
+			imageVersion:      "v2.17.0",
+			wantErr:           true,
+		},
+	}
+
+	for name, tc := range testCases {
+		t.Run(name, func(t *testing.T) {
+			assert := assert.New(t)
+			require := require.New(t)
+
+			prunedConfig, pruned, err := pruneAttestationConfig(tc.attestationConfig, tc.imageVersion)
+			if tc.wantErr {
+				assert.Error(err)
+				return
+			}
+			require.NoError(err)
+			assert.Equal(tc.wantPruned, pruned)
+			if !pruned {
+				assert.Equal(tc.attestationConfig, prunedConfig)
+				return
+			}
+
+			var cfg struct {
+				Measurements      measurements.M `json:"measurements"`
+				BootloaderVersion string         `json:"bootloaderVersion"`
+			}
+			require.NoError(json.Unmarshal([]byte(prunedConfig), &cfg))
+			assert.Equal("latest", cfg.BootloaderVersion)
+			var gotAllowed []string
+			for _, allowed := range cfg.Measurements[4].Allowed {
+				gotAllowed = append(gotAllowed, allowed.Image)
+			}
+			assert.Equal(tc.wantAllowed, gotAllowed)
+		})
+	}
+}
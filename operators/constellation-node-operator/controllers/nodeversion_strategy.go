@@ -0,0 +1,248 @@
+/*
+Copyright (c) Edgeless Systems GmbH
+
+SPDX-License-Identifier: BUSL-1.1
+*/
+
+package controllers
+
+import (
+	"fmt"
+	"strings"
+	"time"
+
+	"k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+
+	updatev1alpha1 "github.com/edgelesssys/constellation/v2/operators/constellation-node-operator/api/v1alpha1"
+)
+
+// surgeBudget is the number of new nodes that can be created in a Reconcile call.
+type surgeBudget struct {
+	// total limits the number of new nodes across all scaling groups.
+	total int
+	// perRole limits the number of new nodes in scaling groups of a role.
+	// Roles without a limit are not contained.
+	perRole map[updatev1alpha1.NodeRole]int
+	// perScalingGroup limits the number of new nodes in a scaling group, keyed by the lower case group ID.
+	// Scaling groups without a limit are not contained.
+	perScalingGroup map[string]int
+}
+
+// newSurgeBudget calculates the budget for new nodes from the upgrade strategy.
+// extraNodes is the number of nodes that cannot be used for regular workloads,
+// extraNodesPerScalingGroup is the same number broken down by lower case scaling group ID.
+func newSurgeBudget(strategy updatev1alpha1.UpgradeStrategy, scalingGroupByID map[string]updatev1alpha1.ScalingGroup,
+	extraNodes int, extraNodesPerScalingGroup map[string]int,
+) surgeBudget {
+	maxSurge := nodeOverprovisionLimit
+	if strategy.MaxSurge > 0 {
+		maxSurge = int(strategy.MaxSurge)
+	}
+	budget := surgeBudget{
+		total:           remainingSurge(maxSurge, extraNodes),
+		perRole:         make(map[updatev1alpha1.NodeRole]int, len(strategy.MaxSurgePerRole)),
+		perScalingGroup: make(map[string]int),
+	}
+
+	extraNodesPerRole := make(map[updatev1alpha1.NodeRole]int)
+	for scalingGroupID, count := range extraNodesPerScalingGroup {
+		if scalingGroup, ok := scalingGroupByID[scalingGroupID]; ok {
+			extraNodesPerRole[scalingGroup.Spec.Role] += count
+		}
+	}
+	for role, limit := range strategy.MaxSurgePerRole {
+		budget.perRole[role] = remainingSurge(int(limit), extraNodesPerRole[role])
+	}
+	for scalingGroupID, scalingGroup := range scalingGroupByID {
+		limit, ok := strategy.MaxSurgePerNodeGroup[scalingGroup.Spec.NodeGroupName]
+		if !ok {
+			continue
+		}
+		budget.perScalingGroup[scalingGroupID] = remainingSurge(int(limit), extraNodesPerScalingGroup[scalingGroupID])
+	}
+	return budget
+}
+
+// allows checks if a new node can be created in the given scaling group.
+func (b surgeBudget) allows(scalingGroupID string, role updatev1alpha1.NodeRole) bool {
+	if b.total < 1 {
+		return false
+	}
+	if remaining, ok := b.perRole[role]; ok && remaining < 1 {
+		return false
+	}
+	if remaining, ok := b.perScalingGroup[scalingGroupID]; ok && remaining < 1 {
+		return false
+	}
+	return true
+}
+
+// consume reduces the budget by a new node created in the given scaling group.
+func (b *surgeBudget) consume(scalingGroupID string, role updatev1alpha1.NodeRole) {
+	b.total--
+	if _, ok := b.perRole[role]; ok {
+		b.perRole[role]--
+	}
+	if _, ok := b.perScalingGroup[scalingGroupID]; ok {
+		b.perScalingGroup[scalingGroupID]--
+	}
+}
+
+// remainingSurge returns how many nodes can be added to used extra nodes without exceeding limit.
+func remainingSurge(limit, used int) int {
+	if used >= limit {
+		return 0
+	}
+	return limit - used
+}
+
+// extraNodesPerScalingGroup counts the nodes that cannot be used for regular workloads per lower case scaling group ID.
+func extraNodesPerScalingGroup(groups nodeGroups, pendingNodes []updatev1alpha1.PendingNode) map[string]int {
+	extraNodes := make(map[string]int)
+	for _, node := range groups.Heirs {
+		extraNodes[strings.ToLower(node.Annotations[scalingGroupAnnotation])]++
+	}
+	for _, node := range groups.AwaitingAnnotation {
+		extraNodes[strings.ToLower(node.Annotations[scalingGroupAnnotation])]++
+	}
+	for _, pendingNode := range pendingNodes {
+		extraNodes[strings.ToLower(pendingNode.Spec.ScalingGroupID)]++
+	}
+	return extraNodes
+}
+
+// upgradeHaltedCondition checks if the replacement of outdated nodes is halted by the upgrade strategy.
+// It also returns the duration after which the NodeVersion should be reconciled again,
+// because a halt ends or a node replacement may time out. A duration of zero means no reconciliation is needed.
+//
+// The replacement is halted if
+// - the upgrade is paused,
+// - a node replacement exceeded the node timeout or
+// - the current time is outside of all maintenance windows.
+//
+// A halt due to a node timeout persists until the spec of the NodeVersion is changed.
+func upgradeHaltedCondition(nodeVersion *updatev1alpha1.NodeVersion, groups nodeGroups, pendingNodes []updatev1alpha1.PendingNode, now time.Time) (metav1.Condition, time.Duration) {
+	strategy := nodeVersion.Spec.UpgradeStrategy
+	condition := metav1.Condition{
+		Type:               updatev1alpha1.ConditionUpgradeHalted,
+		Status:             metav1.ConditionTrue,
+		ObservedGeneration: nodeVersion.Generation,
+	}
+
+	if strategy.Paused {
+		condition.Reason = conditionUpgradePausedReason
+		condition.Message = conditionUpgradePausedMessage
+		return condition, 0
+	}
+
+	var nextTimeout time.Duration
+	if strategy.NodeTimeout != nil {
+		previous := meta.FindStatusCondition(nodeVersion.Status.Conditions, updatev1alpha1.ConditionUpgradeHalted)
+		if previous != nil && previous.Status == metav1.ConditionTrue &&
+			previous.Reason == conditionNodeTimeoutReason && previous.ObservedGeneration == nodeVersion.Generation {
+			condition.Reason = previous.Reason
+			condition.Message = previous.Message
+			return condition, 0
+		}
+		var timedOutNode string
+		timedOutNode, nextTimeout = findTimedOutReplacement(groups, pendingNodes, strategy.NodeTimeout.Duration, now)
+		if timedOutNode != "" {
+			condition.Reason = conditionNodeTimeoutReason
+			condition.Message = fmt.Sprintf("Replacement by node %s exceeded the node timeout of %s", timedOutNode, strategy.NodeTimeout.Duration)
+			return condition, 0
+		}
+	}
+
+	if len(strategy.MaintenanceWindows) > 0 {
+		if open, next := maintenanceWindowOpen(strategy.MaintenanceWindows, now); !open {
+			condition.Reason = conditionOutsideMaintenanceWindowReason
+			condition.Message = conditionOutsideMaintenanceWindowMessage
+			var requeueAfter time.Duration
+			if !next.IsZero() {
+				requeueAfter = next.Sub(now)
+			}
+			return condition, requeueAfter
+		}
+	}
+
+	condition.Status = metav1.ConditionFalse
+	condition.Reason = conditionUpgradeProceedingReason
+	condition.Message = conditionUpgradeProceedingMessage
+	return condition, nextTimeout
+}
+
+// findTimedOutReplacement returns the name of a heir or joining node whose replacement exceeded the timeout.
+// If no replacement timed out, the duration until the next replacement times out is returned instead.
+// The duration is zero if no replacement is in progress.
+func findTimedOutReplacement(groups nodeGroups, pendingNodes []updatev1alpha1.PendingNode, timeout time.Duration, now time.Time) (string, time.Duration) {
+	var nextTimeout time.Duration
+	check := func(started metav1.Time) bool {
+		remaining := started.Add(timeout).Sub(now)
+		if remaining <= 0 {
+			return true
+		}
+		if nextTimeout == 0 || remaining < nextTimeout {
+			nextTimeout = remaining
+		}
+		return false
+	}
+	for _, heir := range groups.Heirs {
+		if check(heir.CreationTimestamp) {
+			return heir.Name, 0
+		}
+	}
+	for _, pendingNode := range pendingNodes {
+		if pendingNode.Spec.Goal != updatev1alpha1.NodeGoalJoin {
+			continue
+		}
+		if check(pendingNode.CreationTimestamp) {
+			return pendingNode.Spec.NodeName, 0
+		}
+	}
+	return "", nextTimeout
+}
+
+// maintenanceWindowOpen checks if now is inside any of the maintenance windows.
+// If not, the start of the next window is returned, which is zero if no window starts within a week.
+// Windows with an invalid start time are ignored.
+func maintenanceWindowOpen(windows []updatev1alpha1.MaintenanceWindow, now time.Time) (bool, time.Time) {
+	now = now.UTC()
+	today := time.Date(now.Year(), now.Month(), now.Day(), 0, 0, 0, 0, time.UTC)
+	var next time.Time
+	for _, window := range windows {
+		startOfDay, err := time.Parse("15:04", window.Start)
+		if err != nil {
+			continue
+		}
+		offset := time.Duration(startOfDay.Hour())*time.Hour + time.Duration(startOfDay.Minute())*time.Minute
+		// windows may span multiple days, so starts on previous days are considered as well
+		daysBack := int(window.Duration.Duration / (24 * time.Hour))
+		for day := -daysBack - 1; day <= 7; day++ {
+			start := today.AddDate(0, 0, day).Add(offset)
+			if !windowStartsOn(window, start.Weekday()) {
+				continue
+			}
+			if !start.After(now) && now.Before(start.Add(window.Duration.Duration)) {
+				return true, time.Time{}
+			}
+			if start.After(now) && (next.IsZero() || start.Before(next)) {
+				next = start
+			}
+		}
+	}
+	return false, next
+}
+
+// windowStartsOn checks if the maintenance window starts on the given weekday.
+func windowStartsOn(window updatev1alpha1.MaintenanceWindow, weekday time.Weekday) bool {
+	if len(window.Days) == 0 {
+		return true
+	}
+	for _, day := range window.Days {
+		if strings.EqualFold(string(day), weekday.String()) {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,374 @@
+/*
+Copyright (c) Edgeless Systems GmbH
+
+SPDX-License-Identifier: BUSL-1.1
+*/
+
+package controllers
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+
+	updatev1alpha1 "github.com/edgelesssys/constellation/v2/operators/constellation-node-operator/api/v1alpha1"
+)
+
+func TestNewSurgeBudget(t *testing.T) {
+	scalingGroupByID := map[string]updatev1alpha1.ScalingGroup{
+		"control-plane-group": {
+			Spec: updatev1alpha1.ScalingGroupSpec{
+				GroupID:       "control-plane-group",
+				NodeGroupName: "control_plane_default",
+				Role:          updatev1alpha1.ControlPlaneRole,
+			},
+		},
+		"worker-group": {
+			Spec: updatev1alpha1.ScalingGroupSpec{
+				GroupID:       "worker-group",
+				NodeGroupName: "worker_default",
+				Role:          updatev1alpha1.WorkerRole,
+			},
+		},
+	}
+
+	testCases := map[string]struct {
+		strategy                  updatev1alpha1.UpgradeStrategy
+		extraNodes                int
+		extraNodesPerScalingGroup map[string]int
+		wantBudget                surgeBudget
+	}{
+		"default strategy": {
+			wantBudget: surgeBudget{
+				total:           1,
+				perRole:         map[updatev1alpha1.NodeRole]int{},
+				perScalingGroup: map[string]int{},
+			},
+		},
+		"default strategy with extra node": {
+			extraNodes:                1,
+			extraNodesPerScalingGroup: map[string]int{"worker-group": 1},
+			wantBudget: surgeBudget{
+				total:           0,
+				perRole:         map[updatev1alpha1.NodeRole]int{},
+				perScalingGroup: map[string]int{},
+			},
+		},
+		"max surge": {
+			strategy:                  updatev1alpha1.UpgradeStrategy{MaxSurge: 10},
+			extraNodes:                3,
+			extraNodesPerScalingGroup: map[string]int{"worker-group": 3},
+			wantBudget: surgeBudget{
+				total:           7,
+				perRole:         map[updatev1alpha1.NodeRole]int{},
+				perScalingGroup: map[string]int{},
+			},
+		},
+		"max surge per role": {
+			strategy: updatev1alpha1.UpgradeStrategy{
+				MaxSurge: 10,
+				MaxSurgePerRole: map[updatev1alpha1.NodeRole]int32{
+					updatev1alpha1.ControlPlaneRole: 1,
+					updatev1alpha1.WorkerRole:       5,
+				},
+			},
+			extraNodes:                3,
+			extraNodesPerScalingGroup: map[string]int{"control-plane-group": 1, "worker-group": 2},
+			wantBudget: surgeBudget{
+				total: 7,
+				perRole: map[updatev1alpha1.NodeRole]int{
+					updatev1alpha1.ControlPlaneRole: 0,
+					updatev1alpha1.WorkerRole:       3,
+				},
+				perScalingGroup: map[string]int{},
+			},
+		},
+		"max surge per node group": {
+			strategy: updatev1alpha1.UpgradeStrategy{
+				MaxSurge: 10,
+				MaxSurgePerNodeGroup: map[string]int32{
+					"worker_default":  4,
+					"unknown_default": 1,
+				},
+			},
+			extraNodes:                1,
+			extraNodesPerScalingGroup: map[string]int{"worker-group": 1},
+			wantBudget: surgeBudget{
+				total:           9,
+				perRole:         map[updatev1alpha1.NodeRole]int{},
+				perScalingGroup: map[string]int{"worker-group": 3},
+			},
+		},
+		"extra nodes exceed limit": {
+			strategy:                  updatev1alpha1.UpgradeStrategy{MaxSurge: 2},
+			extraNodes:                4,
+			extraNodesPerScalingGroup: map[string]int{"worker-group": 4},
+			wantBudget: surgeBudget{
+				total:           0,
+				perRole:         map[updatev1alpha1.NodeRole]int{},
+				perScalingGroup: map[string]int{},
+			},
+		},
+	}
+
+	for name, tc := range testCases {
+		t.Run(name, func(t *testing.T) {
+			assert := assert.New(t)
+
+			budget := newSurgeBudget(tc.strategy, scalingGroupByID, tc.extraNodes, tc.extraNodesPerScalingGroup)
+			assert.Equal(tc.wantBudget, budget)
+		})
+	}
+}
+
+func TestSurgeBudget(t *testing.T) {
+	assert := assert.New(t)
+
+	budget := surgeBudget{
+		total:           3,
+		perRole:         map[updatev1alpha1.NodeRole]int{updatev1alpha1.ControlPlaneRole: 1},
+		perScalingGroup: map[string]int{"worker-group": 1},
+	}
+	assert.True(budget.allows("control-plane-group", updatev1alpha1.ControlPlaneRole))
+	budget.consume("control-plane-group", updatev1alpha1.ControlPlaneRole)
+	assert.False(budget.allows("control-plane-group", updatev1alpha1.ControlPlaneRole))
+
+	assert.True(budget.allows("worker-group", updatev1alpha1.WorkerRole))
+	budget.consume("worker-group", updatev1alpha1.WorkerRole)
+	assert.False(budget.allows("worker-group", updatev1alpha1.WorkerRole))
+
+	assert.True(budget.allows("other-worker-group", updatev1alpha1.WorkerRole))
+	budget.consume("other-worker-group", updatev1alpha1.WorkerRole)
+	assert.False(budget.allows("other-worker-group", updatev1alpha1.WorkerRole))
+	assert.Equal(0, budget.total)
+}
+
+func TestUpgradeHaltedCondition(t *testing.T) {
+	// Wednesday, 12:00 UTC
+	now := time.Date(2024, time.January, 3, 12, 0, 0, 0, time.UTC)
+	nodeTimeout := &metav1.Duration{Duration: time.Hour}
+
+	testCases := map[string]struct {
+		nodeVersion      updatev1alpha1.NodeVersion
+		groups           nodeGroups
+		pendingNodes     []updatev1alpha1.PendingNode
+		wantStatus       metav1.ConditionStatus
+		wantReason       string
+		wantRequeueAfter time.Duration
+	}{
+		"default strategy": {
+			wantStatus: metav1.ConditionFalse,
+			wantReason: conditionUpgradeProceedingReason,
+		},
+		"paused": {
+			nodeVersion: updatev1alpha1.NodeVersion{
+				Spec: updatev1alpha1.NodeVersionSpec{
+					UpgradeStrategy: updatev1alpha1.UpgradeStrategy{Paused: true},
+				},
+			},
+			wantStatus: metav1.ConditionTrue,
+			wantReason: conditionUpgradePausedReason,
+		},
+		"inside maintenance window": {
+			nodeVersion: updatev1alpha1.NodeVersion{
+				Spec: updatev1alpha1.NodeVersionSpec{
+					UpgradeStrategy: updatev1alpha1.UpgradeStrategy{
+						MaintenanceWindows: []updatev1alpha1.MaintenanceWindow{
+							{Start: "11:00", Duration: metav1.Duration{Duration: 2 * time.Hour}},
+						},
+					},
+				},
+			},
+			wantStatus: metav1.ConditionFalse,
+			wantReason: conditionUpgradeProceedingReason,
+		},
+		"outside maintenance window": {
+			nodeVersion: updatev1alpha1.NodeVersion{
+				Spec: updatev1alpha1.NodeVersionSpec{
+					UpgradeStrategy: updatev1alpha1.UpgradeStrategy{
+						MaintenanceWindows: []updatev1alpha1.MaintenanceWindow{
+							{Start: "22:00", Duration: metav1.Duration{Duration: 4 * time.Hour}},
+						},
+					},
+				},
+			},
+			wantStatus:       metav1.ConditionTrue,
+			wantReason:       conditionOutsideMaintenanceWindowReason,
+			wantRequeueAfter: 10 * time.Hour,
+		},
+		"replacement in progress": {
+			nodeVersion: updatev1alpha1.NodeVersion{
+				Spec: updatev1alpha1.NodeVersionSpec{
+					UpgradeStrategy: updatev1alpha1.UpgradeStrategy{NodeTimeout: nodeTimeout},
+				},
+			},
+			groups: nodeGroups{
+				Heirs: []corev1.Node{
+					{ObjectMeta: metav1.ObjectMeta{Name: "heir", CreationTimestamp: metav1.NewTime(now.Add(-20 * time.Minute))}},
+				},
+			},
+			pendingNodes: []updatev1alpha1.PendingNode{
+				{
+					ObjectMeta: metav1.ObjectMeta{Name: "joining", CreationTimestamp: metav1.NewTime(now.Add(-50 * time.Minute))},
+					Spec:       updatev1alpha1.PendingNodeSpec{NodeName: "joining", Goal: updatev1alpha1.NodeGoalJoin},
+				},
+				{
+					ObjectMeta: metav1.ObjectMeta{Name: "leaving", CreationTimestamp: metav1.NewTime(now.Add(-2 * time.Hour))},
+					Spec:       updatev1alpha1.PendingNodeSpec{NodeName: "leaving", Goal: updatev1alpha1.NodeGoalLeave},
+				},
+			},
+			wantStatus:       metav1.ConditionFalse,
+			wantReason:       conditionUpgradeProceedingReason,
+			wantRequeueAfter: 10 * time.Minute,
+		},
+		"heir timed out": {
+			nodeVersion: updatev1alpha1.NodeVersion{
+				Spec: updatev1alpha1.NodeVersionSpec{
+					UpgradeStrategy: updatev1alpha1.UpgradeStrategy{NodeTimeout: nodeTimeout},
+				},
+			},
+			groups: nodeGroups{
+				Heirs: []corev1.Node{
+					{ObjectMeta: metav1.ObjectMeta{Name: "heir", CreationTimestamp: metav1.NewTime(now.Add(-2 * time.Hour))}},
+				},
+			},
+			wantStatus: metav1.ConditionTrue,
+			wantReason: conditionNodeTimeoutReason,
+		},
+		"joining node timed out": {
+			nodeVersion: updatev1alpha1.NodeVersion{
+				Spec: updatev1alpha1.NodeVersionSpec{
+					UpgradeStrategy: updatev1alpha1.UpgradeStrategy{NodeTimeout: nodeTimeout},
+				},
+			},
+			pendingNodes: []updatev1alpha1.PendingNode{
+				{
+					ObjectMeta: metav1.ObjectMeta{Name: "joining", CreationTimestamp: metav1.NewTime(now.Add(-time.Hour))},
+					Spec:       updatev1alpha1.PendingNodeSpec{NodeName: "joining", Goal: updatev1alpha1.NodeGoalJoin},
+				},
+			},
+			wantStatus: metav1.ConditionTrue,
+			wantReason: conditionNodeTimeoutReason,
+		},
+		"timeout persists for same generation": {
+			nodeVersion: updatev1alpha1.NodeVersion{
+				ObjectMeta: metav1.ObjectMeta{Generation: 2},
+				Spec: updatev1alpha1.NodeVersionSpec{
+					UpgradeStrategy: updatev1alpha1.UpgradeStrategy{NodeTimeout: nodeTimeout},
+				},
+				Status: updatev1alpha1.NodeVersionStatus{
+					Conditions: []metav1.Condition{
+						{
+							Type:               updatev1alpha1.ConditionUpgradeHalted,
+							Status:             metav1.ConditionTrue,
+							Reason:             conditionNodeTimeoutReason,
+							ObservedGeneration: 2,
+						},
+					},
+				},
+			},
+			wantStatus: metav1.ConditionTrue,
+			wantReason: conditionNodeTimeoutReason,
+		},
+		"timeout is reset by spec change": {
+			nodeVersion: updatev1alpha1.NodeVersion{
+				ObjectMeta: metav1.ObjectMeta{Generation: 3},
+				Spec: updatev1alpha1.NodeVersionSpec{
+					UpgradeStrategy: updatev1alpha1.UpgradeStrategy{NodeTimeout: nodeTimeout},
+				},
+				Status: updatev1alpha1.NodeVersionStatus{
+					Conditions: []metav1.Condition{
+						{
+							Type:               updatev1alpha1.ConditionUpgradeHalted,
+							Status:             metav1.ConditionTrue,
+							Reason:             conditionNodeTimeoutReason,
+							ObservedGeneration: 2,
+						},
+					},
+				},
+			},
+			wantStatus: metav1.ConditionFalse,
+			wantReason: conditionUpgradeProceedingReason,
+		},
+	}
+
+	for name, tc := range testCases {
+		t.Run(name, func(t *testing.T) {
+			assert := assert.New(t)
+
+			condition, requeueAfter := upgradeHaltedCondition(&tc.nodeVersion, tc.groups, tc.pendingNodes, now)
+			assert.Equal(updatev1alpha1.ConditionUpgradeHalted, condition.Type)
+			assert.Equal(tc.wantStatus, condition.Status)
+			assert.Equal(tc.wantReason, condition.Reason)
+			assert.Equal(tc.nodeVersion.Generation, condition.ObservedGeneration)
+			assert.Equal(tc.wantRequeueAfter, requeueAfter)
+		})
+	}
+}
+
+func TestMaintenanceWindowOpen(t *testing.T) {
+	// Wednesday, 12:00 UTC
+	now := time.Date(2024, time.January, 3, 12, 0, 0, 0, time.UTC)
+
+	testCases := map[string]struct {
+		windows  []updatev1alpha1.MaintenanceWindow
+		wantOpen bool
+		wantNext time.Time
+	}{
+		"daily window open": {
+			windows: []updatev1alpha1.MaintenanceWindow{
+				{Start: "12:00", Duration: metav1.Duration{Duration: time.Minute}},
+			},
+			wantOpen: true,
+		},
+		"daily window closed": {
+			windows: []updatev1alpha1.MaintenanceWindow{
+				{Start: "02:00", Duration: metav1.Duration{Duration: 2 * time.Hour}},
+			},
+			wantNext: time.Date(2024, time.January, 4, 2, 0, 0, 0, time.UTC),
+		},
+		"window ends when now starts": {
+			windows: []updatev1alpha1.MaintenanceWindow{
+				{Start: "11:00", Duration: metav1.Duration{Duration: time.Hour}},
+			},
+			wantNext: time.Date(2024, time.January, 4, 11, 0, 0, 0, time.UTC),
+		},
+		"window on other day": {
+			windows: []updatev1alpha1.MaintenanceWindow{
+				{Days: []updatev1alpha1.Weekday{"Saturday", "Sunday"}, Start: "00:00", Duration: metav1.Duration{Duration: 24 * time.Hour}},
+			},
+			wantNext: time.Date(2024, time.January, 6, 0, 0, 0, 0, time.UTC),
+		},
+		"window spanning days": {
+			windows: []updatev1alpha1.MaintenanceWindow{
+				{Days: []updatev1alpha1.Weekday{"Monday"}, Start: "20:00", Duration: metav1.Duration{Duration: 48 * time.Hour}},
+			},
+			wantOpen: true,
+		},
+		"multiple windows": {
+			windows: []updatev1alpha1.MaintenanceWindow{
+				{Days: []updatev1alpha1.Weekday{"Friday"}, Start: "18:00", Duration: metav1.Duration{Duration: time.Hour}},
+				{Days: []updatev1alpha1.Weekday{"Wednesday"}, Start: "13:30", Duration: metav1.Duration{Duration: time.Hour}},
+			},
+			wantNext: time.Date(2024, time.January, 3, 13, 30, 0, 0, time.UTC),
+		},
+		"invalid window is ignored": {
+			windows: []updatev1alpha1.MaintenanceWindow{
+				{Start: "noon", Duration: metav1.Duration{Duration: time.Hour}},
+			},
+		},
+	}
+
+	for name, tc := range testCases {
+		t.Run(name, func(t *testing.T) {
+			assert := assert.New(t)
+
+			open, next := maintenanceWindowOpen(tc.windows, now)
+			assert.Equal(tc.wantOpen, open)
+			assert.Equal(tc.wantNext, next)
+		})
+	}
+}
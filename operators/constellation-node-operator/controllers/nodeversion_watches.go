@@ -74,6 +74,23 @@ func nodeReadyPredicate() predicate.Predicate {
 	}
 }
 
+// nodeReplaceAnnotationChangedPredicate checks if a node was marked for replacement by a NodeReplacement, or if the mark was removed.
+func nodeReplaceAnnotationChangedPredicate() predicate.Predicate {
+	return predicate.Funcs{
+		UpdateFunc: func(e event.UpdateEvent) bool {
+			oldNode, ok := e.ObjectOld.(*corev1.Node)
+			if !ok {
+				return false
+			}
+			newNode, ok := e.ObjectNew.(*corev1.Node)
+			if !ok {
+				return false
+			}
+			return oldNode.Annotations[replaceAnnotation] != newNode.Annotations[replaceAnnotation]
+		},
+	}
+}
+
 // nodeMaintenanceSucceededPredicate checks if a node maintenance resource switched its status to "maintenance succeeded".
 func nodeMaintenanceSucceededPredicate() predicate.Predicate {
 	return predicate.Funcs{
@@ -179,6 +179,60 @@ func TestNodeReadyPredicate(t *testing.T) {
 	}
 }
 
+func TestNodeReplaceAnnotationChangedPredicate(t *testing.T) {
+	testCases := map[string]struct {
+		event          event.UpdateEvent
+		wantProcessing bool
+	}{
+		"old object is not a node": {
+			event: event.UpdateEvent{
+				ObjectNew: &corev1.Node{},
+			},
+		},
+		"new object is not a node": {
+			event: event.UpdateEvent{
+				ObjectOld: &corev1.Node{},
+			},
+		},
+		"annotation is unchanged": {
+			event: event.UpdateEvent{
+				ObjectOld: &corev1.Node{
+					ObjectMeta: metav1.ObjectMeta{Annotations: map[string]string{replaceAnnotation: "replacement"}},
+				},
+				ObjectNew: &corev1.Node{
+					ObjectMeta: metav1.ObjectMeta{Annotations: map[string]string{replaceAnnotation: "replacement", heirAnnotation: "heir"}},
+				},
+			},
+		},
+		"node was marked for replacement": {
+			event: event.UpdateEvent{
+				ObjectOld: &corev1.Node{},
+				ObjectNew: &corev1.Node{
+					ObjectMeta: metav1.ObjectMeta{Annotations: map[string]string{replaceAnnotation: "replacement"}},
+				},
+			},
+			wantProcessing: true,
+		},
+		"mark was removed": {
+			event: event.UpdateEvent{
+				ObjectOld: &corev1.Node{
+					ObjectMeta: metav1.ObjectMeta{Annotations: map[string]string{replaceAnnotation: "replacement"}},
+				},
+				ObjectNew: &corev1.Node{},
+			},
+			wantProcessing: true,
+		},
+	}
+
+	for name, tc := range testCases {
+		t.Run(name, func(t *testing.T) {
+			assert := assert.New(t)
+			predicate := nodeReplaceAnnotationChangedPredicate()
+			assert.Equal(tc.wantProcessing, predicate.Update(tc.event))
+		})
+	}
+}
+
 func TestNodeMaintenanceSucceededPredicate(t *testing.T) {
 	testCases := map[string]struct {
 		event          event.UpdateEvent
@@ -0,0 +1,13 @@
+/*
+Copyright (c) Edgeless Systems GmbH
+
+SPDX-License-Identifier: BUSL-1.1
+*/
+
+package client
+
+// AutoscalingCloudProvider returns the cloud-provider name as used by k8s cluster-autoscaler.
+// The cluster-autoscaler does not support Nova server groups, so autoscaling is not available on OpenStack.
+func (c *Client) AutoscalingCloudProvider() string {
+	return "openstack"
+}
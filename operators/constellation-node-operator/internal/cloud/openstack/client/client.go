@@ -0,0 +1,135 @@
+/*
+Copyright (c) Edgeless Systems GmbH
+
+SPDX-License-Identifier: BUSL-1.1
+*/
+
+package client
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"math/rand"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/gophercloud/gophercloud/v2"
+	"github.com/gophercloud/utils/v2/openstack/clientconfig"
+)
+
+const (
+	// microversion is the compute API microversion used to read servers.
+	// Later microversions no longer return the flavor ID of a server.
+	microversion = "2.42"
+	// createMicroversion is the compute API microversion used to create servers.
+	// It is required to set tags and volume types on creation.
+	createMicroversion = "2.67"
+	// imdsUserDataURL is the URL of the user data of the instance the operator is running on.
+	imdsUserDataURL = "http://169.254.169.254/openstack/2018-08-27/user_data"
+)
+
+// Client is a client for OpenStack.
+// Scaling groups are implemented as Nova server groups.
+type Client struct {
+	compute *gophercloud.ServiceClient
+	network *gophercloud.ServiceClient
+	volume  *gophercloud.ServiceClient
+	// userData is passed to newly created servers.
+	// All nodes of a Constellation share the same user data.
+	userData []byte
+	// prng is a pseudo-random number generator seeded with time. Not used for security.
+	prng
+}
+
+// New creates a new client for OpenStack.
+// The credentials are taken from the user data of the instance the operator is running on.
+func New(ctx context.Context) (*Client, error) {
+	userData, err := getUserData(ctx, &http.Client{})
+	if err != nil {
+		return nil, fmt.Errorf("getting user data: %w", err)
+	}
+	var creds userDataCredentials
+	if err := json.Unmarshal(userData, &creds); err != nil {
+		return nil, fmt.Errorf("unmarshalling user data: %w", err)
+	}
+
+	clientOpts := &clientconfig.ClientOpts{
+		AuthType: clientconfig.AuthV3Password,
+		AuthInfo: &clientconfig.AuthInfo{
+			AuthURL:        creds.AuthURL,
+			UserDomainName: creds.UserDomainName,
+			Username:       creds.Username,
+			Password:       creds.Password,
+		},
+		RegionName: creds.RegionName,
+	}
+
+	computeClient, err := clientconfig.NewServiceClient(ctx, "compute", clientOpts)
+	if err != nil {
+		return nil, fmt.Errorf("creating compute client: %w", err)
+	}
+	computeClient.Microversion = microversion
+	networkClient, err := clientconfig.NewServiceClient(ctx, "network", clientOpts)
+	if err != nil {
+		return nil, fmt.Errorf("creating network client: %w", err)
+	}
+	volumeClient, err := clientconfig.NewServiceClient(ctx, "volume", clientOpts)
+	if err != nil {
+		return nil, fmt.Errorf("creating volume client: %w", err)
+	}
+
+	return &Client{
+		compute:  computeClient,
+		network:  networkClient,
+		volume:   volumeClient,
+		userData: userData,
+		prng:     rand.New(rand.NewSource(int64(time.Now().Nanosecond()))),
+	}, nil
+}
+
+// userDataCredentials are the OpenStack credentials contained in the user data of a node.
+type userDataCredentials struct {
+	AuthURL        string `json:"openstack-auth-url"`
+	UserDomainName string `json:"openstack-user-domain-name"`
+	RegionName     string `json:"openstack-region-name"`
+	Username       string `json:"openstack-username"`
+	Password       string `json:"openstack-password"`
+}
+
+type prng interface {
+	// Intn returns, as an int, a non-negative pseudo-random number in the half-open interval [0,n). It panics if n <= 0.
+	Intn(n int) int
+}
+
+// serverIDFromProviderID returns the server ID from a provider ID.
+// The provider ID has the format openstack://<region>/<server-id>, where the region is optional.
+func serverIDFromProviderID(providerID string) (string, error) {
+	trimmed, ok := strings.CutPrefix(providerID, "openstack://")
+	if !ok {
+		return "", fmt.Errorf("invalid providerID: %s", providerID)
+	}
+	parts := strings.Split(trimmed, "/")
+	if len(parts) != 2 || parts[1] == "" {
+		return "", fmt.Errorf("invalid providerID: %s", providerID)
+	}
+	return parts[1], nil
+}
+
+// providerIDFromServerID returns the provider ID of a server as set by the OpenStack cloud controller manager.
+func providerIDFromServerID(serverID string) string {
+	return "openstack:///" + serverID
+}
+
+// generateServerName generates a name for a new server in a server group.
+func generateServerName(baseName string, random prng) string {
+	letters := []byte("abcdefghijklmnopqrstuvwxyz0123456789")
+	const uidLen = 4
+	uid := make([]byte, 0, uidLen)
+	for i := 0; i < uidLen; i++ {
+		n := random.Intn(len(letters))
+		uid = append(uid, letters[n])
+	}
+	return baseName + "-" + string(uid)
+}
@@ -0,0 +1,553 @@
+/*
+Copyright (c) Edgeless Systems GmbH
+
+SPDX-License-Identifier: BUSL-1.1
+*/
+
+package client
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"slices"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/gophercloud/gophercloud/v2"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestServerIDFromProviderID(t *testing.T) {
+	testCases := map[string]struct {
+		providerID string
+		want       string
+		wantErr    bool
+	}{
+		"valid without region": {
+			providerID: "openstack:///0c1c5fd5-5e1c-4c4f-8c47-7a2f1b0c2a21",
+			want:       "0c1c5fd5-5e1c-4c4f-8c47-7a2f1b0c2a21",
+		},
+		"valid with region": {
+			providerID: "openstack://RegionOne/0c1c5fd5-5e1c-4c4f-8c47-7a2f1b0c2a21",
+			want:       "0c1c5fd5-5e1c-4c4f-8c47-7a2f1b0c2a21",
+		},
+		"wrong provider": {
+			providerID: "aws:///us-east-2a/i-06888991e7138ed4e",
+			wantErr:    true,
+		},
+		"too many parts": {
+			providerID: "openstack:///0c1c5fd5-5e1c-4c4f-8c47-7a2f1b0c2a21/invalid",
+			wantErr:    true,
+		},
+		"missing server id": {
+			providerID: "openstack:///",
+			wantErr:    true,
+		},
+	}
+
+	for name, tc := range testCases {
+		t.Run(name, func(t *testing.T) {
+			assert := assert.New(t)
+			require := require.New(t)
+
+			got, err := serverIDFromProviderID(tc.providerID)
+			if tc.wantErr {
+				require.Error(err)
+				return
+			}
+			require.NoError(err)
+			assert.Equal(tc.want, got)
+		})
+	}
+}
+
+func TestGenerateServerName(t *testing.T) {
+	assert := assert.New(t)
+
+	name := generateServerName("constellation-worker", &stubRng{result: 0})
+	assert.Equal("constellation-worker-aaaa", name)
+}
+
+type stubRng struct {
+	result int
+}
+
+func (r *stubRng) Intn(_ int) int {
+	return r.result
+}
+
+// fakeOpenStack is an in-memory fake of the OpenStack Compute, Networking and Block Storage APIs.
+// It implements the subset of the APIs used by the client.
+type fakeOpenStack struct {
+	mux          sync.Mutex
+	servers      map[string]*fakeServer
+	serverGroups map[string]*fakeServerGroup
+	ports        map[string]*fakePort
+	volumes      map[string]*fakeVolume
+	nextID       int
+
+	// createRequest is the last server create request.
+	createRequest *fakeCreateRequest
+	// failServerCreate lets server creation fail.
+	failServerCreate bool
+	// failServerGet lets all server get requests fail.
+	failServerGet bool
+}
+
+type fakeServer struct {
+	ID        string
+	Name      string
+	Status    string
+	TaskState string
+	Created   time.Time
+	Image     string
+	Flavor    string
+	AZ        string
+	Metadata  map[string]string
+	Tags      []string
+	Volumes   []string
+	Ports     []string
+}
+
+type fakeServerGroup struct {
+	ID      string
+	Name    string
+	Members []string
+}
+
+type fakePort struct {
+	ID             string
+	Name           string
+	NetworkID      string
+	SubnetIDs      []string
+	SecurityGroups []string
+}
+
+type fakeVolume struct {
+	ID         string
+	Size       int
+	VolumeType string
+	ServerID   string
+	Device     string
+	ImageID    string
+}
+
+type fakeCreateRequest struct {
+	Name             string                  `json:"name"`
+	ImageRef         string                  `json:"imageRef"`
+	FlavorRef        string                  `json:"flavorRef"`
+	AvailabilityZone string                  `json:"availability_zone"`
+	UserData         string                  `json:"user_data"`
+	Metadata         map[string]string       `json:"metadata"`
+	Tags             []string                `json:"tags"`
+	Networks         []fakeCreateNetwork     `json:"networks"`
+	BlockDevices     []fakeCreateBlockDevice `json:"block_device_mapping_v2"`
+	Group            string                  `json:"-"`
+	Microversion     string                  `json:"-"`
+}
+
+type fakeCreateNetwork struct {
+	Port string `json:"port"`
+}
+
+type fakeCreateBlockDevice struct {
+	SourceType          string `json:"source_type"`
+	DestinationType     string `json:"destination_type"`
+	UUID                string `json:"uuid"`
+	VolumeSize          int    `json:"volume_size"`
+	VolumeType          string `json:"volume_type"`
+	BootIndex           int    `json:"boot_index"`
+	DeleteOnTermination bool   `json:"delete_on_termination"`
+}
+
+func newFakeOpenStack() *fakeOpenStack {
+	return &fakeOpenStack{
+		servers:      map[string]*fakeServer{},
+		serverGroups: map[string]*fakeServerGroup{},
+		ports:        map[string]*fakePort{},
+		volumes:      map[string]*fakeVolume{},
+	}
+}
+
+// newClient starts the fake APIs and returns a client using them.
+func (f *fakeOpenStack) newClient(t *testing.T) *Client {
+	t.Helper()
+	srv := httptest.NewServer(f.handler())
+	t.Cleanup(srv.Close)
+
+	provider := &gophercloud.ProviderClient{TokenID: "token", HTTPClient: *srv.Client()}
+	return &Client{
+		compute:  &gophercloud.ServiceClient{ProviderClient: provider, Endpoint: srv.URL + "/compute/", Type: "compute", Microversion: microversion},
+		network:  &gophercloud.ServiceClient{ProviderClient: provider, Endpoint: srv.URL + "/network/", ResourceBase: srv.URL + "/network/v2.0/", Type: "network"},
+		volume:   &gophercloud.ServiceClient{ProviderClient: provider, Endpoint: srv.URL + "/volume/", Type: "volume"},
+		userData: []byte(`{"openstack-auth-url":"https://keystone.example.com"}`),
+		prng:     &stubRng{result: 0},
+	}
+}
+
+func (f *fakeOpenStack) id(prefix string) string {
+	f.nextID++
+	return fmt.Sprintf("%s-%d", prefix, f.nextID)
+}
+
+func (f *fakeOpenStack) handler() http.Handler {
+	mux := http.NewServeMux()
+	mux.HandleFunc("GET /compute/servers/{id}", f.getServer)
+	mux.HandleFunc("POST /compute/servers", f.createServer)
+	mux.HandleFunc("DELETE /compute/servers/{id}", f.deleteServer)
+	mux.HandleFunc("PUT /compute/servers/{id}/metadata/{key}", f.setServerMetadatum)
+	mux.HandleFunc("GET /compute/servers/{id}/os-interface", f.listInterfaces)
+	mux.HandleFunc("GET /compute/os-server-groups", f.listServerGroups)
+	mux.HandleFunc("GET /compute/os-server-groups/{id}", f.getServerGroup)
+	mux.HandleFunc("GET /network/v2.0/ports/{id}", f.getPort)
+	mux.HandleFunc("POST /network/v2.0/ports", f.createPort)
+	mux.HandleFunc("DELETE /network/v2.0/ports/{id}", f.deletePort)
+	mux.HandleFunc("GET /volume/volumes/{id}", f.getVolume)
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("X-Auth-Token") != "token" {
+			http.Error(w, "unauthorized", http.StatusUnauthorized)
+			return
+		}
+		f.mux.Lock()
+		defer f.mux.Unlock()
+		mux.ServeHTTP(w, r)
+	})
+}
+
+func (f *fakeOpenStack) getServer(w http.ResponseWriter, r *http.Request) {
+	if f.failServerGet {
+		http.Error(w, "internal error", http.StatusInternalServerError)
+		return
+	}
+	server, ok := f.servers[r.PathValue("id")]
+	if !ok {
+		http.NotFound(w, r)
+		return
+	}
+	var image any = ""
+	if server.Image != "" {
+		image = map[string]any{"id": server.Image}
+	}
+	volumes := []map[string]any{}
+	for _, volumeID := range server.Volumes {
+		volumes = append(volumes, map[string]any{"id": volumeID})
+	}
+	writeJSON(w, http.StatusOK, map[string]any{"server": map[string]any{
+		"id":                                   server.ID,
+		"name":                                 server.Name,
+		"status":                               server.Status,
+		"created":                              server.Created.Format(time.RFC3339),
+		"image":                                image,
+		"flavor":                               map[string]any{"id": server.Flavor},
+		"metadata":                             server.Metadata,
+		"tags":                                 server.Tags,
+		"OS-EXT-AZ:availability_zone":          server.AZ,
+		"OS-EXT-STS:task_state":                server.TaskState,
+		"os-extended-volumes:volumes_attached": volumes,
+	}})
+}
+
+func (f *fakeOpenStack) createServer(w http.ResponseWriter, r *http.Request) {
+	if f.failServerCreate {
+		http.Error(w, "quota exceeded", http.StatusForbidden)
+		return
+	}
+	var body struct {
+		Server fakeCreateRequest `json:"server"`
+		Hints  struct {
+			Group string `json:"group"`
+		} `json:"os:scheduler_hints"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&body); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	userData, err := base64.StdEncoding.DecodeString(body.Server.UserData)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	req := body.Server
+	req.UserData = string(userData)
+	req.Group = body.Hints.Group
+	req.Microversion = r.Header.Get("X-OpenStack-Nova-API-Version")
+	f.createRequest = &req
+
+	server := &fakeServer{
+		ID:       f.id("server"),
+		Name:     req.Name,
+		Status:   "BUILD",
+		Created:  time.Now(),
+		Image:    req.ImageRef,
+		Flavor:   req.FlavorRef,
+		AZ:       req.AvailabilityZone,
+		Metadata: req.Metadata,
+		Tags:     req.Tags,
+	}
+	for _, network := range req.Networks {
+		server.Ports = append(server.Ports, network.Port)
+	}
+	for _, device := range req.BlockDevices {
+		volume := &fakeVolume{ID: f.id("volume"), Size: device.VolumeSize, VolumeType: device.VolumeType, ServerID: server.ID}
+		if device.SourceType == "image" {
+			volume.ImageID = device.UUID
+		}
+		f.volumes[volume.ID] = volume
+		server.Volumes = append(server.Volumes, volume.ID)
+	}
+	f.servers[server.ID] = server
+	if group, ok := f.serverGroups[req.Group]; ok {
+		group.Members = append(group.Members, server.ID)
+	}
+	writeJSON(w, http.StatusAccepted, map[string]any{"server": map[string]any{"id": server.ID}})
+}
+
+func (f *fakeOpenStack) deleteServer(w http.ResponseWriter, r *http.Request) {
+	id := r.PathValue("id")
+	if _, ok := f.servers[id]; !ok {
+		http.NotFound(w, r)
+		return
+	}
+	delete(f.servers, id)
+	for _, group := range f.serverGroups {
+		group.Members = slices.DeleteFunc(group.Members, func(member string) bool { return member == id })
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func (f *fakeOpenStack) setServerMetadatum(w http.ResponseWriter, r *http.Request) {
+	server, ok := f.servers[r.PathValue("id")]
+	if !ok {
+		http.NotFound(w, r)
+		return
+	}
+	var body struct {
+		Meta map[string]string `json:"meta"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&body); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	if server.Metadata == nil {
+		server.Metadata = map[string]string{}
+	}
+	key := r.PathValue("key")
+	server.Metadata[key] = body.Meta[key]
+	writeJSON(w, http.StatusOK, body)
+}
+
+func (f *fakeOpenStack) listInterfaces(w http.ResponseWriter, r *http.Request) {
+	server, ok := f.servers[r.PathValue("id")]
+	if !ok {
+		http.NotFound(w, r)
+		return
+	}
+	interfaces := []map[string]any{}
+	for _, portID := range server.Ports {
+		interfaces = append(interfaces, map[string]any{"port_id": portID, "port_state": "ACTIVE"})
+	}
+	writeJSON(w, http.StatusOK, map[string]any{"interfaceAttachments": interfaces})
+}
+
+func (f *fakeOpenStack) listServerGroups(w http.ResponseWriter, _ *http.Request) {
+	groups := []map[string]any{}
+	for _, group := range f.serverGroups {
+		groups = append(groups, serverGroupJSON(group))
+	}
+	writeJSON(w, http.StatusOK, map[string]any{"server_groups": groups})
+}
+
+func (f *fakeOpenStack) getServerGroup(w http.ResponseWriter, r *http.Request) {
+	group, ok := f.serverGroups[r.PathValue("id")]
+	if !ok {
+		http.NotFound(w, r)
+		return
+	}
+	writeJSON(w, http.StatusOK, map[string]any{"server_group": serverGroupJSON(group)})
+}
+
+func (f *fakeOpenStack) getPort(w http.ResponseWriter, r *http.Request) {
+	port, ok := f.ports[r.PathValue("id")]
+	if !ok {
+		http.NotFound(w, r)
+		return
+	}
+	writeJSON(w, http.StatusOK, map[string]any{"port": portJSON(port)})
+}
+
+func (f *fakeOpenStack) createPort(w http.ResponseWriter, r *http.Request) {
+	var body struct {
+		Port struct {
+			Name      string `json:"name"`
+			NetworkID string `json:"network_id"`
+			FixedIPs  []struct {
+				SubnetID  string `json:"subnet_id"`
+				IPAddress string `json:"ip_address"`
+			} `json:"fixed_ips"`
+			SecurityGroups []string `json:"security_groups"`
+		} `json:"port"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&body); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	port := &fakePort{
+		ID:             f.id("port"),
+		Name:           body.Port.Name,
+		NetworkID:      body.Port.NetworkID,
+		SecurityGroups: body.Port.SecurityGroups,
+	}
+	for _, fixedIP := range body.Port.FixedIPs {
+		if fixedIP.IPAddress != "" {
+			http.Error(w, "fixed IP address must not be copied", http.StatusConflict)
+			return
+		}
+		port.SubnetIDs = append(port.SubnetIDs, fixedIP.SubnetID)
+	}
+	f.ports[port.ID] = port
+	writeJSON(w, http.StatusCreated, map[string]any{"port": portJSON(port)})
+}
+
+func (f *fakeOpenStack) deletePort(w http.ResponseWriter, r *http.Request) {
+	id := r.PathValue("id")
+	if _, ok := f.ports[id]; !ok {
+		http.NotFound(w, r)
+		return
+	}
+	delete(f.ports, id)
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func (f *fakeOpenStack) getVolume(w http.ResponseWriter, r *http.Request) {
+	volume, ok := f.volumes[r.PathValue("id")]
+	if !ok {
+		http.NotFound(w, r)
+		return
+	}
+	attachments := []map[string]any{}
+	if volume.ServerID != "" {
+		attachments = append(attachments, map[string]any{"server_id": volume.ServerID, "device": volume.Device, "volume_id": volume.ID})
+	}
+	resp := map[string]any{
+		"id":          volume.ID,
+		"size":        volume.Size,
+		"volume_type": volume.VolumeType,
+		"attachments": attachments,
+	}
+	if volume.ImageID != "" {
+		resp["volume_image_metadata"] = map[string]string{"image_id": volume.ImageID}
+	}
+	writeJSON(w, http.StatusOK, map[string]any{"volume": resp})
+}
+
+func serverGroupJSON(group *fakeServerGroup) map[string]any {
+	members := group.Members
+	if members == nil {
+		members = []string{}
+	}
+	return map[string]any{
+		"id":       group.ID,
+		"name":     group.Name,
+		"members":  members,
+		"policies": []string{"soft-anti-affinity"},
+	}
+}
+
+func portJSON(port *fakePort) map[string]any {
+	fixedIPs := []map[string]string{}
+	for i, subnetID := range port.SubnetIDs {
+		fixedIPs = append(fixedIPs, map[string]string{"subnet_id": subnetID, "ip_address": fmt.Sprintf("192.168.178.%d", i+2)})
+	}
+	return map[string]any{
+		"id":              port.ID,
+		"name":            port.Name,
+		"network_id":      port.NetworkID,
+		"fixed_ips":       fixedIPs,
+		"security_groups": port.SecurityGroups,
+	}
+}
+
+func writeJSON(w http.ResponseWriter, status int, v any) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	_ = json.NewEncoder(w).Encode(v)
+}
+
+// workerGroupID is the ID of the worker server group of the fake cluster.
+// Nova requires server group IDs to be UUIDs.
+const workerGroupID = "3e0e1a4c-8e3f-4a5b-9c41-2d0c6a1b7f52"
+
+// newFakeCluster returns a fake with a worker server group of a Constellation with uid "uid".
+// The single member "worker-0" boots from a volume created from "image-1" and has a blank state disk volume.
+func newFakeCluster() *fakeOpenStack {
+	f := newFakeOpenStack()
+	f.volumes["boot-volume-0"] = &fakeVolume{ID: "boot-volume-0", Size: 5, VolumeType: "ssd", ServerID: "worker-0", Device: "/dev/vda", ImageID: "image-1"}
+	f.volumes["state-volume-0"] = &fakeVolume{ID: "state-volume-0", Size: 30, VolumeType: "ssd", ServerID: "worker-0", Device: "/dev/vdb"}
+	f.ports["port-0"] = &fakePort{ID: "port-0", Name: "worker-0", NetworkID: "network", SubnetIDs: []string{"nodes-subnet"}, SecurityGroups: []string{"security-group"}}
+	f.servers["worker-0"] = &fakeServer{
+		ID:      "worker-0",
+		Name:    "constellation-worker-0",
+		Status:  "ACTIVE",
+		Created: time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC),
+		Flavor:  "flavor",
+		AZ:      "zone",
+		Metadata: map[string]string{
+			"constellation-uid":  "uid",
+			"constellation-role": "worker",
+		},
+		Tags:    []string{"constellation-role-worker", "constellation-node-group-worker_default", "constellation-uid-uid"},
+		Volumes: []string{"state-volume-0", "boot-volume-0"},
+		Ports:   []string{"port-0"},
+	}
+	f.serverGroups[workerGroupID] = &fakeServerGroup{ID: workerGroupID, Name: "constellation-worker", Members: []string{"worker-0"}}
+	return f
+}
+
+// newTerraformCluster returns a fake holding the servers and server groups
+// the OpenStack Terraform module creates for a cluster with uid "b1c0e2a9".
+// The project also holds a server group of another cluster and one that wasn't created by Constellation.
+func newTerraformCluster() *fakeOpenStack {
+	f := newFakeOpenStack()
+	created := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	addGroup := func(groupID, groupName, uid, role, nodeGroup string, members ...string) {
+		f.serverGroups[groupID] = &fakeServerGroup{ID: groupID, Name: groupName, Members: members}
+		for i, member := range members {
+			f.servers[member] = &fakeServer{
+				ID:      member,
+				Name:    fmt.Sprintf("%s-%d", groupName, i),
+				Status:  "ACTIVE",
+				Created: created.Add(time.Duration(i) * time.Second),
+				Flavor:  "4b1dd5c6-0b6e-4d8d-a0b4-6f2f4c5a9e11",
+				AZ:      "eu01-1",
+				Metadata: map[string]string{
+					"constellation-role":             role,
+					"constellation-uid":              uid,
+					"constellation-init-secret-hash": "$2a$10$6v5sM0jC0Q2Hk9bQ8Yq0UeOq3m1mQ9v0xq3C1yF2W2zj2G4x7pP9y",
+				},
+				Tags: []string{
+					"constellation-node-group-" + nodeGroup,
+					"constellation-role-" + role,
+					"constellation-uid-" + uid,
+					"team-a",
+				},
+			}
+		}
+	}
+	addGroup("6f4c1f7e-2d0b-4f57-9a1e-0b0c5d3e2a41", "constell-b1c0e2a9-control-plane-9e1f3c2d", "b1c0e2a9", "control-plane", "control_plane_default",
+		"0c1c5fd5-5e1c-4c4f-8c47-7a2f1b0c2a21", "5a9d2c77-3b1e-4a0c-9f21-8e7d6c5b4a39", "c2e4f6a8-1b3d-4e5f-8a7b-9c0d1e2f3a4b")
+	addGroup("a8d3e5f1-7c2b-4e9a-b6d4-1f0e2c3b4a5d", "constell-b1c0e2a9-worker-2b7a4e61", "b1c0e2a9", "worker", "worker_default",
+		"e7f8a9b0-c1d2-4e3f-a4b5-c6d7e8f9a0b1", "1d2e3f4a-5b6c-4d7e-8f9a-0b1c2d3e4f5a")
+	addGroup("3b9f0e2d-6a4c-4b8e-9d1f-2c5a7e8b0d3f", "constell-77aa01ff-worker-0c9d8e7f", "77aa01ff", "worker", "worker_default",
+		"9f8e7d6c-5b4a-4392-8170-6f5e4d3c2b1a")
+	// A member of the worker group that is still being built.
+	f.servers["1d2e3f4a-5b6c-4d7e-8f9a-0b1c2d3e4f5a"].Status = "BUILD"
+	// A server group that wasn't created by Constellation.
+	f.serverGroups["d4c3b2a1-0f9e-4d8c-b7a6-5e4d3c2b1a09"] = &fakeServerGroup{ID: "d4c3b2a1-0f9e-4d8c-b7a6-5e4d3c2b1a09", Name: "database", Members: []string{"8a7b6c5d-4e3f-4a1b-9c8d-7e6f5a4b3c2d"}}
+	f.servers["8a7b6c5d-4e3f-4a1b-9c8d-7e6f5a4b3c2d"] = &fakeServer{ID: "8a7b6c5d-4e3f-4a1b-9c8d-7e6f5a4b3c2d", Name: "database-0", Status: "ACTIVE", Created: created}
+	return f
+}
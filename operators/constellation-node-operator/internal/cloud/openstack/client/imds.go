@@ -0,0 +1,35 @@
+/*
+Copyright (c) Edgeless Systems GmbH
+
+SPDX-License-Identifier: BUSL-1.1
+*/
+
+package client
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"net/http"
+)
+
+// getUserData retrieves the raw user data from the OpenStack metadata service.
+func getUserData(ctx context.Context, client httpClient) ([]byte, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, imdsUserDataURL, http.NoBody)
+	if err != nil {
+		return nil, err
+	}
+	resp, err := client.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("querying the OpenStack metadata service: %w", err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("querying the OpenStack metadata service: unexpected status code %d", resp.StatusCode)
+	}
+	return io.ReadAll(resp.Body)
+}
+
+type httpClient interface {
+	Do(req *http.Request) (*http.Response, error)
+}
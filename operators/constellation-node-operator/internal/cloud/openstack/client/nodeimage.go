@@ -0,0 +1,277 @@
+/*
+Copyright (c) Edgeless Systems GmbH
+
+SPDX-License-Identifier: BUSL-1.1
+*/
+
+package client
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"slices"
+	"sort"
+
+	"github.com/gophercloud/gophercloud/v2"
+	"github.com/gophercloud/gophercloud/v2/openstack/blockstorage/v3/volumes"
+	"github.com/gophercloud/gophercloud/v2/openstack/compute/v2/attachinterfaces"
+	"github.com/gophercloud/gophercloud/v2/openstack/compute/v2/servergroups"
+	"github.com/gophercloud/gophercloud/v2/openstack/compute/v2/servers"
+	"github.com/gophercloud/gophercloud/v2/openstack/networking/v2/ports"
+)
+
+// GetNodeImage returns the image ID of the node.
+func (c *Client) GetNodeImage(ctx context.Context, providerID string) (string, error) {
+	serverID, err := serverIDFromProviderID(providerID)
+	if err != nil {
+		return "", err
+	}
+	server, err := servers.Get(ctx, c.compute, serverID).Extract()
+	if err != nil {
+		return "", fmt.Errorf("getting server %q: %w", serverID, err)
+	}
+	return c.serverImage(ctx, server)
+}
+
+// GetScalingGroupID returns the ID of the server group the node is a member of.
+func (c *Client) GetScalingGroupID(ctx context.Context, providerID string) (string, error) {
+	serverID, err := serverIDFromProviderID(providerID)
+	if err != nil {
+		return "", err
+	}
+	groups, err := c.listServerGroups(ctx)
+	if err != nil {
+		return "", err
+	}
+	for _, group := range groups {
+		if slices.Contains(group.Members, serverID) {
+			return group.ID, nil
+		}
+	}
+	return "", fmt.Errorf("server %q is not a member of any server group", serverID)
+}
+
+// CreateNode creates a node in the specified server group.
+// The newest member of the server group is used as a template for the new server.
+func (c *Client) CreateNode(ctx context.Context, scalingGroupID string) (nodeName, providerID string, err error) {
+	group, err := servergroups.Get(ctx, c.compute, scalingGroupID).Extract()
+	if err != nil {
+		return "", "", fmt.Errorf("getting server group %q: %w", scalingGroupID, err)
+	}
+	template, err := c.newestMember(ctx, group)
+	if err != nil {
+		return "", "", err
+	}
+	flavorID, ok := template.Flavor["id"].(string)
+	if !ok || flavorID == "" {
+		return "", "", fmt.Errorf("template server %q has no flavor", template.ID)
+	}
+	image, err := c.scalingGroupImage(ctx, template)
+	if err != nil {
+		return "", "", err
+	}
+	imageRef, blockDevices, err := c.blockDevicesFromTemplate(ctx, template, image)
+	if err != nil {
+		return "", "", err
+	}
+
+	name := generateServerName(group.Name, c.prng)
+	portIDs, err := c.createPortsFromTemplate(ctx, template.ID, name)
+	if err != nil {
+		return "", "", err
+	}
+	networks := make([]servers.Network, 0, len(portIDs))
+	for _, portID := range portIDs {
+		networks = append(networks, servers.Network{Port: portID})
+	}
+	var tags []string
+	if template.Tags != nil {
+		tags = *template.Tags
+	}
+
+	// tags and volume types can only be set with a later microversion
+	createClient := *c.compute
+	createClient.Microversion = createMicroversion
+	server, err := servers.Create(ctx, &createClient, servers.CreateOpts{
+		Name:             name,
+		ImageRef:         imageRef,
+		FlavorRef:        flavorID,
+		UserData:         c.userData,
+		AvailabilityZone: template.AvailabilityZone,
+		Networks:         networks,
+		Metadata:         template.Metadata,
+		Tags:             tags,
+		BlockDevice:      blockDevices,
+	}, servers.SchedulerHintOpts{Group: group.ID}).Extract()
+	if err != nil {
+		return "", "", errors.Join(fmt.Errorf("creating server: %w", err), c.deletePorts(ctx, portIDs))
+	}
+	return name, providerIDFromServerID(server.ID), nil
+}
+
+// DeleteNode deletes a node and its network ports.
+func (c *Client) DeleteNode(ctx context.Context, providerID string) error {
+	serverID, err := serverIDFromProviderID(providerID)
+	if err != nil {
+		return err
+	}
+	interfaces, err := c.listInterfaces(ctx, serverID)
+	if gophercloud.ResponseCodeIs(err, http.StatusNotFound) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	if err := servers.Delete(ctx, c.compute, serverID).ExtractErr(); err != nil && !gophercloud.ResponseCodeIs(err, http.StatusNotFound) {
+		return fmt.Errorf("deleting server %q: %w", serverID, err)
+	}
+	portIDs := make([]string, 0, len(interfaces))
+	for _, iface := range interfaces {
+		portIDs = append(portIDs, iface.PortID)
+	}
+	return c.deletePorts(ctx, portIDs)
+}
+
+// serverImage returns the image a server was booted from.
+// Servers booting from a volume have no image, so the image is taken from the metadata of the boot volume.
+func (c *Client) serverImage(ctx context.Context, server *servers.Server) (string, error) {
+	if imageID, ok := server.Image["id"].(string); ok && imageID != "" {
+		return imageID, nil
+	}
+	for _, attachedVolume := range server.AttachedVolumes {
+		volume, err := volumes.Get(ctx, c.volume, attachedVolume.ID).Extract()
+		if err != nil {
+			return "", fmt.Errorf("getting volume %q: %w", attachedVolume.ID, err)
+		}
+		if imageID := volume.VolumeImageMetadata["image_id"]; imageID != "" {
+			return imageID, nil
+		}
+	}
+	return "", fmt.Errorf("server %q has no image", server.ID)
+}
+
+// blockDevicesFromTemplate returns the block devices for a new server booting the given image,
+// based on the volumes of the template server.
+// If the template server does not boot from a volume, the image reference for the new server is returned as well.
+func (c *Client) blockDevicesFromTemplate(ctx context.Context, template *servers.Server, image string) (string, []servers.BlockDevice, error) {
+	type attachedVolume struct {
+		device string
+		volume *volumes.Volume
+	}
+	attachedVolumes := make([]attachedVolume, 0, len(template.AttachedVolumes))
+	for _, templateVolume := range template.AttachedVolumes {
+		volume, err := volumes.Get(ctx, c.volume, templateVolume.ID).Extract()
+		if err != nil {
+			return "", nil, fmt.Errorf("getting volume %q: %w", templateVolume.ID, err)
+		}
+		var device string
+		for _, attachment := range volume.Attachments {
+			if attachment.ServerID == template.ID {
+				device = attachment.Device
+			}
+		}
+		attachedVolumes = append(attachedVolumes, attachedVolume{device: device, volume: volume})
+	}
+	sort.Slice(attachedVolumes, func(i, j int) bool {
+		return attachedVolumes[i].device < attachedVolumes[j].device
+	})
+
+	var bootDevice *servers.BlockDevice
+	var blankDevices []servers.BlockDevice
+	for _, attached := range attachedVolumes {
+		if attached.volume.VolumeImageMetadata["image_id"] != "" && bootDevice == nil {
+			bootDevice = &servers.BlockDevice{
+				SourceType:          servers.SourceImage,
+				UUID:                image,
+				DestinationType:     servers.DestinationVolume,
+				VolumeSize:          attached.volume.Size,
+				VolumeType:          attached.volume.VolumeType,
+				BootIndex:           0,
+				DeleteOnTermination: true,
+			}
+			continue
+		}
+		blankDevices = append(blankDevices, servers.BlockDevice{
+			SourceType:          servers.SourceBlank,
+			DestinationType:     servers.DestinationVolume,
+			VolumeSize:          attached.volume.Size,
+			VolumeType:          attached.volume.VolumeType,
+			DeleteOnTermination: true,
+		})
+	}
+
+	if bootDevice == nil {
+		// the image is booted from the local disk, so additional volumes are not bootable
+		for i := range blankDevices {
+			blankDevices[i].BootIndex = -1
+		}
+		return image, blankDevices, nil
+	}
+	blockDevices := []servers.BlockDevice{*bootDevice}
+	for i, blankDevice := range blankDevices {
+		blankDevice.BootIndex = i + 1
+		blockDevices = append(blockDevices, blankDevice)
+	}
+	return "", blockDevices, nil
+}
+
+// createPortsFromTemplate creates a port for every network port of the template server.
+// The ports are created in the same subnets and security groups as the ports of the template server.
+func (c *Client) createPortsFromTemplate(ctx context.Context, templateID, name string) ([]string, error) {
+	interfaces, err := c.listInterfaces(ctx, templateID)
+	if err != nil {
+		return nil, err
+	}
+	var portIDs []string
+	for _, iface := range interfaces {
+		templatePort, err := ports.Get(ctx, c.network, iface.PortID).Extract()
+		if err != nil {
+			return nil, errors.Join(fmt.Errorf("getting port %q: %w", iface.PortID, err), c.deletePorts(ctx, portIDs))
+		}
+		fixedIPs := make([]ports.IP, 0, len(templatePort.FixedIPs))
+		for _, fixedIP := range templatePort.FixedIPs {
+			fixedIPs = append(fixedIPs, ports.IP{SubnetID: fixedIP.SubnetID})
+		}
+		securityGroups := templatePort.SecurityGroups
+		port, err := ports.Create(ctx, c.network, ports.CreateOpts{
+			Name:           name,
+			NetworkID:      templatePort.NetworkID,
+			FixedIPs:       fixedIPs,
+			SecurityGroups: &securityGroups,
+		}).Extract()
+		if err != nil {
+			return nil, errors.Join(fmt.Errorf("creating port: %w", err), c.deletePorts(ctx, portIDs))
+		}
+		portIDs = append(portIDs, port.ID)
+	}
+	if len(portIDs) == 0 {
+		return nil, fmt.Errorf("template server %q has no network ports", templateID)
+	}
+	return portIDs, nil
+}
+
+// deletePorts deletes the given ports. Ports that do not exist are ignored.
+func (c *Client) deletePorts(ctx context.Context, portIDs []string) error {
+	var errs []error
+	for _, portID := range portIDs {
+		if err := ports.Delete(ctx, c.network, portID).ExtractErr(); err != nil && !gophercloud.ResponseCodeIs(err, http.StatusNotFound) {
+			errs = append(errs, fmt.Errorf("deleting port %q: %w", portID, err))
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// listInterfaces lists the network interfaces of a server.
+func (c *Client) listInterfaces(ctx context.Context, serverID string) ([]attachinterfaces.Interface, error) {
+	pages, err := attachinterfaces.List(c.compute, serverID).AllPages(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("listing interfaces of server %q: %w", serverID, err)
+	}
+	interfaces, err := attachinterfaces.ExtractInterfaces(pages)
+	if err != nil {
+		return nil, fmt.Errorf("extracting interfaces of server %q: %w", serverID, err)
+	}
+	return interfaces, nil
+}
@@ -0,0 +1,339 @@
+/*
+Copyright (c) Edgeless Systems GmbH
+
+SPDX-License-Identifier: BUSL-1.1
+*/
+
+package client
+
+import (
+	"context"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestGetNodeImage(t *testing.T) {
+	testCases := map[string]struct {
+		providerID string
+		modify     func(f *fakeOpenStack)
+		wantImage  string
+		wantErr    bool
+	}{
+		"server booted from volume": {
+			providerID: "openstack:///worker-0",
+			wantImage:  "image-1",
+		},
+		"server booted from image": {
+			providerID: "openstack:///worker-0",
+			modify: func(f *fakeOpenStack) {
+				f.servers["worker-0"].Image = "image-2"
+			},
+			wantImage: "image-2",
+		},
+		"server without image": {
+			providerID: "openstack:///worker-0",
+			modify: func(f *fakeOpenStack) {
+				f.volumes["boot-volume-0"].ImageID = ""
+			},
+			wantErr: true,
+		},
+		"server does not exist": {
+			providerID: "openstack:///worker-1",
+			wantErr:    true,
+		},
+		"invalid provider ID": {
+			providerID: "invalid",
+			wantErr:    true,
+		},
+	}
+
+	for name, tc := range testCases {
+		t.Run(name, func(t *testing.T) {
+			assert := assert.New(t)
+			require := require.New(t)
+
+			fake := newFakeCluster()
+			if tc.modify != nil {
+				tc.modify(fake)
+			}
+			client := fake.newClient(t)
+
+			gotImage, err := client.GetNodeImage(context.Background(), tc.providerID)
+			if tc.wantErr {
+				assert.Error(err)
+				return
+			}
+			require.NoError(err)
+			assert.Equal(tc.wantImage, gotImage)
+		})
+	}
+}
+
+func TestGetScalingGroupID(t *testing.T) {
+	testCases := map[string]struct {
+		providerID string
+		wantID     string
+		wantErr    bool
+	}{
+		"server is member of a group": {
+			providerID: "openstack:///worker-0",
+			wantID:     workerGroupID,
+		},
+		"server is not member of a group": {
+			providerID: "openstack:///worker-1",
+			wantErr:    true,
+		},
+		"invalid provider ID": {
+			providerID: "invalid",
+			wantErr:    true,
+		},
+	}
+
+	for name, tc := range testCases {
+		t.Run(name, func(t *testing.T) {
+			assert := assert.New(t)
+			require := require.New(t)
+
+			fake := newFakeCluster()
+			fake.serverGroups["group-2"] = &fakeServerGroup{ID: "group-2", Name: "empty"}
+			client := fake.newClient(t)
+
+			gotID, err := client.GetScalingGroupID(context.Background(), tc.providerID)
+			if tc.wantErr {
+				assert.Error(err)
+				return
+			}
+			require.NoError(err)
+			assert.Equal(tc.wantID, gotID)
+		})
+	}
+}
+
+func TestGetScalingGroupIDTerraformCluster(t *testing.T) {
+	testCases := map[string]struct {
+		providerID string
+		wantID     string
+		wantErr    bool
+	}{
+		"control plane node": {
+			providerID: "openstack:///5a9d2c77-3b1e-4a0c-9f21-8e7d6c5b4a39",
+			wantID:     "6f4c1f7e-2d0b-4f57-9a1e-0b0c5d3e2a41",
+		},
+		"control plane node with region": {
+			providerID: "openstack://RegionOne/c2e4f6a8-1b3d-4e5f-8a7b-9c0d1e2f3a4b",
+			wantID:     "6f4c1f7e-2d0b-4f57-9a1e-0b0c5d3e2a41",
+		},
+		"worker node": {
+			providerID: "openstack:///e7f8a9b0-c1d2-4e3f-a4b5-c6d7e8f9a0b1",
+			wantID:     "a8d3e5f1-7c2b-4e9a-b6d4-1f0e2c3b4a5d",
+		},
+		"worker node that is still being built": {
+			providerID: "openstack:///1d2e3f4a-5b6c-4d7e-8f9a-0b1c2d3e4f5a",
+			wantID:     "a8d3e5f1-7c2b-4e9a-b6d4-1f0e2c3b4a5d",
+		},
+		"server without group": {
+			providerID: "openstack:///4e5f6a7b-8c9d-4e0f-a1b2-c3d4e5f6a7b8",
+			wantErr:    true,
+		},
+	}
+
+	for name, tc := range testCases {
+		t.Run(name, func(t *testing.T) {
+			assert := assert.New(t)
+			require := require.New(t)
+
+			client := newTerraformCluster().newClient(t)
+
+			gotID, err := client.GetScalingGroupID(context.Background(), tc.providerID)
+			if tc.wantErr {
+				assert.Error(err)
+				return
+			}
+			require.NoError(err)
+			assert.Equal(tc.wantID, gotID)
+		})
+	}
+}
+
+func TestCreateNode(t *testing.T) {
+	testCases := map[string]struct {
+		scalingGroupID   string
+		modify           func(f *fakeOpenStack)
+		wantImageRef     string
+		wantBlockDevices []fakeCreateBlockDevice
+		wantErr          bool
+	}{
+		"creating node from volume booted template": {
+			scalingGroupID: workerGroupID,
+			wantBlockDevices: []fakeCreateBlockDevice{
+				{SourceType: "image", DestinationType: "volume", UUID: "image-1", VolumeSize: 5, VolumeType: "ssd", BootIndex: 0, DeleteOnTermination: true},
+				{SourceType: "blank", DestinationType: "volume", VolumeSize: 30, VolumeType: "ssd", BootIndex: 1, DeleteOnTermination: true},
+			},
+		},
+		"creating node uses scaling group image": {
+			scalingGroupID: workerGroupID,
+			modify: func(f *fakeOpenStack) {
+				f.servers["worker-0"].Metadata[scalingGroupImageMetadataKey] = "image-2"
+			},
+			wantBlockDevices: []fakeCreateBlockDevice{
+				{SourceType: "image", DestinationType: "volume", UUID: "image-2", VolumeSize: 5, VolumeType: "ssd", BootIndex: 0, DeleteOnTermination: true},
+				{SourceType: "blank", DestinationType: "volume", VolumeSize: 30, VolumeType: "ssd", BootIndex: 1, DeleteOnTermination: true},
+			},
+		},
+		"creating node from image booted template": {
+			scalingGroupID: workerGroupID,
+			modify: func(f *fakeOpenStack) {
+				f.servers["worker-0"].Image = "image-1"
+				f.servers["worker-0"].Volumes = []string{"state-volume-0"}
+			},
+			wantImageRef: "image-1",
+			wantBlockDevices: []fakeCreateBlockDevice{
+				{SourceType: "blank", DestinationType: "volume", VolumeSize: 30, VolumeType: "ssd", BootIndex: -1, DeleteOnTermination: true},
+			},
+		},
+		"newest active member is used as template": {
+			scalingGroupID: workerGroupID,
+			modify: func(f *fakeOpenStack) {
+				f.servers["worker-1"] = &fakeServer{
+					ID:      "worker-1",
+					Status:  "ACTIVE",
+					Created: f.servers["worker-0"].Created.Add(-1),
+					Flavor:  "old-flavor",
+				}
+				f.servers["worker-2"] = &fakeServer{
+					ID:      "worker-2",
+					Status:  "BUILD",
+					Created: f.servers["worker-0"].Created.Add(1),
+					Flavor:  "building-flavor",
+				}
+				f.serverGroups[workerGroupID].Members = append(f.serverGroups[workerGroupID].Members, "worker-1", "worker-2")
+			},
+			wantBlockDevices: []fakeCreateBlockDevice{
+				{SourceType: "image", DestinationType: "volume", UUID: "image-1", VolumeSize: 5, VolumeType: "ssd", BootIndex: 0, DeleteOnTermination: true},
+				{SourceType: "blank", DestinationType: "volume", VolumeSize: 30, VolumeType: "ssd", BootIndex: 1, DeleteOnTermination: true},
+			},
+		},
+		"server group does not exist": {
+			scalingGroupID: "group-2",
+			wantErr:        true,
+		},
+		"server group has no members": {
+			scalingGroupID: workerGroupID,
+			modify: func(f *fakeOpenStack) {
+				f.serverGroups[workerGroupID].Members = nil
+			},
+			wantErr: true,
+		},
+		"template has no ports": {
+			scalingGroupID: workerGroupID,
+			modify: func(f *fakeOpenStack) {
+				f.servers["worker-0"].Ports = nil
+			},
+			wantErr: true,
+		},
+		"creating server fails": {
+			scalingGroupID: workerGroupID,
+			modify: func(f *fakeOpenStack) {
+				f.failServerCreate = true
+			},
+			wantErr: true,
+		},
+	}
+
+	for name, tc := range testCases {
+		t.Run(name, func(t *testing.T) {
+			assert := assert.New(t)
+			require := require.New(t)
+
+			fake := newFakeCluster()
+			if tc.modify != nil {
+				tc.modify(fake)
+			}
+			client := fake.newClient(t)
+
+			nodeName, providerID, err := client.CreateNode(context.Background(), tc.scalingGroupID)
+			if tc.wantErr {
+				assert.Error(err)
+				// created ports are cleaned up on failure
+				assert.Len(fake.ports, 1)
+				return
+			}
+			require.NoError(err)
+			assert.Equal("constellation-worker-aaaa", nodeName)
+
+			req := fake.createRequest
+			require.NotNil(req)
+			assert.Equal(nodeName, req.Name)
+			assert.Equal("flavor", req.FlavorRef)
+			assert.Equal("zone", req.AvailabilityZone)
+			assert.Equal(tc.wantImageRef, req.ImageRef)
+			assert.Equal(tc.wantBlockDevices, req.BlockDevices)
+			assert.Equal(workerGroupID, req.Group)
+			assert.Equal(createMicroversion, req.Microversion)
+			assert.Equal(string(client.userData), req.UserData)
+			assert.Equal("uid", req.Metadata["constellation-uid"])
+			assert.Equal(fake.servers["worker-0"].Tags, req.Tags)
+
+			require.Len(req.Networks, 1)
+			port := fake.ports[req.Networks[0].Port]
+			require.NotNil(port)
+			assert.Equal(nodeName, port.Name)
+			assert.Equal("network", port.NetworkID)
+			assert.Equal([]string{"nodes-subnet"}, port.SubnetIDs)
+			assert.Equal([]string{"security-group"}, port.SecurityGroups)
+
+			serverID, err := serverIDFromProviderID(providerID)
+			require.NoError(err)
+			assert.Contains(fake.serverGroups[workerGroupID].Members, serverID)
+		})
+	}
+}
+
+func TestDeleteNode(t *testing.T) {
+	testCases := map[string]struct {
+		providerID string
+		modify     func(f *fakeOpenStack)
+		wantErr    bool
+	}{
+		"deleting node works": {
+			providerID: "openstack:///worker-0",
+		},
+		"deleting node is idempotent": {
+			providerID: "openstack:///worker-0",
+			modify: func(f *fakeOpenStack) {
+				delete(f.servers, "worker-0")
+				delete(f.ports, "port-0")
+				f.serverGroups[workerGroupID].Members = nil
+			},
+		},
+		"invalid provider ID": {
+			providerID: "invalid",
+			wantErr:    true,
+		},
+	}
+
+	for name, tc := range testCases {
+		t.Run(name, func(t *testing.T) {
+			assert := assert.New(t)
+			require := require.New(t)
+
+			fake := newFakeCluster()
+			if tc.modify != nil {
+				tc.modify(fake)
+			}
+			client := fake.newClient(t)
+
+			err := client.DeleteNode(context.Background(), tc.providerID)
+			if tc.wantErr {
+				assert.Error(err)
+				return
+			}
+			require.NoError(err)
+			assert.NotContains(fake.servers, "worker-0")
+			assert.Empty(fake.ports)
+			assert.Empty(fake.serverGroups[workerGroupID].Members)
+		})
+	}
+}
@@ -0,0 +1,54 @@
+/*
+Copyright (c) Edgeless Systems GmbH
+
+SPDX-License-Identifier: BUSL-1.1
+*/
+
+package client
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+
+	updatev1alpha1 "github.com/edgelesssys/constellation/v2/operators/constellation-node-operator/api/v1alpha1"
+	"github.com/gophercloud/gophercloud/v2"
+	"github.com/gophercloud/gophercloud/v2/openstack/compute/v2/servers"
+)
+
+// GetNodeState returns the state of the node.
+func (c *Client) GetNodeState(ctx context.Context, providerID string) (updatev1alpha1.CSPNodeState, error) {
+	serverID, err := serverIDFromProviderID(providerID)
+	if err != nil {
+		return updatev1alpha1.NodeStateUnknown, err
+	}
+	server, err := servers.Get(ctx, c.compute, serverID).Extract()
+	if gophercloud.ResponseCodeIs(err, http.StatusNotFound) {
+		return updatev1alpha1.NodeStateTerminated, nil
+	}
+	if err != nil {
+		return updatev1alpha1.NodeStateUnknown, fmt.Errorf("getting server %q: %w", serverID, err)
+	}
+
+	if server.TaskState == "deleting" {
+		return updatev1alpha1.NodeStateTerminating, nil
+	}
+
+	// Translate Nova server status to node state.
+	// https://docs.openstack.org/api-guide/compute/server_concepts.html#server-status
+	switch server.Status {
+	case "BUILD":
+		return updatev1alpha1.NodeStateCreating, nil
+	case "ACTIVE":
+		return updatev1alpha1.NodeStateReady, nil
+	case "SHUTOFF", "SUSPENDED", "PAUSED", "SHELVED", "SHELVED_OFFLOADED":
+		return updatev1alpha1.NodeStateStopped, nil
+	case "DELETED", "SOFT_DELETED":
+		return updatev1alpha1.NodeStateTerminated, nil
+	case "ERROR":
+		return updatev1alpha1.NodeStateFailed, nil
+	default:
+		// transitional states like REBOOT, REBUILD or MIGRATING
+		return updatev1alpha1.NodeStateUnknown, nil
+	}
+}
@@ -0,0 +1,103 @@
+/*
+Copyright (c) Edgeless Systems GmbH
+
+SPDX-License-Identifier: BUSL-1.1
+*/
+
+package client
+
+import (
+	"context"
+	"testing"
+
+	updatev1alpha1 "github.com/edgelesssys/constellation/v2/operators/constellation-node-operator/api/v1alpha1"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestGetNodeState(t *testing.T) {
+	testCases := map[string]struct {
+		providerID string
+		status     string
+		taskState  string
+		failGet    bool
+		wantState  updatev1alpha1.CSPNodeState
+		wantErr    bool
+	}{
+		"building server": {
+			providerID: "openstack:///worker-0",
+			status:     "BUILD",
+			wantState:  updatev1alpha1.NodeStateCreating,
+		},
+		"active server": {
+			providerID: "openstack:///worker-0",
+			status:     "ACTIVE",
+			wantState:  updatev1alpha1.NodeStateReady,
+		},
+		"shut off server": {
+			providerID: "openstack:///worker-0",
+			status:     "SHUTOFF",
+			wantState:  updatev1alpha1.NodeStateStopped,
+		},
+		"shelved server": {
+			providerID: "openstack:///worker-0",
+			status:     "SHELVED_OFFLOADED",
+			wantState:  updatev1alpha1.NodeStateStopped,
+		},
+		"server being deleted": {
+			providerID: "openstack:///worker-0",
+			status:     "ACTIVE",
+			taskState:  "deleting",
+			wantState:  updatev1alpha1.NodeStateTerminating,
+		},
+		"soft deleted server": {
+			providerID: "openstack:///worker-0",
+			status:     "SOFT_DELETED",
+			wantState:  updatev1alpha1.NodeStateTerminated,
+		},
+		"server does not exist": {
+			providerID: "openstack:///worker-1",
+			wantState:  updatev1alpha1.NodeStateTerminated,
+		},
+		"server in error state": {
+			providerID: "openstack:///worker-0",
+			status:     "ERROR",
+			wantState:  updatev1alpha1.NodeStateFailed,
+		},
+		"server rebooting": {
+			providerID: "openstack:///worker-0",
+			status:     "HARD_REBOOT",
+			wantState:  updatev1alpha1.NodeStateUnknown,
+		},
+		"getting server fails": {
+			providerID: "openstack:///worker-0",
+			failGet:    true,
+			wantErr:    true,
+		},
+		"invalid provider ID": {
+			providerID: "invalid",
+			wantErr:    true,
+		},
+	}
+
+	for name, tc := range testCases {
+		t.Run(name, func(t *testing.T) {
+			assert := assert.New(t)
+			require := require.New(t)
+
+			fake := newFakeCluster()
+			fake.servers["worker-0"].Status = tc.status
+			fake.servers["worker-0"].TaskState = tc.taskState
+			fake.failServerGet = tc.failGet
+			client := fake.newClient(t)
+
+			gotState, err := client.GetNodeState(context.Background(), tc.providerID)
+			if tc.wantErr {
+				assert.Error(err)
+				return
+			}
+			require.NoError(err)
+			assert.Equal(tc.wantState, gotState)
+		})
+	}
+}
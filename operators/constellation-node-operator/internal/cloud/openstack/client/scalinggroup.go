@@ -0,0 +1,188 @@
+/*
+Copyright (c) Edgeless Systems GmbH
+
+SPDX-License-Identifier: BUSL-1.1
+*/
+
+package client
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+
+	"github.com/edgelesssys/constellation/v2/internal/constants"
+	updatev1alpha1 "github.com/edgelesssys/constellation/v2/operators/constellation-node-operator/api/v1alpha1"
+	cspapi "github.com/edgelesssys/constellation/v2/operators/constellation-node-operator/internal/cloud/api"
+	"github.com/gophercloud/gophercloud/v2"
+	"github.com/gophercloud/gophercloud/v2/openstack/compute/v2/servergroups"
+	"github.com/gophercloud/gophercloud/v2/openstack/compute/v2/servers"
+)
+
+const (
+	// scalingGroupImageMetadataKey is the server metadata key storing the image of the server group.
+	// Nova server groups have no metadata of their own, so the image is stored on every member.
+	scalingGroupImageMetadataKey = "constellation-scaling-group-image"
+	uidMetadataKey               = "constellation-uid"
+	roleMetadataKey              = "constellation-role"
+	nodeGroupTagPrefix           = "constellation-node-group-"
+)
+
+// GetScalingGroupImage returns the image ID used for new servers of the server group.
+func (c *Client) GetScalingGroupImage(ctx context.Context, scalingGroupID string) (string, error) {
+	group, err := servergroups.Get(ctx, c.compute, scalingGroupID).Extract()
+	if err != nil {
+		return "", fmt.Errorf("getting server group %q: %w", scalingGroupID, err)
+	}
+	member, err := c.newestMember(ctx, group)
+	if err != nil {
+		return "", err
+	}
+	return c.scalingGroupImage(ctx, member)
+}
+
+// SetScalingGroupImage sets the image ID used for new servers of the server group.
+func (c *Client) SetScalingGroupImage(ctx context.Context, scalingGroupID, imageURI string) error {
+	group, err := servergroups.Get(ctx, c.compute, scalingGroupID).Extract()
+	if err != nil {
+		return fmt.Errorf("getting server group %q: %w", scalingGroupID, err)
+	}
+	if len(group.Members) == 0 {
+		return fmt.Errorf("server group %q has no members to store the image", scalingGroupID)
+	}
+	for _, member := range group.Members {
+		_, err := servers.CreateMetadatum(ctx, c.compute, member, servers.MetadatumOpts{scalingGroupImageMetadataKey: imageURI}).Extract()
+		if gophercloud.ResponseCodeIs(err, http.StatusNotFound) {
+			// member was deleted in the meantime
+			continue
+		}
+		if err != nil {
+			return fmt.Errorf("setting image of server %q: %w", member, err)
+		}
+	}
+	return nil
+}
+
+// GetScalingGroupName retrieves the name of a scaling group.
+// Server group IDs are UUIDs, which are valid Kubernetes names once lower cased.
+func (c *Client) GetScalingGroupName(scalingGroupID string) (string, error) {
+	return strings.ToLower(scalingGroupID), nil
+}
+
+// GetAutoscalingGroupName retrieves the name of a scaling group as needed by the cluster-autoscaler.
+func (c *Client) GetAutoscalingGroupName(scalingGroupID string) (string, error) {
+	return scalingGroupID, nil
+}
+
+// ListScalingGroups retrieves a list of server groups for the cluster.
+// Server groups are assigned to the cluster, a role and a node group by the metadata and tags of their members.
+// Server groups without members are skipped.
+func (c *Client) ListScalingGroups(ctx context.Context, uid string) ([]cspapi.ScalingGroup, error) {
+	groups, err := c.listServerGroups(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	results := []cspapi.ScalingGroup{}
+	for _, group := range groups {
+		if len(group.Members) == 0 {
+			continue
+		}
+		member, err := c.newestMember(ctx, &group)
+		if err != nil {
+			return nil, err
+		}
+		if member.Metadata[uidMetadataKey] != uid {
+			continue
+		}
+
+		role := updatev1alpha1.NodeRoleFromString(member.Metadata[roleMetadataKey])
+		var nodeGroupName string
+		if member.Tags != nil {
+			for _, tag := range *member.Tags {
+				if name, ok := strings.CutPrefix(tag, nodeGroupTagPrefix); ok {
+					nodeGroupName = name
+					break
+				}
+			}
+		}
+		if nodeGroupName == "" {
+			switch role {
+			case updatev1alpha1.ControlPlaneRole:
+				nodeGroupName = constants.ControlPlaneDefault
+			case updatev1alpha1.WorkerRole:
+				nodeGroupName = constants.WorkerDefault
+			}
+		}
+
+		name, err := c.GetScalingGroupName(group.ID)
+		if err != nil {
+			return nil, fmt.Errorf("getting scaling group name: %w", err)
+		}
+		autoscalerGroupName, err := c.GetAutoscalingGroupName(group.ID)
+		if err != nil {
+			return nil, fmt.Errorf("getting autoscaler group name: %w", err)
+		}
+
+		results = append(results, cspapi.ScalingGroup{
+			Name:                 name,
+			NodeGroupName:        nodeGroupName,
+			GroupID:              group.ID,
+			AutoscalingGroupName: autoscalerGroupName,
+			Role:                 role,
+		})
+	}
+	return results, nil
+}
+
+// scalingGroupImage returns the image of the server group a server is a member of.
+// If the image of the server group was never set, the image of the server is used.
+func (c *Client) scalingGroupImage(ctx context.Context, member *servers.Server) (string, error) {
+	if image := member.Metadata[scalingGroupImageMetadataKey]; image != "" {
+		return image, nil
+	}
+	return c.serverImage(ctx, member)
+}
+
+// newestMember returns the most recently created member of a server group.
+// Active members are preferred, since members that are still being built may not have all resources attached.
+func (c *Client) newestMember(ctx context.Context, group *servergroups.ServerGroup) (*servers.Server, error) {
+	var newest, newestActive *servers.Server
+	for _, member := range group.Members {
+		server, err := servers.Get(ctx, c.compute, member).Extract()
+		if gophercloud.ResponseCodeIs(err, http.StatusNotFound) {
+			continue
+		}
+		if err != nil {
+			return nil, fmt.Errorf("getting server %q: %w", member, err)
+		}
+		if newest == nil || server.Created.After(newest.Created) {
+			newest = server
+		}
+		if server.Status == "ACTIVE" && (newestActive == nil || server.Created.After(newestActive.Created)) {
+			newestActive = server
+		}
+	}
+	if newestActive != nil {
+		return newestActive, nil
+	}
+	if newest != nil {
+		return newest, nil
+	}
+	return nil, fmt.Errorf("server group %q has no members", group.ID)
+}
+
+// listServerGroups lists all server groups of the project.
+func (c *Client) listServerGroups(ctx context.Context) ([]servergroups.ServerGroup, error) {
+	pages, err := servergroups.List(c.compute, servergroups.ListOpts{}).AllPages(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("listing server groups: %w", err)
+	}
+	groups, err := servergroups.ExtractServerGroups(pages)
+	if err != nil {
+		return nil, errors.Join(errors.New("extracting server groups"), err)
+	}
+	return groups, nil
+}
@@ -0,0 +1,269 @@
+/*
+Copyright (c) Edgeless Systems GmbH
+
+SPDX-License-Identifier: BUSL-1.1
+*/
+
+package client
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/edgelesssys/constellation/v2/internal/constants"
+	updatev1alpha1 "github.com/edgelesssys/constellation/v2/operators/constellation-node-operator/api/v1alpha1"
+	cspapi "github.com/edgelesssys/constellation/v2/operators/constellation-node-operator/internal/cloud/api"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestGetScalingGroupImage(t *testing.T) {
+	testCases := map[string]struct {
+		scalingGroupID string
+		modify         func(f *fakeOpenStack)
+		wantImage      string
+		wantErr        bool
+	}{
+		"image of member is used if unset": {
+			scalingGroupID: workerGroupID,
+			wantImage:      "image-1",
+		},
+		"scaling group image is used if set": {
+			scalingGroupID: workerGroupID,
+			modify: func(f *fakeOpenStack) {
+				f.servers["worker-0"].Metadata[scalingGroupImageMetadataKey] = "image-2"
+			},
+			wantImage: "image-2",
+		},
+		"deleted members are skipped": {
+			scalingGroupID: workerGroupID,
+			modify: func(f *fakeOpenStack) {
+				f.serverGroups[workerGroupID].Members = append([]string{"worker-1"}, f.serverGroups[workerGroupID].Members...)
+			},
+			wantImage: "image-1",
+		},
+		"server group does not exist": {
+			scalingGroupID: "group-2",
+			wantErr:        true,
+		},
+		"server group has no members": {
+			scalingGroupID: workerGroupID,
+			modify: func(f *fakeOpenStack) {
+				f.serverGroups[workerGroupID].Members = nil
+			},
+			wantErr: true,
+		},
+		"getting member fails": {
+			scalingGroupID: workerGroupID,
+			modify: func(f *fakeOpenStack) {
+				f.failServerGet = true
+			},
+			wantErr: true,
+		},
+	}
+
+	for name, tc := range testCases {
+		t.Run(name, func(t *testing.T) {
+			assert := assert.New(t)
+			require := require.New(t)
+
+			fake := newFakeCluster()
+			if tc.modify != nil {
+				tc.modify(fake)
+			}
+			client := fake.newClient(t)
+
+			gotImage, err := client.GetScalingGroupImage(context.Background(), tc.scalingGroupID)
+			if tc.wantErr {
+				assert.Error(err)
+				return
+			}
+			require.NoError(err)
+			assert.Equal(tc.wantImage, gotImage)
+		})
+	}
+}
+
+func TestSetScalingGroupImage(t *testing.T) {
+	testCases := map[string]struct {
+		scalingGroupID string
+		modify         func(f *fakeOpenStack)
+		wantErr        bool
+	}{
+		"setting image works": {
+			scalingGroupID: workerGroupID,
+		},
+		"image is set on all members": {
+			scalingGroupID: workerGroupID,
+			modify: func(f *fakeOpenStack) {
+				f.servers["worker-1"] = &fakeServer{ID: "worker-1", Status: "ACTIVE"}
+				f.serverGroups[workerGroupID].Members = append(f.serverGroups[workerGroupID].Members, "worker-1", "deleted")
+			},
+		},
+		"server group does not exist": {
+			scalingGroupID: "group-2",
+			wantErr:        true,
+		},
+		"server group has no members": {
+			scalingGroupID: workerGroupID,
+			modify: func(f *fakeOpenStack) {
+				f.serverGroups[workerGroupID].Members = nil
+			},
+			wantErr: true,
+		},
+	}
+
+	for name, tc := range testCases {
+		t.Run(name, func(t *testing.T) {
+			assert := assert.New(t)
+			require := require.New(t)
+
+			fake := newFakeCluster()
+			if tc.modify != nil {
+				tc.modify(fake)
+			}
+			client := fake.newClient(t)
+
+			err := client.SetScalingGroupImage(context.Background(), tc.scalingGroupID, "image-2")
+			if tc.wantErr {
+				assert.Error(err)
+				return
+			}
+			require.NoError(err)
+			for _, server := range fake.servers {
+				assert.Equal("image-2", server.Metadata[scalingGroupImageMetadataKey])
+			}
+			gotImage, err := client.GetScalingGroupImage(context.Background(), tc.scalingGroupID)
+			require.NoError(err)
+			assert.Equal("image-2", gotImage)
+		})
+	}
+}
+
+func TestListScalingGroups(t *testing.T) {
+	testCases := map[string]struct {
+		modify     func(f *fakeOpenStack)
+		wantGroups []cspapi.ScalingGroup
+		wantErr    bool
+	}{
+		"listing scaling groups works": {
+			modify: func(f *fakeOpenStack) {
+				f.servers["control-plane-0"] = &fakeServer{
+					ID:      "control-plane-0",
+					Status:  "ACTIVE",
+					Created: time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC),
+					Metadata: map[string]string{
+						"constellation-uid":  "uid",
+						"constellation-role": "control-plane",
+					},
+					Tags: []string{"constellation-node-group-control_plane_default"},
+				}
+				f.serverGroups["GROUP-0"] = &fakeServerGroup{ID: "GROUP-0", Name: "constellation-control-plane", Members: []string{"control-plane-0"}}
+			},
+			wantGroups: []cspapi.ScalingGroup{
+				{
+					Name:                 "group-0",
+					NodeGroupName:        constants.ControlPlaneDefault,
+					GroupID:              "GROUP-0",
+					AutoscalingGroupName: "GROUP-0",
+					Role:                 updatev1alpha1.ControlPlaneRole,
+				},
+				{
+					Name:                 workerGroupID,
+					NodeGroupName:        "worker_default",
+					GroupID:              workerGroupID,
+					AutoscalingGroupName: workerGroupID,
+					Role:                 updatev1alpha1.WorkerRole,
+				},
+			},
+		},
+		"node group name falls back to role default": {
+			modify: func(f *fakeOpenStack) {
+				f.servers["worker-0"].Tags = nil
+			},
+			wantGroups: []cspapi.ScalingGroup{
+				{
+					Name:                 workerGroupID,
+					NodeGroupName:        constants.WorkerDefault,
+					GroupID:              workerGroupID,
+					AutoscalingGroupName: workerGroupID,
+					Role:                 updatev1alpha1.WorkerRole,
+				},
+			},
+		},
+		"groups of other clusters and empty groups are skipped": {
+			modify: func(f *fakeOpenStack) {
+				f.servers["other-0"] = &fakeServer{
+					ID:       "other-0",
+					Status:   "ACTIVE",
+					Metadata: map[string]string{"constellation-uid": "other", "constellation-role": "worker"},
+				}
+				f.serverGroups["group-2"] = &fakeServerGroup{ID: "group-2", Name: "other", Members: []string{"other-0"}}
+				f.serverGroups["group-3"] = &fakeServerGroup{ID: "group-3", Name: "empty"}
+			},
+			wantGroups: []cspapi.ScalingGroup{
+				{
+					Name:                 workerGroupID,
+					NodeGroupName:        "worker_default",
+					GroupID:              workerGroupID,
+					AutoscalingGroupName: workerGroupID,
+					Role:                 updatev1alpha1.WorkerRole,
+				},
+			},
+		},
+		"getting member fails": {
+			modify: func(f *fakeOpenStack) {
+				f.failServerGet = true
+			},
+			wantErr: true,
+		},
+	}
+
+	for name, tc := range testCases {
+		t.Run(name, func(t *testing.T) {
+			assert := assert.New(t)
+			require := require.New(t)
+
+			fake := newFakeCluster()
+			if tc.modify != nil {
+				tc.modify(fake)
+			}
+			client := fake.newClient(t)
+
+			gotGroups, err := client.ListScalingGroups(context.Background(), "uid")
+			if tc.wantErr {
+				assert.Error(err)
+				return
+			}
+			require.NoError(err)
+			assert.ElementsMatch(tc.wantGroups, gotGroups)
+		})
+	}
+}
+
+func TestListScalingGroupsTerraformCluster(t *testing.T) {
+	assert := assert.New(t)
+	require := require.New(t)
+
+	client := newTerraformCluster().newClient(t)
+
+	gotGroups, err := client.ListScalingGroups(context.Background(), "b1c0e2a9")
+	require.NoError(err)
+	assert.ElementsMatch([]cspapi.ScalingGroup{
+		{
+			Name:                 "6f4c1f7e-2d0b-4f57-9a1e-0b0c5d3e2a41",
+			NodeGroupName:        constants.ControlPlaneDefault,
+			GroupID:              "6f4c1f7e-2d0b-4f57-9a1e-0b0c5d3e2a41",
+			AutoscalingGroupName: "6f4c1f7e-2d0b-4f57-9a1e-0b0c5d3e2a41",
+			Role:                 updatev1alpha1.ControlPlaneRole,
+		},
+		{
+			Name:                 "a8d3e5f1-7c2b-4e9a-b6d4-1f0e2c3b4a5d",
+			NodeGroupName:        constants.WorkerDefault,
+			GroupID:              "a8d3e5f1-7c2b-4e9a-b6d4-1f0e2c3b4a5d",
+			AutoscalingGroupName: "a8d3e5f1-7c2b-4e9a-b6d4-1f0e2c3b4a5d",
+			Role:                 updatev1alpha1.WorkerRole,
+		},
+	}, gotGroups)
+}
@@ -0,0 +1,13 @@
+/*
+Copyright (c) Edgeless Systems GmbH
+
+SPDX-License-Identifier: BUSL-1.1
+*/
+
+package client
+
+// AutoscalingCloudProvider returns the cloud-provider name as used by k8s cluster-autoscaler.
+// The cluster-autoscaler does not support libvirt, so autoscaling is not available on QEMU.
+func (c *Client) AutoscalingCloudProvider() string {
+	return "qemu"
+}
@@ -0,0 +1,120 @@
+/*
+Copyright (c) Edgeless Systems GmbH
+
+SPDX-License-Identifier: BUSL-1.1
+*/
+
+package client
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+)
+
+// metadataAPIEndpoint is the address of the operator API of the QEMU metadata API as seen from the cluster network.
+// The operator API only accepts requests from control-plane instances, where the operator runs.
+const metadataAPIEndpoint = "http://10.42.0.1:8081"
+
+// errNotFound is returned if the metadata API does not know the requested resource.
+var errNotFound = errors.New("not found")
+
+// Client is a client for Constellation on QEMU.
+// The operator has no direct access to libvirt, so scaling groups are managed through the QEMU metadata API,
+// which groups the libvirt domains of the cluster by their name.
+type Client struct {
+	httpClient *http.Client
+	endpoint   string
+}
+
+// New creates a new client for QEMU.
+func New() *Client {
+	return &Client{
+		httpClient: &http.Client{},
+		endpoint:   metadataAPIEndpoint,
+	}
+}
+
+// scalingGroup is a scaling group as returned by the metadata API.
+type scalingGroup struct {
+	ID   string `json:"id"`
+	Role string `json:"role"`
+}
+
+// instance is an instance as returned by the metadata API.
+type instance struct {
+	Name           string `json:"name"`
+	ScalingGroupID string `json:"scalingGroupID"`
+	Image          string `json:"image"`
+	State          string `json:"state"`
+}
+
+// imageRequest is the body of requests to get or set the image of a scaling group.
+type imageRequest struct {
+	Image string `json:"image"`
+}
+
+// do sends a request to the metadata API and decodes the JSON response into out, if out is not nil.
+func (c *Client) do(ctx context.Context, method string, path []string, in, out any) error {
+	body := io.Reader(http.NoBody)
+	if in != nil {
+		raw, err := json.Marshal(in)
+		if err != nil {
+			return fmt.Errorf("marshalling request: %w", err)
+		}
+		body = bytes.NewReader(raw)
+	}
+	escaped := make([]string, 0, len(path))
+	for _, elem := range path {
+		escaped = append(escaped, url.PathEscape(elem))
+	}
+	reqURL := c.endpoint + "/" + strings.Join(escaped, "/")
+	req, err := http.NewRequestWithContext(ctx, method, reqURL, body)
+	if err != nil {
+		return err
+	}
+	if in != nil {
+		req.Header.Set("Content-Type", "application/json")
+	}
+
+	resp, err := c.httpClient.Do(req)
+	if err != nil {
+		return fmt.Errorf("%s %s: %w", method, reqURL, err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode == http.StatusNotFound {
+		return fmt.Errorf("%s %s: %w", method, reqURL, errNotFound)
+	}
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		msg, _ := io.ReadAll(io.LimitReader(resp.Body, 1024))
+		return fmt.Errorf("%s %s: unexpected status code %d: %s", method, reqURL, resp.StatusCode, strings.TrimSpace(string(msg)))
+	}
+	if out == nil {
+		return nil
+	}
+	if err := json.NewDecoder(resp.Body).Decode(out); err != nil {
+		return fmt.Errorf("decoding response of %s %s: %w", method, reqURL, err)
+	}
+	return nil
+}
+
+// hostnameFromProviderID returns the hostname of an instance from a provider ID.
+// The provider ID has the format qemu:///hostname/<hostname>.
+func hostnameFromProviderID(providerID string) (string, error) {
+	hostname, ok := strings.CutPrefix(providerID, "qemu:///hostname/")
+	if !ok || hostname == "" || strings.Contains(hostname, "/") {
+		return "", fmt.Errorf("invalid providerID: %s", providerID)
+	}
+	return hostname, nil
+}
+
+// providerIDFromHostname returns the provider ID of an instance as set by the bootstrapper.
+func providerIDFromHostname(hostname string) string {
+	return "qemu:///hostname/" + hostname
+}
@@ -0,0 +1,169 @@
+/*
+Copyright (c) Edgeless Systems GmbH
+
+SPDX-License-Identifier: BUSL-1.1
+*/
+
+package client
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestHostnameFromProviderID(t *testing.T) {
+	testCases := map[string]struct {
+		providerID string
+		want       string
+		wantErr    bool
+	}{
+		"valid": {
+			providerID: "qemu:///hostname/worker-0",
+			want:       "worker-0",
+		},
+		"wrong provider": {
+			providerID: "openstack:///worker-0",
+			wantErr:    true,
+		},
+		"missing hostname": {
+			providerID: "qemu:///hostname/",
+			wantErr:    true,
+		},
+		"too many parts": {
+			providerID: "qemu:///hostname/worker-0/invalid",
+			wantErr:    true,
+		},
+	}
+
+	for name, tc := range testCases {
+		t.Run(name, func(t *testing.T) {
+			assert := assert.New(t)
+			require := require.New(t)
+
+			got, err := hostnameFromProviderID(tc.providerID)
+			if tc.wantErr {
+				require.Error(err)
+				return
+			}
+			require.NoError(err)
+			assert.Equal(tc.want, got)
+			assert.Equal(tc.providerID, providerIDFromHostname(got))
+		})
+	}
+}
+
+// fakeMetadataAPI is an in-memory fake of the scaling group endpoints of the QEMU metadata API.
+type fakeMetadataAPI struct {
+	mux       sync.Mutex
+	groups    []scalingGroup
+	images    map[string]string
+	instances map[string]*instance
+
+	// failAll lets all requests fail with an internal server error.
+	failAll bool
+}
+
+// newFakeCluster returns a metadata API with a control-plane and a worker scaling group with one instance each.
+func newFakeCluster() *fakeMetadataAPI {
+	return &fakeMetadataAPI{
+		groups: []scalingGroup{
+			{ID: "constell-control-plane-abcd", Role: "ControlPlane"},
+			{ID: "constell-worker-abcd", Role: "Worker"},
+		},
+		images: map[string]string{
+			"constell-control-plane-abcd": "/pool/image",
+			"constell-worker-abcd":        "/pool/image",
+		},
+		instances: map[string]*instance{
+			"control-plane-0": {Name: "control-plane-0", ScalingGroupID: "constell-control-plane-abcd", Image: "/pool/image", State: "running"},
+			"worker-0":        {Name: "worker-0", ScalingGroupID: "constell-worker-abcd", Image: "/pool/image", State: "running"},
+		},
+	}
+}
+
+// newClient starts the fake API and returns a client using it.
+func (f *fakeMetadataAPI) newClient(t *testing.T) *Client {
+	t.Helper()
+	srv := httptest.NewServer(f.handler())
+	t.Cleanup(srv.Close)
+	return &Client{httpClient: srv.Client(), endpoint: srv.URL}
+}
+
+func (f *fakeMetadataAPI) handler() http.Handler {
+	mux := http.NewServeMux()
+	mux.HandleFunc("GET /scalinggroups", func(w http.ResponseWriter, _ *http.Request) {
+		writeJSON(w, http.StatusOK, f.groups)
+	})
+	mux.HandleFunc("GET /scalinggroups/{id}/image", func(w http.ResponseWriter, r *http.Request) {
+		image, ok := f.images[r.PathValue("id")]
+		if !ok {
+			http.Error(w, "not found", http.StatusNotFound)
+			return
+		}
+		writeJSON(w, http.StatusOK, imageRequest{Image: image})
+	})
+	mux.HandleFunc("PUT /scalinggroups/{id}/image", func(w http.ResponseWriter, r *http.Request) {
+		if _, ok := f.images[r.PathValue("id")]; !ok {
+			http.Error(w, "not found", http.StatusNotFound)
+			return
+		}
+		var req imageRequest
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil || req.Image == "" {
+			http.Error(w, "invalid body", http.StatusBadRequest)
+			return
+		}
+		f.images[r.PathValue("id")] = req.Image
+		w.WriteHeader(http.StatusNoContent)
+	})
+	mux.HandleFunc("POST /scalinggroups/{id}/instances", func(w http.ResponseWriter, r *http.Request) {
+		image, ok := f.images[r.PathValue("id")]
+		if !ok {
+			http.Error(w, "not found", http.StatusNotFound)
+			return
+		}
+		name := fmt.Sprintf("worker-%d", len(f.instances))
+		inst := &instance{Name: name, ScalingGroupID: r.PathValue("id"), Image: image, State: "running"}
+		f.instances[name] = inst
+		writeJSON(w, http.StatusCreated, inst)
+	})
+	mux.HandleFunc("GET /instances/{name}", func(w http.ResponseWriter, r *http.Request) {
+		inst, ok := f.instances[r.PathValue("name")]
+		if !ok {
+			http.Error(w, "not found", http.StatusNotFound)
+			return
+		}
+		writeJSON(w, http.StatusOK, inst)
+	})
+	mux.HandleFunc("DELETE /instances/{name}", func(w http.ResponseWriter, r *http.Request) {
+		if _, ok := f.instances[r.PathValue("name")]; !ok {
+			// the real API succeeds as well, but the client must also handle a 404
+			http.Error(w, "not found", http.StatusNotFound)
+			return
+		}
+		delete(f.instances, r.PathValue("name"))
+		w.WriteHeader(http.StatusNoContent)
+	})
+
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		f.mux.Lock()
+		defer f.mux.Unlock()
+		if f.failAll {
+			http.Error(w, "internal error", http.StatusInternalServerError)
+			return
+		}
+		mux.ServeHTTP(w, r)
+	})
+}
+
+func writeJSON(w http.ResponseWriter, code int, v any) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(code)
+	_ = json.NewEncoder(w).Encode(v)
+}
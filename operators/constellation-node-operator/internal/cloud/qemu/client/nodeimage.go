@@ -0,0 +1,66 @@
+/*
+Copyright (c) Edgeless Systems GmbH
+
+SPDX-License-Identifier: BUSL-1.1
+*/
+
+package client
+
+import (
+	"context"
+	"errors"
+	"net/http"
+)
+
+// GetNodeImage returns the image the node was created from.
+// This is either the path of a libvirt storage volume or a URL.
+func (c *Client) GetNodeImage(ctx context.Context, providerID string) (string, error) {
+	inst, err := c.getInstance(ctx, providerID)
+	if err != nil {
+		return "", err
+	}
+	return inst.Image, nil
+}
+
+// GetScalingGroupID returns the ID of the scaling group the node is part of.
+func (c *Client) GetScalingGroupID(ctx context.Context, providerID string) (string, error) {
+	inst, err := c.getInstance(ctx, providerID)
+	if err != nil {
+		return "", err
+	}
+	return inst.ScalingGroupID, nil
+}
+
+// CreateNode creates a node in the specified scaling group.
+// The metadata API clones the newest domain of the scaling group and returns the hostname of the new domain.
+func (c *Client) CreateNode(ctx context.Context, scalingGroupID string) (nodeName, providerID string, err error) {
+	var inst instance
+	if err := c.do(ctx, http.MethodPost, []string{"scalinggroups", scalingGroupID, "instances"}, nil, &inst); err != nil {
+		return "", "", err
+	}
+	return inst.Name, providerIDFromHostname(inst.Name), nil
+}
+
+// DeleteNode deletes a node, including its disks.
+func (c *Client) DeleteNode(ctx context.Context, providerID string) error {
+	hostname, err := hostnameFromProviderID(providerID)
+	if err != nil {
+		return err
+	}
+	if err := c.do(ctx, http.MethodDelete, []string{"instances", hostname}, nil, nil); err != nil && !errors.Is(err, errNotFound) {
+		return err
+	}
+	return nil
+}
+
+func (c *Client) getInstance(ctx context.Context, providerID string) (instance, error) {
+	hostname, err := hostnameFromProviderID(providerID)
+	if err != nil {
+		return instance{}, err
+	}
+	var inst instance
+	if err := c.do(ctx, http.MethodGet, []string{"instances", hostname}, nil, &inst); err != nil {
+		return instance{}, err
+	}
+	return inst, nil
+}
@@ -0,0 +1,222 @@
+/*
+Copyright (c) Edgeless Systems GmbH
+
+SPDX-License-Identifier: BUSL-1.1
+*/
+
+package client
+
+import (
+	"context"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestGetNodeImage(t *testing.T) {
+	testCases := map[string]struct {
+		providerID string
+		modify     func(f *fakeMetadataAPI)
+		wantImage  string
+		wantErr    bool
+	}{
+		"instance created from volume": {
+			providerID: "qemu:///hostname/worker-0",
+			wantImage:  "/pool/image",
+		},
+		"instance created from URL": {
+			providerID: "qemu:///hostname/worker-0",
+			modify: func(f *fakeMetadataAPI) {
+				f.instances["worker-0"].Image = "https://example.com/image.raw"
+			},
+			wantImage: "https://example.com/image.raw",
+		},
+		"instance does not exist": {
+			providerID: "qemu:///hostname/worker-1",
+			wantErr:    true,
+		},
+		"metadata API fails": {
+			providerID: "qemu:///hostname/worker-0",
+			modify: func(f *fakeMetadataAPI) {
+				f.failAll = true
+			},
+			wantErr: true,
+		},
+		"invalid provider ID": {
+			providerID: "invalid",
+			wantErr:    true,
+		},
+	}
+
+	for name, tc := range testCases {
+		t.Run(name, func(t *testing.T) {
+			assert := assert.New(t)
+			require := require.New(t)
+
+			fake := newFakeCluster()
+			if tc.modify != nil {
+				tc.modify(fake)
+			}
+			client := fake.newClient(t)
+
+			gotImage, err := client.GetNodeImage(context.Background(), tc.providerID)
+			if tc.wantErr {
+				assert.Error(err)
+				return
+			}
+			require.NoError(err)
+			assert.Equal(tc.wantImage, gotImage)
+		})
+	}
+}
+
+func TestGetScalingGroupID(t *testing.T) {
+	testCases := map[string]struct {
+		providerID string
+		wantID     string
+		wantErr    bool
+	}{
+		"instance is part of a scaling group": {
+			providerID: "qemu:///hostname/control-plane-0",
+			wantID:     "constell-control-plane-abcd",
+		},
+		"instance does not exist": {
+			providerID: "qemu:///hostname/worker-1",
+			wantErr:    true,
+		},
+		"invalid provider ID": {
+			providerID: "invalid",
+			wantErr:    true,
+		},
+	}
+
+	for name, tc := range testCases {
+		t.Run(name, func(t *testing.T) {
+			assert := assert.New(t)
+			require := require.New(t)
+
+			client := newFakeCluster().newClient(t)
+
+			gotID, err := client.GetScalingGroupID(context.Background(), tc.providerID)
+			if tc.wantErr {
+				assert.Error(err)
+				return
+			}
+			require.NoError(err)
+			assert.Equal(tc.wantID, gotID)
+		})
+	}
+}
+
+func TestCreateNode(t *testing.T) {
+	testCases := map[string]struct {
+		scalingGroupID string
+		modify         func(f *fakeMetadataAPI)
+		wantNodeName   string
+		wantImage      string
+		wantErr        bool
+	}{
+		"creating node works": {
+			scalingGroupID: "constell-worker-abcd",
+			wantNodeName:   "worker-2",
+			wantImage:      "/pool/image",
+		},
+		"creating node uses scaling group image": {
+			scalingGroupID: "constell-worker-abcd",
+			modify: func(f *fakeMetadataAPI) {
+				f.images["constell-worker-abcd"] = "https://example.com/image.raw"
+			},
+			wantNodeName: "worker-2",
+			wantImage:    "https://example.com/image.raw",
+		},
+		"scaling group does not exist": {
+			scalingGroupID: "unknown",
+			wantErr:        true,
+		},
+		"metadata API fails": {
+			scalingGroupID: "constell-worker-abcd",
+			modify: func(f *fakeMetadataAPI) {
+				f.failAll = true
+			},
+			wantErr: true,
+		},
+	}
+
+	for name, tc := range testCases {
+		t.Run(name, func(t *testing.T) {
+			assert := assert.New(t)
+			require := require.New(t)
+
+			fake := newFakeCluster()
+			if tc.modify != nil {
+				tc.modify(fake)
+			}
+			client := fake.newClient(t)
+
+			nodeName, providerID, err := client.CreateNode(context.Background(), tc.scalingGroupID)
+			if tc.wantErr {
+				assert.Error(err)
+				return
+			}
+			require.NoError(err)
+			assert.Equal(tc.wantNodeName, nodeName)
+			assert.Equal("qemu:///hostname/"+tc.wantNodeName, providerID)
+
+			gotImage, err := client.GetNodeImage(context.Background(), providerID)
+			require.NoError(err)
+			assert.Equal(tc.wantImage, gotImage)
+		})
+	}
+}
+
+func TestDeleteNode(t *testing.T) {
+	testCases := map[string]struct {
+		providerID string
+		modify     func(f *fakeMetadataAPI)
+		wantErr    bool
+	}{
+		"deleting node works": {
+			providerID: "qemu:///hostname/worker-0",
+		},
+		"deleting node is idempotent": {
+			providerID: "qemu:///hostname/worker-0",
+			modify: func(f *fakeMetadataAPI) {
+				delete(f.instances, "worker-0")
+			},
+		},
+		"metadata API fails": {
+			providerID: "qemu:///hostname/worker-0",
+			modify: func(f *fakeMetadataAPI) {
+				f.failAll = true
+			},
+			wantErr: true,
+		},
+		"invalid provider ID": {
+			providerID: "invalid",
+			wantErr:    true,
+		},
+	}
+
+	for name, tc := range testCases {
+		t.Run(name, func(t *testing.T) {
+			assert := assert.New(t)
+			require := require.New(t)
+
+			fake := newFakeCluster()
+			if tc.modify != nil {
+				tc.modify(fake)
+			}
+			client := fake.newClient(t)
+
+			err := client.DeleteNode(context.Background(), tc.providerID)
+			if tc.wantErr {
+				assert.Error(err)
+				return
+			}
+			require.NoError(err)
+			assert.NotContains(fake.instances, "worker-0")
+			assert.Contains(fake.instances, "control-plane-0")
+		})
+	}
+}
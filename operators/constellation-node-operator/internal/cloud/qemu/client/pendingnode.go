@@ -0,0 +1,37 @@
+/*
+Copyright (c) Edgeless Systems GmbH
+
+SPDX-License-Identifier: BUSL-1.1
+*/
+
+package client
+
+import (
+	"context"
+	"errors"
+
+	updatev1alpha1 "github.com/edgelesssys/constellation/v2/operators/constellation-node-operator/api/v1alpha1"
+)
+
+// GetNodeState returns the state of the node.
+func (c *Client) GetNodeState(ctx context.Context, providerID string) (updatev1alpha1.CSPNodeState, error) {
+	inst, err := c.getInstance(ctx, providerID)
+	if errors.Is(err, errNotFound) {
+		return updatev1alpha1.NodeStateTerminated, nil
+	}
+	if err != nil {
+		return updatev1alpha1.NodeStateUnknown, err
+	}
+
+	// Translate libvirt domain state as reported by the metadata API to node state.
+	switch inst.State {
+	case "running":
+		return updatev1alpha1.NodeStateReady, nil
+	case "stopped":
+		return updatev1alpha1.NodeStateStopped, nil
+	case "crashed":
+		return updatev1alpha1.NodeStateFailed, nil
+	default:
+		return updatev1alpha1.NodeStateUnknown, nil
+	}
+}
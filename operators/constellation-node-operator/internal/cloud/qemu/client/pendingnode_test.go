@@ -0,0 +1,80 @@
+/*
+Copyright (c) Edgeless Systems GmbH
+
+SPDX-License-Identifier: BUSL-1.1
+*/
+
+package client
+
+import (
+	"context"
+	"testing"
+
+	updatev1alpha1 "github.com/edgelesssys/constellation/v2/operators/constellation-node-operator/api/v1alpha1"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestGetNodeState(t *testing.T) {
+	testCases := map[string]struct {
+		providerID string
+		state      string
+		failAll    bool
+		wantState  updatev1alpha1.CSPNodeState
+		wantErr    bool
+	}{
+		"running instance is ready": {
+			providerID: "qemu:///hostname/worker-0",
+			state:      "running",
+			wantState:  updatev1alpha1.NodeStateReady,
+		},
+		"stopped instance": {
+			providerID: "qemu:///hostname/worker-0",
+			state:      "stopped",
+			wantState:  updatev1alpha1.NodeStateStopped,
+		},
+		"crashed instance has failed": {
+			providerID: "qemu:///hostname/worker-0",
+			state:      "crashed",
+			wantState:  updatev1alpha1.NodeStateFailed,
+		},
+		"unknown state": {
+			providerID: "qemu:///hostname/worker-0",
+			state:      "unknown",
+			wantState:  updatev1alpha1.NodeStateUnknown,
+		},
+		"missing instance is terminated": {
+			providerID: "qemu:///hostname/worker-1",
+			wantState:  updatev1alpha1.NodeStateTerminated,
+		},
+		"metadata API fails": {
+			providerID: "qemu:///hostname/worker-0",
+			failAll:    true,
+			wantErr:    true,
+		},
+		"invalid provider ID": {
+			providerID: "invalid",
+			wantErr:    true,
+		},
+	}
+
+	for name, tc := range testCases {
+		t.Run(name, func(t *testing.T) {
+			assert := assert.New(t)
+			require := require.New(t)
+
+			fake := newFakeCluster()
+			fake.instances["worker-0"].State = tc.state
+			fake.failAll = tc.failAll
+			client := fake.newClient(t)
+
+			state, err := client.GetNodeState(context.Background(), tc.providerID)
+			if tc.wantErr {
+				assert.Error(err)
+				return
+			}
+			require.NoError(err)
+			assert.Equal(tc.wantState, state)
+		})
+	}
+}
@@ -0,0 +1,83 @@
+/*
+Copyright (c) Edgeless Systems GmbH
+
+SPDX-License-Identifier: BUSL-1.1
+*/
+
+package client
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"strings"
+
+	"github.com/edgelesssys/constellation/v2/internal/constants"
+	updatev1alpha1 "github.com/edgelesssys/constellation/v2/operators/constellation-node-operator/api/v1alpha1"
+	cspapi "github.com/edgelesssys/constellation/v2/operators/constellation-node-operator/internal/cloud/api"
+)
+
+// GetScalingGroupImage returns the image used for new nodes of the scaling group.
+func (c *Client) GetScalingGroupImage(ctx context.Context, scalingGroupID string) (string, error) {
+	var resp imageRequest
+	if err := c.do(ctx, http.MethodGet, []string{"scalinggroups", scalingGroupID, "image"}, nil, &resp); err != nil {
+		return "", err
+	}
+	return resp.Image, nil
+}
+
+// SetScalingGroupImage sets the image used for new nodes of the scaling group.
+// The image is either the path of a libvirt storage volume or a URL of a raw image.
+func (c *Client) SetScalingGroupImage(ctx context.Context, scalingGroupID, imageURI string) error {
+	return c.do(ctx, http.MethodPut, []string{"scalinggroups", scalingGroupID, "image"}, imageRequest{Image: imageURI}, nil)
+}
+
+// GetScalingGroupName retrieves the name of a scaling group.
+// Scaling group IDs are libvirt domain name prefixes, which are valid Kubernetes names once lower cased.
+func (c *Client) GetScalingGroupName(scalingGroupID string) (string, error) {
+	return strings.ToLower(scalingGroupID), nil
+}
+
+// GetAutoscalingGroupName retrieves the name of a scaling group as needed by the cluster-autoscaler.
+func (c *Client) GetAutoscalingGroupName(scalingGroupID string) (string, error) {
+	return scalingGroupID, nil
+}
+
+// ListScalingGroups retrieves a list of scaling groups for the cluster.
+// Only one Constellation can run in a libvirt network, so all scaling groups belong to the cluster and the uid is ignored.
+func (c *Client) ListScalingGroups(ctx context.Context, _ string) ([]cspapi.ScalingGroup, error) {
+	var groups []scalingGroup
+	if err := c.do(ctx, http.MethodGet, []string{"scalinggroups"}, nil, &groups); err != nil {
+		return nil, err
+	}
+
+	results := []cspapi.ScalingGroup{}
+	for _, group := range groups {
+		role := updatev1alpha1.NodeRoleFromString(group.Role)
+		var nodeGroupName string
+		switch role {
+		case updatev1alpha1.ControlPlaneRole:
+			nodeGroupName = constants.ControlPlaneDefault
+		case updatev1alpha1.WorkerRole:
+			nodeGroupName = constants.WorkerDefault
+		}
+
+		name, err := c.GetScalingGroupName(group.ID)
+		if err != nil {
+			return nil, fmt.Errorf("getting scaling group name: %w", err)
+		}
+		autoscalerGroupName, err := c.GetAutoscalingGroupName(group.ID)
+		if err != nil {
+			return nil, fmt.Errorf("getting autoscaler group name: %w", err)
+		}
+
+		results = append(results, cspapi.ScalingGroup{
+			Name:                 name,
+			NodeGroupName:        nodeGroupName,
+			GroupID:              group.ID,
+			AutoscalingGroupName: autoscalerGroupName,
+			Role:                 role,
+		})
+	}
+	return results, nil
+}
@@ -0,0 +1,167 @@
+/*
+Copyright (c) Edgeless Systems GmbH
+
+SPDX-License-Identifier: BUSL-1.1
+*/
+
+package client
+
+import (
+	"context"
+	"testing"
+
+	"github.com/edgelesssys/constellation/v2/internal/constants"
+	updatev1alpha1 "github.com/edgelesssys/constellation/v2/operators/constellation-node-operator/api/v1alpha1"
+	cspapi "github.com/edgelesssys/constellation/v2/operators/constellation-node-operator/internal/cloud/api"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestGetScalingGroupImage(t *testing.T) {
+	testCases := map[string]struct {
+		scalingGroupID string
+		wantImage      string
+		wantErr        bool
+	}{
+		"getting image works": {
+			scalingGroupID: "constell-worker-abcd",
+			wantImage:      "/pool/image",
+		},
+		"scaling group does not exist": {
+			scalingGroupID: "unknown",
+			wantErr:        true,
+		},
+	}
+
+	for name, tc := range testCases {
+		t.Run(name, func(t *testing.T) {
+			assert := assert.New(t)
+			require := require.New(t)
+
+			client := newFakeCluster().newClient(t)
+
+			gotImage, err := client.GetScalingGroupImage(context.Background(), tc.scalingGroupID)
+			if tc.wantErr {
+				assert.Error(err)
+				return
+			}
+			require.NoError(err)
+			assert.Equal(tc.wantImage, gotImage)
+		})
+	}
+}
+
+func TestSetScalingGroupImage(t *testing.T) {
+	testCases := map[string]struct {
+		scalingGroupID string
+		imageURI       string
+		wantErr        bool
+	}{
+		"setting image works": {
+			scalingGroupID: "constell-worker-abcd",
+			imageURI:       "https://example.com/image.raw",
+		},
+		"empty image": {
+			scalingGroupID: "constell-worker-abcd",
+			wantErr:        true,
+		},
+		"scaling group does not exist": {
+			scalingGroupID: "unknown",
+			imageURI:       "https://example.com/image.raw",
+			wantErr:        true,
+		},
+	}
+
+	for name, tc := range testCases {
+		t.Run(name, func(t *testing.T) {
+			assert := assert.New(t)
+			require := require.New(t)
+
+			fake := newFakeCluster()
+			client := fake.newClient(t)
+
+			err := client.SetScalingGroupImage(context.Background(), tc.scalingGroupID, tc.imageURI)
+			if tc.wantErr {
+				assert.Error(err)
+				return
+			}
+			require.NoError(err)
+			assert.Equal(tc.imageURI, fake.images[tc.scalingGroupID])
+			assert.Equal("/pool/image", fake.images["constell-control-plane-abcd"])
+		})
+	}
+}
+
+func TestListScalingGroups(t *testing.T) {
+	testCases := map[string]struct {
+		modify     func(f *fakeMetadataAPI)
+		wantGroups []cspapi.ScalingGroup
+		wantErr    bool
+	}{
+		"listing scaling groups works": {
+			wantGroups: []cspapi.ScalingGroup{
+				{
+					Name:                 "constell-control-plane-abcd",
+					NodeGroupName:        constants.ControlPlaneDefault,
+					GroupID:              "constell-control-plane-abcd",
+					AutoscalingGroupName: "constell-control-plane-abcd",
+					Role:                 updatev1alpha1.ControlPlaneRole,
+				},
+				{
+					Name:                 "constell-worker-abcd",
+					NodeGroupName:        constants.WorkerDefault,
+					GroupID:              "constell-worker-abcd",
+					AutoscalingGroupName: "constell-worker-abcd",
+					Role:                 updatev1alpha1.WorkerRole,
+				},
+			},
+		},
+		"names are lower cased": {
+			modify: func(f *fakeMetadataAPI) {
+				f.groups = []scalingGroup{{ID: "Constell-Worker-ABCD", Role: "Worker"}}
+			},
+			wantGroups: []cspapi.ScalingGroup{
+				{
+					Name:                 "constell-worker-abcd",
+					NodeGroupName:        constants.WorkerDefault,
+					GroupID:              "Constell-Worker-ABCD",
+					AutoscalingGroupName: "Constell-Worker-ABCD",
+					Role:                 updatev1alpha1.WorkerRole,
+				},
+			},
+		},
+		"no scaling groups": {
+			modify: func(f *fakeMetadataAPI) {
+				f.groups = nil
+			},
+			wantGroups: []cspapi.ScalingGroup{},
+		},
+		"metadata API fails": {
+			modify: func(f *fakeMetadataAPI) {
+				f.failAll = true
+			},
+			wantErr: true,
+		},
+	}
+
+	for name, tc := range testCases {
+		t.Run(name, func(t *testing.T) {
+			assert := assert.New(t)
+			require := require.New(t)
+
+			fake := newFakeCluster()
+			if tc.modify != nil {
+				tc.modify(fake)
+			}
+			client := fake.newClient(t)
+
+			gotGroups, err := client.ListScalingGroups(context.Background(), "uid")
+			if tc.wantErr {
+				assert.Error(err)
+				return
+			}
+			require.NoError(err)
+			assert.Equal(tc.wantGroups, gotGroups)
+		})
+	}
+}
@@ -31,6 +31,8 @@ import (
 	azureclient "github.com/edgelesssys/constellation/v2/operators/constellation-node-operator/internal/cloud/azure/client"
 	cloudfake "github.com/edgelesssys/constellation/v2/operators/constellation-node-operator/internal/cloud/fake/client"
 	gcpclient "github.com/edgelesssys/constellation/v2/operators/constellation-node-operator/internal/cloud/gcp/client"
+	openstackclient "github.com/edgelesssys/constellation/v2/operators/constellation-node-operator/internal/cloud/openstack/client"
+	qemuclient "github.com/edgelesssys/constellation/v2/operators/constellation-node-operator/internal/cloud/qemu/client"
 	"github.com/edgelesssys/constellation/v2/operators/constellation-node-operator/internal/deploy"
 	"github.com/edgelesssys/constellation/v2/operators/constellation-node-operator/internal/executor"
 	"github.com/edgelesssys/constellation/v2/operators/constellation-node-operator/internal/upgrade"
@@ -112,6 +114,14 @@ func main() {
 			setupLog.Error(clientErr, "unable to create AWS client")
 			os.Exit(1)
 		}
+	case "openstack":
+		cspClient, clientErr = openstackclient.New(context.Background())
+		if clientErr != nil {
+			setupLog.Error(clientErr, "unable to create OpenStack client")
+			os.Exit(1)
+		}
+	case "qemu":
+		cspClient = qemuclient.New()
 	default:
 		setupLog.Info("CSP does not support upgrades", "csp", csp)
 		cspClient = &cloudfake.Client{}
@@ -167,13 +177,19 @@ func main() {
 		os.Exit(1)
 	}
 	// Create Controllers
-	if csp == "azure" || csp == "gcp" || csp == "aws" {
+	if csp == "azure" || csp == "gcp" || csp == "aws" || csp == "openstack" || csp == "qemu" {
 		if err = controllers.NewNodeVersionReconciler(
 			cspClient, etcdClient, upgrade.NewClient(), discoveryClient, mgr.GetClient(), mgr.GetScheme(),
 		).SetupWithManager(mgr); err != nil {
 			setupLog.Error(err, "Unable to create controller", "controller", "NodeVersion")
 			os.Exit(1)
 		}
+		if err = controllers.NewNodeReplacementReconciler(
+			mgr.GetClient(), mgr.GetScheme(),
+		).SetupWithManager(mgr); err != nil {
+			setupLog.Error(err, "Unable to create controller", "controller", "NodeReplacement")
+			os.Exit(1)
+		}
 		if err = (&controllers.AutoscalingStrategyReconciler{
 			Client: mgr.GetClient(),
 			Scheme: mgr.GetScheme(),
@@ -10,15 +10,18 @@ Package main parses command line flags and starts the s3proxy server.
 package main
 
 import (
+	"context"
 	"crypto/tls"
 	"flag"
 	"fmt"
 	"log/slog"
+	"math"
 	"net"
 	"net/http"
 
 	"github.com/edgelesssys/constellation/v2/internal/logger"
 	"github.com/edgelesssys/constellation/v2/s3proxy/internal/router"
+	"github.com/edgelesssys/constellation/v2/s3proxy/internal/s3"
 )
 
 const (
@@ -43,7 +46,14 @@ func main() {
 	logger := logger.NewJSONLogger(logger.VerbosityFromInt(flags.logLevel))
 
 	if flags.forwardMultipartReqs {
-		logger.Warn("configured to forward multipart uploads, this may leak data to AWS")
+		logger.Warn("configured to forward multipart uploads unencrypted, this may leak data to AWS")
+	}
+
+	if flags.rewrapBucket != "" {
+		if err := runRewrap(flags, logger); err != nil {
+			panic(err)
+		}
+		return
 	}
 
 	if err := runServer(flags, logger); err != nil {
@@ -51,10 +61,27 @@ func main() {
 	}
 }
 
+// runRewrap wraps the DEKs of all objects in a bucket with the latest KEK version.
+func runRewrap(flags cmdFlags, log *slog.Logger) error {
+	log.With(slog.String("bucket", flags.rewrapBucket), slog.Uint64("kekVersion", uint64(flags.kekVersion))).Info("rewrapping bucket")
+
+	router, err := router.New(flags.backends, flags.kmsEndpoint, flags.oldestKEKVersion, flags.kekVersion, flags.allowLegacyKEK, flags.forwardMultipartReqs, log)
+	if err != nil {
+		return fmt.Errorf("creating router: %w", err)
+	}
+
+	result, err := router.RewrapBucket(context.Background(), flags.rewrapBucket)
+	log.With(slog.Int("rewrapped", result.Rewrapped), slog.Int("skipped", result.Skipped), slog.Int("failed", result.Failed)).Info("rewrapping finished")
+	if err != nil {
+		return fmt.Errorf("rewrapping bucket %s: %w", flags.rewrapBucket, err)
+	}
+	return nil
+}
+
 func runServer(flags cmdFlags, log *slog.Logger) error {
-	log.With(slog.String("ip", flags.ip), slog.Int("port", defaultPort), slog.String("region", flags.region)).Info("listening")
+	log.With(slog.String("ip", flags.ip), slog.Int("port", defaultPort), slog.String("region", flags.backends.Region), slog.String("endpoint", flags.backends.Endpoint)).Info("listening")
 
-	router, err := router.New(flags.region, flags.kmsEndpoint, flags.forwardMultipartReqs, log)
+	router, err := router.New(flags.backends, flags.kmsEndpoint, flags.oldestKEKVersion, flags.kekVersion, flags.allowLegacyKEK, flags.forwardMultipartReqs, log)
 	if err != nil {
 		return fmt.Errorf("creating router: %w", err)
 	}
@@ -91,9 +118,17 @@ func parseFlags() (cmdFlags, error) {
 	noTLS := flag.Bool("no-tls", false, "disable TLS and listen on port 80, otherwise listen on 443")
 	ip := flag.String("ip", defaultIP, "ip to listen on")
 	region := flag.String("region", defaultRegion, "AWS region in which target bucket is located")
+	endpoint := flag.String("endpoint", "", "URL of an S3-compatible store to use instead of AWS S3, e.g. https://minio.example.com:9000")
+	pathStyle := flag.Bool("path-style", false, "address buckets in the request path instead of the host name")
+	caBundle := flag.String("ca-bundle", "", "path to a PEM file with additional CA certificates to trust when connecting to the S3 store")
+	backendConfig := flag.String("backend-config", "", "path to a YAML file that configures the S3 store and per-bucket overrides; flags are used for fields the file doesn't set")
 	certLocation := flag.String("cert", defaultCertLocation, "location of TLS certificate")
 	kmsEndpoint := flag.String("kms", "key-service.kube-system:9000", "endpoint of the KMS service to get key encryption keys from")
-	forwardMultipartReqs := flag.Bool("allow-multipart", false, "forward multipart requests to the target bucket; beware: this may store unencrypted data on AWS. See the documentation for more information")
+	forwardMultipartReqs := flag.Bool("allow-multipart", false, "forward multipart requests to the target bucket without encrypting them; beware: this stores unencrypted data on AWS. See the documentation for more information")
+	kekVersion := flag.Uint("kek-version", 1, "version of the key encryption key used to encrypt new objects")
+	oldestKEKVersion := flag.Uint("oldest-kek-version", 1, "oldest version of the key encryption key that is still used to decrypt objects")
+	allowLegacyKEK := flag.Bool("allow-legacy-kek", false, "decrypt objects whose DEK was wrapped with the all-zero key by s3proxy versions before KEK rotation; only enable this to rewrap those objects with -rewrap-bucket, as anyone with write access to a bucket can wrap DEKs with that key")
+	rewrapBucket := flag.String("rewrap-bucket", "", "wrap the DEKs of all objects in the given bucket with the key encryption key given by -kek-version, then exit")
 	level := flag.Int("level", defaultLogLevel, "log level")
 
 	flag.Parse()
@@ -103,13 +138,45 @@ func parseFlags() (cmdFlags, error) {
 		return cmdFlags{}, fmt.Errorf("not a valid IPv4 address: %s", *ip)
 	}
 
+	backends := s3.Config{}
+	if *backendConfig != "" {
+		var err error
+		backends, err = s3.LoadConfig(*backendConfig)
+		if err != nil {
+			return cmdFlags{}, err
+		}
+	}
+	if backends.Region == "" {
+		backends.Region = *region
+	}
+	if backends.Endpoint == "" {
+		backends.Endpoint = *endpoint
+	}
+	if backends.UsePathStyle == nil {
+		backends.UsePathStyle = pathStyle
+	}
+	if backends.CABundle == "" {
+		backends.CABundle = *caBundle
+	}
+	if err := backends.Validate(); err != nil {
+		return cmdFlags{}, fmt.Errorf("invalid S3 backend configuration: %w", err)
+	}
+
+	if *oldestKEKVersion < 1 || *oldestKEKVersion > *kekVersion || *kekVersion > math.MaxUint32 {
+		return cmdFlags{}, fmt.Errorf("invalid KEK versions: oldest version %d, latest version %d", *oldestKEKVersion, *kekVersion)
+	}
+
 	return cmdFlags{
 		noTLS:                *noTLS,
 		ip:                   netIP.String(),
-		region:               *region,
+		backends:             backends,
 		certLocation:         *certLocation,
 		kmsEndpoint:          *kmsEndpoint,
 		forwardMultipartReqs: *forwardMultipartReqs,
+		kekVersion:           uint32(*kekVersion),
+		oldestKEKVersion:     uint32(*oldestKEKVersion),
+		allowLegacyKEK:       *allowLegacyKEK,
+		rewrapBucket:         *rewrapBucket,
 		logLevel:             *level,
 	}, nil
 }
@@ -117,9 +184,13 @@ func parseFlags() (cmdFlags, error) {
 type cmdFlags struct {
 	noTLS                bool
 	ip                   string
-	region               string
+	backends             s3.Config
 	certLocation         string
 	kmsEndpoint          string
 	forwardMultipartReqs bool
+	kekVersion           uint32
+	oldestKEKVersion     uint32
+	allowLegacyKEK       bool
+	rewrapBucket         string
 	logLevel             int
 }
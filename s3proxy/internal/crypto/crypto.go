@@ -7,6 +7,10 @@ SPDX-License-Identifier: BUSL-1.1
 /*
 Package crypto provides encryption and decryption functions for the s3proxy.
 It uses AES-256-GCM to encrypt and decrypt data.
+
+New objects are encrypted using the segmented stream format, see NewEncryptingReader.
+Encrypt produces the format used by earlier versions of s3proxy.
+It is kept, together with Decrypt, to read objects written by those versions.
 */
 package crypto
 
@@ -18,11 +22,18 @@ import (
 	"github.com/tink-crypto/tink-go/v2/subtle/random"
 )
 
+// legacyOverhead is the number of bytes Encrypt adds to a plaintext: a 12 byte nonce and a 16 byte authentication tag.
+const legacyOverhead = 12 + 16
+
 // Encrypt generates a random key to encrypt a plaintext using AES-256-GCM.
 // The generated key is encrypted using the supplied key encryption key (KEK).
 // The ciphertext and encrypted data encryption key (DEK) are returned.
 func Encrypt(plaintext []byte, kek [32]byte) (ciphertext []byte, encryptedDEK []byte, err error) {
-	dek := random.GetRandomBytes(32)
+	dek, encryptedDEK, err := GenerateDEK(kek)
+	if err != nil {
+		return nil, nil, err
+	}
+
 	aesgcm, err := aeadsubtle.NewAESGCMSIV(dek)
 	if err != nil {
 		return nil, nil, fmt.Errorf("getting aesgcm: %w", err)
@@ -33,41 +44,82 @@ func Encrypt(plaintext []byte, kek [32]byte) (ciphertext []byte, encryptedDEK []
 		return nil, nil, fmt.Errorf("encrypting plaintext: %w", err)
 	}
 
-	keywrapper, err := kwpsubtle.NewKWP(kek[:])
+	return ciphertext, encryptedDEK, nil
+}
+
+// Decrypt decrypts a ciphertext using AES-256-GCM.
+// The encrypted DEK is decrypted using the supplied KEK.
+func Decrypt(ciphertext, encryptedDEK []byte, kek [32]byte) ([]byte, error) {
+	dek, err := UnwrapDEK(encryptedDEK, kek)
 	if err != nil {
-		return nil, nil, fmt.Errorf("getting kwp: %w", err)
+		return nil, err
 	}
 
-	encryptedDEK, err = keywrapper.Wrap(dek)
+	return DecryptWithDEK(ciphertext, dek)
+}
+
+// DecryptWithDEK decrypts a ciphertext created by Encrypt using the already unwrapped DEK.
+func DecryptWithDEK(ciphertext, dek []byte) ([]byte, error) {
+	aesgcm, err := aeadsubtle.NewAESGCMSIV(dek)
 	if err != nil {
-		return nil, nil, fmt.Errorf("wrapping dek: %w", err)
+		return nil, fmt.Errorf("getting aesgcm: %w", err)
 	}
 
-	return ciphertext, encryptedDEK, nil
+	plaintext, err := aesgcm.Decrypt(ciphertext, []byte(""))
+	if err != nil {
+		return nil, fmt.Errorf("decrypting ciphertext: %w", err)
+	}
+
+	return plaintext, nil
 }
 
-// Decrypt decrypts a ciphertext using AES-256-GCM.
-// The encrypted DEK is decrypted using the supplied KEK.
-func Decrypt(ciphertext, encryptedDEK []byte, kek [32]byte) ([]byte, error) {
+// LegacyPlaintextSize returns the size of the plaintext of a ciphertext created by Encrypt.
+func LegacyPlaintextSize(ciphertextSize int64) (int64, error) {
+	if ciphertextSize < legacyOverhead {
+		return 0, fmt.Errorf("ciphertext of %d bytes is too short", ciphertextSize)
+	}
+	return ciphertextSize - legacyOverhead, nil
+}
+
+// GenerateDEK generates a random data encryption key (DEK).
+// The DEK is returned in plaintext and wrapped with the supplied key encryption key (KEK).
+func GenerateDEK(kek [32]byte) (dek []byte, encryptedDEK []byte, err error) {
+	dek = random.GetRandomBytes(32)
+
+	encryptedDEK, err = WrapDEK(dek, kek)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	return dek, encryptedDEK, nil
+}
+
+// WrapDEK encrypts a DEK using the supplied KEK.
+func WrapDEK(dek []byte, kek [32]byte) ([]byte, error) {
 	keywrapper, err := kwpsubtle.NewKWP(kek[:])
 	if err != nil {
 		return nil, fmt.Errorf("getting kwp: %w", err)
 	}
 
-	dek, err := keywrapper.Unwrap(encryptedDEK)
+	encryptedDEK, err := keywrapper.Wrap(dek)
 	if err != nil {
-		return nil, fmt.Errorf("unwrapping dek: %w", err)
+		return nil, fmt.Errorf("wrapping dek: %w", err)
 	}
 
-	aesgcm, err := aeadsubtle.NewAESGCMSIV(dek)
+	return encryptedDEK, nil
+}
+
+// UnwrapDEK decrypts an encrypted DEK using the supplied KEK.
+func UnwrapDEK(encryptedDEK []byte, kek [32]byte) ([]byte, error) {
+	keywrapper, err := kwpsubtle.NewKWP(kek[:])
 	if err != nil {
-		return nil, fmt.Errorf("getting aesgcm: %w", err)
+		return nil, fmt.Errorf("getting kwp: %w", err)
 	}
 
-	plaintext, err := aesgcm.Decrypt(ciphertext, []byte(""))
+	dek, err := keywrapper.Unwrap(encryptedDEK)
 	if err != nil {
-		return nil, fmt.Errorf("decrypting ciphertext: %w", err)
+		return nil, fmt.Errorf("unwrapping dek: %w", err)
 	}
 
-	return plaintext, nil
+	return dek, nil
 }
@@ -37,6 +37,10 @@ func TestEncryptDecrypt(t *testing.T) {
 
 			assert.NotContains(t, ciphertext, tt.plaintext)
 
+			plaintextSize, err := LegacyPlaintextSize(int64(len(ciphertext)))
+			require.NoError(t, err)
+			assert.EqualValues(t, len(tt.plaintext), plaintextSize)
+
 			// Decrypt the ciphertext using the KEK and encrypted DEK
 			decrypted, err := Decrypt(ciphertext, encryptedDEK, kek)
 			require.NoError(t, err)
@@ -46,3 +50,23 @@ func TestEncryptDecrypt(t *testing.T) {
 		})
 	}
 }
+
+func TestRewrapDEK(t *testing.T) {
+	assert := assert.New(t)
+	require := require.New(t)
+
+	oldKEK, newKEK := [32]byte{0x01}, [32]byte{0x02}
+	ciphertext, encryptedDEK, err := Encrypt([]byte("hello, world"), oldKEK)
+	require.NoError(err)
+
+	dek, err := UnwrapDEK(encryptedDEK, oldKEK)
+	require.NoError(err)
+	rewrappedDEK, err := WrapDEK(dek, newKEK)
+	require.NoError(err)
+
+	_, err = UnwrapDEK(rewrappedDEK, oldKEK)
+	assert.Error(err)
+	plaintext, err := Decrypt(ciphertext, rewrappedDEK, newKEK)
+	require.NoError(err)
+	assert.Equal([]byte("hello, world"), plaintext)
+}
@@ -0,0 +1,254 @@
+/*
+Copyright (c) Edgeless Systems GmbH
+
+SPDX-License-Identifier: BUSL-1.1
+*/
+
+package crypto
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"math"
+
+	"github.com/tink-crypto/tink-go/v2/subtle/random"
+)
+
+const (
+	// layoutVersion is the version of the layout encoding.
+	layoutVersion = 1
+	// maxLayoutRuns limits the number of runs a sealed layout lists, so that it fits into the metadata of an object.
+	maxLayoutRuns = 32
+	// layoutNonceSize is the size of the random nonce a sealed layout starts with.
+	layoutNonceSize = 12
+	// maxFrameNumber is the highest frame number the stream format can encode.
+	maxFrameNumber = math.MaxUint32
+)
+
+// layoutAAD is the additional data used when sealing a layout. It separates sealed layouts from the segments of the stream format.
+var layoutAAD = []byte("constellation-s3proxy-layout")
+
+// Layout describes the frames an object in the stream format consists of.
+//
+// The parts of a multipart upload are encrypted before it is known which of them make up the object.
+// Their frames can't record this, so the layout is sealed with the object's DEK once the upload is completed.
+type Layout struct {
+	// FrameCount is the number of frames in the object.
+	FrameCount int
+	// PlaintextSize is the size of the object's plaintext.
+	PlaintextSize int64
+	// Frames lists the number and plaintext size of each frame. The frame headers are not set.
+	// It is empty if the frames are too irregular to be listed in the sealed layout.
+	Frames []Frame
+}
+
+// NewLayout returns the layout of an object that consists of the given frames.
+func NewLayout(frames []Frame) Layout {
+	layout := Layout{FrameCount: len(frames)}
+	for _, frame := range frames {
+		layout.Frames = append(layout.Frames, Frame{Number: frame.Number, PlaintextSize: frame.PlaintextSize})
+		layout.PlaintextSize += frame.PlaintextSize
+	}
+	return layout
+}
+
+// SingleFrameLayout returns the layout of an object created by a single request.
+// Such objects consist of frame 1 only.
+func SingleFrameLayout(plaintextSize int64) Layout {
+	return NewLayout([]Frame{{Number: 1, PlaintextSize: plaintextSize}})
+}
+
+// CheckFrames checks that the frames of an object match the layout.
+func (l Layout) CheckFrames(frames []Frame) error {
+	var plaintextSize int64
+	for i, frame := range frames {
+		if err := l.checkFrame(i, frame); err != nil {
+			return err
+		}
+		plaintextSize += frame.PlaintextSize
+	}
+	if len(frames) != l.FrameCount {
+		return fmt.Errorf("object holds %d frames, but its layout lists %d", len(frames), l.FrameCount)
+	}
+	if plaintextSize != l.PlaintextSize {
+		return fmt.Errorf("frames of object hold %d bytes, but its layout lists %d", plaintextSize, l.PlaintextSize)
+	}
+	return nil
+}
+
+// checkFrame checks that the frame at the given index matches the layout.
+// If the layout doesn't list its frames, only the index is checked.
+func (l Layout) checkFrame(index int, frame Frame) error {
+	if index >= l.FrameCount {
+		return fmt.Errorf("object holds more than the %d frames listed in its layout", l.FrameCount)
+	}
+	if len(l.Frames) == 0 {
+		return nil
+	}
+	if want := l.Frames[index]; frame.Number != want.Number || frame.PlaintextSize != want.PlaintextSize {
+		return fmt.Errorf("frame %d holding %d bytes doesn't match frame %d holding %d bytes in layout", frame.Number, frame.PlaintextSize, want.Number, want.PlaintextSize)
+	}
+	return nil
+}
+
+// CheckCiphertextSize checks that an object of the given size holds the plaintext size of the layout.
+// If the layout lists its frames, the size has to match exactly. Otherwise, the size of each frame's segments is unknown,
+// so the size has to lie between the sizes of the smallest and largest objects of FrameCount frames holding PlaintextSize bytes.
+func (l Layout) CheckCiphertextSize(ciphertextSize int64) error {
+	if size, ok := l.CiphertextSize(); ok {
+		if size != ciphertextSize {
+			return fmt.Errorf("object holds %d bytes, but its layout lists %d bytes of plaintext in %d bytes", ciphertextSize, l.PlaintextSize, size)
+		}
+		return nil
+	}
+
+	frameCount := int64(l.FrameCount)
+	// Each frame holds at least one segment, and at most one segment more than fit its plaintext into full segments.
+	minSegments := max(frameCount, (l.PlaintextSize+SegmentSize-1)/SegmentSize)
+	maxSegments := frameCount + l.PlaintextSize/SegmentSize
+	minSize := frameCount*FrameHeaderSize + l.PlaintextSize + minSegments*segmentOverhead
+	maxSize := frameCount*FrameHeaderSize + l.PlaintextSize + maxSegments*segmentOverhead
+	if ciphertextSize < minSize || ciphertextSize > maxSize {
+		return fmt.Errorf("object holds %d bytes, but its layout lists %d bytes of plaintext in %d frames", ciphertextSize, l.PlaintextSize, l.FrameCount)
+	}
+	return nil
+}
+
+// CiphertextSize returns the size of the object described by the layout.
+// It returns false if the layout doesn't list its frames.
+func (l Layout) CiphertextSize() (int64, bool) {
+	if len(l.Frames) == 0 {
+		return 0, false
+	}
+	var size int64
+	for _, frame := range l.Frames {
+		size += frame.CiphertextSize()
+	}
+	return size, true
+}
+
+// Seal encodes the layout and encrypts it with the DEK of the object.
+// Objects usually consist of frames of equal size, which are encoded as a single run.
+// If the frames need more than maxLayoutRuns runs, only the frame count and the plaintext size are sealed.
+func (l Layout) Seal(dek []byte) ([]byte, error) {
+	runs := l.runs()
+	if len(runs) > maxLayoutRuns {
+		runs = nil
+	}
+
+	encoded := []byte{layoutVersion}
+	encoded = binary.AppendUvarint(encoded, uint64(l.FrameCount))
+	encoded = binary.AppendUvarint(encoded, uint64(l.PlaintextSize))
+	encoded = binary.AppendUvarint(encoded, uint64(len(runs)))
+	for _, run := range runs {
+		encoded = binary.AppendUvarint(encoded, uint64(run.first))
+		encoded = binary.AppendUvarint(encoded, uint64(run.count))
+		encoded = binary.AppendUvarint(encoded, uint64(run.plaintextSize))
+	}
+
+	aesgcm, err := newGCM(dek)
+	if err != nil {
+		return nil, err
+	}
+	nonce := random.GetRandomBytes(layoutNonceSize)
+	return aesgcm.Seal(nonce, nonce, encoded, layoutAAD), nil
+}
+
+// OpenLayout decrypts and decodes a layout sealed by Layout.Seal.
+func OpenLayout(sealed, dek []byte) (Layout, error) {
+	if len(sealed) < layoutNonceSize {
+		return Layout{}, errors.New("sealed layout is too short")
+	}
+	aesgcm, err := newGCM(dek)
+	if err != nil {
+		return Layout{}, err
+	}
+	encoded, err := aesgcm.Open(nil, sealed[:layoutNonceSize], sealed[layoutNonceSize:], layoutAAD)
+	if err != nil {
+		return Layout{}, fmt.Errorf("decrypting layout: %w", err)
+	}
+
+	if len(encoded) == 0 || encoded[0] != layoutVersion {
+		return Layout{}, errors.New("unsupported layout version")
+	}
+	decoder := uvarintDecoder{data: encoded[1:]}
+	layout := Layout{
+		FrameCount:    int(decoder.next(maxFrameNumber)),
+		PlaintextSize: int64(decoder.next(math.MaxInt64)),
+	}
+	runCount := decoder.next(maxLayoutRuns)
+	var lastNumber uint64
+	for range runCount {
+		first := decoder.next(maxFrameNumber)
+		count := decoder.next(maxFrameNumber)
+		plaintextSize := decoder.next(math.MaxInt64)
+		if decoder.err != nil {
+			break
+		}
+		if first <= lastNumber || count == 0 || first+count-1 > maxFrameNumber {
+			return Layout{}, errors.New("invalid frame numbers in layout")
+		}
+		for number := first; number < first+count; number++ {
+			layout.Frames = append(layout.Frames, Frame{Number: uint32(number), PlaintextSize: int64(plaintextSize)})
+		}
+		lastNumber = first + count - 1
+	}
+	if decoder.err != nil {
+		return Layout{}, fmt.Errorf("decoding layout: %w", decoder.err)
+	}
+	if len(decoder.data) != 0 {
+		return Layout{}, errors.New("decoding layout: trailing data")
+	}
+	if runCount > 0 && (len(layout.Frames) != layout.FrameCount || NewLayout(layout.Frames).PlaintextSize != layout.PlaintextSize) {
+		return Layout{}, errors.New("frames of layout don't match its size")
+	}
+	return layout, nil
+}
+
+// layoutRun is a sequence of consecutively numbered frames of equal size.
+type layoutRun struct {
+	first         uint32
+	count         uint32
+	plaintextSize int64
+}
+
+// runs groups the frames of the layout into runs.
+func (l Layout) runs() []layoutRun {
+	var runs []layoutRun
+	for _, frame := range l.Frames {
+		if len(runs) > 0 {
+			last := &runs[len(runs)-1]
+			if frame.Number == last.first+last.count && frame.PlaintextSize == last.plaintextSize {
+				last.count++
+				continue
+			}
+		}
+		runs = append(runs, layoutRun{first: frame.Number, count: 1, plaintextSize: frame.PlaintextSize})
+	}
+	return runs
+}
+
+// uvarintDecoder decodes a sequence of uvarints, remembering the first error.
+type uvarintDecoder struct {
+	data []byte
+	err  error
+}
+
+// next decodes the next value, which must not be larger than limit.
+func (d *uvarintDecoder) next(limit uint64) uint64 {
+	if d.err != nil {
+		return 0
+	}
+	value, n := binary.Uvarint(d.data)
+	if n <= 0 {
+		d.err = errors.New("malformed value")
+		return 0
+	}
+	if value > limit {
+		d.err = fmt.Errorf("value %d exceeds %d", value, limit)
+		return 0
+	}
+	d.data = d.data[n:]
+	return value
+}
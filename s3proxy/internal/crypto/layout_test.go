@@ -0,0 +1,154 @@
+/*
+Copyright (c) Edgeless Systems GmbH
+
+SPDX-License-Identifier: BUSL-1.1
+*/
+
+package crypto
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestLayout(t *testing.T) {
+	irregular := make([]Frame, maxLayoutRuns+1)
+	for i := range irregular {
+		irregular[i] = Frame{Number: uint32(2*i + 1), PlaintextSize: int64(i)}
+	}
+
+	testCases := map[string]struct {
+		frames         []Frame
+		wantFramesLost bool
+	}{
+		"empty object": {},
+		"single frame": {
+			frames: []Frame{{Number: 1, PlaintextSize: SegmentSize + 1}},
+		},
+		"equal parts with smaller last part": {
+			frames: []Frame{
+				{Number: 1, PlaintextSize: 5 << 20},
+				{Number: 2, PlaintextSize: 5 << 20},
+				{Number: 3, PlaintextSize: 5 << 20},
+				{Number: 4, PlaintextSize: 17},
+			},
+		},
+		"gaps in part numbers": {
+			frames: []Frame{
+				{Number: 2, PlaintextSize: 10},
+				{Number: 5, PlaintextSize: 10},
+				{Number: 10000, PlaintextSize: 0},
+			},
+		},
+		"too many runs": {
+			frames:         irregular,
+			wantFramesLost: true,
+		},
+	}
+
+	for name, tc := range testCases {
+		t.Run(name, func(t *testing.T) {
+			assert := assert.New(t)
+			require := require.New(t)
+
+			dek := newTestDEK(t)
+			layout := NewLayout(tc.frames)
+			sealed, err := layout.Seal(dek)
+			require.NoError(err)
+
+			opened, err := OpenLayout(sealed, dek)
+			require.NoError(err)
+			assert.Equal(len(tc.frames), opened.FrameCount)
+			assert.Equal(layout.PlaintextSize, opened.PlaintextSize)
+			if tc.wantFramesLost {
+				assert.Empty(opened.Frames)
+				return
+			}
+			assert.Equal(layout.Frames, opened.Frames)
+
+			_, err = OpenLayout(sealed, newTestDEK(t))
+			assert.Error(err)
+			sealed[len(sealed)-1] ^= 0x01
+			_, err = OpenLayout(sealed, dek)
+			assert.Error(err)
+		})
+	}
+}
+
+func TestLayoutCheckCiphertextSize(t *testing.T) {
+	irregular := make([]Frame, maxLayoutRuns+1)
+	for i := range irregular {
+		irregular[i] = Frame{Number: uint32(i + 1), PlaintextSize: int64(i) * SegmentSize / 2}
+	}
+	irregularSize := int64(0)
+	for _, frame := range irregular {
+		irregularSize += frame.CiphertextSize()
+	}
+	regular := []Frame{
+		{Number: 1, PlaintextSize: SegmentSize + 1},
+		{Number: 2, PlaintextSize: SegmentSize + 1},
+	}
+	regularSize := 2 * CiphertextSize(SegmentSize+1)
+
+	testCases := map[string]struct {
+		frames         []Frame
+		ciphertextSize int64
+		wantErr        bool
+	}{
+		"listed frames": {
+			frames:         regular,
+			ciphertextSize: regularSize,
+		},
+		"listed frames, object truncated": {
+			frames:         regular,
+			ciphertextSize: regularSize - 1,
+			wantErr:        true,
+		},
+		"listed frames, frame dropped": {
+			frames:         regular,
+			ciphertextSize: CiphertextSize(SegmentSize + 1),
+			wantErr:        true,
+		},
+		"listed frames, object too long": {
+			frames:         regular,
+			ciphertextSize: regularSize + 1,
+			wantErr:        true,
+		},
+		"unlisted frames": {
+			frames:         irregular,
+			ciphertextSize: irregularSize,
+		},
+		"unlisted frames, frame dropped": {
+			frames:         irregular,
+			ciphertextSize: irregularSize - irregular[len(irregular)-1].CiphertextSize(),
+			wantErr:        true,
+		},
+		"unlisted frames, frame added": {
+			frames:         irregular,
+			ciphertextSize: irregularSize + CiphertextSize(SegmentSize),
+			wantErr:        true,
+		},
+	}
+
+	for name, tc := range testCases {
+		t.Run(name, func(t *testing.T) {
+			assert := assert.New(t)
+			require := require.New(t)
+
+			dek := newTestDEK(t)
+			sealed, err := NewLayout(tc.frames).Seal(dek)
+			require.NoError(err)
+			layout, err := OpenLayout(sealed, dek)
+			require.NoError(err)
+
+			err = layout.CheckCiphertextSize(tc.ciphertextSize)
+			if tc.wantErr {
+				assert.Error(err)
+				return
+			}
+			assert.NoError(err)
+		})
+	}
+}
@@ -0,0 +1,363 @@
+/*
+Copyright (c) Edgeless Systems GmbH
+
+SPDX-License-Identifier: BUSL-1.1
+*/
+
+package crypto
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+
+	"github.com/tink-crypto/tink-go/v2/subtle/random"
+)
+
+/*
+The stream format splits a plaintext into segments of SegmentSize bytes that are encrypted
+and authenticated individually using AES-256-GCM. This allows encrypting and decrypting objects
+without holding them in memory.
+
+An encrypted object consists of one or more frames. A PutObject request produces a single frame,
+a multipart upload produces one frame per part. Each frame starts with a header:
+
+	| frame number (4 bytes) | nonce prefix (8 bytes) | plaintext size (8 bytes) |
+
+followed by the encrypted segments. Only the last segment of a frame may be shorter than SegmentSize.
+A frame always holds at least one, possibly empty, segment.
+The nonce of a segment is the random nonce prefix followed by the segment's index within the frame.
+The header is passed as additional data when sealing each segment, which binds segments to their frame,
+and detects truncated or reordered segments.
+Frame numbers have to be strictly increasing within an object.
+
+Frames can't record how many frames follow them, so dropping frames from the end of an object
+isn't detected by authenticating them. Instead, frames are checked against the object's Layout.
+*/
+
+const (
+	// SegmentSize is the size of a plaintext segment in the stream format.
+	SegmentSize = 64 * 1024
+	// segmentOverhead is the size of the authentication tag appended to each segment.
+	segmentOverhead = 16
+	// noncePrefixSize is the size of the random part of a segment's nonce.
+	noncePrefixSize = 8
+	// FrameHeaderSize is the size of the header that precedes each frame.
+	FrameHeaderSize = 4 + noncePrefixSize + 8
+)
+
+// CiphertextSize returns the size of a frame that holds a plaintext of the given size.
+func CiphertextSize(plaintextSize int64) int64 {
+	return FrameHeaderSize + plaintextSize + segmentCount(plaintextSize)*segmentOverhead
+}
+
+// PlaintextSize returns the size of the plaintext held by a single frame of the given size.
+func PlaintextSize(ciphertextSize int64) (int64, error) {
+	payload := ciphertextSize - FrameHeaderSize
+	if payload < segmentOverhead {
+		return 0, fmt.Errorf("ciphertext of %d bytes is too short", ciphertextSize)
+	}
+	segments := (payload + SegmentSize + segmentOverhead - 1) / (SegmentSize + segmentOverhead)
+	return payload - segments*segmentOverhead, nil
+}
+
+// NewEncryptingReader returns a reader that reads plaintextSize bytes from plaintext and returns them as an encrypted frame.
+// The frame number has to be greater than zero. For multipart uploads, it is the part number.
+// Reading fails if plaintext does not hold exactly plaintextSize bytes.
+func NewEncryptingReader(plaintext io.Reader, plaintextSize int64, dek []byte, frameNumber uint32) (io.Reader, error) {
+	if plaintextSize < 0 {
+		return nil, fmt.Errorf("invalid plaintext size %d", plaintextSize)
+	}
+	if frameNumber == 0 {
+		return nil, errors.New("frame number must be greater than zero")
+	}
+
+	aesgcm, err := newGCM(dek)
+	if err != nil {
+		return nil, err
+	}
+
+	header := make([]byte, FrameHeaderSize)
+	binary.BigEndian.PutUint32(header[:4], frameNumber)
+	copy(header[4:4+noncePrefixSize], random.GetRandomBytes(noncePrefixSize))
+	binary.BigEndian.PutUint64(header[4+noncePrefixSize:], uint64(plaintextSize))
+
+	return &encryptingReader{
+		plaintext: plaintext,
+		aead:      aesgcm,
+		header:    header,
+		remaining: plaintextSize,
+		segments:  segmentCount(plaintextSize),
+		buf:       append([]byte{}, header...),
+	}, nil
+}
+
+type encryptingReader struct {
+	plaintext io.Reader
+	aead      cipher.AEAD
+	header    []byte
+	remaining int64
+	segments  int64
+	index     int64
+	// buf holds ciphertext that was not yet returned to the caller.
+	buf []byte
+	err error
+}
+
+func (r *encryptingReader) Read(p []byte) (int, error) {
+	for len(r.buf) == 0 {
+		if r.err != nil {
+			return 0, r.err
+		}
+		r.err = r.sealNext()
+	}
+
+	n := copy(p, r.buf)
+	r.buf = r.buf[n:]
+	return n, nil
+}
+
+// sealNext reads and encrypts the next segment into buf.
+// It returns io.EOF once all segments have been encrypted.
+func (r *encryptingReader) sealNext() error {
+	if r.index == r.segments {
+		// Make sure the plaintext does not hold more data than announced.
+		if n, err := r.plaintext.Read(make([]byte, 1)); n > 0 || (err != nil && err != io.EOF) {
+			if err != nil {
+				return fmt.Errorf("reading plaintext: %w", err)
+			}
+			return errors.New("plaintext is longer than announced")
+		}
+		return io.EOF
+	}
+
+	size := min(r.remaining, SegmentSize)
+	segment := make([]byte, size, size+segmentOverhead)
+	if _, err := io.ReadFull(r.plaintext, segment); err != nil {
+		if errors.Is(err, io.ErrUnexpectedEOF) || errors.Is(err, io.EOF) {
+			return errors.New("plaintext is shorter than announced")
+		}
+		return fmt.Errorf("reading plaintext: %w", err)
+	}
+
+	r.buf = r.aead.Seal(segment[:0], segmentNonce(r.header, r.index), segment, r.header)
+	r.remaining -= size
+	r.index++
+	return nil
+}
+
+// Frame describes a frame of the stream format.
+// The information is taken from the frame's header, which is only authenticated once a segment of the frame is decrypted.
+type Frame struct {
+	// Header is the raw header of the frame.
+	Header []byte
+	// Number is the frame number.
+	Number uint32
+	// PlaintextSize is the size of the plaintext held by the frame.
+	PlaintextSize int64
+}
+
+// ParseFrameHeader parses the header at the start of a frame.
+func ParseFrameHeader(header []byte) (Frame, error) {
+	if len(header) != FrameHeaderSize {
+		return Frame{}, fmt.Errorf("frame header must be %d bytes, got %d", FrameHeaderSize, len(header))
+	}
+
+	frameNumber := binary.BigEndian.Uint32(header[:4])
+	if frameNumber == 0 {
+		return Frame{}, errors.New("invalid frame number 0")
+	}
+	plaintextSize := int64(binary.BigEndian.Uint64(header[4+noncePrefixSize:]))
+	if plaintextSize < 0 {
+		return Frame{}, fmt.Errorf("invalid plaintext size in frame %d", frameNumber)
+	}
+
+	return Frame{Header: append([]byte{}, header...), Number: frameNumber, PlaintextSize: plaintextSize}, nil
+}
+
+// CiphertextSize returns the size of the frame, including its header.
+func (f Frame) CiphertextSize() int64 {
+	return CiphertextSize(f.PlaintextSize)
+}
+
+// CiphertextRange returns the range of the frame's ciphertext that holds the plaintext bytes from start to end (inclusive).
+// The returned offsets are relative to the start of the frame, last is inclusive.
+// segment is the index of the first segment in the range.
+func (f Frame) CiphertextRange(start, end int64) (first, last, segment int64, err error) {
+	if start < 0 || end < start || end >= f.PlaintextSize {
+		return 0, 0, 0, fmt.Errorf("range %d-%d is out of bounds for a frame holding %d bytes", start, end, f.PlaintextSize)
+	}
+
+	segment = start / SegmentSize
+	lastSegment := end / SegmentSize
+	lastSegmentSize := min(f.PlaintextSize-lastSegment*SegmentSize, SegmentSize)
+
+	first = FrameHeaderSize + segment*(SegmentSize+segmentOverhead)
+	last = FrameHeaderSize + lastSegment*(SegmentSize+segmentOverhead) + lastSegmentSize + segmentOverhead - 1
+	return first, last, segment, nil
+}
+
+// NewDecryptingReader returns a reader that decrypts the segments of the frame read from ciphertext.
+// The ciphertext has to start with the segment at the given index, as returned by CiphertextRange.
+// Reading stops at the end of the frame. Only as many segments as are needed to fill the caller's reads are consumed,
+// so ciphertext may end before the end of the frame.
+func (f Frame) NewDecryptingReader(ciphertext io.Reader, segment int64, dek []byte) (io.Reader, error) {
+	segments := segmentCount(f.PlaintextSize)
+	if segment < 0 || segment >= segments {
+		return nil, fmt.Errorf("segment %d is out of bounds for a frame with %d segments", segment, segments)
+	}
+
+	aesgcm, err := newGCM(dek)
+	if err != nil {
+		return nil, err
+	}
+	return &decryptingReader{
+		ciphertext:      ciphertext,
+		aead:            aesgcm,
+		singleFrame:     true,
+		header:          f.Header,
+		lastFrameNumber: f.Number,
+		remaining:       f.PlaintextSize - segment*SegmentSize,
+		segments:        segments,
+		index:           segment,
+	}, nil
+}
+
+// NewDecryptingReader returns a reader that decrypts all frames read from ciphertext.
+// The frames have to match the layout of the object, so that truncated objects are detected.
+// Reading returns an error as soon as a segment fails authentication or a frame doesn't match the layout,
+// so only authentic plaintext is ever returned.
+func NewDecryptingReader(ciphertext io.Reader, dek []byte, layout Layout) (io.Reader, error) {
+	aesgcm, err := newGCM(dek)
+	if err != nil {
+		return nil, err
+	}
+	return &decryptingReader{ciphertext: ciphertext, aead: aesgcm, layout: layout}, nil
+}
+
+type decryptingReader struct {
+	ciphertext io.Reader
+	aead       cipher.AEAD
+	// singleFrame stops reading at the end of the current frame.
+	singleFrame bool
+	// layout is the layout of the object, which all frames are checked against.
+	layout Layout
+	// frameCount is the number of frames read so far.
+	frameCount int
+
+	header          []byte
+	lastFrameNumber uint32
+	remaining       int64
+	segments        int64
+	index           int64
+	// buf holds plaintext that was not yet returned to the caller.
+	buf []byte
+	err error
+}
+
+func (r *decryptingReader) Read(p []byte) (int, error) {
+	for len(r.buf) == 0 {
+		if r.err != nil {
+			return 0, r.err
+		}
+		r.err = r.openNext()
+	}
+
+	n := copy(p, r.buf)
+	r.buf = r.buf[n:]
+	return n, nil
+}
+
+// openNext reads and decrypts the next segment into buf.
+// It returns io.EOF once the ciphertext ends after a complete frame.
+func (r *decryptingReader) openNext() error {
+	if r.index == r.segments {
+		if r.singleFrame {
+			return io.EOF
+		}
+		if err := r.readHeader(); err != nil {
+			return err
+		}
+	}
+
+	size := min(r.remaining, SegmentSize)
+	segment := make([]byte, size+segmentOverhead)
+	if _, err := io.ReadFull(r.ciphertext, segment); err != nil {
+		if errors.Is(err, io.ErrUnexpectedEOF) || errors.Is(err, io.EOF) {
+			return errors.New("ciphertext is truncated")
+		}
+		return fmt.Errorf("reading ciphertext: %w", err)
+	}
+
+	plaintext, err := r.aead.Open(segment[:0], segmentNonce(r.header, r.index), segment, r.header)
+	if err != nil {
+		return fmt.Errorf("decrypting segment %d of frame %d: %w", r.index, r.lastFrameNumber, err)
+	}
+
+	r.buf = plaintext
+	r.remaining -= size
+	r.index++
+	return nil
+}
+
+// readHeader reads the header of the next frame.
+func (r *decryptingReader) readHeader() error {
+	header := make([]byte, FrameHeaderSize)
+	n, err := io.ReadFull(r.ciphertext, header)
+	switch {
+	case n == 0 && errors.Is(err, io.EOF) && r.frameCount == r.layout.FrameCount:
+		return io.EOF
+	case errors.Is(err, io.ErrUnexpectedEOF) || errors.Is(err, io.EOF):
+		return errors.New("ciphertext is truncated")
+	case err != nil:
+		return fmt.Errorf("reading ciphertext: %w", err)
+	}
+
+	frame, err := ParseFrameHeader(header)
+	if err != nil {
+		return err
+	}
+	if frame.Number <= r.lastFrameNumber {
+		return fmt.Errorf("frame %d follows frame %d", frame.Number, r.lastFrameNumber)
+	}
+	if err := r.layout.checkFrame(r.frameCount, frame); err != nil {
+		return err
+	}
+	r.frameCount++
+
+	r.header = frame.Header
+	r.lastFrameNumber = frame.Number
+	r.remaining = frame.PlaintextSize
+	r.segments = segmentCount(frame.PlaintextSize)
+	r.index = 0
+	return nil
+}
+
+// segmentCount returns the number of segments needed for a plaintext of the given size.
+// Empty plaintexts are encrypted as a single empty segment, so that the header is always authenticated.
+func segmentCount(plaintextSize int64) int64 {
+	return max(1, (plaintextSize+SegmentSize-1)/SegmentSize)
+}
+
+// segmentNonce returns the nonce of the segment with the given index in the frame with the given header.
+func segmentNonce(header []byte, index int64) []byte {
+	nonce := make([]byte, noncePrefixSize+4)
+	copy(nonce, header[4:4+noncePrefixSize])
+	binary.BigEndian.PutUint32(nonce[noncePrefixSize:], uint32(index))
+	return nonce
+}
+
+func newGCM(dek []byte) (cipher.AEAD, error) {
+	block, err := aes.NewCipher(dek)
+	if err != nil {
+		return nil, fmt.Errorf("creating aes cipher: %w", err)
+	}
+	aesgcm, err := cipher.NewGCM(block)
+	if err != nil {
+		return nil, fmt.Errorf("getting aesgcm: %w", err)
+	}
+	return aesgcm, nil
+}
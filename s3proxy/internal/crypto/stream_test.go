@@ -0,0 +1,265 @@
+/*
+Copyright (c) Edgeless Systems GmbH
+
+SPDX-License-Identifier: BUSL-1.1
+*/
+
+package crypto
+
+import (
+	"bytes"
+	"crypto/rand"
+	"io"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestStream(t *testing.T) {
+	testCases := map[string]struct {
+		plaintextSize int
+	}{
+		"empty":                      {plaintextSize: 0},
+		"single byte":                {plaintextSize: 1},
+		"less than one segment":      {plaintextSize: SegmentSize - 1},
+		"exactly one segment":        {plaintextSize: SegmentSize},
+		"more than one segment":      {plaintextSize: SegmentSize + 1},
+		"multiple complete segments": {plaintextSize: 3 * SegmentSize},
+	}
+
+	for name, tc := range testCases {
+		t.Run(name, func(t *testing.T) {
+			assert := assert.New(t)
+			require := require.New(t)
+
+			dek := newTestDEK(t)
+			plaintext := make([]byte, tc.plaintextSize)
+			_, err := rand.Read(plaintext)
+			require.NoError(err)
+
+			ciphertext := encryptFrame(t, plaintext, dek, 1)
+			assert.Equal(CiphertextSize(int64(tc.plaintextSize)), int64(len(ciphertext)))
+			plaintextSize, err := PlaintextSize(int64(len(ciphertext)))
+			require.NoError(err)
+			assert.Equal(int64(tc.plaintextSize), plaintextSize)
+
+			decrypted, err := decryptStream(ciphertext, dek, SingleFrameLayout(int64(tc.plaintextSize)))
+			require.NoError(err)
+			assert.Equal(plaintext, decrypted)
+		})
+	}
+}
+
+func TestStreamFrames(t *testing.T) {
+	dek := newTestDEK(t)
+	first := bytes.Repeat([]byte("a"), SegmentSize+3)
+	second := []byte("b")
+	layout := NewLayout([]Frame{{Number: 1, PlaintextSize: int64(len(first))}, {Number: 5, PlaintextSize: int64(len(second))}})
+
+	testCases := map[string]struct {
+		ciphertext func() []byte
+		layout     *Layout
+		want       []byte
+		wantErr    bool
+	}{
+		"multiple frames": {
+			ciphertext: func() []byte {
+				return append(encryptFrame(t, first, dek, 1), encryptFrame(t, second, dek, 5)...)
+			},
+			want: append(append([]byte{}, first...), second...),
+		},
+		"layout without frames": {
+			ciphertext: func() []byte {
+				return append(encryptFrame(t, first, dek, 1), encryptFrame(t, second, dek, 5)...)
+			},
+			layout: &Layout{FrameCount: 2, PlaintextSize: layout.PlaintextSize},
+			want:   append(append([]byte{}, first...), second...),
+		},
+		"dropped last frame": {
+			ciphertext: func() []byte { return encryptFrame(t, first, dek, 1) },
+			wantErr:    true,
+		},
+		"dropped last frame with layout without frames": {
+			ciphertext: func() []byte { return encryptFrame(t, first, dek, 1) },
+			layout:     &Layout{FrameCount: 2, PlaintextSize: layout.PlaintextSize},
+			wantErr:    true,
+		},
+		"frame doesn't match layout": {
+			ciphertext: func() []byte {
+				return append(encryptFrame(t, first, dek, 1), encryptFrame(t, second, dek, 4)...)
+			},
+			wantErr: true,
+		},
+		"more frames than in layout": {
+			ciphertext: func() []byte {
+				return append(encryptFrame(t, first, dek, 1), encryptFrame(t, second, dek, 5)...)
+			},
+			layout:  &Layout{FrameCount: 1, PlaintextSize: layout.PlaintextSize},
+			wantErr: true,
+		},
+		"frames out of order": {
+			ciphertext: func() []byte {
+				return append(encryptFrame(t, second, dek, 2), encryptFrame(t, first, dek, 1)...)
+			},
+			wantErr: true,
+		},
+		"empty ciphertext": {
+			ciphertext: func() []byte { return nil },
+			wantErr:    true,
+		},
+		"truncated header": {
+			ciphertext: func() []byte { return encryptFrame(t, first, dek, 1)[:FrameHeaderSize-1] },
+			wantErr:    true,
+		},
+		"truncated segment": {
+			ciphertext: func() []byte {
+				ciphertext := encryptFrame(t, first, dek, 1)
+				return ciphertext[:len(ciphertext)-1]
+			},
+			wantErr: true,
+		},
+		"dropped segment": {
+			ciphertext: func() []byte {
+				return encryptFrame(t, first, dek, 1)[:FrameHeaderSize+SegmentSize+segmentOverhead]
+			},
+			wantErr: true,
+		},
+		"modified plaintext size": {
+			ciphertext: func() []byte {
+				ciphertext := encryptFrame(t, first, dek, 1)
+				ciphertext[FrameHeaderSize-1]--
+				return ciphertext[:len(ciphertext)-1]
+			},
+			wantErr: true,
+		},
+		"modified segment": {
+			ciphertext: func() []byte {
+				ciphertext := encryptFrame(t, first, dek, 1)
+				ciphertext[FrameHeaderSize] ^= 0xff
+				return ciphertext
+			},
+			wantErr: true,
+		},
+		"wrong key": {
+			ciphertext: func() []byte { return encryptFrame(t, first, newTestDEK(t), 1) },
+			wantErr:    true,
+		},
+	}
+
+	for name, tc := range testCases {
+		t.Run(name, func(t *testing.T) {
+			frameLayout := layout
+			if tc.layout != nil {
+				frameLayout = *tc.layout
+			}
+			decrypted, err := decryptStream(tc.ciphertext(), dek, frameLayout)
+			if tc.wantErr {
+				assert.Error(t, err)
+				return
+			}
+			require.NoError(t, err)
+			assert.Equal(t, tc.want, decrypted)
+		})
+	}
+}
+
+func TestEncryptingReaderSizeMismatch(t *testing.T) {
+	testCases := map[string]struct {
+		plaintext     []byte
+		plaintextSize int64
+	}{
+		"plaintext too short": {
+			plaintext:     []byte("short"),
+			plaintextSize: 6,
+		},
+		"plaintext too long": {
+			plaintext:     []byte("long"),
+			plaintextSize: 3,
+		},
+	}
+
+	for name, tc := range testCases {
+		t.Run(name, func(t *testing.T) {
+			reader, err := NewEncryptingReader(bytes.NewReader(tc.plaintext), tc.plaintextSize, newTestDEK(t), 1)
+			require.NoError(t, err)
+			_, err = io.ReadAll(reader)
+			assert.Error(t, err)
+		})
+	}
+}
+
+func newTestDEK(t *testing.T) []byte {
+	t.Helper()
+	dek := make([]byte, 32)
+	_, err := rand.Read(dek)
+	require.NoError(t, err)
+	return dek
+}
+
+func encryptFrame(t *testing.T, plaintext, dek []byte, frameNumber uint32) []byte {
+	t.Helper()
+	reader, err := NewEncryptingReader(bytes.NewReader(plaintext), int64(len(plaintext)), dek, frameNumber)
+	require.NoError(t, err)
+	ciphertext, err := io.ReadAll(reader)
+	require.NoError(t, err)
+	return ciphertext
+}
+
+func decryptStream(ciphertext, dek []byte, layout Layout) ([]byte, error) {
+	reader, err := NewDecryptingReader(bytes.NewReader(ciphertext), dek, layout)
+	if err != nil {
+		return nil, err
+	}
+	return io.ReadAll(reader)
+}
+
+func TestFrameRange(t *testing.T) {
+	dek := newTestDEK(t)
+	plaintext := make([]byte, 3*SegmentSize+100)
+	_, err := rand.Read(plaintext)
+	require.NoError(t, err)
+	ciphertext := encryptFrame(t, plaintext, dek, 7)
+
+	testCases := map[string]struct {
+		start, end int64
+		wantErr    bool
+	}{
+		"first byte":              {start: 0, end: 0},
+		"last byte":               {start: int64(len(plaintext)) - 1, end: int64(len(plaintext)) - 1},
+		"within a segment":        {start: 10, end: 20},
+		"across segment boundary": {start: SegmentSize - 5, end: SegmentSize + 5},
+		"last segment":            {start: 3*SegmentSize + 1, end: 3*SegmentSize + 99},
+		"whole frame":             {start: 0, end: int64(len(plaintext)) - 1},
+		"end out of bounds":       {start: 0, end: int64(len(plaintext)), wantErr: true},
+		"end before start":        {start: 5, end: 4, wantErr: true},
+	}
+
+	for name, tc := range testCases {
+		t.Run(name, func(t *testing.T) {
+			assert := assert.New(t)
+			require := require.New(t)
+
+			frame, err := ParseFrameHeader(ciphertext[:FrameHeaderSize])
+			require.NoError(err)
+			assert.Equal(uint32(7), frame.Number)
+			assert.Equal(int64(len(plaintext)), frame.PlaintextSize)
+			assert.Equal(int64(len(ciphertext)), frame.CiphertextSize())
+
+			first, last, segment, err := frame.CiphertextRange(tc.start, tc.end)
+			if tc.wantErr {
+				assert.Error(err)
+				return
+			}
+			require.NoError(err)
+
+			reader, err := frame.NewDecryptingReader(bytes.NewReader(ciphertext[first:last+1]), segment, dek)
+			require.NoError(err)
+			offset := tc.start - segment*SegmentSize
+			decrypted := make([]byte, offset+tc.end-tc.start+1)
+			_, err = io.ReadFull(reader, decrypted)
+			require.NoError(err)
+			assert.Equal(plaintext[tc.start:tc.end+1], decrypted[offset:])
+		})
+	}
+}
@@ -0,0 +1,107 @@
+/*
+Copyright (c) Edgeless Systems GmbH
+
+SPDX-License-Identifier: BUSL-1.1
+*/
+
+package router
+
+import (
+	"crypto/md5"
+	"crypto/sha256"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"hash"
+	"io"
+	"log/slog"
+	"net/http"
+)
+
+// errBodyMismatch is returned when reading a request body that does not match its announced digests.
+var errBodyMismatch = errors.New("request body does not match its digest")
+
+// bodyReader wraps the body of a request that is encrypted while it is streamed to S3.
+// It calculates the digests of the body while it is read and compares them to the
+// x-amz-content-sha256 and Content-MD5 headers once the body is exhausted.
+//
+// There may be a client that wants to test that incorrect content digests result in API errors.
+// For encrypting the body we have to recalculate the content digest.
+// If the client intentionally sends a mismatching content digest, we would take the client request, rewrap it,
+// calculate the correct digest for the new body and NOT get an error.
+// Thus we have to check incoming requests for matching content digests.
+// On mismatch, reading fails, which aborts the request to S3 before the object is stored.
+type bodyReader struct {
+	reader       io.Reader
+	clientSHA256 string
+	contentMD5   string
+	sha256       hash.Hash
+	md5          hash.Hash
+
+	// sha256Mismatch is set if the body does not match the x-amz-content-sha256 header.
+	sha256Mismatch *ContentSHA256MismatchError
+	// md5Err is set if the body does not match the Content-MD5 header.
+	md5Err error
+}
+
+func newBodyReader(req *http.Request) *bodyReader {
+	return &bodyReader{
+		reader:       req.Body,
+		clientSHA256: req.Header.Get("x-amz-content-sha256"),
+		contentMD5:   req.Header.Get("content-md5"),
+		sha256:       sha256.New(),
+		md5:          md5.New(),
+	}
+}
+
+// Read implements io.Reader.
+func (b *bodyReader) Read(p []byte) (int, error) {
+	n, err := b.reader.Read(p)
+	b.sha256.Write(p[:n])
+	b.md5.Write(p[:n])
+
+	if errors.Is(err, io.EOF) && !b.verify() {
+		return n, errBodyMismatch
+	}
+	return n, err
+}
+
+// verify compares the digests of the body read so far with the digests announced by the client.
+func (b *bodyReader) verify() bool {
+	// UNSIGNED-PAYLOAD can be used to disabled payload signing. In that case we don't check the content digest.
+	serverSHA256 := fmt.Sprintf("%x", b.sha256.Sum(nil))
+	if b.clientSHA256 != "" && b.clientSHA256 != "UNSIGNED-PAYLOAD" && b.clientSHA256 != serverSHA256 {
+		mismatchErr := NewContentSHA256MismatchError(b.clientSHA256, serverSHA256)
+		b.sha256Mismatch = &mismatchErr
+	}
+
+	b.md5Err = validateContentMD5(b.contentMD5, [md5.Size]byte(b.md5.Sum(nil)))
+
+	return b.sha256Mismatch == nil && b.md5Err == nil
+}
+
+// writeError writes an error response if the body did not match its digests.
+// It reports whether a response was written.
+func (b *bodyReader) writeError(w http.ResponseWriter, log *slog.Logger) bool {
+	if b.sha256Mismatch != nil {
+		log.Debug("x-amz-content-sha256 mismatch")
+		// The S3 API responds with an XML formatted error message.
+		marshalled, err := xml.Marshal(b.sha256Mismatch)
+		if err != nil {
+			log.With(slog.Any("error", err)).Error("marshalling content digest mismatch")
+			http.Error(w, fmt.Sprintf("marshalling error: %s", err.Error()), http.StatusInternalServerError)
+			return true
+		}
+
+		http.Error(w, string(marshalled), http.StatusBadRequest)
+		return true
+	}
+
+	if b.md5Err != nil {
+		log.With(slog.Any("error", b.md5Err)).Error("validating content md5")
+		http.Error(w, fmt.Sprintf("validating content md5: %s", b.md5Err.Error()), http.StatusBadRequest)
+		return true
+	}
+
+	return false
+}
@@ -0,0 +1,53 @@
+/*
+Copyright (c) Edgeless Systems GmbH
+
+SPDX-License-Identifier: BUSL-1.1
+*/
+
+package router
+
+import "sync"
+
+// objectCacheSize is the maximum number of entries an objectCache holds.
+const objectCacheSize = 1024
+
+// objectVersion identifies the content of an object.
+// S3 assigns a new ETag whenever an object is overwritten, so cached data can never become stale.
+type objectVersion struct {
+	bucket string
+	key    string
+	etag   string
+}
+
+// objectCache caches data derived from the content of objects, e.g. information that can only be gathered
+// by reading parts of the object from S3.
+type objectCache[V any] struct {
+	mux     sync.Mutex
+	entries map[objectVersion]V
+}
+
+func newObjectCache[V any]() *objectCache[V] {
+	return &objectCache[V]{entries: map[objectVersion]V{}}
+}
+
+func (c *objectCache[V]) get(key objectVersion) (V, bool) {
+	c.mux.Lock()
+	defer c.mux.Unlock()
+
+	value, ok := c.entries[key]
+	return value, ok
+}
+
+// put adds an entry to the cache. If the cache is full, an arbitrary entry is evicted.
+func (c *objectCache[V]) put(key objectVersion, value V) {
+	c.mux.Lock()
+	defer c.mux.Unlock()
+
+	if len(c.entries) >= objectCacheSize {
+		for k := range c.entries {
+			delete(c.entries, k)
+			break
+		}
+	}
+	c.entries[key] = value
+}
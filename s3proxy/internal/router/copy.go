@@ -0,0 +1,207 @@
+/*
+Copyright (c) Edgeless Systems GmbH
+
+SPDX-License-Identifier: BUSL-1.1
+*/
+
+package router
+
+import (
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/service/s3"
+	"github.com/aws/aws-sdk-go-v2/service/s3/types"
+)
+
+// copyObjectResult is the response to a CopyObject request.
+type copyObjectResult struct {
+	XMLName      xml.Name `xml:"http://s3.amazonaws.com/doc/2006-03-01/ CopyObjectResult"`
+	ETag         string   `xml:"ETag"`
+	LastModified string   `xml:"LastModified,omitempty"`
+}
+
+// copyObject is a http.HandlerFunc that implements CopyObject.
+// S3 copies the encrypted body of the source object, so the copy is encrypted with the same DEK.
+// If the metadata is copied as well, the copy keeps the source's encrypted DEK. If the metadata is replaced,
+// the source's DEK is wrapped with the latest KEK and attached to the new metadata.
+func (o object) copyObject(w http.ResponseWriter, r *http.Request) {
+	o.log.With(slog.String("key", o.key), slog.String("host", o.bucket), slog.String("source", o.copySource)).Debug("copyObject")
+
+	sourceBucket, sourceKey, sourceVersionID, err := parseCopySource(o.copySource)
+	if err != nil {
+		o.log.With(slog.Any("error", err)).Error("CopyObject parsing copy source")
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	input, err := o.copyObjectInput()
+	if err != nil {
+		o.log.With(slog.Any("error", err)).Error("CopyObject parsing request")
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	if input.MetadataDirective == types.MetadataDirectiveReplace {
+		source, err := o.client.HeadObject(r.Context(), sourceBucket, sourceKey, sourceVersionID, o.copySourceSSECustomerAlgorithm, o.copySourceSSECustomerKey, o.copySourceSSECustomerKeyMD5)
+		if err != nil {
+			o.log.With(slog.Any("error", err)).Error("CopyObject reading source metadata")
+			writeS3Error(w, err)
+			return
+		}
+
+		if _, encrypted := source.Metadata[dekTag]; encrypted {
+			if source.ETag == nil {
+				o.log.Error("CopyObject source metadata is missing the ETag")
+				http.Error(w, "S3 response is missing the ETag", http.StatusInternalServerError)
+				return
+			}
+			if o.copySourceIfMatch != "" && strings.Trim(o.copySourceIfMatch, "\"") != strings.Trim(*source.ETag, "\"") {
+				http.Error(w, "At least one of the pre-conditions you specified did not hold", http.StatusPreconditionFailed)
+				return
+			}
+
+			rewrapped, _, err := o.keys.rewrapDEK(source.Metadata)
+			if err != nil {
+				o.log.With(slog.Any("error", err)).Error("CopyObject rewrapping DEK")
+				http.Error(w, err.Error(), http.StatusInternalServerError)
+				return
+			}
+			for _, key := range internalMetadata {
+				if value, ok := rewrapped[key]; ok {
+					input.Metadata[key] = value
+				}
+			}
+			// The attached DEK belongs to the source we just read. Make sure S3 copies exactly that object.
+			input.CopySourceIfMatch = source.ETag
+		}
+	}
+
+	output, err := o.client.CopyObject(r.Context(), input)
+	if err != nil {
+		o.log.With(slog.Any("error", err)).Error("CopyObject sending request to S3")
+		writeS3Error(w, err)
+		return
+	}
+
+	if output.VersionId != nil {
+		w.Header().Set("x-amz-version-id", *output.VersionId)
+	}
+	if output.CopySourceVersionId != nil {
+		w.Header().Set("x-amz-copy-source-version-id", *output.CopySourceVersionId)
+	}
+	if output.ServerSideEncryption != "" {
+		w.Header().Set("x-amz-server-side-encryption", string(output.ServerSideEncryption))
+	}
+
+	result := copyObjectResult{}
+	if output.CopyObjectResult != nil {
+		if output.CopyObjectResult.ETag != nil {
+			result.ETag = *output.CopyObjectResult.ETag
+		}
+		if output.CopyObjectResult.LastModified != nil {
+			result.LastModified = output.CopyObjectResult.LastModified.UTC().Format("2006-01-02T15:04:05.000Z")
+		}
+	}
+	writeXML(w, result, o.log)
+}
+
+// copyObjectInput builds the input of a CopyObject call from the client's request.
+func (o object) copyObjectInput() (*s3.CopyObjectInput, error) {
+	input := &s3.CopyObjectInput{
+		Bucket:                         &o.bucket,
+		Key:                            &o.key,
+		CopySource:                     &o.copySource,
+		MetadataDirective:              types.MetadataDirective(strings.ToUpper(o.header.Get("x-amz-metadata-directive"))),
+		TaggingDirective:               types.TaggingDirective(strings.ToUpper(o.header.Get("x-amz-tagging-directive"))),
+		StorageClass:                   types.StorageClass(o.header.Get("x-amz-storage-class")),
+		ServerSideEncryption:           types.ServerSideEncryption(o.header.Get("x-amz-server-side-encryption")),
+		ObjectLockLegalHoldStatus:      types.ObjectLockLegalHoldStatus(o.objectLockLegalHoldStatus),
+		CopySourceIfMatch:              optionalString(o.copySourceIfMatch),
+		CopySourceIfNoneMatch:          optionalString(o.header.Get("x-amz-copy-source-if-none-match")),
+		SSEKMSKeyId:                    optionalString(o.header.Get("x-amz-server-side-encryption-aws-kms-key-id")),
+		SSECustomerAlgorithm:           optionalString(o.sseCustomerAlgorithm),
+		SSECustomerKey:                 optionalString(o.sseCustomerKey),
+		SSECustomerKeyMD5:              optionalString(o.sseCustomerKeyMD5),
+		CopySourceSSECustomerAlgorithm: optionalString(o.copySourceSSECustomerAlgorithm),
+		CopySourceSSECustomerKey:       optionalString(o.copySourceSSECustomerKey),
+		CopySourceSSECustomerKeyMD5:    optionalString(o.copySourceSSECustomerKeyMD5),
+	}
+
+	var err error
+	if input.CopySourceIfModifiedSince, err = parseOptionalTime(o.header.Get("x-amz-copy-source-if-modified-since")); err != nil {
+		return nil, fmt.Errorf("parsing x-amz-copy-source-if-modified-since: %w", err)
+	}
+	if input.CopySourceIfUnmodifiedSince, err = parseOptionalTime(o.header.Get("x-amz-copy-source-if-unmodified-since")); err != nil {
+		return nil, fmt.Errorf("parsing x-amz-copy-source-if-unmodified-since: %w", err)
+	}
+
+	if input.MetadataDirective == types.MetadataDirectiveReplace {
+		input.Metadata = o.metadata
+		input.ContentType = optionalString(o.contentType)
+		input.CacheControl = optionalString(o.header.Get("Cache-Control"))
+		input.ContentDisposition = optionalString(o.header.Get("Content-Disposition"))
+		input.ContentEncoding = optionalString(o.header.Get("Content-Encoding"))
+		input.ContentLanguage = optionalString(o.header.Get("Content-Language"))
+	}
+	if input.TaggingDirective == types.TaggingDirectiveReplace {
+		input.Tagging = &o.tags
+	}
+
+	// It is not allowed to only set one of these two properties.
+	if o.objectLockMode != "" && !o.objectLockRetainUntilDate.IsZero() {
+		input.ObjectLockMode = types.ObjectLockMode(o.objectLockMode)
+		input.ObjectLockRetainUntilDate = &o.objectLockRetainUntilDate
+	}
+
+	return input, nil
+}
+
+// parseCopySource parses the value of the x-amz-copy-source header.
+// The header holds the URL-encoded bucket and key of the source object, optionally followed by a version ID.
+func parseCopySource(raw string) (bucket, key, versionID string, err error) {
+	source, rawQuery, _ := strings.Cut(strings.TrimPrefix(raw, "/"), "?")
+	if rawQuery != "" {
+		query, err := url.ParseQuery(rawQuery)
+		if err != nil {
+			return "", "", "", fmt.Errorf("parsing copy source %q: %w", raw, err)
+		}
+		versionID = query.Get("versionId")
+	}
+
+	source, err = url.PathUnescape(source)
+	if err != nil {
+		return "", "", "", fmt.Errorf("parsing copy source %q: %w", raw, err)
+	}
+	bucket, key, found := strings.Cut(source, "/")
+	if !found || bucket == "" || key == "" {
+		return "", "", "", errors.New("copy source must have the form <bucket>/<key>")
+	}
+	return bucket, key, versionID, nil
+}
+
+// parseOptionalTime parses an HTTP date, returning nil if raw is empty.
+func parseOptionalTime(raw string) (*time.Time, error) {
+	if raw == "" {
+		return nil, nil
+	}
+	date, err := http.ParseTime(raw)
+	if err != nil {
+		return nil, err
+	}
+	return &date, nil
+}
+
+// optionalString returns a pointer to s, or nil if s is empty.
+func optionalString(s string) *string {
+	if s == "" {
+		return nil
+	}
+	return &s
+}
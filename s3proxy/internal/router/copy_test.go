@@ -0,0 +1,195 @@
+/*
+Copyright (c) Edgeless Systems GmbH
+
+SPDX-License-Identifier: BUSL-1.1
+*/
+
+package router
+
+import (
+	"maps"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/edgelesssys/constellation/v2/internal/logger"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestCopyObject(t *testing.T) {
+	kekV1, kekV2 := [32]byte{0x01}, [32]byte{0x02}
+	oldKeys := newTestKeyring(kekV1)
+	newKeys, err := newKeyring(map[uint32][32]byte{1: kekV1, 2: kekV2})
+	require.NoError(t, err)
+	latestKeys, err := newKeyring(map[uint32][32]byte{2: kekV2})
+	require.NoError(t, err)
+
+	testCases := map[string]struct {
+		source         string
+		header         map[string]string
+		wantCode       int
+		wantMetadata   map[string]string
+		wantKEKVersion string
+		wantReadable   keyring
+	}{
+		"copy metadata": {
+			source:         "bucket/source",
+			header:         map[string]string{"x-amz-meta-user": "new"},
+			wantCode:       http.StatusOK,
+			wantMetadata:   map[string]string{"user": "old"},
+			wantKEKVersion: "1",
+			wantReadable:   oldKeys,
+		},
+		"replace metadata": {
+			source: "bucket/source",
+			header: map[string]string{
+				"x-amz-metadata-directive": "REPLACE",
+				"x-amz-meta-user":          "new",
+			},
+			wantCode:       http.StatusOK,
+			wantMetadata:   map[string]string{"user": "new"},
+			wantKEKVersion: "2",
+			wantReadable:   latestKeys,
+		},
+		"replace metadata with internal keys": {
+			source: "bucket/source",
+			header: map[string]string{
+				"x-amz-metadata-directive": "REPLACE",
+				"x-amz-meta-" + dekTag:     "00",
+				"x-amz-meta-" + formatTag:  "other",
+			},
+			wantCode:       http.StatusOK,
+			wantMetadata:   map[string]string{},
+			wantKEKVersion: "2",
+			wantReadable:   latestKeys,
+		},
+		"replace metadata of unencrypted object": {
+			source: "bucket/plain",
+			header: map[string]string{
+				"x-amz-metadata-directive": "REPLACE",
+				"x-amz-meta-" + dekTag:     "00",
+				"x-amz-meta-user":          "new",
+			},
+			wantCode:     http.StatusOK,
+			wantMetadata: map[string]string{"user": "new"},
+			wantReadable: latestKeys,
+		},
+		"leading slash and encoded key": {
+			source:         "/bucket/%73ource",
+			wantCode:       http.StatusOK,
+			wantMetadata:   map[string]string{"user": "old"},
+			wantKEKVersion: "1",
+			wantReadable:   oldKeys,
+		},
+		"if-match mismatch": {
+			source: "bucket/source",
+			header: map[string]string{
+				"x-amz-metadata-directive":   "REPLACE",
+				"x-amz-copy-source-if-match": `"other"`,
+			},
+			wantCode: http.StatusPreconditionFailed,
+		},
+		"missing source": {
+			source:   "bucket/missing",
+			header:   map[string]string{"x-amz-metadata-directive": "REPLACE"},
+			wantCode: http.StatusNotFound,
+		},
+		"invalid source": {
+			source:   "bucket",
+			wantCode: http.StatusBadRequest,
+		},
+		"invalid condition": {
+			source:   "bucket/source",
+			header:   map[string]string{"x-amz-copy-source-if-modified-since": "yesterday"},
+			wantCode: http.StatusBadRequest,
+		},
+	}
+
+	for name, tc := range testCases {
+		t.Run(name, func(t *testing.T) {
+			assert := assert.New(t)
+			require := require.New(t)
+
+			client := newStubS3Client()
+			putTestObject(t, client, oldKeys, "source")
+			client.metadata["bucket/source"]["user"] = "old"
+			client.objects["bucket/plain"] = []byte("hello, world")
+			client.metadata["bucket/plain"] = map[string]string{}
+
+			req := httptest.NewRequest(http.MethodPut, "/bucket/copy", nil)
+			req.Header.Set("x-amz-copy-source", tc.source)
+			for k, v := range tc.header {
+				req.Header.Set(k, v)
+			}
+			obj := object{
+				keys:              newKeys,
+				client:            client,
+				bucket:            "bucket",
+				key:               "copy",
+				metadata:          getMetadataHeaders(req.Header),
+				copySource:        req.Header.Get("x-amz-copy-source"),
+				copySourceIfMatch: req.Header.Get("x-amz-copy-source-if-match"),
+				header:            req.Header,
+				log:               logger.NewTest(t),
+			}
+
+			rec := httptest.NewRecorder()
+			obj.copyObject(rec, req)
+			require.Equal(tc.wantCode, rec.Code)
+			if tc.wantCode != http.StatusOK {
+				assert.NotContains(client.objects, "bucket/copy")
+				return
+			}
+			assert.Contains(rec.Body.String(), "<CopyObjectResult")
+
+			metadata := maps.Clone(client.metadata["bucket/copy"])
+			assert.Equal(tc.wantKEKVersion, metadata[kekVersionTag])
+			for _, key := range internalMetadata {
+				delete(metadata, key)
+			}
+			assert.Equal(tc.wantMetadata, metadata)
+
+			rec = getTestObject(t, client, tc.wantReadable, "copy")
+			require.Equal(http.StatusOK, rec.Code)
+			assert.Equal("hello, world", rec.Body.String())
+		})
+	}
+}
+
+func TestParseCopySource(t *testing.T) {
+	testCases := map[string]struct {
+		raw           string
+		wantBucket    string
+		wantKey       string
+		wantVersionID string
+		wantErr       bool
+	}{
+		"bucket and key":      {raw: "bucket/key", wantBucket: "bucket", wantKey: "key"},
+		"leading slash":       {raw: "/bucket/key", wantBucket: "bucket", wantKey: "key"},
+		"nested key":          {raw: "bucket/dir/key", wantBucket: "bucket", wantKey: "dir/key"},
+		"encoded key":         {raw: "bucket/a%20b%3Fc", wantBucket: "bucket", wantKey: "a b?c"},
+		"version ID":          {raw: "bucket/key?versionId=abc", wantBucket: "bucket", wantKey: "key", wantVersionID: "abc"},
+		"missing key":         {raw: "bucket", wantErr: true},
+		"empty key":           {raw: "bucket/", wantErr: true},
+		"invalid encoding":    {raw: "bucket/%zz", wantErr: true},
+		"invalid query":       {raw: "bucket/key?versionId=%zz", wantErr: true},
+		"missing bucket name": {raw: "/key", wantErr: true},
+	}
+
+	for name, tc := range testCases {
+		t.Run(name, func(t *testing.T) {
+			assert := assert.New(t)
+
+			bucket, key, versionID, err := parseCopySource(tc.raw)
+			if tc.wantErr {
+				assert.Error(err)
+				return
+			}
+			assert.NoError(err)
+			assert.Equal(tc.wantBucket, bucket)
+			assert.Equal(tc.wantKey, key)
+			assert.Equal(tc.wantVersionID, versionID)
+		})
+	}
+}
@@ -7,69 +7,43 @@ SPDX-License-Identifier: BUSL-1.1
 package router
 
 import (
-	"encoding/xml"
 	"fmt"
 	"io"
 	"log/slog"
 	"net/http"
+	"strconv"
 
 	"github.com/edgelesssys/constellation/v2/s3proxy/internal/s3"
 )
 
-func handleGetObject(client *s3.Client, key string, bucket string, log *slog.Logger) http.HandlerFunc {
+func handleGetObject(client *s3.Client, key string, bucket string, keys keyring, frames *objectCache[frameIndex], log *slog.Logger) http.HandlerFunc {
 	return func(w http.ResponseWriter, req *http.Request) {
 		log.With(slog.String("path", req.URL.Path), slog.String("method", req.Method), slog.String("host", req.Host)).Debug("intercepting")
-		if req.Header.Get("Range") != "" {
-			log.Error("GetObject Range header unsupported")
-			http.Error(w, "s3proxy currently does not support Range headers", http.StatusNotImplemented)
-			return
-		}
 
 		obj := object{
+			keys:                 keys,
 			client:               client,
 			key:                  key,
 			bucket:               bucket,
 			query:                req.URL.Query(),
+			rangeHeader:          req.Header.Get("Range"),
 			sseCustomerAlgorithm: req.Header.Get("x-amz-server-side-encryption-customer-algorithm"),
 			sseCustomerKey:       req.Header.Get("x-amz-server-side-encryption-customer-key"),
 			sseCustomerKeyMD5:    req.Header.Get("x-amz-server-side-encryption-customer-key-MD5"),
+			frames:               frames,
 			log:                  log,
 		}
 		get(obj.get)(w, req)
 	}
 }
 
-func handlePutObject(client *s3.Client, key string, bucket string, log *slog.Logger) http.HandlerFunc {
+func handlePutObject(client *s3.Client, key string, bucket string, keys keyring, log *slog.Logger) http.HandlerFunc {
 	return func(w http.ResponseWriter, req *http.Request) {
 		log.With(slog.String("path", req.URL.Path), slog.String("method", req.Method), slog.String("host", req.Host)).Debug("intercepting")
-		body, err := io.ReadAll(req.Body)
-		if err != nil {
-			log.With(slog.Any("error", err)).Error("PutObject")
-			http.Error(w, fmt.Sprintf("reading body: %s", err.Error()), http.StatusInternalServerError)
-			return
-		}
-
-		clientDigest := req.Header.Get("x-amz-content-sha256")
-		serverDigest := sha256sum(body)
-
-		// There may be a client that wants to test that incorrect content digests result in API errors.
-		// For encrypting the body we have to recalculate the content digest.
-		// If the client intentionally sends a mismatching content digest, we would take the client request, rewrap it,
-		// calculate the correct digest for the new body and NOT get an error.
-		// Thus we have to check incoming requets for matching content digests.
-		// UNSIGNED-PAYLOAD can be used to disabled payload signing. In that case we don't check the content digest.
-		if clientDigest != "" && clientDigest != "UNSIGNED-PAYLOAD" && clientDigest != serverDigest {
-			log.Debug("PutObject", "error", "x-amz-content-sha256 mismatch")
-			// The S3 API responds with an XML formatted error message.
-			mismatchErr := NewContentSHA256MismatchError(clientDigest, serverDigest)
-			marshalled, err := xml.Marshal(mismatchErr)
-			if err != nil {
-				log.With(slog.Any("error", err)).Error("PutObject")
-				http.Error(w, fmt.Sprintf("marshalling error: %s", err.Error()), http.StatusInternalServerError)
-				return
-			}
-
-			http.Error(w, string(marshalled), http.StatusBadRequest)
+		// The body is encrypted while it is streamed to S3, so its size has to be known in advance.
+		if req.ContentLength < 0 {
+			log.Error("PutObject without Content-Length")
+			http.Error(w, "Content-Length header is required", http.StatusLengthRequired)
 			return
 		}
 
@@ -83,18 +57,13 @@ func handlePutObject(client *s3.Client, key string, bucket string, log *slog.Log
 			return
 		}
 
-		err = validateContentMD5(req.Header.Get("content-md5"), body)
-		if err != nil {
-			log.With(slog.Any("error", err)).Error("validating content md5")
-			http.Error(w, fmt.Sprintf("validating content md5: %s", err.Error()), http.StatusBadRequest)
-			return
-		}
-
 		obj := object{
+			keys:                      keys,
 			client:                    client,
 			key:                       key,
 			bucket:                    bucket,
-			data:                      body,
+			body:                      newBodyReader(req),
+			contentLength:             req.ContentLength,
 			query:                     req.URL.Query(),
 			tags:                      req.Header.Get("x-amz-tagging"),
 			contentType:               req.Header.Get("Content-Type"),
@@ -112,14 +81,11 @@ func handlePutObject(client *s3.Client, key string, bucket string, log *slog.Log
 	}
 }
 
-func handleForwards(log *slog.Logger) http.HandlerFunc {
+func handleForwards(client *s3.Client, log *slog.Logger) http.HandlerFunc {
 	return func(w http.ResponseWriter, req *http.Request) {
 		log.With(slog.String("path", req.URL.Path), slog.String("method", req.Method), slog.String("host", req.Host)).Debug("forwarding")
 
-		newReq := repackage(req)
-
-		httpClient := http.DefaultClient
-		resp, err := httpClient.Do(&newReq)
+		resp, err := forward(client, req)
 		if err != nil {
 			log.With(slog.Any("error", err)).Error("do request")
 			http.Error(w, fmt.Sprintf("do request: %s", err.Error()), http.StatusInternalServerError)
@@ -149,42 +115,208 @@ func handleForwards(log *slog.Logger) http.HandlerFunc {
 	}
 }
 
-// handleCreateMultipartUpload logs the request and blocks with an error message.
-func handleCreateMultipartUpload(log *slog.Logger) http.HandlerFunc {
+func handleHeadObject(client *s3.Client, key string, bucket string, keys keyring, log *slog.Logger) http.HandlerFunc {
+	return func(w http.ResponseWriter, req *http.Request) {
+		log.With(slog.String("path", req.URL.Path), slog.String("method", req.Method), slog.String("host", req.Host)).Debug("intercepting")
+
+		obj := object{
+			keys:                 keys,
+			client:               client,
+			key:                  key,
+			bucket:               bucket,
+			query:                req.URL.Query(),
+			sseCustomerAlgorithm: req.Header.Get("x-amz-server-side-encryption-customer-algorithm"),
+			sseCustomerKey:       req.Header.Get("x-amz-server-side-encryption-customer-key"),
+			sseCustomerKeyMD5:    req.Header.Get("x-amz-server-side-encryption-customer-key-MD5"),
+			log:                  log,
+		}
+		allowMethod(obj.head, http.MethodHead)(w, req)
+	}
+}
+
+func handleCopyObject(client *s3.Client, key string, bucket string, keys keyring, log *slog.Logger) http.HandlerFunc {
+	return func(w http.ResponseWriter, req *http.Request) {
+		log.With(slog.String("path", req.URL.Path), slog.String("method", req.Method), slog.String("host", req.Host)).Debug("intercepting CopyObject")
+
+		raw := req.Header.Get("x-amz-object-lock-retain-until-date")
+		retentionTime, err := parseRetentionTime(raw)
+		if err != nil {
+			log.With(slog.String("data", raw), slog.Any("error", err)).Error("parsing lock retention time")
+			http.Error(w, fmt.Sprintf("parsing x-amz-object-lock-retain-until-date: %s", err.Error()), http.StatusInternalServerError)
+			return
+		}
+
+		obj := object{
+			keys:                           keys,
+			client:                         client,
+			key:                            key,
+			bucket:                         bucket,
+			query:                          req.URL.Query(),
+			tags:                           req.Header.Get("x-amz-tagging"),
+			contentType:                    req.Header.Get("Content-Type"),
+			metadata:                       getMetadataHeaders(req.Header),
+			objectLockLegalHoldStatus:      req.Header.Get("x-amz-object-lock-legal-hold"),
+			objectLockMode:                 req.Header.Get("x-amz-object-lock-mode"),
+			objectLockRetainUntilDate:      retentionTime,
+			sseCustomerAlgorithm:           req.Header.Get("x-amz-server-side-encryption-customer-algorithm"),
+			sseCustomerKey:                 req.Header.Get("x-amz-server-side-encryption-customer-key"),
+			sseCustomerKeyMD5:              req.Header.Get("x-amz-server-side-encryption-customer-key-MD5"),
+			copySource:                     req.Header.Get("x-amz-copy-source"),
+			copySourceIfMatch:              req.Header.Get("x-amz-copy-source-if-match"),
+			copySourceSSECustomerAlgorithm: req.Header.Get("x-amz-copy-source-server-side-encryption-customer-algorithm"),
+			copySourceSSECustomerKey:       req.Header.Get("x-amz-copy-source-server-side-encryption-customer-key"),
+			copySourceSSECustomerKeyMD5:    req.Header.Get("x-amz-copy-source-server-side-encryption-customer-key-MD5"),
+			header:                         req.Header,
+			log:                            log,
+		}
+		put(obj.copyObject)(w, req)
+	}
+}
+
+func handleListObjects(client *s3.Client, bucket string, keys keyring, sizes *objectCache[int64], log *slog.Logger) http.HandlerFunc {
+	return func(w http.ResponseWriter, req *http.Request) {
+		log.With(slog.String("path", req.URL.Path), slog.String("method", req.Method), slog.String("host", req.Host)).Debug("intercepting ListObjects")
+
+		obj := object{
+			keys:   keys,
+			client: client,
+			bucket: bucket,
+			query:  req.URL.Query(),
+			sizes:  sizes,
+			log:    log,
+		}
+		get(obj.listObjects)(w, req)
+	}
+}
+
+// forward sends a request to the client's backend without modifying it.
+// The caller has to close the body of the response.
+func forward(client forwarder, req *http.Request) (*http.Response, error) {
+	newReq := repackage(req, client.Endpoint())
+	return client.Do(&newReq)
+}
+
+func handleCreateMultipartUpload(client *s3.Client, key string, bucket string, keys keyring, uploads *uploadStore, log *slog.Logger) http.HandlerFunc {
 	return func(w http.ResponseWriter, req *http.Request) {
 		log.With(slog.String("path", req.URL.Path), slog.String("method", req.Method), slog.String("host", req.Host)).Debug("intercepting CreateMultipartUpload")
 
-		log.Error("Blocking CreateMultipartUpload request")
-		http.Error(w, "s3proxy is configured to block CreateMultipartUpload requests", http.StatusNotImplemented)
+		raw := req.Header.Get("x-amz-object-lock-retain-until-date")
+		retentionTime, err := parseRetentionTime(raw)
+		if err != nil {
+			log.With(slog.String("data", raw), slog.Any("error", err)).Error("parsing lock retention time")
+			http.Error(w, fmt.Sprintf("parsing x-amz-object-lock-retain-until-date: %s", err.Error()), http.StatusInternalServerError)
+			return
+		}
+
+		obj := object{
+			keys:                      keys,
+			client:                    client,
+			key:                       key,
+			bucket:                    bucket,
+			query:                     req.URL.Query(),
+			tags:                      req.Header.Get("x-amz-tagging"),
+			contentType:               req.Header.Get("Content-Type"),
+			metadata:                  getMetadataHeaders(req.Header),
+			objectLockLegalHoldStatus: req.Header.Get("x-amz-object-lock-legal-hold"),
+			objectLockMode:            req.Header.Get("x-amz-object-lock-mode"),
+			objectLockRetainUntilDate: retentionTime,
+			sseCustomerAlgorithm:      req.Header.Get("x-amz-server-side-encryption-customer-algorithm"),
+			sseCustomerKey:            req.Header.Get("x-amz-server-side-encryption-customer-key"),
+			sseCustomerKeyMD5:         req.Header.Get("x-amz-server-side-encryption-customer-key-MD5"),
+			uploads:                   uploads,
+			log:                       log,
+		}
+		post(obj.createMultipartUpload)(w, req)
 	}
 }
 
-// handleUploadPart logs the request and blocks with an error message.
-func handleUploadPart(log *slog.Logger) http.HandlerFunc {
+func handleUploadPart(client *s3.Client, key string, bucket string, keys keyring, uploads *uploadStore, log *slog.Logger) http.HandlerFunc {
 	return func(w http.ResponseWriter, req *http.Request) {
 		log.With(slog.String("path", req.URL.Path), slog.String("method", req.Method), slog.String("host", req.Host)).Debug("intercepting UploadPart")
 
-		log.Error("Blocking UploadPart request")
-		http.Error(w, "s3proxy is configured to block UploadPart requests", http.StatusNotImplemented)
+		partNumber, err := strconv.ParseInt(req.URL.Query().Get("partNumber"), 10, 32)
+		if err != nil || partNumber < 1 || partNumber > maxPartNumber {
+			log.With(slog.String("partNumber", req.URL.Query().Get("partNumber"))).Error("UploadPart invalid part number")
+			http.Error(w, fmt.Sprintf("part number must be an integer between 1 and %d", maxPartNumber), http.StatusBadRequest)
+			return
+		}
+
+		// Copied parts would keep the ciphertext of their source, which is encrypted with a different DEK.
+		if req.Header.Get("x-amz-copy-source") != "" {
+			log.Error("UploadPartCopy is not supported for encrypted multipart uploads")
+			http.Error(w, "UploadPartCopy is not supported for encrypted multipart uploads", http.StatusNotImplemented)
+			return
+		}
+
+		// The part is encrypted while it is streamed to S3, so its size has to be known in advance.
+		if req.ContentLength < 0 {
+			log.Error("UploadPart without Content-Length")
+			http.Error(w, "Content-Length header is required", http.StatusLengthRequired)
+			return
+		}
+
+		obj := object{
+			keys:                 keys,
+			client:               client,
+			key:                  key,
+			bucket:               bucket,
+			body:                 newBodyReader(req),
+			contentLength:        req.ContentLength,
+			query:                req.URL.Query(),
+			sseCustomerAlgorithm: req.Header.Get("x-amz-server-side-encryption-customer-algorithm"),
+			sseCustomerKey:       req.Header.Get("x-amz-server-side-encryption-customer-key"),
+			sseCustomerKeyMD5:    req.Header.Get("x-amz-server-side-encryption-customer-key-MD5"),
+			uploadID:             req.URL.Query().Get("uploadId"),
+			partNumber:           int32(partNumber),
+			uploads:              uploads,
+			log:                  log,
+		}
+		put(obj.uploadPart)(w, req)
 	}
 }
 
-// handleCompleteMultipartUpload logs the request and blocks with an error message.
-func handleCompleteMultipartUpload(log *slog.Logger) http.HandlerFunc {
+func handleCompleteMultipartUpload(client *s3.Client, key string, bucket string, keys keyring, uploads *uploadStore, log *slog.Logger) http.HandlerFunc {
 	return func(w http.ResponseWriter, req *http.Request) {
 		log.With(slog.String("path", req.URL.Path), slog.String("method", req.Method), slog.String("host", req.Host)).Debug("intercepting CompleteMultipartUpload")
 
-		log.Error("Blocking CompleteMultipartUpload request")
-		http.Error(w, "s3proxy is configured to block CompleteMultipartUpload requests", http.StatusNotImplemented)
+		body, err := io.ReadAll(req.Body)
+		if err != nil {
+			log.With(slog.Any("error", err)).Error("CompleteMultipartUpload")
+			http.Error(w, fmt.Sprintf("reading body: %s", err.Error()), http.StatusInternalServerError)
+			return
+		}
+
+		obj := object{
+			keys:                 keys,
+			client:               client,
+			key:                  key,
+			bucket:               bucket,
+			data:                 body,
+			query:                req.URL.Query(),
+			sseCustomerAlgorithm: req.Header.Get("x-amz-server-side-encryption-customer-algorithm"),
+			sseCustomerKey:       req.Header.Get("x-amz-server-side-encryption-customer-key"),
+			sseCustomerKeyMD5:    req.Header.Get("x-amz-server-side-encryption-customer-key-MD5"),
+			uploadID:             req.URL.Query().Get("uploadId"),
+			uploads:              uploads,
+			log:                  log,
+		}
+		post(obj.completeMultipartUpload)(w, req)
 	}
 }
 
-// handleAbortMultipartUpload logs the request and blocks with an error message.
-func handleAbortMultipartUpload(log *slog.Logger) http.HandlerFunc {
+func handleAbortMultipartUpload(client *s3.Client, key string, bucket string, uploads *uploadStore, log *slog.Logger) http.HandlerFunc {
 	return func(w http.ResponseWriter, req *http.Request) {
 		log.With(slog.String("path", req.URL.Path), slog.String("method", req.Method), slog.String("host", req.Host)).Debug("intercepting AbortMultipartUpload")
 
-		log.Error("Blocking AbortMultipartUpload request")
-		http.Error(w, "s3proxy is configured to block AbortMultipartUpload requests", http.StatusNotImplemented)
+		obj := object{
+			client:   client,
+			key:      key,
+			bucket:   bucket,
+			query:    req.URL.Query(),
+			uploadID: req.URL.Query().Get("uploadId"),
+			uploads:  uploads,
+			log:      log,
+		}
+		del(obj.abortMultipartUpload)(w, req)
 	}
 }
@@ -0,0 +1,83 @@
+/*
+Copyright (c) Edgeless Systems GmbH
+
+SPDX-License-Identifier: BUSL-1.1
+*/
+
+package router
+
+import (
+	"log/slog"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/edgelesssys/constellation/v2/s3proxy/internal/crypto"
+)
+
+// head is a http.HandlerFunc that implements the HEAD method for objects.
+// The request is forwarded to S3, so that S3 evaluates conditional requests.
+// In the response, the ciphertext size of encrypted objects is replaced with their plaintext size
+// and the metadata used by s3proxy is removed.
+func (o object) head(w http.ResponseWriter, r *http.Request) {
+	o.log.With(slog.String("key", o.key), slog.String("host", o.bucket)).Debug("headObject")
+
+	resp, err := forward(o.client, r)
+	if err != nil {
+		o.log.With(slog.Any("error", err)).Error("HeadObject sending request to S3")
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	defer resp.Body.Close()
+
+	metadata := map[string]string{}
+	for key, values := range resp.Header {
+		if name, ok := strings.CutPrefix(strings.ToLower(key), "x-amz-meta-"); ok {
+			metadata[name] = resp.Header.Get(key)
+			if isInternalMetadata(name) {
+				continue
+			}
+		}
+		w.Header()[key] = values
+	}
+
+	if resp.StatusCode == http.StatusOK && resp.ContentLength >= 0 {
+		size, err := o.plaintextSize(metadata, resp.ContentLength)
+		if err != nil {
+			o.log.With(slog.Any("error", err)).Error("HeadObject calculating plaintext size")
+			writeS3Error(w, err)
+			return
+		}
+		w.Header().Set("Content-Length", strconv.FormatInt(size, 10))
+	}
+
+	w.WriteHeader(resp.StatusCode)
+}
+
+// plaintextSize returns the size of an object's plaintext.
+// The object is described by its metadata and the size of its body in S3.
+func (o object) plaintextSize(metadata map[string]string, ciphertextSize int64) (int64, error) {
+	if _, encrypted := metadata[dekTag]; !encrypted {
+		return ciphertextSize, nil
+	}
+
+	switch metadata[formatTag] {
+	case streamFormat:
+		return crypto.PlaintextSize(ciphertextSize)
+
+	case multipartStreamFormat:
+		// Each part has its own size, so the size is recorded in the object's layout.
+		dek, _, err := o.keys.unwrapDEK(metadata)
+		if err != nil {
+			return 0, err
+		}
+		layout, err := streamLayout(metadata, dek, ciphertextSize)
+		if err != nil {
+			return 0, err
+		}
+		return layout.PlaintextSize, nil
+
+	default:
+		return crypto.LegacyPlaintextSize(ciphertextSize)
+	}
+}
@@ -0,0 +1,148 @@
+/*
+Copyright (c) Edgeless Systems GmbH
+
+SPDX-License-Identifier: BUSL-1.1
+*/
+
+package router
+
+import (
+	"encoding/hex"
+	"testing"
+
+	"github.com/edgelesssys/constellation/v2/internal/logger"
+	"github.com/edgelesssys/constellation/v2/s3proxy/internal/crypto"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestPlaintextSize(t *testing.T) {
+	kek := [32]byte{0x01}
+	data := make([]byte, 2*crypto.SegmentSize+10)
+
+	testCases := map[string]struct {
+		object  func(t *testing.T) ([]byte, map[string]string)
+		wantErr bool
+	}{
+		"unencrypted": {
+			object: func(*testing.T) ([]byte, map[string]string) {
+				return data, map[string]string{}
+			},
+		},
+		"stream format": {
+			object: func(t *testing.T) ([]byte, map[string]string) {
+				dek, encryptedDEK, err := crypto.GenerateDEK(kek)
+				require.NoError(t, err)
+				return encryptFrames(t, dek, data), map[string]string{dekTag: hex.EncodeToString(encryptedDEK), formatTag: streamFormat}
+			},
+		},
+		"multipart stream format": {
+			object: func(t *testing.T) ([]byte, map[string]string) {
+				dek, encryptedDEK, err := crypto.GenerateDEK(kek)
+				require.NoError(t, err)
+				parts := [][]byte{data[:crypto.SegmentSize+1], data[crypto.SegmentSize+1:]}
+				return encryptFrames(t, dek, parts...), map[string]string{
+					dekTag:    hex.EncodeToString(encryptedDEK),
+					formatTag: multipartStreamFormat,
+					layoutTag: sealLayout(t, dek, parts...),
+				}
+			},
+		},
+		"multipart stream format without layout": {
+			object: func(t *testing.T) ([]byte, map[string]string) {
+				dek, encryptedDEK, err := crypto.GenerateDEK(kek)
+				require.NoError(t, err)
+				body := encryptFrames(t, dek, data[:crypto.SegmentSize+1], data[crypto.SegmentSize+1:])
+				return body, map[string]string{dekTag: hex.EncodeToString(encryptedDEK), formatTag: multipartStreamFormat}
+			},
+			wantErr: true,
+		},
+		"layout sealed with another DEK": {
+			object: func(t *testing.T) ([]byte, map[string]string) {
+				dek, encryptedDEK, err := crypto.GenerateDEK(kek)
+				require.NoError(t, err)
+				otherDEK, _, err := crypto.GenerateDEK(kek)
+				require.NoError(t, err)
+				return encryptFrames(t, dek, data), map[string]string{
+					dekTag:    hex.EncodeToString(encryptedDEK),
+					formatTag: multipartStreamFormat,
+					layoutTag: sealLayout(t, otherDEK, data),
+				}
+			},
+			wantErr: true,
+		},
+		"multipart stream format with dropped part": {
+			object: func(t *testing.T) ([]byte, map[string]string) {
+				dek, encryptedDEK, err := crypto.GenerateDEK(kek)
+				require.NoError(t, err)
+				parts := [][]byte{data[:crypto.SegmentSize+1], data[crypto.SegmentSize+1:]}
+				return encryptFrames(t, dek, parts[0]), map[string]string{
+					dekTag:    hex.EncodeToString(encryptedDEK),
+					formatTag: multipartStreamFormat,
+					layoutTag: sealLayout(t, dek, parts...),
+				}
+			},
+			wantErr: true,
+		},
+		"multipart stream format with irregular parts and dropped part": {
+			object: func(t *testing.T) ([]byte, map[string]string) {
+				dek, encryptedDEK, err := crypto.GenerateDEK(kek)
+				require.NoError(t, err)
+				// Parts of distinct sizes can't be listed in the layout.
+				var parts [][]byte
+				rest := data
+				for i := 1; i <= 40; i++ {
+					parts = append(parts, rest[:i])
+					rest = rest[i:]
+				}
+				parts = append(parts, rest)
+				return encryptFrames(t, dek, parts[:len(parts)-1]...), map[string]string{
+					dekTag:    hex.EncodeToString(encryptedDEK),
+					formatTag: multipartStreamFormat,
+					layoutTag: sealLayout(t, dek, parts...),
+				}
+			},
+			wantErr: true,
+		},
+		"legacy single ciphertext": {
+			object: func(t *testing.T) ([]byte, map[string]string) {
+				ciphertext, encryptedDEK, err := crypto.Encrypt(data, kek)
+				require.NoError(t, err)
+				return ciphertext, map[string]string{dekTag: hex.EncodeToString(encryptedDEK)}
+			},
+		},
+		"truncated stream format": {
+			object: func(t *testing.T) ([]byte, map[string]string) {
+				dek, encryptedDEK, err := crypto.GenerateDEK(kek)
+				require.NoError(t, err)
+				return encryptFrames(t, dek, data)[:10], map[string]string{dekTag: hex.EncodeToString(encryptedDEK), formatTag: streamFormat}
+			},
+			wantErr: true,
+		},
+	}
+
+	for name, tc := range testCases {
+		t.Run(name, func(t *testing.T) {
+			assert := assert.New(t)
+
+			client := newStubS3Client()
+			body, metadata := tc.object(t)
+			client.objects["bucket/key"], client.metadata["bucket/key"] = body, metadata
+			obj := object{
+				keys:   newTestKeyring(kek),
+				client: client,
+				bucket: "bucket",
+				key:    "key",
+				log:    logger.NewTest(t),
+			}
+
+			size, err := obj.plaintextSize(metadata, int64(len(body)))
+			if tc.wantErr {
+				assert.Error(err)
+				return
+			}
+			assert.NoError(err)
+			assert.EqualValues(len(data), size)
+		})
+	}
+}
@@ -0,0 +1,167 @@
+/*
+Copyright (c) Edgeless Systems GmbH
+
+SPDX-License-Identifier: BUSL-1.1
+*/
+
+package router
+
+import (
+	"context"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"log/slog"
+	"strconv"
+
+	"github.com/edgelesssys/constellation/v2/s3proxy/internal/crypto"
+)
+
+const (
+	// kekVersionTag is the name of the header that holds the version of the KEK that wrapped the object's DEK.
+	// Objects without this header were written before KEK rotation was supported and use version 1.
+	kekVersionTag = "constellation-kek-version"
+	// legacyKEKVersion is reported for DEKs that are wrapped with legacyKEK.
+	legacyKEKVersion = 0
+)
+
+// keyring holds all versions of the key encryption key (KEK) that s3proxy knows about.
+// New DEKs are wrapped with the latest version, while DEKs wrapped with any known version can be unwrapped.
+type keyring struct {
+	keks   map[uint32][32]byte
+	latest uint32
+	// allowLegacyKEK enables unwrapping DEKs with legacyKEK. It is only meant for migrating objects
+	// written by earlier versions of s3proxy with RewrapBucket, and will be removed in a future release.
+	allowLegacyKEK bool
+	log            *slog.Logger
+}
+
+// newKeyring creates a keyring holding the given KEK versions.
+func newKeyring(keks map[uint32][32]byte) (keyring, error) {
+	if len(keks) == 0 {
+		return keyring{}, errors.New("at least one KEK is required")
+	}
+
+	var latest uint32
+	for version := range keks {
+		if version == legacyKEKVersion {
+			return keyring{}, fmt.Errorf("invalid KEK version %d", version)
+		}
+		latest = max(latest, version)
+	}
+	return keyring{keks: keks, latest: latest}, nil
+}
+
+// fetchKeyring fetches the KEK versions from oldest to latest from the keyservice.
+func fetchKeyring(ctx context.Context, kms kmsClient, oldest, latest uint32) (keyring, error) {
+	if oldest == legacyKEKVersion || oldest > latest {
+		return keyring{}, fmt.Errorf("invalid KEK version range %d to %d", oldest, latest)
+	}
+
+	keks := make(map[uint32][32]byte)
+	for version := oldest; version <= latest; version++ {
+		kek, err := kms.GetDataKey(ctx, kekID(version), kekSizeBytes)
+		if err != nil {
+			return keyring{}, fmt.Errorf("getting KEK version %d: %w", version, err)
+		}
+		keks[version], err = byteSliceToByteArray(kek)
+		if err != nil {
+			return keyring{}, fmt.Errorf("converting KEK version %d to byte array: %w", version, err)
+		}
+	}
+	return newKeyring(keks)
+}
+
+// withLegacyKEK returns a copy of the keyring that falls back to legacyKEK for DEKs that can't be unwrapped otherwise.
+// Every use of the fallback is logged.
+func (k keyring) withLegacyKEK(log *slog.Logger) keyring {
+	k.allowLegacyKEK = true
+	k.log = log
+	return k
+}
+
+// kekID returns the ID under which the given KEK version is derived by the keyservice.
+// Version 1 uses the ID of the single KEK used before KEK rotation was supported.
+func kekID(version uint32) string {
+	if version == 1 {
+		return kekBaseID
+	}
+	return fmt.Sprintf("%s-v%d", kekBaseID, version)
+}
+
+// generateDEK generates a new DEK and attaches it, wrapped with the latest KEK, to the given object metadata.
+func (k keyring) generateDEK(metadata map[string]string) ([]byte, error) {
+	dek, encryptedDEK, err := crypto.GenerateDEK(k.keks[k.latest])
+	if err != nil {
+		return nil, err
+	}
+	metadata[dekTag] = hex.EncodeToString(encryptedDEK)
+	metadata[kekVersionTag] = strconv.FormatUint(uint64(k.latest), 10)
+	return dek, nil
+}
+
+// unwrapDEK unwraps the DEK attached to an object's metadata.
+// It returns the DEK and the version of the KEK that wrapped it.
+func (k keyring) unwrapDEK(metadata map[string]string) (dek []byte, version uint32, err error) {
+	encryptedDEK, err := hex.DecodeString(metadata[dekTag])
+	if err != nil {
+		return nil, 0, fmt.Errorf("decoding DEK: %w", err)
+	}
+
+	version = 1
+	rawVersion, hasVersion := metadata[kekVersionTag]
+	if hasVersion {
+		parsed, err := strconv.ParseUint(rawVersion, 10, 32)
+		if err != nil || parsed == legacyKEKVersion {
+			return nil, 0, fmt.Errorf("invalid KEK version %q", rawVersion)
+		}
+		version = uint32(parsed)
+	}
+
+	kek, ok := k.keks[version]
+	if !ok {
+		err = fmt.Errorf("KEK version %d is not available", version)
+	} else if dek, err = crypto.UnwrapDEK(encryptedDEK, kek); err == nil {
+		return dek, version, nil
+	}
+
+	// Earlier versions of s3proxy did not pass the KEK to the request handlers and wrapped all DEKs with the zero key.
+	// Those versions only wrote the legacy formats and no KEK version.
+	// Since anyone with write access to the bucket can wrap DEKs with the zero key, the fallback has to be enabled explicitly.
+	if format := metadata[formatTag]; k.allowLegacyKEK && !hasVersion && format != streamFormat && format != multipartStreamFormat {
+		if dek, legacyErr := crypto.UnwrapDEK(encryptedDEK, legacyKEK); legacyErr == nil {
+			k.log.Warn("Unwrapped DEK with the legacy all-zero KEK, rewrap the bucket and disable the legacy KEK afterwards")
+			return dek, legacyKEKVersion, nil
+		}
+	}
+	return nil, 0, err
+}
+
+// rewrapDEK wraps the DEK attached to an object's metadata with the latest KEK.
+// It returns the updated metadata and whether the DEK had to be rewrapped.
+func (k keyring) rewrapDEK(metadata map[string]string) (map[string]string, bool, error) {
+	dek, version, err := k.unwrapDEK(metadata)
+	if err != nil {
+		return nil, false, err
+	}
+	if version == k.latest {
+		return metadata, false, nil
+	}
+
+	encryptedDEK, err := crypto.WrapDEK(dek, k.keks[k.latest])
+	if err != nil {
+		return nil, false, err
+	}
+
+	rewrapped := make(map[string]string, len(metadata)+1)
+	for key, value := range metadata {
+		rewrapped[key] = value
+	}
+	rewrapped[dekTag] = hex.EncodeToString(encryptedDEK)
+	rewrapped[kekVersionTag] = strconv.FormatUint(uint64(k.latest), 10)
+	return rewrapped, true, nil
+}
+
+type kmsClient interface {
+	GetDataKey(ctx context.Context, keyID string, length int) ([]byte, error)
+}
@@ -0,0 +1,218 @@
+/*
+Copyright (c) Edgeless Systems GmbH
+
+SPDX-License-Identifier: BUSL-1.1
+*/
+
+package router
+
+import (
+	"context"
+	"encoding/hex"
+	"errors"
+	"testing"
+
+	"github.com/edgelesssys/constellation/v2/internal/logger"
+	"github.com/edgelesssys/constellation/v2/s3proxy/internal/crypto"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestFetchKeyring(t *testing.T) {
+	testCases := map[string]struct {
+		oldest, latest uint32
+		kms            *stubKMS
+		wantIDs        []string
+		wantErr        bool
+	}{
+		"single version": {
+			oldest:  1,
+			latest:  1,
+			kms:     &stubKMS{},
+			wantIDs: []string{"s3proxy-kek"},
+		},
+		"multiple versions": {
+			oldest:  2,
+			latest:  4,
+			kms:     &stubKMS{},
+			wantIDs: []string{"s3proxy-kek-v2", "s3proxy-kek-v3", "s3proxy-kek-v4"},
+		},
+		"version zero": {
+			oldest:  0,
+			latest:  1,
+			kms:     &stubKMS{},
+			wantErr: true,
+		},
+		"oldest after latest": {
+			oldest:  2,
+			latest:  1,
+			kms:     &stubKMS{},
+			wantErr: true,
+		},
+		"kms error": {
+			oldest:  1,
+			latest:  2,
+			kms:     &stubKMS{err: errors.New("failed")},
+			wantErr: true,
+		},
+	}
+
+	for name, tc := range testCases {
+		t.Run(name, func(t *testing.T) {
+			assert := assert.New(t)
+
+			keys, err := fetchKeyring(context.Background(), tc.kms, tc.oldest, tc.latest)
+			if tc.wantErr {
+				assert.Error(err)
+				return
+			}
+			assert.NoError(err)
+			assert.Equal(tc.wantIDs, tc.kms.requestedIDs)
+			assert.Equal(tc.latest, keys.latest)
+			assert.Len(keys.keks, len(tc.wantIDs))
+		})
+	}
+}
+
+func TestUnwrapDEK(t *testing.T) {
+	kekV1, kekV2 := [32]byte{0x01}, [32]byte{0x02}
+	keys, err := newKeyring(map[uint32][32]byte{1: kekV1, 2: kekV2})
+	require.NoError(t, err)
+
+	wrap := func(t *testing.T, kek [32]byte, metadata map[string]string) ([]byte, map[string]string) {
+		dek, encryptedDEK, err := crypto.GenerateDEK(kek)
+		require.NoError(t, err)
+		metadata[dekTag] = hex.EncodeToString(encryptedDEK)
+		return dek, metadata
+	}
+
+	testCases := map[string]struct {
+		kek            [32]byte
+		metadata       map[string]string
+		allowLegacyKEK bool
+		wantVersion    uint32
+		wantErr        bool
+	}{
+		"latest version": {
+			kek:         kekV2,
+			metadata:    map[string]string{kekVersionTag: "2", formatTag: streamFormat},
+			wantVersion: 2,
+		},
+		"older version": {
+			kek:         kekV1,
+			metadata:    map[string]string{kekVersionTag: "1", formatTag: streamFormat},
+			wantVersion: 1,
+		},
+		"no version": {
+			kek:         kekV1,
+			metadata:    map[string]string{formatTag: streamFormat},
+			wantVersion: 1,
+		},
+		"legacy KEK": {
+			kek:            legacyKEK,
+			metadata:       map[string]string{},
+			allowLegacyKEK: true,
+			wantVersion:    legacyKEKVersion,
+		},
+		"legacy KEK not allowed": {
+			kek:      legacyKEK,
+			metadata: map[string]string{},
+			wantErr:  true,
+		},
+		"legacy KEK with stream format": {
+			kek:            legacyKEK,
+			metadata:       map[string]string{formatTag: streamFormat},
+			allowLegacyKEK: true,
+			wantErr:        true,
+		},
+		"legacy KEK with version": {
+			kek:            legacyKEK,
+			metadata:       map[string]string{kekVersionTag: "1"},
+			allowLegacyKEK: true,
+			wantErr:        true,
+		},
+		"wrong version": {
+			kek:      kekV1,
+			metadata: map[string]string{kekVersionTag: "2", formatTag: streamFormat},
+			wantErr:  true,
+		},
+		"unknown version": {
+			kek:      [32]byte{0x03},
+			metadata: map[string]string{kekVersionTag: "3", formatTag: streamFormat},
+			wantErr:  true,
+		},
+		"invalid version": {
+			kek:      kekV1,
+			metadata: map[string]string{kekVersionTag: "first"},
+			wantErr:  true,
+		},
+	}
+
+	for name, tc := range testCases {
+		t.Run(name, func(t *testing.T) {
+			assert := assert.New(t)
+
+			keys := keys
+			if tc.allowLegacyKEK {
+				keys = keys.withLegacyKEK(logger.NewTest(t))
+			}
+
+			wantDEK, metadata := wrap(t, tc.kek, tc.metadata)
+			dek, version, err := keys.unwrapDEK(metadata)
+			if tc.wantErr {
+				assert.Error(err)
+				return
+			}
+			assert.NoError(err)
+			assert.Equal(wantDEK, dek)
+			assert.Equal(tc.wantVersion, version)
+		})
+	}
+}
+
+func TestGenerateAndRewrapDEK(t *testing.T) {
+	assert := assert.New(t)
+	require := require.New(t)
+
+	oldKeys := newTestKeyring([32]byte{0x01})
+	metadata := map[string]string{"user": "data"}
+	dek, err := oldKeys.generateDEK(metadata)
+	require.NoError(err)
+	assert.Equal("1", metadata[kekVersionTag])
+
+	newKeys, err := newKeyring(map[uint32][32]byte{1: {0x01}, 2: {0x02}})
+	require.NoError(err)
+	rewrapped, ok, err := newKeys.rewrapDEK(metadata)
+	require.NoError(err)
+	assert.True(ok)
+	assert.Equal("2", rewrapped[kekVersionTag])
+	assert.Equal("data", rewrapped["user"])
+	assert.NotEqual(metadata[dekTag], rewrapped[dekTag])
+
+	// The DEK can be unwrapped without the old KEK.
+	latestKeys, err := newKeyring(map[uint32][32]byte{2: {0x02}})
+	require.NoError(err)
+	rewrappedDEK, version, err := latestKeys.unwrapDEK(rewrapped)
+	require.NoError(err)
+	assert.Equal(dek, rewrappedDEK)
+	assert.EqualValues(2, version)
+
+	_, ok, err = latestKeys.rewrapDEK(rewrapped)
+	require.NoError(err)
+	assert.False(ok)
+}
+
+// newTestKeyring returns a keyring holding the given KEK as version 1.
+func newTestKeyring(kek [32]byte) keyring {
+	return keyring{keks: map[uint32][32]byte{1: kek}, latest: 1}
+}
+
+type stubKMS struct {
+	requestedIDs []string
+	err          error
+}
+
+func (k *stubKMS) GetDataKey(_ context.Context, keyID string, length int) ([]byte, error) {
+	k.requestedIDs = append(k.requestedIDs, keyID)
+	return make([]byte, length), k.err
+}
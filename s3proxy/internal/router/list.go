@@ -0,0 +1,255 @@
+/*
+Copyright (c) Edgeless Systems GmbH
+
+SPDX-License-Identifier: BUSL-1.1
+*/
+
+package router
+
+import (
+	"bytes"
+	"context"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+	"net/url"
+	"regexp"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// listConcurrency is the maximum number of objects whose size is determined in parallel during a ListObjects request.
+const listConcurrency = 16
+
+var (
+	listContentsPattern       = regexp.MustCompile(`(?s)<Contents>.*?</Contents>`)
+	listCommonPrefixesPattern = regexp.MustCompile(`(?s)<CommonPrefixes>.*?</CommonPrefixes>`)
+	listKeyPattern            = regexp.MustCompile(`<Key>(.*?)</Key>`)
+	listPrefixPattern         = regexp.MustCompile(`<Prefix>(.*?)</Prefix>`)
+	listETagPattern           = regexp.MustCompile(`<ETag>(.*?)</ETag>`)
+	listSizePattern           = regexp.MustCompile(`<Size>(\d+)</Size>`)
+	listKeyCountPattern       = regexp.MustCompile(`<KeyCount>(\d+)</KeyCount>`)
+)
+
+// listObjects is a http.HandlerFunc that implements ListObjects and ListObjectsV2.
+// The request is forwarded to S3. In the response, the sizes of encrypted objects are replaced with their plaintext sizes,
+// and the objects s3proxy stores for itself are removed.
+// S3 doesn't return the metadata of objects in listings, so the metadata of each listed object is requested separately.
+// Plaintext sizes are cached by ETag, so that listing the same objects again doesn't cause additional requests.
+func (o object) listObjects(w http.ResponseWriter, r *http.Request) {
+	o.log.With(slog.String("host", o.bucket)).Debug("listObjects")
+
+	resp, err := forward(o.client, r)
+	if err != nil {
+		o.log.With(slog.Any("error", err)).Error("ListObjects sending request to S3")
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	defer resp.Body.Close()
+
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		o.log.With(slog.Any("error", err)).Error("ListObjects reading S3 response")
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	if resp.StatusCode == http.StatusOK {
+		body, err = o.rewriteListing(r.Context(), body, o.query.Get("encoding-type") == "url")
+		if err != nil {
+			o.log.With(slog.Any("error", err)).Error("ListObjects rewriting listing")
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+	}
+
+	for key := range resp.Header {
+		w.Header().Set(key, resp.Header.Get(key))
+	}
+	w.Header().Set("Content-Length", strconv.Itoa(len(body)))
+	w.WriteHeader(resp.StatusCode)
+	if _, err := w.Write(body); err != nil {
+		o.log.With(slog.Any("error", err)).Error("ListObjects sending response")
+	}
+}
+
+// listedObject is an object in a ListObjects response.
+type listedObject struct {
+	key  string
+	etag string
+	size int64
+}
+
+// listingEdit replaces the bytes from start to end of a ListObjects response.
+type listingEdit struct {
+	start, end  int
+	replacement []byte
+}
+
+// rewriteListing replaces the size of each object in a ListObjects response with its plaintext size,
+// and removes the objects and common prefixes below internalPrefix.
+// If urlEncoded is true, the object keys and prefixes in the response are URL-encoded.
+// If the plaintext size of an object can't be determined, e.g., because it was changed or deleted while listing it,
+// the error is logged and the size reported by S3 is kept.
+func (o object) rewriteListing(ctx context.Context, body []byte, urlEncoded bool) ([]byte, error) {
+	var edits []listingEdit
+	var objects []listedObject
+	var objectEntries [][]int
+	for _, entry := range listContentsPattern.FindAllIndex(body, -1) {
+		listed, err := parseListedObject(body[entry[0]:entry[1]], urlEncoded)
+		if err != nil {
+			return nil, err
+		}
+		if strings.HasPrefix(listed.key, internalPrefix) {
+			edits = append(edits, listingEdit{start: entry[0], end: entry[1]})
+			continue
+		}
+		objects = append(objects, listed)
+		objectEntries = append(objectEntries, entry)
+	}
+	for _, entry := range listCommonPrefixesPattern.FindAllIndex(body, -1) {
+		prefix, err := parseListedPrefix(body[entry[0]:entry[1]], urlEncoded)
+		if err != nil {
+			return nil, err
+		}
+		if strings.HasPrefix(prefix, internalPrefix) {
+			edits = append(edits, listingEdit{start: entry[0], end: entry[1]})
+		}
+	}
+	hidden := len(edits)
+
+	var wg sync.WaitGroup
+	semaphore := make(chan struct{}, listConcurrency)
+	sizes := make([]int64, len(objects))
+	for i, listed := range objects {
+		wg.Add(1)
+		semaphore <- struct{}{}
+		go func() {
+			defer wg.Done()
+			defer func() { <-semaphore }()
+
+			size, err := o.listedPlaintextSize(ctx, listed)
+			if err != nil {
+				o.log.With(slog.String("key", listed.key), slog.Any("error", err)).Warn("ListObjects determining plaintext size, keeping listed size")
+				size = listed.size
+			}
+			sizes[i] = size
+		}()
+	}
+	wg.Wait()
+
+	for i, entry := range objectEntries {
+		edits = append(edits, listingEdit{
+			start:       entry[0],
+			end:         entry[1],
+			replacement: listSizePattern.ReplaceAllLiteral(body[entry[0]:entry[1]], []byte("<Size>"+strconv.FormatInt(sizes[i], 10)+"</Size>")),
+		})
+	}
+	if keyCount := listKeyCountPattern.FindSubmatchIndex(body); keyCount != nil && hidden > 0 {
+		count, err := strconv.Atoi(string(body[keyCount[2]:keyCount[3]]))
+		if err != nil {
+			return nil, fmt.Errorf("parsing key count: %w", err)
+		}
+		edits = append(edits, listingEdit{
+			start:       keyCount[0],
+			end:         keyCount[1],
+			replacement: []byte("<KeyCount>" + strconv.Itoa(max(count-hidden, 0)) + "</KeyCount>"),
+		})
+	}
+	slices.SortFunc(edits, func(a, b listingEdit) int { return a.start - b.start })
+
+	var result bytes.Buffer
+	var last int
+	for _, edit := range edits {
+		result.Write(body[last:edit.start])
+		result.Write(edit.replacement)
+		last = edit.end
+	}
+	result.Write(body[last:])
+	return result.Bytes(), nil
+}
+
+// listedPlaintextSize returns the plaintext size of a listed object.
+func (o object) listedPlaintextSize(ctx context.Context, listed listedObject) (int64, error) {
+	version := objectVersion{bucket: o.bucket, key: listed.key, etag: listed.etag}
+	if size, ok := o.sizes.get(version); ok {
+		return size, nil
+	}
+
+	head, err := o.client.HeadObject(ctx, o.bucket, listed.key, "", "", "", "")
+	if err != nil {
+		return 0, err
+	}
+	if head.ETag == nil || *head.ETag != listed.etag || head.ContentLength == nil {
+		return 0, errors.New("object changed while listing it")
+	}
+
+	size, err := o.plaintextSize(head.Metadata, *head.ContentLength)
+	if err != nil {
+		return 0, err
+	}
+	o.sizes.put(version, size)
+	return size, nil
+}
+
+// parseListedObject parses a Contents element of a ListObjects response.
+func parseListedObject(entry []byte, urlEncoded bool) (listedObject, error) {
+	key := listKeyPattern.FindSubmatch(entry)
+	etag := listETagPattern.FindSubmatch(entry)
+	size := listSizePattern.FindSubmatch(entry)
+	if key == nil || etag == nil || size == nil {
+		return listedObject{}, fmt.Errorf("malformed object in listing: %s", entry)
+	}
+
+	var listed listedObject
+	var err error
+	if listed.key, err = xmlUnescape(key[1]); err != nil {
+		return listedObject{}, fmt.Errorf("parsing object key: %w", err)
+	}
+	if urlEncoded {
+		if listed.key, err = url.QueryUnescape(listed.key); err != nil {
+			return listedObject{}, fmt.Errorf("parsing object key: %w", err)
+		}
+	}
+	if listed.etag, err = xmlUnescape(etag[1]); err != nil {
+		return listedObject{}, fmt.Errorf("parsing object ETag: %w", err)
+	}
+	if listed.size, err = strconv.ParseInt(string(size[1]), 10, 64); err != nil {
+		return listedObject{}, fmt.Errorf("parsing object size: %w", err)
+	}
+	return listed, nil
+}
+
+// parseListedPrefix parses a CommonPrefixes element of a ListObjects response.
+func parseListedPrefix(entry []byte, urlEncoded bool) (string, error) {
+	match := listPrefixPattern.FindSubmatch(entry)
+	if match == nil {
+		return "", fmt.Errorf("malformed common prefix in listing: %s", entry)
+	}
+	prefix, err := xmlUnescape(match[1])
+	if err != nil {
+		return "", fmt.Errorf("parsing common prefix: %w", err)
+	}
+	if urlEncoded {
+		if prefix, err = url.QueryUnescape(prefix); err != nil {
+			return "", fmt.Errorf("parsing common prefix: %w", err)
+		}
+	}
+	return prefix, nil
+}
+
+// xmlUnescape returns the text represented by the character data of an XML element.
+func xmlUnescape(data []byte) (string, error) {
+	var element struct {
+		Text string `xml:",chardata"`
+	}
+	if err := xml.Unmarshal([]byte("<e>"+string(data)+"</e>"), &element); err != nil {
+		return "", err
+	}
+	return element.Text, nil
+}
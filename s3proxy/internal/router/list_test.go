@@ -0,0 +1,148 @@
+/*
+Copyright (c) Edgeless Systems GmbH
+
+SPDX-License-Identifier: BUSL-1.1
+*/
+
+package router
+
+import (
+	"fmt"
+	"net/url"
+	"strings"
+	"testing"
+
+	"github.com/edgelesssys/constellation/v2/internal/logger"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestRewriteListing(t *testing.T) {
+	keys := newTestKeyring([32]byte{0x01})
+
+	listing := func(client *stubS3Client, listedKeys, commonPrefixes []string, encodedKeys map[string]string) string {
+		result := `<?xml version="1.0" encoding="UTF-8"?>` + "\n" +
+			fmt.Sprintf(`<ListBucketResult xmlns="http://s3.amazonaws.com/doc/2006-03-01/"><Name>bucket</Name><KeyCount>%d</KeyCount>`, len(listedKeys)+len(commonPrefixes))
+		for _, key := range listedKeys {
+			body := client.objects["bucket/"+key]
+			etag := strings.ReplaceAll(stubETag(body), `"`, "&quot;")
+			if key == "unknown" {
+				body, etag = make([]byte, 42), "&quot;0&quot;"
+			}
+			encodedKey := key
+			if encoded, ok := encodedKeys[key]; ok {
+				encodedKey = encoded
+			}
+			result += fmt.Sprintf("<Contents><Key>%s</Key><LastModified>2024-01-01T00:00:00.000Z</LastModified><ETag>%s</ETag><Size>%d</Size><StorageClass>STANDARD</StorageClass></Contents>",
+				encodedKey, etag, len(body))
+		}
+		for _, prefix := range commonPrefixes {
+			result += fmt.Sprintf("<CommonPrefixes><Prefix>%s</Prefix></CommonPrefixes>", prefix)
+		}
+		return result + "</ListBucketResult>"
+	}
+
+	testCases := map[string]struct {
+		listedKeys     []string
+		commonPrefixes []string
+		encodedKeys    map[string]string
+		urlEncoded     bool
+		failingKeys    map[string]bool
+		wantSizes      func(client *stubS3Client) []int
+		wantKeyCount   int
+		wantCached     int
+	}{
+		"xml escaped keys": {
+			listedKeys:   []string{"a&b", "plain"},
+			encodedKeys:  map[string]string{"a&b": "a&amp;b"},
+			wantKeyCount: 2,
+			wantCached:   2,
+		},
+		"url encoded keys": {
+			listedKeys:   []string{"a&b", "plain"},
+			encodedKeys:  map[string]string{"a&b": "a%26b"},
+			urlEncoded:   true,
+			wantKeyCount: 2,
+			wantCached:   2,
+		},
+		"object was deleted or changed while listing it": {
+			encodedKeys:  map[string]string{"a&b": "a&amp;b"},
+			listedKeys:   []string{"a&b", "plain", "unknown"},
+			wantSizes:    func(*stubS3Client) []int { return []int{42} },
+			wantKeyCount: 3,
+			wantCached:   2,
+		},
+		"object can't be inspected": {
+			encodedKeys: map[string]string{"a&b": "a&amp;b"},
+			listedKeys:  []string{"a&b", "plain"},
+			failingKeys: map[string]bool{"a&b": true},
+			wantSizes: func(client *stubS3Client) []int {
+				return []int{len(client.objects["bucket/a&b"])}
+			},
+			wantKeyCount: 2,
+			wantCached:   1,
+		},
+		"internal objects are hidden": {
+			encodedKeys:    map[string]string{"a&b": "a&amp;b"},
+			listedKeys:     []string{"a&b", uploadObjectKey("upload-id"), "plain"},
+			commonPrefixes: []string{internalPrefix, "dir/"},
+			wantKeyCount:   3,
+			wantCached:     2,
+		},
+		"url encoded internal objects are hidden": {
+			encodedKeys:    map[string]string{"a&b": "a%26b", uploadObjectKey("upload-id"): url.QueryEscape(uploadObjectKey("upload-id"))},
+			listedKeys:     []string{"a&b", uploadObjectKey("upload-id"), "plain"},
+			commonPrefixes: []string{url.QueryEscape(internalPrefix), "dir%2F"},
+			urlEncoded:     true,
+			wantKeyCount:   3,
+			wantCached:     2,
+		},
+	}
+
+	for name, tc := range testCases {
+		t.Run(name, func(t *testing.T) {
+			assert := assert.New(t)
+			require := require.New(t)
+
+			client := newStubS3Client()
+			putTestObject(t, client, keys, "a&b")
+			client.objects["bucket/plain"] = []byte("plaintext")
+			client.metadata["bucket/plain"] = map[string]string{}
+			client.failingKeys = tc.failingKeys
+			obj := object{
+				keys:   keys,
+				client: client,
+				bucket: "bucket",
+				sizes:  newObjectCache[int64](),
+				log:    logger.NewTest(t),
+			}
+
+			body := listing(client, tc.listedKeys, tc.commonPrefixes, tc.encodedKeys)
+			rewritten, err := obj.rewriteListing(t.Context(), []byte(body), tc.urlEncoded)
+			require.NoError(err)
+			assert.Contains(string(rewritten), fmt.Sprintf("<KeyCount>%d</KeyCount>", tc.wantKeyCount))
+			assert.Contains(string(rewritten), "<Key>"+tc.encodedKeys["a&b"]+"</Key><LastModified>2024-01-01T00:00:00.000Z</LastModified><ETag>")
+			assert.Contains(string(rewritten), fmt.Sprintf("<Size>%d</Size>", len("plaintext")))
+			wantSizes := []int{len("hello, world")}
+			if tc.wantSizes != nil {
+				wantSizes = tc.wantSizes(client)
+			}
+			for _, size := range wantSizes {
+				assert.Contains(string(rewritten), fmt.Sprintf("<Size>%d</Size>", size))
+			}
+			assert.NotContains(string(rewritten), "constellation-s3proxy")
+			for _, prefix := range tc.commonPrefixes {
+				if !strings.Contains(prefix, "constellation-s3proxy") {
+					assert.Contains(string(rewritten), "<Prefix>"+prefix+"</Prefix>")
+				}
+			}
+			assert.Len(obj.sizes.entries, tc.wantCached)
+
+			// Cached sizes don't require further requests.
+			obj.client = newStubS3Client()
+			cached, err := obj.rewriteListing(t.Context(), []byte(body), tc.urlEncoded)
+			require.NoError(err)
+			assert.Equal(rewritten, cached)
+		})
+	}
+}
@@ -0,0 +1,503 @@
+/*
+Copyright (c) Edgeless Systems GmbH
+
+SPDX-License-Identifier: BUSL-1.1
+*/
+
+package router
+
+import (
+	"bytes"
+	"context"
+	"encoding/base64"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"log/slog"
+	"maps"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/service/s3"
+	"github.com/aws/aws-sdk-go-v2/service/s3/types"
+	"github.com/edgelesssys/constellation/v2/s3proxy/internal/crypto"
+)
+
+// uploadTTL is the time after which the state of an unfinished multipart upload is dropped from memory.
+// It matches the maximum time we expect clients to take between creating and completing an upload.
+const uploadTTL = 7 * 24 * time.Hour
+
+const (
+	// internalPrefix is the prefix of the objects s3proxy stores for itself in a bucket.
+	// The objects are hidden from listings and aren't rewrapped.
+	internalPrefix = ".constellation-s3proxy/"
+	// uploadPrefix is the prefix of the objects that hold the wrapped DEKs of multipart uploads in progress.
+	// The objects are deleted when their upload is completed or aborted.
+	uploadPrefix = internalPrefix + "uploads/"
+	// uploadKeyTag is the name of the header of an upload's object that holds the base64 encoded key of the object being uploaded.
+	// It ties the upload's DEK to that object, so that it is never used for requests of other objects.
+	uploadKeyTag = "constellation-upload-key"
+)
+
+var (
+	// errNoSuchUpload is returned for requests that belong to an unknown multipart upload.
+	errNoSuchUpload = errors.New("the specified multipart upload does not exist")
+	// errInvalidPart is returned if the parts listed in a CompleteMultipartUpload request can't be assembled.
+	errInvalidPart = errors.New("invalid part list")
+)
+
+// uploadStore caches the DEKs of multipart uploads that are in progress.
+// Each part of an upload has to be encrypted with the upload's DEK, but S3 does not return the metadata of unfinished uploads.
+// The wrapped DEK is therefore stored in a separate object in the bucket, see uploadObjectKey.
+// The cache saves fetching and unwrapping it for every part, while any s3proxy instance can continue an upload.
+type uploadStore struct {
+	mux     sync.Mutex
+	uploads map[uploadKey]uploadState
+	now     func() time.Time
+}
+
+type uploadKey struct {
+	bucket   string
+	key      string
+	uploadID string
+}
+
+type uploadState struct {
+	dek     []byte
+	created time.Time
+}
+
+func newUploadStore() *uploadStore {
+	return &uploadStore{
+		uploads: map[uploadKey]uploadState{},
+		now:     time.Now,
+	}
+}
+
+// put saves the DEK for the given upload and drops the state of expired uploads.
+func (s *uploadStore) put(bucket, key, uploadID string, dek []byte) {
+	s.mux.Lock()
+	defer s.mux.Unlock()
+
+	now := s.now()
+	for k, state := range s.uploads {
+		if now.Sub(state.created) > uploadTTL {
+			delete(s.uploads, k)
+		}
+	}
+
+	s.uploads[uploadKey{bucket: bucket, key: key, uploadID: uploadID}] = uploadState{dek: dek, created: now}
+}
+
+// get returns the DEK for the given upload.
+func (s *uploadStore) get(bucket, key, uploadID string) ([]byte, bool) {
+	s.mux.Lock()
+	defer s.mux.Unlock()
+
+	state, ok := s.uploads[uploadKey{bucket: bucket, key: key, uploadID: uploadID}]
+	if !ok || s.now().Sub(state.created) > uploadTTL {
+		return nil, false
+	}
+	return state.dek, true
+}
+
+// delete drops the state of the given upload.
+func (s *uploadStore) delete(bucket, key, uploadID string) {
+	s.mux.Lock()
+	defer s.mux.Unlock()
+
+	delete(s.uploads, uploadKey{bucket: bucket, key: key, uploadID: uploadID})
+}
+
+// initiateMultipartUploadResult is the XML response to a CreateMultipartUpload request.
+type initiateMultipartUploadResult struct {
+	XMLName  xml.Name `xml:"http://s3.amazonaws.com/doc/2006-03-01/ InitiateMultipartUploadResult"`
+	Bucket   string   `xml:"Bucket"`
+	Key      string   `xml:"Key"`
+	UploadID string   `xml:"UploadId"`
+}
+
+// completeMultipartUpload is the XML body of a CompleteMultipartUpload request.
+type completeMultipartUpload struct {
+	XMLName xml.Name        `xml:"CompleteMultipartUpload"`
+	Parts   []completedPart `xml:"Part"`
+}
+
+// completedPart references an uploaded part.
+// Checksums sent by the client are ignored, as they were calculated over the plaintext and can't be verified by S3.
+type completedPart struct {
+	ETag       string `xml:"ETag"`
+	PartNumber int32  `xml:"PartNumber"`
+}
+
+// completeMultipartUploadResult is the XML response to a CompleteMultipartUpload request.
+type completeMultipartUploadResult struct {
+	XMLName  xml.Name `xml:"http://s3.amazonaws.com/doc/2006-03-01/ CompleteMultipartUploadResult"`
+	Location string   `xml:"Location"`
+	Bucket   string   `xml:"Bucket"`
+	Key      string   `xml:"Key"`
+	ETag     string   `xml:"ETag"`
+}
+
+// uploadObjectKey returns the key of the object that holds the wrapped DEK of the given upload.
+func uploadObjectKey(uploadID string) string {
+	return uploadPrefix + uploadID
+}
+
+// uploadDEK returns the DEK of the multipart upload the request belongs to.
+// If the DEK isn't cached, it is unwrapped from the upload's object.
+// errNoSuchUpload is returned if that object doesn't exist or belongs to an upload of another object.
+func (o object) uploadDEK(ctx context.Context) ([]byte, error) {
+	if dek, ok := o.uploads.get(o.bucket, o.key, o.uploadID); ok {
+		return dek, nil
+	}
+
+	head, err := o.client.HeadObject(ctx, o.bucket, uploadObjectKey(o.uploadID), "", "", "", "")
+	if err != nil {
+		if parseErrorCode(err) == http.StatusNotFound {
+			return nil, errNoSuchUpload
+		}
+		return nil, fmt.Errorf("getting DEK of upload: %w", err)
+	}
+	if head.Metadata[uploadKeyTag] != base64.StdEncoding.EncodeToString([]byte(o.key)) {
+		return nil, errNoSuchUpload
+	}
+	dek, _, err := o.keys.unwrapDEK(head.Metadata)
+	if err != nil {
+		return nil, fmt.Errorf("unwrapping DEK of upload: %w", err)
+	}
+
+	o.uploads.put(o.bucket, o.key, o.uploadID, dek)
+	return dek, nil
+}
+
+// deleteUploadObject deletes the object holding the wrapped DEK of the upload the request belongs to.
+// Failures are only logged, since the upload itself is already completed or aborted.
+func (o object) deleteUploadObject(ctx context.Context) {
+	o.uploads.delete(o.bucket, o.key, o.uploadID)
+	if _, err := o.client.DeleteObject(ctx, o.bucket, uploadObjectKey(o.uploadID), ""); err != nil {
+		o.log.With(slog.String("uploadID", o.uploadID), slog.Any("error", err)).Warn("Deleting DEK of finished multipart upload")
+	}
+}
+
+// createMultipartUpload is a http.HandlerFunc that implements CreateMultipartUpload.
+// A new DEK is generated for the upload. The encrypted DEK is attached to the object's metadata,
+// and stored in a separate object until the upload is completed or aborted, so that it can be used to encrypt the parts.
+func (o object) createMultipartUpload(w http.ResponseWriter, r *http.Request) {
+	o.log.With(slog.String("key", o.key), slog.String("host", o.bucket)).Debug("createMultipartUpload")
+
+	dek, err := o.keys.generateDEK(o.metadata)
+	if err != nil {
+		o.log.With(slog.Any("error", err)).Error("CreateMultipartUpload")
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	o.metadata[formatTag] = multipartStreamFormat
+
+	output, err := o.client.CreateMultipartUpload(r.Context(), o.bucket, o.key, o.tags, o.contentType, o.objectLockLegalHoldStatus, o.objectLockMode, o.sseCustomerAlgorithm, o.sseCustomerKey, o.sseCustomerKeyMD5, o.objectLockRetainUntilDate, o.metadata)
+	if err != nil {
+		o.log.With(slog.Any("error", err)).Error("CreateMultipartUpload sending request to S3")
+		writeS3Error(w, err)
+		return
+	}
+	if output.UploadId == nil {
+		o.log.Error("CreateMultipartUpload response is missing the upload ID")
+		http.Error(w, "S3 response is missing the upload ID", http.StatusInternalServerError)
+		return
+	}
+
+	uploadMetadata := map[string]string{
+		dekTag:        o.metadata[dekTag],
+		kekVersionTag: o.metadata[kekVersionTag],
+		uploadKeyTag:  base64.StdEncoding.EncodeToString([]byte(o.key)),
+	}
+	if _, err := o.client.PutObject(r.Context(), o.bucket, uploadObjectKey(*output.UploadId), "", "", "", "", "", "", "", time.Time{}, uploadMetadata, bytes.NewReader(nil), 0); err != nil {
+		o.log.With(slog.Any("error", err)).Error("CreateMultipartUpload storing DEK of upload")
+		if _, err := o.client.AbortMultipartUpload(r.Context(), o.bucket, o.key, *output.UploadId); err != nil {
+			o.log.With(slog.Any("error", err)).Error("CreateMultipartUpload aborting upload")
+		}
+		writeS3Error(w, err)
+		return
+	}
+	o.uploads.put(o.bucket, o.key, *output.UploadId, dek)
+
+	if output.AbortDate != nil {
+		w.Header().Set("x-amz-abort-date", output.AbortDate.Format(http.TimeFormat))
+	}
+	if output.AbortRuleId != nil {
+		w.Header().Set("x-amz-abort-rule-id", *output.AbortRuleId)
+	}
+	if output.SSECustomerAlgorithm != nil {
+		w.Header().Set("x-amz-server-side-encryption-customer-algorithm", *output.SSECustomerAlgorithm)
+	}
+	if output.SSECustomerKeyMD5 != nil {
+		w.Header().Set("x-amz-server-side-encryption-customer-key-MD5", *output.SSECustomerKeyMD5)
+	}
+
+	writeXML(w, initiateMultipartUploadResult{Bucket: o.bucket, Key: o.key, UploadID: *output.UploadId}, o.log)
+}
+
+// uploadPart is a http.HandlerFunc that implements UploadPart.
+// The part is encrypted with the DEK of its upload while it is streamed to S3.
+// It forms a frame of the stream format, using the part number as the frame number.
+func (o object) uploadPart(w http.ResponseWriter, r *http.Request) {
+	o.log.With(slog.String("key", o.key), slog.String("host", o.bucket), slog.Int("partNumber", int(o.partNumber))).Debug("uploadPart")
+
+	dek, err := o.uploadDEK(r.Context())
+	if errors.Is(err, errNoSuchUpload) {
+		o.log.With(slog.String("uploadID", o.uploadID)).Error("UploadPart for unknown upload")
+		http.Error(w, err.Error(), http.StatusNotFound)
+		return
+	}
+	if err != nil {
+		o.log.With(slog.Any("error", err)).Error("UploadPart")
+		writeS3Error(w, err)
+		return
+	}
+
+	ciphertext, err := crypto.NewEncryptingReader(o.body, o.contentLength, dek, uint32(o.partNumber))
+	if err != nil {
+		o.log.With(slog.Any("error", err)).Error("UploadPart")
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	output, err := o.client.UploadPart(r.Context(), o.bucket, o.key, o.uploadID, o.partNumber, o.sseCustomerAlgorithm, o.sseCustomerKey, o.sseCustomerKeyMD5, ciphertext, crypto.CiphertextSize(o.contentLength))
+	if err != nil {
+		if o.body.writeError(w, o.log) {
+			return
+		}
+		o.log.With(slog.Any("error", err)).Error("UploadPart sending request to S3")
+		writeS3Error(w, err)
+		return
+	}
+
+	if output.ETag != nil {
+		w.Header().Set("ETag", *output.ETag)
+	}
+	if output.ServerSideEncryption != "" {
+		w.Header().Set("x-amz-server-side-encryption", string(output.ServerSideEncryption))
+	}
+	if output.SSECustomerAlgorithm != nil {
+		w.Header().Set("x-amz-server-side-encryption-customer-algorithm", *output.SSECustomerAlgorithm)
+	}
+	if output.SSECustomerKeyMD5 != nil {
+		w.Header().Set("x-amz-server-side-encryption-customer-key-MD5", *output.SSECustomerKeyMD5)
+	}
+
+	w.WriteHeader(http.StatusOK)
+}
+
+// completeMultipartUpload is a http.HandlerFunc that implements CompleteMultipartUpload.
+// The ETags sent by the client belong to the encrypted parts, so the part list can be forwarded as is.
+// Once S3 assembled the object, the layout of its frames is sealed with the upload's DEK and added to its metadata.
+func (o object) completeMultipartUpload(w http.ResponseWriter, r *http.Request) {
+	o.log.With(slog.String("key", o.key), slog.String("host", o.bucket)).Debug("completeMultipartUpload")
+
+	var request completeMultipartUpload
+	if err := xml.Unmarshal(o.data, &request); err != nil {
+		o.log.With(slog.Any("error", err)).Error("CompleteMultipartUpload parsing request")
+		http.Error(w, "malformed CompleteMultipartUpload request", http.StatusBadRequest)
+		return
+	}
+
+	dek, err := o.uploadDEK(r.Context())
+	if errors.Is(err, errNoSuchUpload) {
+		o.log.With(slog.String("uploadID", o.uploadID)).Error("CompleteMultipartUpload for unknown upload")
+		http.Error(w, err.Error(), http.StatusNotFound)
+		return
+	}
+	if err != nil {
+		o.log.With(slog.Any("error", err)).Error("CompleteMultipartUpload")
+		writeS3Error(w, err)
+		return
+	}
+
+	layout, err := o.uploadLayout(r.Context(), request.Parts)
+	if errors.Is(err, errInvalidPart) {
+		o.log.With(slog.Any("error", err)).Error("CompleteMultipartUpload invalid part list")
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	if err != nil {
+		o.log.With(slog.Any("error", err)).Error("CompleteMultipartUpload listing parts")
+		writeS3Error(w, err)
+		return
+	}
+	sealedLayout, err := layout.Seal(dek)
+	if err != nil {
+		o.log.With(slog.Any("error", err)).Error("CompleteMultipartUpload sealing layout")
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	parts := make([]types.CompletedPart, 0, len(request.Parts))
+	for _, part := range request.Parts {
+		parts = append(parts, types.CompletedPart{
+			ETag:       &part.ETag,
+			PartNumber: &part.PartNumber,
+		})
+	}
+
+	output, err := o.client.CompleteMultipartUpload(r.Context(), o.bucket, o.key, o.uploadID, o.sseCustomerAlgorithm, o.sseCustomerKey, o.sseCustomerKeyMD5, parts)
+	if err != nil {
+		o.log.With(slog.Any("error", err)).Error("CompleteMultipartUpload sending request to S3")
+		writeS3Error(w, err)
+		return
+	}
+	o.deleteUploadObject(r.Context())
+
+	copied, err := o.addLayout(r.Context(), output, dek, sealedLayout)
+	if err != nil {
+		o.log.With(slog.Any("error", err)).Error("CompleteMultipartUpload adding layout to object")
+		writeS3Error(w, err)
+		return
+	}
+
+	if copied.VersionId != nil {
+		w.Header().Set("x-amz-version-id", *copied.VersionId)
+	}
+	if output.Expiration != nil {
+		w.Header().Set("x-amz-expiration", *output.Expiration)
+	}
+	if output.ServerSideEncryption != "" {
+		w.Header().Set("x-amz-server-side-encryption", string(output.ServerSideEncryption))
+	}
+
+	result := completeMultipartUploadResult{Bucket: o.bucket, Key: o.key}
+	if output.Location != nil {
+		result.Location = *output.Location
+	}
+	if copied.CopyObjectResult != nil && copied.CopyObjectResult.ETag != nil {
+		result.ETag = *copied.CopyObjectResult.ETag
+	}
+	writeXML(w, result, o.log)
+}
+
+// uploadLayout returns the layout of the object that is assembled from the given parts of the request's upload.
+// Each part holds a single frame, whose size is listed by S3.
+// errInvalidPart is returned if the parts weren't uploaded or aren't sorted by part number.
+func (o object) uploadLayout(ctx context.Context, parts []completedPart) (crypto.Layout, error) {
+	sizes := map[int32]int64{}
+	var partNumberMarker string
+	for {
+		page, err := o.client.ListParts(ctx, o.bucket, o.key, o.uploadID, partNumberMarker, o.sseCustomerAlgorithm, o.sseCustomerKey, o.sseCustomerKeyMD5)
+		if err != nil {
+			return crypto.Layout{}, fmt.Errorf("listing parts: %w", err)
+		}
+		for _, part := range page.Parts {
+			if part.PartNumber != nil && part.Size != nil {
+				sizes[*part.PartNumber] = *part.Size
+			}
+		}
+		if page.IsTruncated == nil || !*page.IsTruncated || page.NextPartNumberMarker == nil {
+			break
+		}
+		partNumberMarker = *page.NextPartNumberMarker
+	}
+
+	frames := make([]crypto.Frame, 0, len(parts))
+	for _, part := range parts {
+		if len(frames) > 0 && part.PartNumber <= int32(frames[len(frames)-1].Number) {
+			return crypto.Layout{}, fmt.Errorf("%w: parts must be listed in ascending order", errInvalidPart)
+		}
+		size, ok := sizes[part.PartNumber]
+		if !ok {
+			return crypto.Layout{}, fmt.Errorf("%w: part %d was not uploaded", errInvalidPart, part.PartNumber)
+		}
+		plaintextSize, err := crypto.PlaintextSize(size)
+		if err != nil {
+			return crypto.Layout{}, fmt.Errorf("part %d: %w", part.PartNumber, err)
+		}
+		frames = append(frames, crypto.Frame{Number: uint32(part.PartNumber), PlaintextSize: plaintextSize})
+	}
+	return crypto.NewLayout(frames), nil
+}
+
+// addLayout adds the sealed layout to the metadata of the object assembled by CompleteMultipartUpload.
+// S3 can't change the metadata of an existing object, so the object is copied onto itself.
+// The object must still be the version created by the upload and carry the DEK its parts were encrypted with,
+// otherwise a concurrently written object could be served with a layout that doesn't belong to it.
+// In versioned buckets, the version without the layout is deleted afterwards.
+func (o object) addLayout(ctx context.Context, completed *s3.CompleteMultipartUploadOutput, dek, sealedLayout []byte) (*s3.CopyObjectOutput, error) {
+	var versionID string
+	if completed.VersionId != nil {
+		versionID = *completed.VersionId
+	}
+
+	head, err := o.client.HeadObject(ctx, o.bucket, o.key, versionID, o.sseCustomerAlgorithm, o.sseCustomerKey, o.sseCustomerKeyMD5)
+	if err != nil {
+		return nil, fmt.Errorf("getting metadata of completed object: %w", err)
+	}
+	if completed.ETag != nil && (head.ETag == nil || *head.ETag != *completed.ETag) {
+		return nil, errors.New("object was overwritten while completing the upload")
+	}
+	if completed.VersionId != nil && (head.VersionId == nil || *head.VersionId != *completed.VersionId) {
+		return nil, errors.New("object was overwritten while completing the upload")
+	}
+	objectDEK, _, err := o.keys.unwrapDEK(head.Metadata)
+	if err != nil {
+		return nil, fmt.Errorf("unwrapping DEK of completed object: %w", err)
+	}
+	if !bytes.Equal(objectDEK, dek) {
+		return nil, errors.New("DEK of the completed object doesn't match the DEK of its upload")
+	}
+
+	metadata := maps.Clone(head.Metadata)
+	metadata[layoutTag] = base64.StdEncoding.EncodeToString(sealedLayout)
+	copied, err := o.client.ReplaceMetadata(ctx, o.bucket, o.key, head, metadata, o.sseCustomerAlgorithm, o.sseCustomerKey, o.sseCustomerKeyMD5)
+	if err != nil {
+		return nil, fmt.Errorf("replacing metadata of completed object: %w", err)
+	}
+
+	if versionID != "" {
+		if _, err := o.client.DeleteObject(ctx, o.bucket, o.key, versionID); err != nil {
+			o.log.With(slog.String("versionID", versionID), slog.Any("error", err)).Warn("Deleting version of completed object without layout")
+		}
+	}
+	return copied, nil
+}
+
+// openLayout returns the layout sealed in the metadata of an object in the multipartStreamFormat.
+func openLayout(metadata map[string]string, dek []byte) (crypto.Layout, error) {
+	encoded, ok := metadata[layoutTag]
+	if !ok {
+		return crypto.Layout{}, errors.New("object has no layout, its multipart upload wasn't completed")
+	}
+	sealed, err := base64.StdEncoding.DecodeString(encoded)
+	if err != nil {
+		return crypto.Layout{}, fmt.Errorf("decoding layout: %w", err)
+	}
+	return crypto.OpenLayout(sealed, dek)
+}
+
+// abortMultipartUpload is a http.HandlerFunc that implements AbortMultipartUpload.
+func (o object) abortMultipartUpload(w http.ResponseWriter, r *http.Request) {
+	o.log.With(slog.String("key", o.key), slog.String("host", o.bucket)).Debug("abortMultipartUpload")
+
+	if _, err := o.client.AbortMultipartUpload(r.Context(), o.bucket, o.key, o.uploadID); err != nil {
+		o.log.With(slog.Any("error", err)).Error("AbortMultipartUpload sending request to S3")
+		writeS3Error(w, err)
+		return
+	}
+	o.deleteUploadObject(r.Context())
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// writeXML marshals the given value and writes it as the XML body of a 200 response.
+func writeXML(w http.ResponseWriter, v any, log *slog.Logger) {
+	marshalled, err := xml.Marshal(v)
+	if err != nil {
+		log.With(slog.Any("error", err)).Error("marshalling response")
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/xml")
+	w.WriteHeader(http.StatusOK)
+	if _, err := w.Write([]byte(xml.Header + string(marshalled))); err != nil {
+		log.With(slog.Any("error", err)).Error("sending response")
+	}
+}
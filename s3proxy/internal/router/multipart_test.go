@@ -0,0 +1,289 @@
+/*
+Copyright (c) Edgeless Systems GmbH
+
+SPDX-License-Identifier: BUSL-1.1
+*/
+
+package router
+
+import (
+	"bytes"
+	"encoding/xml"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/edgelesssys/constellation/v2/internal/logger"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestMultipartUpload(t *testing.T) {
+	partA := bytes.Repeat([]byte("a"), 1024)
+	partB := bytes.Repeat([]byte("b"), 16)
+
+	testCases := map[string]struct {
+		parts      map[int32][]byte
+		complete   []int32
+		wantObject []byte
+		wantErr    bool
+	}{
+		"single part": {
+			parts:      map[int32][]byte{1: partA},
+			complete:   []int32{1},
+			wantObject: partA,
+		},
+		"multiple parts": {
+			parts:      map[int32][]byte{1: partA, 2: partB},
+			complete:   []int32{1, 2},
+			wantObject: append(append([]byte{}, partA...), partB...),
+		},
+		"unused part is dropped": {
+			parts:      map[int32][]byte{1: partA, 2: partB, 3: partA},
+			complete:   []int32{1, 3},
+			wantObject: append(append([]byte{}, partA...), partA...),
+		},
+		"parts out of order": {
+			parts:    map[int32][]byte{1: partA, 2: partB},
+			complete: []int32{2, 1},
+			wantErr:  true,
+		},
+		"part wasn't uploaded": {
+			parts:    map[int32][]byte{1: partA},
+			complete: []int32{1, 2},
+			wantErr:  true,
+		},
+	}
+
+	for name, tc := range testCases {
+		t.Run(name, func(t *testing.T) {
+			assert := assert.New(t)
+			require := require.New(t)
+
+			client := newStubS3Client()
+			obj := object{
+				keys:     newTestKeyring([32]byte{0x01}),
+				client:   client,
+				bucket:   "bucket",
+				key:      "key",
+				metadata: map[string]string{},
+				uploads:  newUploadStore(),
+				log:      logger.NewTest(t),
+			}
+
+			rec := httptest.NewRecorder()
+			obj.createMultipartUpload(rec, httptest.NewRequest(http.MethodPost, "/bucket/key?uploads", nil))
+			require.Equal(http.StatusOK, rec.Code)
+			var initiated initiateMultipartUploadResult
+			require.NoError(xml.Unmarshal(rec.Body.Bytes(), &initiated))
+			assert.Equal(multipartStreamFormat, client.uploadMetadata[initiated.UploadID][formatTag])
+			assert.NotEmpty(client.uploadMetadata[initiated.UploadID][dekTag])
+			assert.Equal(client.uploadMetadata[initiated.UploadID][dekTag], client.metadata["bucket/"+uploadObjectKey(initiated.UploadID)][dekTag])
+			obj.uploadID = initiated.UploadID
+
+			etags := map[int32]string{}
+			for partNumber, data := range tc.parts {
+				req := httptest.NewRequest(http.MethodPut, "/bucket/key", bytes.NewReader(data))
+				// Each part is served by a different s3proxy instance, which has to fetch the upload's DEK from S3.
+				partObj := obj
+				partObj.uploads = newUploadStore()
+				partObj.partNumber = partNumber
+				partObj.body = newBodyReader(req)
+				partObj.contentLength = req.ContentLength
+				rec := httptest.NewRecorder()
+				partObj.uploadPart(rec, req)
+				require.Equal(http.StatusOK, rec.Code)
+				etags[partNumber] = rec.Header().Get("ETag")
+
+				assert.NotContains(string(client.parts[obj.uploadID][partNumber]), string(data))
+			}
+
+			var request completeMultipartUpload
+			for _, partNumber := range tc.complete {
+				request.Parts = append(request.Parts, completedPart{ETag: etags[partNumber], PartNumber: partNumber})
+			}
+			body, err := xml.Marshal(request)
+			require.NoError(err)
+			obj.data = body
+			rec = httptest.NewRecorder()
+			obj.completeMultipartUpload(rec, httptest.NewRequest(http.MethodPost, "/bucket/key", nil))
+			if tc.wantErr {
+				assert.Equal(http.StatusBadRequest, rec.Code)
+				assert.NotContains(client.objects, "bucket/key")
+				return
+			}
+			require.Equal(http.StatusOK, rec.Code)
+			_, ok := obj.uploads.get(obj.bucket, obj.key, obj.uploadID)
+			assert.False(ok)
+			assert.NotContains(client.objects, "bucket/"+uploadObjectKey(obj.uploadID))
+			assert.NotEmpty(client.metadata["bucket/key"][layoutTag])
+
+			size, err := obj.plaintextSize(client.metadata["bucket/key"], int64(len(client.objects["bucket/key"])))
+			require.NoError(err)
+			assert.EqualValues(len(tc.wantObject), size)
+
+			rec = httptest.NewRecorder()
+			obj.get(rec, httptest.NewRequest(http.MethodGet, "/bucket/key", nil))
+			require.Equal(http.StatusOK, rec.Code)
+			assert.Equal(tc.wantObject, rec.Body.Bytes())
+		})
+	}
+}
+
+func TestUploadPartUnknownUpload(t *testing.T) {
+	req := httptest.NewRequest(http.MethodPut, "/bucket/key", bytes.NewReader([]byte("data")))
+	obj := object{
+		keys:          newTestKeyring([32]byte{0x01}),
+		client:        newStubS3Client(),
+		bucket:        "bucket",
+		key:           "key",
+		uploadID:      "unknown",
+		partNumber:    1,
+		body:          newBodyReader(req),
+		contentLength: req.ContentLength,
+		uploads:       newUploadStore(),
+		log:           logger.NewTest(t),
+	}
+
+	rec := httptest.NewRecorder()
+	obj.uploadPart(rec, req)
+	assert.Equal(t, http.StatusNotFound, rec.Code)
+}
+
+func TestUploadPartOfOtherObject(t *testing.T) {
+	require := require.New(t)
+
+	client := newStubS3Client()
+	obj := object{
+		keys:     newTestKeyring([32]byte{0x01}),
+		client:   client,
+		bucket:   "bucket",
+		key:      "key",
+		metadata: map[string]string{},
+		uploads:  newUploadStore(),
+		log:      logger.NewTest(t),
+	}
+	rec := httptest.NewRecorder()
+	obj.createMultipartUpload(rec, httptest.NewRequest(http.MethodPost, "/bucket/key?uploads", nil))
+	require.Equal(http.StatusOK, rec.Code)
+	var initiated initiateMultipartUploadResult
+	require.NoError(xml.Unmarshal(rec.Body.Bytes(), &initiated))
+
+	// The DEK of the upload must not be used for parts sent for another object.
+	req := httptest.NewRequest(http.MethodPut, "/bucket/other-key", bytes.NewReader([]byte("data")))
+	partObj := obj
+	partObj.key = "other-key"
+	partObj.uploadID = initiated.UploadID
+	partObj.partNumber = 1
+	partObj.body = newBodyReader(req)
+	partObj.contentLength = req.ContentLength
+	partObj.uploads = newUploadStore()
+	rec = httptest.NewRecorder()
+	partObj.uploadPart(rec, req)
+	assert.Equal(t, http.StatusNotFound, rec.Code)
+}
+
+func TestCompleteMultipartUploadDEKMismatch(t *testing.T) {
+	assert := assert.New(t)
+	require := require.New(t)
+
+	keys := newTestKeyring([32]byte{0x01})
+	client := newStubS3Client()
+	obj := object{
+		keys:     keys,
+		client:   client,
+		bucket:   "bucket",
+		key:      "key",
+		metadata: map[string]string{},
+		uploads:  newUploadStore(),
+		log:      logger.NewTest(t),
+	}
+	rec := httptest.NewRecorder()
+	obj.createMultipartUpload(rec, httptest.NewRequest(http.MethodPost, "/bucket/key?uploads", nil))
+	require.Equal(http.StatusOK, rec.Code)
+	var initiated initiateMultipartUploadResult
+	require.NoError(xml.Unmarshal(rec.Body.Bytes(), &initiated))
+	obj.uploadID = initiated.UploadID
+
+	req := httptest.NewRequest(http.MethodPut, "/bucket/key", bytes.NewReader([]byte("data")))
+	partObj := obj
+	partObj.partNumber = 1
+	partObj.body = newBodyReader(req)
+	partObj.contentLength = req.ContentLength
+	rec = httptest.NewRecorder()
+	partObj.uploadPart(rec, req)
+	require.Equal(http.StatusOK, rec.Code)
+
+	// The completed object carries another DEK than the one its parts were encrypted with.
+	otherMetadata := map[string]string{}
+	_, err := keys.generateDEK(otherMetadata)
+	require.NoError(err)
+	client.uploadMetadata[obj.uploadID][dekTag] = otherMetadata[dekTag]
+
+	body, err := xml.Marshal(completeMultipartUpload{Parts: []completedPart{{ETag: rec.Header().Get("ETag"), PartNumber: 1}}})
+	require.NoError(err)
+	obj.data = body
+	rec = httptest.NewRecorder()
+	obj.completeMultipartUpload(rec, httptest.NewRequest(http.MethodPost, "/bucket/key", nil))
+	assert.Equal(http.StatusInternalServerError, rec.Code)
+	assert.Empty(client.metadata["bucket/key"][layoutTag])
+}
+
+func TestAbortMultipartUpload(t *testing.T) {
+	assert := assert.New(t)
+	require := require.New(t)
+
+	client := newStubS3Client()
+	obj := object{
+		keys:     newTestKeyring([32]byte{0x01}),
+		client:   client,
+		bucket:   "bucket",
+		key:      "key",
+		metadata: map[string]string{},
+		uploads:  newUploadStore(),
+		log:      logger.NewTest(t),
+	}
+
+	rec := httptest.NewRecorder()
+	obj.createMultipartUpload(rec, httptest.NewRequest(http.MethodPost, "/bucket/key?uploads", nil))
+	require.Equal(http.StatusOK, rec.Code)
+	var initiated initiateMultipartUploadResult
+	require.NoError(xml.Unmarshal(rec.Body.Bytes(), &initiated))
+	require.Contains(client.objects, "bucket/"+uploadObjectKey(initiated.UploadID))
+
+	obj.uploadID = initiated.UploadID
+	rec = httptest.NewRecorder()
+	obj.abortMultipartUpload(rec, httptest.NewRequest(http.MethodDelete, "/bucket/key", nil))
+	assert.Equal(http.StatusNoContent, rec.Code)
+	assert.NotContains(client.objects, "bucket/"+uploadObjectKey(initiated.UploadID))
+	_, ok := obj.uploads.get(obj.bucket, obj.key, obj.uploadID)
+	assert.False(ok)
+}
+
+func TestUploadStore(t *testing.T) {
+	assert := assert.New(t)
+
+	now := time.Now()
+	store := newUploadStore()
+	store.now = func() time.Time { return now }
+
+	store.put("bucket", "key", "old", []byte("old"))
+	store.put("bucket", "key", "new", []byte("new"))
+
+	dek, ok := store.get("bucket", "key", "old")
+	assert.True(ok)
+	assert.Equal([]byte("old"), dek)
+	_, ok = store.get("bucket", "other-key", "old")
+	assert.False(ok)
+
+	store.delete("bucket", "key", "new")
+	_, ok = store.get("bucket", "key", "new")
+	assert.False(ok)
+
+	now = now.Add(uploadTTL + time.Second)
+	_, ok = store.get("bucket", "key", "old")
+	assert.False(ok)
+	store.put("bucket", "key", "newest", []byte("newest"))
+	assert.Len(store.uploads, 1)
+}
@@ -7,18 +7,23 @@ SPDX-License-Identifier: BUSL-1.1
 package router
 
 import (
+	"bufio"
+	"bytes"
 	"context"
-	"encoding/hex"
+	"errors"
+	"fmt"
 	"io"
 	"log/slog"
 	"net/http"
 	"net/url"
 	"regexp"
+	"slices"
 	"strconv"
 	"strings"
 	"time"
 
 	"github.com/aws/aws-sdk-go-v2/service/s3"
+	"github.com/aws/aws-sdk-go-v2/service/s3/types"
 	"github.com/edgelesssys/constellation/v2/s3proxy/internal/crypto"
 )
 
@@ -26,15 +31,36 @@ const (
 	// dekTag is the name of the header that holds the encrypted data encryption key for the attached object. Presence of the key implies the object needs to be decrypted.
 	// Use lowercase only, as AWS automatically lowercases all metadata keys.
 	dekTag = "constellation-dek"
+	// formatTag is the name of the header that describes how the object's body is encrypted.
+	// Objects without this header consist of a single ciphertext created by crypto.Encrypt.
+	formatTag = "constellation-format"
+	// streamFormat marks objects that consist of a single frame of the crypto package's stream format.
+	streamFormat = "stream-v1"
+	// multipartStreamFormat marks objects created through a multipart upload.
+	// Their body consists of one frame of the crypto package's stream format per part.
+	multipartStreamFormat = "multipart-stream-v1"
+	// layoutTag is the name of the header that holds the sealed crypto.Layout of objects in the multipartStreamFormat.
+	// It is added when the multipart upload is completed.
+	layoutTag = "constellation-layout"
 )
 
+// internalMetadata lists the metadata keys s3proxy uses to decrypt objects.
+// They are neither shown to nor accepted from clients.
+var internalMetadata = []string{dekTag, formatTag, kekVersionTag, layoutTag}
+
+// legacyKEK is the all-zero KEK that was used to wrap DEKs by earlier versions of s3proxy.
+var legacyKEK = [32]byte{}
+
 // object bundles data to implement http.Handler methods that use data from incoming requests.
 type object struct {
-	kek                       [32]byte
+	keys                      keyring
 	client                    s3Client
 	key                       string
 	bucket                    string
 	data                      []byte
+	body                      *bodyReader
+	contentLength             int64
+	rangeHeader               string
 	query                     url.Values
 	tags                      string
 	contentType               string
@@ -45,34 +71,189 @@ type object struct {
 	sseCustomerAlgorithm      string
 	sseCustomerKey            string
 	sseCustomerKeyMD5         string
-	log                       *slog.Logger
+	uploadID                  string
+	partNumber                int32
+	uploads                   *uploadStore
+	frames                    *objectCache[frameIndex]
+	sizes                     *objectCache[int64]
+	// copySource and the following fields are only set for CopyObject requests.
+	copySource                     string
+	copySourceIfMatch              string
+	copySourceSSECustomerAlgorithm string
+	copySourceSSECustomerKey       string
+	copySourceSSECustomerKeyMD5    string
+	// header holds the headers of a CopyObject request that are passed on to S3 unchanged.
+	header http.Header
+	log    *slog.Logger
 }
 
 // get is a http.HandlerFunc that implements the GET method for objects.
 func (o object) get(w http.ResponseWriter, r *http.Request) {
 	o.log.With(slog.String("key", o.key), slog.String("host", o.bucket)).Debug("getObject")
 
-	versionID, ok := o.query["versionId"]
-	if !ok {
-		versionID = []string{""}
+	if o.rangeHeader != "" {
+		o.getRange(w, r)
+		return
 	}
 
-	output, err := o.client.GetObject(r.Context(), o.bucket, o.key, versionID[0], o.sseCustomerAlgorithm, o.sseCustomerKey, o.sseCustomerKeyMD5)
+	output, err := o.client.GetObject(r.Context(), o.bucket, o.key, o.versionID(), "", "", o.sseCustomerAlgorithm, o.sseCustomerKey, o.sseCustomerKeyMD5)
 	if err != nil {
 		// log with Info as it might be expected behavior (e.g. object not found).
 		o.log.With(slog.Any("error", err)).Error("GetObject sending request to S3")
 
 		// We want to forward error codes from the s3 API to clients as much as possible.
-		code := parseErrorCode(err)
-		if code != 0 {
-			http.Error(w, err.Error(), code)
-			return
+		writeS3Error(w, err)
+		return
+	}
+	defer output.Body.Close()
+
+	setObjectHeaders(w, output)
+
+	if _, ok := output.Metadata[dekTag]; !ok {
+		// The object was not encrypted by s3proxy.
+		if output.ContentLength != nil {
+			w.Header().Set("Content-Length", strconv.FormatInt(*output.ContentLength, 10))
+		}
+		o.writeBody(w, http.StatusOK, output.Body)
+		return
+	}
+
+	format := output.Metadata[formatTag]
+	if format != streamFormat && format != multipartStreamFormat {
+		o.getLegacy(w, output.Body, output.Metadata)
+		return
+	}
+
+	dek, _, err := o.keys.unwrapDEK(output.Metadata)
+	if err != nil {
+		o.log.With(slog.Any("error", err)).Error("GetObject unwrapping DEK")
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	var ciphertextSize int64
+	if output.ContentLength != nil {
+		ciphertextSize = *output.ContentLength
+	}
+	layout, err := streamLayout(output.Metadata, dek, ciphertextSize)
+	if err != nil {
+		o.log.With(slog.Any("error", err)).Error("GetObject reading layout")
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	decrypter, err := crypto.NewDecryptingReader(output.Body, dek, layout)
+	if err != nil {
+		o.log.With(slog.Any("error", err)).Error("GetObject decrypting response")
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	// Decrypt the first segment before sending the response, so that we can still report errors with a proper status code.
+	plaintext := bufio.NewReaderSize(decrypter, crypto.SegmentSize)
+	if _, err := plaintext.Peek(1); err != nil && !errors.Is(err, io.EOF) {
+		o.log.With(slog.Any("error", err)).Error("GetObject decrypting response")
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Length", strconv.FormatInt(layout.PlaintextSize, 10))
+	o.writeBody(w, http.StatusOK, plaintext)
+}
+
+// streamLayout returns the layout of an object in one of the stream formats.
+// Objects created by PutObject consist of a single frame, whose size follows from the size of the object.
+// The layout of objects created by multipart uploads is sealed in their metadata. It must match the size of the object,
+// so that a plaintext size is never reported for an object that doesn't hold it.
+func streamLayout(metadata map[string]string, dek []byte, ciphertextSize int64) (crypto.Layout, error) {
+	if metadata[formatTag] == multipartStreamFormat {
+		layout, err := openLayout(metadata, dek)
+		if err != nil {
+			return crypto.Layout{}, err
+		}
+		if err := layout.CheckCiphertextSize(ciphertextSize); err != nil {
+			return crypto.Layout{}, fmt.Errorf("decrypting object: %w", err)
 		}
+		return layout, nil
+	}
+	plaintextSize, err := crypto.PlaintextSize(ciphertextSize)
+	if err != nil {
+		return crypto.Layout{}, err
+	}
+	return crypto.SingleFrameLayout(plaintextSize), nil
+}
+
+// getLegacy decrypts objects written by earlier versions of s3proxy.
+// Those objects consist of a single ciphertext, so they have to be read completely before decrypting them.
+func (o object) getLegacy(w http.ResponseWriter, body io.Reader, metadata map[string]string) {
+	dek, _, err := o.keys.unwrapDEK(metadata)
+	if err != nil {
+		o.log.With(slog.Any("error", err)).Error("GetObject unwrapping DEK")
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	ciphertext, err := io.ReadAll(body)
+	if err != nil {
+		o.log.With(slog.Any("error", err)).Error("GetObject reading S3 response")
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
 
+	plaintext, err := crypto.DecryptWithDEK(ciphertext, dek)
+	if err != nil {
+		o.log.With(slog.Any("error", err)).Error("GetObject decrypting response")
 		http.Error(w, err.Error(), http.StatusInternalServerError)
 		return
 	}
 
+	if o.rangeHeader != "" {
+		rng, ok, err := parseRange(o.rangeHeader, int64(len(plaintext)))
+		if err != nil {
+			writeRangeNotSatisfiable(w, int64(len(plaintext)))
+			return
+		}
+		if ok {
+			rng.setHeaders(w, int64(len(plaintext)))
+			o.writeBody(w, http.StatusPartialContent, bytes.NewReader(plaintext[rng.start:rng.end+1]))
+			return
+		}
+	}
+
+	w.Header().Set("Content-Length", strconv.Itoa(len(plaintext)))
+	o.writeBody(w, http.StatusOK, bytes.NewReader(plaintext))
+}
+
+// writeBody streams body to the client as the body of a response with the given status.
+// Once the response status is sent, errors can't be reported anymore. If reading the body fails,
+// the connection is aborted, so that clients notice the incomplete response.
+func (o object) writeBody(w http.ResponseWriter, status int, body io.Reader) {
+	w.WriteHeader(status)
+	if _, err := io.Copy(w, body); err != nil {
+		o.log.With(slog.Any("error", err)).Error("GetObject sending response")
+		panic(http.ErrAbortHandler)
+	}
+}
+
+// versionID returns the object version requested by the client, or an empty string for the latest version.
+func (o object) versionID() string {
+	return o.query.Get("versionId")
+}
+
+// setObjectHeaders copies the headers describing an object from a GetObject response.
+func setObjectHeaders(w http.ResponseWriter, output *s3.GetObjectOutput) {
+	if output.ContentType != nil {
+		w.Header().Set("Content-Type", *output.ContentType)
+	}
+	if output.LastModified != nil {
+		w.Header().Set("Last-Modified", output.LastModified.UTC().Format(http.TimeFormat))
+	}
+	if output.VersionId != nil {
+		w.Header().Set("x-amz-version-id", *output.VersionId)
+	}
+	for key, value := range output.Metadata {
+		if !isInternalMetadata(key) {
+			w.Header().Set("x-amz-meta-"+key, value)
+		}
+	}
 	if output.ETag != nil {
 		w.Header().Set("ETag", strings.Trim(*output.ETag, "\""))
 	}
@@ -103,60 +284,34 @@ func (o object) get(w http.ResponseWriter, r *http.Request) {
 	if output.ServerSideEncryption != "" {
 		w.Header().Set("x-amz-server-side-encryption-context", string(output.ServerSideEncryption))
 	}
+}
 
-	body, err := io.ReadAll(output.Body)
+// put is a http.HandlerFunc that implements the PUT method for objects.
+// The body is encrypted while it is streamed to S3.
+func (o object) put(w http.ResponseWriter, r *http.Request) {
+	dek, err := o.keys.generateDEK(o.metadata)
 	if err != nil {
-		o.log.With(slog.Any("error", err)).Error("GetObject reading S3 response")
+		o.log.With(slog.Any("error", err)).Error("PutObject")
 		http.Error(w, err.Error(), http.StatusInternalServerError)
 		return
 	}
-
-	plaintext := body
-	rawEncryptedDEK, ok := output.Metadata[dekTag]
-	if ok {
-		encryptedDEK, err := hex.DecodeString(rawEncryptedDEK)
-		if err != nil {
-			o.log.Error("GetObject decoding DEK", "error", err)
-			http.Error(w, err.Error(), http.StatusInternalServerError)
-			return
-		}
-
-		plaintext, err = crypto.Decrypt(body, encryptedDEK, o.kek)
-		if err != nil {
-			o.log.With(slog.Any("error", err)).Error("GetObject decrypting response")
-			http.Error(w, err.Error(), http.StatusInternalServerError)
-			return
-		}
-	}
-
-	w.WriteHeader(http.StatusOK)
-	if _, err := w.Write(plaintext); err != nil {
-		o.log.With(slog.Any("error", err)).Error("GetObject sending response")
-	}
-}
-
-// put is a http.HandlerFunc that implements the PUT method for objects.
-func (o object) put(w http.ResponseWriter, r *http.Request) {
-	ciphertext, encryptedDEK, err := crypto.Encrypt(o.data, o.kek)
+	ciphertext, err := crypto.NewEncryptingReader(o.body, o.contentLength, dek, 1)
 	if err != nil {
 		o.log.With(slog.Any("error", err)).Error("PutObject")
 		http.Error(w, err.Error(), http.StatusInternalServerError)
 		return
 	}
-	o.metadata[dekTag] = hex.EncodeToString(encryptedDEK)
+	o.metadata[formatTag] = streamFormat
 
-	output, err := o.client.PutObject(r.Context(), o.bucket, o.key, o.tags, o.contentType, o.objectLockLegalHoldStatus, o.objectLockMode, o.sseCustomerAlgorithm, o.sseCustomerKey, o.sseCustomerKeyMD5, o.objectLockRetainUntilDate, o.metadata, ciphertext)
+	output, err := o.client.PutObject(r.Context(), o.bucket, o.key, o.tags, o.contentType, o.objectLockLegalHoldStatus, o.objectLockMode, o.sseCustomerAlgorithm, o.sseCustomerKey, o.sseCustomerKeyMD5, o.objectLockRetainUntilDate, o.metadata, ciphertext, crypto.CiphertextSize(o.contentLength))
 	if err != nil {
-		o.log.With(slog.Any("error", err)).Error("PutObject sending request to S3")
-
-		// We want to forward error codes from the s3 API to clients whenever possible.
-		code := parseErrorCode(err)
-		if code != 0 {
-			http.Error(w, err.Error(), code)
+		if o.body.writeError(w, o.log) {
 			return
 		}
+		o.log.With(slog.Any("error", err)).Error("PutObject sending request to S3")
 
-		http.Error(w, err.Error(), http.StatusInternalServerError)
+		// We want to forward error codes from the s3 API to clients whenever possible.
+		writeS3Error(w, err)
 		return
 	}
 
@@ -202,6 +357,22 @@ func (o object) put(w http.ResponseWriter, r *http.Request) {
 	}
 }
 
+// isInternalMetadata returns true if the given metadata key is used by s3proxy to decrypt objects.
+func isInternalMetadata(key string) bool {
+	return slices.Contains(internalMetadata, strings.ToLower(key))
+}
+
+// writeS3Error writes an error response, reusing the status code of an S3 API error if possible.
+func writeS3Error(w http.ResponseWriter, err error) {
+	code := parseErrorCode(err)
+	if code != 0 {
+		http.Error(w, err.Error(), code)
+		return
+	}
+
+	http.Error(w, err.Error(), http.StatusInternalServerError)
+}
+
 func parseErrorCode(err error) int {
 	regex := regexp.MustCompile(`https response error StatusCode: (\d+)`)
 	matches := regex.FindStringSubmatch(err.Error())
@@ -214,6 +385,23 @@ func parseErrorCode(err error) int {
 }
 
 type s3Client interface {
-	GetObject(ctx context.Context, bucket, key, versionID, sseCustomerAlgorithm, sseCustomerKey, sseCustomerKeyMD5 string) (*s3.GetObjectOutput, error)
-	PutObject(ctx context.Context, bucket, key, tags, contentType, objectLockLegalHoldStatus, objectLockMode, sseCustomerAlgorithm, sseCustomerKey, sseCustomerKeyMD5 string, objectLockRetainUntilDate time.Time, metadata map[string]string, body []byte) (*s3.PutObjectOutput, error)
+	GetObject(ctx context.Context, bucket, key, versionID, byteRange, ifMatch, sseCustomerAlgorithm, sseCustomerKey, sseCustomerKeyMD5 string) (*s3.GetObjectOutput, error)
+	PutObject(ctx context.Context, bucket, key, tags, contentType, objectLockLegalHoldStatus, objectLockMode, sseCustomerAlgorithm, sseCustomerKey, sseCustomerKeyMD5 string, objectLockRetainUntilDate time.Time, metadata map[string]string, body io.Reader, contentLength int64) (*s3.PutObjectOutput, error)
+	CreateMultipartUpload(ctx context.Context, bucket, key, tags, contentType, objectLockLegalHoldStatus, objectLockMode, sseCustomerAlgorithm, sseCustomerKey, sseCustomerKeyMD5 string, objectLockRetainUntilDate time.Time, metadata map[string]string) (*s3.CreateMultipartUploadOutput, error)
+	UploadPart(ctx context.Context, bucket, key, uploadID string, partNumber int32, sseCustomerAlgorithm, sseCustomerKey, sseCustomerKeyMD5 string, body io.Reader, contentLength int64) (*s3.UploadPartOutput, error)
+	CompleteMultipartUpload(ctx context.Context, bucket, key, uploadID, sseCustomerAlgorithm, sseCustomerKey, sseCustomerKeyMD5 string, parts []types.CompletedPart) (*s3.CompleteMultipartUploadOutput, error)
+	AbortMultipartUpload(ctx context.Context, bucket, key, uploadID string) (*s3.AbortMultipartUploadOutput, error)
+	ListParts(ctx context.Context, bucket, key, uploadID, partNumberMarker, sseCustomerAlgorithm, sseCustomerKey, sseCustomerKeyMD5 string) (*s3.ListPartsOutput, error)
+	DeleteObject(ctx context.Context, bucket, key, versionID string) (*s3.DeleteObjectOutput, error)
+	ListObjects(ctx context.Context, bucket, continuationToken string) (*s3.ListObjectsV2Output, error)
+	HeadObject(ctx context.Context, bucket, key, versionID, sseCustomerAlgorithm, sseCustomerKey, sseCustomerKeyMD5 string) (*s3.HeadObjectOutput, error)
+	ReplaceMetadata(ctx context.Context, bucket, key string, head *s3.HeadObjectOutput, metadata map[string]string, sseCustomerAlgorithm, sseCustomerKey, sseCustomerKeyMD5 string) (*s3.CopyObjectOutput, error)
+	CopyObject(ctx context.Context, input *s3.CopyObjectInput) (*s3.CopyObjectOutput, error)
+	forwarder
+}
+
+// forwarder sends requests that are signed by the client to the backend.
+type forwarder interface {
+	Endpoint() *url.URL
+	Do(req *http.Request) (*http.Response, error)
 }
@@ -0,0 +1,263 @@
+/*
+Copyright (c) Edgeless Systems GmbH
+
+SPDX-License-Identifier: BUSL-1.1
+*/
+
+package router
+
+import (
+	"bytes"
+	"crypto/md5"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"testing"
+
+	"github.com/edgelesssys/constellation/v2/internal/logger"
+	"github.com/edgelesssys/constellation/v2/s3proxy/internal/crypto"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestPutGetObject(t *testing.T) {
+	data := bytes.Repeat([]byte("0123456789"), crypto.SegmentSize/5)
+	sha256Sum := sha256.Sum256(data)
+	md5Sum := md5.Sum(data)
+
+	testCases := map[string]struct {
+		data     []byte
+		header   map[string]string
+		wantCode int
+	}{
+		"empty object": {
+			data:     nil,
+			wantCode: http.StatusOK,
+		},
+		"object spanning multiple segments": {
+			data:     data,
+			wantCode: http.StatusOK,
+		},
+		"matching digests": {
+			data: data,
+			header: map[string]string{
+				"x-amz-content-sha256": fmt.Sprintf("%x", sha256Sum),
+				"content-md5":          base64.StdEncoding.EncodeToString(md5Sum[:]),
+			},
+			wantCode: http.StatusOK,
+		},
+		"unsigned payload": {
+			data:     data,
+			header:   map[string]string{"x-amz-content-sha256": "UNSIGNED-PAYLOAD"},
+			wantCode: http.StatusOK,
+		},
+		"sha256 mismatch": {
+			data:     data,
+			header:   map[string]string{"x-amz-content-sha256": fmt.Sprintf("%x", sha256.Sum256([]byte("other")))},
+			wantCode: http.StatusBadRequest,
+		},
+		"md5 mismatch": {
+			data:     data,
+			header:   map[string]string{"content-md5": base64.StdEncoding.EncodeToString(make([]byte, md5.Size))},
+			wantCode: http.StatusBadRequest,
+		},
+	}
+
+	for name, tc := range testCases {
+		t.Run(name, func(t *testing.T) {
+			assert := assert.New(t)
+			require := require.New(t)
+
+			client := newStubS3Client()
+			req := httptest.NewRequest(http.MethodPut, "/bucket/key", bytes.NewReader(tc.data))
+			for k, v := range tc.header {
+				req.Header.Set(k, v)
+			}
+			obj := object{
+				keys:          newTestKeyring([32]byte{0x01}),
+				client:        client,
+				bucket:        "bucket",
+				key:           "key",
+				body:          newBodyReader(req),
+				contentLength: req.ContentLength,
+				metadata:      map[string]string{},
+				log:           logger.NewTest(t),
+			}
+
+			rec := httptest.NewRecorder()
+			obj.put(rec, req)
+			require.Equal(tc.wantCode, rec.Code)
+			if tc.wantCode != http.StatusOK {
+				assert.Empty(client.objects)
+				return
+			}
+			assert.Equal(streamFormat, client.metadata["bucket/key"][formatTag])
+			assert.Equal("1", client.metadata["bucket/key"][kekVersionTag])
+			if len(tc.data) > 0 {
+				assert.NotContains(string(client.objects["bucket/key"]), string(tc.data[:10]))
+			}
+
+			rec = httptest.NewRecorder()
+			obj.get(rec, httptest.NewRequest(http.MethodGet, "/bucket/key", nil))
+			require.Equal(http.StatusOK, rec.Code)
+			assert.Equal(tc.data, rec.Body.Bytes())
+			assert.Equal(strconv.Itoa(len(tc.data)), rec.Header().Get("Content-Length"))
+		})
+	}
+}
+
+func TestGetObjectLegacyFormats(t *testing.T) {
+	kek := [32]byte{0x01}
+	data := []byte("hello, world")
+
+	testCases := map[string]struct {
+		encrypt        func(t *testing.T) (body []byte, metadata map[string]string)
+		allowLegacyKEK bool
+		wantCode       int
+		wantData       []byte
+	}{
+		"unencrypted object": {
+			encrypt: func(*testing.T) ([]byte, map[string]string) {
+				return data, map[string]string{}
+			},
+			wantCode: http.StatusOK,
+			wantData: data,
+		},
+		"single ciphertext": {
+			encrypt: func(t *testing.T) ([]byte, map[string]string) {
+				ciphertext, encryptedDEK, err := crypto.Encrypt(data, kek)
+				require.NoError(t, err)
+				return ciphertext, map[string]string{dekTag: hex.EncodeToString(encryptedDEK)}
+			},
+			wantCode: http.StatusOK,
+			wantData: data,
+		},
+		"single ciphertext with legacy KEK": {
+			encrypt: func(t *testing.T) ([]byte, map[string]string) {
+				ciphertext, encryptedDEK, err := crypto.Encrypt(data, legacyKEK)
+				require.NoError(t, err)
+				return ciphertext, map[string]string{dekTag: hex.EncodeToString(encryptedDEK)}
+			},
+			allowLegacyKEK: true,
+			wantCode:       http.StatusOK,
+			wantData:       data,
+		},
+		"single ciphertext with legacy KEK not allowed": {
+			encrypt: func(t *testing.T) ([]byte, map[string]string) {
+				ciphertext, encryptedDEK, err := crypto.Encrypt(data, legacyKEK)
+				require.NoError(t, err)
+				return ciphertext, map[string]string{dekTag: hex.EncodeToString(encryptedDEK)}
+			},
+			wantCode: http.StatusInternalServerError,
+		},
+		"single ciphertext with unknown KEK": {
+			encrypt: func(t *testing.T) ([]byte, map[string]string) {
+				ciphertext, encryptedDEK, err := crypto.Encrypt(data, [32]byte{0x02})
+				require.NoError(t, err)
+				return ciphertext, map[string]string{dekTag: hex.EncodeToString(encryptedDEK)}
+			},
+			wantCode: http.StatusInternalServerError,
+		},
+	}
+
+	for name, tc := range testCases {
+		t.Run(name, func(t *testing.T) {
+			assert := assert.New(t)
+
+			client := newStubS3Client()
+			client.objects["bucket/key"], client.metadata["bucket/key"] = tc.encrypt(t)
+			keys := newTestKeyring(kek)
+			if tc.allowLegacyKEK {
+				keys = keys.withLegacyKEK(logger.NewTest(t))
+			}
+			obj := object{
+				keys:   keys,
+				client: client,
+				bucket: "bucket",
+				key:    "key",
+				log:    logger.NewTest(t),
+			}
+
+			rec := httptest.NewRecorder()
+			obj.get(rec, httptest.NewRequest(http.MethodGet, "/bucket/key", nil))
+			assert.Equal(tc.wantCode, rec.Code)
+			if tc.wantCode == http.StatusOK {
+				assert.Equal(tc.wantData, rec.Body.Bytes())
+			}
+		})
+	}
+}
+
+func TestGetTruncatedObject(t *testing.T) {
+	kek := [32]byte{0x01}
+	parts := [][]byte{bytes.Repeat([]byte("a"), crypto.SegmentSize+1), []byte("hello, world")}
+
+	testCases := map[string]struct {
+		keepFrames  int
+		corruptLast bool
+		wantPanic   bool
+	}{
+		"complete object": {
+			keepFrames: 2,
+		},
+		"last frame dropped": {
+			// The object doesn't match the size of its layout, which is detected before the response is started.
+			keepFrames: 1,
+		},
+		"all frames dropped": {
+			keepFrames: 0,
+		},
+		"last frame corrupted": {
+			keepFrames:  2,
+			corruptLast: true,
+			wantPanic:   true,
+		},
+	}
+
+	for name, tc := range testCases {
+		t.Run(name, func(t *testing.T) {
+			assert := assert.New(t)
+			require := require.New(t)
+
+			dek, encryptedDEK, err := crypto.GenerateDEK(kek)
+			require.NoError(err)
+			client := newStubS3Client()
+			client.objects["bucket/key"] = encryptFrames(t, dek, parts[:tc.keepFrames]...)
+			if tc.corruptLast {
+				client.objects["bucket/key"][len(client.objects["bucket/key"])-1] ^= 0x01
+			}
+			client.metadata["bucket/key"] = map[string]string{
+				dekTag:    hex.EncodeToString(encryptedDEK),
+				formatTag: multipartStreamFormat,
+				layoutTag: sealLayout(t, dek, parts...),
+			}
+			obj := object{
+				keys:   newTestKeyring(kek),
+				client: client,
+				bucket: "bucket",
+				key:    "key",
+				log:    logger.NewTest(t),
+			}
+
+			rec := httptest.NewRecorder()
+			get := func() { obj.get(rec, httptest.NewRequest(http.MethodGet, "/bucket/key", nil)) }
+			if tc.wantPanic {
+				// The response was already started, so the handler aborts it.
+				assert.PanicsWithValue(http.ErrAbortHandler, get)
+				assert.Less(rec.Body.Len(), len(parts[0])+len(parts[1]))
+				return
+			}
+			get()
+			if tc.keepFrames < len(parts) {
+				assert.Equal(http.StatusInternalServerError, rec.Code)
+				return
+			}
+			assert.Equal(http.StatusOK, rec.Code)
+			assert.Equal(append(append([]byte{}, parts[0]...), parts[1]...), rec.Body.Bytes())
+		})
+	}
+}
@@ -0,0 +1,468 @@
+/*
+Copyright (c) Edgeless Systems GmbH
+
+SPDX-License-Identifier: BUSL-1.1
+*/
+
+package router
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/aws/aws-sdk-go-v2/service/s3"
+	"github.com/edgelesssys/constellation/v2/s3proxy/internal/crypto"
+)
+
+// errRangeNotSatisfiable is returned if a range does not overlap with the object.
+var errRangeNotSatisfiable = errors.New("range not satisfiable")
+
+// byteRange is a range of bytes. Both start and end are inclusive.
+type byteRange struct {
+	start int64
+	end   int64
+}
+
+// parseRange parses the value of a Range header for an object of the given size.
+// Only single ranges are supported, as is the case for the S3 API.
+// If the header is malformed, ok is false and the header should be ignored.
+// If the range does not overlap with the object, errRangeNotSatisfiable is returned.
+func parseRange(header string, size int64) (rng byteRange, ok bool, err error) {
+	spec, found := strings.CutPrefix(header, "bytes=")
+	if !found || strings.Contains(spec, ",") {
+		return byteRange{}, false, nil
+	}
+	rawStart, rawEnd, found := strings.Cut(strings.TrimSpace(spec), "-")
+	if !found {
+		return byteRange{}, false, nil
+	}
+
+	// A suffix range requests the last bytes of the object.
+	if rawStart == "" {
+		length, err := strconv.ParseInt(rawEnd, 10, 64)
+		if err != nil || length < 0 {
+			return byteRange{}, false, nil
+		}
+		if length == 0 || size == 0 {
+			return byteRange{}, true, errRangeNotSatisfiable
+		}
+		return byteRange{start: max(0, size-length), end: size - 1}, true, nil
+	}
+
+	start, err := strconv.ParseInt(rawStart, 10, 64)
+	if err != nil || start < 0 {
+		return byteRange{}, false, nil
+	}
+	end := size - 1
+	if rawEnd != "" {
+		end, err = strconv.ParseInt(rawEnd, 10, 64)
+		if err != nil || end < start {
+			return byteRange{}, false, nil
+		}
+		end = min(end, size-1)
+	}
+	if start >= size {
+		return byteRange{}, true, errRangeNotSatisfiable
+	}
+
+	return byteRange{start: start, end: end}, true, nil
+}
+
+// length returns the number of bytes in the range.
+func (r byteRange) length() int64 {
+	return r.end - r.start + 1
+}
+
+// setHeaders sets the headers of a 206 response serving the range of an object of the given size.
+func (r byteRange) setHeaders(w http.ResponseWriter, size int64) {
+	w.Header().Set("Content-Range", fmt.Sprintf("bytes %d-%d/%d", r.start, r.end, size))
+	w.Header().Set("Content-Length", strconv.FormatInt(r.length(), 10))
+}
+
+// writeRangeNotSatisfiable writes a 416 response for an object of the given size.
+func writeRangeNotSatisfiable(w http.ResponseWriter, size int64) {
+	w.Header().Set("Content-Range", fmt.Sprintf("bytes */%d", size))
+	http.Error(w, "the requested range is not satisfiable", http.StatusRequestedRangeNotSatisfiable)
+}
+
+// getRange implements GET requests with a Range header.
+// For objects in the stream format, only the segments covering the requested range are fetched from S3 and decrypted.
+func (o object) getRange(w http.ResponseWriter, r *http.Request) {
+	o.log.With(slog.String("key", o.key), slog.String("host", o.bucket), slog.String("range", o.rangeHeader)).Debug("getObject range")
+
+	// Fetch the header of the first frame. The response also tells us the object's metadata and size.
+	probe, err := o.client.GetObject(r.Context(), o.bucket, o.key, o.versionID(), fmt.Sprintf("bytes=0-%d", crypto.FrameHeaderSize-1), "", o.sseCustomerAlgorithm, o.sseCustomerKey, o.sseCustomerKeyMD5)
+	if err != nil {
+		o.log.With(slog.Any("error", err)).Error("GetObject sending request to S3")
+		writeS3Error(w, err)
+		return
+	}
+	defer probe.Body.Close()
+
+	// All further requests have to read the same object, even if it is overwritten in the meantime.
+	var etag string
+	if probe.ETag != nil {
+		etag = *probe.ETag
+	}
+
+	_, encrypted := probe.Metadata[dekTag]
+	format := probe.Metadata[formatTag]
+	if !encrypted || (format != streamFormat && format != multipartStreamFormat) {
+		// Unencrypted objects can be served by S3 directly.
+		// Objects in legacy formats have to be decrypted as a whole, so we fetch them completely.
+		byteRange := ""
+		if !encrypted {
+			byteRange = o.rangeHeader
+		}
+		output, err := o.client.GetObject(r.Context(), o.bucket, o.key, o.versionID(), byteRange, etag, o.sseCustomerAlgorithm, o.sseCustomerKey, o.sseCustomerKeyMD5)
+		if err != nil {
+			o.log.With(slog.Any("error", err)).Error("GetObject sending request to S3")
+			writeS3Error(w, err)
+			return
+		}
+		defer output.Body.Close()
+		setObjectHeaders(w, output)
+
+		if !encrypted {
+			status := http.StatusOK
+			if output.ContentRange != nil {
+				w.Header().Set("Content-Range", *output.ContentRange)
+				status = http.StatusPartialContent
+			}
+			if output.ContentLength != nil {
+				w.Header().Set("Content-Length", strconv.FormatInt(*output.ContentLength, 10))
+			}
+			o.writeBody(w, status, output.Body)
+			return
+		}
+
+		o.getLegacy(w, output.Body, output.Metadata)
+		return
+	}
+
+	dek, _, err := o.keys.unwrapDEK(probe.Metadata)
+	if err != nil {
+		o.log.With(slog.Any("error", err)).Error("GetObject unwrapping DEK")
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	if probe.ContentRange == nil {
+		o.log.Error("GetObject S3 response is missing the Content-Range header")
+		http.Error(w, "S3 response is missing the Content-Range header", http.StatusInternalServerError)
+		return
+	}
+	ciphertextSize, err := parseContentRangeSize(*probe.ContentRange)
+	if err != nil {
+		o.log.With(slog.Any("error", err)).Error("GetObject parsing Content-Range")
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	layout, err := streamLayout(probe.Metadata, dek, ciphertextSize)
+	if err != nil {
+		o.log.With(slog.Any("error", err)).Error("GetObject reading layout")
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	// S3 answers range requests for empty objects with the empty object, not with 416.
+	if layout.PlaintextSize == 0 {
+		setObjectHeaders(w, probe)
+		w.Header().Set("Content-Length", "0")
+		w.WriteHeader(http.StatusOK)
+		return
+	}
+
+	index, err := o.frameIndex(r.Context(), probe, etag, ciphertextSize, layout)
+	if err != nil {
+		o.log.With(slog.Any("error", err)).Error("GetObject reading frame headers")
+		writeS3Error(w, err)
+		return
+	}
+
+	rng, ok, err := parseRange(o.rangeHeader, index.plaintextSize)
+	if err != nil {
+		writeRangeNotSatisfiable(w, index.plaintextSize)
+		return
+	}
+	if !ok {
+		// Malformed Range headers are ignored, as done by S3.
+		o.rangeHeader = ""
+		o.get(w, r)
+		return
+	}
+
+	ranges := &rangeReader{
+		ctx:    r.Context(),
+		object: o,
+		etag:   etag,
+		dek:    dek,
+		frames: index.frames,
+		rng:    rng,
+	}
+	// The response body of the frame that is read when sending the response fails has to be closed.
+	defer ranges.Close()
+	plaintext := bufio.NewReaderSize(ranges, crypto.SegmentSize)
+	// Decrypt the first segment before sending the response, so that we can still report errors with a proper status code.
+	if _, err := plaintext.Peek(1); err != nil {
+		o.log.With(slog.Any("error", err)).Error("GetObject decrypting range")
+		writeS3Error(w, err)
+		return
+	}
+
+	setObjectHeaders(w, probe)
+	rng.setHeaders(w, index.plaintextSize)
+	o.writeBody(w, http.StatusPartialContent, plaintext)
+}
+
+// frameIndex returns the frames of an object in the stream format.
+// The probe holds the response to a request for the first frame header.
+// The position of each frame is taken from the object's layout. Only the header of the first frame is known,
+// the other headers are fetched when their frame is read.
+// Layouts of objects with irregular frames don't list them, so each frame header has to be read from the object.
+// Those indices are cached and checked against the layout, so that frames dropped from the end of the object are detected.
+func (o object) frameIndex(ctx context.Context, probe *s3.GetObjectOutput, etag string, ciphertextSize int64, layout crypto.Layout) (frameIndex, error) {
+	first, err := readFrameHeader(probe.Body)
+	if err != nil {
+		return frameIndex{}, err
+	}
+
+	if len(layout.Frames) > 0 {
+		index := frameIndex{}
+		var offset int64
+		for _, frame := range layout.Frames {
+			index.add(crypto.Frame{Number: frame.Number, PlaintextSize: frame.PlaintextSize}, offset)
+			offset += frame.CiphertextSize()
+		}
+		if offset != ciphertextSize {
+			return frameIndex{}, fmt.Errorf("object holds %d bytes, but its layout ends after %d bytes", ciphertextSize, offset)
+		}
+		index.frames[0], err = index.frames[0].withHeader(first)
+		if err != nil {
+			return frameIndex{}, err
+		}
+		return index, nil
+	}
+
+	cacheKey := objectVersion{bucket: o.bucket, key: o.key, etag: etag}
+	if etag != "" {
+		if index, ok := o.frames.get(cacheKey); ok {
+			return index, nil
+		}
+	}
+
+	index := frameIndex{}
+	index.add(first, 0)
+	for offset := first.CiphertextSize(); offset < ciphertextSize; {
+		frame, err := o.readFrameHeaderAt(ctx, etag, offset)
+		if err != nil {
+			return frameIndex{}, err
+		}
+		if last := index.frames[len(index.frames)-1]; frame.Number <= last.Number {
+			return frameIndex{}, fmt.Errorf("frame %d follows frame %d", frame.Number, last.Number)
+		}
+		index.add(frame, offset)
+		offset += frame.CiphertextSize()
+	}
+
+	if last := index.frames[len(index.frames)-1]; last.offset+last.CiphertextSize() != ciphertextSize {
+		return frameIndex{}, fmt.Errorf("object holds %d bytes, but its frames end after %d bytes", ciphertextSize, last.offset+last.CiphertextSize())
+	}
+	frames := make([]crypto.Frame, 0, len(index.frames))
+	for _, frame := range index.frames {
+		frames = append(frames, frame.Frame)
+	}
+	if err := layout.CheckFrames(frames); err != nil {
+		return frameIndex{}, err
+	}
+
+	if etag != "" {
+		o.frames.put(cacheKey, index)
+	}
+	return index, nil
+}
+
+// readFrameHeaderAt fetches and parses the frame header at the given offset of the object.
+func (o object) readFrameHeaderAt(ctx context.Context, etag string, offset int64) (crypto.Frame, error) {
+	byteRange := fmt.Sprintf("bytes=%d-%d", offset, offset+crypto.FrameHeaderSize-1)
+	output, err := o.client.GetObject(ctx, o.bucket, o.key, o.versionID(), byteRange, etag, o.sseCustomerAlgorithm, o.sseCustomerKey, o.sseCustomerKeyMD5)
+	if err != nil {
+		return crypto.Frame{}, err
+	}
+	defer output.Body.Close()
+	return readFrameHeader(output.Body)
+}
+
+// readFrameHeader reads and parses a frame header.
+func readFrameHeader(body io.Reader) (crypto.Frame, error) {
+	header := make([]byte, crypto.FrameHeaderSize)
+	if _, err := io.ReadFull(body, header); err != nil {
+		return crypto.Frame{}, fmt.Errorf("reading frame header: %w", err)
+	}
+	return crypto.ParseFrameHeader(header)
+}
+
+// parseContentRangeSize returns the complete size of an object from a Content-Range header.
+func parseContentRangeSize(contentRange string) (int64, error) {
+	_, rawSize, found := strings.Cut(contentRange, "/")
+	if !found {
+		return 0, fmt.Errorf("malformed Content-Range %q", contentRange)
+	}
+	size, err := strconv.ParseInt(rawSize, 10, 64)
+	if err != nil {
+		return 0, fmt.Errorf("malformed Content-Range %q: %w", contentRange, err)
+	}
+	return size, nil
+}
+
+// rangeReader returns the plaintext of a range of an object in the stream format.
+// It fetches and decrypts the segments covering the range frame by frame.
+// It has to be closed, so that the response body of the current frame is closed if reading stops early.
+type rangeReader struct {
+	ctx    context.Context
+	object object
+	etag   string
+	dek    []byte
+	frames []indexedFrame
+	rng    byteRange
+
+	current io.Reader
+	body    io.Closer
+}
+
+// Read implements io.Reader.
+func (r *rangeReader) Read(p []byte) (int, error) {
+	for {
+		if r.current != nil {
+			n, err := r.current.Read(p)
+			if !errors.Is(err, io.EOF) {
+				return n, err
+			}
+			r.Close()
+			if n > 0 {
+				return n, nil
+			}
+		}
+
+		if err := r.openNext(); err != nil {
+			return 0, err
+		}
+	}
+}
+
+// Close closes the response body of the frame that is currently read.
+func (r *rangeReader) Close() error {
+	if r.body == nil {
+		return nil
+	}
+	err := r.body.Close()
+	r.current, r.body = nil, nil
+	return err
+}
+
+// openNext fetches the ciphertext for the next frame that overlaps with the range.
+// It returns io.EOF if no such frame is left.
+func (r *rangeReader) openNext() error {
+	for len(r.frames) > 0 {
+		frame := r.frames[0]
+		r.frames = r.frames[1:]
+
+		frameEnd := frame.plaintextOffset + frame.PlaintextSize - 1
+		if frame.PlaintextSize == 0 || frameEnd < r.rng.start || frame.plaintextOffset > r.rng.end {
+			continue
+		}
+		start := max(r.rng.start, frame.plaintextOffset) - frame.plaintextOffset
+		end := min(r.rng.end, frameEnd) - frame.plaintextOffset
+
+		first, last, segment, err := frame.CiphertextRange(start, end)
+		if err != nil {
+			return err
+		}
+		o := r.object
+
+		// Frames taken from the layout lack their header, which holds the nonce prefix.
+		// If the range starts at the first segment, the header is fetched with the same request.
+		rangeStart := frame.offset + first
+		if frame.Header == nil {
+			if segment == 0 {
+				rangeStart = frame.offset
+			} else {
+				header, err := o.readFrameHeaderAt(r.ctx, r.etag, frame.offset)
+				if err != nil {
+					return err
+				}
+				if frame, err = frame.withHeader(header); err != nil {
+					return err
+				}
+			}
+		}
+
+		byteRange := fmt.Sprintf("bytes=%d-%d", rangeStart, frame.offset+last)
+		output, err := o.client.GetObject(r.ctx, o.bucket, o.key, o.versionID(), byteRange, r.etag, o.sseCustomerAlgorithm, o.sseCustomerKey, o.sseCustomerKeyMD5)
+		if err != nil {
+			return err
+		}
+		if frame.Header == nil {
+			header, err := readFrameHeader(output.Body)
+			if err == nil {
+				frame, err = frame.withHeader(header)
+			}
+			if err != nil {
+				output.Body.Close()
+				return err
+			}
+		}
+
+		decrypter, err := frame.NewDecryptingReader(output.Body, segment, r.dek)
+		if err != nil {
+			output.Body.Close()
+			return err
+		}
+		// Skip the plaintext that precedes the range within the first segment.
+		if _, err := io.CopyN(io.Discard, decrypter, start-segment*crypto.SegmentSize); err != nil {
+			output.Body.Close()
+			return err
+		}
+
+		r.current = io.LimitReader(decrypter, end-start+1)
+		r.body = output.Body
+		return nil
+	}
+	return io.EOF
+}
+
+// frameIndex lists the frames of an object in the stream format.
+type frameIndex struct {
+	frames        []indexedFrame
+	plaintextSize int64
+}
+
+// indexedFrame is a frame and its position within an object.
+type indexedFrame struct {
+	crypto.Frame
+	// offset is the position of the frame's header in the ciphertext.
+	offset int64
+	// plaintextOffset is the position of the frame's first plaintext byte in the object.
+	plaintextOffset int64
+}
+
+// withHeader returns the frame with the given header, which has to match the frame.
+func (f indexedFrame) withHeader(header crypto.Frame) (indexedFrame, error) {
+	if header.Number != f.Number || header.PlaintextSize != f.PlaintextSize {
+		return indexedFrame{}, fmt.Errorf("header of frame %d holding %d bytes doesn't match frame %d holding %d bytes", header.Number, header.PlaintextSize, f.Number, f.PlaintextSize)
+	}
+	f.Frame = header
+	return f, nil
+}
+
+func (i *frameIndex) add(frame crypto.Frame, offset int64) {
+	i.frames = append(i.frames, indexedFrame{Frame: frame, offset: offset, plaintextOffset: i.plaintextSize})
+	i.plaintextSize += frame.PlaintextSize
+}
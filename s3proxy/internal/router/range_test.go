@@ -0,0 +1,451 @@
+/*
+Copyright (c) Edgeless Systems GmbH
+
+SPDX-License-Identifier: BUSL-1.1
+*/
+
+package router
+
+import (
+	"bytes"
+	"crypto/rand"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/edgelesssys/constellation/v2/internal/logger"
+	"github.com/edgelesssys/constellation/v2/s3proxy/internal/crypto"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestParseRange(t *testing.T) {
+	testCases := map[string]struct {
+		header    string
+		size      int64
+		wantRange byteRange
+		wantOK    bool
+		wantErr   bool
+	}{
+		"start and end":             {header: "bytes=10-19", size: 100, wantRange: byteRange{start: 10, end: 19}, wantOK: true},
+		"end beyond object":         {header: "bytes=90-200", size: 100, wantRange: byteRange{start: 90, end: 99}, wantOK: true},
+		"open end":                  {header: "bytes=50-", size: 100, wantRange: byteRange{start: 50, end: 99}, wantOK: true},
+		"suffix":                    {header: "bytes=-10", size: 100, wantRange: byteRange{start: 90, end: 99}, wantOK: true},
+		"suffix longer than object": {header: "bytes=-200", size: 100, wantRange: byteRange{start: 0, end: 99}, wantOK: true},
+		"start beyond object":       {header: "bytes=100-", size: 100, wantOK: true, wantErr: true},
+		"empty suffix":              {header: "bytes=-0", size: 100, wantOK: true, wantErr: true},
+		"empty object":              {header: "bytes=0-", size: 0, wantOK: true, wantErr: true},
+		"multiple ranges":           {header: "bytes=0-1,5-6", size: 100},
+		"wrong unit":                {header: "items=0-1", size: 100},
+		"end before start":          {header: "bytes=5-1", size: 100},
+		"not a number":              {header: "bytes=a-b", size: 100},
+		"missing dash":              {header: "bytes=5", size: 100},
+	}
+
+	for name, tc := range testCases {
+		t.Run(name, func(t *testing.T) {
+			assert := assert.New(t)
+
+			rng, ok, err := parseRange(tc.header, tc.size)
+			assert.Equal(tc.wantOK, ok)
+			if tc.wantErr {
+				assert.ErrorIs(err, errRangeNotSatisfiable)
+				return
+			}
+			assert.NoError(err)
+			assert.Equal(tc.wantRange, rng)
+		})
+	}
+}
+
+func TestGetObjectRange(t *testing.T) {
+	kek := [32]byte{0x01}
+	data := make([]byte, 3*crypto.SegmentSize+100)
+	_, err := rand.Read(data)
+	require.NoError(t, err)
+	size := int64(len(data))
+
+	singleFrame := func(t *testing.T) ([]byte, map[string]string) {
+		dek, encryptedDEK, err := crypto.GenerateDEK(kek)
+		require.NoError(t, err)
+		return encryptFrames(t, dek, data), map[string]string{dekTag: hex.EncodeToString(encryptedDEK), formatTag: streamFormat}
+	}
+	multipleFrames := func(t *testing.T) ([]byte, map[string]string) {
+		dek, encryptedDEK, err := crypto.GenerateDEK(kek)
+		require.NoError(t, err)
+		parts := [][]byte{data[:crypto.SegmentSize+10], data[crypto.SegmentSize+10 : crypto.SegmentSize+10], data[crypto.SegmentSize+10:]}
+		return encryptFrames(t, dek, parts...), map[string]string{
+			dekTag:    hex.EncodeToString(encryptedDEK),
+			formatTag: multipartStreamFormat,
+			layoutTag: sealLayout(t, dek, parts...),
+		}
+	}
+	droppedFrame := func(t *testing.T) ([]byte, map[string]string) {
+		dek, encryptedDEK, err := crypto.GenerateDEK(kek)
+		require.NoError(t, err)
+		parts := [][]byte{data[:crypto.SegmentSize+10], data[crypto.SegmentSize+10:]}
+		return encryptFrames(t, dek, parts[0]), map[string]string{
+			dekTag:    hex.EncodeToString(encryptedDEK),
+			formatTag: multipartStreamFormat,
+			layoutTag: sealLayout(t, dek, parts...),
+		}
+	}
+	irregularFrames := func(t *testing.T) ([]byte, map[string]string) {
+		dek, encryptedDEK, err := crypto.GenerateDEK(kek)
+		require.NoError(t, err)
+		// Frames of distinct sizes can't be listed in the layout.
+		var parts [][]byte
+		rest := data
+		for i := 1; i <= 40; i++ {
+			parts = append(parts, rest[:i])
+			rest = rest[i:]
+		}
+		parts = append(parts, rest)
+		return encryptFrames(t, dek, parts...), map[string]string{
+			dekTag:    hex.EncodeToString(encryptedDEK),
+			formatTag: multipartStreamFormat,
+			layoutTag: sealLayout(t, dek, parts...),
+		}
+	}
+	legacy := func(t *testing.T) ([]byte, map[string]string) {
+		ciphertext, encryptedDEK, err := crypto.Encrypt(data, kek)
+		require.NoError(t, err)
+		return ciphertext, map[string]string{dekTag: hex.EncodeToString(encryptedDEK)}
+	}
+	unencrypted := func(*testing.T) ([]byte, map[string]string) {
+		return data, map[string]string{}
+	}
+
+	testCases := map[string]struct {
+		object           func(t *testing.T) ([]byte, map[string]string)
+		rangeHeader      string
+		wantCode         int
+		wantStart        int64
+		wantEnd          int64
+		maxCiphertextLen int64
+		maxRequests      int
+	}{
+		"single frame, within one segment": {
+			object:      singleFrame,
+			rangeHeader: "bytes=10-19",
+			wantCode:    http.StatusPartialContent,
+			wantStart:   10,
+			wantEnd:     19,
+			// The frame header and the first segment.
+			maxCiphertextLen: 2*crypto.FrameHeaderSize + crypto.SegmentSize + 16,
+		},
+		"single frame, across segments": {
+			object:           singleFrame,
+			rangeHeader:      fmt.Sprintf("bytes=%d-%d", crypto.SegmentSize-1, 2*crypto.SegmentSize),
+			wantCode:         http.StatusPartialContent,
+			wantStart:        crypto.SegmentSize - 1,
+			wantEnd:          2 * crypto.SegmentSize,
+			maxCiphertextLen: crypto.FrameHeaderSize + 3*(crypto.SegmentSize+16),
+		},
+		"single frame, suffix": {
+			object:           singleFrame,
+			rangeHeader:      "bytes=-50",
+			wantCode:         http.StatusPartialContent,
+			wantStart:        size - 50,
+			wantEnd:          size - 1,
+			maxCiphertextLen: crypto.FrameHeaderSize + 100 + 16,
+		},
+		"multiple frames": {
+			object:      multipleFrames,
+			rangeHeader: fmt.Sprintf("bytes=%d-%d", crypto.SegmentSize, crypto.SegmentSize+20),
+			wantCode:    http.StatusPartialContent,
+			wantStart:   crypto.SegmentSize,
+			wantEnd:     crypto.SegmentSize + 20,
+			// The first frame header, a segment of the first frame, and the header and a segment of the last frame.
+			maxRequests: 3,
+		},
+		"multiple frames, last frame": {
+			object:      multipleFrames,
+			rangeHeader: "bytes=-10",
+			wantCode:    http.StatusPartialContent,
+			wantStart:   size - 10,
+			wantEnd:     size - 1,
+			// The first frame header, the header of the last frame, and a segment of the last frame.
+			maxRequests: 3,
+		},
+		"irregular frames": {
+			object:      irregularFrames,
+			rangeHeader: "bytes=100-",
+			wantCode:    http.StatusPartialContent,
+			wantStart:   100,
+			wantEnd:     size - 1,
+		},
+		"multiple frames, whole object": {
+			object:      multipleFrames,
+			rangeHeader: "bytes=0-",
+			wantCode:    http.StatusPartialContent,
+			wantStart:   0,
+			wantEnd:     size - 1,
+		},
+		"multiple frames, last frame dropped": {
+			object:      droppedFrame,
+			rangeHeader: "bytes=0-9",
+			wantCode:    http.StatusInternalServerError,
+		},
+		"legacy format": {
+			object:      legacy,
+			rangeHeader: "bytes=5-9",
+			wantCode:    http.StatusPartialContent,
+			wantStart:   5,
+			wantEnd:     9,
+		},
+		"unencrypted": {
+			object:      unencrypted,
+			rangeHeader: "bytes=5-9",
+			wantCode:    http.StatusPartialContent,
+			wantStart:   5,
+			wantEnd:     9,
+		},
+		"not satisfiable": {
+			object:      singleFrame,
+			rangeHeader: fmt.Sprintf("bytes=%d-", size),
+			wantCode:    http.StatusRequestedRangeNotSatisfiable,
+		},
+		"malformed range is ignored": {
+			object:      singleFrame,
+			rangeHeader: "bytes=5-1",
+			wantCode:    http.StatusOK,
+			wantStart:   0,
+			wantEnd:     size - 1,
+		},
+	}
+
+	for name, tc := range testCases {
+		t.Run(name, func(t *testing.T) {
+			assert := assert.New(t)
+			require := require.New(t)
+
+			client := newStubS3Client()
+			client.objects["bucket/key"], client.metadata["bucket/key"] = tc.object(t)
+			obj := object{
+				keys:        newTestKeyring(kek),
+				client:      client,
+				bucket:      "bucket",
+				key:         "key",
+				rangeHeader: tc.rangeHeader,
+				frames:      newObjectCache[frameIndex](),
+				log:         logger.NewTest(t),
+			}
+
+			rec := httptest.NewRecorder()
+			obj.get(rec, httptest.NewRequest(http.MethodGet, "/bucket/key", nil))
+			require.Equal(tc.wantCode, rec.Code)
+			assert.Zero(client.openBodies)
+			if tc.wantCode == http.StatusRequestedRangeNotSatisfiable {
+				assert.Equal(fmt.Sprintf("bytes */%d", size), rec.Header().Get("Content-Range"))
+				return
+			}
+			if tc.wantCode == http.StatusInternalServerError {
+				return
+			}
+
+			assert.Equal(data[tc.wantStart:tc.wantEnd+1], rec.Body.Bytes())
+			assert.Equal(fmt.Sprint(tc.wantEnd-tc.wantStart+1), rec.Header().Get("Content-Length"))
+			if tc.wantCode == http.StatusPartialContent {
+				assert.Equal(fmt.Sprintf("bytes %d-%d/%d", tc.wantStart, tc.wantEnd, size), rec.Header().Get("Content-Range"))
+			}
+			if tc.maxCiphertextLen != 0 {
+				assert.LessOrEqual(client.bytesRead, tc.maxCiphertextLen)
+			}
+			if tc.maxRequests != 0 {
+				assert.LessOrEqual(client.getRequests, tc.maxRequests)
+			}
+		})
+	}
+}
+
+func TestGetObjectRangeAborted(t *testing.T) {
+	assert := assert.New(t)
+	require := require.New(t)
+
+	kek := [32]byte{0x01}
+	data := make([]byte, 3*crypto.SegmentSize)
+	_, err := rand.Read(data)
+	require.NoError(err)
+	dek, encryptedDEK, err := crypto.GenerateDEK(kek)
+	require.NoError(err)
+	parts := [][]byte{data[:crypto.SegmentSize], data[crypto.SegmentSize:]}
+
+	client := newStubS3Client()
+	client.objects["bucket/key"] = encryptFrames(t, dek, parts...)
+	client.metadata["bucket/key"] = map[string]string{
+		dekTag:    hex.EncodeToString(encryptedDEK),
+		formatTag: multipartStreamFormat,
+		layoutTag: sealLayout(t, dek, parts...),
+	}
+	obj := object{
+		keys:        newTestKeyring(kek),
+		client:      client,
+		bucket:      "bucket",
+		key:         "key",
+		rangeHeader: "bytes=10-",
+		frames:      newObjectCache[frameIndex](),
+		log:         logger.NewTest(t),
+	}
+
+	// The client disconnects while the second frame is sent.
+	w := &failingResponseWriter{ResponseWriter: httptest.NewRecorder(), limit: crypto.SegmentSize + 10}
+	assert.PanicsWithValue(http.ErrAbortHandler, func() {
+		obj.get(w, httptest.NewRequest(http.MethodGet, "/bucket/key", nil))
+	})
+	assert.Zero(client.openBodies)
+}
+
+// failingResponseWriter fails writes once more than limit bytes were written.
+type failingResponseWriter struct {
+	http.ResponseWriter
+	limit int
+}
+
+func (w *failingResponseWriter) Write(p []byte) (int, error) {
+	if len(p) > w.limit {
+		return 0, errors.New("connection reset by peer")
+	}
+	w.limit -= len(p)
+	return w.ResponseWriter.Write(p)
+}
+
+func TestGetEmptyObjectRange(t *testing.T) {
+	kek := [32]byte{0x01}
+
+	testCases := map[string]struct {
+		format string
+		parts  [][]byte
+	}{
+		"single frame": {
+			format: streamFormat,
+			parts:  [][]byte{{}},
+		},
+		"multiple frames": {
+			format: multipartStreamFormat,
+			parts:  [][]byte{{}, {}},
+		},
+	}
+
+	for name, tc := range testCases {
+		t.Run(name, func(t *testing.T) {
+			assert := assert.New(t)
+
+			dek, encryptedDEK, err := crypto.GenerateDEK(kek)
+			require.NoError(t, err)
+			client := newStubS3Client()
+			client.objects["bucket/key"] = encryptFrames(t, dek, tc.parts...)
+			client.metadata["bucket/key"] = map[string]string{dekTag: hex.EncodeToString(encryptedDEK), formatTag: tc.format}
+			if tc.format == multipartStreamFormat {
+				client.metadata["bucket/key"][layoutTag] = sealLayout(t, dek, tc.parts...)
+			}
+			obj := object{
+				keys:        newTestKeyring(kek),
+				client:      client,
+				bucket:      "bucket",
+				key:         "key",
+				rangeHeader: "bytes=0-10",
+				frames:      newObjectCache[frameIndex](),
+				log:         logger.NewTest(t),
+			}
+
+			rec := httptest.NewRecorder()
+			obj.get(rec, httptest.NewRequest(http.MethodGet, "/bucket/key", nil))
+			assert.Equal(http.StatusOK, rec.Code)
+			assert.Equal("0", rec.Header().Get("Content-Length"))
+			assert.Empty(rec.Body.Bytes())
+		})
+	}
+}
+
+func TestFrameIndexCache(t *testing.T) {
+	assert := assert.New(t)
+	require := require.New(t)
+
+	// Frames of distinct sizes can't be listed in the layout, so their headers have to be read.
+	irregular := func(prefix string) [][]byte {
+		parts := [][]byte{[]byte(prefix)}
+		for i := 1; i <= 40; i++ {
+			parts = append(parts, bytes.Repeat([]byte("x"), i))
+		}
+		return append(parts, []byte("world"))
+	}
+
+	kek := [32]byte{0x01}
+	dek, encryptedDEK, err := crypto.GenerateDEK(kek)
+	require.NoError(err)
+	client := newStubS3Client()
+	client.objects["bucket/key"] = encryptFrames(t, dek, irregular("hello, ")...)
+	client.metadata["bucket/key"] = map[string]string{
+		dekTag:    hex.EncodeToString(encryptedDEK),
+		formatTag: multipartStreamFormat,
+		layoutTag: sealLayout(t, dek, irregular("hello, ")...),
+	}
+
+	obj := object{
+		keys:        newTestKeyring(kek),
+		client:      client,
+		bucket:      "bucket",
+		key:         "key",
+		rangeHeader: "bytes=-5",
+		frames:      newObjectCache[frameIndex](),
+		log:         logger.NewTest(t),
+	}
+
+	rec := httptest.NewRecorder()
+	obj.get(rec, httptest.NewRequest(http.MethodGet, "/bucket/key", nil))
+	require.Equal(http.StatusPartialContent, rec.Code)
+	assert.Equal("world", rec.Body.String())
+	assert.Len(obj.frames.entries, 1)
+
+	// A changed object has a new ETag, so the cached index is not used.
+	client.objects["bucket/key"] = encryptFrames(t, dek, irregular("hi, ")...)
+	client.metadata["bucket/key"][layoutTag] = sealLayout(t, dek, irregular("hi, ")...)
+	obj.rangeHeader = "bytes=0-1"
+	rec = httptest.NewRecorder()
+	obj.get(rec, httptest.NewRequest(http.MethodGet, "/bucket/key", nil))
+	require.Equal(http.StatusPartialContent, rec.Code)
+	assert.Equal("hi", rec.Body.String())
+	assert.Len(obj.frames.entries, 2)
+
+	// Layouts listing their frames don't need an index.
+	client.objects["bucket/key"] = encryptFrames(t, dek, []byte("hello, "), []byte("world"))
+	client.metadata["bucket/key"][layoutTag] = sealLayout(t, dek, []byte("hello, "), []byte("world"))
+	obj.rangeHeader = "bytes=7-"
+	rec = httptest.NewRecorder()
+	obj.get(rec, httptest.NewRequest(http.MethodGet, "/bucket/key", nil))
+	require.Equal(http.StatusPartialContent, rec.Code)
+	assert.Equal("world", rec.Body.String())
+	assert.Len(obj.frames.entries, 2)
+}
+
+// encryptFrames encrypts each of the given plaintexts as a frame of the stream format.
+func encryptFrames(t *testing.T, dek []byte, plaintexts ...[]byte) []byte {
+	t.Helper()
+	var ciphertext []byte
+	for i, plaintext := range plaintexts {
+		reader, err := crypto.NewEncryptingReader(bytes.NewReader(plaintext), int64(len(plaintext)), dek, uint32(i+1))
+		require.NoError(t, err)
+		frame, err := io.ReadAll(reader)
+		require.NoError(t, err)
+		ciphertext = append(ciphertext, frame...)
+	}
+	return ciphertext
+}
+
+// sealLayout returns the sealed layout of an object created by encryptFrames, as stored in the object's metadata.
+func sealLayout(t *testing.T, dek []byte, plaintexts ...[]byte) string {
+	t.Helper()
+	var frames []crypto.Frame
+	for i, plaintext := range plaintexts {
+		frames = append(frames, crypto.Frame{Number: uint32(i + 1), PlaintextSize: int64(len(plaintext))})
+	}
+	sealed, err := crypto.NewLayout(frames).Seal(dek)
+	require.NoError(t, err)
+	return base64.StdEncoding.EncodeToString(sealed)
+}
@@ -0,0 +1,98 @@
+/*
+Copyright (c) Edgeless Systems GmbH
+
+SPDX-License-Identifier: BUSL-1.1
+*/
+
+package router
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"strings"
+)
+
+// RewrapResult summarizes a RewrapBucket run.
+type RewrapResult struct {
+	// Rewrapped is the number of objects whose DEK was wrapped with the latest KEK.
+	Rewrapped int
+	// Skipped is the number of objects that are not encrypted or already use the latest KEK.
+	Skipped int
+	// Failed is the number of objects that could not be rewrapped.
+	Failed int
+}
+
+// RewrapBucket wraps the DEKs of all objects in the given bucket with the latest KEK version.
+// The encrypted bodies are not re-encrypted: S3 copies every object onto itself, only replacing its metadata.
+// Objects that can't be rewrapped are logged and skipped, so that a single broken object doesn't block the rotation.
+// In versioned buckets, only the latest version of each object is rewrapped.
+// Objects s3proxy stores for itself, like the DEKs of multipart uploads in progress, are left untouched.
+func (r Router) RewrapBucket(ctx context.Context, bucket string) (RewrapResult, error) {
+	return rewrapBucket(ctx, r.clients.ForBucket(bucket), r.keys, bucket, r.log)
+}
+
+func rewrapBucket(ctx context.Context, client s3Client, keys keyring, bucket string, log *slog.Logger) (RewrapResult, error) {
+	var result RewrapResult
+	var continuationToken string
+	for {
+		page, err := client.ListObjects(ctx, bucket, continuationToken)
+		if err != nil {
+			return result, fmt.Errorf("listing objects: %w", err)
+		}
+
+		for _, object := range page.Contents {
+			if object.Key == nil || strings.HasPrefix(*object.Key, internalPrefix) {
+				continue
+			}
+			rewrapped, err := rewrapObject(ctx, client, keys, bucket, *object.Key)
+			switch {
+			case err != nil:
+				log.With(slog.String("key", *object.Key), slog.Any("error", err)).Error("Rewrapping object")
+				result.Failed++
+			case rewrapped:
+				log.With(slog.String("key", *object.Key)).Debug("Rewrapped object")
+				result.Rewrapped++
+			default:
+				result.Skipped++
+			}
+		}
+
+		if page.NextContinuationToken == nil || *page.NextContinuationToken == "" {
+			break
+		}
+		continuationToken = *page.NextContinuationToken
+	}
+
+	if result.Failed > 0 {
+		return result, fmt.Errorf("failed to rewrap %d objects", result.Failed)
+	}
+	return result, nil
+}
+
+// rewrapObject wraps the DEK of a single object with the latest KEK.
+// It returns false if the object doesn't need to be rewrapped.
+func rewrapObject(ctx context.Context, client s3Client, keys keyring, bucket, key string) (bool, error) {
+	head, err := client.HeadObject(ctx, bucket, key, "", "", "", "")
+	if err != nil {
+		return false, fmt.Errorf("getting object metadata: %w", err)
+	}
+	if _, ok := head.Metadata[dekTag]; !ok {
+		return false, nil
+	}
+
+	metadata, rewrap, err := keys.rewrapDEK(head.Metadata)
+	if err != nil {
+		return false, err
+	}
+	if !rewrap {
+		return false, nil
+	}
+
+	// The copy fails if the object was changed since the HeadObject call,
+	// so a concurrently written object is never overwritten with stale data.
+	if _, err := client.ReplaceMetadata(ctx, bucket, key, head, metadata, "", "", ""); err != nil {
+		return false, fmt.Errorf("replacing object metadata: %w", err)
+	}
+	return true, nil
+}
@@ -0,0 +1,116 @@
+/*
+Copyright (c) Edgeless Systems GmbH
+
+SPDX-License-Identifier: BUSL-1.1
+*/
+
+package router
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/edgelesssys/constellation/v2/internal/logger"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestRewrapBucket(t *testing.T) {
+	kekV1, kekV2 := [32]byte{0x01}, [32]byte{0x02}
+	oldKeys := newTestKeyring(kekV1)
+	newKeys, err := newKeyring(map[uint32][32]byte{1: kekV1, 2: kekV2})
+	require.NoError(t, err)
+	latestKeys, err := newKeyring(map[uint32][32]byte{2: kekV2})
+	require.NoError(t, err)
+
+	testCases := map[string]struct {
+		failingKeys   map[string]bool
+		wantResult    RewrapResult
+		wantReadable  []string
+		wantErr       bool
+		wantUnchanged []string
+	}{
+		"all objects rewrapped": {
+			wantResult:   RewrapResult{Rewrapped: 3, Skipped: 2},
+			wantReadable: []string{"old-0", "old-1", "old-2", "new", "plain"},
+		},
+		"failing object is skipped": {
+			failingKeys:   map[string]bool{"old-1": true},
+			wantResult:    RewrapResult{Rewrapped: 2, Skipped: 2, Failed: 1},
+			wantReadable:  []string{"old-0", "old-2", "new", "plain"},
+			wantUnchanged: []string{"old-1"},
+			wantErr:       true,
+		},
+	}
+
+	for name, tc := range testCases {
+		t.Run(name, func(t *testing.T) {
+			assert := assert.New(t)
+			require := require.New(t)
+
+			client := newStubS3Client()
+			client.listPageSize = 2
+			client.failingKeys = tc.failingKeys
+			for i := range 3 {
+				putTestObject(t, client, oldKeys, fmt.Sprintf("old-%d", i))
+			}
+			putTestObject(t, client, newKeys, "new")
+			client.objects["bucket/plain"] = []byte("hello, world")
+			client.metadata["bucket/plain"] = map[string]string{}
+			// objects stored by s3proxy for itself are not rewrapped
+			putTestObject(t, client, oldKeys, uploadObjectKey("upload-id"))
+
+			result, err := rewrapBucket(t.Context(), client, newKeys, "bucket", logger.NewTest(t))
+			if tc.wantErr {
+				assert.Error(err)
+			} else {
+				assert.NoError(err)
+			}
+			assert.Equal(tc.wantResult, result)
+
+			for _, key := range tc.wantReadable {
+				rec := getTestObject(t, client, latestKeys, key)
+				require.Equal(http.StatusOK, rec.Code, key)
+				assert.Equal("hello, world", rec.Body.String())
+			}
+			for _, key := range append(tc.wantUnchanged, uploadObjectKey("upload-id")) {
+				assert.Equal("1", client.metadata["bucket/"+key][kekVersionTag])
+			}
+		})
+	}
+}
+
+func putTestObject(t *testing.T, client *stubS3Client, keys keyring, key string) {
+	t.Helper()
+	req := httptest.NewRequest(http.MethodPut, "/bucket/"+key, strings.NewReader("hello, world"))
+	obj := object{
+		keys:          keys,
+		client:        client,
+		bucket:        "bucket",
+		key:           key,
+		metadata:      map[string]string{},
+		body:          newBodyReader(req),
+		contentLength: req.ContentLength,
+		log:           logger.NewTest(t),
+	}
+	rec := httptest.NewRecorder()
+	obj.put(rec, req)
+	require.Equal(t, http.StatusOK, rec.Code)
+}
+
+func getTestObject(t *testing.T, client *stubS3Client, keys keyring, key string) *httptest.ResponseRecorder {
+	t.Helper()
+	obj := object{
+		keys:   keys,
+		client: client,
+		bucket: "bucket",
+		key:    key,
+		log:    logger.NewTest(t),
+	}
+	rec := httptest.NewRecorder()
+	obj.get(rec, httptest.NewRequest(http.MethodGet, "/bucket/"+key, nil))
+	return rec
+}
@@ -16,6 +16,13 @@ The stored object will have a tag that holds an encrypted data encryption key (D
 That DEK is used to encrypt the object's body.
 The DEK is generated randomly for each PutObject request.
 The DEK is encrypted with a key encryption key (KEK) fetched from Constellation's keyservice.
+The KEK can be rotated: the router holds several KEK versions, wraps new DEKs with the latest one
+and records the version in the object's metadata. RewrapBucket moves existing objects to the latest version.
+
+Multipart uploads are encrypted in the same way: CreateMultipartUpload generates a DEK for the whole upload
+and attaches it to the object's metadata. Each UploadPart request is encrypted separately with that DEK,
+so that the completed object is a sequence of individually encrypted parts.
+While the upload is in progress, the wrapped DEK is kept in a separate object, so that any s3proxy instance can encrypt its parts.
 */
 package router
 
@@ -23,11 +30,11 @@ import (
 	"bytes"
 	"context"
 	"crypto/md5"
-	"crypto/sha256"
 	"encoding/base64"
 	"encoding/xml"
 	"fmt"
 	"log/slog"
+	"net"
 	"net/http"
 	"net/url"
 	"regexp"
@@ -41,89 +48,129 @@ import (
 const (
 	// Use a 32*8 = 256 bit key for AES-256.
 	kekSizeBytes = 32
-	kekID        = "s3proxy-kek"
+	// kekBaseID is the ID of the first KEK version. The IDs of later versions are derived from it, see kekID.
+	kekBaseID = "s3proxy-kek"
+	// maxPartNumber is the highest part number S3 accepts for multipart uploads.
+	maxPartNumber = 10000
 )
 
 var (
 	keyPattern          = regexp.MustCompile("/(.+)")
 	bucketAndKeyPattern = regexp.MustCompile("/([^/?]+)/(.+)")
+	bucketPattern       = regexp.MustCompile("^/([^/?]+)/?$")
 )
 
 // Router implements the interception logic for the s3proxy.
 type Router struct {
-	region string
-	kek    [32]byte
+	// clients holds the S3 clients for the configured backends.
+	clients *s3.Clients
+	// endpoint is the URL of the default backend, or nil for AWS S3. It is used to find bucket names in host names.
+	endpoint *url.URL
+	// pathStyle is true if clients address buckets in the request path instead of the host name.
+	pathStyle bool
+	// keys holds the KEK versions used to wrap and unwrap DEKs.
+	keys keyring
 	// forwardMultipartReqs controls whether we forward the following requests: CreateMultipartUpload, UploadPart, CompleteMultipartUpload, AbortMultipartUpload.
-	// s3proxy does not implement those yet.
-	// Setting forwardMultipartReqs to true will forward those requests to the S3 API, otherwise we block them (secure defaults).
+	// Setting forwardMultipartReqs to true will forward those requests to the S3 API without encrypting them,
+	// otherwise we intercept and encrypt them (secure defaults).
 	forwardMultipartReqs bool
-	log                  *slog.Logger
+	// uploads caches the DEKs of multipart uploads that are in progress.
+	uploads *uploadStore
+	// frames caches the frame indices of objects whose layout doesn't list their frames, speeding up range requests.
+	frames *objectCache[frameIndex]
+	// sizes caches the plaintext sizes of objects, speeding up ListObjects requests.
+	sizes *objectCache[int64]
+	log   *slog.Logger
 }
 
 // New creates a new Router.
-func New(region, endpoint string, forwardMultipartReqs bool, log *slog.Logger) (Router, error) {
-	kms := kms.New(log, endpoint)
-
-	// Get the key encryption key that encrypts all DEKs.
-	kek, err := kms.GetDataKey(context.Background(), kekID, kekSizeBytes)
+// Requests are sent to the S3-compatible backends described by backends.
+// The KEK versions from oldestKEKVersion to latestKEKVersion are fetched from the keyservice at kmsEndpoint.
+// New objects are encrypted using the latest version, objects encrypted with any of the fetched versions can be decrypted.
+// If allowLegacyKEK is true, DEKs of objects written by earlier versions of s3proxy that used the all-zero KEK
+// can be unwrapped as well. This must only be enabled while rewrapping those objects.
+func New(backends s3.Config, kmsEndpoint string, oldestKEKVersion, latestKEKVersion uint32, allowLegacyKEK, forwardMultipartReqs bool, log *slog.Logger) (Router, error) {
+	clients, err := s3.NewClients(backends)
 	if err != nil {
-		return Router{}, fmt.Errorf("getting KEK: %w", err)
+		return Router{}, fmt.Errorf("creating S3 clients: %w", err)
 	}
+	endpoint, err := backends.EndpointURL()
+	if err != nil {
+		return Router{}, err
+	}
+
+	kms := kms.New(log, kmsEndpoint)
 
-	kekArray, err := byteSliceToByteArray(kek)
+	// Get the key encryption keys that encrypt all DEKs.
+	keys, err := fetchKeyring(context.Background(), kms, oldestKEKVersion, latestKEKVersion)
 	if err != nil {
-		return Router{}, fmt.Errorf("converting KEK to byte array: %w", err)
+		return Router{}, fmt.Errorf("getting KEKs: %w", err)
+	}
+	if allowLegacyKEK {
+		log.Warn("Unwrapping DEKs with the legacy all-zero KEK is enabled, disable it once all buckets are rewrapped")
+		keys = keys.withLegacyKEK(log)
 	}
 
-	return Router{region: region, kek: kekArray, forwardMultipartReqs: forwardMultipartReqs, log: log}, nil
+	return Router{
+		clients: clients, endpoint: endpoint, pathStyle: backends.PathStyle(), keys: keys, forwardMultipartReqs: forwardMultipartReqs, uploads: newUploadStore(), frames: newObjectCache[frameIndex](), sizes: newObjectCache[int64](), log: log,
+	}, nil
 }
 
 // Serve implements the routing logic for the s3 proxy.
-// It intercepts GetObject and PutObject requests, encrypting/decrypting their bodies if necessary.
+// It intercepts GetObject, PutObject and multipart upload requests, encrypting/decrypting their bodies if necessary.
+// HeadObject, CopyObject and ListObjects requests are intercepted to keep the encryption transparent to clients.
 // All other requests are forwarded to the S3 API.
 // Ideally we could separate routing logic, request handling and s3 interactions.
 // Currently routing logic and request handling are integrated.
 func (r Router) Serve(w http.ResponseWriter, req *http.Request) {
-	client, err := s3.NewClient(r.region)
-	if err != nil {
-		http.Error(w, err.Error(), http.StatusInternalServerError)
-		return
-	}
-
 	var key string
 	var bucket string
 	var matchingPath bool
-	if containsBucket(req.Host) {
-		// BUCKET.s3.REGION.amazonaws.com
+	// matchingBucketPath is true if the request targets a bucket instead of an object.
+	var matchingBucketPath bool
+	if !r.pathStyle && containsBucket(req.Host, r.endpoint) {
+		// BUCKET.s3.REGION.amazonaws.com or BUCKET.ENDPOINT
 		parts := strings.Split(req.Host, ".")
 		bucket = parts[0]
 
 		matchingPath = match(req.URL.Path, keyPattern, &key)
-
+		matchingBucketPath = req.URL.Path == "" || req.URL.Path == "/"
 	} else {
 		matchingPath = match(req.URL.Path, bucketAndKeyPattern, &bucket, &key)
+		matchingBucketPath = !matchingPath && match(req.URL.Path, bucketPattern, &bucket)
 	}
+	client := r.clients.ForBucket(bucket)
 
 	var h http.Handler
 
 	switch {
 	// intercept GetObject.
 	case matchingPath && req.Method == "GET" && !isUnwantedGetEndpoint(req.URL.Query()):
-		h = handleGetObject(client, key, bucket, r.log)
+		h = handleGetObject(client, key, bucket, r.keys, r.frames, r.log)
+	// intercept HeadObject.
+	case matchingPath && req.Method == "HEAD" && !isUnwantedHeadEndpoint(req.URL.Query()):
+		h = handleHeadObject(client, key, bucket, r.keys, r.log)
+	// intercept CopyObject.
+	case matchingPath && req.Method == "PUT" && isCopyObject(req.Header, req.URL.Query()):
+		h = handleCopyObject(client, key, bucket, r.keys, r.log)
 	// intercept PutObject.
-	case matchingPath && req.Method == "PUT" && !isUnwantedPutEndpoint(req.Header, req.URL.Query()):
-		h = handlePutObject(client, key, bucket, r.log)
+	case matchingPath && req.Method == "PUT" && !isUnwantedPutEndpoint(req.URL.Query()):
+		h = handlePutObject(client, key, bucket, r.keys, r.log)
+	// intercept ListObjects and ListObjectsV2.
+	case matchingBucketPath && req.Method == "GET" && isListObjects(req.URL.Query()):
+		h = handleListObjects(client, bucket, r.keys, r.sizes, r.log)
+	// intercept multipart uploads.
 	case !r.forwardMultipartReqs && matchingPath && isUploadPart(req.Method, req.URL.Query()):
-		h = handleUploadPart(r.log)
+		h = handleUploadPart(client, key, bucket, r.keys, r.uploads, r.log)
 	case !r.forwardMultipartReqs && matchingPath && isCreateMultipartUpload(req.Method, req.URL.Query()):
-		h = handleCreateMultipartUpload(r.log)
+		h = handleCreateMultipartUpload(client, key, bucket, r.keys, r.uploads, r.log)
 	case !r.forwardMultipartReqs && matchingPath && isCompleteMultipartUpload(req.Method, req.URL.Query()):
-		h = handleCompleteMultipartUpload(r.log)
+		h = handleCompleteMultipartUpload(client, key, bucket, r.keys, r.uploads, r.log)
 	case !r.forwardMultipartReqs && matchingPath && isAbortMultipartUpload(req.Method, req.URL.Query()):
-		h = handleAbortMultipartUpload(r.log)
+		h = handleAbortMultipartUpload(client, key, bucket, r.uploads, r.log)
 	// Forward all other requests.
 	default:
-		h = handleForwards(r.log)
+		h = handleForwards(client, r.log)
 	}
 
 	h.ServeHTTP(w, req)
@@ -186,7 +233,15 @@ func byteSliceToByteArray(input []byte) ([32]byte, error) {
 
 // containsBucket is a helper to recognizes cases where the bucket name is sent as part of the host.
 // In other cases the bucket name is sent as part of the path.
-func containsBucket(host string) bool {
+// For AWS S3, endpoint is nil. For other backends, the bucket name is a subdomain of the endpoint's host.
+func containsBucket(host string, endpoint *url.URL) bool {
+	if endpoint != nil {
+		hostname, _, err := net.SplitHostPort(host)
+		if err != nil {
+			hostname = host
+		}
+		return strings.HasSuffix(hostname, "."+endpoint.Hostname())
+	}
 	parts := strings.Split(host, ".")
 	return len(parts) > 4
 }
@@ -206,14 +261,36 @@ func isUnwantedGetEndpoint(query url.Values) bool {
 	return acl || attributes || legalHold || retention || tagging || torrent || uploadID
 }
 
-// isUnwantedPutEndpoint returns true if the request is any of these requests: UploadPart, PutObjectTagging.
-// These requests are all structured similarly: they all have a query param that is not present in PutObject.
-// Otherwise those endpoints are similar to PutObject.
-func isUnwantedPutEndpoint(header http.Header, query url.Values) bool {
-	if header.Get("x-amz-copy-source") != "" {
-		return true
+// isUnwantedHeadEndpoint returns true if the request is a HeadObject request for a single part of an object.
+func isUnwantedHeadEndpoint(query url.Values) bool {
+	_, partNumber := query["partNumber"]
+
+	return partNumber
+}
+
+// isCopyObject returns true if the request is a CopyObject request.
+func isCopyObject(header http.Header, query url.Values) bool {
+	return header.Get("x-amz-copy-source") != "" && !isUnwantedPutEndpoint(query)
+}
+
+// isListObjects returns true if a GET request for a bucket is a ListObjects or ListObjectsV2 request.
+// All other GET requests for buckets have a query param that is not used by ListObjects.
+func isListObjects(query url.Values) bool {
+	for param := range query {
+		switch param {
+		case "list-type", "delimiter", "encoding-type", "marker", "max-keys", "prefix", "continuation-token", "fetch-owner", "start-after":
+		default:
+			return false
+		}
 	}
+	return true
+}
 
+// isUnwantedPutEndpoint returns true if the request is any of these requests: UploadPart, UploadPartCopy, PutObjectTagging.
+// These requests are all structured similarly: they all have a query param that is not present in PutObject.
+// Otherwise those endpoints are similar to PutObject.
+// CopyObject requests are not considered unwanted, they have to be distinguished from PutObject using isCopyObject.
+func isUnwantedPutEndpoint(query url.Values) bool {
 	_, partNumber := query["partNumber"]
 	_, uploadID := query["uploadId"]
 	_, tagging := query["tagging"]
@@ -226,11 +303,6 @@ func isUnwantedPutEndpoint(header http.Header, query url.Values) bool {
 	return partNumber || uploadID || tagging || legalHold || objectLock || retention || publicAccessBlock || acl
 }
 
-func sha256sum(data []byte) string {
-	digest := sha256.Sum256(data)
-	return fmt.Sprintf("%x", digest)
-}
-
 // getMetadataHeaders parses user-defined metadata headers from a
 // http.Header object. Users can define custom headers by taking
 // HEADERNAME and prefixing it with "x-amz-meta-".
@@ -242,6 +314,10 @@ func getMetadataHeaders(header http.Header) map[string]string {
 
 		if strings.HasPrefix(key, "x-amz-meta-") {
 			name := strings.TrimPrefix(key, "x-amz-meta-")
+			// Clients must not be able to set the metadata s3proxy uses to decrypt objects.
+			if isInternalMetadata(name) {
+				continue
+			}
 			result[name] = strings.Join(header.Values(key), ",")
 		}
 	}
@@ -257,22 +333,29 @@ func parseRetentionTime(raw string) (time.Time, error) {
 }
 
 // repackage implements all modifications we need to do to an incoming request that we want to forward to the s3 API.
-func repackage(r *http.Request) http.Request {
+// If endpoint is nil, the request is sent to AWS S3. Otherwise it is sent to the given endpoint.
+func repackage(r *http.Request, endpoint *url.URL) http.Request {
 	req := r.Clone(r.Context())
 
 	// HTTP clients are not supposed to set this field, however when we receive a request it is set.
 	// So, we unset it.
 	req.RequestURI = ""
 
-	req.URL.Host = r.Host
-	// We always want to use HTTPS when talking to S3.
-	req.URL.Scheme = "https"
+	if endpoint == nil {
+		req.URL.Host = r.Host
+		// We always want to use HTTPS when talking to AWS S3.
+		req.URL.Scheme = "https"
+		return *req
+	}
 
+	// The Host header is kept, since it is part of the client's signature.
+	req.URL.Host = endpoint.Host
+	req.URL.Scheme = endpoint.Scheme
 	return *req
 }
 
-// validateContentMD5 checks if the content-md5 header matches the body.
-func validateContentMD5(contentMD5 string, body []byte) error {
+// validateContentMD5 checks if the content-md5 header matches the MD5 digest of the body.
+func validateContentMD5(contentMD5 string, actual [md5.Size]byte) error {
 	if contentMD5 == "" {
 		return nil
 	}
@@ -286,8 +369,6 @@ func validateContentMD5(contentMD5 string, body []byte) error {
 		return fmt.Errorf("content-md5 must be 16 bytes long, got %d bytes", len(expected))
 	}
 
-	actual := md5.Sum(body)
-
 	if !bytes.Equal(actual[:], expected) {
 		return fmt.Errorf("content-md5 mismatch, header is %x, body is %x", expected, actual)
 	}
@@ -329,7 +410,22 @@ func get(h http.HandlerFunc) http.HandlerFunc {
 	return allowMethod(h, "GET")
 }
 
-// put takes a HandlerFunc and wraps it to only allow the POST method.
+// head takes a HandlerFunc and wraps it to only allow the HEAD method.
+func head(h http.HandlerFunc) http.HandlerFunc {
+	return allowMethod(h, "HEAD")
+}
+
+// put takes a HandlerFunc and wraps it to only allow the PUT method.
 func put(h http.HandlerFunc) http.HandlerFunc {
 	return allowMethod(h, "PUT")
 }
+
+// post takes a HandlerFunc and wraps it to only allow the POST method.
+func post(h http.HandlerFunc) http.HandlerFunc {
+	return allowMethod(h, "POST")
+}
+
+// del takes a HandlerFunc and wraps it to only allow the DELETE method.
+func del(h http.HandlerFunc) http.HandlerFunc {
+	return allowMethod(h, "DELETE")
+}
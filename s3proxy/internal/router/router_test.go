@@ -6,8 +6,23 @@ SPDX-License-Identifier: BUSL-1.1
 package router
 
 import (
+	"bytes"
+	"context"
+	"crypto/md5"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"slices"
+	"strings"
+	"sync"
 	"testing"
+	"time"
 
+	"github.com/aws/aws-sdk-go-v2/service/s3"
+	"github.com/aws/aws-sdk-go-v2/service/s3/types"
 	"github.com/stretchr/testify/assert"
 )
 
@@ -37,7 +52,7 @@ func TestValidateContentMD5(t *testing.T) {
 	for name, tc := range tests {
 		t.Run(name, func(t *testing.T) {
 			// Call the validateContentMD5 function
-			err := validateContentMD5(tc.contentMD5, tc.body)
+			err := validateContentMD5(tc.contentMD5, md5.Sum(tc.body))
 
 			// Check the result against the expected value
 			if tc.expectedErrMsg != "" {
@@ -85,3 +100,322 @@ func TestByteSliceToByteArray(t *testing.T) {
 		})
 	}
 }
+
+func TestRepackage(t *testing.T) {
+	testCases := map[string]struct {
+		endpoint   string
+		wantURL    string
+		wantHeader string
+	}{
+		"AWS S3": {
+			wantURL:    "https://bucket.s3.eu-west-1.amazonaws.com/dir/key?tagging=",
+			wantHeader: "bucket.s3.eu-west-1.amazonaws.com",
+		},
+		"custom endpoint": {
+			endpoint:   "http://minio.local:9000",
+			wantURL:    "http://minio.local:9000/dir/key?tagging=",
+			wantHeader: "bucket.s3.eu-west-1.amazonaws.com",
+		},
+	}
+
+	for name, tc := range testCases {
+		t.Run(name, func(t *testing.T) {
+			assert := assert.New(t)
+
+			var endpoint *url.URL
+			if tc.endpoint != "" {
+				var err error
+				endpoint, err = url.Parse(tc.endpoint)
+				assert.NoError(err)
+			}
+			req := httptest.NewRequest(http.MethodGet, "/dir/key?tagging=", nil)
+			req.Host = "bucket.s3.eu-west-1.amazonaws.com"
+
+			repackaged := repackage(req, endpoint)
+			assert.Equal(tc.wantURL, repackaged.URL.String())
+			// The Host header is part of the client's signature and must not change.
+			assert.Equal(tc.wantHeader, repackaged.Host)
+			assert.Empty(repackaged.RequestURI)
+		})
+	}
+}
+
+func TestContainsBucket(t *testing.T) {
+	testCases := map[string]struct {
+		host     string
+		endpoint string
+		want     bool
+	}{
+		"AWS virtual-hosted":      {host: "bucket.s3.eu-west-1.amazonaws.com", want: true},
+		"AWS path-style":          {host: "s3.eu-west-1.amazonaws.com"},
+		"endpoint virtual-hosted": {host: "bucket.minio.local:9000", endpoint: "https://minio.local:9000", want: true},
+		"endpoint path-style":     {host: "minio.local:9000", endpoint: "https://minio.local:9000"},
+		"endpoint other host":     {host: "s3proxy.default.svc.cluster.local", endpoint: "https://minio.local"},
+	}
+
+	for name, tc := range testCases {
+		t.Run(name, func(t *testing.T) {
+			var endpoint *url.URL
+			if tc.endpoint != "" {
+				var err error
+				endpoint, err = url.Parse(tc.endpoint)
+				assert.NoError(t, err)
+			}
+			assert.Equal(t, tc.want, containsBucket(tc.host, endpoint))
+		})
+	}
+}
+
+// stubS3Client is an in-memory stand-in for the S3 API.
+type stubS3Client struct {
+	// mux protects the stub against concurrent reads, e.g. during ListObjects requests.
+	mux            sync.Mutex
+	objects        map[string][]byte
+	metadata       map[string]map[string]string
+	uploadMetadata map[string]map[string]string
+	parts          map[string]map[int32][]byte
+	uploadCount    int
+	// bytesRead counts the bytes returned by GetObject.
+	bytesRead int64
+	// getRequests counts the GetObject requests.
+	getRequests int
+	// openBodies counts the bodies returned by GetObject that were not closed yet.
+	openBodies int
+	// listPageSize limits the number of objects returned by ListObjects.
+	listPageSize int
+	// failingKeys makes HeadObject fail for the given objects.
+	failingKeys map[string]bool
+}
+
+func newStubS3Client() *stubS3Client {
+	return &stubS3Client{
+		objects:        map[string][]byte{},
+		metadata:       map[string]map[string]string{},
+		uploadMetadata: map[string]map[string]string{},
+		parts:          map[string]map[int32][]byte{},
+	}
+}
+
+func (c *stubS3Client) GetObject(_ context.Context, bucket, key, _, byteRange, ifMatch, _, _, _ string) (*s3.GetObjectOutput, error) {
+	c.mux.Lock()
+	defer c.mux.Unlock()
+	c.getRequests++
+
+	body, ok := c.objects[bucket+"/"+key]
+	if !ok {
+		return nil, errors.New("https response error StatusCode: 404")
+	}
+	etag := stubETag(body)
+	if ifMatch != "" && ifMatch != etag {
+		return nil, errors.New("https response error StatusCode: 412")
+	}
+
+	output := &s3.GetObjectOutput{ETag: &etag, Metadata: c.metadata[bucket+"/"+key]}
+	if byteRange != "" {
+		var start, end int64
+		if _, err := fmt.Sscanf(byteRange, "bytes=%d-%d", &start, &end); err != nil {
+			return nil, fmt.Errorf("unsupported range %q: %w", byteRange, err)
+		}
+		if start >= int64(len(body)) {
+			return nil, errors.New("https response error StatusCode: 416")
+		}
+		end = min(end, int64(len(body))-1)
+		contentRange := fmt.Sprintf("bytes %d-%d/%d", start, end, len(body))
+		output.ContentRange = &contentRange
+		body = body[start : end+1]
+	}
+
+	c.bytesRead += int64(len(body))
+	contentLength := int64(len(body))
+	output.Body = &stubBody{Reader: bytes.NewReader(body), client: c}
+	output.ContentLength = &contentLength
+	c.openBodies++
+	return output, nil
+}
+
+// stubBody is a body returned by stubS3Client.GetObject that tracks whether it was closed.
+type stubBody struct {
+	io.Reader
+	client *stubS3Client
+	closed bool
+}
+
+func (b *stubBody) Close() error {
+	b.client.mux.Lock()
+	defer b.client.mux.Unlock()
+	if !b.closed {
+		b.closed = true
+		b.client.openBodies--
+	}
+	return nil
+}
+
+func (c *stubS3Client) PutObject(_ context.Context, bucket, key, _, _, _, _, _, _, _ string, _ time.Time, metadata map[string]string, body io.Reader, contentLength int64) (*s3.PutObjectOutput, error) {
+	data, err := readBody(body, contentLength)
+	if err != nil {
+		return nil, err
+	}
+	c.objects[bucket+"/"+key] = data
+	c.metadata[bucket+"/"+key] = metadata
+	return &s3.PutObjectOutput{}, nil
+}
+
+func (c *stubS3Client) CreateMultipartUpload(_ context.Context, _, _, _, _, _, _, _, _, _ string, _ time.Time, metadata map[string]string) (*s3.CreateMultipartUploadOutput, error) {
+	c.uploadCount++
+	uploadID := fmt.Sprintf("upload-%d", c.uploadCount)
+	c.uploadMetadata[uploadID] = metadata
+	c.parts[uploadID] = map[int32][]byte{}
+	return &s3.CreateMultipartUploadOutput{UploadId: &uploadID}, nil
+}
+
+func (c *stubS3Client) UploadPart(_ context.Context, _, _, uploadID string, partNumber int32, _, _, _ string, body io.Reader, contentLength int64) (*s3.UploadPartOutput, error) {
+	parts, ok := c.parts[uploadID]
+	if !ok {
+		return nil, errors.New("https response error StatusCode: 404")
+	}
+	data, err := readBody(body, contentLength)
+	if err != nil {
+		return nil, err
+	}
+	parts[partNumber] = data
+	etag := fmt.Sprintf("%q", fmt.Sprintf("etag-%d", partNumber))
+	return &s3.UploadPartOutput{ETag: &etag}, nil
+}
+
+func (c *stubS3Client) CompleteMultipartUpload(_ context.Context, bucket, key, uploadID, _, _, _ string, parts []types.CompletedPart) (*s3.CompleteMultipartUploadOutput, error) {
+	uploaded, ok := c.parts[uploadID]
+	if !ok {
+		return nil, errors.New("https response error StatusCode: 404")
+	}
+	var body []byte
+	for _, part := range parts {
+		if *part.ETag != fmt.Sprintf("%q", fmt.Sprintf("etag-%d", *part.PartNumber)) {
+			return nil, errors.New("https response error StatusCode: 400")
+		}
+		body = append(body, uploaded[*part.PartNumber]...)
+	}
+	c.objects[bucket+"/"+key] = body
+	c.metadata[bucket+"/"+key] = c.uploadMetadata[uploadID]
+	delete(c.parts, uploadID)
+	return &s3.CompleteMultipartUploadOutput{}, nil
+}
+
+func (c *stubS3Client) ListParts(_ context.Context, _, _, uploadID, _, _, _, _ string) (*s3.ListPartsOutput, error) {
+	uploaded, ok := c.parts[uploadID]
+	if !ok {
+		return nil, errors.New("https response error StatusCode: 404")
+	}
+	output := &s3.ListPartsOutput{}
+	for number, part := range uploaded {
+		size := int64(len(part))
+		output.Parts = append(output.Parts, types.Part{PartNumber: &number, Size: &size})
+	}
+	return output, nil
+}
+
+func (c *stubS3Client) AbortMultipartUpload(_ context.Context, _, _, uploadID string) (*s3.AbortMultipartUploadOutput, error) {
+	delete(c.parts, uploadID)
+	return &s3.AbortMultipartUploadOutput{}, nil
+}
+
+func (c *stubS3Client) DeleteObject(_ context.Context, bucket, key, _ string) (*s3.DeleteObjectOutput, error) {
+	delete(c.objects, bucket+"/"+key)
+	delete(c.metadata, bucket+"/"+key)
+	return &s3.DeleteObjectOutput{}, nil
+}
+
+// readBody reads a request body like an HTTP client would, failing if it doesn't hold contentLength bytes.
+func readBody(body io.Reader, contentLength int64) ([]byte, error) {
+	data, err := io.ReadAll(body)
+	if err != nil {
+		return nil, err
+	}
+	if int64(len(data)) != contentLength {
+		return nil, fmt.Errorf("body has %d bytes, expected %d", len(data), contentLength)
+	}
+	return data, nil
+}
+
+func (c *stubS3Client) ListObjects(_ context.Context, bucket, continuationToken string) (*s3.ListObjectsV2Output, error) {
+	var keys []string
+	for name := range c.objects {
+		if key, ok := strings.CutPrefix(name, bucket+"/"); ok && key > continuationToken {
+			keys = append(keys, key)
+		}
+	}
+	slices.Sort(keys)
+
+	output := &s3.ListObjectsV2Output{}
+	if c.listPageSize > 0 && len(keys) > c.listPageSize {
+		keys = keys[:c.listPageSize]
+		output.NextContinuationToken = &keys[len(keys)-1]
+	}
+	for _, key := range keys {
+		output.Contents = append(output.Contents, types.Object{Key: &key})
+	}
+	return output, nil
+}
+
+func (c *stubS3Client) HeadObject(_ context.Context, bucket, key, _, _, _, _ string) (*s3.HeadObjectOutput, error) {
+	c.mux.Lock()
+	defer c.mux.Unlock()
+
+	body, ok := c.objects[bucket+"/"+key]
+	if !ok {
+		return nil, errors.New("https response error StatusCode: 404")
+	}
+	if c.failingKeys[key] {
+		return nil, errors.New("https response error StatusCode: 400")
+	}
+	etag := stubETag(body)
+	contentLength := int64(len(body))
+	return &s3.HeadObjectOutput{ETag: &etag, ContentLength: &contentLength, Metadata: c.metadata[bucket+"/"+key]}, nil
+}
+
+func (c *stubS3Client) ReplaceMetadata(_ context.Context, bucket, key string, head *s3.HeadObjectOutput, metadata map[string]string, _, _, _ string) (*s3.CopyObjectOutput, error) {
+	body, ok := c.objects[bucket+"/"+key]
+	if !ok {
+		return nil, errors.New("https response error StatusCode: 404")
+	}
+	if head.ETag == nil || *head.ETag != stubETag(body) {
+		return nil, errors.New("https response error StatusCode: 412")
+	}
+	c.metadata[bucket+"/"+key] = metadata
+	return &s3.CopyObjectOutput{CopyObjectResult: &types.CopyObjectResult{ETag: head.ETag}}, nil
+}
+
+func (c *stubS3Client) CopyObject(_ context.Context, input *s3.CopyObjectInput) (*s3.CopyObjectOutput, error) {
+	source, err := url.PathUnescape(strings.TrimPrefix(*input.CopySource, "/"))
+	if err != nil {
+		return nil, err
+	}
+	body, ok := c.objects[source]
+	if !ok {
+		return nil, errors.New("https response error StatusCode: 404")
+	}
+	etag := stubETag(body)
+	if input.CopySourceIfMatch != nil && *input.CopySourceIfMatch != etag {
+		return nil, errors.New("https response error StatusCode: 412")
+	}
+
+	metadata := c.metadata[source]
+	if input.MetadataDirective == types.MetadataDirectiveReplace {
+		metadata = input.Metadata
+	}
+	c.objects[*input.Bucket+"/"+*input.Key] = body
+	c.metadata[*input.Bucket+"/"+*input.Key] = metadata
+	return &s3.CopyObjectOutput{CopyObjectResult: &types.CopyObjectResult{ETag: &etag}}, nil
+}
+
+func (c *stubS3Client) Endpoint() *url.URL {
+	return nil
+}
+
+func (c *stubS3Client) Do(*http.Request) (*http.Response, error) {
+	return nil, errors.New("stub doesn't forward requests")
+}
+
+// stubETag returns the ETag S3 reports for an object uploaded in a single request.
+func stubETag(body []byte) string {
+	return fmt.Sprintf("%q", fmt.Sprintf("%x", md5.Sum(body)))
+}
@@ -0,0 +1,174 @@
+/*
+Copyright (c) Edgeless Systems GmbH
+
+SPDX-License-Identifier: BUSL-1.1
+*/
+
+package s3
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"os"
+	"strings"
+
+	awshttp "github.com/aws/aws-sdk-go-v2/aws/transport/http"
+	"gopkg.in/yaml.v3"
+)
+
+// Config describes the S3-compatible stores s3proxy talks to.
+// The embedded Backend is used for all buckets that are not listed in Buckets.
+type Config struct {
+	Backend `yaml:",inline"`
+	// Buckets overrides the backend for individual buckets.
+	// Fields that are not set for a bucket are taken from the default backend.
+	Buckets map[string]Backend `yaml:"buckets,omitempty"`
+}
+
+// Backend describes a single S3-compatible store.
+type Backend struct {
+	// Region is the region of the store. Most S3-compatible stores accept any region.
+	Region string `yaml:"region,omitempty"`
+	// Endpoint is the URL of the store, e.g. https://minio.example.com:9000.
+	// If empty, AWS S3 is used.
+	Endpoint string `yaml:"endpoint,omitempty"`
+	// UsePathStyle addresses buckets in the request path instead of the host name.
+	UsePathStyle *bool `yaml:"usePathStyle,omitempty"`
+	// CABundle is the path to a PEM file with CA certificates that are trusted in addition to the system roots.
+	CABundle string `yaml:"caBundle,omitempty"`
+	// Credentials are the static credentials s3proxy uses for requests it sends on its own.
+	// If not set, credentials are taken from the environment.
+	Credentials *Credentials `yaml:"credentials,omitempty"`
+}
+
+// Credentials are static S3 credentials.
+type Credentials struct {
+	AccessKeyID     string `yaml:"accessKeyID"`
+	SecretAccessKey string `yaml:"secretAccessKey"`
+	SessionToken    string `yaml:"sessionToken,omitempty"`
+}
+
+// LoadConfig reads a Config from the YAML file at path.
+func LoadConfig(path string) (Config, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return Config{}, fmt.Errorf("reading backend config: %w", err)
+	}
+	var cfg Config
+	if err := yaml.Unmarshal(data, &cfg); err != nil {
+		return Config{}, fmt.Errorf("parsing backend config: %w", err)
+	}
+	return cfg, nil
+}
+
+// Validate checks the default backend and the backends of all buckets.
+func (c Config) Validate() error {
+	if err := c.Backend.validate(); err != nil {
+		return fmt.Errorf("default backend: %w", err)
+	}
+	for bucket := range c.Buckets {
+		if err := c.ForBucket(bucket).validate(); err != nil {
+			return fmt.Errorf("backend of bucket %s: %w", bucket, err)
+		}
+	}
+	return nil
+}
+
+// ForBucket returns the backend of the given bucket.
+func (c Config) ForBucket(bucket string) Backend {
+	override, ok := c.Buckets[bucket]
+	if !ok {
+		return c.Backend
+	}
+
+	backend := c.Backend
+	if override.Region != "" {
+		backend.Region = override.Region
+	}
+	if override.Endpoint != "" {
+		backend.Endpoint = override.Endpoint
+	}
+	if override.UsePathStyle != nil {
+		backend.UsePathStyle = override.UsePathStyle
+	}
+	if override.CABundle != "" {
+		backend.CABundle = override.CABundle
+	}
+	if override.Credentials != nil {
+		backend.Credentials = override.Credentials
+	}
+	return backend
+}
+
+// PathStyle reports whether buckets are addressed in the request path.
+func (b Backend) PathStyle() bool {
+	return b.UsePathStyle != nil && *b.UsePathStyle
+}
+
+// EndpointURL returns the parsed endpoint of the backend, or nil if the backend is AWS S3.
+func (b Backend) EndpointURL() (*url.URL, error) {
+	if b.Endpoint == "" {
+		return nil, nil
+	}
+	endpoint, err := url.Parse(b.Endpoint)
+	if err != nil {
+		return nil, fmt.Errorf("parsing endpoint: %w", err)
+	}
+	if endpoint.Scheme != "http" && endpoint.Scheme != "https" {
+		return nil, fmt.Errorf("endpoint %q must use http or https", b.Endpoint)
+	}
+	if endpoint.Host == "" {
+		return nil, fmt.Errorf("endpoint %q has no host", b.Endpoint)
+	}
+	// Forwarded requests are signed by the client for their original path, so it can't be changed.
+	if strings.TrimSuffix(endpoint.Path, "/") != "" || endpoint.RawQuery != "" || endpoint.Fragment != "" {
+		return nil, fmt.Errorf("endpoint %q must not have a path, query or fragment", b.Endpoint)
+	}
+	return endpoint, nil
+}
+
+func (b Backend) validate() error {
+	if b.Region == "" {
+		return errors.New("region is required")
+	}
+	if _, err := b.EndpointURL(); err != nil {
+		return err
+	}
+	if b.Credentials != nil && (b.Credentials.AccessKeyID == "" || b.Credentials.SecretAccessKey == "") {
+		return errors.New("credentials require an access key ID and a secret access key")
+	}
+	return nil
+}
+
+// httpClient returns the HTTP client used to talk to the backend.
+// It is the default client of the AWS SDK, so its timeouts and connection settings are kept.
+// If a CA bundle is configured, its certificates are trusted in addition to the system roots.
+func (b Backend) httpClient() (*awshttp.BuildableClient, error) {
+	client := awshttp.NewBuildableClient()
+	if b.CABundle == "" {
+		return client, nil
+	}
+
+	pem, err := os.ReadFile(b.CABundle)
+	if err != nil {
+		return nil, fmt.Errorf("reading CA bundle: %w", err)
+	}
+	roots, err := x509.SystemCertPool()
+	if err != nil {
+		return nil, fmt.Errorf("loading system CA certificates: %w", err)
+	}
+	if !roots.AppendCertsFromPEM(pem) {
+		return nil, fmt.Errorf("no certificates found in CA bundle %s", b.CABundle)
+	}
+
+	return client.WithTransportOptions(func(transport *http.Transport) {
+		if transport.TLSClientConfig == nil {
+			transport.TLSClientConfig = &tls.Config{MinVersion: tls.VersionTLS12}
+		}
+		transport.TLSClientConfig.RootCAs = roots
+	}), nil
+}
@@ -0,0 +1,119 @@
+/*
+Copyright (c) Edgeless Systems GmbH
+
+SPDX-License-Identifier: BUSL-1.1
+*/
+
+package s3
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestLoadConfig(t *testing.T) {
+	assert := assert.New(t)
+	require := require.New(t)
+
+	path := filepath.Join(t.TempDir(), "backends.yaml")
+	require.NoError(os.WriteFile(path, []byte(`
+region: us-east-1
+endpoint: https://minio.local:9000
+usePathStyle: true
+buckets:
+  archive:
+    endpoint: http://ceph.local
+    usePathStyle: false
+    credentials:
+      accessKeyID: id
+      secretAccessKey: secret
+`), 0o600))
+
+	cfg, err := LoadConfig(path)
+	require.NoError(err)
+	assert.NoError(cfg.Validate())
+
+	assert.Equal("us-east-1", cfg.Region)
+	assert.Equal("https://minio.local:9000", cfg.Endpoint)
+	assert.True(cfg.PathStyle())
+
+	archive := cfg.ForBucket("archive")
+	assert.Equal("us-east-1", archive.Region)
+	assert.Equal("http://ceph.local", archive.Endpoint)
+	assert.False(archive.PathStyle())
+	assert.Equal(&Credentials{AccessKeyID: "id", SecretAccessKey: "secret"}, archive.Credentials)
+
+	assert.Equal(cfg.Backend, cfg.ForBucket("other"))
+}
+
+func TestConfigValidate(t *testing.T) {
+	testCases := map[string]struct {
+		cfg     Config
+		wantErr bool
+	}{
+		"AWS S3": {
+			cfg: Config{Backend: Backend{Region: "eu-west-1"}},
+		},
+		"custom endpoint": {
+			cfg: Config{Backend: Backend{Region: "eu-west-1", Endpoint: "http://localhost:9000/"}},
+		},
+		"missing region": {
+			cfg:     Config{Backend: Backend{Endpoint: "https://minio.local"}},
+			wantErr: true,
+		},
+		"endpoint without scheme": {
+			cfg:     Config{Backend: Backend{Region: "eu-west-1", Endpoint: "minio.local:9000"}},
+			wantErr: true,
+		},
+		"endpoint with path": {
+			cfg:     Config{Backend: Backend{Region: "eu-west-1", Endpoint: "https://minio.local/s3"}},
+			wantErr: true,
+		},
+		"invalid bucket endpoint": {
+			cfg: Config{
+				Backend: Backend{Region: "eu-west-1"},
+				Buckets: map[string]Backend{"bucket": {Endpoint: "ftp://minio.local"}},
+			},
+			wantErr: true,
+		},
+		"incomplete credentials": {
+			cfg: Config{
+				Backend: Backend{Region: "eu-west-1"},
+				Buckets: map[string]Backend{"bucket": {Credentials: &Credentials{AccessKeyID: "id"}}},
+			},
+			wantErr: true,
+		},
+	}
+
+	for name, tc := range testCases {
+		t.Run(name, func(t *testing.T) {
+			err := tc.cfg.Validate()
+			if tc.wantErr {
+				assert.Error(t, err)
+				return
+			}
+			assert.NoError(t, err)
+		})
+	}
+}
+
+func TestHTTPClient(t *testing.T) {
+	assert := assert.New(t)
+
+	client, err := Backend{}.httpClient()
+	assert.NoError(err)
+	assert.NotNil(client)
+
+	dir := t.TempDir()
+	invalid := filepath.Join(dir, "invalid.pem")
+	assert.NoError(os.WriteFile(invalid, []byte("not a certificate"), 0o600))
+	_, err = Backend{CABundle: invalid}.httpClient()
+	assert.Error(err)
+
+	_, err = Backend{CABundle: filepath.Join(dir, "missing.pem")}.httpClient()
+	assert.Error(err)
+}
@@ -6,49 +6,143 @@ SPDX-License-Identifier: BUSL-1.1
 
 /*
 Package s3 implements a very thin wrapper around the AWS S3 client.
-It only exists to enable stubbing of the AWS S3 client in tests.
+It only exists to enable stubbing of the AWS S3 client in tests
+and to configure the client for AWS S3 or other S3-compatible stores.
 */
 package s3
 
 import (
-	"bytes"
 	"context"
-	"crypto/md5"
-	"encoding/base64"
 	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
 	"time"
 
+	"github.com/aws/aws-sdk-go-v2/aws"
+	v4 "github.com/aws/aws-sdk-go-v2/aws/signer/v4"
+	awshttp "github.com/aws/aws-sdk-go-v2/aws/transport/http"
 	"github.com/aws/aws-sdk-go-v2/config"
+	"github.com/aws/aws-sdk-go-v2/credentials"
 	"github.com/aws/aws-sdk-go-v2/service/s3"
 	"github.com/aws/aws-sdk-go-v2/service/s3/types"
 )
 
+const (
+	// maxCopySize is the size of the largest object S3 copies in a single CopyObject request.
+	maxCopySize = 5 << 30
+	// copyPartSize is the size of the parts used to copy objects larger than maxCopySize.
+	copyPartSize = 1 << 30
+)
+
 // Client is a wrapper around the AWS S3 client.
 type Client struct {
 	s3client *s3.Client
+	// endpoint is the URL of the backend, or nil for AWS S3.
+	endpoint *url.URL
+	// httpClient is used for requests that are forwarded to the backend without going through the AWS S3 client.
+	httpClient *awshttp.BuildableClient
 }
 
-// NewClient creates a new AWS S3 client.
-func NewClient(region string) (*Client, error) {
+// NewClient creates a new S3 client for the given backend.
+func NewClient(backend Backend) (*Client, error) {
+	endpoint, err := backend.EndpointURL()
+	if err != nil {
+		return nil, err
+	}
+	httpClient, err := backend.httpClient()
+	if err != nil {
+		return nil, err
+	}
+
+	opts := []func(*config.LoadOptions) error{
+		config.WithRegion(backend.Region),
+		config.WithHTTPClient(httpClient),
+	}
+	if backend.Credentials != nil {
+		opts = append(opts, config.WithCredentialsProvider(credentials.NewStaticCredentialsProvider(
+			backend.Credentials.AccessKeyID, backend.Credentials.SecretAccessKey, backend.Credentials.SessionToken,
+		)))
+	}
+	if endpoint != nil {
+		// Many S3-compatible stores don't support the flexible checksums that the AWS SDK adds by default.
+		opts = append(opts,
+			config.WithRequestChecksumCalculation(aws.RequestChecksumCalculationWhenRequired),
+			config.WithResponseChecksumValidation(aws.ResponseChecksumValidationWhenRequired),
+		)
+	}
+
 	// Use context.Background here because this context will not influence the later operations of the client.
 	// The context given here is used for http requests that are made during client construction.
 	// Client construction happens once during proxy setup.
-	clientCfg, err := config.LoadDefaultConfig(
-		context.Background(),
-		config.WithRegion(region),
-	)
+	clientCfg, err := config.LoadDefaultConfig(context.Background(), opts...)
 	if err != nil {
 		return nil, fmt.Errorf("loading AWS S3 client config: %w", err)
 	}
 
-	client := s3.NewFromConfig(clientCfg)
+	client := s3.NewFromConfig(clientCfg, func(o *s3.Options) {
+		if endpoint != nil {
+			o.BaseEndpoint = aws.String(endpoint.String())
+		}
+		o.UsePathStyle = backend.PathStyle()
+	})
+
+	return &Client{s3client: client, endpoint: endpoint, httpClient: httpClient}, nil
+}
+
+// Clients holds one client for the default backend and one for each bucket with its own backend.
+type Clients struct {
+	defaultClient *Client
+	buckets       map[string]*Client
+}
+
+// NewClients creates the clients for all backends in cfg.
+func NewClients(cfg Config) (*Clients, error) {
+	if err := cfg.Validate(); err != nil {
+		return nil, err
+	}
+
+	defaultClient, err := NewClient(cfg.Backend)
+	if err != nil {
+		return nil, fmt.Errorf("creating client for default backend: %w", err)
+	}
+	clients := &Clients{defaultClient: defaultClient, buckets: map[string]*Client{}}
+	for bucket := range cfg.Buckets {
+		client, err := NewClient(cfg.ForBucket(bucket))
+		if err != nil {
+			return nil, fmt.Errorf("creating client for bucket %s: %w", bucket, err)
+		}
+		clients.buckets[bucket] = client
+	}
+	return clients, nil
+}
+
+// ForBucket returns the client for the given bucket.
+// Requests that don't target a bucket use the default backend.
+func (c *Clients) ForBucket(bucket string) *Client {
+	if client, ok := c.buckets[bucket]; ok {
+		return client
+	}
+	return c.defaultClient
+}
+
+// Endpoint returns the URL of the backend, or nil if the backend is AWS S3.
+func (c Client) Endpoint() *url.URL {
+	return c.endpoint
+}
 
-	return &Client{client}, nil
+// Do sends a prepared HTTP request to the backend.
+// It is used to forward requests that are signed by the client, so the request is not modified or signed again.
+func (c Client) Do(req *http.Request) (*http.Response, error) {
+	return c.httpClient.Do(req)
 }
 
 // GetObject returns the object with the given key from the given bucket.
 // If a versionID is given, the specific version of the object is returned.
-func (c Client) GetObject(ctx context.Context, bucket, key, versionID, sseCustomerAlgorithm, sseCustomerKey, sseCustomerKeyMD5 string) (*s3.GetObjectOutput, error) {
+// If a byteRange is given, only the requested bytes of the object are returned.
+// If ifMatch is given, the object is only returned if its ETag matches.
+func (c Client) GetObject(ctx context.Context, bucket, key, versionID, byteRange, ifMatch, sseCustomerAlgorithm, sseCustomerKey, sseCustomerKeyMD5 string) (*s3.GetObjectOutput, error) {
 	getObjectInput := &s3.GetObjectInput{
 		Bucket: &bucket,
 		Key:    &key,
@@ -56,6 +150,12 @@ func (c Client) GetObject(ctx context.Context, bucket, key, versionID, sseCustom
 	if versionID != "" {
 		getObjectInput.VersionId = &versionID
 	}
+	if byteRange != "" {
+		getObjectInput.Range = &byteRange
+	}
+	if ifMatch != "" {
+		getObjectInput.IfMatch = &ifMatch
+	}
 	if sseCustomerAlgorithm != "" {
 		getObjectInput.SSECustomerAlgorithm = &sseCustomerAlgorithm
 	}
@@ -70,8 +170,9 @@ func (c Client) GetObject(ctx context.Context, bucket, key, versionID, sseCustom
 }
 
 // PutObject creates a new object in the given bucket with the given key and body.
+// The body is streamed to S3 and has to hold exactly contentLength bytes.
 // Various optional parameters can be set.
-func (c Client) PutObject(ctx context.Context, bucket, key, tags, contentType, objectLockLegalHoldStatus, objectLockMode, sseCustomerAlgorithm, sseCustomerKey, sseCustomerKeyMD5 string, objectLockRetainUntilDate time.Time, metadata map[string]string, body []byte) (*s3.PutObjectOutput, error) {
+func (c Client) PutObject(ctx context.Context, bucket, key, tags, contentType, objectLockLegalHoldStatus, objectLockMode, sseCustomerAlgorithm, sseCustomerKey, sseCustomerKeyMD5 string, objectLockRetainUntilDate time.Time, metadata map[string]string, body io.Reader, contentLength int64) (*s3.PutObjectOutput, error) {
 	// The AWS Go SDK has two versions. V1 does not set the Content-Type header.
 	// V2 always sets the Content-Type header. We use V2.
 	// The s3 API sets an object's content-type to binary/octet-stream if
@@ -83,16 +184,13 @@ func (c Client) PutObject(ctx context.Context, bucket, key, tags, contentType, o
 		contentType = "binary/octet-stream"
 	}
 
-	contentMD5 := md5.Sum(body)
-	encodedContentMD5 := base64.StdEncoding.EncodeToString(contentMD5[:])
-
 	putObjectInput := &s3.PutObjectInput{
 		Bucket:                    &bucket,
 		Key:                       &key,
-		Body:                      bytes.NewReader(body),
+		Body:                      body,
+		ContentLength:             &contentLength,
 		Tagging:                   &tags,
 		Metadata:                  metadata,
-		ContentMD5:                &encodedContentMD5,
 		ContentType:               &contentType,
 		ObjectLockLegalHoldStatus: types.ObjectLockLegalHoldStatus(objectLockLegalHoldStatus),
 	}
@@ -112,5 +210,349 @@ func (c Client) PutObject(ctx context.Context, bucket, key, tags, contentType, o
 		putObjectInput.ObjectLockRetainUntilDate = &objectLockRetainUntilDate
 	}
 
-	return c.s3client.PutObject(ctx, putObjectInput)
+	return c.s3client.PutObject(ctx, putObjectInput, c.streamingOptions()...)
+}
+
+// CreateMultipartUpload initiates a multipart upload for the given key in the given bucket.
+// Various optional parameters can be set. The returned output holds the ID of the upload.
+func (c Client) CreateMultipartUpload(ctx context.Context, bucket, key, tags, contentType, objectLockLegalHoldStatus, objectLockMode, sseCustomerAlgorithm, sseCustomerKey, sseCustomerKeyMD5 string, objectLockRetainUntilDate time.Time, metadata map[string]string) (*s3.CreateMultipartUploadOutput, error) {
+	// See PutObject for why we set the Content-Type explicitly.
+	if contentType == "" {
+		contentType = "binary/octet-stream"
+	}
+
+	createInput := &s3.CreateMultipartUploadInput{
+		Bucket:                    &bucket,
+		Key:                       &key,
+		Tagging:                   &tags,
+		Metadata:                  metadata,
+		ContentType:               &contentType,
+		ObjectLockLegalHoldStatus: types.ObjectLockLegalHoldStatus(objectLockLegalHoldStatus),
+	}
+	if sseCustomerAlgorithm != "" {
+		createInput.SSECustomerAlgorithm = &sseCustomerAlgorithm
+	}
+	if sseCustomerKey != "" {
+		createInput.SSECustomerKey = &sseCustomerKey
+	}
+	if sseCustomerKeyMD5 != "" {
+		createInput.SSECustomerKeyMD5 = &sseCustomerKeyMD5
+	}
+
+	// It is not allowed to only set one of these two properties.
+	if objectLockMode != "" && !objectLockRetainUntilDate.IsZero() {
+		createInput.ObjectLockMode = types.ObjectLockMode(objectLockMode)
+		createInput.ObjectLockRetainUntilDate = &objectLockRetainUntilDate
+	}
+
+	return c.s3client.CreateMultipartUpload(ctx, createInput)
+}
+
+// UploadPart uploads a single part of the multipart upload with the given ID.
+// The body is streamed to S3 and has to hold exactly contentLength bytes.
+func (c Client) UploadPart(ctx context.Context, bucket, key, uploadID string, partNumber int32, sseCustomerAlgorithm, sseCustomerKey, sseCustomerKeyMD5 string, body io.Reader, contentLength int64) (*s3.UploadPartOutput, error) {
+	uploadPartInput := &s3.UploadPartInput{
+		Bucket:        &bucket,
+		Key:           &key,
+		UploadId:      &uploadID,
+		PartNumber:    &partNumber,
+		Body:          body,
+		ContentLength: &contentLength,
+	}
+	if sseCustomerAlgorithm != "" {
+		uploadPartInput.SSECustomerAlgorithm = &sseCustomerAlgorithm
+	}
+	if sseCustomerKey != "" {
+		uploadPartInput.SSECustomerKey = &sseCustomerKey
+	}
+	if sseCustomerKeyMD5 != "" {
+		uploadPartInput.SSECustomerKeyMD5 = &sseCustomerKeyMD5
+	}
+
+	return c.s3client.UploadPart(ctx, uploadPartInput, c.streamingOptions()...)
+}
+
+// streamingOptions returns the options for requests that stream their body to the backend.
+// The AWS SDK signs the SHA-256 of the payload, which it can only compute for bodies it can read twice,
+// unless the request uses TLS. Requests to plain HTTP endpoints are therefore signed with an unsigned payload.
+func (c Client) streamingOptions() []func(*s3.Options) {
+	if c.endpoint == nil || c.endpoint.Scheme != "http" {
+		return nil
+	}
+	return []func(*s3.Options){s3.WithAPIOptions(v4.SwapComputePayloadSHA256ForUnsignedPayloadMiddleware)}
+}
+
+// CompleteMultipartUpload assembles the given, previously uploaded parts into a single object.
+func (c Client) CompleteMultipartUpload(ctx context.Context, bucket, key, uploadID, sseCustomerAlgorithm, sseCustomerKey, sseCustomerKeyMD5 string, parts []types.CompletedPart) (*s3.CompleteMultipartUploadOutput, error) {
+	completeInput := &s3.CompleteMultipartUploadInput{
+		Bucket:          &bucket,
+		Key:             &key,
+		UploadId:        &uploadID,
+		MultipartUpload: &types.CompletedMultipartUpload{Parts: parts},
+	}
+	if sseCustomerAlgorithm != "" {
+		completeInput.SSECustomerAlgorithm = &sseCustomerAlgorithm
+	}
+	if sseCustomerKey != "" {
+		completeInput.SSECustomerKey = &sseCustomerKey
+	}
+	if sseCustomerKeyMD5 != "" {
+		completeInput.SSECustomerKeyMD5 = &sseCustomerKeyMD5
+	}
+
+	return c.s3client.CompleteMultipartUpload(ctx, completeInput)
+}
+
+// ListParts returns one page of the parts uploaded for the multipart upload with the given ID.
+// Pass the NextPartNumberMarker of the previous page to get the next page, or an empty string for the first page.
+func (c Client) ListParts(ctx context.Context, bucket, key, uploadID, partNumberMarker, sseCustomerAlgorithm, sseCustomerKey, sseCustomerKeyMD5 string) (*s3.ListPartsOutput, error) {
+	listInput := &s3.ListPartsInput{
+		Bucket:   &bucket,
+		Key:      &key,
+		UploadId: &uploadID,
+	}
+	if partNumberMarker != "" {
+		listInput.PartNumberMarker = &partNumberMarker
+	}
+	if sseCustomerAlgorithm != "" {
+		listInput.SSECustomerAlgorithm = &sseCustomerAlgorithm
+	}
+	if sseCustomerKey != "" {
+		listInput.SSECustomerKey = &sseCustomerKey
+	}
+	if sseCustomerKeyMD5 != "" {
+		listInput.SSECustomerKeyMD5 = &sseCustomerKeyMD5
+	}
+
+	return c.s3client.ListParts(ctx, listInput)
+}
+
+// AbortMultipartUpload aborts the multipart upload with the given ID and frees all uploaded parts.
+func (c Client) AbortMultipartUpload(ctx context.Context, bucket, key, uploadID string) (*s3.AbortMultipartUploadOutput, error) {
+	return c.s3client.AbortMultipartUpload(ctx, &s3.AbortMultipartUploadInput{
+		Bucket:   &bucket,
+		Key:      &key,
+		UploadId: &uploadID,
+	})
+}
+
+// DeleteObject deletes the object with the given key from the given bucket.
+// If a versionID is given, the specific version of the object is deleted.
+func (c Client) DeleteObject(ctx context.Context, bucket, key, versionID string) (*s3.DeleteObjectOutput, error) {
+	deleteInput := &s3.DeleteObjectInput{
+		Bucket: &bucket,
+		Key:    &key,
+	}
+	if versionID != "" {
+		deleteInput.VersionId = &versionID
+	}
+
+	return c.s3client.DeleteObject(ctx, deleteInput)
+}
+
+// ListObjects returns one page of the objects in the given bucket.
+// Pass the NextContinuationToken of the previous page to get the next page, or an empty string for the first page.
+func (c Client) ListObjects(ctx context.Context, bucket, continuationToken string) (*s3.ListObjectsV2Output, error) {
+	listInput := &s3.ListObjectsV2Input{
+		Bucket: &bucket,
+	}
+	if continuationToken != "" {
+		listInput.ContinuationToken = &continuationToken
+	}
+
+	return c.s3client.ListObjectsV2(ctx, listInput)
+}
+
+// HeadObject returns the metadata of the object with the given key from the given bucket.
+// If a versionID is given, the metadata of the specific version of the object is returned.
+func (c Client) HeadObject(ctx context.Context, bucket, key, versionID, sseCustomerAlgorithm, sseCustomerKey, sseCustomerKeyMD5 string) (*s3.HeadObjectOutput, error) {
+	headObjectInput := &s3.HeadObjectInput{
+		Bucket: &bucket,
+		Key:    &key,
+	}
+	if versionID != "" {
+		headObjectInput.VersionId = &versionID
+	}
+	if sseCustomerAlgorithm != "" {
+		headObjectInput.SSECustomerAlgorithm = &sseCustomerAlgorithm
+	}
+	if sseCustomerKey != "" {
+		headObjectInput.SSECustomerKey = &sseCustomerKey
+	}
+	if sseCustomerKeyMD5 != "" {
+		headObjectInput.SSECustomerKeyMD5 = &sseCustomerKeyMD5
+	}
+
+	return c.s3client.HeadObject(ctx, headObjectInput)
+}
+
+// ReplaceMetadata replaces the user metadata of an object by copying the object onto itself.
+// The object's body is copied by S3 and does not pass through the client.
+// The content headers, the storage class and the object lock settings are taken over from head, the output of a preceding HeadObject call.
+// The copy only succeeds if the object's ETag still matches the one in head.
+// Objects encrypted with a customer-provided key require the key to be passed again.
+// Objects larger than maxCopySize are copied in parts, see replaceMetadataInParts.
+func (c Client) ReplaceMetadata(ctx context.Context, bucket, key string, head *s3.HeadObjectOutput, metadata map[string]string, sseCustomerAlgorithm, sseCustomerKey, sseCustomerKeyMD5 string) (*s3.CopyObjectOutput, error) {
+	if head.ContentLength != nil && *head.ContentLength > maxCopySize {
+		return c.replaceMetadataInParts(ctx, bucket, key, head, metadata, sseCustomerAlgorithm, sseCustomerKey, sseCustomerKeyMD5)
+	}
+
+	copySource := copySource(bucket, key)
+	copyObjectInput := &s3.CopyObjectInput{
+		Bucket:                    &bucket,
+		Key:                       &key,
+		CopySource:                &copySource,
+		CopySourceIfMatch:         head.ETag,
+		MetadataDirective:         types.MetadataDirectiveReplace,
+		Metadata:                  metadata,
+		ContentType:               head.ContentType,
+		ContentEncoding:           head.ContentEncoding,
+		ContentDisposition:        head.ContentDisposition,
+		ContentLanguage:           head.ContentLanguage,
+		CacheControl:              head.CacheControl,
+		StorageClass:              types.StorageClass(head.StorageClass),
+		ObjectLockLegalHoldStatus: head.ObjectLockLegalHoldStatus,
+		ObjectLockMode:            types.ObjectLockMode(head.ObjectLockMode),
+		ObjectLockRetainUntilDate: head.ObjectLockRetainUntilDate,
+	}
+	if head.ServerSideEncryption != "" {
+		copyObjectInput.ServerSideEncryption = head.ServerSideEncryption
+		copyObjectInput.SSEKMSKeyId = head.SSEKMSKeyId
+	}
+	if sseCustomerAlgorithm != "" {
+		copyObjectInput.SSECustomerAlgorithm = &sseCustomerAlgorithm
+		copyObjectInput.CopySourceSSECustomerAlgorithm = &sseCustomerAlgorithm
+	}
+	if sseCustomerKey != "" {
+		copyObjectInput.SSECustomerKey = &sseCustomerKey
+		copyObjectInput.CopySourceSSECustomerKey = &sseCustomerKey
+	}
+	if sseCustomerKeyMD5 != "" {
+		copyObjectInput.SSECustomerKeyMD5 = &sseCustomerKeyMD5
+		copyObjectInput.CopySourceSSECustomerKeyMD5 = &sseCustomerKeyMD5
+	}
+
+	return c.s3client.CopyObject(ctx, copyObjectInput)
+}
+
+// replaceMetadataInParts replaces the user metadata of an object that is too large for a single CopyObject request.
+// The object is copied onto itself using a multipart upload whose parts are copied from ranges of the object.
+// The object's tags are read separately, since a multipart upload can't take them over from its source.
+func (c Client) replaceMetadataInParts(ctx context.Context, bucket, key string, head *s3.HeadObjectOutput, metadata map[string]string, sseCustomerAlgorithm, sseCustomerKey, sseCustomerKeyMD5 string) (*s3.CopyObjectOutput, error) {
+	tagging, err := c.s3client.GetObjectTagging(ctx, &s3.GetObjectTaggingInput{Bucket: &bucket, Key: &key, VersionId: head.VersionId})
+	if err != nil {
+		return nil, fmt.Errorf("getting object tags: %w", err)
+	}
+	tags := url.Values{}
+	for _, tag := range tagging.TagSet {
+		if tag.Key != nil && tag.Value != nil {
+			tags.Set(*tag.Key, *tag.Value)
+		}
+	}
+	encodedTags := tags.Encode()
+
+	createInput := &s3.CreateMultipartUploadInput{
+		Bucket:                    &bucket,
+		Key:                       &key,
+		Tagging:                   &encodedTags,
+		Metadata:                  metadata,
+		ContentType:               head.ContentType,
+		ContentEncoding:           head.ContentEncoding,
+		ContentDisposition:        head.ContentDisposition,
+		ContentLanguage:           head.ContentLanguage,
+		CacheControl:              head.CacheControl,
+		StorageClass:              types.StorageClass(head.StorageClass),
+		ObjectLockLegalHoldStatus: head.ObjectLockLegalHoldStatus,
+		ObjectLockMode:            types.ObjectLockMode(head.ObjectLockMode),
+		ObjectLockRetainUntilDate: head.ObjectLockRetainUntilDate,
+	}
+	if head.ServerSideEncryption != "" {
+		createInput.ServerSideEncryption = head.ServerSideEncryption
+		createInput.SSEKMSKeyId = head.SSEKMSKeyId
+	}
+	if sseCustomerAlgorithm != "" {
+		createInput.SSECustomerAlgorithm = &sseCustomerAlgorithm
+	}
+	if sseCustomerKey != "" {
+		createInput.SSECustomerKey = &sseCustomerKey
+	}
+	if sseCustomerKeyMD5 != "" {
+		createInput.SSECustomerKeyMD5 = &sseCustomerKeyMD5
+	}
+	upload, err := c.s3client.CreateMultipartUpload(ctx, createInput)
+	if err != nil {
+		return nil, fmt.Errorf("creating multipart upload: %w", err)
+	}
+
+	copySource := copySource(bucket, key)
+	var parts []types.CompletedPart
+	for start := int64(0); start < *head.ContentLength; start += copyPartSize {
+		partNumber := int32(len(parts) + 1)
+		byteRange := fmt.Sprintf("bytes=%d-%d", start, min(start+copyPartSize, *head.ContentLength)-1)
+		copyInput := &s3.UploadPartCopyInput{
+			Bucket:            &bucket,
+			Key:               &key,
+			UploadId:          upload.UploadId,
+			PartNumber:        &partNumber,
+			CopySource:        &copySource,
+			CopySourceRange:   &byteRange,
+			CopySourceIfMatch: head.ETag,
+		}
+		if sseCustomerAlgorithm != "" {
+			copyInput.SSECustomerAlgorithm = &sseCustomerAlgorithm
+			copyInput.CopySourceSSECustomerAlgorithm = &sseCustomerAlgorithm
+		}
+		if sseCustomerKey != "" {
+			copyInput.SSECustomerKey = &sseCustomerKey
+			copyInput.CopySourceSSECustomerKey = &sseCustomerKey
+		}
+		if sseCustomerKeyMD5 != "" {
+			copyInput.SSECustomerKeyMD5 = &sseCustomerKeyMD5
+			copyInput.CopySourceSSECustomerKeyMD5 = &sseCustomerKeyMD5
+		}
+
+		output, err := c.s3client.UploadPartCopy(ctx, copyInput)
+		if err != nil {
+			c.abortCopy(bucket, key, upload.UploadId)
+			return nil, fmt.Errorf("copying part %d: %w", partNumber, err)
+		}
+		if output.CopyPartResult == nil {
+			c.abortCopy(bucket, key, upload.UploadId)
+			return nil, fmt.Errorf("copying part %d: S3 response is missing the part's ETag", partNumber)
+		}
+		parts = append(parts, types.CompletedPart{ETag: output.CopyPartResult.ETag, PartNumber: &partNumber})
+	}
+
+	completed, err := c.CompleteMultipartUpload(ctx, bucket, key, *upload.UploadId, sseCustomerAlgorithm, sseCustomerKey, sseCustomerKeyMD5, parts)
+	if err != nil {
+		c.abortCopy(bucket, key, upload.UploadId)
+		return nil, fmt.Errorf("completing multipart upload: %w", err)
+	}
+	return &s3.CopyObjectOutput{
+		CopyObjectResult: &types.CopyObjectResult{ETag: completed.ETag},
+		VersionId:        completed.VersionId,
+	}, nil
+}
+
+// abortCopy aborts the multipart upload of a failed replaceMetadataInParts call.
+// The context of the call may already be canceled, so a new one is used.
+func (c Client) abortCopy(bucket, key string, uploadID *string) {
+	ctx, cancel := context.WithTimeout(context.Background(), time.Minute)
+	defer cancel()
+	_, _ = c.s3client.AbortMultipartUpload(ctx, &s3.AbortMultipartUploadInput{Bucket: &bucket, Key: &key, UploadId: uploadID})
+}
+
+// CopyObject copies an object within S3.
+// Copy requests take many optional parameters, so the input is built by the caller and passed to S3 unchanged.
+func (c Client) CopyObject(ctx context.Context, input *s3.CopyObjectInput) (*s3.CopyObjectOutput, error) {
+	return c.s3client.CopyObject(ctx, input)
+}
+
+// copySource returns the URL-encoded x-amz-copy-source value for the given object.
+func copySource(bucket, key string) string {
+	segments := strings.Split(key, "/")
+	for i, segment := range segments {
+		segments[i] = url.PathEscape(segment)
+	}
+	return bucket + "/" + strings.Join(segments, "/")
 }
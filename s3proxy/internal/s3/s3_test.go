@@ -0,0 +1,91 @@
+/*
+Copyright (c) Edgeless Systems GmbH
+
+SPDX-License-Identifier: BUSL-1.1
+*/
+
+package s3
+
+import (
+	"bytes"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestStreamedUploadToHTTPEndpoint(t *testing.T) {
+	assert := assert.New(t)
+	require := require.New(t)
+
+	backend := &recordingBackend{}
+	server := httptest.NewServer(backend)
+	defer server.Close()
+
+	pathStyle := true
+	client, err := NewClient(Backend{
+		Region:       "us-east-1",
+		Endpoint:     server.URL,
+		UsePathStyle: &pathStyle,
+		Credentials:  &Credentials{AccessKeyID: "id", SecretAccessKey: "secret"},
+	})
+	require.NoError(err)
+
+	data := []byte("streamed data")
+	// io.MultiReader hides the Seek method of the bytes.Reader, so the SDK can't read the body twice.
+	_, err = client.PutObject(t.Context(), "bucket", "object", "", "", "", "", "", "", "", time.Time{}, nil,
+		io.MultiReader(bytes.NewReader(data)), int64(len(data)))
+	require.NoError(err)
+	_, err = client.UploadPart(t.Context(), "bucket", "object", "upload", 1, "", "", "",
+		io.MultiReader(bytes.NewReader(data)), int64(len(data)))
+	require.NoError(err)
+
+	require.Len(backend.requests, 2)
+	for _, req := range backend.requests {
+		assert.Equal(http.MethodPut, req.method)
+		assert.Equal("/bucket/object", req.path)
+		assert.Equal("UNSIGNED-PAYLOAD", req.payloadHash)
+		assert.Contains(req.authorization, "Credential=id/")
+		assert.Equal(data, req.body)
+	}
+}
+
+type recordedRequest struct {
+	method        string
+	path          string
+	payloadHash   string
+	authorization string
+	body          []byte
+}
+
+// recordingBackend is an S3 backend that accepts all uploads and records them.
+type recordingBackend struct {
+	mux      sync.Mutex
+	requests []recordedRequest
+}
+
+func (b *recordingBackend) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	body, err := io.ReadAll(r.Body)
+	if err != nil {
+		w.WriteHeader(http.StatusBadRequest)
+		return
+	}
+
+	b.mux.Lock()
+	b.requests = append(b.requests, recordedRequest{
+		method:        r.Method,
+		path:          r.URL.Path,
+		payloadHash:   r.Header.Get("X-Amz-Content-Sha256"),
+		authorization: r.Header.Get("Authorization"),
+		body:          body,
+	})
+	b.mux.Unlock()
+
+	w.Header().Set("ETag", `"etag"`)
+	w.WriteHeader(http.StatusOK)
+}
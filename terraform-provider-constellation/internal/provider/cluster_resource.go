@@ -1072,7 +1072,7 @@ func (r *ClusterResource) apply(ctx context.Context, data *ClusterResourceModel,
 	}
 
 	// Apply attestation config
-	if err := applier.ApplyJoinConfig(ctx, att.config, secrets.measurementSalt); err != nil {
+	if err := applier.ApplyJoinConfig(ctx, att.config, secrets.measurementSalt, imageSemver); err != nil {
 		diags.AddError("Applying attestation config", err.Error())
 		return diags
 	}
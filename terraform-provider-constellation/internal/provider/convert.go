@@ -15,6 +15,7 @@ import (
 	"github.com/edgelesssys/constellation/v2/internal/api/attestationconfigapi"
 	"github.com/edgelesssys/constellation/v2/internal/attestation/idkeydigest"
 	"github.com/edgelesssys/constellation/v2/internal/attestation/measurements"
+	"github.com/edgelesssys/constellation/v2/internal/attestation/policy"
 	"github.com/edgelesssys/constellation/v2/internal/attestation/variant"
 	"github.com/edgelesssys/constellation/v2/internal/config"
 	"github.com/edgelesssys/constellation/v2/internal/encoding"
@@ -51,6 +52,14 @@ func convertFromTfAttestationCfg(tfAttestation attestationAttribute, attestation
 		}
 	}
 
+	var attestationPolicy []policy.Rule
+	for _, rule := range tfAttestation.Policy {
+		attestationPolicy = append(attestationPolicy, policy.Rule{
+			Name:       rule.Name,
+			Expression: rule.Expression,
+		})
+	}
+
 	var attestationConfig config.AttestationCfg
 	switch attestationVariant {
 	case variant.AzureSEVSNP{}:
@@ -72,6 +81,7 @@ func convertFromTfAttestationCfg(tfAttestation attestationAttribute, attestation
 			MicrocodeVersion:     newVersion(tfAttestation.MicrocodeVersion),
 			FirmwareSignerConfig: firmwareCfg,
 			AMDRootKey:           rootKey,
+			Policy:               attestationPolicy,
 		}
 	case variant.AWSSEVSNP{}:
 		var rootKey config.Certificate
@@ -86,6 +96,7 @@ func convertFromTfAttestationCfg(tfAttestation attestationAttribute, attestation
 			SNPVersion:        newVersion(tfAttestation.SNPVersion),
 			MicrocodeVersion:  newVersion(tfAttestation.MicrocodeVersion),
 			AMDRootKey:        rootKey,
+			Policy:            attestationPolicy,
 		}
 	case variant.AzureTDX{}:
 		var rootKey config.Certificate
@@ -118,18 +129,22 @@ func convertFromTfAttestationCfg(tfAttestation attestationAttribute, attestation
 			MRSeam:       mrSeam,
 			XFAM:         newVersion(encoding.HexBytes(xfam)),
 			IntelRootKey: rootKey,
+			Policy:       attestationPolicy,
 		}
 	case variant.GCPSEVES{}:
 		attestationConfig = &config.GCPSEVES{
 			Measurements: c11nMeasurements,
+			Policy:       attestationPolicy,
 		}
 	case variant.GCPSEVSNP{}:
 		attestationConfig = &config.GCPSEVSNP{
 			Measurements: c11nMeasurements,
+			Policy:       attestationPolicy,
 		}
 	case variant.QEMUVTPM{}:
 		attestationConfig = &config.QEMUVTPM{
 			Measurements: c11nMeasurements,
+			Policy:       attestationPolicy,
 		}
 	default:
 		return nil, fmt.Errorf("unknown attestation variant: %s", attestationVariant)
@@ -11,6 +11,7 @@ import (
 
 	"github.com/edgelesssys/constellation/v2/internal/attestation/idkeydigest"
 	"github.com/edgelesssys/constellation/v2/internal/attestation/measurements"
+	"github.com/edgelesssys/constellation/v2/internal/attestation/policy"
 	"github.com/edgelesssys/constellation/v2/internal/attestation/variant"
 	"github.com/edgelesssys/constellation/v2/internal/config"
 	"github.com/stretchr/testify/assert"
@@ -33,6 +34,9 @@ func TestParseAttestationConfig(t *testing.T) {
 			"1": {Expected: "48656c6c6f", WarnOnly: false}, // "Hello" in hex
 			"2": {Expected: "776f726c64", WarnOnly: true},  // "world" in hex
 		},
+		Policy: []policyRuleAttribute{
+			{Name: "no debug", Expression: "!snp.policyFlags.debug"},
+		},
 	}
 	t.Run("Azure SEV-SNP success", func(t *testing.T) {
 		attestationVariant := variant.AzureSEVSNP{}
@@ -61,6 +65,8 @@ func TestParseAttestationConfig(t *testing.T) {
 		require.Equal(t, idkeydigest.Equal, azureCfg.FirmwareSignerConfig.EnforcementPolicy)
 
 		assert.Len(t, azureCfg.FirmwareSignerConfig.AcceptedKeyDigests, 1)
+
+		require.Equal(t, []policy.Rule{{Name: "no debug", Expression: "!snp.policyFlags.debug"}}, azureCfg.Policy)
 	})
 
 	// Test error scenarios
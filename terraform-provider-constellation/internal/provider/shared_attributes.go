@@ -166,6 +166,24 @@ func newAttestationConfigAttributeSchema(t attributeType) schema.Attribute {
 					},
 				},
 			},
+			"policy": schema.ListNestedAttribute{
+				MarkdownDescription: "Attestation policy. Each rule is a [CEL](https://cel.dev) expression over the claims of the attestation, which must evaluate to true for the attestation to succeed.",
+				Description:         "Attestation policy. Each rule is a CEL expression over the claims of the attestation, which must evaluate to true for the attestation to succeed.",
+				Computed:            !isInput,
+				Optional:            isInput,
+				NestedObject: schema.NestedAttributeObject{
+					Attributes: map[string]schema.Attribute{
+						"name": schema.StringAttribute{
+							Computed: !isInput,
+							Required: isInput,
+						},
+						"expression": schema.StringAttribute{
+							Computed: !isInput,
+							Required: isInput,
+						},
+					},
+				},
+			},
 			"measurements": newMeasurementsAttributeSchema(t),
 		},
 	}
@@ -182,6 +200,13 @@ type attestationAttribute struct {
 	TDX                          tdxConfigAttribute                    `tfsdk:"tdx"`
 	Variant                      string                                `tfsdk:"variant"`
 	Measurements                 map[string]measurementAttribute       `tfsdk:"measurements"`
+	Policy                       []policyRuleAttribute                 `tfsdk:"policy"`
+}
+
+// policyRuleAttribute is the attestation policy rule attribute's data model.
+type policyRuleAttribute struct {
+	Name       string `tfsdk:"name"`
+	Expression string `tfsdk:"expression"`
 }
 
 // azureSnpFirmwareSignerConfigAttribute is the azure firmware signer config attribute's data model.
@@ -235,6 +235,7 @@ module "instance_group" {
   node_group_name                  = each.key
   role                             = each.value.role
   initial_count                    = each.value.initial_count
+  create_server_group              = var.create_server_groups
   disk_size                        = each.value.state_disk_size
   state_disk_type                  = each.value.state_disk_type
   availability_zone                = each.value.zone
@@ -31,11 +31,11 @@ resource "openstack_networking_port_v2" "port" {
   security_group_ids = var.security_groups
 }
 
-# TODO(malt3): get this API enabled in the test environment
-# resource "openstack_compute_servergroup_v2" "instance_group" {
-#   name = local.name
-#   policies = ["soft-anti-affinity"]
-# }
+resource "openstack_compute_servergroup_v2" "instance_group" {
+  count    = var.create_server_group ? 1 : 0
+  name     = local.name
+  policies = ["soft-anti-affinity"]
+}
 
 data "openstack_compute_flavor_v2" "flavor" {
   flavor_id = local.flavor_id_is_uuid ? var.flavor_id : null
@@ -47,10 +47,12 @@ resource "openstack_compute_instance_v2" "instance_group_member" {
   count     = var.initial_count
   flavor_id = data.openstack_compute_flavor_v2.flavor.id
   tags      = local.tags
-  # TODO(malt3): get this API enabled in the test environment
-  # scheduler_hints {
-  #   group = openstack_compute_servergroup_v2.instance_group.id
-  # }
+  dynamic "scheduler_hints" {
+    for_each = openstack_compute_servergroup_v2.instance_group[*].id
+    content {
+      group = scheduler_hints.value
+    }
+  }
   network {
     port = openstack_networking_port_v2.port[count.index].id
   }
@@ -85,6 +87,10 @@ resource "openstack_compute_instance_v2" "instance_group_member" {
   })
   availability_zone_hints = length(var.availability_zone) > 0 ? var.availability_zone : null
   lifecycle {
-    ignore_changes = [block_device] # block device contains current image, which can be updated from inside the cluster
+    ignore_changes = [
+      block_device, # block device contains current image, which can be updated from inside the cluster
+      scheduler_hints, # servers can't join a server group after creation, changing the hints would replace them
+      metadata["constellation-scaling-group-image"], # image of the server group, set from inside the cluster
+    ]
   }
 }
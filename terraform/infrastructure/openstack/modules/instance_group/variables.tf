@@ -27,6 +27,11 @@ variable "uid" {
   description = "Unique ID of the Constellation."
 }
 
+variable "create_server_group" {
+  type        = bool
+  description = "Whether to create a server group for the instances. The node operator manages the members of the server group."
+}
+
 variable "initial_count" {
   type        = number
   description = "Number of instances in this instance group."
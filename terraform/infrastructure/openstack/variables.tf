@@ -59,6 +59,12 @@ variable "floating_ip_pool_id" {
   description = "Pool (network name) to use for floating IPs."
 }
 
+variable "create_server_groups" {
+  type        = bool
+  default     = true
+  description = "Whether to create a server group for each node group. Existing servers don't join new server groups, see the migration guide."
+}
+
 variable "additional_tags" {
   type        = list(any)
   default     = []
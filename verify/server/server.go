@@ -11,15 +11,17 @@ import (
 	"context"
 	"encoding/base64"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"log/slog"
 	"net"
 	"net/http"
+	"net/url"
 	"sync"
 	"time"
 
-	"github.com/edgelesssys/constellation/v2/internal/constants"
 	"github.com/edgelesssys/constellation/v2/internal/logger"
+	"github.com/edgelesssys/constellation/v2/verify/userdata"
 	"github.com/edgelesssys/constellation/v2/verify/verifyproto"
 	"google.golang.org/grpc"
 	"google.golang.org/grpc/codes"
@@ -110,8 +112,14 @@ func (s *Server) GetAttestation(ctx context.Context, req *verifyproto.GetAttesta
 		return nil, status.Error(codes.InvalidArgument, "nonce is required to issue attestation")
 	}
 
+	userData, err := userdata.FromRequest(req)
+	if err != nil {
+		log.With(slog.Any("error", err)).Error("Received attestation request with invalid user data")
+		return nil, status.Errorf(codes.InvalidArgument, "invalid user data: %v", err)
+	}
+
 	log.Info("Creating attestation")
-	statement, err := s.issuer.Issue(ctx, []byte(constants.ConstellationVerifyServiceUserData), req.Nonce)
+	statement, err := s.issuer.Issue(ctx, userData, req.Nonce)
 	if err != nil {
 		return nil, status.Errorf(codes.Internal, "issuing attestation statement: %v", err)
 	}
@@ -138,8 +146,21 @@ func (s *Server) getAttestationHTTP(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	req := &verifyproto.GetAttestationRequest{Nonce: nonce}
+	if err := parseUserDataQuery(r.URL.Query(), req); err != nil {
+		log.With(slog.Any("error", err)).Error("Received attestation request with invalid user data")
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	userData, err := userdata.FromRequest(req)
+	if err != nil {
+		log.With(slog.Any("error", err)).Error("Received attestation request with invalid user data")
+		http.Error(w, fmt.Sprintf("invalid user data: %v", err), http.StatusBadRequest)
+		return
+	}
+
 	log.Info("Creating attestation")
-	quote, err := s.issuer.Issue(r.Context(), []byte(constants.ConstellationVerifyServiceUserData), nonce)
+	quote, err := s.issuer.Issue(r.Context(), userData, nonce)
 	if err != nil {
 		http.Error(w, fmt.Sprintf("issuing attestation statement: %v", err), http.StatusInternalServerError)
 		return
@@ -152,6 +173,35 @@ func (s *Server) getAttestationHTTP(w http.ResponseWriter, r *http.Request) {
 	}
 }
 
+// parseUserDataQuery parses the optional user_data and claims query parameters into req.
+// user_data is base64 URL encoded data, claims is a base64 URL encoded JSON object of string values.
+func parseUserDataQuery(query url.Values, req *verifyproto.GetAttestationRequest) error {
+	if userDataB64, ok := query["user_data"]; ok {
+		if len(userDataB64) != 1 {
+			return errors.New("user_data parameter may only be specified once")
+		}
+		userData, err := base64.URLEncoding.DecodeString(userDataB64[0])
+		if err != nil {
+			return fmt.Errorf("invalid base64 encoding for user_data: %w", err)
+		}
+		req.UserData = userData
+	}
+
+	if claimsB64, ok := query["claims"]; ok {
+		if len(claimsB64) != 1 {
+			return errors.New("claims parameter may only be specified once")
+		}
+		claimsJSON, err := base64.URLEncoding.DecodeString(claimsB64[0])
+		if err != nil {
+			return fmt.Errorf("invalid base64 encoding for claims: %w", err)
+		}
+		if err := json.Unmarshal(claimsJSON, &req.Claims); err != nil {
+			return fmt.Errorf("invalid claims: %w", err)
+		}
+	}
+	return nil
+}
+
 // AttestationIssuer issues an attestation document for the provided userData and nonce.
 type AttestationIssuer interface {
 	Issue(ctx context.Context, userData []byte, nonce []byte) (quote []byte, err error)
@@ -18,8 +18,10 @@ import (
 	"sync"
 	"testing"
 
+	"github.com/edgelesssys/constellation/v2/internal/constants"
 	"github.com/edgelesssys/constellation/v2/internal/grpc/testdialer"
 	"github.com/edgelesssys/constellation/v2/internal/logger"
+	"github.com/edgelesssys/constellation/v2/verify/userdata"
 	"github.com/edgelesssys/constellation/v2/verify/verifyproto"
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
@@ -38,7 +40,7 @@ func TestRun(t *testing.T) {
 	var wg sync.WaitGroup
 	s := &Server{
 		log:    logger.NewTest(t),
-		issuer: stubIssuer{attestation: []byte("quote")},
+		issuer: &stubIssuer{attestation: []byte("quote")},
 	}
 
 	httpListener, grpcListener := setUpTestListeners()
@@ -75,25 +77,52 @@ func TestRun(t *testing.T) {
 
 func TestGetAttestationGRPC(t *testing.T) {
 	testCases := map[string]struct {
-		issuer  stubIssuer
-		request *verifyproto.GetAttestationRequest
-		wantErr bool
+		issuer       *stubIssuer
+		request      *verifyproto.GetAttestationRequest
+		wantUserData []byte
+		wantErr      bool
 	}{
 		"success": {
-			issuer: stubIssuer{attestation: []byte("quote")},
+			issuer: &stubIssuer{attestation: []byte("quote")},
 			request: &verifyproto.GetAttestationRequest{
 				Nonce: []byte("nonce"),
 			},
+			wantUserData: []byte(constants.ConstellationVerifyServiceUserData),
+		},
+		"user data": {
+			issuer: &stubIssuer{attestation: []byte("quote")},
+			request: &verifyproto.GetAttestationRequest{
+				Nonce:    []byte("nonce"),
+				UserData: []byte("session-key"),
+			},
+			wantUserData: userdata.FromUserData([]byte("session-key")),
+		},
+		"claims": {
+			issuer: &stubIssuer{attestation: []byte("quote")},
+			request: &verifyproto.GetAttestationRequest{
+				Nonce:  []byte("nonce"),
+				Claims: map[string]string{"session": "1234"},
+			},
+			wantUserData: []byte(`{"service":"VerifyService","claims":{"session":"1234"}}`),
+		},
+		"user data and claims": {
+			issuer: &stubIssuer{attestation: []byte("quote")},
+			request: &verifyproto.GetAttestationRequest{
+				Nonce:    []byte("nonce"),
+				UserData: []byte("session-key"),
+				Claims:   map[string]string{"session": "1234"},
+			},
+			wantErr: true,
 		},
 		"issuer fails": {
-			issuer: stubIssuer{issueErr: errors.New("issuer error")},
+			issuer: &stubIssuer{issueErr: errors.New("issuer error")},
 			request: &verifyproto.GetAttestationRequest{
 				Nonce: []byte("nonce"),
 			},
 			wantErr: true,
 		},
 		"no nonce": {
-			issuer:  stubIssuer{attestation: []byte("quote")},
+			issuer:  &stubIssuer{attestation: []byte("quote")},
 			request: &verifyproto.GetAttestationRequest{},
 			wantErr: true,
 		},
@@ -114,39 +143,74 @@ func TestGetAttestationGRPC(t *testing.T) {
 			} else {
 				assert.NoError(err)
 				assert.Equal(tc.issuer.attestation, resp.Attestation)
+				assert.Equal(tc.wantUserData, tc.issuer.userData)
 			}
 		})
 	}
 }
 
 func TestGetAttestationHTTP(t *testing.T) {
+	nonceQuery := "?nonce=" + base64.URLEncoding.EncodeToString([]byte("nonce"))
+
 	testCases := map[string]struct {
-		request string
-		issuer  stubIssuer
-		wantErr bool
+		request      string
+		issuer       *stubIssuer
+		wantUserData []byte
+		wantErr      bool
 	}{
 		"success": {
-			request: "?nonce=" + base64.URLEncoding.EncodeToString([]byte("nonce")),
-			issuer:  stubIssuer{attestation: []byte("quote")},
+			request:      nonceQuery,
+			issuer:       &stubIssuer{attestation: []byte("quote")},
+			wantUserData: []byte(constants.ConstellationVerifyServiceUserData),
+		},
+		"user data": {
+			request:      nonceQuery + "&user_data=" + base64.URLEncoding.EncodeToString([]byte("session-key")),
+			issuer:       &stubIssuer{attestation: []byte("quote")},
+			wantUserData: userdata.FromUserData([]byte("session-key")),
+		},
+		"claims": {
+			request:      nonceQuery + "&claims=" + base64.URLEncoding.EncodeToString([]byte(`{"session":"1234"}`)),
+			issuer:       &stubIssuer{attestation: []byte("quote")},
+			wantUserData: []byte(`{"service":"VerifyService","claims":{"session":"1234"}}`),
+		},
+		"invalid user data in query": {
+			request: nonceQuery + "&user_data=not-base-64",
+			issuer:  &stubIssuer{attestation: []byte("quote")},
+			wantErr: true,
+		},
+		"multiple user data parameters": {
+			request: nonceQuery + "&user_data=YQ==&user_data=Yg==",
+			issuer:  &stubIssuer{attestation: []byte("quote")},
+			wantErr: true,
+		},
+		"invalid claims in query": {
+			request: nonceQuery + "&claims=" + base64.URLEncoding.EncodeToString([]byte(`["session"]`)),
+			issuer:  &stubIssuer{attestation: []byte("quote")},
+			wantErr: true,
+		},
+		"user data and claims in query": {
+			request: nonceQuery + "&user_data=YQ==&claims=" + base64.URLEncoding.EncodeToString([]byte(`{"session":"1234"}`)),
+			issuer:  &stubIssuer{attestation: []byte("quote")},
+			wantErr: true,
 		},
 		"invalid nonce in query": {
 			request: "?nonce=not-base-64",
-			issuer:  stubIssuer{attestation: []byte("quote")},
+			issuer:  &stubIssuer{attestation: []byte("quote")},
 			wantErr: true,
 		},
 		"no nonce in query": {
 			request: "?foo=bar",
-			issuer:  stubIssuer{attestation: []byte("quote")},
+			issuer:  &stubIssuer{attestation: []byte("quote")},
 			wantErr: true,
 		},
 		"empty nonce in query": {
 			request: "?nonce=",
-			issuer:  stubIssuer{attestation: []byte("quote")},
+			issuer:  &stubIssuer{attestation: []byte("quote")},
 			wantErr: true,
 		},
 		"issuer fails": {
 			request: "?nonce=" + base64.URLEncoding.EncodeToString([]byte("nonce")),
-			issuer:  stubIssuer{issueErr: errors.New("errors")},
+			issuer:  &stubIssuer{issueErr: errors.New("errors")},
 			wantErr: true,
 		},
 	}
@@ -182,6 +246,7 @@ func TestGetAttestationHTTP(t *testing.T) {
 			require.NoError(json.Unmarshal(quote, &rawQuote))
 
 			assert.Equal(tc.issuer.attestation, rawQuote.Data)
+			assert.Equal(tc.wantUserData, tc.issuer.userData)
 		})
 	}
 }
@@ -195,8 +260,10 @@ func setUpTestListeners() (net.Listener, net.Listener) {
 type stubIssuer struct {
 	attestation []byte
 	issueErr    error
+	userData    []byte
 }
 
-func (i stubIssuer) Issue(_ context.Context, _ []byte, _ []byte) ([]byte, error) {
+func (i *stubIssuer) Issue(_ context.Context, userData []byte, _ []byte) ([]byte, error) {
+	i.userData = userData
 	return i.attestation, i.issueErr
 }
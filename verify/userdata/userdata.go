@@ -0,0 +1,102 @@
+/*
+Copyright (c) Edgeless Systems GmbH
+
+SPDX-License-Identifier: BUSL-1.1
+*/
+
+/*
+Package userdata computes the user data the verification service binds to attestation statements.
+
+Relying parties may supply their own data, e.g. a session or public key, when requesting an attestation.
+The data is bound to the attestation in one of two ways:
+
+  - Raw user data is hashed together with a fixed prefix.
+    The attestation contains SHA-256(prefix || user data).
+  - Claims are encoded as a structured JSON object.
+    The attestation contains the encoded object, which can be decoded using [ParseClaims].
+
+If the caller supplies neither, the attestation contains [constants.ConstellationVerifyServiceUserData].
+The fixed prefix and the service field of the claims object ensure the bound data
+can't be confused with user data used by other Constellation services.
+*/
+package userdata
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/json"
+	"errors"
+	"fmt"
+
+	"github.com/edgelesssys/constellation/v2/internal/constants"
+	"github.com/edgelesssys/constellation/v2/verify/verifyproto"
+)
+
+// userDataPrefix is hashed together with caller supplied user data.
+const userDataPrefix = constants.ConstellationVerifyServiceUserData + "/user-data\x00"
+
+// Claims is the structured claims object bound to an attestation.
+type Claims struct {
+	// Service is always [constants.ConstellationVerifyServiceUserData].
+	Service string `json:"service"`
+	// Claims are the caller supplied claims.
+	Claims map[string]string `json:"claims"`
+}
+
+// FromRequest returns the user data bound to the attestation issued for the given request.
+func FromRequest(req *verifyproto.GetAttestationRequest) ([]byte, error) {
+	switch {
+	case len(req.GetUserData()) > 0 && len(req.GetClaims()) > 0:
+		return nil, errors.New("user data and claims are mutually exclusive")
+	case len(req.GetUserData()) > 0:
+		return FromUserData(req.GetUserData()), nil
+	case len(req.GetClaims()) > 0:
+		return FromClaims(req.GetClaims())
+	default:
+		return []byte(constants.ConstellationVerifyServiceUserData), nil
+	}
+}
+
+// FromUserData binds caller supplied data by hashing it together with a fixed prefix.
+func FromUserData(data []byte) []byte {
+	digest := sha256.Sum256(append([]byte(userDataPrefix), data...))
+	return digest[:]
+}
+
+// FromClaims binds caller supplied claims by encoding them as a structured claims object.
+// The encoding is deterministic, so the result can be recomputed by relying parties.
+func FromClaims(claims map[string]string) ([]byte, error) {
+	// json.Marshal sorts map keys, which makes the encoding deterministic
+	encoded, err := json.Marshal(Claims{
+		Service: constants.ConstellationVerifyServiceUserData,
+		Claims:  claims,
+	})
+	if err != nil {
+		return nil, fmt.Errorf("encoding claims: %w", err)
+	}
+	return encoded, nil
+}
+
+// ParseClaims decodes a structured claims object bound to an attestation.
+func ParseClaims(userData []byte) (map[string]string, error) {
+	var claims Claims
+	if err := json.Unmarshal(userData, &claims); err != nil {
+		return nil, fmt.Errorf("decoding claims: %w", err)
+	}
+	if claims.Service != constants.ConstellationVerifyServiceUserData {
+		return nil, fmt.Errorf("claims were issued for service %q, expected %q", claims.Service, constants.ConstellationVerifyServiceUserData)
+	}
+	return claims.Claims, nil
+}
+
+// Verify checks that the user data signed by an attestation matches the data requested by req.
+func Verify(req *verifyproto.GetAttestationRequest, signedData []byte) error {
+	want, err := FromRequest(req)
+	if err != nil {
+		return err
+	}
+	if !bytes.Equal(signedData, want) {
+		return errors.New("signed data in attestation does not match expected user data")
+	}
+	return nil
+}
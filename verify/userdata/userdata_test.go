@@ -0,0 +1,133 @@
+/*
+Copyright (c) Edgeless Systems GmbH
+
+SPDX-License-Identifier: BUSL-1.1
+*/
+
+package userdata
+
+import (
+	"crypto/sha256"
+	"testing"
+
+	"github.com/edgelesssys/constellation/v2/internal/constants"
+	"github.com/edgelesssys/constellation/v2/verify/verifyproto"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.uber.org/goleak"
+)
+
+func TestMain(m *testing.M) {
+	goleak.VerifyTestMain(m, goleak.IgnoreAnyFunction("github.com/bazelbuild/rules_go/go/tools/bzltestutil.RegisterTimeoutHandler.func1"))
+}
+
+func TestFromRequest(t *testing.T) {
+	userDataDigest := sha256.Sum256([]byte("VerifyService/user-data\x00session-key"))
+
+	testCases := map[string]struct {
+		req          *verifyproto.GetAttestationRequest
+		wantUserData []byte
+		wantErr      bool
+	}{
+		"default user data": {
+			req:          &verifyproto.GetAttestationRequest{Nonce: []byte("nonce")},
+			wantUserData: []byte(constants.ConstellationVerifyServiceUserData),
+		},
+		"user data": {
+			req: &verifyproto.GetAttestationRequest{
+				Nonce:    []byte("nonce"),
+				UserData: []byte("session-key"),
+			},
+			wantUserData: userDataDigest[:],
+		},
+		"claims": {
+			req: &verifyproto.GetAttestationRequest{
+				Nonce:  []byte("nonce"),
+				Claims: map[string]string{"session": "1234", "audience": "relying-party"},
+			},
+			wantUserData: []byte(`{"service":"VerifyService","claims":{"audience":"relying-party","session":"1234"}}`),
+		},
+		"user data and claims": {
+			req: &verifyproto.GetAttestationRequest{
+				Nonce:    []byte("nonce"),
+				UserData: []byte("session-key"),
+				Claims:   map[string]string{"session": "1234"},
+			},
+			wantErr: true,
+		},
+	}
+
+	for name, tc := range testCases {
+		t.Run(name, func(t *testing.T) {
+			assert := assert.New(t)
+
+			userData, err := FromRequest(tc.req)
+			if tc.wantErr {
+				assert.Error(err)
+				return
+			}
+			assert.NoError(err)
+			assert.Equal(tc.wantUserData, userData)
+		})
+	}
+}
+
+func TestParseClaims(t *testing.T) {
+	testCases := map[string]struct {
+		userData   []byte
+		wantClaims map[string]string
+		wantErr    bool
+	}{
+		"valid claims": {
+			userData:   []byte(`{"service":"VerifyService","claims":{"session":"1234"}}`),
+			wantClaims: map[string]string{"session": "1234"},
+		},
+		"wrong service": {
+			userData: []byte(`{"service":"OtherService","claims":{"session":"1234"}}`),
+			wantErr:  true,
+		},
+		"no claims object": {
+			userData: []byte(constants.ConstellationVerifyServiceUserData),
+			wantErr:  true,
+		},
+	}
+
+	for name, tc := range testCases {
+		t.Run(name, func(t *testing.T) {
+			assert := assert.New(t)
+
+			claims, err := ParseClaims(tc.userData)
+			if tc.wantErr {
+				assert.Error(err)
+				return
+			}
+			assert.NoError(err)
+			assert.Equal(tc.wantClaims, claims)
+		})
+	}
+}
+
+func TestClaimsRoundTrip(t *testing.T) {
+	assert := assert.New(t)
+	require := require.New(t)
+
+	claims := map[string]string{"session": "1234", "key": "abcd"}
+	userData, err := FromClaims(claims)
+	require.NoError(err)
+
+	parsed, err := ParseClaims(userData)
+	require.NoError(err)
+	assert.Equal(claims, parsed)
+}
+
+func TestVerify(t *testing.T) {
+	req := &verifyproto.GetAttestationRequest{
+		Nonce:    []byte("nonce"),
+		UserData: []byte("session-key"),
+	}
+
+	assert.NoError(t, Verify(req, FromUserData([]byte("session-key"))))
+	assert.Error(t, Verify(req, FromUserData([]byte("other-key"))))
+	assert.Error(t, Verify(req, []byte(constants.ConstellationVerifyServiceUserData)))
+	assert.NoError(t, Verify(&verifyproto.GetAttestationRequest{}, []byte(constants.ConstellationVerifyServiceUserData)))
+}
@@ -0,0 +1,172 @@
+/*
+Copyright (c) Edgeless Systems GmbH
+
+SPDX-License-Identifier: BUSL-1.1
+*/
+
+package verifier
+
+import (
+	"encoding/json"
+
+	"github.com/edgelesssys/constellation/v2/internal/attestation/policy"
+)
+
+// Claims are the claims of a verified attestation statement.
+// They're encoded using the names of the claims in attestation policies.
+type Claims struct {
+	// PCRs are the quoted PCR values.
+	PCRs map[uint32][]byte
+	// SNP are the claims of the SEV-SNP attestation report, if any.
+	SNP *SNPClaims
+	// TDX are the claims of the TDX quote, if any.
+	TDX *TDXClaims
+}
+
+// SNPClaims are the claims of an SEV-SNP attestation report.
+type SNPClaims struct {
+	// Version of the attestation report.
+	Version uint32
+	// GuestSVN is the security version number of the guest.
+	GuestSVN uint32
+	// Policy is the guest policy.
+	Policy uint64
+	// FamilyID is the family ID provided at launch.
+	FamilyID []byte
+	// ImageID is the image ID provided at launch.
+	ImageID []byte
+	// VMPL is the virtual machine privilege level of the report request.
+	VMPL uint32
+	// PlatformInfo describes the enabled features of the platform.
+	PlatformInfo uint64
+	// CurrentTCB is the current TCB version of the platform.
+	CurrentTCB TCB
+	// ReportedTCB is the TCB version used to derive the report signing key.
+	ReportedTCB TCB
+	// CommittedTCB is the committed TCB version of the platform.
+	CommittedTCB TCB
+	// LaunchTCB is the TCB version at the time the guest was launched.
+	LaunchTCB TCB
+	// Measurement is the launch measurement of the guest.
+	Measurement []byte
+	// HostData is the data provided by the hypervisor at launch.
+	HostData []byte
+	// IDKeyDigest is the digest of the ID key that signed the ID block.
+	IDKeyDigest []byte
+	// AuthorKeyDigest is the digest of the author key that signed the ID key.
+	AuthorKeyDigest []byte
+	// ReportData is the data provided by the guest in the report request.
+	ReportData []byte
+	// ChipID is the identifier of the processor.
+	ChipID []byte
+}
+
+// TCB are the security patch levels of an SEV-SNP TCB version.
+type TCB struct {
+	Bootloader uint8
+	TEE        uint8
+	SNP        uint8
+	Microcode  uint8
+}
+
+// TDXClaims are the claims of a TDX quote.
+type TDXClaims struct {
+	// TEETCBSVN is the security version number of the TDX module.
+	TEETCBSVN []byte
+	// MRSeam is the measurement of the TDX module.
+	MRSeam []byte
+	// TDAttributes are the attributes of the trust domain.
+	TDAttributes []byte
+	// XFAM is the extended features available mask of the trust domain.
+	XFAM []byte
+	// MRTD is the initial measurement of the trust domain.
+	MRTD []byte
+	// MRConfigID is the software defined ID of the trust domain configuration.
+	MRConfigID []byte
+	// MROwner is the software defined ID of the trust domain owner.
+	MROwner []byte
+	// MROwnerConfig is the software defined ID of the owner defined configuration.
+	MROwnerConfig []byte
+	// RTMRs are the runtime measurement registers.
+	RTMRs [][]byte
+	// ReportData is the data provided by the trust domain in the report request.
+	ReportData []byte
+}
+
+// MarshalJSON encodes the claims using the names and encodings of attestation policies.
+// Claims that aren't available are omitted.
+func (c Claims) MarshalJSON() ([]byte, error) {
+	return json.Marshal(c.toPolicy())
+}
+
+// UnmarshalJSON decodes claims encoded by [Claims.MarshalJSON].
+func (c *Claims) UnmarshalJSON(data []byte) error {
+	var claims policy.Claims
+	if err := json.Unmarshal(data, &claims); err != nil {
+		return err
+	}
+	*c = *claimsFromPolicy(claims)
+	return nil
+}
+
+// claimsFromPolicy converts the claims of a validator.
+func claimsFromPolicy(claims policy.Claims) *Claims {
+	c := &Claims{PCRs: claims.PCRs}
+	if claims.SNP != nil {
+		c.SNP = &SNPClaims{
+			Version:         claims.SNP.Version,
+			GuestSVN:        claims.SNP.GuestSVN,
+			Policy:          claims.SNP.Policy,
+			FamilyID:        claims.SNP.FamilyID,
+			ImageID:         claims.SNP.ImageID,
+			VMPL:            claims.SNP.VMPL,
+			PlatformInfo:    claims.SNP.PlatformInfo,
+			CurrentTCB:      TCB(claims.SNP.CurrentTCB),
+			ReportedTCB:     TCB(claims.SNP.ReportedTCB),
+			CommittedTCB:    TCB(claims.SNP.CommittedTCB),
+			LaunchTCB:       TCB(claims.SNP.LaunchTCB),
+			Measurement:     claims.SNP.Measurement,
+			HostData:        claims.SNP.HostData,
+			IDKeyDigest:     claims.SNP.IDKeyDigest,
+			AuthorKeyDigest: claims.SNP.AuthorKeyDigest,
+			ReportData:      claims.SNP.ReportData,
+			ChipID:          claims.SNP.ChipID,
+		}
+	}
+	if claims.TDX != nil {
+		tdx := TDXClaims(*claims.TDX)
+		c.TDX = &tdx
+	}
+	return c
+}
+
+// toPolicy converts the claims to the claims of attestation policies.
+func (c Claims) toPolicy() policy.Claims {
+	claims := policy.Claims{PCRs: c.PCRs}
+	if c.SNP != nil {
+		claims.SNP = &policy.SNPClaims{
+			Version:         c.SNP.Version,
+			GuestSVN:        c.SNP.GuestSVN,
+			Policy:          c.SNP.Policy,
+			FamilyID:        c.SNP.FamilyID,
+			ImageID:         c.SNP.ImageID,
+			VMPL:            c.SNP.VMPL,
+			PlatformInfo:    c.SNP.PlatformInfo,
+			CurrentTCB:      policy.TCB(c.SNP.CurrentTCB),
+			ReportedTCB:     policy.TCB(c.SNP.ReportedTCB),
+			CommittedTCB:    policy.TCB(c.SNP.CommittedTCB),
+			LaunchTCB:       policy.TCB(c.SNP.LaunchTCB),
+			Measurement:     c.SNP.Measurement,
+			HostData:        c.SNP.HostData,
+			IDKeyDigest:     c.SNP.IDKeyDigest,
+			AuthorKeyDigest: c.SNP.AuthorKeyDigest,
+			ReportData:      c.SNP.ReportData,
+			ChipID:          c.SNP.ChipID,
+		}
+	}
+	if c.TDX != nil {
+		tdx := policy.TDXClaims(*c.TDX)
+		claims.TDX = &tdx
+	}
+	return claims
+}
@@ -0,0 +1,69 @@
+/*
+Copyright (c) Edgeless Systems GmbH
+
+SPDX-License-Identifier: BUSL-1.1
+*/
+
+// The verifier command serves the HTTP API of package verifier, so workloads that can't embed the Go package
+// can verify attestation statements of Constellation's verification service.
+package main
+
+import (
+	"flag"
+	"log/slog"
+	"net"
+	"net/http"
+	"os"
+	"strconv"
+	"time"
+
+	"github.com/edgelesssys/constellation/v2/internal/constants"
+	"github.com/edgelesssys/constellation/v2/internal/logger"
+	"github.com/edgelesssys/constellation/v2/verify/verifier"
+)
+
+func main() {
+	attestationVariant := flag.String("attestation-variant", "", "attestation variant of the cluster")
+	attestationConfigPath := flag.String("attestation-config", "", "path to the JSON encoded attestation config of the cluster")
+	ownerID := flag.String("owner-id", "", "hex or base64 encoded owner ID of the cluster")
+	clusterID := flag.String("cluster-id", "", "hex or base64 encoded cluster ID of the cluster")
+	port := flag.Int("port", 8080, "port to serve the HTTP API on")
+	verbosity := flag.Int("v", 0, logger.CmdLineVerbosityDescription)
+
+	flag.Parse()
+	log := logger.NewJSONLogger(logger.VerbosityFromInt(*verbosity))
+
+	log.With(slog.String("version", constants.BinaryVersion().String()), slog.String("attestationVariant", *attestationVariant)).
+		Info("Constellation Attestation Verifier")
+
+	attestationConfig, err := os.ReadFile(*attestationConfigPath)
+	if err != nil {
+		log.With(slog.Any("error", err)).Error("Failed to read attestation config")
+		os.Exit(1)
+	}
+	cfg, err := verifier.ParseAttestationConfig(*attestationVariant, attestationConfig)
+	if err != nil {
+		log.With(slog.Any("error", err)).Error("Failed to parse attestation config")
+		os.Exit(1)
+	}
+	if err := cfg.UpdateInitMeasurements(*ownerID, *clusterID); err != nil {
+		log.With(slog.Any("error", err)).Error("Failed to update measurements of owner and cluster ID")
+		os.Exit(1)
+	}
+
+	listener, err := net.Listen("tcp", net.JoinHostPort("", strconv.Itoa(*port)))
+	if err != nil {
+		log.With(slog.Any("error", err), slog.Int("port", *port)).Error("Failed to listen")
+		os.Exit(1)
+	}
+
+	server := &http.Server{
+		Handler:           verifier.NewHandler(verifier.New(cfg, log.WithGroup("verifier"))),
+		ReadHeaderTimeout: 10 * time.Second,
+	}
+	log.Info("Starting HTTP server", slog.String("address", listener.Addr().String()))
+	if err := server.Serve(listener); err != nil {
+		log.With(slog.Any("error", err)).Error("Failed to serve HTTP API")
+		os.Exit(1)
+	}
+}
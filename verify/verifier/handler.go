@@ -0,0 +1,77 @@
+/*
+Copyright (c) Edgeless Systems GmbH
+
+SPDX-License-Identifier: BUSL-1.1
+*/
+
+package verifier
+
+import (
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"net/http"
+
+	"github.com/edgelesssys/constellation/v2/verify/verifyproto"
+)
+
+// maxRequestSize limits the size of verification requests.
+// Attestation statements including an event log are a few hundred kilobytes at most.
+const maxRequestSize = 4 << 20
+
+// Request is the body of a verification request to the HTTP API.
+type Request struct {
+	// Attestation is the attestation statement, i.e., the data field of the verification service's response.
+	Attestation []byte `json:"attestation"`
+	// Nonce is the nonce the attestation statement was requested with.
+	Nonce []byte `json:"nonce"`
+	// UserData is the user data the attestation statement was requested with, if any.
+	UserData []byte `json:"userData,omitempty"`
+	// Claims are the claims the attestation statement was requested with, if any.
+	Claims map[string]string `json:"claims,omitempty"`
+}
+
+// NewHandler returns an HTTP handler serving the verifier's HTTP API.
+//
+// Verification requests are sent as JSON encoded [Request] to POST /v1/verify.
+// Byte values are base64 encoded.
+// The response is the JSON encoded [Verdict], with status code 200 regardless of whether the verification succeeded.
+// Malformed requests are rejected with status code 400.
+func NewHandler(v *Verifier) http.Handler {
+	mux := http.NewServeMux()
+	mux.HandleFunc("POST /"+APIVersion+"/verify", v.verifyHTTP)
+	return mux
+}
+
+// verifyHTTP implements the HTTP endpoint for verifying attestation statements.
+func (v *Verifier) verifyHTTP(w http.ResponseWriter, r *http.Request) {
+	log := v.log.With(slog.String("peerAddress", r.RemoteAddr)).WithGroup("http")
+
+	var req Request
+	if err := json.NewDecoder(http.MaxBytesReader(w, r.Body, maxRequestSize)).Decode(&req); err != nil {
+		log.With(slog.Any("error", err)).Error("Received invalid verification request")
+		http.Error(w, fmt.Sprintf("decoding request: %v", err), http.StatusBadRequest)
+		return
+	}
+	if len(req.Attestation) == 0 || len(req.Nonce) == 0 {
+		log.Error("Received verification request without attestation or nonce")
+		http.Error(w, "attestation and nonce are required", http.StatusBadRequest)
+		return
+	}
+
+	verdict, err := v.Verify(r.Context(), req.Attestation, &verifyproto.GetAttestationRequest{
+		Nonce:    req.Nonce,
+		UserData: req.UserData,
+		Claims:   req.Claims,
+	})
+	if err != nil {
+		log.With(slog.Any("error", err)).Warn("Verification failed")
+	} else {
+		log.Info("Verification successful")
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(verdict); err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+	}
+}
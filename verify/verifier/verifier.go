@@ -0,0 +1,176 @@
+/*
+Copyright (c) Edgeless Systems GmbH
+
+SPDX-License-Identifier: BUSL-1.1
+*/
+
+/*
+Package verifier verifies attestation statements issued by Constellation's verification service.
+
+Workloads outside of the cluster use the verifier to check that an attestation statement
+was issued by a node of a cluster with the expected attestation config, and that it is bound
+to the nonce and the user data or claims of their request.
+The result is returned as a structured [Verdict], including the claims of the verified attestation.
+All attestation variants supported by Constellation can be verified.
+
+The package is part of Constellation's public Go API and follows the versioning of the Constellation module.
+The JSON encoding of the [Verdict] and the HTTP API served by [NewHandler] are versioned separately by [APIVersion].
+*/
+package verifier
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+
+	"github.com/edgelesssys/constellation/v2/internal/atls"
+	"github.com/edgelesssys/constellation/v2/internal/attestation/choose"
+	"github.com/edgelesssys/constellation/v2/internal/attestation/policy"
+	"github.com/edgelesssys/constellation/v2/internal/attestation/variant"
+	"github.com/edgelesssys/constellation/v2/internal/config"
+	"github.com/edgelesssys/constellation/v2/verify/userdata"
+	"github.com/edgelesssys/constellation/v2/verify/verifyproto"
+)
+
+// APIVersion is the version of the verdict encoding and the HTTP API.
+const APIVersion = "v1"
+
+// AttestationConfig is the attestation config of a Constellation cluster.
+// Use [ParseAttestationConfig] to create it.
+type AttestationConfig struct {
+	cfg config.AttestationCfg
+}
+
+// ParseAttestationConfig parses the JSON encoded attestation config of the given attestation variant,
+// e.g., the attestationConfig of the join-config ConfigMap in the cluster's kube-system namespace.
+func ParseAttestationConfig(attestationVariant string, data []byte) (*AttestationConfig, error) {
+	attVariant, err := variant.FromString(attestationVariant)
+	if err != nil {
+		return nil, fmt.Errorf("parsing attestation variant: %w", err)
+	}
+	cfg, err := config.UnmarshalAttestationConfig(data, attVariant)
+	if err != nil {
+		return nil, fmt.Errorf("unmarshalling attestation config: %w", err)
+	}
+	return &AttestationConfig{cfg: cfg}, nil
+}
+
+// Variant returns the attestation variant of the config.
+func (c *AttestationConfig) Variant() string {
+	return c.cfg.GetVariant().String()
+}
+
+// UpdateInitMeasurements sets the expected values of the owner and cluster ID measurements depending on the
+// attestation variant. The IDs are hex or base64 encoded. Measurements of empty IDs are removed from the config.
+func (c *AttestationConfig) UpdateInitMeasurements(ownerID, clusterID string) error {
+	return c.cfg.GetMeasurements().UpdateInitMeasurements(c.cfg.GetVariant(), ownerID, clusterID)
+}
+
+// Verdict is the result of the verification of an attestation statement.
+type Verdict struct {
+	// APIVersion is the version of the encoding, always [APIVersion].
+	APIVersion string `json:"apiVersion"`
+	// Verified is true if the attestation statement was verified successfully.
+	Verified bool `json:"verified"`
+	// Variant is the attestation variant the statement was verified against.
+	Variant string `json:"variant"`
+	// Reason explains why the verification failed.
+	Reason string `json:"reason,omitempty"`
+	// Warnings are reported during verification, e.g., for mismatching measurements that aren't enforced.
+	Warnings []string `json:"warnings,omitempty"`
+	// Claims are the claims of the attestation statement. Only set if the statement was verified.
+	Claims *Claims `json:"claims,omitempty"`
+	// UserClaims are the caller supplied claims the attestation statement is bound to, if any.
+	UserClaims map[string]string `json:"userClaims,omitempty"`
+}
+
+// Verifier verifies attestation statements of Constellation's verification service.
+type Verifier struct {
+	config config.AttestationCfg
+	log    *slog.Logger
+}
+
+// New returns a verifier for attestation statements of clusters using the given attestation config.
+// The measurements of the config must contain the expected values of the cluster,
+// including the measurements of the owner and cluster ID, see [AttestationConfig.UpdateInitMeasurements].
+func New(cfg *AttestationConfig, log *slog.Logger) *Verifier {
+	return &Verifier{
+		config: cfg.cfg,
+		log:    log,
+	}
+}
+
+// Verify verifies the attestation statement issued by the verification service for req.
+// The statement must match the attestation config of the verifier,
+// and be bound to the nonce and the user data or claims of req.
+// The returned verdict describes the result. If the verification fails, the reason is also returned as error.
+func (v *Verifier) Verify(ctx context.Context, attestation []byte, req *verifyproto.GetAttestationRequest) (Verdict, error) {
+	verdict := Verdict{
+		APIVersion: APIVersion,
+		Variant:    v.config.GetVariant().String(),
+	}
+
+	log := &warningLogger{log: v.log}
+	claims, err := v.verify(ctx, attestation, req, log)
+	verdict.Warnings = log.warnings
+	if err != nil {
+		verdict.Reason = err.Error()
+		return verdict, err
+	}
+
+	verdict.Verified = true
+	verdict.Claims = claimsFromPolicy(claims)
+	verdict.UserClaims = req.GetClaims()
+	return verdict, nil
+}
+
+func (v *Verifier) verify(ctx context.Context, attestation []byte, req *verifyproto.GetAttestationRequest, log *warningLogger) (policy.Claims, error) {
+	if len(req.GetNonce()) == 0 {
+		return policy.Claims{}, errors.New("nonce is required")
+	}
+
+	validator, err := choose.Validator(v.config, log)
+	if err != nil {
+		return policy.Claims{}, fmt.Errorf("creating validator: %w", err)
+	}
+
+	var signedData []byte
+	var claims policy.Claims
+	if claimsValidator, ok := validator.(claimsValidator); ok {
+		signedData, claims, err = claimsValidator.ValidateClaims(ctx, attestation, req.GetNonce())
+	} else {
+		signedData, err = validator.Validate(ctx, attestation, req.GetNonce())
+	}
+	if err != nil {
+		return policy.Claims{}, fmt.Errorf("validating attestation: %w", err)
+	}
+
+	if err := userdata.Verify(req, signedData); err != nil {
+		return policy.Claims{}, err
+	}
+	return claims, nil
+}
+
+// claimsValidator is implemented by validators that return the claims of a validated attestation.
+type claimsValidator interface {
+	atls.Validator
+	ValidateClaims(ctx context.Context, attDoc []byte, nonce []byte) ([]byte, policy.Claims, error)
+}
+
+// warningLogger records the warnings of a validator.
+type warningLogger struct {
+	log      *slog.Logger
+	warnings []string
+}
+
+// Info logs the message.
+func (l *warningLogger) Info(msg string, args ...any) {
+	l.log.Info(msg, args...)
+}
+
+// Warn logs and records the message.
+func (l *warningLogger) Warn(msg string, args ...any) {
+	l.log.Warn(msg, args...)
+	l.warnings = append(l.warnings, msg)
+}
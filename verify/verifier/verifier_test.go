@@ -0,0 +1,266 @@
+/*
+Copyright (c) Edgeless Systems GmbH
+
+SPDX-License-Identifier: BUSL-1.1
+*/
+
+package verifier
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/edgelesssys/constellation/v2/internal/atls"
+	"github.com/edgelesssys/constellation/v2/internal/config"
+	"github.com/edgelesssys/constellation/v2/internal/constants"
+	"github.com/edgelesssys/constellation/v2/internal/logger"
+	"github.com/edgelesssys/constellation/v2/verify/userdata"
+	"github.com/edgelesssys/constellation/v2/verify/verifyproto"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.uber.org/goleak"
+)
+
+func TestMain(m *testing.M) {
+	goleak.VerifyTestMain(m, goleak.IgnoreAnyFunction("github.com/bazelbuild/rules_go/go/tools/bzltestutil.RegisterTimeoutHandler.func1"))
+}
+
+func TestVerify(t *testing.T) {
+	nonce := []byte("nonce")
+
+	testCases := map[string]struct {
+		attestation    []byte
+		req            *verifyproto.GetAttestationRequest
+		wantUserClaims map[string]string
+		wantErr        bool
+	}{
+		"default user data": {
+			attestation: fakeAttestation(t, []byte(constants.ConstellationVerifyServiceUserData), nonce),
+			req:         &verifyproto.GetAttestationRequest{Nonce: nonce},
+		},
+		"user data": {
+			attestation: fakeAttestation(t, userdata.FromUserData([]byte("session-key")), nonce),
+			req:         &verifyproto.GetAttestationRequest{Nonce: nonce, UserData: []byte("session-key")},
+		},
+		"claims": {
+			attestation:    fakeAttestation(t, mustFromClaims(t, map[string]string{"session": "1234"}), nonce),
+			req:            &verifyproto.GetAttestationRequest{Nonce: nonce, Claims: map[string]string{"session": "1234"}},
+			wantUserClaims: map[string]string{"session": "1234"},
+		},
+		"attestation is not bound to user data": {
+			attestation: fakeAttestation(t, []byte(constants.ConstellationVerifyServiceUserData), nonce),
+			req:         &verifyproto.GetAttestationRequest{Nonce: nonce, UserData: []byte("session-key")},
+			wantErr:     true,
+		},
+		"attestation is not bound to nonce": {
+			attestation: fakeAttestation(t, []byte(constants.ConstellationVerifyServiceUserData), []byte("other-nonce")),
+			req:         &verifyproto.GetAttestationRequest{Nonce: nonce},
+			wantErr:     true,
+		},
+		"missing nonce": {
+			attestation: fakeAttestation(t, []byte(constants.ConstellationVerifyServiceUserData), nil),
+			req:         &verifyproto.GetAttestationRequest{},
+			wantErr:     true,
+		},
+		"invalid attestation": {
+			attestation: []byte("invalid"),
+			req:         &verifyproto.GetAttestationRequest{Nonce: nonce},
+			wantErr:     true,
+		},
+	}
+
+	for name, tc := range testCases {
+		t.Run(name, func(t *testing.T) {
+			assert := assert.New(t)
+
+			verifier := New(&AttestationConfig{cfg: &config.DummyCfg{}}, logger.NewTest(t))
+			verdict, err := verifier.Verify(t.Context(), tc.attestation, tc.req)
+
+			assert.Equal(APIVersion, verdict.APIVersion)
+			assert.Equal("dummy", verdict.Variant)
+			if tc.wantErr {
+				assert.Error(err)
+				assert.False(verdict.Verified)
+				assert.NotEmpty(verdict.Reason)
+				assert.Nil(verdict.Claims)
+				return
+			}
+			assert.NoError(err)
+			assert.True(verdict.Verified)
+			assert.Empty(verdict.Reason)
+			assert.NotNil(verdict.Claims)
+			assert.Equal(tc.wantUserClaims, verdict.UserClaims)
+		})
+	}
+}
+
+func TestParseAttestationConfig(t *testing.T) {
+	testCases := map[string]struct {
+		variant string
+		data    []byte
+		wantErr bool
+	}{
+		"valid config": {
+			variant: "qemu-vtpm",
+			data:    []byte(`{"measurements":{"0":{"expected":"0000000000000000000000000000000000000000000000000000000000000000","warnOnly":false}}}`),
+		},
+		"unknown variant": {
+			variant: "unknown",
+			data:    []byte(`{}`),
+			wantErr: true,
+		},
+		"invalid config": {
+			variant: "qemu-vtpm",
+			data:    []byte(`{"measurements":`),
+			wantErr: true,
+		},
+	}
+
+	for name, tc := range testCases {
+		t.Run(name, func(t *testing.T) {
+			assert := assert.New(t)
+
+			cfg, err := ParseAttestationConfig(tc.variant, tc.data)
+			if tc.wantErr {
+				assert.Error(err)
+				return
+			}
+			assert.NoError(err)
+			assert.Equal(tc.variant, cfg.Variant())
+			assert.Len(cfg.cfg.GetMeasurements(), 1)
+		})
+	}
+}
+
+func TestClaimsJSON(t *testing.T) {
+	testCases := map[string]Claims{
+		"pcrs": {
+			PCRs: map[uint32][]byte{0: {0x01, 0x02}, 15: {0x03}},
+		},
+		"snp": {
+			SNP: &SNPClaims{
+				Version:     2,
+				GuestSVN:    1,
+				Policy:      0x30000,
+				VMPL:        0,
+				CurrentTCB:  TCB{Bootloader: 3, TEE: 0, SNP: 8, Microcode: 115},
+				LaunchTCB:   TCB{Bootloader: 3, TEE: 0, SNP: 8, Microcode: 115},
+				Measurement: []byte{0x04, 0x05},
+				ReportData:  []byte{0x06},
+				ChipID:      []byte{0x07},
+			},
+		},
+		"tdx": {
+			TDX: &TDXClaims{
+				MRTD:  []byte{0x08},
+				RTMRs: [][]byte{{0x09}, {0x0a}},
+			},
+		},
+	}
+
+	for name, claims := range testCases {
+		t.Run(name, func(t *testing.T) {
+			assert := assert.New(t)
+			require := require.New(t)
+
+			data, err := json.Marshal(claims)
+			require.NoError(err)
+			policyData, err := json.Marshal(claims.toPolicy())
+			require.NoError(err)
+			assert.JSONEq(string(policyData), string(data))
+
+			var decoded Claims
+			require.NoError(json.Unmarshal(data, &decoded))
+			assert.Equal(claims.PCRs, decoded.PCRs)
+			assert.Equal(claims.SNP, decoded.SNP)
+			assert.Equal(claims.TDX, decoded.TDX)
+		})
+	}
+}
+
+func TestVerifyHTTP(t *testing.T) {
+	nonce := []byte("nonce")
+
+	testCases := map[string]struct {
+		method       string
+		body         []byte
+		wantStatus   int
+		wantVerified bool
+	}{
+		"verified": {
+			method: http.MethodPost,
+			body: mustMarshal(t, Request{
+				Attestation: fakeAttestation(t, userdata.FromUserData([]byte("session-key")), nonce),
+				Nonce:       nonce,
+				UserData:    []byte("session-key"),
+			}),
+			wantStatus:   http.StatusOK,
+			wantVerified: true,
+		},
+		"verification failed": {
+			method: http.MethodPost,
+			body: mustMarshal(t, Request{
+				Attestation: fakeAttestation(t, []byte(constants.ConstellationVerifyServiceUserData), nonce),
+				Nonce:       nonce,
+				UserData:    []byte("session-key"),
+			}),
+			wantStatus: http.StatusOK,
+		},
+		"missing nonce": {
+			method: http.MethodPost,
+			body: mustMarshal(t, Request{
+				Attestation: fakeAttestation(t, []byte(constants.ConstellationVerifyServiceUserData), nonce),
+			}),
+			wantStatus: http.StatusBadRequest,
+		},
+		"invalid body": {
+			method:     http.MethodPost,
+			body:       []byte("invalid"),
+			wantStatus: http.StatusBadRequest,
+		},
+		"wrong method": {
+			method:     http.MethodGet,
+			wantStatus: http.StatusMethodNotAllowed,
+		},
+	}
+
+	for name, tc := range testCases {
+		t.Run(name, func(t *testing.T) {
+			assert := assert.New(t)
+			require := require.New(t)
+
+			handler := NewHandler(New(&AttestationConfig{cfg: &config.DummyCfg{}}, logger.NewTest(t)))
+			req := httptest.NewRequest(tc.method, "/v1/verify", bytes.NewReader(tc.body))
+			resp := httptest.NewRecorder()
+			handler.ServeHTTP(resp, req)
+
+			require.Equal(tc.wantStatus, resp.Code)
+			if tc.wantStatus != http.StatusOK {
+				return
+			}
+			var verdict Verdict
+			require.NoError(json.Unmarshal(resp.Body.Bytes(), &verdict))
+			assert.Equal(APIVersion, verdict.APIVersion)
+			assert.Equal(tc.wantVerified, verdict.Verified)
+		})
+	}
+}
+
+func fakeAttestation(t *testing.T, userData, nonce []byte) []byte {
+	return mustMarshal(t, atls.FakeAttestationDoc{UserData: userData, Nonce: nonce})
+}
+
+func mustFromClaims(t *testing.T, claims map[string]string) []byte {
+	userData, err := userdata.FromClaims(claims)
+	require.NoError(t, err)
+	return userData
+}
+
+func mustMarshal(t *testing.T, v any) []byte {
+	out, err := json.Marshal(v)
+	require.NoError(t, err)
+	return out
+}
@@ -0,0 +1,70 @@
+/*
+Copyright (c) Edgeless Systems GmbH
+
+SPDX-License-Identifier: BUSL-1.1
+*/
+
+/*
+Package verifyclient retrieves attestation statements from Constellation's verification service and verifies them.
+
+Besides validating the attestation statement, the client checks that the statement is bound
+to the user data or claims of the request, as described in package [userdata].
+*/
+package verifyclient
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/edgelesssys/constellation/v2/internal/atls"
+	"github.com/edgelesssys/constellation/v2/verify/userdata"
+	"github.com/edgelesssys/constellation/v2/verify/verifyproto"
+	"google.golang.org/grpc"
+)
+
+// Client requests attestation statements from the verification service.
+type Client struct {
+	dialer Dialer
+}
+
+// New creates a new verification service client.
+func New(dialer Dialer) *Client {
+	return &Client{dialer: dialer}
+}
+
+// Verify requests an attestation statement for req from the verification service at endpoint,
+// validates it using validator, and checks that it is bound to the user data of req.
+// It returns the raw attestation statement.
+func (c *Client) Verify(ctx context.Context, endpoint string, req *verifyproto.GetAttestationRequest, validator atls.Validator) ([]byte, error) {
+	conn, err := c.dialer.DialInsecure(endpoint)
+	if err != nil {
+		return nil, fmt.Errorf("dialing verification service: %w", err)
+	}
+	defer conn.Close()
+
+	resp, err := verifyproto.NewAPIClient(conn).GetAttestation(ctx, req)
+	if err != nil {
+		return nil, fmt.Errorf("getting attestation: %w", err)
+	}
+
+	if err := VerifyAttestation(ctx, resp.Attestation, req, validator); err != nil {
+		return nil, err
+	}
+	return resp.Attestation, nil
+}
+
+// VerifyAttestation validates an attestation statement issued by the verification service for req,
+// e.g. one retrieved from the HTTP endpoint, and checks that it is bound to the user data of req.
+func VerifyAttestation(ctx context.Context, attestation []byte, req *verifyproto.GetAttestationRequest, validator atls.Validator) error {
+	signedData, err := validator.Validate(ctx, attestation, req.Nonce)
+	if err != nil {
+		return fmt.Errorf("validating attestation: %w", err)
+	}
+	return userdata.Verify(req, signedData)
+}
+
+// Dialer dials the verification service without aTLS.
+// The attestation statement is validated by the client itself.
+type Dialer interface {
+	DialInsecure(endpoint string) (conn *grpc.ClientConn, err error)
+}
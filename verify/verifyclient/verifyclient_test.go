@@ -0,0 +1,118 @@
+/*
+Copyright (c) Edgeless Systems GmbH
+
+SPDX-License-Identifier: BUSL-1.1
+*/
+
+package verifyclient
+
+import (
+	"context"
+	"encoding/json"
+	"net"
+	"strconv"
+	"testing"
+
+	"github.com/edgelesssys/constellation/v2/internal/atls"
+	"github.com/edgelesssys/constellation/v2/internal/attestation/variant"
+	"github.com/edgelesssys/constellation/v2/internal/constants"
+	"github.com/edgelesssys/constellation/v2/internal/grpc/dialer"
+	"github.com/edgelesssys/constellation/v2/internal/grpc/testdialer"
+	"github.com/edgelesssys/constellation/v2/internal/logger"
+	"github.com/edgelesssys/constellation/v2/verify/server"
+	"github.com/edgelesssys/constellation/v2/verify/verifyproto"
+	"github.com/stretchr/testify/assert"
+	"go.uber.org/goleak"
+	"google.golang.org/grpc"
+)
+
+func TestMain(m *testing.M) {
+	goleak.VerifyTestMain(m, goleak.IgnoreAnyFunction("github.com/bazelbuild/rules_go/go/tools/bzltestutil.RegisterTimeoutHandler.func1"))
+}
+
+func TestVerify(t *testing.T) {
+	testCases := map[string]struct {
+		issuer  *fakeIssuer
+		req     *verifyproto.GetAttestationRequest
+		wantErr bool
+	}{
+		"default user data": {
+			issuer: &fakeIssuer{},
+			req:    &verifyproto.GetAttestationRequest{Nonce: []byte("nonce")},
+		},
+		"user data": {
+			issuer: &fakeIssuer{},
+			req: &verifyproto.GetAttestationRequest{
+				Nonce:    []byte("nonce"),
+				UserData: []byte("session-key"),
+			},
+		},
+		"claims": {
+			issuer: &fakeIssuer{},
+			req: &verifyproto.GetAttestationRequest{
+				Nonce:  []byte("nonce"),
+				Claims: map[string]string{"session": "1234"},
+			},
+		},
+		"attestation is not bound to user data": {
+			issuer: &fakeIssuer{overrideUserData: []byte(constants.ConstellationVerifyServiceUserData)},
+			req: &verifyproto.GetAttestationRequest{
+				Nonce:    []byte("nonce"),
+				UserData: []byte("session-key"),
+			},
+			wantErr: true,
+		},
+		"attestation is not bound to nonce": {
+			issuer:  &fakeIssuer{overrideNonce: []byte("other-nonce")},
+			req:     &verifyproto.GetAttestationRequest{Nonce: []byte("nonce")},
+			wantErr: true,
+		},
+		"user data and claims": {
+			issuer: &fakeIssuer{},
+			req: &verifyproto.GetAttestationRequest{
+				Nonce:    []byte("nonce"),
+				UserData: []byte("session-key"),
+				Claims:   map[string]string{"session": "1234"},
+			},
+			wantErr: true,
+		},
+	}
+
+	for name, tc := range testCases {
+		t.Run(name, func(t *testing.T) {
+			assert := assert.New(t)
+
+			netDialer := testdialer.NewBufconnDialer()
+			verifyServer := grpc.NewServer()
+			verifyproto.RegisterAPIServer(verifyServer, server.New(logger.NewTest(t), tc.issuer))
+			addr := net.JoinHostPort("192.0.2.1", strconv.Itoa(constants.VerifyServiceNodePortGRPC))
+			go verifyServer.Serve(netDialer.GetListener(addr))
+			defer verifyServer.GracefulStop()
+
+			client := New(dialer.New(nil, nil, netDialer))
+			attestation, err := client.Verify(t.Context(), addr, tc.req, atls.NewFakeValidator(variant.Dummy{}))
+			if tc.wantErr {
+				assert.Error(err)
+				return
+			}
+			assert.NoError(err)
+			assert.NotEmpty(attestation)
+		})
+	}
+}
+
+// fakeIssuer issues fake attestation documents for the requested user data and nonce.
+type fakeIssuer struct {
+	overrideUserData []byte
+	overrideNonce    []byte
+}
+
+func (i *fakeIssuer) Issue(_ context.Context, userData []byte, nonce []byte) ([]byte, error) {
+	if i.overrideUserData != nil {
+		userData = i.overrideUserData
+	}
+	if i.overrideNonce != nil {
+		nonce = i.overrideNonce
+	}
+	return json.Marshal(atls.FakeAttestationDoc{UserData: userData, Nonce: nonce})
+}
@@ -28,6 +28,8 @@ const (
 type GetAttestationRequest struct {
 	state         protoimpl.MessageState `protogen:"open.v1"`
 	Nonce         []byte                 `protobuf:"bytes,2,opt,name=nonce,proto3" json:"nonce,omitempty"`
+	UserData      []byte                 `protobuf:"bytes,3,opt,name=user_data,json=userData,proto3" json:"user_data,omitempty"`
+	Claims        map[string]string      `protobuf:"bytes,4,rep,name=claims,proto3" json:"claims,omitempty" protobuf_key:"bytes,1,opt,name=key" protobuf_val:"bytes,2,opt,name=value"`
 	unknownFields protoimpl.UnknownFields
 	sizeCache     protoimpl.SizeCache
 }
@@ -69,6 +71,20 @@ func (x *GetAttestationRequest) GetNonce() []byte {
 	return nil
 }
 
+func (x *GetAttestationRequest) GetUserData() []byte {
+	if x != nil {
+		return x.UserData
+	}
+	return nil
+}
+
+func (x *GetAttestationRequest) GetClaims() map[string]string {
+	if x != nil {
+		return x.Claims
+	}
+	return nil
+}
+
 type GetAttestationResponse struct {
 	state         protoimpl.MessageState `protogen:"open.v1"`
 	Attestation   []byte                 `protobuf:"bytes,1,opt,name=attestation,proto3" json:"attestation,omitempty"`
@@ -117,9 +133,14 @@ var File_verify_verifyproto_verify_proto protoreflect.FileDescriptor
 
 const file_verify_verifyproto_verify_proto_rawDesc = "" +
 	"\n" +
-	"\x1fverify/verifyproto/verify.proto\x12\x06verify\"-\n" +
+	"\x1fverify/verifyproto/verify.proto\x12\x06verify\"\xc8\x01\n" +
 	"\x15GetAttestationRequest\x12\x14\n" +
-	"\x05nonce\x18\x02 \x01(\fR\x05nonce\":\n" +
+	"\x05nonce\x18\x02 \x01(\fR\x05nonce\x12\x1b\n" +
+	"\tuser_data\x18\x03 \x01(\fR\buserData\x12A\n" +
+	"\x06claims\x18\x04 \x03(\v2).verify.GetAttestationRequest.ClaimsEntryR\x06claims\x1a9\n" +
+	"\vClaimsEntry\x12\x10\n" +
+	"\x03key\x18\x01 \x01(\tR\x03key\x12\x14\n" +
+	"\x05value\x18\x02 \x01(\tR\x05value:\x028\x01\":\n" +
 	"\x16GetAttestationResponse\x12 \n" +
 	"\vattestation\x18\x01 \x01(\fR\vattestation2V\n" +
 	"\x03API\x12O\n" +
@@ -137,19 +158,21 @@ func file_verify_verifyproto_verify_proto_rawDescGZIP() []byte {
 	return file_verify_verifyproto_verify_proto_rawDescData
 }
 
-var file_verify_verifyproto_verify_proto_msgTypes = make([]protoimpl.MessageInfo, 2)
+var file_verify_verifyproto_verify_proto_msgTypes = make([]protoimpl.MessageInfo, 3)
 var file_verify_verifyproto_verify_proto_goTypes = []any{
 	(*GetAttestationRequest)(nil),  // 0: verify.GetAttestationRequest
 	(*GetAttestationResponse)(nil), // 1: verify.GetAttestationResponse
+	nil,                            // 2: verify.GetAttestationRequest.ClaimsEntry
 }
 var file_verify_verifyproto_verify_proto_depIdxs = []int32{
-	0, // 0: verify.API.GetAttestation:input_type -> verify.GetAttestationRequest
-	1, // 1: verify.API.GetAttestation:output_type -> verify.GetAttestationResponse
-	1, // [1:2] is the sub-list for method output_type
-	0, // [0:1] is the sub-list for method input_type
-	0, // [0:0] is the sub-list for extension type_name
-	0, // [0:0] is the sub-list for extension extendee
-	0, // [0:0] is the sub-list for field type_name
+	2, // 0: verify.GetAttestationRequest.claims:type_name -> verify.GetAttestationRequest.ClaimsEntry
+	0, // 1: verify.API.GetAttestation:input_type -> verify.GetAttestationRequest
+	1, // 2: verify.API.GetAttestation:output_type -> verify.GetAttestationResponse
+	2, // [2:3] is the sub-list for method output_type
+	1, // [1:2] is the sub-list for method input_type
+	1, // [1:1] is the sub-list for extension type_name
+	1, // [1:1] is the sub-list for extension extendee
+	0, // [0:1] is the sub-list for field type_name
 }
 
 func init() { file_verify_verifyproto_verify_proto_init() }
@@ -163,7 +186,7 @@ func file_verify_verifyproto_verify_proto_init() {
 			GoPackagePath: reflect.TypeOf(x{}).PkgPath(),
 			RawDescriptor: unsafe.Slice(unsafe.StringData(file_verify_verifyproto_verify_proto_rawDesc), len(file_verify_verifyproto_verify_proto_rawDesc)),
 			NumEnums:      0,
-			NumMessages:   2,
+			NumMessages:   3,
 			NumExtensions: 0,
 			NumServices:   1,
 		},